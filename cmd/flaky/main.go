@@ -0,0 +1,26 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/mtnori/httpRetryExample/retryhttp/flaky"
+)
+
+// flaky は、指定した割合で失敗するレスポンスを返却するサーバーを起動する
+// 例: go run ./cmd/flaky -addr :8080 -latency 50ms
+// curl http://localhost:8080/status/200:0.2,500:0.8
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "listen address")
+	latency := flag.Duration("latency", 0, "latency added to every response")
+	jitter := flag.Duration("jitter", 0, "random latency added on top of -latency")
+	retryAfter := flag.Int("retry-after", 0, "Retry-After seconds for 429 and 503 responses")
+	flag.Parse()
+
+	server := flaky.NewFlakyServer(flaky.Config{Latency: *latency, Jitter: *jitter, RetryAfter: *retryAfter})
+	log.Printf("listening on %s", *addr)
+	srv := &http.Server{Addr: *addr, Handler: server, ReadHeaderTimeout: 10 * time.Second}
+	log.Fatal(srv.ListenAndServe())
+}
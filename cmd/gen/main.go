@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/mtnori/httpRetryExample/retryhttp/codegen"
+)
+
+// gen は指定した機能を設定した Client を作成するコードを出力する
+// 例: go run ./cmd/gen -features retry,metrics,otel,auth > client_gen.go
+func main() {
+	features := flag.String("features", "retry", "comma separated features: retry, metrics, otel, auth")
+	pkg := flag.String("package", "main", "package name of the generated code")
+	funcName := flag.String("func", "newClient", "name of the generated constructor")
+	flag.Parse()
+
+	parsed, err := codegen.ParseFeatures(*features)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = codegen.Generate(os.Stdout, codegen.Config{Package: *pkg, FuncName: *funcName, Features: parsed})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
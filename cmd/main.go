@@ -3,51 +3,244 @@ package main
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"flag"
 	"fmt"
-	myhttp "httpRetry/internal/pkg/http"
 	"io"
 	"log"
 	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mtnori/httpRetryExample/retryhttp"
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
 )
 
-type RequestBody struct {
-	Name string `json:"name"`
+// headerFlags は、-H で複数回指定できるリクエストヘッダー
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(value string) error {
+	if !strings.Contains(value, ":") {
+		return fmt.Errorf("header must be \"Key: Value\": %q", value)
+	}
+	*h = append(*h, value)
+	return nil
 }
 
+// main はリトライを行う curl のようなコマンド。レスポンスボディを標準出力に、試行ごとの結果を標準エラー出力に出力する
+// 例: go run ./cmd -X POST -H "Content-Type: application/json" -d '{"name":"Nori"}' http://127.0.0.1:8080/status/200:0.2,500:0.8
+// 失敗するサーバーは go run ./cmd/flaky で起動できる。設定ファイルと HTTPRETRY_ の環境変数の値は、明示したフラグで上書きする
 func main() {
-	var debugLevel = new(slog.LevelVar)
-	debugLevel.Set(slog.LevelDebug)
+	var headers headerFlags
+	method := flag.String("X", "", "request method (default: GET, or POST with -d)")
+	flag.Var(&headers, "H", "request header \"Key: Value\" (repeatable)")
+	data := flag.String("d", "", "request body; @file reads the body from file, @- from stdin")
+	configPath := flag.String("config", "", "JSON or YAML config file (see retryhttp.Config)")
+	attempts := flag.Int("attempts", 4, "max attempts including the first one")
+	backoffBase := flag.Duration("backoff-base", time.Second, "exponential backoff base")
+	backoffCap := flag.Duration("backoff-cap", 10*time.Second, "exponential backoff cap")
+	retryStatus := flag.String("retry-status", "408,429,500,502,503,504", "comma-separated status codes to retry")
+	timeout := flag.Duration("timeout", 30*time.Second, "overall timeout including retries")
+	retryNonIdempotent := flag.Bool("retry-non-idempotent", false, "retry POST and PATCH too")
+	include := flag.Bool("i", false, "include response headers in the output")
+	output := flag.String("o", "", "write the response body to file instead of stdout")
+	fail := flag.Bool("f", false, "exit with status 22 on HTTP 4xx and 5xx")
+	verbose := flag.Bool("v", false, "print request and response headers and debug logs")
+	silent := flag.Bool("s", false, "do not print per-attempt timing")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] URL\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
 
-	client := myhttp.NewClient()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	target := flag.Arg(0)
 
-	body := RequestBody{
-		Name: "Nori",
+	config, err := retryhttp.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
 	}
-	bodyJson, err := json.Marshal(body)
+	// NOTE: 明示したフラグのみで、設定ファイルと環境変数の値を上書きする
+	var parseErr error
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "attempts":
+			config.MaxAttempts = *attempts
+		case "backoff-base":
+			config.BackoffBase = *backoffBase
+		case "backoff-cap":
+			config.BackoffCap = *backoffCap
+		case "timeout":
+			config.Timeouts.Overall = *timeout
+		case "retry-status":
+			config.RetryStatusCodes, parseErr = parseStatusCodes(*retryStatus)
+		}
+	})
+	if parseErr != nil {
+		log.Fatal(parseErr)
+	}
+
+	body, err := readBody(*data)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if *method == "" {
+		*method = http.MethodGet
+		if body != nil {
+			*method = http.MethodPost
+		}
+	}
+
+	level := slog.LevelWarn
+	if *verbose {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
 
-	req, err := http.NewRequestWithContext(context.TODO(), http.MethodPost, "https://httpbin.org/status/200:0.2,500:0.8", bytes.NewReader(bodyJson))
-	req.Header.Set("Content-Type", "application/json")
+	client, err := retryhttp.NewClientFromConfig(config,
+		retryhttp.WithLogger(logger),
+		retryhttp.WithRetryNonIdempotent(*retryNonIdempotent),
+		retryhttp.WithTransportOptions(attemptTimings(os.Stderr, *silent)...),
+	)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	res, err := client.Do(req)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, *method, target, reader)
 	if err != nil {
 		log.Fatal(err)
 	}
+	for _, header := range headers {
+		key, value, _ := strings.Cut(header, ":")
+		req.Header.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+	}
+	if *verbose {
+		fmt.Fprintf(os.Stderr, "> %s %s\n", req.Method, req.URL)
+		writeHeaders(os.Stderr, "> ", req.Header)
+	}
 
+	res, err := client.Do(req)
+	if err != nil {
+		log.Fatal(err)
+	}
 	defer res.Body.Close()
-	fmt.Println(res.Status)
 
-	b, err := io.ReadAll(res.Body)
-	if err != nil {
+	if *verbose {
+		fmt.Fprintf(os.Stderr, "< %s %s\n", res.Proto, res.Status)
+		writeHeaders(os.Stderr, "< ", res.Header)
+	}
+
+	out := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		out = f
+	}
+	if *include {
+		fmt.Fprintf(out, "%s %s\n", res.Proto, res.Status)
+		writeHeaders(out, "", res.Header)
+		fmt.Fprintln(out)
+	}
+	if _, err := io.Copy(out, res.Body); err != nil {
 		log.Fatal(err)
 	}
 
-	fmt.Printf("%s", b)
+	if *fail && res.StatusCode >= http.StatusBadRequest {
+		// NOTE: curl -f と同じ終了コード
+		os.Exit(22)
+	}
+}
+
+// readBody は -d の値からリクエストボディを返却する。@file の場合はファイル、@- の場合は標準入力から読み込む
+func readBody(data string) ([]byte, error) {
+	switch {
+	case data == "":
+		return nil, nil
+	case data == "@-":
+		return io.ReadAll(os.Stdin)
+	case strings.HasPrefix(data, "@"):
+		return os.ReadFile(data[1:])
+	}
+	return []byte(data), nil
+}
+
+// parseStatusCodes はカンマ区切りのステータスコードを解析する
+func parseStatusCodes(value string) ([]int, error) {
+	var codes []int
+	for _, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		code, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code %q", field)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// attemptTimings は、試行ごとの結果と所要時間、リトライまでの待機時間を w に出力するフックを返却する
+func attemptTimings(w io.Writer, silent bool) []retryabletransport.Option {
+	if silent {
+		return nil
+	}
+	var mu sync.Mutex
+	starts := map[int]time.Time{}
+	return []retryabletransport.Option{
+		retryabletransport.WithOnRequest(func(attempt int, req *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			starts[attempt] = time.Now()
+		}),
+		retryabletransport.WithOnResponse(func(attempt int, res *http.Response, err error) {
+			mu.Lock()
+			elapsed := time.Since(starts[attempt])
+			mu.Unlock()
+			if err != nil {
+				fmt.Fprintf(w, "* attempt %d: error after %s: %v\n", attempt, elapsed.Round(time.Millisecond), err)
+				return
+			}
+			fmt.Fprintf(w, "* attempt %d: %s in %s\n", attempt, res.Status, elapsed.Round(time.Millisecond))
+		}),
+		retryabletransport.WithOnRetry(func(attempt int, wait time.Duration, reason retryabletransport.RetryReason) {
+			fmt.Fprintf(w, "* retrying in %s (%s)\n", wait.Round(time.Millisecond), reason)
+		}),
+	}
+}
+
+// writeHeaders はヘッダーを 1 行ずつ prefix を付けて出力する
+func writeHeaders(w io.Writer, prefix string, header http.Header) {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range header[key] {
+			fmt.Fprintf(w, "%s%s: %s\n", prefix, key, value)
+		}
+	}
 }
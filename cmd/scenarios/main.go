@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/mtnori/httpRetryExample/retryhttp/integration"
+)
+
+// scenarios は、YAML で定義したシナリオを同梱の FlakyServer に対して実行し、結果を出力する
+// いずれかのシナリオが期待値と一致しなかった場合は終了コード 1 で終了する
+// 例: go run ./cmd/scenarios -run Retry-After retryhttp/integration/scenarios
+func main() {
+	run := flag.String("run", "", "only run scenarios whose name contains this string")
+	flag.Parse()
+
+	path := "retryhttp/integration/scenarios"
+	if flag.NArg() > 0 {
+		path = flag.Arg(0)
+	}
+	scenarios, err := integration.LoadScenarios(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	failed := 0
+	for _, s := range scenarios {
+		if !strings.Contains(s.Name, *run) {
+			continue
+		}
+		report := s.Run(context.Background())
+		if report.Passed() {
+			fmt.Printf("ok    %s (%d attempts, %s)\n", report.Name, report.Attempts, report.Elapsed.Round(1e6))
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL  %s\n", report.Name)
+		for _, f := range report.Failures {
+			fmt.Printf("      %s\n", f)
+		}
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
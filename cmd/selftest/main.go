@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/mtnori/httpRetryExample/retryhttp"
+)
+
+// selftest は接続先への名前解決、TCP、TLS、HTTP の疎通を確認し、結果を JSON で出力する
+// いずれかの確認に失敗した場合は終了コード 1 で終了する
+// 例: go run ./cmd/selftest https://httpbin.org/get https://example.com
+func main() {
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout for all checks")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	report := retryhttp.NewClient().SelfTest(ctx, flag.Args())
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Fatal(err)
+	}
+	if !report.OK() {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/mtnori/httpRetryExample/retryhttp/tuning"
+)
+
+// tune は対象のエンドポイントを計測し、リトライポリシーの初期設定を提案する
+// 例: go run ./cmd/tune -url https://httpbin.org/get -n 200 -c 8
+func main() {
+	url := flag.String("url", "", "target URL (required)")
+	method := flag.String("method", "GET", "GET or HEAD")
+	requests := flag.Int("n", 100, "number of requests")
+	concurrency := flag.Int("c", 4, "concurrent requests")
+	timeout := flag.Duration("timeout", 30*time.Second, "timeout per request")
+	warmup := flag.Int("warmup", 5, "requests sent before measuring to warm up connections")
+	flag.Parse()
+
+	if *url == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// コネクションの確立や TLS ハンドシェイクの時間が計測結果に含まれないように、事前にリクエストを送信する
+	if *warmup > 0 {
+		if _, err := tuning.Probe(ctx, tuning.ProbeConfig{URL: *url, Method: *method, Requests: *warmup, Concurrency: *concurrency, Timeout: *timeout}); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	result, err := tuning.Probe(ctx, tuning.ProbeConfig{URL: *url, Method: *method, Requests: *requests, Concurrency: *concurrency, Timeout: *timeout})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("requests: %d, errors: %d, throttled: %d, server errors: %d\n", result.Requests, result.Errors, result.Throttled, result.ServerErrors)
+	fmt.Printf("latency p50: %s, p95: %s, p99: %s\n", result.Percentile(50), result.Percentile(95), result.Percentile(99))
+
+	rec := tuning.Recommend(result)
+	fmt.Println()
+	fmt.Println("recommended configuration:")
+	fmt.Printf("  TimeoutConfig.PerAttempt: %s\n", rec.PerAttemptTimeout)
+	fmt.Printf("  WithBackoff(ExponentialBackoff(%s, %s))\n", rec.BackoffBase, rec.BackoffCap)
+	fmt.Printf("  WithMaxAttempts(%d)\n", rec.MaxAttempts)
+	for _, note := range rec.Notes {
+		fmt.Printf("  - %s\n", note)
+	}
+}
@@ -0,0 +1,246 @@
+package retryhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// maxPollBodySize はステータスの判定のために読み込むポーリングのレスポンスボディの最大サイズ
+const maxPollBodySize = 1 << 20
+
+// ErrOperationTimeout は、非同期処理が制限時間内に完了しなかったことを表すエラー
+var ErrOperationTimeout = errors.New("async operation did not complete in time")
+
+// OperationFailedError は、非同期処理が失敗またはキャンセルされたことを表すエラー
+type OperationFailedError struct {
+	// Status は非同期処理のステータス (例: Failed, Canceled)
+	Status string
+	// Body はステータス URL のレスポンスボディ
+	Body []byte
+}
+
+func (e *OperationFailedError) Error() string {
+	return fmt.Sprintf("async operation %s", strings.ToLower(e.Status))
+}
+
+// CompletionFunc は、ステータス URL のレスポンスから非同期処理が完了したか判定する関数の型定義
+// body はバッファリング済みのレスポンスボディ。失敗した場合はエラーを返却する
+type CompletionFunc func(res *http.Response, body []byte) (done bool, err error)
+
+// pollConfig は DoAndPoll の設定
+type pollConfig struct {
+	backoff    retryabletransport.BackoffFunc
+	timeout    time.Duration
+	completion CompletionFunc
+}
+
+// PollOption は DoAndPoll の設定を変更する関数の型定義
+type PollOption func(*pollConfig)
+
+// WithPollBackoff は、ポーリングの間隔を設定する。Retry-After ヘッダーがある場合はそちらを優先する
+func WithPollBackoff(backoff retryabletransport.BackoffFunc) PollOption {
+	return func(c *pollConfig) {
+		c.backoff = backoff
+	}
+}
+
+// WithPollTimeout は、非同期処理の完了を待つ制限時間を設定する
+func WithPollTimeout(timeout time.Duration) PollOption {
+	return func(c *pollConfig) {
+		c.timeout = timeout
+	}
+}
+
+// WithCompletionCheck は、非同期処理が完了したか判定する関数を設定する
+func WithCompletionCheck(completion CompletionFunc) PollOption {
+	return func(c *pollConfig) {
+		c.completion = completion
+	}
+}
+
+// DoAndPoll はリクエストを送信し、202 Accepted と Operation-Location または Location ヘッダーが返却された場合は、
+// 非同期処理が完了するまでステータス URL をポーリングして最終的なリソースを返却する
+// 202 以外のレスポンスと、ステータス URL のない 202 のレスポンスはそのまま返却する。レスポンスボディのクローズは呼び出し元で行う必要がある
+// NOTE: クラウドの API でよく使われる長時間実行操作 (Long Running Operation) のパターンに対応する
+func (c *Client) DoAndPoll(req *http.Request, opts ...PollOption) (*http.Response, error) {
+	config := pollConfig{
+		backoff:    pollBackoff,
+		timeout:    5 * time.Minute,
+		completion: defaultCompletion,
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusAccepted {
+		return res, nil
+	}
+
+	statusURL, err := operationLocation(req, res)
+	if err != nil {
+		// ステータス URL がない場合はポーリングできないため、202 のレスポンスをボディを含めてそのまま返却する
+		return res, nil
+	}
+	wait := retryAfter(res)
+	closeBody(res)
+
+	ctx, cancel := context.WithTimeout(req.Context(), config.timeout)
+	defer cancel()
+
+	for attempts := 1; ; attempts++ {
+		if wait <= 0 {
+			wait = config.backoff(attempts)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, pollError(ctx, req, ctx.Err())
+		case <-timer.C:
+		}
+
+		res, body, err := c.poll(ctx, req, statusURL)
+		if err != nil {
+			return nil, pollError(ctx, req, err)
+		}
+		wait = retryAfter(res)
+
+		if res.StatusCode == http.StatusAccepted {
+			continue
+		}
+		done, err := config.completion(res, body)
+		if err != nil {
+			return nil, err
+		}
+		if !done {
+			continue
+		}
+
+		// 完了したステータスに最終的なリソースの URL が含まれている場合は取得する
+		if resourceURL := resourceLocation(statusURL, body); resourceURL != "" {
+			return c.Send(req.Context(), http.MethodGet, resourceURL, nil, copyAuthorization(req))
+		}
+		res.Body = io.NopCloser(bytes.NewReader(body))
+		return res, nil
+	}
+}
+
+// pollError は、ポーリングの制限時間を超えた場合は ErrOperationTimeout を、それ以外の場合は err を返却する
+// NOTE: ステータス URL へのリクエスト中に制限時間を超えた場合も、元のリクエストのキャンセルと区別する
+func pollError(ctx context.Context, origin *http.Request, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) && origin.Context().Err() == nil {
+		return ErrOperationTimeout
+	}
+	return err
+}
+
+// poll はステータス URL に GET リクエストを送信し、レスポンスボディをバッファリングする
+func (c *Client) poll(ctx context.Context, origin *http.Request, statusURL string) (*http.Response, []byte, error) {
+	res, err := c.Send(ctx, http.MethodGet, statusURL, nil, copyAuthorization(origin))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer closeBody(res)
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxPollBodySize))
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, body, nil
+}
+
+// copyAuthorization は元のリクエストの Authorization ヘッダーを引き継ぐ RequestOption を返却する
+func copyAuthorization(origin *http.Request) RequestOption {
+	return func(req *http.Request) {
+		if v := origin.Header.Get("Authorization"); v != "" {
+			req.Header.Set("Authorization", v)
+		}
+	}
+}
+
+// operationLocation はステータス URL を取得する。相対 URL の場合は元のリクエストの URL を基準に解決する
+func operationLocation(req *http.Request, res *http.Response) (string, error) {
+	location := res.Header.Get("Operation-Location")
+	if location == "" {
+		location = res.Header.Get("Location")
+	}
+	if location == "" {
+		return "", errors.New("no operation location")
+	}
+	u, err := req.URL.Parse(location)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// operationStatus は非同期処理のステータスのレスポンスボディ
+type operationStatus struct {
+	Status           string `json:"status"`
+	ResourceLocation string `json:"resourceLocation"`
+}
+
+// defaultCompletion は、レスポンスボディの status フィールドから非同期処理が完了したか判定する
+// status フィールドがない場合は、レスポンス自体を最終的なリソースとみなす
+func defaultCompletion(res *http.Response, body []byte) (bool, error) {
+	if res.StatusCode >= http.StatusBadRequest {
+		return false, &StatusError{StatusCode: res.StatusCode, Status: res.Status, Problem: decodeProblem(res.Header, body)}
+	}
+
+	var status operationStatus
+	if err := json.Unmarshal(body, &status); err != nil || status.Status == "" {
+		return true, nil
+	}
+	switch strings.ToLower(status.Status) {
+	case "succeeded", "completed", "done":
+		return true, nil
+	case "failed", "canceled", "cancelled":
+		return false, &OperationFailedError{Status: status.Status, Body: body}
+	default:
+		return false, nil
+	}
+}
+
+// resourceLocation は、完了したステータスのレスポンスボディから最終的なリソースの URL を取得する
+// 相対 URL の場合はステータス URL を基準に解決する
+func resourceLocation(statusURL string, body []byte) string {
+	var status operationStatus
+	if err := json.Unmarshal(body, &status); err != nil || status.ResourceLocation == "" {
+		return ""
+	}
+	base, err := url.Parse(statusURL)
+	if err != nil {
+		return status.ResourceLocation
+	}
+	u, err := base.Parse(status.ResourceLocation)
+	if err != nil {
+		return status.ResourceLocation
+	}
+	return u.String()
+}
+
+// retryAfter は Retry-After ヘッダー (秒数または HTTP-date) の値を返却する。ない場合は 0
+func retryAfter(res *http.Response) time.Duration {
+	wait, _ := retryabletransport.ParseRetryAfter(res, time.Now())
+	return wait
+}
+
+// pollBackoff はポーリング間隔のデフォルト。1 秒から倍々に増加し、30 秒を上限とする
+func pollBackoff(attempts int) time.Duration {
+	wait := time.Second << min(attempts-1, 5)
+	return min(wait, 30*time.Second)
+}
@@ -0,0 +1,157 @@
+package retryhttp
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// newTestClient は、ログを出力せずにリトライの待機をしない Client を作成する
+func newTestClient(opts ...Option) *Client {
+	return NewClient(append([]Option{
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithBackoff(retryabletransport.Constant(0)),
+	}, opts...)...)
+}
+
+// readBody はレスポンスボディを読み込んでクローズする
+func readBody(t *testing.T, res *http.Response) string {
+	t.Helper()
+
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	return string(body)
+}
+
+// pollNow はポーリングの間隔を待機しない PollOption
+var pollNow = WithPollBackoff(func(int) time.Duration { return time.Millisecond })
+
+func TestDoAndPollWithoutAccepted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "created")
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	res, err := newTestClient().DoAndPoll(req, pollNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusCreated || readBody(t, res) != "created" {
+		t.Errorf("response = %d, want 201 created", res.StatusCode)
+	}
+}
+
+// TestDoAndPollAcceptedWithoutLocation は、ステータス URL のない 202 をボディを含めてそのまま返却することを検証する
+func TestDoAndPollAcceptedWithoutLocation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, `{"id":"op-1"}`)
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	res, err := newTestClient().DoAndPoll(req, pollNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusAccepted {
+		t.Errorf("status = %d, want 202", res.StatusCode)
+	}
+	if body := readBody(t, res); body != `{"id":"op-1"}` {
+		t.Errorf("body = %q, want the 202 body", body)
+	}
+}
+
+func TestDoAndPoll(t *testing.T) {
+	tests := []struct {
+		name string
+		// statuses はステータス URL が順に返却するレスポンスボディ
+		statuses []string
+		wantBody string
+		wantErr  error
+	}{
+		{
+			name:     "succeeded with the resource location",
+			statuses: []string{`{"status":"Running"}`, `{"status":"Succeeded","resourceLocation":"/resource"}`},
+			wantBody: "resource",
+		},
+		{
+			name:     "completed status is the result",
+			statuses: []string{`{"status":"Running"}`, `{"status":"Completed"}`},
+			wantBody: `{"status":"Completed"}`,
+		},
+		{
+			name:     "failed",
+			statuses: []string{`{"status":"Failed"}`},
+			wantErr:  &OperationFailedError{Status: "Failed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var polls atomic.Int64
+			mux := http.NewServeMux()
+			mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Operation-Location", "/status")
+				w.WriteHeader(http.StatusAccepted)
+			})
+			mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer token" {
+					t.Errorf("poll Authorization = %q", r.Header.Get("Authorization"))
+				}
+				n := int(polls.Add(1))
+				io.WriteString(w, tt.statuses[min(n, len(tt.statuses))-1])
+			})
+			mux.HandleFunc("/resource", func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "resource")
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			req, _ := http.NewRequest(http.MethodPost, server.URL+"/start", nil)
+			req.Header.Set("Authorization", "Bearer token")
+			res, err := newTestClient().DoAndPoll(req, pollNow)
+			if tt.wantErr != nil {
+				var failed *OperationFailedError
+				if !errors.As(err, &failed) || failed.Status != "Failed" {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if body := readBody(t, res); body != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+			if got := int(polls.Load()); got != len(tt.statuses) {
+				t.Errorf("polls = %d, want %d", got, len(tt.statuses))
+			}
+		})
+	}
+}
+
+func TestDoAndPollTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "/status")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	_, err := newTestClient().DoAndPoll(req, pollNow, WithPollTimeout(50*time.Millisecond))
+	if !errors.Is(err, ErrOperationTimeout) {
+		t.Errorf("err = %v, want ErrOperationTimeout", err)
+	}
+}
@@ -0,0 +1,44 @@
+package retryhttp
+
+import (
+	"context"
+	"iter"
+	"time"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// Attempts は、最初の試行を含む最大 maxAttempts 回の試行番号 (1 から開始) を返却するイテレーター
+// 2 回目以降は backoff の待機時間が経過してから次の試行番号を返却する。backoff が nil の場合は、NewClient と同じ指数バックオフを使用する
+// 成功した場合はループを抜け、ctx が終了した場合はその時点で終了するため、ループの後に ctx.Err() を確認する
+// NOTE: HTTP 以外の処理 (メッセージの送信など) を同じポリシーでリトライする独自のループに使用する
+//
+//	for attempt := range retryhttp.Attempts(ctx, 5, nil) {
+//		if err = send(ctx); err == nil {
+//			break
+//		}
+//	}
+func Attempts(ctx context.Context, maxAttempts int, backoff retryabletransport.BackoffFunc) iter.Seq[int] {
+	if backoff == nil {
+		backoff = exponentialBackoffAndFullJitter(1000, 10000, newLockedRand(nil))
+	}
+	return func(yield func(int) bool) {
+		for attempt := 1; attempt <= maxAttempts; attempt++ {
+			if attempt > 1 {
+				timer := time.NewTimer(backoff(attempt - 1))
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if !yield(attempt) {
+				return
+			}
+		}
+	}
+}
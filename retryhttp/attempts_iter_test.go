@@ -0,0 +1,54 @@
+package retryhttp
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAttempts(t *testing.T) {
+	var waits []int
+	backoff := func(attempts int) time.Duration {
+		waits = append(waits, attempts)
+		return 0
+	}
+
+	var got []int
+	for attempt := range Attempts(context.Background(), 3, backoff) {
+		got = append(got, attempt)
+	}
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("attempts = %v, want %v", got, want)
+	}
+	// バックオフは 2 回目以降の試行の前に、前回までの試行回数で呼び出す
+	if want := []int{1, 2}; !reflect.DeepEqual(waits, want) {
+		t.Errorf("backoff calls = %v, want %v", waits, want)
+	}
+}
+
+func TestAttemptsBreak(t *testing.T) {
+	calls := 0
+	for attempt := range Attempts(context.Background(), 5, func(int) time.Duration { calls++; return 0 }) {
+		if attempt == 2 {
+			break
+		}
+	}
+	if calls != 1 {
+		t.Errorf("backoff calls = %d, want 1", calls)
+	}
+}
+
+// TestAttemptsCanceled は、バックオフの待機中に ctx が終了した場合に、次の試行番号を返却せずに終了することを検証する
+func TestAttemptsCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var got []int
+	for attempt := range Attempts(ctx, 3, func(int) time.Duration { return time.Hour }) {
+		got = append(got, attempt)
+		cancel()
+	}
+	if want := []int{1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("attempts = %v, want %v", got, want)
+	}
+}
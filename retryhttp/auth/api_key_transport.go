@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// APIKeySlot は、リクエストに付与した API キーの種類
+type APIKeySlot int
+
+const (
+	// PrimaryKey はプライマリの API キー
+	PrimaryKey APIKeySlot = iota
+	// SecondaryKey はセカンダリの API キー
+	SecondaryKey
+)
+
+func (s APIKeySlot) String() string {
+	if s == SecondaryKey {
+		return "secondary"
+	}
+	return "primary"
+}
+
+// apiKeySlotKey は context.Context に付与した API キーの種類を格納するためのキー
+type apiKeySlotKey struct{}
+
+// APIKeyFromResponse は、APIKeyTransport が返却したレスポンスのリクエストに付与した API キーの種類を返却する
+// APIKeyTransport を経由していないレスポンスの場合は false を返却する
+// NOTE: キーのローテーション中に、セカンダリのキーで成功したリクエストを検出するために使用する
+func APIKeyFromResponse(res *http.Response) (APIKeySlot, bool) {
+	if res == nil || res.Request == nil {
+		return PrimaryKey, false
+	}
+	slot, ok := res.Request.Context().Value(apiKeySlotKey{}).(APIKeySlot)
+	return slot, ok
+}
+
+// APIKeyTransport は API キーをヘッダーに付与するための http.RoundTripper 具象型
+// 401 を受け取った場合は、もう一方の API キーで 1 回だけリクエストを再送する
+// セカンダリのキーで成功した場合は、SetKeys でキーを更新するまでセカンダリのキーを優先して付与する
+// NOTE: プライマリのキーを失効させるローテーションの期間中も、リクエストを失敗させずに新しいキーに切り替えるために使用する
+type APIKeyTransport struct {
+	wrapped http.RoundTripper
+	header  string
+
+	mu        sync.Mutex
+	keys      [2]string
+	preferred APIKeySlot
+}
+
+// NewAPIKeyTransport は APIKeyTransport 構造体を作成する
+// header は API キーを付与するヘッダー名 (例: X-API-Key)。secondary が空文字の場合は再送しない
+func NewAPIKeyTransport(transport http.RoundTripper, header string, primary string, secondary string) *APIKeyTransport {
+	return &APIKeyTransport{
+		wrapped: transport,
+		header:  header,
+		keys:    [2]string{primary, secondary},
+	}
+}
+
+// SetKeys は API キーを更新し、プライマリのキーを優先して付与するように戻す
+func (t *APIKeyTransport) SetKeys(primary string, secondary string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.keys = [2]string{primary, secondary}
+	t.preferred = PrimaryKey
+}
+
+// Preferred は、現在優先して付与している API キーの種類を返却する
+func (t *APIKeyTransport) Preferred() APIKeySlot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.preferred
+}
+
+// transport は親の Transport を返却する。親がない場合は、http.DefaultTransport を返却する
+func (t *APIKeyTransport) transport() http.RoundTripper {
+	if t.wrapped == nil {
+		return http.DefaultTransport
+	}
+	return t.wrapped
+}
+
+// RoundTrip は API キーを付与してリクエストを送信する
+func (t *APIKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	keys, slot := t.keys, t.preferred
+	t.mu.Unlock()
+
+	res, err := t.send(req, slot, keys[slot])
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+
+	// もう一方のキーがない場合や、リクエストボディを再送できない場合はそのまま返却する
+	fallback := 1 - slot
+	if keys[fallback] == "" || !canResend(req) {
+		return res, nil
+	}
+
+	// コネクションを再利用するためにレスポンスボディを読み切ってクローズする
+	drainBody(res)
+
+	resent, err := resendable(req)
+	if err != nil {
+		return nil, err
+	}
+	res, err = t.send(resent, fallback, keys[fallback])
+	if err != nil || res.StatusCode == http.StatusUnauthorized {
+		return res, err
+	}
+
+	// NOTE: SetKeys でキーが更新されていない場合のみ、成功したキーを優先するように切り替える
+	t.mu.Lock()
+	if t.keys == keys {
+		t.preferred = fallback
+	}
+	t.mu.Unlock()
+	return res, nil
+}
+
+// send は API キーをヘッダーに付与し、リクエストを送信する
+func (t *APIKeyTransport) send(req *http.Request, slot APIKeySlot, key string) (*http.Response, error) {
+	// NOTE: http.RoundTripper はリクエストを変更してはいけないため、複製してからヘッダーを付与する
+	authorized := req.Clone(context.WithValue(req.Context(), apiKeySlotKey{}, slot))
+	authorized.Header.Set(t.header, key)
+	return t.transport().RoundTrip(authorized)
+}
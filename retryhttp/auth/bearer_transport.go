@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"net/http"
+)
+
+// BearerTransport は TokenProvider から取得したトークンを Authorization ヘッダーに付与するための http.RoundTripper 具象型
+// 401 を受け取った場合は、トークンを破棄して再取得し、1 回だけリクエストを再送する
+// NOTE: RetryableTransport の内側に配置することで、リトライのたびに最新のトークンを付与する
+type BearerTransport struct {
+	wrapped  http.RoundTripper
+	provider TokenProvider
+}
+
+// NewBearerTransport は BearerTransport 構造体を作成する
+func NewBearerTransport(transport http.RoundTripper, provider TokenProvider) *BearerTransport {
+	return &BearerTransport{
+		wrapped:  transport,
+		provider: provider,
+	}
+}
+
+// transport は親の Transport を返却する。親がない場合は、http.DefaultTransport を返却する
+func (t *BearerTransport) transport() http.RoundTripper {
+	if t.wrapped == nil {
+		return http.DefaultTransport
+	}
+	return t.wrapped
+}
+
+// RoundTrip はトークンを付与してリクエストを送信する
+func (t *BearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.send(req)
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+
+	// トークンを破棄できない場合や、リクエストボディを再送できない場合はそのまま返却する
+	invalidator, ok := t.provider.(Invalidator)
+	if !ok || !canResend(req) {
+		return res, nil
+	}
+	invalidator.Invalidate()
+
+	// コネクションを再利用するためにレスポンスボディを読み切ってクローズする
+	drainBody(res)
+
+	resent, err := resendable(req)
+	if err != nil {
+		return nil, err
+	}
+	return t.send(resent)
+}
+
+// send はトークンを取得して Authorization ヘッダーに付与し、リクエストを送信する
+func (t *BearerTransport) send(req *http.Request) (*http.Response, error) {
+	token, err := t.provider.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE: http.RoundTripper はリクエストを変更してはいけないため、複製してからヘッダーを付与する
+	authorized := req.Clone(req.Context())
+	authorized.Header.Set("Authorization", "Bearer "+token)
+	return t.transport().RoundTrip(authorized)
+}
@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrCSRFTokenNotFound は、トークン取得用のエンドポイントのレスポンスに CSRF トークンが含まれていないことを表すエラー
+var ErrCSRFTokenNotFound = errors.New("csrf token not found")
+
+// csrfPeekSize は CSRF エラーを判定するために読み込むレスポンスボディの最大サイズ
+const csrfPeekSize = 4 * 1024
+
+// CSRFConfig は CSRFTransport の設定
+type CSRFConfig struct {
+	// TokenURL は CSRF トークンを取得するエンドポイント。GET リクエストを送信する
+	TokenURL string
+	// HeaderName はリクエストに CSRF トークンを付与するヘッダー名。空文字の場合は "X-CSRF-Token"
+	HeaderName string
+	// ResponseHeader はトークン取得用のエンドポイントのレスポンスでトークンを格納しているヘッダー名。空文字の場合は HeaderName
+	ResponseHeader string
+	// CookieName を指定した場合は、ヘッダーではなく Set-Cookie からトークンを取得し、以降のリクエストに Cookie も付与する
+	CookieName string
+	// IsCSRFError はレスポンスが CSRF トークンの不一致によるエラーか判定する関数
+	// nil の場合は、403 かつ ボディまたは "X-CSRF-Token: Required" ヘッダーに CSRF を示す内容があるものを CSRF エラーとみなす
+	IsCSRFError func(res *http.Response) bool
+}
+
+// CSRFTransport は、状態を変更するリクエスト (POST, PUT, PATCH, DELETE) に CSRF トークンを付与するための http.RoundTripper 具象型
+// CSRF エラーの 403 を受け取った場合は、トークンを再取得して 1 回だけ再送する
+type CSRFTransport struct {
+	wrapped http.RoundTripper
+	config  CSRFConfig
+	// fetches は、並行して取得し直すトークンの取得を 1 回にまとめる
+	fetches singleflight.Group
+
+	mu     sync.Mutex
+	token  string
+	cookie *http.Cookie
+}
+
+// csrfToken はトークン取得用のエンドポイントから取得した CSRF トークン
+type csrfToken struct {
+	value  string
+	cookie *http.Cookie
+}
+
+// NewCSRFTransport は CSRFTransport 構造体を作成する
+func NewCSRFTransport(transport http.RoundTripper, config CSRFConfig) *CSRFTransport {
+	if config.HeaderName == "" {
+		config.HeaderName = "X-CSRF-Token"
+	}
+	if config.ResponseHeader == "" {
+		config.ResponseHeader = config.HeaderName
+	}
+	if config.IsCSRFError == nil {
+		config.IsCSRFError = isCSRFError
+	}
+	return &CSRFTransport{
+		wrapped: transport,
+		config:  config,
+	}
+}
+
+// transport は親の Transport を返却する。親がない場合は、http.DefaultTransport を返却する
+func (t *CSRFTransport) transport() http.RoundTripper {
+	if t.wrapped == nil {
+		return http.DefaultTransport
+	}
+	return t.wrapped
+}
+
+// RoundTrip は状態を変更するリクエストに CSRF トークンを付与して送信する
+func (t *CSRFTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isMutating(req.Method) {
+		return t.transport().RoundTrip(req)
+	}
+
+	token, cookie, err := t.currentToken(req, "")
+	if err != nil {
+		return nil, err
+	}
+	res, err := t.send(req, token, cookie)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusForbidden || !t.config.IsCSRFError(res) || !canResend(req) {
+		return res, nil
+	}
+	drainBody(res)
+
+	// トークンを再取得して 1 回だけ再送する
+	token, cookie, err = t.currentToken(req, token)
+	if err != nil {
+		return nil, err
+	}
+	resent, err := resendable(req)
+	if err != nil {
+		return nil, err
+	}
+	return t.send(resent, token, cookie)
+}
+
+// send は CSRF トークンを付与してリクエストを送信する
+func (t *CSRFTransport) send(req *http.Request, token string, cookie *http.Cookie) (*http.Response, error) {
+	withToken := req.Clone(req.Context())
+	withToken.Header.Set(t.config.HeaderName, token)
+	if cookie != nil {
+		if _, err := withToken.Cookie(cookie.Name); err != nil {
+			withToken.AddCookie(cookie)
+		}
+	}
+	return t.transport().RoundTrip(withToken)
+}
+
+// currentToken はキャッシュしている CSRF トークンを返却する。未取得またはキャッシュしているトークンが stale の場合は取得し直す
+// NOTE: トークンの取得中にロックを保持しないように、並行した取得は singleflight で 1 回にまとめ、呼び出し元ごとに req のコンテキストで待機する
+// stale には拒否されたトークンを指定し、他のリクエストが取得し直したトークンがあれば、それを使用する
+func (t *CSRFTransport) currentToken(req *http.Request, stale string) (string, *http.Cookie, error) {
+	t.mu.Lock()
+	token, cookie := t.token, t.cookie
+	t.mu.Unlock()
+	if token != "" && token != stale {
+		return token, cookie, nil
+	}
+
+	ch := t.fetches.DoChan("", func() (any, error) {
+		// 直前に完了した取得があれば、そのトークンを使用する
+		t.mu.Lock()
+		token, cookie := t.token, t.cookie
+		t.mu.Unlock()
+		if token != "" && token != stale {
+			return csrfToken{value: token, cookie: cookie}, nil
+		}
+		return t.fetchToken(req)
+	})
+	select {
+	case result := <-ch:
+		if result.Err != nil {
+			return "", nil, result.Err
+		}
+		fetched := result.Val.(csrfToken)
+		return fetched.value, fetched.cookie, nil
+	case <-req.Context().Done():
+		return "", nil, req.Context().Err()
+	}
+}
+
+// fetchToken はトークン取得用のエンドポイントから CSRF トークンを取得してキャッシュする
+// NOTE: まとめた他のリクエストも結果を待機するため、最初に取得を開始したリクエストがキャンセルされても取得を続ける
+func (t *CSRFTransport) fetchToken(req *http.Request) (csrfToken, error) {
+	fetch, err := http.NewRequestWithContext(context.WithoutCancel(req.Context()), http.MethodGet, t.config.TokenURL, nil)
+	if err != nil {
+		return csrfToken{}, err
+	}
+	// SAP などのトークン取得の慣例に合わせて、トークンを要求するヘッダーを付与する
+	fetch.Header.Set(t.config.ResponseHeader, "Fetch")
+	// 認証情報など、元のリクエストのヘッダーを引き継ぐ
+	for _, name := range []string{"Authorization", "Cookie"} {
+		if v := req.Header.Get(name); v != "" {
+			fetch.Header.Set(name, v)
+		}
+	}
+
+	res, err := t.transport().RoundTrip(fetch)
+	if err != nil {
+		return csrfToken{}, fmt.Errorf("fetch csrf token: %w", err)
+	}
+	defer drainBody(res)
+
+	var fetched csrfToken
+	if t.config.CookieName != "" {
+		for _, c := range res.Cookies() {
+			if c.Name == t.config.CookieName {
+				fetched = csrfToken{value: c.Value, cookie: &http.Cookie{Name: c.Name, Value: c.Value}}
+			}
+		}
+	} else {
+		fetched.value = res.Header.Get(t.config.ResponseHeader)
+	}
+	if fetched.value == "" {
+		return csrfToken{}, fmt.Errorf("%w: %s returned %s", ErrCSRFTokenNotFound, t.config.TokenURL, res.Status)
+	}
+
+	t.mu.Lock()
+	t.token, t.cookie = fetched.value, fetched.cookie
+	t.mu.Unlock()
+	return fetched, nil
+}
+
+// isMutating は状態を変更する HTTP メソッドか判定する
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// isCSRFError はレスポンスが CSRF エラーか判定する
+// NOTE: ボディを読み込んで判定するため、読み込んだ内容を戻したボディに差し替える
+func isCSRFError(res *http.Response) bool {
+	if strings.EqualFold(res.Header.Get("X-CSRF-Token"), "Required") {
+		return true
+	}
+	if res.Body == nil {
+		return false
+	}
+
+	peeked, err := io.ReadAll(io.LimitReader(res.Body, csrfPeekSize))
+	res.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(peeked), res.Body), res.Body}
+	if err != nil {
+		return false
+	}
+	return bytes.Contains(bytes.ToLower(peeked), []byte("csrf"))
+}
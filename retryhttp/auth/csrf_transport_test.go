@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// csrfServer は、/token で現在の CSRF トークンを返却し、それ以外のパスでトークンを検証するテスト用のサーバー
+type csrfServer struct {
+	mu      sync.Mutex
+	current string
+	// release を設定した場合は、クローズするまで /token のレスポンスを返却しない
+	release chan struct{}
+	fetches atomic.Int64
+}
+
+func (s *csrfServer) token() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current
+}
+
+func (s *csrfServer) rotate(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = token
+}
+
+func (s *csrfServer) RoundTrip(req *http.Request) (*http.Response, error) {
+	res := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: http.NoBody, Request: req}
+	if req.URL.Path == "/token" {
+		s.fetches.Add(1)
+		if s.release != nil {
+			<-s.release
+		}
+		res.Header.Set("X-CSRF-Token", s.token())
+		return res, nil
+	}
+	if req.Header.Get("X-CSRF-Token") != s.token() {
+		res.StatusCode = http.StatusForbidden
+		res.Body = io.NopCloser(strings.NewReader("CSRF token invalid"))
+	}
+	return res, nil
+}
+
+// post は transport で POST を送信し、ステータスコードを返却する
+func post(ctx context.Context, transport http.RoundTripper) (int, error) {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "http://api.example.com/items", strings.NewReader("{}"))
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+	return res.StatusCode, nil
+}
+
+func TestCSRFTransportRefetchesRejectedToken(t *testing.T) {
+	server := &csrfServer{current: "t1"}
+	transport := NewCSRFTransport(server, CSRFConfig{TokenURL: "http://api.example.com/token"})
+
+	for i := 0; i < 2; i++ {
+		if code, err := post(context.Background(), transport); err != nil || code != http.StatusOK {
+			t.Fatalf("request %d = %d, %v, want 200", i+1, code, err)
+		}
+	}
+	if got := server.fetches.Load(); got != 1 {
+		t.Errorf("token fetches = %d, want 1", got)
+	}
+
+	server.rotate("t2")
+	if code, err := post(context.Background(), transport); err != nil || code != http.StatusOK {
+		t.Fatalf("request after rotation = %d, %v, want 200", code, err)
+	}
+	if got := server.fetches.Load(); got != 2 {
+		t.Errorf("token fetches after rotation = %d, want 2", got)
+	}
+
+	// 状態を変更しないリクエストにはトークンを付与しない
+	req, _ := http.NewRequest(http.MethodGet, "http://api.example.com/items", nil)
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Request.Header.Get("X-CSRF-Token") != "" {
+		t.Error("GET request has a CSRF token")
+	}
+}
+
+// TestCSRFTransportSharesConcurrentFetch は、並行したリクエストのトークンの取得を 1 回にまとめることを検証する
+func TestCSRFTransportSharesConcurrentFetch(t *testing.T) {
+	server := &csrfServer{current: "t1", release: make(chan struct{})}
+	transport := NewCSRFTransport(server, CSRFConfig{TokenURL: "http://api.example.com/token"})
+
+	const n = 10
+	var wg sync.WaitGroup
+	codes := make([]int, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i], errs[i] = post(context.Background(), transport)
+		}()
+	}
+	waitFetches(t, server, 1)
+	close(server.release)
+	wg.Wait()
+
+	for i := range codes {
+		if errs[i] != nil || codes[i] != http.StatusOK {
+			t.Errorf("request %d = %d, %v, want 200", i+1, codes[i], errs[i])
+		}
+	}
+	if got := server.fetches.Load(); got != 1 {
+		t.Errorf("token fetches = %d, want 1", got)
+	}
+}
+
+// TestCSRFTransportWaiterCanceled は、トークンの取得中に他のリクエストがキャンセルされた場合に、取得の完了を待たずに終了することを検証する
+func TestCSRFTransportWaiterCanceled(t *testing.T) {
+	server := &csrfServer{current: "t1", release: make(chan struct{})}
+	transport := NewCSRFTransport(server, CSRFConfig{TokenURL: "http://api.example.com/token"})
+
+	done := make(chan error, 1)
+	go func() {
+		code, err := post(context.Background(), transport)
+		if err == nil && code != http.StatusOK {
+			err = errors.New(http.StatusText(code))
+		}
+		done <- err
+	}()
+	waitFetches(t, server, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := post(ctx, transport); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("canceled request = %v, want context.DeadlineExceeded", err)
+	}
+
+	close(server.release)
+	if err := <-done; err != nil {
+		t.Errorf("request that started the fetch = %v", err)
+	}
+}
+
+// waitFetches は、トークンの取得が n 回開始されるまで待機する
+func waitFetches(t *testing.T, server *csrfServer, n int64) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for server.fetches.Load() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("token fetches = %d, want %d", server.fetches.Load(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
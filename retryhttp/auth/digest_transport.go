@@ -0,0 +1,284 @@
+package auth
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// digestChallenge は WWW-Authenticate: Digest のチャレンジと、nonce の使用回数
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	stale     bool
+	nc        uint32
+}
+
+// DigestTransport は RFC 7616 のダイジェスト認証を行うための http.RoundTripper 具象型
+// ホストごとに nonce をキャッシュし、2 回目以降のリクエストでは 401 の往復を行わずに認証情報を付与する
+// NOTE: RetryableTransport の内側に配置することで、リトライのたびに新しい nc と cnonce で署名し直す
+// stale=true のチャレンジ (nonce の期限切れ) はこの Transport 内で再計算するため、リトライ回数に数えられない
+type DigestTransport struct {
+	wrapped  http.RoundTripper
+	username string
+	password string
+
+	mu     sync.Mutex
+	nonces map[string]*digestChallenge
+}
+
+// NewDigestTransport は DigestTransport 構造体を作成する
+func NewDigestTransport(transport http.RoundTripper, username string, password string) *DigestTransport {
+	return &DigestTransport{
+		wrapped:  transport,
+		username: username,
+		password: password,
+		nonces:   make(map[string]*digestChallenge),
+	}
+}
+
+// transport は親の Transport を返却する。親がない場合は、http.DefaultTransport を返却する
+func (t *DigestTransport) transport() http.RoundTripper {
+	if t.wrapped == nil {
+		return http.DefaultTransport
+	}
+	return t.wrapped
+}
+
+// RoundTrip はダイジェスト認証の認証情報を付与してリクエストを送信する
+func (t *DigestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+
+	// キャッシュしている nonce があれば、事前に認証情報を付与する
+	challenge := t.cachedChallenge(host)
+	res, err := t.send(req, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	// 最初のリクエストと nonce の期限切れ (stale=true) の場合のみ、チャレンジに応答して再送する
+	for retried := false; res.StatusCode == http.StatusUnauthorized && !retried; retried = true {
+		next, ok := parseDigestChallenge(res)
+		if !ok {
+			return res, nil
+		}
+		t.storeChallenge(host, next)
+
+		// nonce を使用済みで stale ではない場合は、資格情報の誤りのため再送しない
+		if challenge != nil && !next.stale {
+			return res, nil
+		}
+		if !canResend(req) {
+			return res, nil
+		}
+		drainBody(res)
+
+		req, err = resendable(req)
+		if err != nil {
+			return nil, err
+		}
+		challenge = t.cachedChallenge(host)
+		res, err = t.send(req, challenge)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// send は認証情報を付与してリクエストを送信する。challenge が nil の場合は認証情報を付与しない
+func (t *DigestTransport) send(req *http.Request, challenge *digestChallenge) (*http.Response, error) {
+	if challenge == nil {
+		return t.transport().RoundTrip(req)
+	}
+
+	authorization, err := t.authorization(req, challenge)
+	if err != nil {
+		return nil, err
+	}
+	authorized := req.Clone(req.Context())
+	authorized.Header.Set("Authorization", authorization)
+	return t.transport().RoundTrip(authorized)
+}
+
+// cachedChallenge はホストのチャレンジを取得し、nonce の使用回数を加算したコピーを返却する
+func (t *DigestTransport) cachedChallenge(host string) *digestChallenge {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, ok := t.nonces[host]
+	if !ok {
+		return nil
+	}
+	c.nc++
+	copied := *c
+	return &copied
+}
+
+// storeChallenge はホストのチャレンジをキャッシュする
+func (t *DigestTransport) storeChallenge(host string, c *digestChallenge) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.nonces[host] = c
+}
+
+// authorization は Authorization ヘッダーの値を作成する
+func (t *DigestTransport) authorization(req *http.Request, c *digestChallenge) (string, error) {
+	newHash, err := digestHash(c.algorithm)
+	if err != nil {
+		return "", err
+	}
+	h := func(s string) string {
+		hh := newHash()
+		hh.Write([]byte(s))
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+
+	cnonceBytes := make([]byte, 16)
+	if _, err := rand.Read(cnonceBytes); err != nil {
+		return "", err
+	}
+	cnonce := hex.EncodeToString(cnonceBytes)
+	nc := fmt.Sprintf("%08x", c.nc)
+	uri := req.URL.RequestURI()
+
+	ha1 := h(t.username + ":" + c.realm + ":" + t.password)
+	if strings.HasSuffix(strings.ToLower(c.algorithm), "-sess") {
+		ha1 = h(ha1 + ":" + c.nonce + ":" + cnonce)
+	}
+	ha2 := h(req.Method + ":" + uri)
+
+	var response string
+	if c.qop == "" {
+		// RFC 2069 との互換性のため、qop がない場合は nc と cnonce を使用しない
+		response = h(ha1 + ":" + c.nonce + ":" + ha2)
+	} else {
+		response = h(strings.Join([]string{ha1, c.nonce, nc, cnonce, c.qop, ha2}, ":"))
+	}
+
+	params := []string{
+		fmt.Sprintf("username=%q", t.username),
+		fmt.Sprintf("realm=%q", c.realm),
+		fmt.Sprintf("nonce=%q", c.nonce),
+		fmt.Sprintf("uri=%q", uri),
+		fmt.Sprintf("response=%q", response),
+	}
+	if c.algorithm != "" {
+		params = append(params, "algorithm="+c.algorithm)
+	}
+	if c.qop != "" {
+		params = append(params, "qop="+c.qop, "nc="+nc, fmt.Sprintf("cnonce=%q", cnonce))
+	}
+	if c.opaque != "" {
+		params = append(params, fmt.Sprintf("opaque=%q", c.opaque))
+	}
+	return "Digest " + strings.Join(params, ", "), nil
+}
+
+// digestHash はアルゴリズムに対応するハッシュ関数を返却する
+func digestHash(algorithm string) (func() hash.Hash, error) {
+	switch strings.ToUpper(strings.TrimSuffix(strings.ToLower(algorithm), "-sess")) {
+	case "", "MD5":
+		return md5.New, nil
+	case "SHA-256":
+		return sha256.New, nil
+	case "SHA-512-256":
+		return sha512.New512_256, nil
+	default:
+		return nil, fmt.Errorf("digest: unsupported algorithm %q", algorithm)
+	}
+}
+
+// digestAlgorithmPreference はアルゴリズムの優先順位。値が大きいほど優先する
+var digestAlgorithmPreference = map[string]int{
+	"":                 0,
+	"MD5":              0,
+	"MD5-SESS":         0,
+	"SHA-256":          1,
+	"SHA-256-SESS":     1,
+	"SHA-512-256":      2,
+	"SHA-512-256-SESS": 2,
+}
+
+// parseDigestChallenge は WWW-Authenticate ヘッダーから、対応しているアルゴリズムのうち最も強いチャレンジを取得する
+func parseDigestChallenge(res *http.Response) (*digestChallenge, bool) {
+	var best *digestChallenge
+	for _, v := range res.Header.Values("WWW-Authenticate") {
+		scheme, rest, _ := strings.Cut(strings.TrimSpace(v), " ")
+		if !strings.EqualFold(scheme, "Digest") {
+			continue
+		}
+		params := parseAuthParams(rest)
+
+		c := &digestChallenge{
+			realm:     params["realm"],
+			nonce:     params["nonce"],
+			opaque:    params["opaque"],
+			algorithm: params["algorithm"],
+			stale:     strings.EqualFold(params["stale"], "true"),
+		}
+		if _, err := digestHash(c.algorithm); err != nil || c.nonce == "" {
+			continue
+		}
+		// qop は "auth" のみ対応する
+		for _, q := range strings.Split(params["qop"], ",") {
+			if strings.TrimSpace(q) == "auth" {
+				c.qop = "auth"
+			}
+		}
+		if params["qop"] != "" && c.qop == "" {
+			continue
+		}
+
+		if best == nil || digestAlgorithmPreference[strings.ToUpper(c.algorithm)] > digestAlgorithmPreference[strings.ToUpper(best.algorithm)] {
+			best = c
+		}
+	}
+	return best, best != nil
+}
+
+// parseAuthParams は認証パラメーター (key=value または key="quoted value" のカンマ区切り) を解析する
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " \t,")
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		rest = strings.TrimLeft(rest, " \t")
+
+		var value strings.Builder
+		if strings.HasPrefix(rest, `"`) {
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				value.WriteByte(rest[i])
+			}
+			s = rest[min(i+1, len(rest)):]
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end < 0 {
+				end = len(rest)
+			}
+			value.WriteString(strings.TrimSpace(rest[:end]))
+			s = rest[end:]
+		}
+		params[key] = value.String()
+	}
+	return params
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// md4 は RFC 1320 の MD4 ハッシュを計算する
+// NOTE: MD4 は NTLM のパスワードハッシュの算出にのみ使用する。標準ライブラリに含まれていないため実装している
+func md4(data []byte) [16]byte {
+	// パディング: 0x80 を追加し、長さが 64 の倍数 - 8 になるまで 0 を追加した後、ビット長を追加する
+	msg := make([]byte, 0, len(data)+72)
+	msg = append(msg, data...)
+	msg = append(msg, 0x80)
+	for len(msg)%64 != 56 {
+		msg = append(msg, 0)
+	}
+	msg = binary.LittleEndian.AppendUint64(msg, uint64(len(data))*8)
+
+	a, b, c, d := uint32(0x67452301), uint32(0xefcdab89), uint32(0x98badcfe), uint32(0x10325476)
+
+	var x [16]uint32
+	for block := 0; block < len(msg); block += 64 {
+		for i := range x {
+			x[i] = binary.LittleEndian.Uint32(msg[block+i*4:])
+		}
+		aa, bb, cc, dd := a, b, c, d
+
+		// ラウンド 1
+		for _, i := range [4]int{0, 4, 8, 12} {
+			a = bits.RotateLeft32(a+((b&c)|(^b&d))+x[i], 3)
+			d = bits.RotateLeft32(d+((a&b)|(^a&c))+x[i+1], 7)
+			c = bits.RotateLeft32(c+((d&a)|(^d&b))+x[i+2], 11)
+			b = bits.RotateLeft32(b+((c&d)|(^c&a))+x[i+3], 19)
+		}
+
+		// ラウンド 2
+		for _, i := range [4]int{0, 1, 2, 3} {
+			a = bits.RotateLeft32(a+((b&c)|(b&d)|(c&d))+x[i]+0x5a827999, 3)
+			d = bits.RotateLeft32(d+((a&b)|(a&c)|(b&c))+x[i+4]+0x5a827999, 5)
+			c = bits.RotateLeft32(c+((d&a)|(d&b)|(a&b))+x[i+8]+0x5a827999, 9)
+			b = bits.RotateLeft32(b+((c&d)|(c&a)|(d&a))+x[i+12]+0x5a827999, 13)
+		}
+
+		// ラウンド 3
+		for _, i := range [4]int{0, 2, 1, 3} {
+			a = bits.RotateLeft32(a+(b^c^d)+x[i]+0x6ed9eba1, 3)
+			d = bits.RotateLeft32(d+(a^b^c)+x[i+8]+0x6ed9eba1, 9)
+			c = bits.RotateLeft32(c+(d^a^b)+x[i+4]+0x6ed9eba1, 11)
+			b = bits.RotateLeft32(b+(c^d^a)+x[i+12]+0x6ed9eba1, 15)
+		}
+
+		a, b, c, d = a+aa, b+bb, c+cc, d+dd
+	}
+
+	var sum [16]byte
+	binary.LittleEndian.PutUint32(sum[0:], a)
+	binary.LittleEndian.PutUint32(sum[4:], b)
+	binary.LittleEndian.PutUint32(sum[8:], c)
+	binary.LittleEndian.PutUint32(sum[12:], d)
+	return sum
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// NegotiateContext は SPNEGO (Kerberos) のセキュリティコンテキストを表すインターフェース
+// NOTE: Kerberos の実装 (gokrb5 や Windows の SSPI など) に依存しないように、トークンの生成をこのインターフェースに委譲する
+type NegotiateContext interface {
+	// Step は サーバーから受け取ったトークン (初回は nil) を元に、次に送信するトークンを生成する
+	// done が true の場合は、コンテキストの確立が完了したことを表す
+	Step(input []byte) (output []byte, done bool, err error)
+}
+
+// NegotiateProvider は、リクエスト先の SPN (例: HTTP/intranet.example.com) に対する NegotiateContext を作成するインターフェース
+type NegotiateProvider interface {
+	NewContext(ctx context.Context, spn string) (NegotiateContext, error)
+}
+
+// ErrNegotiateFailed は、SPNEGO のネゴシエーションが規定の回数内に完了しなかったことを表すエラー
+var ErrNegotiateFailed = errors.New("negotiate authentication did not complete")
+
+// maxNegotiateLegs はネゴシエーションの最大往復回数
+const maxNegotiateLegs = 5
+
+// NegotiateTransport は SPNEGO (Negotiate) 認証を行うための http.RoundTripper 具象型
+// Windows 統合認証の背後にあるイントラネットの API に対して使用する
+// NOTE: RetryableTransport の内側に配置することで、リトライのたびに新しいセキュリティコンテキストからトークンを生成する
+// Kerberos のトークンはリプレイ検知の対象となるため、同じトークンを再送すると失敗する
+type NegotiateTransport struct {
+	wrapped  http.RoundTripper
+	provider NegotiateProvider
+	// SPN は使用するサービスプリンシパル名。空文字の場合は "HTTP/<ホスト名>" を使用する
+	SPN string
+}
+
+// NewNegotiateTransport は NegotiateTransport 構造体を作成する
+func NewNegotiateTransport(transport http.RoundTripper, provider NegotiateProvider) *NegotiateTransport {
+	return &NegotiateTransport{
+		wrapped:  transport,
+		provider: provider,
+	}
+}
+
+// transport は親の Transport を返却する。親がない場合は、http.DefaultTransport を返却する
+func (t *NegotiateTransport) transport() http.RoundTripper {
+	if t.wrapped == nil {
+		return http.DefaultTransport
+	}
+	return t.wrapped
+}
+
+// RoundTrip は Negotiate トークンを付与してリクエストを送信する
+// サーバーが追加のトークンを要求した場合 (401 + WWW-Authenticate: Negotiate <token>) は、ネゴシエーションを継続する
+func (t *NegotiateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	spn := t.SPN
+	if spn == "" {
+		spn = "HTTP/" + req.URL.Hostname()
+	}
+
+	secCtx, err := t.provider.NewContext(req.Context(), spn)
+	if err != nil {
+		return nil, err
+	}
+
+	var input []byte
+	for leg := 0; leg < maxNegotiateLegs; leg++ {
+		output, done, err := secCtx.Step(input)
+		if err != nil {
+			return nil, fmt.Errorf("negotiate: %w", err)
+		}
+
+		if leg > 0 {
+			if !canResend(req) {
+				return nil, fmt.Errorf("negotiate: request body cannot be resent: %w", ErrNegotiateFailed)
+			}
+			req, err = resendable(req)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		authorized := req.Clone(req.Context())
+		authorized.Header.Set("Authorization", "Negotiate "+base64.StdEncoding.EncodeToString(output))
+
+		res, err := t.transport().RoundTrip(authorized)
+		if err != nil {
+			return nil, err
+		}
+
+		token, ok := negotiateChallenge(res)
+		// 401 以外、またはサーバーが追加のトークンを要求していない場合はネゴシエーション完了
+		if res.StatusCode != http.StatusUnauthorized || !ok || token == nil || done {
+			return res, nil
+		}
+
+		drainBody(res)
+		input = token
+	}
+	return nil, ErrNegotiateFailed
+}
+
+// negotiateChallenge は WWW-Authenticate ヘッダーから Negotiate のトークンを取得する
+func negotiateChallenge(res *http.Response) ([]byte, bool) {
+	for _, v := range res.Header.Values("WWW-Authenticate") {
+		scheme, param, _ := strings.Cut(strings.TrimSpace(v), " ")
+		if !strings.EqualFold(scheme, "Negotiate") {
+			continue
+		}
+		param = strings.TrimSpace(param)
+		if param == "" {
+			return nil, true
+		}
+		token, err := base64.StdEncoding.DecodeString(param)
+		if err != nil {
+			return nil, true
+		}
+		return token, true
+	}
+	return nil, false
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// NTLM のネゴシエーションフラグ
+const (
+	ntlmNegotiateUnicode          = 0x00000001
+	ntlmRequestTarget             = 0x00000004
+	ntlmNegotiateNTLM             = 0x00000200
+	ntlmNegotiateAlwaysSign       = 0x00008000
+	ntlmNegotiateExtendedSecurity = 0x00080000
+	ntlmNegotiateTargetInfo       = 0x00800000
+	ntlmNegotiate128              = 0x20000000
+	ntlmNegotiate56               = 0x80000000
+
+	ntlmNegotiateFlags = ntlmNegotiateUnicode | ntlmRequestTarget | ntlmNegotiateNTLM | ntlmNegotiateAlwaysSign |
+		ntlmNegotiateExtendedSecurity | ntlmNegotiateTargetInfo | ntlmNegotiate128 | ntlmNegotiate56
+)
+
+// ntlmSignature は NTLM メッセージの先頭に付与されるシグネチャ
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// errInvalidNTLMChallenge は、サーバーから受け取った CHALLENGE_MESSAGE が不正であることを表すエラー
+var errInvalidNTLMChallenge = errors.New("invalid NTLM challenge message")
+
+// NTLMCredentials は NTLM 認証に使用する資格情報
+type NTLMCredentials struct {
+	Domain      string
+	Username    string
+	Password    string
+	Workstation string
+}
+
+// ntlmNegotiateMessage は NEGOTIATE_MESSAGE (Type 1) を作成する
+func ntlmNegotiateMessage() []byte {
+	msg := make([]byte, 32)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 1)
+	binary.LittleEndian.PutUint32(msg[12:], ntlmNegotiateFlags)
+	// DomainNameFields と WorkstationFields は空のため 0 のまま
+	return msg
+}
+
+// ntlmChallenge は CHALLENGE_MESSAGE (Type 2) の内容
+type ntlmChallenge struct {
+	flags           uint32
+	serverChallenge []byte
+	targetInfo      []byte
+}
+
+// parseNTLMChallenge は CHALLENGE_MESSAGE (Type 2) を解析する
+func parseNTLMChallenge(msg []byte) (*ntlmChallenge, error) {
+	if len(msg) < 48 || !bytes.Equal(msg[:8], ntlmSignature) || binary.LittleEndian.Uint32(msg[8:]) != 2 {
+		return nil, errInvalidNTLMChallenge
+	}
+
+	c := &ntlmChallenge{
+		flags:           binary.LittleEndian.Uint32(msg[20:]),
+		serverChallenge: msg[24:32],
+	}
+
+	length := int(binary.LittleEndian.Uint16(msg[40:]))
+	offset := int(binary.LittleEndian.Uint32(msg[44:]))
+	if length > 0 {
+		if offset+length > len(msg) {
+			return nil, errInvalidNTLMChallenge
+		}
+		c.targetInfo = msg[offset : offset+length]
+	}
+	return c, nil
+}
+
+// ntlmAuthenticateMessage は NTLMv2 の AUTHENTICATE_MESSAGE (Type 3) を作成する
+func ntlmAuthenticateMessage(cred NTLMCredentials, challenge *ntlmChallenge, now time.Time) ([]byte, error) {
+	clientChallenge := make([]byte, 8)
+	if _, err := rand.Read(clientChallenge); err != nil {
+		return nil, err
+	}
+	return buildNTLMAuthenticateMessage(cred, challenge, fileTime(now), clientChallenge), nil
+}
+
+// ntowfv2 は NTOWFv2 = HMAC_MD5(MD4(UNICODE(Password)), UNICODE(Upper(User) + Domain)) を計算する
+func ntowfv2(cred NTLMCredentials) []byte {
+	passwordHash := md4(utf16le(cred.Password))
+	return hmacMD5(passwordHash[:], utf16le(strings.ToUpper(cred.Username)+cred.Domain))
+}
+
+// buildNTLMAuthenticateMessage は、タイムスタンプ (FILETIME) とクライアントチャレンジを指定して AUTHENTICATE_MESSAGE (Type 3) を作成する
+// NOTE: MS-NLMP のテストベクターで検証できるように、乱数と現在時刻を使用する処理と分けている
+func buildNTLMAuthenticateMessage(cred NTLMCredentials, challenge *ntlmChallenge, timestamp uint64, clientChallenge []byte) []byte {
+	ntowf := ntowfv2(cred)
+
+	// NTLMv2_CLIENT_CHALLENGE
+	var temp bytes.Buffer
+	temp.Write([]byte{0x01, 0x01, 0, 0, 0, 0, 0, 0})
+	_ = binary.Write(&temp, binary.LittleEndian, timestamp)
+	temp.Write(clientChallenge)
+	temp.Write([]byte{0, 0, 0, 0})
+	temp.Write(challenge.targetInfo)
+	temp.Write([]byte{0, 0, 0, 0})
+
+	ntProof := hmacMD5(ntowf, challenge.serverChallenge, temp.Bytes())
+	ntResponse := append(ntProof, temp.Bytes()...)
+	lmResponse := append(hmacMD5(ntowf, challenge.serverChallenge, clientChallenge), clientChallenge...)
+
+	payloads := [][]byte{
+		lmResponse,
+		ntResponse,
+		utf16le(cred.Domain),
+		utf16le(cred.Username),
+		utf16le(cred.Workstation),
+		nil, // EncryptedRandomSessionKey (署名・暗号化を行わないため空)
+	}
+
+	const headerSize = 64
+	msg := make([]byte, headerSize)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 3)
+
+	offset := headerSize
+	for i, p := range payloads {
+		field := msg[12+i*8:]
+		binary.LittleEndian.PutUint16(field[0:], uint16(len(p)))
+		binary.LittleEndian.PutUint16(field[2:], uint16(len(p)))
+		binary.LittleEndian.PutUint32(field[4:], uint32(offset))
+		offset += len(p)
+	}
+	binary.LittleEndian.PutUint32(msg[60:], challenge.flags&ntlmNegotiateFlags|ntlmNegotiateUnicode)
+
+	for _, p := range payloads {
+		msg = append(msg, p...)
+	}
+	return msg
+}
+
+// hmacMD5 は HMAC-MD5 を計算する
+func hmacMD5(key []byte, data ...[]byte) []byte {
+	mac := hmac.New(md5.New, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+// utf16le は文字列を UTF-16LE のバイト列に変換する
+func utf16le(s string) []byte {
+	encoded := utf16.Encode([]rune(s))
+	b := make([]byte, len(encoded)*2)
+	for i, r := range encoded {
+		binary.LittleEndian.PutUint16(b[i*2:], r)
+	}
+	return b
+}
+
+// fileTime は 1601 年 1 月 1 日からの 100 ナノ秒単位の経過時間 (Windows の FILETIME) に変換する
+func fileTime(t time.Time) uint64 {
+	const epochDiff = 116444736000000000
+	return uint64(t.UnixNano()/100) + epochDiff
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// MS-NLMP 4.2.4 NTLMv2 Authentication の例の値
+var (
+	ntlmTestCredentials = NTLMCredentials{
+		Domain:      "Domain",
+		Username:    "User",
+		Password:    "Password",
+		Workstation: "COMPUTER",
+	}
+	// ntlmTestChallengeMessage は 4.2.4.3 の CHALLENGE_MESSAGE
+	ntlmTestChallengeMessage = mustDecodeHex(
+		"4e544c4d53535000020000000c000c003800000033828ae20123456789abcdef" +
+			"00000000000000002400240044000000060070170000000f5300650072007600" +
+			"6500720002000c0044006f006d00610069006e0001000c005300650072007600" +
+			"650072000000000000")
+	// ntlmTestTargetInfo は CHALLENGE_MESSAGE の TargetInfo (MsvAvNbDomainName, MsvAvNbComputerName, MsvAvEOL)
+	ntlmTestTargetInfo = mustDecodeHex(
+		"02000c0044006f006d00610069006e0001000c00530065007200760065007200" +
+			"00000000")
+	ntlmTestClientChallenge = mustDecodeHex("aaaaaaaaaaaaaaaa")
+)
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestParseNTLMChallenge(t *testing.T) {
+	challenge, err := parseNTLMChallenge(ntlmTestChallengeMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hex.EncodeToString(challenge.serverChallenge), "0123456789abcdef"; got != want {
+		t.Errorf("server challenge = %s, want %s", got, want)
+	}
+	if got, want := challenge.flags, uint32(0xe28a8233); got != want {
+		t.Errorf("flags = %#x, want %#x", got, want)
+	}
+	if !bytes.Equal(challenge.targetInfo, ntlmTestTargetInfo) {
+		t.Errorf("target info = %x, want %x", challenge.targetInfo, ntlmTestTargetInfo)
+	}
+}
+
+func TestParseNTLMChallengeInvalid(t *testing.T) {
+	truncated := append([]byte(nil), ntlmTestChallengeMessage...)
+	// TargetInfoFields の長さをメッセージより長くする
+	binary.LittleEndian.PutUint16(truncated[40:], 0x100)
+
+	tests := map[string][]byte{
+		"short":             ntlmTestChallengeMessage[:47],
+		"bad signature":     append([]byte("NTLMSSX\x00"), ntlmTestChallengeMessage[8:]...),
+		"wrong type":        append(append(append([]byte(nil), ntlmTestChallengeMessage[:8]...), 3, 0, 0, 0), ntlmTestChallengeMessage[12:]...),
+		"target info range": truncated,
+	}
+	for name, msg := range tests {
+		if _, err := parseNTLMChallenge(msg); err != errInvalidNTLMChallenge {
+			t.Errorf("%s: err = %v, want %v", name, err, errInvalidNTLMChallenge)
+		}
+	}
+}
+
+// TestNTOWFv2 は 4.2.4.1.1 の NTOWFv2 の値を検証する
+func TestNTOWFv2(t *testing.T) {
+	if got, want := hex.EncodeToString(ntowfv2(ntlmTestCredentials)), "0c868a403bfd7a93a3001ef22ef02e3f"; got != want {
+		t.Errorf("NTOWFv2 = %s, want %s", got, want)
+	}
+}
+
+// TestBuildNTLMAuthenticateMessage は、4.2.4 の値で作成した AUTHENTICATE_MESSAGE (Type 3) の各フィールドを検証する
+// NOTE: 署名と暗号化を行わないため、4.2.4.4 のメッセージとは EncryptedRandomSessionKey、Version、MIC が異なる。
+// 4.2.4.2.1 の LMv2 と 4.2.4.2.2 の NTProofStr、およびペイロードを比較する
+func TestBuildNTLMAuthenticateMessage(t *testing.T) {
+	challenge, err := parseNTLMChallenge(ntlmTestChallengeMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 4.2.4 の例のタイムスタンプは 0
+	msg := buildNTLMAuthenticateMessage(ntlmTestCredentials, challenge, 0, ntlmTestClientChallenge)
+
+	if !bytes.Equal(msg[:8], ntlmSignature) {
+		t.Fatalf("signature = %x", msg[:8])
+	}
+	if got := binary.LittleEndian.Uint32(msg[8:]); got != 3 {
+		t.Fatalf("message type = %d, want 3", got)
+	}
+
+	field := func(i int) []byte {
+		f := msg[12+i*8:]
+		length := int(binary.LittleEndian.Uint16(f[0:]))
+		if maxLength := int(binary.LittleEndian.Uint16(f[2:])); maxLength != length {
+			t.Errorf("field %d: MaxLen %d != Len %d", i, maxLength, length)
+		}
+		offset := int(binary.LittleEndian.Uint32(f[4:]))
+		if offset+length > len(msg) {
+			t.Fatalf("field %d: offset %d + length %d exceeds message length %d", i, offset, length, len(msg))
+		}
+		return msg[offset : offset+length]
+	}
+
+	if got, want := hex.EncodeToString(field(0)), "86c35097ac9cec102554764a57cccc19aaaaaaaaaaaaaaaa"; got != want {
+		t.Errorf("LmChallengeResponse = %s, want %s", got, want)
+	}
+
+	ntResponse := field(1)
+	if got, want := hex.EncodeToString(ntResponse[:16]), "68cd0ab851e51c96aabc927bebef6a1c"; got != want {
+		t.Errorf("NTProofStr = %s, want %s", got, want)
+	}
+	wantClientChallenge := "0101000000000000" + "0000000000000000" + "aaaaaaaaaaaaaaaa" + "00000000" +
+		hex.EncodeToString(ntlmTestTargetInfo) + "00000000"
+	if got := hex.EncodeToString(ntResponse[16:]); got != wantClientChallenge {
+		t.Errorf("NTLMv2_CLIENT_CHALLENGE = %s, want %s", got, wantClientChallenge)
+	}
+
+	for i, want := range map[int]string{2: "Domain", 3: "User", 4: "COMPUTER"} {
+		if got := field(i); !bytes.Equal(got, utf16le(want)) {
+			t.Errorf("field %d = %x, want UTF-16LE %q", i, got, want)
+		}
+	}
+	if got := field(5); len(got) != 0 {
+		t.Errorf("EncryptedRandomSessionKey = %x, want empty", got)
+	}
+
+	flags := binary.LittleEndian.Uint32(msg[60:])
+	if flags&ntlmNegotiateUnicode == 0 || flags&^ntlmNegotiateFlags != 0 {
+		t.Errorf("flags = %#x, want a subset of %#x with NEGOTIATE_UNICODE", flags, uint32(ntlmNegotiateFlags))
+	}
+}
+
+func TestNTLMNegotiateMessage(t *testing.T) {
+	msg := ntlmNegotiateMessage()
+	if !strings.HasPrefix(string(msg), "NTLMSSP\x00") || binary.LittleEndian.Uint32(msg[8:]) != 1 {
+		t.Fatalf("negotiate message = %x", msg)
+	}
+	if got := binary.LittleEndian.Uint32(msg[12:]); got != ntlmNegotiateFlags {
+		t.Errorf("flags = %#x, want %#x", got, uint32(ntlmNegotiateFlags))
+	}
+}
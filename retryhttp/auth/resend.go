@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"io"
+	"net/http"
+)
+
+// canResend はリクエストボディを再送できるか判定する
+func canResend(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// resendable は再送用にリクエストボディを取得し直したリクエストを返却する
+func resendable(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	resent := *req
+	resent.Body = body
+	return &resent, nil
+}
+
+// drainBody はレスポンスボディを読み切ってクローズする
+// NOTE: 認証のハンドシェイクで破棄するレスポンスでもコネクションを再利用するために読み切る
+func drainBody(res *http.Response) {
+	if res.Body == nil {
+		return
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	_ = res.Body.Close()
+}
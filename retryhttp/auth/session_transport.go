@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// SessionConfig は SessionTransport の設定
+type SessionConfig struct {
+	// Login はログインリクエストを作成する関数。セッションの確立や更新のたびに呼び出される
+	Login func(ctx context.Context) (*http.Request, error)
+	// CookieNames はセッションとして扱う Cookie 名。空の場合はログインのレスポンスのすべての Cookie を使用する
+	CookieNames []string
+	// LoginPath はログインページのパス。リダイレクト先がこのパスを含む場合はセッション切れとみなす
+	LoginPath string
+	// IsSessionExpired はレスポンスがセッション切れを表すか判定する関数
+	// nil の場合は、401 または LoginPath へのリダイレクトをセッション切れとみなす
+	IsSessionExpired func(res *http.Response) bool
+}
+
+// SessionTransport は、ログインで取得したセッション Cookie を付与するための http.RoundTripper 具象型
+// セッション切れのレスポンスを受け取った場合は、ログインし直して元のリクエストを再送する
+// NOTE: 複数の goroutine で同時にセッション切れになった場合も、ログインは 1 回だけ行われる
+type SessionTransport struct {
+	wrapped http.RoundTripper
+	config  SessionConfig
+
+	mu         sync.Mutex
+	cookies    []*http.Cookie
+	generation int
+}
+
+// NewSessionTransport は SessionTransport 構造体を作成する
+func NewSessionTransport(transport http.RoundTripper, config SessionConfig) *SessionTransport {
+	t := &SessionTransport{
+		wrapped: transport,
+		config:  config,
+	}
+	if t.config.IsSessionExpired == nil {
+		t.config.IsSessionExpired = t.isSessionExpired
+	}
+	return t
+}
+
+// transport は親の Transport を返却する。親がない場合は、http.DefaultTransport を返却する
+func (t *SessionTransport) transport() http.RoundTripper {
+	if t.wrapped == nil {
+		return http.DefaultTransport
+	}
+	return t.wrapped
+}
+
+// RoundTrip はセッション Cookie を付与してリクエストを送信する
+func (t *SessionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	cookies, generation, err := t.session(req.Context(), -1)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := t.send(req, cookies)
+	if err != nil {
+		return nil, err
+	}
+	if !t.config.IsSessionExpired(res) || !canResend(req) {
+		return res, nil
+	}
+	drainBody(res)
+
+	// セッションを更新して元のリクエストを再送する
+	cookies, _, err = t.session(req.Context(), generation)
+	if err != nil {
+		return nil, err
+	}
+	resent, err := resendable(req)
+	if err != nil {
+		return nil, err
+	}
+	return t.send(resent, cookies)
+}
+
+// send はセッション Cookie を付与してリクエストを送信する
+func (t *SessionTransport) send(req *http.Request, cookies []*http.Cookie) (*http.Response, error) {
+	withSession := req.Clone(req.Context())
+	for _, c := range cookies {
+		withSession.AddCookie(c)
+	}
+	return t.transport().RoundTrip(withSession)
+}
+
+// session は現在のセッション Cookie を返却する
+// セッションが未確立の場合、または expired が現在の世代と一致する (更新されていない) 場合はログインする
+// NOTE: ロックを保持したままログインするため、同時にセッション切れを検知した goroutine は
+// 先にログインした結果 (更新後の世代) を使用する
+func (t *SessionTransport) session(ctx context.Context, expired int) ([]*http.Cookie, int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.cookies != nil && expired != t.generation {
+		return t.cookies, t.generation, nil
+	}
+
+	cookies, err := t.login(ctx)
+	if err != nil {
+		return nil, t.generation, err
+	}
+	t.cookies = cookies
+	t.generation++
+	return t.cookies, t.generation, nil
+}
+
+// login はログインリクエストを送信し、セッション Cookie を取得する
+func (t *SessionTransport) login(ctx context.Context) ([]*http.Cookie, error) {
+	req, err := t.config.Login(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := t.transport().RoundTrip(req)
+	if err != nil {
+		return nil, fmt.Errorf("session login: %w", err)
+	}
+	defer drainBody(res)
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("session login: unexpected status %s", res.Status)
+	}
+
+	var cookies []*http.Cookie
+	for _, c := range res.Cookies() {
+		if len(t.config.CookieNames) > 0 && !contains(t.config.CookieNames, c.Name) {
+			continue
+		}
+		cookies = append(cookies, &http.Cookie{Name: c.Name, Value: c.Value})
+	}
+	if len(cookies) == 0 {
+		return nil, fmt.Errorf("session login: no session cookie in response")
+	}
+	return cookies, nil
+}
+
+// isSessionExpired は 401 またはログインページへのリダイレクトをセッション切れとみなす
+func (t *SessionTransport) isSessionExpired(res *http.Response) bool {
+	if res.StatusCode == http.StatusUnauthorized {
+		return true
+	}
+	if t.config.LoginPath == "" || res.StatusCode < 300 || res.StatusCode >= 400 {
+		return false
+	}
+	return strings.Contains(res.Header.Get("Location"), t.config.LoginPath)
+}
+
+// contains はスライスに値が含まれるか判定する
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenProvider は認証に使用するトークンを取得するインターフェース
+// NOTE: 呼び出し元でトークンをハードコードせずに、外部のシークレットストアから取得するために使用する
+type TokenProvider interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// Invalidator はキャッシュしているトークンを破棄できる TokenProvider が実装するインターフェース
+// BearerTransport は 401 を受け取った場合に Invalidate を呼び出してトークンを再取得する
+type Invalidator interface {
+	Invalidate()
+}
+
+// TokenProviderFunc は関数を TokenProvider として使用するための型
+type TokenProviderFunc func(ctx context.Context) (string, error)
+
+// Token は f(ctx) を返却する
+func (f TokenProviderFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// EnvTokenProvider は環境変数からトークンを取得する
+type EnvTokenProvider struct {
+	Name string
+}
+
+// Token は環境変数の値を返却する。環境変数が未設定または空の場合はエラーを返却する
+func (p EnvTokenProvider) Token(context.Context) (string, error) {
+	token := os.Getenv(p.Name)
+	if token == "" {
+		return "", fmt.Errorf("environment variable %s is not set", p.Name)
+	}
+	return token, nil
+}
+
+// FileTokenProvider はファイルからトークンを取得する
+// NOTE: Kubernetes の Secret をボリュームとしてマウントした場合など、ファイルが更新される環境を想定している
+type FileTokenProvider struct {
+	Path string
+}
+
+// Token はファイルの内容の前後の空白を除いて返却する
+func (p FileTokenProvider) Token(context.Context) (string, error) {
+	b, err := os.ReadFile(p.Path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", p.Path)
+	}
+	return token, nil
+}
+
+// VaultTokenProvider は HashiCorp Vault の KV シークレットエンジン (v2) からトークンを取得する
+type VaultTokenProvider struct {
+	// Address は Vault のアドレス (例: https://vault.example.com:8200)
+	Address string
+	// Path はシークレットのパス (例: secret/data/my-service)
+	Path string
+	// Field はシークレットのうちトークンを格納しているフィールド名
+	Field string
+	// VaultToken は Vault 自体の認証に使用するトークン。nil の場合は環境変数 VAULT_TOKEN を使用する
+	VaultToken TokenProvider
+	// Client は Vault へのリクエストに使用する *http.Client。nil の場合は http.DefaultClient
+	Client *http.Client
+}
+
+// Token は Vault からシークレットを取得し、Field の値を返却する
+func (p VaultTokenProvider) Token(ctx context.Context) (string, error) {
+	vaultToken := p.VaultToken
+	if vaultToken == nil {
+		vaultToken = EnvTokenProvider{Name: "VAULT_TOKEN"}
+	}
+	token, err := vaultToken.Token(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	url := strings.TrimSuffix(p.Address, "/") + "/v1/" + strings.TrimPrefix(p.Path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned %s for %s", res.Status, p.Path)
+	}
+
+	var secret struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&secret); err != nil {
+		return "", err
+	}
+	value, ok := secret.Data.Data[p.Field].(string)
+	if !ok || value == "" {
+		return "", fmt.Errorf("vault secret %s has no field %s", p.Path, p.Field)
+	}
+	return value, nil
+}
+
+// CachingTokenProvider は取得したトークンを一定間隔でリフレッシュする TokenProvider
+// Invalidator インターフェースを満たすため、401 を受け取った場合は次回の Token 呼び出しで再取得する
+type CachingTokenProvider struct {
+	mu        sync.Mutex
+	provider  TokenProvider
+	interval  time.Duration
+	token     string
+	fetchedAt time.Time
+}
+
+// NewCachingTokenProvider は CachingTokenProvider 構造体を作成する
+// interval が 0 の場合は、Invalidate が呼ばれるまでトークンを再取得しない
+func NewCachingTokenProvider(provider TokenProvider, interval time.Duration) *CachingTokenProvider {
+	return &CachingTokenProvider{
+		provider: provider,
+		interval: interval,
+	}
+}
+
+// Token はキャッシュしているトークンを返却する。期限切れの場合は再取得する
+func (p *CachingTokenProvider) Token(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token != "" && (p.interval == 0 || time.Since(p.fetchedAt) < p.interval) {
+		return p.token, nil
+	}
+
+	token, err := p.provider.Token(ctx)
+	if err != nil {
+		return "", err
+	}
+	p.token = token
+	p.fetchedAt = time.Now()
+	return token, nil
+}
+
+// Invalidate はキャッシュしているトークンを破棄する
+func (p *CachingTokenProvider) Invalidate() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.token = ""
+}
@@ -0,0 +1,159 @@
+package retryhttp
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// Jitter はバックオフの待機時間に適用するゆらぎの種類
+// 参考: https://aws.amazon.com/jp/blogs/architecture/exponential-backoff-and-jitter/
+type Jitter int
+
+const (
+	// JitterFull は 0 から指数バックオフの待機時間までの一様乱数を待機時間とする
+	JitterFull Jitter = iota
+	// JitterEqual は指数バックオフの待機時間の半分に、0 から残りの半分までの一様乱数を加えた値を待機時間とする
+	JitterEqual
+	// JitterDecorrelated は Base から前回の待機時間の 3 倍までの一様乱数を待機時間とする
+	JitterDecorrelated
+	// JitterNone はゆらぎを適用せず、指数バックオフの待機時間をそのまま使用する
+	JitterNone
+)
+
+// jitterNames は、設定ファイルや環境変数で指定する Jitter の名前
+var jitterNames = map[Jitter]string{
+	JitterFull:         "full",
+	JitterEqual:        "equal",
+	JitterDecorrelated: "decorrelated",
+	JitterNone:         "none",
+}
+
+// String は Jitter の名前を返却する
+func (j Jitter) String() string {
+	if name, ok := jitterNames[j]; ok {
+		return name
+	}
+	return "Jitter(" + strconv.Itoa(int(j)) + ")"
+}
+
+// MarshalText は Jitter を名前に変換する
+func (j Jitter) MarshalText() ([]byte, error) {
+	name, ok := jitterNames[j]
+	if !ok {
+		return nil, fmt.Errorf("unknown jitter: %d", int(j))
+	}
+	return []byte(name), nil
+}
+
+// UnmarshalText は名前 ("full", "equal", "decorrelated", "none") から Jitter を設定する。大文字と小文字は区別しない
+func (j *Jitter) UnmarshalText(text []byte) error {
+	for jitter, name := range jitterNames {
+		if strings.EqualFold(string(text), name) {
+			*j = jitter
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown jitter: %q", text)
+}
+
+// BackoffConfig はバックオフの設定
+type BackoffConfig struct {
+	// Base は待機時間の基準。試行回数を attempts とすると、指数バックオフの待機時間は Base * 2^attempts となる
+	Base time.Duration
+	// Cap は待機時間の上限
+	Cap    time.Duration
+	Jitter Jitter
+	// Source は乱数の生成元。nil の場合は math/rand のグローバルな生成元を使用する
+	// NOTE: テストでリトライの待機時間を再現できるように、シードを固定した rand.NewSource を指定する
+	Source rand.Source
+}
+
+// NewBackoff は設定に従って待機時間を算出する BackoffFunc を返却する
+// NOTE: 返却する BackoffFunc は複数のゴルーチンから同時に呼び出しても安全
+func NewBackoff(config BackoffConfig) retryabletransport.BackoffFunc {
+	random := newLockedRand(config.Source)
+	return func(attempts int) time.Duration {
+		return jitteredBackoff(config.Base, config.Cap, config.Jitter, random, attempts)
+	}
+}
+
+// jitteredBackoff は、上限を適用した指数バックオフの待機時間に jitter のゆらぎを適用した待機時間を返却する
+func jitteredBackoff(base time.Duration, cap time.Duration, jitter Jitter, random *lockedRand, attempts int) time.Duration {
+	switch jitter {
+	case JitterEqual:
+		wait := exponential(base, cap, attempts)
+		return wait/2 + random.duration(wait/2)
+	case JitterDecorrelated:
+		// NOTE: BackoffFunc は試行回数のみを受け取るため、前回の待機時間は最初の試行から計算し直す
+		wait := base
+		for i := 0; i < attempts; i++ {
+			wait = min(cap, base+random.duration(wait*3-base))
+		}
+		return wait
+	case JitterNone:
+		return exponential(base, cap, attempts)
+	default:
+		return random.duration(exponential(base, cap, attempts))
+	}
+}
+
+// exponential は上限を適用した指数バックオフの待機時間を返却する
+// NOTE: 上限に達した後は倍にしないため、試行回数が多い場合も time.Duration があふれない
+func exponential(base time.Duration, cap time.Duration, attempts int) time.Duration {
+	wait := base
+	for i := 0; i < attempts && wait > 0 && wait < cap; i++ {
+		if wait > cap/2 {
+			return cap
+		}
+		wait *= 2
+	}
+	return min(wait, cap)
+}
+
+// lockedRand は複数のゴルーチンから使用できるように、排他制御を行う乱数の生成器
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+// newLockedRand は lockedRand 構造体を作成する。source が nil の場合はグローバルな生成元を使用する
+func newLockedRand(source rand.Source) *lockedRand {
+	if source == nil {
+		return &lockedRand{}
+	}
+	return &lockedRand{r: rand.New(source)}
+}
+
+// intn は 0 以上 n 未満の一様乱数を返却する。n が 0 以下の場合は 0
+func (l *lockedRand) intn(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	if l.r == nil {
+		return rand.Intn(n)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.r.Intn(n)
+}
+
+// duration は 0 以上 d 未満の一様乱数を返却する。d が 0 以下の場合は 0
+func (l *lockedRand) duration(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	if l.r == nil {
+		return time.Duration(rand.Int63n(int64(d)))
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return time.Duration(l.r.Int63n(int64(d)))
+}
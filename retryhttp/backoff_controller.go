@@ -0,0 +1,102 @@
+package retryhttp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// BackoffController は、ポーリングや SSE の再接続ループなど長時間動作する処理向けにバックオフを管理する
+// 成功状態が resetAfter 以上継続した場合は試行回数をリセットし、過去の失敗が以降の再接続を遅くし続けないようにする
+type BackoffController struct {
+	mu           sync.Mutex
+	backoff      retryabletransport.BackoffFunc
+	resetAfter   time.Duration
+	attempts     int
+	successSince time.Time
+	now          func() time.Time
+}
+
+// NewBackoffController は BackoffController 構造体を作成する
+// backoff が nil の場合は、NewClient と同じ指数バックオフを使用する
+func NewBackoffController(backoff retryabletransport.BackoffFunc, resetAfter time.Duration) *BackoffController {
+	if backoff == nil {
+		backoff = exponentialBackoffAndFullJitter(1000, 10000, newLockedRand(nil))
+	}
+	return &BackoffController{
+		backoff:    backoff,
+		resetAfter: resetAfter,
+		now:        time.Now,
+	}
+}
+
+// Success は処理が成功したことを記録する
+// 成功状態の開始時刻を記録し、以降 Failure が呼ばれるまでを成功期間とみなす
+func (b *BackoffController) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if b.successSince.IsZero() {
+		b.successSince = now
+	}
+	b.resetIfHealthy(now)
+}
+
+// Failure は処理が失敗したことを記録し、次の試行までのバックオフを返却する
+func (b *BackoffController) Failure() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.resetIfHealthy(b.now())
+	b.successSince = time.Time{}
+	b.attempts++
+	return b.backoff(b.attempts)
+}
+
+// Wait は失敗を記録し、バックオフの間待機する
+// context.Context が終了した場合は待機を中断してエラーを返却する
+func (b *BackoffController) Wait(ctx context.Context) error {
+	wait := b.Failure()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Attempts は現在の連続失敗回数を返却する
+func (b *BackoffController) Attempts() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.resetIfHealthy(b.now())
+	return b.attempts
+}
+
+// Reset は試行回数を明示的にリセットする
+func (b *BackoffController) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.attempts = 0
+	b.successSince = time.Time{}
+}
+
+// resetIfHealthy は成功状態が resetAfter 以上継続していれば試行回数をリセットする
+// NOTE: 呼び出し元でロックを取得している必要がある
+func (b *BackoffController) resetIfHealthy(now time.Time) {
+	if b.successSince.IsZero() {
+		return
+	}
+	if now.Sub(b.successSince) >= b.resetAfter {
+		b.attempts = 0
+	}
+}
@@ -0,0 +1,118 @@
+package retryhttp
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// globalRand は、乱数の生成元を指定しない Backoff が使用する、math/rand のグローバルな生成元
+var globalRand = newLockedRand(nil)
+
+// ConstantBackoff は、試行回数に関わらず Wait を待機時間とする Backoff 具象型
+type ConstantBackoff struct {
+	Wait time.Duration
+}
+
+// Backoff は Wait を返却する
+func (b ConstantBackoff) Backoff(int) time.Duration {
+	return b.Wait
+}
+
+// LinearBackoff は、試行ごとに Step ずつ増加する待機時間を、Cap を上限として返却する Backoff 具象型
+// 試行回数を attempts とすると、待機時間は Base + Step * attempts となる。Step が 0 の場合は Base ずつ増加する
+type LinearBackoff struct {
+	Base time.Duration
+	Step time.Duration
+	// Cap は待機時間の上限。0 の場合は上限なし
+	Cap time.Duration
+}
+
+// Backoff は試行回数に比例して増加する待機時間を返却する
+func (b LinearBackoff) Backoff(attempts int) time.Duration {
+	step := b.Step
+	if step == 0 {
+		step = b.Base
+	}
+	wait := b.Base + step*time.Duration(attempts)
+	if b.Cap > 0 {
+		wait = min(wait, b.Cap)
+	}
+	return wait
+}
+
+// ExponentialWithJitter は、Base から Cap まで倍々に増加する待機時間に Jitter のゆらぎを適用する Backoff 具象型
+// NOTE: 乱数の生成元を指定する場合は、BackoffConfig と NewBackoff を使用する
+type ExponentialWithJitter struct {
+	Base   time.Duration
+	Cap    time.Duration
+	Jitter Jitter
+}
+
+// Backoff は指数バックオフの待機時間にゆらぎを適用した待機時間を返却する
+func (b ExponentialWithJitter) Backoff(attempts int) time.Duration {
+	return jitteredBackoff(b.Base, b.Cap, b.Jitter, globalRand, attempts)
+}
+
+// FibonacciBackoff は、Base にフィボナッチ数列 (1, 1, 2, 3, 5, 8, ...) を掛けた待機時間を、Cap を上限として返却する Backoff 具象型
+// NOTE: 指数バックオフより緩やかに増加するため、短い障害からの回復を早く検出しつつ、長い障害では送信先の負荷を抑えられる
+type FibonacciBackoff struct {
+	Base time.Duration
+	// Cap は待機時間の上限。0 の場合は上限なし
+	Cap time.Duration
+}
+
+// Backoff は試行回数に対応するフィボナッチ数に比例した待機時間を返却する
+func (b FibonacciBackoff) Backoff(attempts int) time.Duration {
+	wait, next := b.Base, b.Base
+	for i := 1; i < attempts && (b.Cap <= 0 || wait < b.Cap); i++ {
+		wait, next = next, wait+next
+	}
+	if b.Cap > 0 {
+		wait = min(wait, b.Cap)
+	}
+	return wait
+}
+
+// BackoffPreset は名前付きのバックオフの設定
+type BackoffPreset string
+
+const (
+	// BackoffAggressive は、100 ミリ秒から 2 秒まで増加する待機時間に Full Jitter を適用する。対話的な処理など、早く結果を返却したい場合に使用する
+	BackoffAggressive BackoffPreset = "aggressive"
+	// BackoffStandard は、1 秒から 10 秒まで増加する待機時間に Full Jitter を適用する。NewClient のデフォルトと同じ設定
+	BackoffStandard BackoffPreset = "standard"
+	// BackoffConservative は、2 秒から 60 秒まで増加する待機時間に Equal Jitter を適用する。バッチ処理など、送信先の回復を待つ場合に使用する
+	BackoffConservative BackoffPreset = "conservative"
+)
+
+// backoffPresets は名前付きのバックオフの設定の一覧
+var backoffPresets = map[BackoffPreset]retryabletransport.Backoff{
+	BackoffAggressive:   ExponentialWithJitter{Base: 100 * time.Millisecond, Cap: 2 * time.Second, Jitter: JitterFull},
+	BackoffStandard:     ExponentialWithJitter{Base: time.Second, Cap: 10 * time.Second, Jitter: JitterFull},
+	BackoffConservative: ExponentialWithJitter{Base: 2 * time.Second, Cap: time.Minute, Jitter: JitterEqual},
+}
+
+// Backoff は名前に対応する Backoff を返却する。未知の名前の場合は false を返却する
+func (p BackoffPreset) Backoff() (retryabletransport.Backoff, bool) {
+	backoff, ok := backoffPresets[p]
+	return backoff, ok
+}
+
+// UnmarshalText は名前 ("aggressive", "standard", "conservative") から BackoffPreset を設定する。大文字と小文字は区別しない
+// 空文字列の場合は、名前付きの設定を使用しない
+func (p *BackoffPreset) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*p = ""
+		return nil
+	}
+	for preset := range backoffPresets {
+		if strings.EqualFold(string(text), string(preset)) {
+			*p = preset
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown backoff preset: %q", text)
+}
@@ -0,0 +1,59 @@
+package retryhttp
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestExponential(t *testing.T) {
+	tests := []struct {
+		base, cap time.Duration
+		attempts  int
+		want      time.Duration
+	}{
+		{time.Second, 10 * time.Second, 0, time.Second},
+		{time.Second, 10 * time.Second, 1, 2 * time.Second},
+		{time.Second, 10 * time.Second, 3, 8 * time.Second},
+		{time.Second, 10 * time.Second, 4, 10 * time.Second},
+		{time.Second, 10 * time.Second, 64, 10 * time.Second},
+		{time.Second, 10 * time.Second, 1 << 30, 10 * time.Second},
+		{time.Second, time.Duration(1<<63 - 1), 100, time.Duration(1<<63 - 1)},
+		{0, 10 * time.Second, 100, 0},
+	}
+	for _, tt := range tests {
+		if got := exponential(tt.base, tt.cap, tt.attempts); got != tt.want {
+			t.Errorf("exponential(%v, %v, %d) = %v, want %v", tt.base, tt.cap, tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// TestExponentialBackoffAndFullJitterManyAttempts は、試行回数が多い場合も待機時間が 0 にならず上限以下であることを検証する
+func TestExponentialBackoffAndFullJitterManyAttempts(t *testing.T) {
+	backoff := exponentialBackoffAndFullJitter(1000, 10000, newLockedRand(rand.NewSource(1)))
+	var zeros int
+	for attempts := 50; attempts < 250; attempts++ {
+		wait := backoff(attempts)
+		if wait < 0 || wait >= 10*time.Second {
+			t.Fatalf("backoff(%d) = %v, want [0s, 10s)", attempts, wait)
+		}
+		if wait == 0 {
+			zeros++
+		}
+	}
+	// NOTE: 0 から 10 秒までの一様乱数のため、0 ミリ秒になるのは 200 回中ほぼ 0 回
+	if zeros > 2 {
+		t.Errorf("backoff returned 0 for %d of 200 attempts", zeros)
+	}
+}
+
+func TestExponentialBackoffAndFullJitterBounds(t *testing.T) {
+	backoff := exponentialBackoffAndFullJitter(1000, 10000, newLockedRand(rand.NewSource(1)))
+	for attempts, upper := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second} {
+		for i := 0; i < 100; i++ {
+			if wait := backoff(attempts); wait < 0 || wait >= upper {
+				t.Fatalf("backoff(%d) = %v, want [0s, %v)", attempts, wait, upper)
+			}
+		}
+	}
+}
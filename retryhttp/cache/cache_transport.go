@@ -0,0 +1,360 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CacheTransport は GET リクエストのレスポンスを Storage にキャッシュするための http.RoundTripper 具象型
+// Cache-Control: max-age の期間内はキャッシュを返却し、期限切れの場合は ETag / Last-Modified で条件付きリクエストを送信する
+// レスポンスの Vary ヘッダーで指定されたリクエストヘッダーの値ごとに、別のレスポンスとしてキャッシュする
+// NOTE: 複数のユーザーで共有するキャッシュとして、RFC 9111 の共有キャッシュと同様に、Authorization ヘッダーのあるリクエストの
+// レスポンスは Cache-Control: public の場合のみキャッシュする
+// NOTE: RetryableTransport の外側に配置すると、キャッシュが有効な間はリトライを含む送信自体を行わない
+type CacheTransport struct {
+	wrapped http.RoundTripper
+	storage Storage
+	// maxBodySize はキャッシュするレスポンスボディの最大サイズ
+	maxBodySize int64
+	// headMinSize は、GET の前に HEAD で変更を確認するキャッシュしたレスポンスボディの最小サイズ。0 の場合は確認しない
+	headMinSize int64
+}
+
+// defaultMaxBodySize はキャッシュするレスポンスボディのデフォルトの最大サイズ
+const defaultMaxBodySize = 10 << 20
+
+// Option は CacheTransport の設定を変更する関数の型定義
+type Option func(*CacheTransport)
+
+// WithMaxBodySize は、キャッシュするレスポンスボディの最大サイズを設定する。デフォルトは 10MiB
+// NOTE: 大きなファイルをキャッシュする場合は、DiskStorage と組み合わせて使用する
+func WithMaxBodySize(size int64) Option {
+	return func(t *CacheTransport) {
+		t.maxBodySize = size
+	}
+}
+
+// WithHeadBeforeGet は、キャッシュの期限が切れたレスポンスボディが minSize バイト以上の場合に、GET の前に条件付きの HEAD リクエストで変更を確認する
+// HEAD のレスポンスが 304 Not Modified の場合や、ETag、Last-Modified、Content-Length がキャッシュと一致する場合は、GET を送信せずにキャッシュを返却する
+// HEAD が失敗した場合や変更されている場合は、通常どおり条件付きの GET を送信する
+// NOTE: 条件付きの GET に 304 を返却せず、変更がなくても全体を返却するサーバーから、大きなリソースを毎回ダウンロードするのを避けるために使用する
+func WithHeadBeforeGet(minSize int64) Option {
+	return func(t *CacheTransport) {
+		t.headMinSize = minSize
+	}
+}
+
+// NewCacheTransport は CacheTransport 構造体を作成する
+func NewCacheTransport(transport http.RoundTripper, storage Storage, opts ...Option) *CacheTransport {
+	t := &CacheTransport{
+		wrapped:     transport,
+		storage:     storage,
+		maxBodySize: defaultMaxBodySize,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// transport は親の Transport を返却する。親がない場合は、http.DefaultTransport を返却する
+func (t *CacheTransport) transport() http.RoundTripper {
+	if t.wrapped == nil {
+		return http.DefaultTransport
+	}
+	return t.wrapped
+}
+
+// RoundTrip はキャッシュが有効であればキャッシュを返却し、そうでなければリクエストを送信してキャッシュする
+func (t *CacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return t.transport().RoundTrip(req)
+	}
+	base := cacheKey(req)
+	key := t.variantKey(base, req)
+
+	cached, storedAt, ok := t.load(key, req)
+	if ok && isFresh(cached, storedAt) {
+		return cached, nil
+	}
+
+	// 大きなレスポンスは、GET の前に HEAD で変更がないか確認する
+	if ok && t.unchangedByHead(req, cached) {
+		t.store(key, cached)
+		return cached, nil
+	}
+
+	out := req
+	if ok {
+		out = conditionalRequest(req, cached)
+	}
+	res, err := t.transport().RoundTrip(out)
+	if err != nil {
+		if cached != nil {
+			cached.Body.Close()
+		}
+		return nil, err
+	}
+
+	// 変更がない場合はキャッシュを返却し、保存時刻を更新する
+	if ok && res.StatusCode == http.StatusNotModified {
+		drain(res)
+		for k, v := range res.Header {
+			cached.Header[k] = v
+		}
+		t.store(key, cached)
+		return cached, nil
+	}
+	if cached != nil {
+		cached.Body.Close()
+	}
+
+	if res.StatusCode != http.StatusOK || !isCacheable(req, res) {
+		return res, nil
+	}
+	return t.storeAndReturn(base, req, res)
+}
+
+// variantKey は、URL のレスポンスの Vary ヘッダーを Storage から読み込み、リクエストのヘッダーの値を含めたキャッシュのキーを返却する
+// Vary ヘッダーのないレスポンスをキャッシュしている場合は base を返却する
+func (t *CacheTransport) variantKey(base string, req *http.Request) string {
+	data, ok, err := t.storage.Get(varyIndexKey(base))
+	if err != nil || !ok || len(data) == 0 {
+		return base
+	}
+	return varyKey(base, req, strings.Split(string(data), ","))
+}
+
+// load は Storage からキャッシュしたレスポンスと保存時刻を読み込む
+func (t *CacheTransport) load(key string, req *http.Request) (*http.Response, time.Time, bool) {
+	data, ok, err := t.storage.Get(key)
+	if err != nil {
+		slog.Warn("cache load failed", "key", key, "error", err)
+		return nil, time.Time{}, false
+	}
+	if !ok || len(data) < 8 {
+		return nil, time.Time{}, false
+	}
+
+	storedAt := time.Unix(0, int64(binary.BigEndian.Uint64(data[:8])))
+	res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data[8:])), req)
+	if err != nil {
+		_ = t.storage.Delete(key)
+		return nil, time.Time{}, false
+	}
+	return res, storedAt, true
+}
+
+// storeAndReturn はレスポンスボディを読み込んでキャッシュし、読み込んだボディを戻したレスポンスを返却する
+// 最大サイズを超える場合はキャッシュせずに返却する
+// NOTE: Vary ヘッダーのヘッダー名を base のキーで保存し、レスポンスはリクエストのヘッダーの値を含めたキーで保存する
+func (t *CacheTransport) storeAndReturn(base string, req *http.Request, res *http.Response) (*http.Response, error) {
+	body, err := io.ReadAll(io.LimitReader(res.Body, t.maxBodySize+1))
+	if err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	if int64(len(body)) > t.maxBodySize {
+		res.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), res.Body), res.Body}
+		return res, nil
+	}
+	res.Body.Close()
+
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	res.ContentLength = int64(len(body))
+	res.TransferEncoding = nil
+
+	key := base
+	if vary, _ := varyHeaders(res); len(vary) > 0 {
+		if err := t.storage.Set(varyIndexKey(base), []byte(strings.Join(vary, ","))); err != nil {
+			slog.Warn("cache store failed", "key", base, "error", err)
+			return res, nil
+		}
+		key = varyKey(base, req, vary)
+	} else if err := t.storage.Delete(varyIndexKey(base)); err != nil {
+		slog.Warn("cache delete failed", "key", base, "error", err)
+	}
+	t.store(key, res)
+	return res, nil
+}
+
+// store はレスポンスを保存時刻とともに Storage に保存する
+// NOTE: httputil.DumpResponse は読み込んだレスポンスボディを戻すため、保存後もレスポンスボディを読み込める
+func (t *CacheTransport) store(key string, res *http.Response) {
+	dump, err := httputil.DumpResponse(res, true)
+	if err != nil {
+		slog.Warn("cache dump failed", "key", key, "error", err)
+		return
+	}
+	data := binary.BigEndian.AppendUint64(make([]byte, 0, 8+len(dump)), uint64(time.Now().UnixNano()))
+	data = append(data, dump...)
+	if err := t.storage.Set(key, data); err != nil {
+		slog.Warn("cache store failed", "key", key, "error", err)
+	}
+}
+
+// cacheKey はリクエストからキャッシュのキーを作成する
+func cacheKey(req *http.Request) string {
+	return req.Method + " " + req.URL.String()
+}
+
+// varyIndexKey は、base のレスポンスの Vary ヘッダーのヘッダー名を保存するキーを作成する
+func varyIndexKey(base string) string {
+	return "vary " + base
+}
+
+// varyKey は、base に Vary ヘッダーで指定されたリクエストヘッダーの値を含めたキーを作成する
+func varyKey(base string, req *http.Request, vary []string) string {
+	var b strings.Builder
+	b.WriteString(base)
+	for _, name := range vary {
+		b.WriteByte('\n')
+		b.WriteString(name)
+		b.WriteString(": ")
+		b.WriteString(strings.Join(req.Header.Values(name), ", "))
+	}
+	return b.String()
+}
+
+// varyHeaders は、レスポンスの Vary ヘッダーのヘッダー名を正規化して昇順で返却する
+// Vary: * の場合は、どのリクエストにも再利用できないため ok に false を返却する
+func varyHeaders(res *http.Response) (names []string, ok bool) {
+	seen := make(map[string]bool)
+	for _, value := range res.Header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return nil, false
+			}
+			if name = http.CanonicalHeaderKey(name); name != "" && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, true
+}
+
+// isCacheable はレスポンスをキャッシュできるか判定する
+// NOTE: 認証したユーザーのレスポンスを他のユーザーに返却しないように、Authorization ヘッダーのあるリクエストは public の場合のみキャッシュする
+func isCacheable(req *http.Request, res *http.Response) bool {
+	directives := cacheDirectives(res.Header)
+	if directives["no-store"] || directives["private"] {
+		return false
+	}
+	if _, ok := varyHeaders(res); !ok {
+		return false
+	}
+	if req.Header.Get("Authorization") != "" && !directives["public"] {
+		return false
+	}
+	return true
+}
+
+// cacheDirectives は、Cache-Control ヘッダーの値のない指示子 (no-store, private, public など) を小文字で返却する
+func cacheDirectives(header http.Header) map[string]bool {
+	directives := make(map[string]bool)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, _, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			directives[strings.ToLower(name)] = true
+		}
+	}
+	return directives
+}
+
+// isFresh は、キャッシュしたレスポンスが Cache-Control: max-age の期間内か判定する
+func isFresh(res *http.Response, storedAt time.Time) bool {
+	for _, directive := range strings.Split(res.Header.Get("Cache-Control"), ",") {
+		directive = strings.TrimSpace(directive)
+		if directive == "no-cache" {
+			return false
+		}
+		if v, ok := strings.CutPrefix(directive, "max-age="); ok {
+			maxAge, err := strconv.Atoi(v)
+			if err != nil {
+				return false
+			}
+			return time.Since(storedAt) < time.Duration(maxAge)*time.Second
+		}
+	}
+	return false
+}
+
+// conditionalRequest は ETag / Last-Modified を元に条件付きリクエストを作成する
+func conditionalRequest(req *http.Request, cached *http.Response) *http.Request {
+	conditional := req.Clone(req.Context())
+	if etag := cached.Header.Get("ETag"); etag != "" {
+		conditional.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := cached.Header.Get("Last-Modified"); lastModified != "" {
+		conditional.Header.Set("If-Modified-Since", lastModified)
+	}
+	return conditional
+}
+
+// unchangedByHead は、WithHeadBeforeGet が指定されている場合に、条件付きの HEAD リクエストでキャッシュしたレスポンスから変更がないか確認する
+// 変更がない場合は、HEAD のレスポンスのヘッダーでキャッシュしたレスポンスのヘッダーを更新する
+func (t *CacheTransport) unchangedByHead(req *http.Request, cached *http.Response) bool {
+	if t.headMinSize <= 0 || cached.ContentLength < t.headMinSize {
+		return false
+	}
+
+	head := conditionalRequest(req, cached)
+	head.Method = http.MethodHead
+	res, err := t.transport().RoundTrip(head)
+	if err != nil {
+		return false
+	}
+	drain(res)
+
+	if res.StatusCode != http.StatusNotModified && !(res.StatusCode == http.StatusOK && sameRepresentation(cached, res)) {
+		return false
+	}
+	for k, v := range res.Header {
+		// NOTE: HEAD のレスポンスはボディを持たないため、ボディの長さを表すヘッダーはキャッシュの値を維持する
+		if k == "Content-Length" || k == "Transfer-Encoding" {
+			continue
+		}
+		cached.Header[k] = v
+	}
+	return true
+}
+
+// sameRepresentation は、HEAD のレスポンスの ETag、Last-Modified、Content-Length がキャッシュしたレスポンスと一致するか判定する
+// NOTE: ETag と Last-Modified がどちらもない場合は、変更を判定できないため一致しないとみなす
+func sameRepresentation(cached, res *http.Response) bool {
+	etag, lastModified := res.Header.Get("ETag"), res.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return false
+	}
+	if etag != "" && (strings.HasPrefix(etag, "W/") || etag != cached.Header.Get("ETag")) {
+		return false
+	}
+	if lastModified != "" && lastModified != cached.Header.Get("Last-Modified") {
+		return false
+	}
+	if res.ContentLength >= 0 && res.ContentLength != cached.ContentLength {
+		return false
+	}
+	return true
+}
+
+// drain はレスポンスボディを読み切ってクローズする
+func drain(res *http.Response) {
+	_, _ = io.Copy(io.Discard, res.Body)
+	_ = res.Body.Close()
+}
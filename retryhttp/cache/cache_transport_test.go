@@ -0,0 +1,292 @@
+package cache
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// origin は、受け付けたリクエスト数を数えて handler でレスポンスを返却するテスト用のサーバー
+type origin struct {
+	*httptest.Server
+	requests atomic.Int64
+}
+
+// newOrigin は origin 構造体を作成してサーバーを起動する
+func newOrigin(t *testing.T, handler http.HandlerFunc) *origin {
+	t.Helper()
+
+	o := &origin{}
+	o.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		o.requests.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(o.Close)
+	return o
+}
+
+// get は transport で GET を送信し、ステータスコードとボディを返却する
+func get(t *testing.T, transport http.RoundTripper, url string, header http.Header) (int, string) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	return res.StatusCode, string(body)
+}
+
+func TestCacheTransportCachesFreshResponses(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheControl string
+		header       http.Header
+		wantRequests int64
+	}{
+		{"max-age", "max-age=60", nil, 1},
+		{"no-cache", "no-cache", nil, 2},
+		{"no max-age", "", nil, 2},
+		{"no-store", "max-age=60, no-store", nil, 2},
+		{"private", "private, max-age=60", nil, 2},
+		{"authorized without public", "max-age=60", http.Header{"Authorization": {"Bearer a"}}, 2},
+		{"authorized with public", "public, max-age=60", http.Header{"Authorization": {"Bearer a"}}, 1},
+		{"upper case directives", "Public, Max-Age=60", http.Header{"Authorization": {"Bearer a"}}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOrigin(t, func(w http.ResponseWriter, r *http.Request) {
+				if tt.cacheControl != "" {
+					w.Header().Set("Cache-Control", tt.cacheControl)
+				}
+				io.WriteString(w, "body")
+			})
+			transport := NewCacheTransport(nil, NewMemoryStorage(0))
+
+			for i := 0; i < 2; i++ {
+				if code, body := get(t, transport, o.URL, tt.header); code != http.StatusOK || body != "body" {
+					t.Errorf("request %d = %d %q, want 200 body", i+1, code, body)
+				}
+			}
+			if got := o.requests.Load(); got != tt.wantRequests {
+				t.Errorf("origin requests = %d, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+// TestCacheTransportAuthorizationIsNotShared は、認証したユーザーのレスポンスを他のユーザーに返却しないことを検証する
+func TestCacheTransportAuthorizationIsNotShared(t *testing.T) {
+	o := newOrigin(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		io.WriteString(w, "profile of "+r.Header.Get("Authorization"))
+	})
+	transport := NewCacheTransport(nil, NewMemoryStorage(0))
+
+	if _, body := get(t, transport, o.URL, http.Header{"Authorization": {"alice"}}); body != "profile of alice" {
+		t.Errorf("alice = %q", body)
+	}
+	if _, body := get(t, transport, o.URL, http.Header{"Authorization": {"bob"}}); body != "profile of bob" {
+		t.Errorf("bob = %q, want bob's own profile", body)
+	}
+}
+
+func TestCacheTransportVary(t *testing.T) {
+	o := newOrigin(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "accept-language, Accept")
+		io.WriteString(w, r.Header.Get("Accept-Language")+" "+r.Header.Get("Accept"))
+	})
+	transport := NewCacheTransport(nil, NewMemoryStorage(0))
+
+	requests := []struct {
+		header http.Header
+		want   string
+		// wantRequests は、このリクエストの後にサーバーが受け付けたリクエスト数
+		wantRequests int64
+	}{
+		{http.Header{"Accept-Language": {"ja"}, "Accept": {"text/html"}}, "ja text/html", 1},
+		{http.Header{"Accept-Language": {"en"}, "Accept": {"text/html"}}, "en text/html", 2},
+		{http.Header{"Accept-Language": {"ja"}, "Accept": {"application/json"}}, "ja application/json", 3},
+		{http.Header{"Accept-Language": {"ja"}, "Accept": {"text/html"}}, "ja text/html", 3},
+		{http.Header{"Accept-Language": {"en"}, "Accept": {"text/html"}, "X-Other": {"1"}}, "en text/html", 3},
+		{http.Header{"Accept": {"text/html"}}, " text/html", 4},
+	}
+	for i, r := range requests {
+		if _, body := get(t, transport, o.URL, r.header); body != r.want {
+			t.Errorf("request %d body = %q, want %q", i+1, body, r.want)
+		}
+		if got := o.requests.Load(); got != r.wantRequests {
+			t.Errorf("after request %d origin requests = %d, want %d", i+1, got, r.wantRequests)
+		}
+	}
+}
+
+func TestCacheTransportVaryStar(t *testing.T) {
+	o := newOrigin(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "*")
+		io.WriteString(w, "body")
+	})
+	transport := NewCacheTransport(nil, NewMemoryStorage(0))
+
+	get(t, transport, o.URL, nil)
+	get(t, transport, o.URL, nil)
+	if got := o.requests.Load(); got != 2 {
+		t.Errorf("origin requests = %d, want 2", got)
+	}
+}
+
+// TestCacheTransportVaryRemoved は、Vary ヘッダーがなくなったレスポンスを URL のキーでキャッシュし直すことを検証する
+func TestCacheTransportVaryRemoved(t *testing.T) {
+	var vary atomic.Bool
+	vary.Store(true)
+	o := newOrigin(t, func(w http.ResponseWriter, r *http.Request) {
+		// 1 回目のみ Vary を付け、キャッシュさせずに期限切れにする
+		if vary.Swap(false) {
+			w.Header().Set("Vary", "Accept")
+			w.Header().Set("Cache-Control", "max-age=0")
+		} else {
+			w.Header().Set("Cache-Control", "max-age=60")
+		}
+		io.WriteString(w, "body")
+	})
+	storage := NewMemoryStorage(0)
+	transport := NewCacheTransport(nil, storage)
+
+	get(t, transport, o.URL, http.Header{"Accept": {"a"}})
+	if _, ok, _ := storage.Get(varyIndexKey(cacheKey(httptest.NewRequest(http.MethodGet, o.URL, nil)))); !ok {
+		t.Fatal("Vary header names are not stored")
+	}
+	get(t, transport, o.URL, http.Header{"Accept": {"a"}})
+	get(t, transport, o.URL, http.Header{"Accept": {"b"}})
+	if got := o.requests.Load(); got != 2 {
+		t.Errorf("origin requests = %d, want 2", got)
+	}
+}
+
+func TestCacheTransportRevalidates(t *testing.T) {
+	o := newOrigin(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "no-cache")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.Header().Set("X-Revalidated", "true")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		io.WriteString(w, "body")
+	})
+	transport := NewCacheTransport(nil, NewMemoryStorage(0))
+
+	get(t, transport, o.URL, nil)
+	req, _ := http.NewRequest(http.MethodGet, o.URL, nil)
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || string(body) != "body" {
+		t.Errorf("revalidated response = %d %q, want the cached 200", res.StatusCode, body)
+	}
+	if res.Header.Get("X-Revalidated") != "true" {
+		t.Error("headers of the 304 response are not merged into the cached response")
+	}
+	if got := o.requests.Load(); got != 2 {
+		t.Errorf("origin requests = %d, want 2", got)
+	}
+}
+
+func TestCacheTransportHeadBeforeGet(t *testing.T) {
+	large := strings.Repeat("x", 100)
+	var gets atomic.Int64
+	o := newOrigin(t, func(w http.ResponseWriter, r *http.Request) {
+		// NOTE: 条件付きリクエストに 304 を返却しないサーバー
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Content-Length", "100")
+		if r.Method == http.MethodGet {
+			gets.Add(1)
+			io.WriteString(w, large)
+		}
+	})
+	transport := NewCacheTransport(nil, NewMemoryStorage(0), WithHeadBeforeGet(50))
+
+	for i := 0; i < 3; i++ {
+		if _, body := get(t, transport, o.URL, nil); body != large {
+			t.Errorf("request %d body has %d bytes, want %d", i+1, len(body), len(large))
+		}
+	}
+	if got := gets.Load(); got != 1 {
+		t.Errorf("GET requests = %d, want 1", got)
+	}
+}
+
+func TestCacheTransportMaxBodySize(t *testing.T) {
+	o := newOrigin(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		io.WriteString(w, strings.Repeat("x", 10))
+	})
+	transport := NewCacheTransport(nil, NewMemoryStorage(0), WithMaxBodySize(5))
+
+	for i := 0; i < 2; i++ {
+		if _, body := get(t, transport, o.URL, nil); len(body) != 10 {
+			t.Errorf("request %d body has %d bytes, want 10", i+1, len(body))
+		}
+	}
+	if got := o.requests.Load(); got != 2 {
+		t.Errorf("origin requests = %d, want 2", got)
+	}
+}
+
+func TestCacheTransportSkipsNonGet(t *testing.T) {
+	o := newOrigin(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+	})
+	transport := NewCacheTransport(nil, NewMemoryStorage(0))
+
+	for _, header := range []http.Header{{"Range": {"bytes=0-1"}}, {"Range": {"bytes=0-1"}}} {
+		get(t, transport, o.URL, header)
+	}
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodPost, o.URL, strings.NewReader("x"))
+		res, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+	if got := o.requests.Load(); got != 4 {
+		t.Errorf("origin requests = %d, want 4", got)
+	}
+}
+
+func TestVaryHeaders(t *testing.T) {
+	tests := []struct {
+		vary   []string
+		want   string
+		wantOK bool
+	}{
+		{nil, "", true},
+		{[]string{"accept-language, Accept"}, "Accept,Accept-Language", true},
+		{[]string{"Accept", "accept"}, "Accept", true},
+		{[]string{"Accept, *"}, "", false},
+	}
+	for _, tt := range tests {
+		names, ok := varyHeaders(&http.Response{Header: http.Header{"Vary": tt.vary}})
+		if strings.Join(names, ",") != tt.want || ok != tt.wantOK {
+			t.Errorf("varyHeaders(%q) = %q, %v, want %q, %v", tt.vary, names, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mtnori/httpRetryExample/retryhttp/encryption"
+)
+
+// diskFileSuffix はキャッシュファイルの拡張子
+const diskFileSuffix = ".cache"
+
+// DiskStorage はディスクに保存する Storage の具象型
+// CLI やバッチジョブで、再起動後もキャッシュを再利用するために使用する
+// 合計サイズが上限を超えた場合は、最も長く参照されていないファイルから削除する (LRU)
+// NOTE: 起動時にディレクトリを走査してインデックスを再構築する。参照順序にはファイルの更新時刻を使用する
+type DiskStorage struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64
+	sealer   *encryption.Sealer
+	size     int64
+	lru      *list.List
+	entries  map[string]*list.Element
+}
+
+// diskEntry は DiskStorage のインデックスのエントリ
+type diskEntry struct {
+	name string
+	size int64
+}
+
+// DiskOption は DiskStorage の設定を変更する関数の型定義
+type DiskOption func(*DiskStorage)
+
+// WithSealer は、キャッシュファイルを AES-GCM で暗号化して保存する
+// NOTE: レスポンスにシークレットが含まれる場合に、平文でディスクに保存しないために使用する
+func WithSealer(sealer *encryption.Sealer) DiskOption {
+	return func(s *DiskStorage) {
+		s.sealer = sealer
+	}
+}
+
+// NewDiskStorage は DiskStorage 構造体を作成し、既存のキャッシュファイルからインデックスを再構築する
+// maxBytes が 0 の場合は上限なし
+func NewDiskStorage(dir string, maxBytes int64, opts ...DiskOption) (*DiskStorage, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	s := &DiskStorage{
+		dir:      dir,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if err := s.rebuildIndex(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get はキーに対応するデータを返却する
+func (s *DiskStorage) Get(key string) ([]byte, bool, error) {
+	name := fileName(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[name]
+	if !ok {
+		return nil, false, nil
+	}
+
+	path := filepath.Join(s.dir, name)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		s.removeEntry(e)
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	s.lru.MoveToFront(e)
+	// 再起動後も参照順序を復元できるように、更新時刻を更新する
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+
+	if s.sealer != nil {
+		data, err = s.sealer.Open(data, []byte(name))
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return data, true, nil
+}
+
+// Set はキーに対応するデータを保存する
+func (s *DiskStorage) Set(key string, data []byte) error {
+	name := fileName(key)
+
+	if s.sealer != nil {
+		sealed, err := s.sealer.Seal(data, []byte(name))
+		if err != nil {
+			return err
+		}
+		data = sealed
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 書き込み途中のファイルを読み込まないように、一時ファイルに書き込んでからリネームする
+	tmp, err := os.CreateTemp(s.dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, name)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if e, ok := s.entries[name]; ok {
+		s.size -= e.Value.(*diskEntry).size
+		s.lru.Remove(e)
+	}
+	s.entries[name] = s.lru.PushFront(&diskEntry{name: name, size: int64(len(data))})
+	s.size += int64(len(data))
+
+	return s.evict()
+}
+
+// Delete はキーに対応するデータを削除する
+func (s *DiskStorage) Delete(key string) error {
+	name := fileName(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[name]
+	if !ok {
+		return nil
+	}
+	return s.removeEntry(e)
+}
+
+// Size はキャッシュファイルの合計サイズを返却する
+func (s *DiskStorage) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.size
+}
+
+// rebuildIndex はディレクトリを走査してインデックスを再構築する
+func (s *DiskStorage) rebuildIndex() error {
+	dirEntries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	type file struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}
+	var files []file
+	for _, de := range dirEntries {
+		if de.IsDir() {
+			continue
+		}
+		// 前回の書き込み途中で残った一時ファイルは削除する
+		if strings.HasPrefix(de.Name(), "tmp-") {
+			_ = os.Remove(filepath.Join(s.dir, de.Name()))
+			continue
+		}
+		if !strings.HasSuffix(de.Name(), diskFileSuffix) {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, file{name: de.Name(), size: info.Size(), modTime: info.ModTime()})
+	}
+
+	// 更新時刻が新しいものほど LRU の先頭になるように、古い順に追加する
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	for _, f := range files {
+		s.entries[f.name] = s.lru.PushFront(&diskEntry{name: f.name, size: f.size})
+		s.size += f.size
+	}
+	return s.evict()
+}
+
+// evict は合計サイズが上限を超えている間、最も長く参照されていないファイルを削除する
+// NOTE: 呼び出し元でロックを取得している必要がある
+func (s *DiskStorage) evict() error {
+	for s.maxBytes > 0 && s.size > s.maxBytes && s.lru.Len() > 0 {
+		if err := s.removeEntry(s.lru.Back()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeEntry はファイルとインデックスのエントリを削除する
+// NOTE: 呼び出し元でロックを取得している必要がある
+func (s *DiskStorage) removeEntry(e *list.Element) error {
+	entry := e.Value.(*diskEntry)
+	s.lru.Remove(e)
+	delete(s.entries, entry.name)
+	s.size -= entry.size
+
+	err := os.Remove(filepath.Join(s.dir, entry.name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// fileName はキーからキャッシュファイル名を作成する
+func fileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:]) + diskFileSuffix
+}
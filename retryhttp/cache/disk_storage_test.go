@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mtnori/httpRetryExample/retryhttp/encryption"
+)
+
+func TestDiskStorage(t *testing.T) {
+	testStorageLRU(t, func(maxBytes int64) Storage {
+		s, err := NewDiskStorage(t.TempDir(), maxBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+// TestDiskStorageRebuildIndex は、再起動後にファイルの更新時刻から参照順序を復元することを検証する
+func TestDiskStorageRebuildIndex(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewDiskStorage(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"old", "new"} {
+		if err := s.Set(key, []byte("data")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// NOTE: 更新時刻の精度に依存しないように、参照順序を明示的に設定する
+	now := time.Now()
+	for key, mtime := range map[string]time.Time{"old": now.Add(-time.Hour), "new": now} {
+		if err := os.Chtimes(filepath.Join(dir, fileName(key)), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 書き込み途中で残った一時ファイルは削除する
+	tmp := filepath.Join(dir, "tmp-123")
+	if err := os.WriteFile(tmp, []byte("partial"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewDiskStorage(dir, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reopened.Size(); got != 4 {
+		t.Errorf("Size = %d, want 4", got)
+	}
+	if _, ok, _ := reopened.Get("old"); ok {
+		t.Error("the least recently used file is not evicted on rebuild")
+	}
+	if data, ok, err := reopened.Get("new"); err != nil || !ok || string(data) != "data" {
+		t.Errorf("Get(new) = %q, %v, %v, want data", data, ok, err)
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("temporary file is not removed: %v", err)
+	}
+}
+
+// TestDiskStorageRemovedFile は、外部で削除されたファイルをキャッシュミスとして扱うことを検証する
+func TestDiskStorageRemovedFile(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewDiskStorage(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("key", []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, fileName("key"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := s.Get("key"); ok || err != nil {
+		t.Errorf("Get = %v, %v, want a miss", ok, err)
+	}
+	if got := s.Size(); got != 0 {
+		t.Errorf("Size = %d, want 0", got)
+	}
+}
+
+func TestDiskStorageWithSealer(t *testing.T) {
+	dir := t.TempDir()
+	sealer := encryption.NewSealer(encryption.StaticKeyProvider{ID: "k1", Value: bytes.Repeat([]byte("k"), 32)})
+	s, err := NewDiskStorage(dir, 0, WithSealer(sealer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("Authorization: Bearer secret")
+	if err := s.Set("key", secret); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(dir, fileName("key")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("secret")) {
+		t.Error("cache file is stored in plaintext")
+	}
+	if data, ok, err := s.Get("key"); err != nil || !ok || !bytes.Equal(data, secret) {
+		t.Errorf("Get = %q, %v, %v, want %q", data, ok, err, secret)
+	}
+
+	// 別のキーのファイルに差し替えた場合は、追加データの検証で改ざんを検知する
+	if err := s.Set("other", []byte("other")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, fileName("other")), filepath.Join(dir, fileName("key"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Get("key"); !errors.Is(err, encryption.ErrInvalidCiphertext) {
+		t.Errorf("Get of a swapped file = %v, want ErrInvalidCiphertext", err)
+	}
+}
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Storage はキャッシュしたレスポンスを保存するインターフェース
+// NOTE: 複数の goroutine から同時に呼び出されても安全である必要がある
+type Storage interface {
+	// Get はキーに対応するデータを返却する。存在しない場合は ok が false となる
+	Get(key string) (data []byte, ok bool, err error)
+	// Set はキーに対応するデータを保存する
+	Set(key string, data []byte) error
+	// Delete はキーに対応するデータを削除する
+	Delete(key string) error
+}
+
+// MemoryStorage はメモリに保存する Storage の具象型
+// 合計サイズが上限を超えた場合は、最も長く参照されていないデータから削除する (LRU)
+type MemoryStorage struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	lru      *list.List
+	entries  map[string]*list.Element
+}
+
+// memoryEntry は MemoryStorage に保存するデータ
+type memoryEntry struct {
+	key  string
+	data []byte
+}
+
+// NewMemoryStorage は MemoryStorage 構造体を作成する。maxBytes が 0 の場合は上限なし
+func NewMemoryStorage(maxBytes int64) *MemoryStorage {
+	return &MemoryStorage{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Get はキーに対応するデータを返却する
+func (s *MemoryStorage) Get(key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	s.lru.MoveToFront(e)
+	return e.Value.(*memoryEntry).data, true, nil
+}
+
+// Set はキーに対応するデータを保存する
+func (s *MemoryStorage) Set(key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		s.size -= int64(len(e.Value.(*memoryEntry).data))
+		s.lru.Remove(e)
+	}
+	s.entries[key] = s.lru.PushFront(&memoryEntry{key: key, data: data})
+	s.size += int64(len(data))
+
+	for s.maxBytes > 0 && s.size > s.maxBytes && s.lru.Len() > 0 {
+		oldest := s.lru.Back()
+		entry := oldest.Value.(*memoryEntry)
+		s.lru.Remove(oldest)
+		delete(s.entries, entry.key)
+		s.size -= int64(len(entry.data))
+	}
+	return nil
+}
+
+// Delete はキーに対応するデータを削除する
+func (s *MemoryStorage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		s.size -= int64(len(e.Value.(*memoryEntry).data))
+		s.lru.Remove(e)
+		delete(s.entries, key)
+	}
+	return nil
+}
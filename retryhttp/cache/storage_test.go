@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"testing"
+)
+
+// testStorageLRU は、上限を超えた場合に最も長く参照されていないデータから削除することを検証する
+func testStorageLRU(t *testing.T, newStorage func(maxBytes int64) Storage) {
+	t.Helper()
+
+	s := newStorage(10)
+	set := func(key, data string) {
+		t.Helper()
+		if err := s.Set(key, []byte(data)); err != nil {
+			t.Fatalf("Set(%q): %v", key, err)
+		}
+	}
+	has := func(key string) bool {
+		t.Helper()
+		_, ok, err := s.Get(key)
+		if err != nil {
+			t.Fatalf("Get(%q): %v", key, err)
+		}
+		return ok
+	}
+
+	set("a", "aaaa")
+	set("b", "bbbb")
+	// a を参照して、b を最も長く参照されていないデータにする
+	if !has("a") {
+		t.Fatal("a is not stored")
+	}
+	set("c", "cccc")
+
+	if has("b") {
+		t.Error("b is not evicted")
+	}
+	if !has("a") || !has("c") {
+		t.Error("recently used data is evicted")
+	}
+
+	// 上書きした場合は古いデータのサイズを差し引く
+	set("a", "a")
+	set("d", "dddd")
+	if !has("a") || !has("c") || !has("d") {
+		t.Error("data is evicted after overwriting with a smaller value")
+	}
+
+	if err := s.Delete("c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("missing"); err != nil {
+		t.Fatal(err)
+	}
+	if has("c") {
+		t.Error("c is not deleted")
+	}
+}
+
+func TestMemoryStorage(t *testing.T) {
+	testStorageLRU(t, func(maxBytes int64) Storage {
+		return NewMemoryStorage(maxBytes)
+	})
+}
+
+func TestMemoryStorageGet(t *testing.T) {
+	s := NewMemoryStorage(0)
+	if err := s.Set("key", []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	data, ok, err := s.Get("key")
+	if err != nil || !ok || string(data) != "data" {
+		t.Errorf("Get = %q, %v, %v, want data", data, ok, err)
+	}
+	if _, ok, _ := s.Get("missing"); ok {
+		t.Error("Get(missing) found data")
+	}
+}
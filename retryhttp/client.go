@@ -0,0 +1,294 @@
+package retryhttp
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/mtnori/httpRetryExample/retryhttp/middleware"
+	"github.com/mtnori/httpRetryExample/retryhttp/stats"
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// Client はリトライ機能を持つ HTTP クライアント
+type Client struct {
+	client *http.Client
+	stats  *stats.RollingWindow
+	// annotations はすべてのリクエストに付与するアノテーション (キーと値の組)
+	annotations []string
+	// defaults は With で追加した、すべてのリクエストに適用するオプション
+	defaults []RequestOption
+	// bufferLimit はレスポンスボディをバッファリングする上限のバイト数。0 の場合はバッファリングしない
+	bufferLimit int64
+	// transport はリトライを行う RetryableTransport
+	transport *retryabletransport.RetryableTransport
+	// runtime は Client が所有するバックグラウンドのゴルーチン
+	runtime *Runtime
+	// async は DoAsync のワーカーとキュー
+	async *asyncQueue
+	// defaultsVersion は、オプションで指定しなかった設定に使用したデフォルトの値のバージョン
+	defaultsVersion DefaultsVersion
+	// err はオプションの設定の誤り
+	err error
+}
+
+// NewClient は Client 構造体を作成する
+// オプションを指定しない場合は、最大 4 回 (リトライ 3 回) の試行、全体で 30 秒のタイムアウト、
+// 1 秒から 10 秒までの指数バックオフ (Full Jitter) を使用する。デフォルトの値は WithDefaults でバージョンを指定して変更する
+// NOTE: オプションの設定に誤りがある場合は、すべてのリクエストは送信せずに Err のエラーを返却する
+func NewClient(opts ...Option) *Client {
+	config := defaultConfig()
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	base := config.transport
+	if base == nil {
+		baseTransport := NewBaseTransport(config.timeouts)
+		if config.proxy != nil {
+			baseTransport.Proxy = config.proxy
+		}
+		// NOTE: Middleware を挟む場合も、WithProxyRotation で選択した試行のプロキシで送信する
+		baseTransport.Proxy = retryabletransport.AttemptProxy(baseTransport.Proxy)
+		if config.alternateAddrDial {
+			baseTransport.DialContext = retryabletransport.AlternateAddrDial(baseTransport.DialContext, nil)
+		}
+		base = baseTransport
+	}
+	if config.propagateDeadline {
+		base = &deadlineTransport{wrapped: base}
+	}
+	if len(config.middlewares) > 0 {
+		base = middleware.Chain(base, config.middlewares...)
+	}
+
+	// 直近のホストごとの統計情報を集計する
+	window := stats.NewRollingWindow(config.statsWindow)
+
+	backoff := config.backoff
+	if backoff == nil {
+		backoff = defaultBackoff(config.defaultsVersion, newLockedRand(config.randSource))
+	}
+
+	checkRetry := config.checkRetry
+	if checkRetry == nil {
+		checkRetry = newShouldRetry(config.retryStatus)
+	}
+
+	transport := retryabletransport.NewRetryableTransport(
+		base,
+		config.maxAttempts-1,
+		checkRetry,
+		backoff,
+		append([]retryabletransport.Option{
+			retryabletransport.WithRecorder(window),
+			retryabletransport.WithAttemptTimeout(config.timeouts.PerAttempt),
+		}, config.transportOptions...)...,
+	)
+
+	// 送信中の同一の GET は、リトライを含めて 1 つのリクエストにまとめる
+	var rt http.RoundTripper = transport
+	if config.singleflight {
+		rt = middleware.NewSingleflightTransport(transport, config.singleflightHeaders...)
+	}
+	if config.err != nil {
+		// NOTE: リトライせず、StandardClient で送信した場合も送信しないように、最も外側でエラーを返却する
+		err := config.err
+		rt = middleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, err
+		})
+	}
+
+	runtime := &Runtime{startupJitter: config.startupJitter}
+	for _, task := range config.backgroundTasks {
+		_ = runtime.Go(task)
+	}
+
+	return &Client{
+		client: &http.Client{
+			Timeout:       config.timeouts.Overall,
+			Transport:     rt,
+			CheckRedirect: config.checkRedirect,
+		},
+		stats:           window,
+		bufferLimit:     config.bufferLimit,
+		transport:       transport,
+		runtime:         runtime,
+		async:           newAsyncQueue(config.asyncWorkers, config.asyncQueueSize),
+		defaultsVersion: config.defaultsVersion,
+		err:             config.err,
+	}
+}
+
+// Err は、NewClient に指定したオプションの設定の誤りを返却する。誤りがない場合は nil
+func (c *Client) Err() error {
+	return c.err
+}
+
+// Stats はホストごとの直近のリクエスト統計を返却する
+// NOTE: アプリケーション側での負荷制御 (ロードシェディング) の判断材料として使用する
+func (c *Client) Stats() *stats.RollingWindow {
+	return c.stats
+}
+
+// Hint は、ホストにリクエストを送信してよいか (healthy, throttled, down) と、送信を遅らせるべき時間を返却する
+// NOTE: アプリケーションのスケジューラーが、リクエストを作成する前に参照してレート制限や障害中のホストへの送信を控えるために使用する
+func (c *Client) Hint(host string) retryabletransport.Hint {
+	return c.transport.Hint(host)
+}
+
+// TransportStats は、リクエスト、試行、理由ごとのリトライ、上限に達したリクエスト、送信中のリクエストの数と、サーキットブレーカーの状態を返却する
+// NOTE: Stats はホストごとの直近の統計のため、作成からの累計は TransportStats を使用する
+func (c *Client) TransportStats() retryabletransport.TransportStats {
+	return c.transport.Stats()
+}
+
+// CanaryStats は、WithCanaryPolicy または WithCanaryProfile の設定と Client の設定を適用したリクエストの集計を返却する
+// どちらも指定されていない場合は false を返却する
+func (c *Client) CanaryStats() (retryabletransport.CanaryStats, bool) {
+	return c.transport.CanaryStats()
+}
+
+// PublishExpvar は、TransportStats の値を name の expvar 変数として公開する。同じ name で複数回呼び出すとパニックする
+func (c *Client) PublishExpvar(name string) {
+	c.transport.PublishExpvar(name)
+}
+
+// Close は、新しいリクエストとバックオフの待機中のリトライを停止し、アイドル状態のコネクションをクローズする
+// バックグラウンドの処理の context.Context も終了する
+// NOTE: 送信中のリクエストとバックグラウンドの処理の終了を待つ場合は Shutdown を使用する。Close の後は Client を再利用できない
+func (c *Client) Close() error {
+	c.runtime.Close()
+	return c.transport.Close()
+}
+
+// Shutdown は、Close と同様にリトライとバックグラウンドの処理を停止し、
+// 送信中のリクエストとバックグラウンドの処理がすべて終了するか ctx が終了するまで待機する
+func (c *Client) Shutdown(ctx context.Context) error {
+	c.runtime.Close()
+	if err := c.transport.Shutdown(ctx); err != nil {
+		return err
+	}
+	return c.runtime.Shutdown(ctx)
+}
+
+// Go は、Client が所有するバックグラウンドのゴルーチンで task を実行する。Close の後は ErrClientClosed を返却する
+// NOTE: 最初のリクエストの送信前に呼び出した場合は、送信時に開始する
+func (c *Client) Go(task BackgroundTask) error {
+	return c.runtime.Go(task)
+}
+
+// StandardClient は内部で使用している *http.Client を返却する
+// NOTE: *http.Client を要求するライブラリに渡す場合に使用する
+func (c *Client) StandardClient() *http.Client {
+	return c.client
+}
+
+// Do はリクエストを送信する。レスポンスボディのクローズは呼び出し元で行う必要がある
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	if len(c.annotations) > 0 {
+		req = req.WithContext(retryabletransport.Annotate(req.Context(), c.annotations...))
+	}
+	req = c.applyDefaults(req)
+	if c.err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, c.err
+	}
+	c.runtime.Start()
+	res, err := c.client.Do(req)
+	if err != nil || c.bufferLimit <= 0 {
+		return res, err
+	}
+	if err := bufferBody(res, c.bufferLimit); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// With は、Transport とコネクションプールを共有し、すべてのリクエストに opts を適用する Client を返却する
+// ヘッダーや認証、リトライポリシーが異なるだけの Client を、新しく作成せずに安価に派生させるために使用する
+// NOTE: リクエストに同じヘッダーが設定されている場合は、リクエストの値が優先される。リトライポリシーは opts の値が優先される
+func (c *Client) With(opts ...RequestOption) *Client {
+	derived := *c
+	derived.defaults = append(append([]RequestOption(nil), c.defaults...), opts...)
+	return &derived
+}
+
+// applyDefaults は With で追加したオプションを適用したリクエストを返却する
+// NOTE: 呼び出し元のリクエストは変更せず、複製に適用する
+func (c *Client) applyDefaults(req *http.Request) *http.Request {
+	if len(c.defaults) == 0 {
+		return req
+	}
+	applied := req.Clone(req.Context())
+	applied.Header = make(http.Header, len(req.Header))
+	for _, opt := range c.defaults {
+		opt(applied)
+	}
+	for k, v := range req.Header {
+		applied.Header[k] = v
+	}
+	return applied
+}
+
+// ExponentialBackoff は base から cap まで倍々に増加する待機時間に、Full Jitter を適用した BackoffFunc を返却する
+// NOTE: Full Jitter は 0 から算出した待機時間までの一様乱数を待機時間とするため、同時に失敗したクライアントのリトライが分散される
+func ExponentialBackoff(base time.Duration, cap time.Duration) retryabletransport.BackoffFunc {
+	return exponentialBackoffAndFullJitter(int(base.Milliseconds()), int(cap.Milliseconds()), newLockedRand(nil))
+}
+
+//func backoff(attempts int) time.Duration {
+//	return time.Duration(math.Pow(2, float64(attempts))) * time.Second
+//}
+
+func exponentialBackoffAndFullJitter(baseMills int, capMills int, random *lockedRand) retryabletransport.BackoffFunc {
+	base := time.Duration(baseMills) * time.Millisecond
+	cap := time.Duration(capMills) * time.Millisecond
+	return func(attempts int) time.Duration {
+		// NOTE: 2^attempts を計算すると試行回数が多い場合に int があふれて待機時間が 0 になるため、上限に達するまで倍にする
+		tempWait := exponential(base, cap, attempts)
+
+		// NOTE: 待機時間は RetryableTransport のバックオフのログに出力される
+		waitMills := random.intn(int(tempWait.Milliseconds()))
+		return time.Duration(waitMills) * time.Millisecond
+	}
+}
+
+// defaultRetryStatusCodes はリトライするステータスコードのデフォルト
+// NOTE: 501 Not Implemented など、リトライしても成功しない 5xx は含めない
+var defaultRetryStatusCodes = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// retryStatusCodes は、codes に含まれるステータスコードをリトライする判定の関数を返却する
+func retryStatusCodes(codes ...int) func(int) bool {
+	retryable := make(map[int]bool, len(codes))
+	for _, code := range codes {
+		retryable[code] = true
+	}
+	return func(code int) bool {
+		return retryable[code]
+	}
+}
+
+// newShouldRetry は、送信エラーとステータスコードからリトライを行うか判定する CheckRetryFunc を返却する
+// NOTE: レート制限 (429) の場合は、Retry-After ヘッダーの待機時間の後にリトライする
+func newShouldRetry(retryStatus func(int) bool) retryabletransport.CheckRetryFunc {
+	return func(res *http.Response, err error) bool {
+		// 証明書のエラーや存在しないホスト、キャンセルなど、リトライしても成功しないエラーはリトライしない
+		if err != nil {
+			return retryabletransport.IsRetryableError(err)
+		}
+		return retryStatus(res.StatusCode)
+	}
+}
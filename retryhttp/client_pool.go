@@ -0,0 +1,76 @@
+package retryhttp
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// TenantAnnotation は ClientPool のクライアントがリクエストに付与するテナントのアノテーションのキー
+const TenantAnnotation = "tenant"
+
+// ClientPool はテナントごとに分離された Client を管理する
+// コネクションプール (親の Transport) は全テナントで共有し、リトライの状態や統計情報などは
+// テナントごとの RetryableTransport に閉じるため、特定のテナントの障害が他のテナントに波及しない
+type ClientPool struct {
+	mu        sync.Mutex
+	base      http.RoundTripper
+	configure func(tenant string) []Option
+	clients   map[string]*Client
+}
+
+// NewClientPool は ClientPool 構造体を作成する
+// base は全テナントで共有する Transport。nil の場合は http.DefaultTransport を使用する
+// configure はテナントごとの Client の設定を返却する関数。nil の場合はデフォルトの設定を使用する
+// NOTE: configure で WithTransport を指定すると、そのテナントはコネクションプールを共有しなくなる
+func NewClientPool(base http.RoundTripper, configure func(tenant string) []Option) *ClientPool {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &ClientPool{
+		base:      base,
+		configure: configure,
+		clients:   make(map[string]*Client),
+	}
+}
+
+// Client はテナントの Client を返却する。存在しない場合は作成する
+// 返却した Client が送信するリクエストには、TenantAnnotation のアノテーションが付与される
+func (p *ClientPool) Client(tenant string) *Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if c, ok := p.clients[tenant]; ok {
+		return c
+	}
+
+	opts := []Option{WithTransport(p.base)}
+	if p.configure != nil {
+		opts = append(opts, p.configure(tenant)...)
+	}
+	c := NewClient(opts...)
+	c.annotations = []string{TenantAnnotation, tenant}
+	p.clients[tenant] = c
+	return c
+}
+
+// Remove はテナントの Client を破棄する
+func (p *ClientPool) Remove(tenant string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.clients, tenant)
+}
+
+// Tenants は Client を作成済みのテナントの一覧を返却する
+func (p *ClientPool) Tenants() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tenants := make([]string, 0, len(p.clients))
+	for t := range p.clients {
+		tenants = append(tenants, t)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
@@ -0,0 +1,183 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Feature は生成するコードに含める機能
+type Feature string
+
+const (
+	// FeatureRetry はリトライの設定 (試行回数、タイムアウト、バックオフ)。常に含まれる
+	FeatureRetry Feature = "retry"
+	// FeatureMetrics は Prometheus のメトリクス
+	FeatureMetrics Feature = "metrics"
+	// FeatureOTel は OpenTelemetry のトレース
+	FeatureOTel Feature = "otel"
+	// FeatureAuth は環境変数のトークンによる Bearer 認証
+	FeatureAuth Feature = "auth"
+)
+
+// Features は指定できる機能の一覧
+var Features = []Feature{FeatureRetry, FeatureMetrics, FeatureOTel, FeatureAuth}
+
+// Config は生成するコードの設定
+type Config struct {
+	// Package は生成するコードのパッケージ名
+	Package string
+	// FuncName は Client を作成する関数名
+	FuncName string
+	Features []Feature
+}
+
+// ParseFeatures は "retry,metrics" のようなカンマ区切りの文字列から機能を取得する
+func ParseFeatures(s string) ([]Feature, error) {
+	var features []Feature
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		f := Feature(name)
+		if !f.valid() {
+			return nil, fmt.Errorf("unknown feature %q (available: %s)", name, joinFeatures(Features))
+		}
+		features = append(features, f)
+	}
+	return features, nil
+}
+
+func (f Feature) valid() bool {
+	for _, known := range Features {
+		if f == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Generate は、指定した機能を設定した Client を作成するコードを w に出力する
+// NOTE: 生成したコードは gofmt 済みのため、そのまま貼り付けて使用できる
+func Generate(w io.Writer, config Config) error {
+	if config.Package == "" {
+		config.Package = "main"
+	}
+	if config.FuncName == "" {
+		config.FuncName = "newClient"
+	}
+	enabled := make(map[Feature]bool, len(config.Features))
+	for _, f := range config.Features {
+		if !f.valid() {
+			return fmt.Errorf("unknown feature %q", f)
+		}
+		enabled[f] = true
+	}
+
+	var buf bytes.Buffer
+	err := clientTemplate.Execute(&buf, map[string]any{
+		"Package":  config.Package,
+		"FuncName": config.FuncName,
+		"Metrics":  enabled[FeatureMetrics],
+		"OTel":     enabled[FeatureOTel],
+		"Auth":     enabled[FeatureAuth],
+	})
+	if err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("format generated code: %w", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// joinFeatures は機能の一覧をソートしてカンマ区切りの文字列にする
+func joinFeatures(features []Feature) string {
+	names := make([]string, len(features))
+	for i, f := range features {
+		names[i] = string(f)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// clientTemplate は Client を作成するコードのテンプレート
+// NOTE: 認証はリトライのたびにトークンを付与し直すように RetryableTransport の内側に、試行ごとのメトリクスはさらにその内側に配置する
+var clientTemplate = template.Must(template.New("client").Parse(`// Generated by github.com/mtnori/httpRetryExample/cmd/gen. Edit as needed.
+
+package {{.Package}}
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/mtnori/httpRetryExample/retryhttp"
+{{- if .Auth}}
+	"github.com/mtnori/httpRetryExample/retryhttp/auth"
+{{- end}}
+{{- if .Metrics}}
+	"github.com/mtnori/httpRetryExample/retryhttp/metrics"
+{{- end}}
+{{- if .OTel}}
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+{{- end}}
+{{- if .Metrics}}
+
+	"github.com/prometheus/client_golang/prometheus"
+{{- end}}
+{{- if .OTel}}
+	"go.opentelemetry.io/otel"
+{{- end}}
+)
+
+// {{.FuncName}} はリトライ機能を持つ Client を作成する
+func {{.FuncName}}({{if .Metrics}}reg prometheus.Registerer{{end}}) ({{if .Metrics}}*retryhttp.Client, error{{else}}*retryhttp.Client{{end}}) {
+	timeouts := retryhttp.DefaultTimeoutConfig()
+	timeouts.PerAttempt = 10 * time.Second
+	timeouts.Overall = 30 * time.Second
+
+	// コネクション確立、TLS ハンドシェイク、レスポンスヘッダーのタイムアウトを設定した親の Transport
+	base := retryhttp.NewBaseTransport(timeouts)
+	var transport http.RoundTripper = base
+{{- if .Metrics}}
+
+	m, err := metrics.NewPrometheusMetrics(reg, "myservice")
+	if err != nil {
+		return nil, err
+	}
+	transport = m.InstrumentAttempts(transport)
+{{- end}}
+{{- if .Auth}}
+
+	// リトライのたびにトークンを付与し直すように、RetryableTransport の内側に配置する
+	tokens := auth.NewCachingTokenProvider(&auth.EnvTokenProvider{Name: "API_TOKEN"}, 5*time.Minute)
+	transport = auth.NewBearerTransport(transport, tokens)
+{{- end}}
+
+	opts := []retryhttp.Option{
+		retryhttp.WithTimeouts(timeouts),
+		retryhttp.WithTransport(transport),
+		retryhttp.WithMaxAttempts(4),
+		retryhttp.WithBackoff(retryhttp.NewBackoff(retryhttp.BackoffConfig{
+			Base:   500 * time.Millisecond,
+			Cap:    10 * time.Second,
+			Jitter: retryhttp.JitterFull,
+		})),
+	}
+{{- if .Metrics}}
+	opts = append(opts, retryhttp.WithTransportOptions(m.Options()...))
+{{- end}}
+{{- if .OTel}}
+	opts = append(opts, retryhttp.WithTransportOptions(retryabletransport.WithTracerProvider(otel.GetTracerProvider())))
+{{- end}}
+
+	return retryhttp.NewClient(opts...){{if .Metrics}}, nil{{end}}
+}
+`))
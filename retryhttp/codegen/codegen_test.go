@@ -0,0 +1,112 @@
+package codegen
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseFeatures(t *testing.T) {
+	got, err := ParseFeatures(" retry, metrics,,otel ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Feature{FeatureRetry, FeatureMetrics, FeatureOTel}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseFeatures = %v, want %v", got, want)
+	}
+
+	_, err = ParseFeatures("retry,tracing")
+	if err == nil || !strings.Contains(err.Error(), `"tracing"`) || !strings.Contains(err.Error(), "auth, metrics, otel, retry") {
+		t.Errorf("err = %v, want unknown feature with the available features", err)
+	}
+}
+
+// generate は config でコードを生成して構文解析する
+func generate(t *testing.T, config Config) *ast.File {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := Generate(&buf, config); err != nil {
+		t.Fatalf("Generate(%+v): %v", config, err)
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), "client.go", buf.Bytes(), parser.ParseComments)
+	if err != nil {
+		t.Fatalf("generated code does not parse: %v\n%s", err, buf.String())
+	}
+	return file
+}
+
+// imports は file が import しているパッケージのパスを返却する
+func imports(file *ast.File) map[string]bool {
+	paths := make(map[string]bool)
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		paths[path] = true
+	}
+	return paths
+}
+
+func TestGenerate(t *testing.T) {
+	featureImports := map[Feature]string{
+		FeatureMetrics: "github.com/prometheus/client_golang/prometheus",
+		FeatureOTel:    "go.opentelemetry.io/otel",
+		FeatureAuth:    "github.com/mtnori/httpRetryExample/retryhttp/auth",
+	}
+	// NOTE: 機能のすべての組み合わせで、未使用の import がないことを import の有無で検証する
+	optional := []Feature{FeatureMetrics, FeatureOTel, FeatureAuth}
+	for mask := 0; mask < 1<<len(optional); mask++ {
+		features := []Feature{FeatureRetry}
+		for i, f := range optional {
+			if mask&(1<<i) != 0 {
+				features = append(features, f)
+			}
+		}
+
+		file := generate(t, Config{Features: features})
+		paths := imports(file)
+		enabled := make(map[Feature]bool)
+		for _, f := range features {
+			enabled[f] = true
+		}
+		for f, path := range featureImports {
+			if paths[path] != enabled[f] {
+				t.Errorf("features %v: import %s = %v, want %v", features, path, paths[path], enabled[f])
+			}
+		}
+		if !paths["github.com/mtnori/httpRetryExample/retryhttp"] {
+			t.Errorf("features %v: retryhttp is not imported", features)
+		}
+	}
+}
+
+func TestGenerateNames(t *testing.T) {
+	file := generate(t, Config{})
+	if file.Name.Name != "main" || file.Scope.Lookup("newClient") == nil {
+		t.Errorf("default package %s, want main with newClient", file.Name.Name)
+	}
+
+	file = generate(t, Config{Package: "httpclient", FuncName: "NewOrders", Features: []Feature{FeatureMetrics}})
+	fn, ok := file.Scope.Lookup("NewOrders").Decl.(*ast.FuncDecl)
+	if file.Name.Name != "httpclient" || !ok {
+		t.Fatalf("package %s, want httpclient with NewOrders", file.Name.Name)
+	}
+	// NOTE: メトリクスを含む場合は、Registerer を受け取りエラーを返却する
+	if fn.Type.Params.NumFields() != 1 || fn.Type.Results.NumFields() != 2 {
+		t.Errorf("NewOrders has %d params and %d results, want 1 and 2", fn.Type.Params.NumFields(), fn.Type.Results.NumFields())
+	}
+}
+
+func TestGenerateUnknownFeature(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Generate(&buf, Config{Features: []Feature{"tracing"}}); err == nil {
+		t.Error("Generate accepted an unknown feature")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Generate wrote %d bytes on error", buf.Len())
+	}
+}
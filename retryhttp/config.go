@@ -0,0 +1,217 @@
+package retryhttp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mtnori/httpRetryExample/retryhttp/middleware"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config は、設定ファイルや環境変数から読み込む NewClient の設定
+// NOTE: 同じバイナリを複数の環境にデプロイする場合に、再コンパイルせずにリトライの設定を変更するために使用する
+type Config struct {
+	// MaxAttempts は最初の試行を含む最大試行回数
+	MaxAttempts int `yaml:"max_attempts"`
+	// BackoffBase と BackoffCap は指数バックオフの待機時間の基準と上限。"500ms" や "10s" の形式で指定する
+	BackoffBase time.Duration `yaml:"backoff_base"`
+	BackoffCap  time.Duration `yaml:"backoff_cap"`
+	// Jitter はバックオフのゆらぎの種類。"full", "equal", "decorrelated", "none" のいずれか
+	Jitter           Jitter        `yaml:"jitter"`
+	RetryStatusCodes []int         `yaml:"retry_status_codes"`
+	Timeouts         TimeoutConfig `yaml:"timeouts"`
+	// BackoffPreset は名前付きのバックオフの設定。"aggressive", "standard", "conservative" のいずれか
+	// 指定した場合は、BackoffBase、BackoffCap、Jitter の代わりに使用する
+	BackoffPreset BackoffPreset `yaml:"backoff_preset"`
+	// Middlewares は、middleware.RegisterPlugin で登録した Plugin の名前と設定。先頭の Middleware が最も外側になる
+	Middlewares []MiddlewareConfig `yaml:"middlewares"`
+}
+
+// MiddlewareConfig は、設定ファイルで指定する Plugin の名前と設定
+// 例 (YAML):
+//
+//	middlewares:
+//	  - name: request-signer
+//	    config:
+//	      key_id: primary
+type MiddlewareConfig struct {
+	Name   string         `yaml:"name"`
+	Config map[string]any `yaml:"config"`
+}
+
+// DefaultConfig は NewClient のデフォルトと同じ設定を返却する
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts:      4,
+		BackoffBase:      time.Second,
+		BackoffCap:       10 * time.Second,
+		Jitter:           JitterFull,
+		RetryStatusCodes: append([]int(nil), defaultRetryStatusCodes...),
+		Timeouts:         DefaultTimeoutConfig(),
+	}
+}
+
+// LoadConfig は、path の JSON または YAML の設定ファイルを読み込み、環境変数の設定で上書きした設定を返却する
+// 設定ファイルにない項目はデフォルトの値を使用する。path が空文字列の場合は、デフォルトの設定を環境変数で上書きする
+// NOTE: JSON は YAML として読み込めるため、拡張子に関わらず同じ方法で読み込む。未知の項目はエラーとする
+func LoadConfig(path string) (Config, error) {
+	config := DefaultConfig()
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return Config{}, err
+		}
+		defer f.Close()
+
+		decoder := yaml.NewDecoder(f)
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+			return Config{}, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := config.ApplyEnv(os.LookupEnv); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// configEnvPrefix は、Config を上書きする環境変数の名前の接頭辞
+const configEnvPrefix = "HTTPRETRY_"
+
+// ApplyEnv は、環境変数の値で設定を上書きする。lookup には通常 os.LookupEnv を指定する
+// 環境変数の名前は HTTPRETRY_ に続けて、MAX_ATTEMPTS, BACKOFF_BASE, BACKOFF_CAP, JITTER, BACKOFF_PRESET, RETRY_STATUS_CODES (カンマ区切り),
+// TIMEOUT, ATTEMPT_TIMEOUT, CONNECT_TIMEOUT, TLS_HANDSHAKE_TIMEOUT, RESPONSE_HEADER_TIMEOUT を指定する
+func (c *Config) ApplyEnv(lookup func(key string) (string, bool)) error {
+	durations := []struct {
+		name   string
+		target *time.Duration
+	}{
+		{"BACKOFF_BASE", &c.BackoffBase},
+		{"BACKOFF_CAP", &c.BackoffCap},
+		{"TIMEOUT", &c.Timeouts.Overall},
+		{"ATTEMPT_TIMEOUT", &c.Timeouts.PerAttempt},
+		{"CONNECT_TIMEOUT", &c.Timeouts.Connect},
+		{"TLS_HANDSHAKE_TIMEOUT", &c.Timeouts.TLSHandshake},
+		{"RESPONSE_HEADER_TIMEOUT", &c.Timeouts.ResponseHeader},
+	}
+	for _, d := range durations {
+		value, ok := lookup(configEnvPrefix + d.name)
+		if !ok {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s%s: %w", configEnvPrefix, d.name, err)
+		}
+		*d.target = parsed
+	}
+
+	if value, ok := lookup(configEnvPrefix + "MAX_ATTEMPTS"); ok {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%sMAX_ATTEMPTS: %w", configEnvPrefix, err)
+		}
+		c.MaxAttempts = n
+	}
+	if value, ok := lookup(configEnvPrefix + "JITTER"); ok {
+		if err := c.Jitter.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("%sJITTER: %w", configEnvPrefix, err)
+		}
+	}
+	if value, ok := lookup(configEnvPrefix + "BACKOFF_PRESET"); ok {
+		if err := c.BackoffPreset.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("%sBACKOFF_PRESET: %w", configEnvPrefix, err)
+		}
+	}
+	if value, ok := lookup(configEnvPrefix + "RETRY_STATUS_CODES"); ok {
+		codes := []int{}
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field == "" {
+				continue
+			}
+			code, err := strconv.Atoi(field)
+			if err != nil {
+				return fmt.Errorf("%sRETRY_STATUS_CODES: %w", configEnvPrefix, err)
+			}
+			codes = append(codes, code)
+		}
+		c.RetryStatusCodes = codes
+	}
+	return nil
+}
+
+// Validate は設定が矛盾していないか検証する
+func (c Config) Validate() error {
+	if c.MaxAttempts < 1 {
+		return fmt.Errorf("max attempts must be at least 1: %d", c.MaxAttempts)
+	}
+	if c.BackoffBase < 0 || c.BackoffCap < c.BackoffBase {
+		return fmt.Errorf("backoff base %s must not be negative or exceed cap %s", c.BackoffBase, c.BackoffCap)
+	}
+	if _, ok := c.BackoffPreset.Backoff(); c.BackoffPreset != "" && !ok {
+		return fmt.Errorf("unknown backoff preset: %q", c.BackoffPreset)
+	}
+	// NOTE: Plugin の設定の誤りを Client の作成前に検出するため、Plugin を作成して初期化する
+	for _, mw := range c.Middlewares {
+		if _, err := middleware.DefaultPluginRegistry.New(mw.Name, mw.Config); err != nil {
+			return err
+		}
+	}
+	return c.Timeouts.Validate()
+}
+
+// Options は、設定を NewClient の Option に変換する
+func (c Config) Options() []Option {
+	backoff := WithBackoff(NewBackoff(BackoffConfig{Base: c.BackoffBase, Cap: c.BackoffCap, Jitter: c.Jitter}))
+	if c.BackoffPreset != "" {
+		backoff = WithBackoffPreset(c.BackoffPreset)
+	}
+	opts := []Option{
+		WithMaxAttempts(c.MaxAttempts),
+		backoff,
+		WithRetryStatusCodes(c.RetryStatusCodes...),
+		WithTimeouts(c.Timeouts),
+	}
+	if len(c.Middlewares) > 0 {
+		opts = append(opts, WithMiddleware(c.middlewares()...))
+	}
+	return opts
+}
+
+// middlewares は、Middlewares の Plugin を DefaultPluginRegistry で作成した Middleware を返却する
+// NOTE: Validate で検証していない設定の Plugin を作成できない場合は、設定を無視して送信しないように、すべての試行でエラーを返却する
+func (c Config) middlewares() []middleware.Middleware {
+	mws := make([]middleware.Middleware, 0, len(c.Middlewares))
+	for _, config := range c.Middlewares {
+		mw, err := middleware.DefaultPluginRegistry.New(config.Name, config.Config)
+		if err != nil {
+			mw = func(http.RoundTripper) http.RoundTripper {
+				return middleware.RoundTripperFunc(func(*http.Request) (*http.Response, error) {
+					return nil, err
+				})
+			}
+		}
+		mws = append(mws, mw)
+	}
+	return mws
+}
+
+// NewClientFromConfig は、設定と opts を検証して Client 構造体を作成する。opts は設定より優先する
+func NewClientFromConfig(config Config, opts ...Option) (*Client, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	client := NewClient(append(config.Options(), opts...)...)
+	if err := client.Err(); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	return client, nil
+}
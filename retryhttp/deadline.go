@@ -0,0 +1,70 @@
+package retryhttp
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HeaderTimeoutBudget は、呼び出し元が待機する残り時間 (ミリ秒) を伝えるヘッダー
+const HeaderTimeoutBudget = "X-Timeout-Budget"
+
+// InboundContext は、受信したリクエストから送信するリクエストの context.Context を作成する
+// 受信したリクエストの context.Context (呼び出し元の切断でキャンセルされる) に、X-Timeout-Budget ヘッダーの残り時間をデッドラインとして設定する
+// margin は自身がレスポンスを返却するための時間で、残り時間から差し引く
+// NOTE: 呼び出し元が待機をやめた後にリトライを続けないように、ハンドラーで Client を使用する場合はこの context.Context を使用する
+func InboundContext(r *http.Request, margin time.Duration) (context.Context, context.CancelFunc) {
+	ctx := r.Context()
+	budget, ok := parseTimeoutBudget(r.Header.Get(HeaderTimeoutBudget))
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, budget-margin)
+}
+
+// MirrorDeadline は、受信したリクエストの context.Context を InboundContext に置き換える http.Handler のミドルウェア
+func MirrorDeadline(margin time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := InboundContext(r, margin)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// WithDeadlinePropagation は、各試行のリクエストに context.Context のデッドラインまでの残り時間を X-Timeout-Budget ヘッダーで付与する
+// NOTE: RetryableTransport の内側で付与するため、リトライした試行には待機した時間を差し引いた残り時間が付与される
+func WithDeadlinePropagation() Option {
+	return func(c *config) {
+		c.propagateDeadline = true
+	}
+}
+
+// deadlineTransport は X-Timeout-Budget ヘッダーを付与する http.RoundTripper 具象型
+type deadlineTransport struct {
+	wrapped http.RoundTripper
+}
+
+// RoundTrip は context.Context にデッドラインがあれば、残り時間をヘッダーに付与して送信する
+func (t *deadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	deadline, ok := req.Context().Deadline()
+	if !ok {
+		return t.wrapped.RoundTrip(req)
+	}
+	remaining := time.Until(deadline).Milliseconds()
+	propagated := req.Clone(req.Context())
+	propagated.Header.Set(HeaderTimeoutBudget, strconv.FormatInt(max(remaining, 0), 10))
+	return t.wrapped.RoundTrip(propagated)
+}
+
+// parseTimeoutBudget は X-Timeout-Budget ヘッダーの値を解釈する
+func parseTimeoutBudget(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	millis, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || millis < 0 {
+		return 0, false
+	}
+	return time.Duration(millis) * time.Millisecond, true
+}
@@ -0,0 +1,229 @@
+package retryhttp
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// DefaultsVersion は、NewClient がオプションで指定しなかった設定に使用するデフォルトの値 (リトライの動作) のバージョン
+// NOTE: パッケージを更新してもリトライの動作が暗黙的に変わらないように、デフォルトの値を変更する場合は新しいバージョンとして追加し、
+// 既存のバージョンの値は変更しない。新しいバージョンは WithDefaults で明示的に指定した場合のみ使用する
+type DefaultsVersion int
+
+const (
+	// DefaultsV1 は最初のデフォルトの値。WithDefaults を指定しない場合に使用する
+	DefaultsV1 DefaultsVersion = 1
+)
+
+// LatestDefaults は最新のデフォルトの値のバージョン
+// NOTE: NewClient は WithDefaults を指定しない場合に DefaultsV1 を使用するため、最新のデフォルトの値を使用する場合は WithDefaults(LatestDefaults) を指定する
+// LatestDefaults はパッケージの更新で変わるため、動作を固定する場合は DefaultsV1 のようにバージョンを指定する
+const LatestDefaults = DefaultsV1
+
+// String は DefaultsVersion の名前 ("v1" など) を返却する
+func (v DefaultsVersion) String() string {
+	return "v" + strconv.Itoa(int(v))
+}
+
+// MarshalText は DefaultsVersion を名前に変換する
+func (v DefaultsVersion) MarshalText() ([]byte, error) {
+	if _, ok := defaultsVersions[v]; !ok {
+		return nil, fmt.Errorf("unknown defaults version: %d", int(v))
+	}
+	return []byte(v.String()), nil
+}
+
+// UnmarshalText は名前 ("v1" または "1") から DefaultsVersion を設定する。未知のバージョンの場合はエラーを返却する
+func (v *DefaultsVersion) UnmarshalText(text []byte) error {
+	n, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(string(text)), "v"))
+	if err != nil {
+		return fmt.Errorf("unknown defaults version: %q", text)
+	}
+	if _, ok := defaultsVersions[DefaultsVersion(n)]; !ok {
+		return fmt.Errorf("unknown defaults version: %q", text)
+	}
+	*v = DefaultsVersion(n)
+	return nil
+}
+
+// Defaults は、あるバージョンのデフォルトの値。JSON に変換して、バージョン間の差分をツールで比較するために使用する
+type Defaults struct {
+	Version DefaultsVersion `json:"version"`
+	// MaxAttempts は最初の試行を含む最大試行回数
+	MaxAttempts int           `json:"max_attempts"`
+	Timeouts    TimeoutConfig `json:"timeouts"`
+	// Backoff は WithBackoff を指定しない場合のバックオフ。Source は使用せず、WithRandSource の生成元を使用する
+	Backoff BackoffConfig `json:"backoff"`
+	// RetryStatusCodes は WithRetryStatusCodes を指定しない場合にリトライするステータスコード
+	RetryStatusCodes []int `json:"retry_status_codes"`
+	// NoRetrySignals はリトライしない、サーバーからの指示
+	NoRetrySignals retryabletransport.NoRetrySignals `json:"no_retry_signals"`
+	// StatsWindow は Stats で集計する直近の期間
+	StatsWindow time.Duration `json:"stats_window"`
+	// MaxDrainBytes は、コネクションを再利用するために読み捨てるレスポンスボディの最大バイト数
+	MaxDrainBytes int64 `json:"max_drain_bytes"`
+	// MaxBodyBuffer は、リトライのためにリクエストボディをバッファリングする上限のバイト数
+	MaxBodyBuffer int64 `json:"max_body_buffer"`
+}
+
+// DefaultsChange は、デフォルトの値の変更履歴の 1 つのバージョン
+type DefaultsChange struct {
+	Version DefaultsVersion `json:"version"`
+	// Summary は変更の概要
+	Summary string `json:"summary"`
+	// Changed は前のバージョンから値が変わった Defaults の項目の JSON の名前
+	Changed []string `json:"changed"`
+}
+
+// defaultsVersion はバージョンごとのデフォルトの値と、前のバージョンからの変更の概要
+type defaultsVersion struct {
+	defaults Defaults
+	summary  string
+}
+
+// defaultsVersions はバージョンごとのデフォルトの値
+// NOTE: リリースしたバージョンの値は変更しない。NoRetrySignals や RetryStatusCodes も、変数を参照せずに値を記載する
+var defaultsVersions = map[DefaultsVersion]defaultsVersion{
+	DefaultsV1: {
+		defaults: Defaults{
+			Version:     DefaultsV1,
+			MaxAttempts: 4,
+			Timeouts: TimeoutConfig{
+				Connect:      30 * time.Second,
+				TLSHandshake: 10 * time.Second,
+				Overall:      30 * time.Second,
+			},
+			Backoff: BackoffConfig{Base: time.Second, Cap: 10 * time.Second, Jitter: JitterFull},
+			RetryStatusCodes: []int{
+				http.StatusRequestTimeout,
+				http.StatusTooManyRequests,
+				http.StatusInternalServerError,
+				http.StatusBadGateway,
+				http.StatusServiceUnavailable,
+				http.StatusGatewayTimeout,
+			},
+			NoRetrySignals: retryabletransport.NoRetrySignals{
+				Headers:     map[string][]string{retryabletransport.HeaderNoRetry: {"true", "1"}},
+				StatusCodes: []int{http.StatusRequestEntityTooLarge, http.StatusNotImplemented, http.StatusHTTPVersionNotSupported},
+			},
+			StatsWindow:   5 * time.Minute,
+			MaxDrainBytes: 4 << 10,
+			MaxBodyBuffer: 10 << 20,
+		},
+		summary: "initial defaults",
+	},
+}
+
+// DefaultsFor は version のデフォルトの値を返却する。未知のバージョンの場合はエラーを返却する
+func DefaultsFor(version DefaultsVersion) (Defaults, error) {
+	v, ok := defaultsVersions[version]
+	if !ok {
+		return Defaults{}, fmt.Errorf("unknown defaults version: %d", int(version))
+	}
+	return v.defaults.clone(), nil
+}
+
+// DefaultsChangelog は、バージョンの昇順に、デフォルトの値の変更履歴を返却する
+// NOTE: パッケージの更新時に、Changed の項目に依存しているサービスが WithDefaults で新しいバージョンに移行できるか判断するために使用する
+func DefaultsChangelog() []DefaultsChange {
+	changelog := make([]DefaultsChange, 0, len(defaultsVersions))
+	var previous *Defaults
+	for version := DefaultsV1; version <= LatestDefaults; version++ {
+		v := defaultsVersions[version]
+		changelog = append(changelog, DefaultsChange{
+			Version: version,
+			Summary: v.summary,
+			Changed: v.defaults.changedFrom(previous),
+		})
+		previous = &v.defaults
+	}
+	return changelog
+}
+
+// clone は呼び出し元が変更しても defaultsVersions に影響しないように、スライスとマップを複製した Defaults を返却する
+func (d Defaults) clone() Defaults {
+	d.RetryStatusCodes = append([]int(nil), d.RetryStatusCodes...)
+	headers := make(map[string][]string, len(d.NoRetrySignals.Headers))
+	for name, values := range d.NoRetrySignals.Headers {
+		headers[name] = append([]string(nil), values...)
+	}
+	d.NoRetrySignals = retryabletransport.NoRetrySignals{
+		Headers:     headers,
+		StatusCodes: append([]int(nil), d.NoRetrySignals.StatusCodes...),
+	}
+	return d
+}
+
+// changedFrom は previous から値が変わった項目の JSON の名前を返却する。previous が nil の場合はすべての項目を返却する
+func (d Defaults) changedFrom(previous *Defaults) []string {
+	fields := []struct {
+		name    string
+		changed bool
+	}{
+		{"max_attempts", previous == nil || d.MaxAttempts != previous.MaxAttempts},
+		{"timeouts", previous == nil || d.Timeouts != previous.Timeouts},
+		{"backoff", previous == nil || d.Backoff.Base != previous.Backoff.Base ||
+			d.Backoff.Cap != previous.Backoff.Cap || d.Backoff.Jitter != previous.Backoff.Jitter},
+		{"retry_status_codes", previous == nil || fmt.Sprint(d.RetryStatusCodes) != fmt.Sprint(previous.RetryStatusCodes)},
+		{"no_retry_signals", previous == nil || fmt.Sprint(d.NoRetrySignals) != fmt.Sprint(previous.NoRetrySignals)},
+		{"stats_window", previous == nil || d.StatsWindow != previous.StatsWindow},
+		{"max_drain_bytes", previous == nil || d.MaxDrainBytes != previous.MaxDrainBytes},
+		{"max_body_buffer", previous == nil || d.MaxBodyBuffer != previous.MaxBodyBuffer},
+	}
+	var changed []string
+	for _, field := range fields {
+		if field.changed {
+			changed = append(changed, field.name)
+		}
+	}
+	return changed
+}
+
+// WithDefaults は、オプションで指定しなかった設定に version のデフォルトの値を使用する
+// 例: NewClient(WithDefaults(DefaultsV1), WithMaxAttempts(2))
+// NOTE: 指定より前のオプションの設定をデフォルトの値で上書きするため、最初に指定する
+// 未知のバージョンを指定した場合は、意図しないバージョンの動作で送信しないように、Client のすべてのリクエストがエラーを返却する
+// エラーは Client.Err、または NewClientFromConfig と NewClientWithTimeouts の戻り値で確認できる
+func WithDefaults(version DefaultsVersion) Option {
+	defaults, err := DefaultsFor(version)
+	return func(c *config) {
+		if err != nil {
+			c.setErr(err)
+			return
+		}
+		c.defaultsVersion = defaults.Version
+		c.maxAttempts = defaults.MaxAttempts
+		c.timeouts = defaults.Timeouts
+		c.backoff = nil
+		c.retryStatus = retryStatusCodes(defaults.RetryStatusCodes...)
+		c.statsWindow = defaults.StatsWindow
+		// NOTE: RetryableTransport のデフォルトの値が変わっても動作が変わらないように、バージョンの値を明示的に指定する
+		WithTransportOptions(
+			retryabletransport.WithNoRetrySignals(defaults.NoRetrySignals),
+			retryabletransport.WithMaxDrainBytes(defaults.MaxDrainBytes),
+			retryabletransport.WithMaxBodyBuffer(defaults.MaxBodyBuffer),
+		)(c)
+	}
+}
+
+// defaultBackoff は、WithBackoff を指定しない場合に version のデフォルトの値で待機時間を算出する BackoffFunc を返却する
+func defaultBackoff(version DefaultsVersion, random *lockedRand) retryabletransport.BackoffFunc {
+	backoff := defaultsVersions[version].defaults.Backoff
+	if backoff.Jitter == JitterFull {
+		// NOTE: DefaultsV1 の待機時間を変えないように、ミリ秒単位で算出する
+		return exponentialBackoffAndFullJitter(int(backoff.Base.Milliseconds()), int(backoff.Cap.Milliseconds()), random)
+	}
+	return func(attempts int) time.Duration {
+		return jitteredBackoff(backoff.Base, backoff.Cap, backoff.Jitter, random, attempts)
+	}
+}
+
+// DefaultsVersion は、Client がオプションで指定しなかった設定に使用したデフォルトの値のバージョンを返却する
+func (c *Client) DefaultsVersion() DefaultsVersion {
+	return c.defaultsVersion
+}
@@ -0,0 +1,108 @@
+package retryhttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWithDefaults(t *testing.T) {
+	client := NewClient(WithDefaults(DefaultsV1))
+	if got := client.DefaultsVersion(); got != DefaultsV1 {
+		t.Errorf("DefaultsVersion() = %v, want %v", got, DefaultsV1)
+	}
+	if got := NewClient().DefaultsVersion(); got != DefaultsV1 {
+		t.Errorf("DefaultsVersion() without WithDefaults = %v, want %v", got, DefaultsV1)
+	}
+}
+
+// TestWithDefaultsUnknownVersion は、未知のバージョンでパニックせずに、送信しないエラーとして返却することを検証する
+func TestWithDefaultsUnknownVersion(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+
+	for _, version := range []DefaultsVersion{0, LatestDefaults + 1, -1} {
+		t.Run(version.String(), func(t *testing.T) {
+			want := fmt.Sprintf("unknown defaults version: %d", int(version))
+
+			client := NewClient(WithDefaults(version), WithMaxAttempts(3))
+			if err := client.Err(); err == nil || err.Error() != want {
+				t.Errorf("Err() = %v, want %q", err, want)
+			}
+			if _, err := client.Get(context.Background(), server.URL); err == nil || err.Error() != want {
+				t.Errorf("Get err = %v, want %q", err, want)
+			}
+			if res, err := client.StandardClient().Get(server.URL); err == nil || !strings.Contains(err.Error(), want) {
+				if err == nil {
+					res.Body.Close()
+				}
+				t.Errorf("StandardClient().Get err = %v, want %q", err, want)
+			}
+
+			if _, err := NewClientWithTimeouts(DefaultTimeoutConfig(), WithDefaults(version)); err == nil || err.Error() != want {
+				t.Errorf("NewClientWithTimeouts err = %v, want %q", err, want)
+			}
+			if _, err := NewClientFromConfig(DefaultConfig(), WithDefaults(version)); err == nil || err.Error() != want {
+				t.Errorf("NewClientFromConfig err = %v, want %q", err, want)
+			}
+		})
+	}
+	if got := requests.Load(); got != 0 {
+		t.Errorf("server received %d requests, want 0", got)
+	}
+	if err := NewClient(WithDefaults(DefaultsV1)).Err(); err != nil {
+		t.Errorf("Err() with DefaultsV1 = %v, want nil", err)
+	}
+}
+
+func TestDefaultsVersionText(t *testing.T) {
+	for _, text := range []string{"v1", "V1", "1"} {
+		var v DefaultsVersion
+		if err := v.UnmarshalText([]byte(text)); err != nil || v != DefaultsV1 {
+			t.Errorf("UnmarshalText(%q) = %v, %v, want %v", text, v, err, DefaultsV1)
+		}
+	}
+	for _, text := range []string{"", "v0", "v2", "latest"} {
+		var v DefaultsVersion
+		if err := v.UnmarshalText([]byte(text)); err == nil {
+			t.Errorf("UnmarshalText(%q) = %v, want an error", text, v)
+		}
+	}
+
+	b, err := json.Marshal(struct {
+		Version DefaultsVersion `json:"version"`
+	}{DefaultsV1})
+	if err != nil || string(b) != `{"version":"v1"}` {
+		t.Errorf("Marshal = %s, %v", b, err)
+	}
+	if _, err := DefaultsVersion(2).MarshalText(); err == nil {
+		t.Error("MarshalText(2) succeeded, want an error")
+	}
+}
+
+func TestDefaultsFor(t *testing.T) {
+	defaults, err := DefaultsFor(DefaultsV1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if defaults.Version != DefaultsV1 || defaults.MaxAttempts != 4 {
+		t.Errorf("DefaultsFor(DefaultsV1) = %+v", defaults)
+	}
+	// NOTE: 返却した値を変更しても、以降の DefaultsFor と WithDefaults に影響しない
+	defaults.RetryStatusCodes[0] = 0
+	if again, _ := DefaultsFor(DefaultsV1); again.RetryStatusCodes[0] == 0 {
+		t.Error("modifying the returned RetryStatusCodes changed the defaults")
+	}
+
+	if _, err := DefaultsFor(0); err == nil {
+		t.Error("DefaultsFor(0) succeeded, want an error")
+	}
+}
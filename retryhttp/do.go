@@ -0,0 +1,113 @@
+package retryhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// StatusError は、レスポンスのステータスコードが 2xx 以外だった場合のエラー
+type StatusError struct {
+	StatusCode int
+	Status     string
+	// Problem はレスポンスが application/problem+json の場合の問題の詳細。それ以外の場合は nil
+	Problem *ProblemDetails
+	// Err はリトライが必要な結果のまま終了した場合の *retryabletransport.RetryExhaustedError、
+	// またはレスポンスにベンダー固有のエラーコードが含まれていた場合の *retryabletransport.VendorError。それ以外の場合は nil
+	Err error
+}
+
+func (e *StatusError) Error() string {
+	if e.Problem != nil && e.Problem.Detail != "" {
+		return fmt.Sprintf("unexpected status: %s: %s", e.Status, e.Problem.Detail)
+	}
+	if e.Problem != nil && e.Problem.Title != "" {
+		return fmt.Sprintf("unexpected status: %s: %s", e.Status, e.Problem.Title)
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("unexpected status: %s: %v", e.Status, e.Err)
+	}
+	return fmt.Sprintf("unexpected status: %s", e.Status)
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// newStatusError はレスポンスから StatusError を作成する。問題の詳細が含まれる場合はデコードして格納する
+func newStatusError(res *http.Response) *StatusError {
+	statusErr := &StatusError{StatusCode: res.StatusCode, Status: res.Status, Problem: parseProblem(res)}
+	if m := retryabletransport.MetadataFromResponse(res); m != nil {
+		if vendorErr := m.VendorError(); vendorErr != nil {
+			statusErr.Err = vendorErr
+		}
+		// リトライが必要な結果のまま終了した場合は、試行ごとの結果を参照できるようにする
+		if exhaustedErr := m.ExhaustedError(); exhaustedErr != nil {
+			statusErr.Err = exhaustedErr
+		}
+	}
+	return statusErr
+}
+
+// DoAndClose はリクエストを送信し、fn でレスポンスを処理した後にレスポンスボディを読み切ってクローズする
+// NOTE: fn がエラーを返却した場合やパニックした場合でも、レスポンスボディは必ずクローズされる
+func (c *Client) DoAndClose(req *http.Request, fn func(*http.Response) error) (err error) {
+	res, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := closeBody(res)
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	return fn(res)
+}
+
+// DoDecode はリクエストを送信し、レスポンスボディを JSON として v にデコードする
+// ステータスコードが 2xx 以外の場合はデコードせず *StatusError を返却する
+// レスポンスが application/problem+json の場合は、問題の詳細を StatusError.Problem に格納する
+// 返却する *http.Response のボディはクローズ済みのため、ステータスやヘッダーの参照のみに使用する
+func (c *Client) DoDecode(req *http.Request, v any) (*http.Response, error) {
+	var decoded *http.Response
+	err := c.DoAndClose(req, func(res *http.Response) error {
+		decoded = res
+		// リトライ時に処理済みとみなしたレスポンスは、成功としてデコードせずに返却する
+		if m := retryabletransport.MetadataFromResponse(res); m != nil && m.AlreadyDone() {
+			return nil
+		}
+		if res.StatusCode < 200 || res.StatusCode >= 300 {
+			return newStatusError(res)
+		}
+		if v == nil {
+			return nil
+		}
+		err := json.NewDecoder(res.Body).Decode(v)
+		// ボディが空の場合 (204 No Content など) はエラーにしない
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return err
+	})
+	return decoded, err
+}
+
+// closeBody はレスポンスボディを読み切ってクローズする
+// NOTE: コネクションを再利用するには、レスポンスボディを読み切ってクローズする必要がある
+func closeBody(res *http.Response) error {
+	if res.Body == nil {
+		return nil
+	}
+	_, copyErr := io.Copy(io.Discard, res.Body)
+	closeErr := res.Body.Close()
+	if copyErr != nil {
+		return copyErr
+	}
+	return closeErr
+}
@@ -0,0 +1,205 @@
+package retryhttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// defaultAsyncWorkers と defaultAsyncQueueSize は、WithAsyncWorkers を指定しない場合の DoAsync のワーカー数とキューの長さ
+const (
+	defaultAsyncWorkers   = 4
+	defaultAsyncQueueSize = 100
+)
+
+// ErrAsyncQueueFull は、DoAsync のキューが上限に達しているため、リクエストを受け付けなかったことを表すエラー
+var ErrAsyncQueueFull = errors.New("async queue is full")
+
+// AsyncResult は DoAsync で送信したリクエストの最終的な結果
+type AsyncResult struct {
+	// Request は DoAsync に渡したリクエスト
+	Request *http.Request
+	// Response はレスポンス。ボディは読み込み済みでクローズされているため、ステータスやヘッダーの参照のみに使用する
+	Response *http.Response
+	// Body はレスポンスボディ
+	Body []byte
+	// Err は送信エラー、またはステータスコードが 2xx 以外の場合の *StatusError
+	// Client の Close または Shutdown で送信前に停止した場合は ErrClientClosed
+	Err error
+}
+
+// asyncConfig は DoAsync の設定
+type asyncConfig struct {
+	callback func(AsyncResult)
+	policy   *retryabletransport.RetryPolicy
+	timeout  time.Duration
+}
+
+// AsyncOption は DoAsync の設定を変更する関数の型定義
+type AsyncOption func(*asyncConfig)
+
+// WithAsyncCallback は、DoAsync の最終的な結果を受け取る関数を設定する。fn はワーカーのゴルーチンで呼び出される
+// NOTE: fn の実行中は、そのワーカーは次のリクエストを送信しないため、時間のかかる処理は別のゴルーチンで行う
+func WithAsyncCallback(fn func(AsyncResult)) AsyncOption {
+	return func(c *asyncConfig) {
+		c.callback = fn
+	}
+}
+
+// WithAsyncRetryPolicy は DoAsync のリクエストに適用するリトライポリシーを設定する。設定しない場合は Client の設定を使用する
+// 例: WithAsyncRetryPolicy(retryabletransport.RetryPolicy{MaxAttempts: 10})
+func WithAsyncRetryPolicy(policy retryabletransport.RetryPolicy) AsyncOption {
+	return func(c *asyncConfig) {
+		c.policy = &policy
+	}
+}
+
+// WithAsyncTimeout は、DoAsync のリトライとバックオフを含むリクエスト全体のタイムアウトを設定する
+// 設定しない場合は Client の WithTimeout の値を使用する。0 の場合はタイムアウトを設定しない
+func WithAsyncTimeout(timeout time.Duration) AsyncOption {
+	return func(c *asyncConfig) {
+		c.timeout = timeout
+	}
+}
+
+// asyncJob は DoAsync のキューに格納するリクエスト
+// NOTE: With で派生した Client はワーカーを共有するため、リクエストを追加した Client の設定で送信する
+type asyncJob struct {
+	client *Client
+	req    *http.Request
+	config asyncConfig
+	done   chan AsyncResult
+}
+
+// asyncQueue は DoAsync のリクエストを送信するワーカーとキュー
+type asyncQueue struct {
+	workers int
+	jobs    chan asyncJob
+	once    sync.Once
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// newAsyncQueue は asyncQueue 構造体を作成する
+func newAsyncQueue(workers int, queueSize int) *asyncQueue {
+	if workers <= 0 {
+		workers = defaultAsyncWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = defaultAsyncQueueSize
+	}
+	return &asyncQueue{workers: workers, jobs: make(chan asyncJob, queueSize)}
+}
+
+// enqueue はリクエストをキューに追加する
+func (q *asyncQueue) enqueue(job asyncJob) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrClientClosed
+	}
+	select {
+	case q.jobs <- job:
+		return nil
+	default:
+		return ErrAsyncQueueFull
+	}
+}
+
+// close はキューへの追加を停止し、送信していないリクエストに ErrClientClosed を通知する
+func (q *asyncQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+
+	for {
+		select {
+		case job := <-q.jobs:
+			job.report(AsyncResult{Request: job.req, Err: ErrClientClosed})
+		default:
+			return
+		}
+	}
+}
+
+// report は結果をチャネルと WithAsyncCallback の関数に通知する
+func (job asyncJob) report(result AsyncResult) {
+	job.done <- result
+	if job.config.callback != nil {
+		job.config.callback(result)
+	}
+}
+
+// DoAsync は、リクエストをキューに追加し、Client が所有するワーカーでバックグラウンドで送信する
+// 最終的な結果は、返却するチャネルと WithAsyncCallback の関数に 1 回だけ通知する
+// キューが上限に達している場合は ErrAsyncQueueFull を、Close または Shutdown の後は ErrClientClosed を返却する
+// NOTE: Webhook の配信や分析イベントの送信など、呼び出し元がバックオフの待機を含めて完了を待つ必要がないリクエストに使用する
+// 呼び出し元の context.Context のキャンセルは引き継がないため、リクエストを受け付けた後は Client の Close または Shutdown で停止する
+// ワーカー数とキューの長さは WithAsyncWorkers で設定する
+func (c *Client) DoAsync(req *http.Request, opts ...AsyncOption) (<-chan AsyncResult, error) {
+	config := asyncConfig{timeout: c.client.Timeout}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	c.async.once.Do(func() {
+		for i := 0; i < c.async.workers; i++ {
+			if err := c.runtime.Go(c.async.worker); err != nil {
+				c.async.close()
+				return
+			}
+		}
+	})
+	c.runtime.Start()
+
+	done := make(chan AsyncResult, 1)
+	if err := c.async.enqueue(asyncJob{client: c, req: req, config: config, done: done}); err != nil {
+		return nil, err
+	}
+	return done, nil
+}
+
+// worker は、ctx が終了するまで DoAsync のキューのリクエストを送信する
+func (q *asyncQueue) worker(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			q.close()
+			return nil
+		case job := <-q.jobs:
+			job.report(job.client.sendAsync(ctx, job))
+		}
+	}
+}
+
+// sendAsync は DoAsync のリクエストを送信し、レスポンスボディを読み込む
+// NOTE: 呼び出し元の context.Context を引き継がずに、Client の Close または Shutdown で終了する context.Context で送信する
+func (c *Client) sendAsync(ctx context.Context, job asyncJob) AsyncResult {
+	reqCtx, cancel := context.WithCancel(context.WithoutCancel(job.req.Context()))
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	if job.config.timeout > 0 {
+		reqCtx, cancel = context.WithTimeout(reqCtx, job.config.timeout)
+		defer cancel()
+	}
+	if job.config.policy != nil {
+		reqCtx = retryabletransport.WithRetryPolicy(reqCtx, *job.config.policy)
+	}
+
+	// NOTE: WithAsyncTimeout で Client のタイムアウトより長く送信できるように、タイムアウトを設定しない *http.Client を使用する
+	client := *c.client
+	client.Timeout = 0
+	derived := *c
+	derived.client = &client
+
+	result := derived.fetch(job.req.WithContext(reqCtx))
+	return AsyncResult{Request: job.req, Response: result.Response, Body: result.Body, Err: result.Err}
+}
@@ -0,0 +1,8 @@
+// Package retryhttp はリトライ機能を持つ HTTP クライアント
+//
+// go get github.com/mtnori/httpRetryExample/retryhttp で取得する
+//
+// NewClient と Option でリトライ回数、タイムアウト、バックオフ (NewBackoff)、リトライの判定 (WithCheckRetry) を設定する
+// リトライ処理そのものは transport パッケージの RetryableTransport で、*http.Client 以外と組み合わせる場合は直接使用する
+// 例: cmd/main.go
+package retryhttp
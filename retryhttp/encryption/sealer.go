@@ -0,0 +1,123 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// formatVersion は暗号化したデータのフォーマットのバージョン
+const formatVersion byte = 1
+
+// ErrInvalidCiphertext は、復号するデータのフォーマットが不正であることを表すエラー
+var ErrInvalidCiphertext = errors.New("invalid ciphertext")
+
+// KeyProvider は暗号化に使用する鍵を提供するインターフェース
+// 鍵のローテーションに対応するため、暗号化したデータには鍵 ID を記録し、復号時は鍵 ID から鍵を取得する
+type KeyProvider interface {
+	// CurrentKey は暗号化に使用する鍵と鍵 ID を返却する。鍵は 16, 24, 32 バイトのいずれか (AES-128, 192, 256)
+	CurrentKey() (id string, key []byte, err error)
+	// Key は鍵 ID に対応する鍵を返却する
+	Key(id string) ([]byte, error)
+}
+
+// StaticKeyProvider は固定の鍵を提供する KeyProvider
+type StaticKeyProvider struct {
+	ID    string
+	Value []byte
+}
+
+// CurrentKey は固定の鍵を返却する
+func (p StaticKeyProvider) CurrentKey() (string, []byte, error) {
+	return p.ID, p.Value, nil
+}
+
+// Key は鍵 ID が一致する場合に固定の鍵を返却する
+func (p StaticKeyProvider) Key(id string) ([]byte, error) {
+	if id != p.ID {
+		return nil, fmt.Errorf("unknown key id %q", id)
+	}
+	return p.Value, nil
+}
+
+// Sealer は AES-GCM でデータを暗号化・復号する
+// NOTE: ディスクに保存するリトライキュー、VCR カセット、レスポンスキャッシュなどで、
+// シークレットを含むリクエストボディを平文で保存しないために使用する
+type Sealer struct {
+	keys KeyProvider
+}
+
+// NewSealer は Sealer 構造体を作成する
+func NewSealer(keys KeyProvider) *Sealer {
+	return &Sealer{keys: keys}
+}
+
+// Seal はデータを暗号化する
+// フォーマット: バージョン (1 バイト) | 鍵 ID の長さ (1 バイト) | 鍵 ID | nonce | 暗号文
+// associatedData は暗号化しないが改ざんを検知する追加データ (保存先のキーなど)
+func (s *Sealer) Seal(plaintext []byte, associatedData []byte) ([]byte, error) {
+	id, key, err := s.keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(id) > 255 {
+		return nil, fmt.Errorf("key id %q is too long", id)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, 2+len(id)+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	out = append(out, formatVersion, byte(len(id)))
+	out = append(out, id...)
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, plaintext, associatedData), nil
+}
+
+// Open は Seal で暗号化したデータを復号する
+func (s *Sealer) Open(ciphertext []byte, associatedData []byte) ([]byte, error) {
+	if len(ciphertext) < 2 || ciphertext[0] != formatVersion {
+		return nil, ErrInvalidCiphertext
+	}
+	idLen := int(ciphertext[1])
+	if len(ciphertext) < 2+idLen {
+		return nil, ErrInvalidCiphertext
+	}
+	id := string(ciphertext[2 : 2+idLen])
+	rest := ciphertext[2+idLen:]
+
+	key, err := s.keys.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < aead.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+
+	plaintext, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], associatedData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCiphertext, err)
+	}
+	return plaintext, nil
+}
+
+// newAEAD は AES-GCM の cipher.AEAD を作成する
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
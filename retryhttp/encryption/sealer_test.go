@@ -0,0 +1,127 @@
+package encryption
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// rotatingKeyProvider は current の鍵で暗号化し、keys のすべての鍵で復号する KeyProvider
+type rotatingKeyProvider struct {
+	current string
+	keys    map[string][]byte
+}
+
+func (p rotatingKeyProvider) CurrentKey() (string, []byte, error) {
+	return p.current, p.keys[p.current], nil
+}
+
+func (p rotatingKeyProvider) Key(id string) ([]byte, error) {
+	key, ok := p.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", id)
+	}
+	return key, nil
+}
+
+var (
+	testKey1 = bytes.Repeat([]byte{1}, 32)
+	testKey2 = bytes.Repeat([]byte{2}, 16)
+)
+
+func TestSealerRoundTrip(t *testing.T) {
+	s := NewSealer(StaticKeyProvider{ID: "k1", Value: testKey1})
+	plaintext := []byte("Authorization: Bearer secret")
+
+	sealed, err := s.Seal(plaintext, []byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("secret")) {
+		t.Error("sealed data contains the plaintext")
+	}
+	opened, err := s.Open(sealed, []byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("Open = %q, want %q", opened, plaintext)
+	}
+
+	// nonce は暗号化のたびに異なる
+	again, _ := s.Seal(plaintext, []byte("key"))
+	if bytes.Equal(sealed, again) {
+		t.Error("sealing the same plaintext twice returned the same ciphertext")
+	}
+}
+
+// TestSealerKeyRotation は、鍵をローテーションした後も、古い鍵で暗号化したデータを復号できることを検証する
+func TestSealerKeyRotation(t *testing.T) {
+	keys := map[string][]byte{"k1": testKey1, "k2": testKey2}
+	old, _ := NewSealer(rotatingKeyProvider{current: "k1", keys: keys}).Seal([]byte("old"), nil)
+
+	rotated := NewSealer(rotatingKeyProvider{current: "k2", keys: keys})
+	sealed, _ := rotated.Seal([]byte("new"), nil)
+	for _, tt := range []struct {
+		sealed []byte
+		want   string
+	}{{old, "old"}, {sealed, "new"}} {
+		opened, err := rotated.Open(tt.sealed, nil)
+		if err != nil || string(opened) != tt.want {
+			t.Errorf("Open = %q, %v, want %q", opened, err, tt.want)
+		}
+	}
+
+	delete(keys, "k1")
+	if _, err := rotated.Open(old, nil); err == nil || !strings.Contains(err.Error(), `unknown key id "k1"`) {
+		t.Errorf("Open with a retired key = %v, want an unknown key id error", err)
+	}
+}
+
+func TestSealerOpenInvalid(t *testing.T) {
+	s := NewSealer(StaticKeyProvider{ID: "k1", Value: testKey1})
+	sealed, err := s.Seal([]byte("data"), []byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+	wrongVersion := bytes.Clone(sealed)
+	wrongVersion[0] = formatVersion + 1
+
+	tests := []struct {
+		name           string
+		data           []byte
+		associatedData string
+	}{
+		{"empty", nil, "key"},
+		{"unknown version", wrongVersion, "key"},
+		{"truncated key id", sealed[:3], "key"},
+		{"truncated nonce", sealed[:2+len("k1")+4], "key"},
+		{"tampered", tampered, "key"},
+		// 別のキーに保存したデータへの差し替えは、追加データで検知する
+		{"different associated data", sealed, "other"},
+	}
+	for _, tt := range tests {
+		if _, err := s.Open(tt.data, []byte(tt.associatedData)); !errors.Is(err, ErrInvalidCiphertext) {
+			t.Errorf("%s: Open = %v, want ErrInvalidCiphertext", tt.name, err)
+		}
+	}
+}
+
+func TestSealerInvalidKey(t *testing.T) {
+	tests := []struct {
+		name string
+		keys StaticKeyProvider
+	}{
+		{"key length", StaticKeyProvider{ID: "k1", Value: []byte("short")}},
+		{"key id length", StaticKeyProvider{ID: strings.Repeat("k", 256), Value: testKey1}},
+	}
+	for _, tt := range tests {
+		if _, err := NewSealer(tt.keys).Seal([]byte("data"), nil); err == nil {
+			t.Errorf("%s: Seal succeeded, want an error", tt.name)
+		}
+	}
+}
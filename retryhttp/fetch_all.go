@@ -0,0 +1,131 @@
+package retryhttp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// FetchMode は FetchAll でエラーが発生した場合の扱い
+type FetchMode int
+
+const (
+	// FetchFirstError は最初のエラーで残りのリクエストをキャンセルし、そのエラーを返却する
+	FetchFirstError FetchMode = iota
+	// FetchCollectAll はエラーが発生してもすべてのリクエストを送信し、各結果にエラーを格納する
+	FetchCollectAll
+)
+
+// FetchResult は FetchAll の 1 件のリクエストの結果
+type FetchResult struct {
+	// Response はレスポンス。ボディは読み込み済みでクローズされているため、ステータスやヘッダーの参照のみに使用する
+	Response *http.Response
+	// Body はレスポンスボディ
+	Body []byte
+	// Err は送信エラー、またはステータスコードが 2xx 以外の場合の *StatusError
+	Err error
+}
+
+// fetchConfig は FetchAll の設定
+type fetchConfig struct {
+	parallelism int
+	mode        FetchMode
+	policy      *retryabletransport.RetryPolicy
+}
+
+// FetchOption は FetchAll の設定を変更する関数の型定義
+type FetchOption func(*fetchConfig)
+
+// WithParallelism は同時に送信するリクエスト数の上限を設定する。デフォルトは 4
+func WithParallelism(n int) FetchOption {
+	return func(c *fetchConfig) {
+		c.parallelism = max(n, 1)
+	}
+}
+
+// WithFetchMode はエラーが発生した場合の扱いを設定する。デフォルトは FetchFirstError
+func WithFetchMode(mode FetchMode) FetchOption {
+	return func(c *fetchConfig) {
+		c.mode = mode
+	}
+}
+
+// WithFetchRetryPolicy は各リクエストに適用するリトライポリシーを設定する。設定しない場合は Client の設定を使用する
+func WithFetchRetryPolicy(policy retryabletransport.RetryPolicy) FetchOption {
+	return func(c *fetchConfig) {
+		c.policy = &policy
+	}
+}
+
+// FetchAll は複数のリクエストを並行して送信し、リクエストと同じ順序で結果を返却する
+// 各リクエストは Client の設定に従ってリトライされ、レスポンスボディは読み込んでクローズする
+// FetchFirstError の場合は最初のエラーを返却し、FetchCollectAll の場合はすべてのエラーを errors.Join でまとめて返却する
+// NOTE: 各リクエストの context.Context は ctx から派生した context.Context に置き換えられる
+func (c *Client) FetchAll(ctx context.Context, reqs []*http.Request, opts ...FetchOption) ([]FetchResult, error) {
+	config := fetchConfig{parallelism: 4}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	results := make([]FetchResult, len(reqs))
+	g, gctx := errgroup.WithContext(ctx)
+	// NOTE: FetchCollectAll の場合は、1 件のエラーで残りのリクエストをキャンセルしないように errgroup の context.Context を使用しない
+	if config.mode == FetchCollectAll {
+		g, gctx = &errgroup.Group{}, ctx
+	}
+	g.SetLimit(config.parallelism)
+
+	for i, req := range reqs {
+		i, req := i, req
+		g.Go(func() error {
+			reqCtx := gctx
+			if config.policy != nil {
+				reqCtx = retryabletransport.WithRetryPolicy(reqCtx, *config.policy)
+			}
+			results[i] = c.fetch(req.WithContext(reqCtx))
+			if results[i].Err != nil && config.mode == FetchFirstError {
+				return fmt.Errorf("fetch %s %s: %w", req.Method, req.URL, results[i].Err)
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return results, err
+	}
+
+	var errs []error
+	for i, r := range results {
+		if r.Err != nil {
+			errs = append(errs, fmt.Errorf("fetch %s %s: %w", reqs[i].Method, reqs[i].URL, r.Err))
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// fetch はリクエストを送信し、レスポンスボディを読み込む
+func (c *Client) fetch(req *http.Request) FetchResult {
+	var result FetchResult
+	result.Err = c.DoAndClose(req, func(res *http.Response) error {
+		result.Response = res
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			return err
+		}
+		result.Body = body
+		if res.StatusCode < 200 || res.StatusCode >= 300 {
+			// NOTE: 元のレスポンスボディは DoAndClose でクローズするため、読み込んだボディを設定したコピーを使用する
+			errRes := *res
+			errRes.Body = io.NopCloser(bytes.NewReader(body))
+			return newStatusError(&errRes)
+		}
+		return nil
+	})
+	return result
+}
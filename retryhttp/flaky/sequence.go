@@ -0,0 +1,78 @@
+package flaky
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Step は SequenceServer が 1 回のリクエストに返却するレスポンス
+type Step struct {
+	// Status はステータスコード
+	Status int `yaml:"status" json:"status"`
+	// Latency はレスポンスを返却するまでの遅延
+	Latency time.Duration `yaml:"latency" json:"latency"`
+	// RetryAfter は Retry-After ヘッダーの値 (秒数または HTTP-date)。空文字の場合は付与しない
+	RetryAfter string `yaml:"retry_after" json:"retry_after"`
+	// Body はレスポンスボディ。空文字の場合はステータスコードとその説明を返却する
+	Body string `yaml:"body" json:"body"`
+}
+
+// SequenceServer は、定義した Step をリクエストごとに順に返却する http.Handler 具象型
+// すべての Step を返却した後は、最後の Step を繰り返し返却する
+// NOTE: FlakyServer は割合でステータスコードを選択するため、結果を検証するテストでは決まった順序で返却する SequenceServer を使用する
+type SequenceServer struct {
+	steps []Step
+
+	mu       sync.Mutex
+	requests int
+}
+
+// NewSequenceServer は SequenceServer 構造体を作成する
+func NewSequenceServer(steps ...Step) *SequenceServer {
+	return &SequenceServer{steps: steps}
+}
+
+// Requests は受け付けたリクエスト数を返却する
+func (s *SequenceServer) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+// ServeHTTP は次の Step のレスポンスを返却する
+// NOTE: このメソッドを実装することで、SequenceServer は http.Handler インターフェースを満たす
+func (s *SequenceServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, _ = io.Copy(io.Discard, r.Body)
+
+	s.mu.Lock()
+	s.requests++
+	step := Step{Status: http.StatusOK}
+	if len(s.steps) > 0 {
+		step = s.steps[min(s.requests, len(s.steps))-1]
+	}
+	s.mu.Unlock()
+
+	if step.Latency > 0 {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(step.Latency):
+		}
+	}
+
+	if step.RetryAfter != "" {
+		w.Header().Set("Retry-After", step.RetryAfter)
+	}
+	body := step.Body
+	if body == "" {
+		body = strconv.Itoa(step.Status) + " " + http.StatusText(step.Status) + "\n"
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(step.Status)
+	_, _ = fmt.Fprint(w, body)
+}
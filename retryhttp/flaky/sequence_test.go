@@ -0,0 +1,74 @@
+package flaky
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+func TestSequenceServer(t *testing.T) {
+	server := NewSequenceServer(
+		Step{Status: http.StatusServiceUnavailable, RetryAfter: "1"},
+		Step{Status: http.StatusOK, Body: "done"},
+	)
+
+	want := []struct {
+		code       int
+		retryAfter string
+		body       string
+	}{
+		{http.StatusServiceUnavailable, "1", "503 Service Unavailable\n"},
+		{http.StatusOK, "", "done"},
+		// すべての Step を返却した後は、最後の Step を繰り返す
+		{http.StatusOK, "", "done"},
+	}
+	for i, w := range want {
+		rec := serve(server, "/anything")
+		if rec.Code != w.code || rec.Header().Get("Retry-After") != w.retryAfter || rec.Body.String() != w.body {
+			t.Errorf("request %d = %d %q %q, want %d %q %q", i+1, rec.Code, rec.Header().Get("Retry-After"), rec.Body.String(), w.code, w.retryAfter, w.body)
+		}
+	}
+	if got := server.Requests(); got != len(want) {
+		t.Errorf("Requests = %d, want %d", got, len(want))
+	}
+}
+
+func TestSequenceServerWithoutSteps(t *testing.T) {
+	if rec := serve(NewSequenceServer(), "/"); rec.Code != http.StatusOK || rec.Body.String() != "200 OK\n" {
+		t.Errorf("response = %d %q, want 200 OK", rec.Code, rec.Body.String())
+	}
+}
+
+// TestSequenceServerRetry は、SequenceServer を送信先として RetryableTransport のリトライを検証できることを確認する
+func TestSequenceServerRetry(t *testing.T) {
+	server := NewSequenceServer(
+		Step{Status: http.StatusServiceUnavailable},
+		Step{Status: http.StatusBadGateway, Latency: 10 * time.Millisecond},
+		Step{Status: http.StatusOK, Body: "recovered"},
+	)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	retry5xx := func(res *http.Response, err error) bool {
+		return err != nil || res.StatusCode >= http.StatusInternalServerError
+	}
+	client := &http.Client{Transport: retryabletransport.NewRetryableTransport(ts.Client().Transport, 3, retry5xx,
+		retryabletransport.Constant(0), retryabletransport.WithoutLogging())}
+
+	res, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || string(body) != "recovered" {
+		t.Errorf("response = %d %q, want 200 recovered", res.StatusCode, body)
+	}
+	if got := server.Requests(); got != 3 {
+		t.Errorf("Requests = %d, want 3", got)
+	}
+}
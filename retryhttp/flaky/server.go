@@ -0,0 +1,139 @@
+package flaky
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config は、FlakyServer の設定。ゼロ値の場合は遅延なしで、ステータスコードのみを返却する
+type Config struct {
+	// Latency はすべてのレスポンスに加える遅延
+	Latency time.Duration
+	// Jitter は Latency に加える 0 から Jitter までの一様乱数の遅延
+	Jitter time.Duration
+	// RetryAfter は、429 と 503 のレスポンスに付与する Retry-After ヘッダーの秒数。0 の場合は付与しない
+	RetryAfter int
+	// Source は乱数の生成元。nil の場合は現在時刻をシードとする
+	// NOTE: デモやテストで同じ順序でステータスコードを返却するには、シードを固定した rand.NewSource を指定する
+	Source rand.Source
+}
+
+// FlakyServer は、指定した割合で失敗するレスポンスを返却する http.Handler 具象型
+// httpbin.org の /status と同じ形式で、/status/200:0.2,500:0.8 は 20% の確率で 200 を、80% の確率で 500 を返却する
+// 割合を省略したステータスコードは 1 とし、割合の合計に対する比率で選択する
+// NOTE: リトライのデモやローカルでの開発、テストで、外部のサービスに依存せずに不安定な送信先を再現するために使用する
+// クエリパラメーター latency (例: ?latency=250ms) を指定した場合は、Config.Latency の代わりにその遅延を加える
+type FlakyServer struct {
+	config Config
+
+	mu     sync.Mutex
+	random *rand.Rand
+}
+
+// NewFlakyServer は FlakyServer 構造体を作成する
+func NewFlakyServer(config Config) *FlakyServer {
+	source := config.Source
+	if source == nil {
+		source = rand.NewSource(time.Now().UnixNano())
+	}
+	return &FlakyServer{config: config, random: rand.New(source)}
+}
+
+// ServeHTTP は、パスで指定した割合でステータスコードを選択し、遅延を加えてから返却する
+// NOTE: このメソッドを実装することで、FlakyServer は http.Handler インターフェースを満たす
+func (s *FlakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	spec, ok := strings.CutPrefix(r.URL.Path, "/status/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	codes, err := parseCodes(spec)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	latency := s.config.Latency
+	if v := r.URL.Query().Get("latency"); v != "" {
+		if latency, err = time.ParseDuration(v); err != nil {
+			http.Error(w, fmt.Sprintf("invalid latency %q: %v", v, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// NOTE: クライアントがリクエストボディを送信し終えるまで待つために読み切る
+	_, _ = io.Copy(io.Discard, r.Body)
+
+	code, wait := s.pick(codes, latency)
+	if wait > 0 {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+
+	if s.config.RetryAfter > 0 && (code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable) {
+		w.Header().Set("Retry-After", strconv.Itoa(s.config.RetryAfter))
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(code)
+	_, _ = fmt.Fprintf(w, "%d %s\n", code, http.StatusText(code))
+}
+
+// weightedCode は、割合を指定したステータスコード
+type weightedCode struct {
+	code   int
+	weight float64
+}
+
+// parseCodes は、"200:0.2,500:0.8" の形式からステータスコードと割合を取得する
+func parseCodes(spec string) ([]weightedCode, error) {
+	var codes []weightedCode
+	for _, part := range strings.Split(spec, ",") {
+		codeText, weightText, hasWeight := strings.Cut(part, ":")
+		code, err := strconv.Atoi(codeText)
+		if err != nil || code < 100 || code > 999 {
+			return nil, fmt.Errorf("invalid status code %q", codeText)
+		}
+		weight := 1.0
+		if hasWeight {
+			if weight, err = strconv.ParseFloat(weightText, 64); err != nil || weight < 0 {
+				return nil, fmt.Errorf("invalid weight %q", weightText)
+			}
+		}
+		codes = append(codes, weightedCode{code: code, weight: weight})
+	}
+	return codes, nil
+}
+
+// pick は、割合に従ってステータスコードを選択し、加える遅延を返却する
+func (s *FlakyServer) pick(codes []weightedCode, latency time.Duration) (int, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.config.Jitter > 0 {
+		latency += time.Duration(s.random.Int63n(int64(s.config.Jitter)))
+	}
+
+	var total float64
+	for _, c := range codes {
+		total += c.weight
+	}
+	if total == 0 {
+		return codes[0].code, latency
+	}
+	r := s.random.Float64() * total
+	for _, c := range codes {
+		if r < c.weight {
+			return c.code, latency
+		}
+		r -= c.weight
+	}
+	return codes[len(codes)-1].code, latency
+}
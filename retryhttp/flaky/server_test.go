@@ -0,0 +1,98 @@
+package flaky
+
+import (
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// serve は handler で GET target を処理した結果を返却する
+func serve(handler http.Handler, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec
+}
+
+func TestFlakyServerWeights(t *testing.T) {
+	server := NewFlakyServer(Config{Source: rand.NewSource(1)})
+
+	counts := make(map[int]int)
+	for i := 0; i < 1000; i++ {
+		counts[serve(server, "/status/200:0.2,500:0.8,404:0").Code]++
+	}
+	if counts[404] != 0 {
+		t.Errorf("status with weight 0 was returned %d times", counts[404])
+	}
+	if counts[200] < 150 || counts[200] > 250 || counts[200]+counts[500] != 1000 {
+		t.Errorf("counts = %v, want about 20%% 200 and 80%% 500", counts)
+	}
+	// 割合の合計が 0 の場合は、最初のステータスコードを返却する
+	if got := serve(server, "/status/418:0,500:0").Code; got != http.StatusTeapot {
+		t.Errorf("status with zero total weight = %d, want 418", got)
+	}
+}
+
+// TestFlakyServerSource は、シードを固定した場合に同じ順序でステータスコードを返却することを検証する
+func TestFlakyServerSource(t *testing.T) {
+	a := NewFlakyServer(Config{Source: rand.NewSource(42)})
+	b := NewFlakyServer(Config{Source: rand.NewSource(42)})
+	for i := 0; i < 20; i++ {
+		if got, want := serve(a, "/status/200,503").Code, serve(b, "/status/200,503").Code; got != want {
+			t.Fatalf("request %d = %d, want %d", i+1, got, want)
+		}
+	}
+}
+
+func TestFlakyServerResponse(t *testing.T) {
+	server := NewFlakyServer(Config{RetryAfter: 2})
+
+	rec := serve(server, "/status/503")
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "2" || rec.Body.String() != "503 Service Unavailable\n" {
+		t.Errorf("response = %d %v %q", rec.Code, rec.Header(), rec.Body.String())
+	}
+	// NOTE: Retry-After は 429 と 503 のみに付与する
+	if rec := serve(server, "/status/500"); rec.Header().Get("Retry-After") != "" {
+		t.Errorf("500 has Retry-After %q", rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestFlakyServerLatency(t *testing.T) {
+	server := NewFlakyServer(Config{Latency: time.Hour})
+
+	start := time.Now()
+	if rec := serve(server, "/status/200?latency=20ms"); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond || elapsed > time.Minute {
+		t.Errorf("elapsed = %s, want the latency from the query", elapsed)
+	}
+}
+
+func TestFlakyServerInvalidRequests(t *testing.T) {
+	server := NewFlakyServer(Config{})
+	tests := map[string]int{
+		"/health":                  http.StatusNotFound,
+		"/status/abc":              http.StatusBadRequest,
+		"/status/99":               http.StatusBadRequest,
+		"/status/200:-1":           http.StatusBadRequest,
+		"/status/200?latency=fast": http.StatusBadRequest,
+	}
+	for target, want := range tests {
+		if got := serve(server, target).Code; got != want {
+			t.Errorf("GET %s = %d, want %d", target, got, want)
+		}
+	}
+}
+
+func TestParseCodes(t *testing.T) {
+	codes, err := parseCodes("200:0.5,500")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []weightedCode{{200, 0.5}, {500, 1}}
+	if len(codes) != len(want) || codes[0] != want[0] || codes[1] != want[1] {
+		t.Errorf("parseCodes = %v, want %v", codes, want)
+	}
+}
@@ -0,0 +1,61 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Codec は Record を外部のストレージに保存する形式に変換するインターフェース
+// NOTE: Protocol Buffers などの形式は、このパッケージに依存を追加せずに利用側で実装する
+type Codec interface {
+	// ContentType は変換後の形式のメディアタイプを返却する
+	ContentType() string
+	Marshal(r Record) ([]byte, error)
+	// Unmarshal は data を Record に変換する。対応していないバージョンの場合は *UnsupportedVersionError を返却する
+	Unmarshal(data []byte) (Record, error)
+}
+
+// UnsupportedVersionError は、このパッケージより新しいバージョンのスキーマの Record を読み込んだことを表すエラー
+type UnsupportedVersionError struct {
+	Version int
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("unsupported attempt history schema version %d (supported up to %d)", e.Version, SchemaVersion)
+}
+
+// JSON は Record を JSON に変換する Codec
+var JSON Codec = jsonCodec{}
+
+// jsonCodec は Codec の JSON の具象型
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return "application/vnd.httpretry.history.v1+json"
+}
+
+func (jsonCodec) Marshal(r Record) ([]byte, error) {
+	if r.Version == 0 {
+		r.Version = SchemaVersion
+	}
+	return json.Marshal(r)
+}
+
+func (jsonCodec) Unmarshal(data []byte) (Record, error) {
+	var r Record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return Record{}, err
+	}
+	if err := checkVersion(r.Version); err != nil {
+		return Record{}, err
+	}
+	return r, nil
+}
+
+// checkVersion は、読み込んだ Record のバージョンに対応しているか確認する
+func checkVersion(version int) error {
+	if version > SchemaVersion {
+		return &UnsupportedVersionError{Version: version}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testRecord はすべてのフィールドを設定した Record を作成する
+func testRecord() Record {
+	return Record{
+		Version:    SchemaVersion,
+		Method:     "POST",
+		URL:        "https://api.example.com/orders",
+		StartedAt:  time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC),
+		Outcome:    OutcomeExhausted,
+		StatusCode: 503,
+		Attempts: []Attempt{
+			{Attempt: 1, Error: "connection reset", DurationNanos: int64(time.Second), WaitNanos: int64(500 * time.Millisecond)},
+			{Attempt: 2, StatusCode: 503, DurationNanos: int64(2 * time.Second)},
+		},
+		Policy:      &PolicySnapshot{Name: "standard", MaxAttempts: 2, Labels: map[string]string{"team": "payments"}},
+		Annotations: map[string]string{"tenant": "acme"},
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	want := testRecord()
+	data, err := JSON.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := JSON.Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip = %+v, want %+v", got, want)
+	}
+	if got.Attempts[0].Duration() != time.Second || got.Attempts[0].Wait() != 500*time.Millisecond {
+		t.Errorf("attempt durations = %s, %s", got.Attempts[0].Duration(), got.Attempts[0].Wait())
+	}
+}
+
+// TestJSONSchema は、他の言語から読み込む JSON のフィールド名と型が変わらないことを検証する
+func TestJSONSchema(t *testing.T) {
+	r := testRecord()
+	r.Version = 0
+	data, err := JSON.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	// NOTE: Version を設定していない Record は、現在のバージョンで書き込む
+	if fields["version"] != float64(SchemaVersion) {
+		t.Errorf("version = %v, want %d", fields["version"], SchemaVersion)
+	}
+	for _, name := range []string{"method", "url", "started_at", "outcome", "status_code", "attempts", "policy", "annotations"} {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("field %q is missing in %s", name, data)
+		}
+	}
+	attempt := fields["attempts"].([]any)[0].(map[string]any)
+	if attempt["duration_ns"] != float64(time.Second) || attempt["wait_ns"] != float64(500*time.Millisecond) {
+		t.Errorf("attempt = %v, want durations in nanoseconds", attempt)
+	}
+}
+
+func TestJSONUnmarshalVersion(t *testing.T) {
+	// NOTE: 古いバージョンの Record は読み込める
+	if _, err := JSON.Unmarshal([]byte(`{"version":0,"method":"GET"}`)); err != nil {
+		t.Errorf("Unmarshal of an older version: %v", err)
+	}
+
+	_, err := JSON.Unmarshal([]byte(`{"version":2,"method":"GET"}`))
+	var unsupported *UnsupportedVersionError
+	if !errors.As(err, &unsupported) || unsupported.Version != 2 {
+		t.Errorf("err = %v, want *UnsupportedVersionError for version 2", err)
+	}
+
+	if _, err := JSON.Unmarshal([]byte(`{`)); err == nil {
+		t.Error("Unmarshal of invalid JSON succeeded")
+	}
+}
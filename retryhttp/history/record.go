@@ -0,0 +1,155 @@
+// Package history は、リトライの試行履歴とリトライポリシーを外部に保存するための、バージョン付きのスキーマを提供する
+// NOTE: デッドレターの処理、監査ログ、永続化したキューなどが同じ形式で試行履歴を読み書きできるように、
+// transport パッケージの型ではなく、互換性を保って変更するスキーマとして定義する
+package history
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// SchemaVersion は Record のスキーマのバージョン
+// NOTE: フィールドの追加は同じバージョンで行い、既存のフィールドの意味や型を変更する場合にバージョンを上げる
+const SchemaVersion = 1
+
+// Outcome はリクエスト全体の結果
+type Outcome string
+
+const (
+	// OutcomeCompleted は、リトライが不要なレスポンスを受け取って終了したことを表す。4xx などのレスポンスも含む
+	OutcomeCompleted Outcome = "completed"
+	// OutcomeExhausted はリトライが必要な結果のまま、試行回数などの上限に達したことを表す
+	OutcomeExhausted Outcome = "exhausted"
+	// OutcomeFailed はリトライできないエラーで終了したことを表す
+	OutcomeFailed Outcome = "failed"
+)
+
+// Record は 1 回のリクエストの試行履歴
+type Record struct {
+	// Version は Record のスキーマのバージョン。SchemaVersion を設定する
+	Version int    `json:"version"`
+	Method  string `json:"method"`
+	URL     string `json:"url"`
+	// StartedAt は最初の試行を開始した時刻
+	StartedAt time.Time `json:"started_at"`
+	Outcome   Outcome   `json:"outcome"`
+	// StatusCode は最後の試行のステータスコード。レスポンスがない場合は 0
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// Attempts は試行ごとの結果を試行した順に格納する
+	Attempts []Attempt `json:"attempts"`
+	// Policy はリクエストに適用したリトライポリシー。記録していない場合は nil
+	Policy *PolicySnapshot `json:"policy,omitempty"`
+	// Annotations は transport.Annotate でリクエストに付与したアノテーション (テナント、機能名など)
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Attempt は 1 回の試行の結果
+// NOTE: 他の言語からも読み込めるように、時間はナノ秒の整数で表す
+type Attempt struct {
+	// Attempt は試行番号 (1 から開始)
+	Attempt    int    `json:"attempt"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// DurationNanos は試行の所要時間
+	DurationNanos int64 `json:"duration_ns"`
+	// WaitNanos は試行の後のバックオフの待機時間。リトライしなかった場合は 0
+	WaitNanos int64 `json:"wait_ns,omitempty"`
+}
+
+// Duration は試行の所要時間を返却する
+func (a Attempt) Duration() time.Duration {
+	return time.Duration(a.DurationNanos)
+}
+
+// Wait は試行の後のバックオフの待機時間を返却する
+func (a Attempt) Wait() time.Duration {
+	return time.Duration(a.WaitNanos)
+}
+
+// PolicySnapshot はリクエストに適用したリトライポリシーの設定値
+// NOTE: 判定の関数やバックオフの関数は保存できないため、名前と設定値のみを記録する
+type PolicySnapshot struct {
+	// Name はポリシーを識別する名前 (例: "standard")
+	Name string `json:"name,omitempty"`
+	// MaxAttempts は最初の試行を含む最大試行回数
+	MaxAttempts int `json:"max_attempts,omitempty"`
+	// Labels は利用側で付与する任意の属性
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Snapshot は transport.RetryPolicy の設定値を name の PolicySnapshot として返却する
+func Snapshot(name string, policy transport.RetryPolicy) *PolicySnapshot {
+	return &PolicySnapshot{Name: name, MaxAttempts: policy.MaxAttempts}
+}
+
+// FromAttempts は、transport.AttemptResult の試行履歴から Record を作成する
+func FromAttempts(req *http.Request, startedAt time.Time, outcome Outcome, attempts []transport.AttemptResult) Record {
+	r := Record{
+		Version:   SchemaVersion,
+		StartedAt: startedAt,
+		Outcome:   outcome,
+		Attempts:  make([]Attempt, 0, len(attempts)),
+	}
+	if req != nil {
+		r.Method = req.Method
+		r.URL = req.URL.Redacted()
+		if annotations := transport.AnnotationsFromContext(req.Context()); len(annotations) > 0 {
+			r.Annotations = make(map[string]string, len(annotations))
+			for k, v := range annotations {
+				r.Annotations[k] = v
+			}
+		}
+	}
+	for _, a := range attempts {
+		attempt := Attempt{
+			Attempt:       a.Attempt,
+			StatusCode:    a.StatusCode,
+			DurationNanos: int64(a.Duration),
+			WaitNanos:     int64(a.Wait),
+		}
+		if a.Err != nil {
+			attempt.Error = a.Err.Error()
+		}
+		r.Attempts = append(r.Attempts, attempt)
+	}
+	if len(r.Attempts) > 0 {
+		last := r.Attempts[len(r.Attempts)-1]
+		r.StatusCode, r.Error = last.StatusCode, last.Error
+	}
+	return r
+}
+
+// FromResult は、RetryableTransport を経由したリクエストの結果から Record を作成する
+// res と err は http.Client.Do などの戻り値を渡す。試行履歴はレスポンスのメタデータか *transport.RetryExhaustedError から取得する
+func FromResult(req *http.Request, startedAt time.Time, res *http.Response, err error) Record {
+	var attempts []transport.AttemptResult
+	outcome := OutcomeCompleted
+	if m := transport.MetadataFromResponse(res); m != nil {
+		attempts = m.Attempts()
+		if m.Exhausted() {
+			outcome = OutcomeExhausted
+		}
+	}
+	var exhausted *transport.RetryExhaustedError
+	switch {
+	case errors.As(err, &exhausted):
+		outcome = OutcomeExhausted
+		if attempts == nil {
+			attempts = exhausted.Attempts
+		}
+	case err != nil:
+		outcome = OutcomeFailed
+	}
+	r := FromAttempts(req, startedAt, outcome, attempts)
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if res != nil {
+		r.StatusCode = res.StatusCode
+	}
+	return r
+}
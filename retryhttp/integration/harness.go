@@ -0,0 +1,257 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mtnori/httpRetryExample/retryhttp"
+	"github.com/mtnori/httpRetryExample/retryhttp/flaky"
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario は、FlakyServer に対するクライアントの一連の動作を宣言的に定義したシナリオ
+//
+//	name: retry until success
+//	client:
+//	  max_attempts: 3
+//	  backoff: 10ms
+//	steps:
+//	  - status: 503
+//	    retry_after: "1"
+//	  - status: 200
+//	expect:
+//	  status: 200
+//	  attempts: 2
+//	  min_elapsed: 1s
+type Scenario struct {
+	Name    string      `yaml:"name"`
+	Client  ClientSpec  `yaml:"client"`
+	Request RequestSpec `yaml:"request"`
+	// Steps はサーバーがリクエストごとに順に返却するレスポンス。Pattern と同時には指定できない
+	Steps []flaky.Step `yaml:"steps"`
+	// Pattern は FlakyServer の /status と同じ形式の割合 (例: "200:0.2,500:0.8")
+	Pattern string `yaml:"pattern"`
+	// Seed は Pattern からステータスコードを選択する乱数のシード
+	Seed int64 `yaml:"seed"`
+	// Latency は Pattern を指定した場合に、すべてのレスポンスに加える遅延
+	Latency time.Duration `yaml:"latency"`
+	Expect  Expectation   `yaml:"expect"`
+}
+
+// ClientSpec はシナリオで使用する Client の設定。ゼロ値の項目は Client のデフォルト値を使用する
+type ClientSpec struct {
+	MaxAttempts    int           `yaml:"max_attempts"`
+	Timeout        time.Duration `yaml:"timeout"`
+	AttemptTimeout time.Duration `yaml:"attempt_timeout"`
+	// Backoff は固定のバックオフの待機時間
+	Backoff            time.Duration `yaml:"backoff"`
+	MaxRetryAfter      time.Duration `yaml:"max_retry_after"`
+	RetryNonIdempotent bool          `yaml:"retry_non_idempotent"`
+}
+
+// RequestSpec はシナリオで送信するリクエスト。ゼロ値の場合は GET で送信する
+type RequestSpec struct {
+	Method string `yaml:"method"`
+	Body   string `yaml:"body"`
+}
+
+// Expectation はシナリオの結果の期待値。ゼロ値の項目は検証しない
+type Expectation struct {
+	Status int `yaml:"status"`
+	// Attempts はサーバーが受け付けたリクエスト数
+	Attempts   int           `yaml:"attempts"`
+	MinElapsed time.Duration `yaml:"min_elapsed"`
+	MaxElapsed time.Duration `yaml:"max_elapsed"`
+	// Error は最終的なエラーのメッセージに含まれる文字列
+	Error string `yaml:"error"`
+}
+
+// Report はシナリオの実行結果
+type Report struct {
+	Name     string
+	Status   int
+	Attempts int
+	Elapsed  time.Duration
+	Err      error
+	// Failures は期待値と一致しなかった項目。空の場合は成功
+	Failures []string
+}
+
+// Passed はすべての期待値と一致したか
+func (r Report) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// LoadScenarios は path の YAML ファイル、または path のディレクトリ内の *.yaml からシナリオを読み込む
+// 1 つのファイルには、"---" で区切って複数のシナリオを定義できる
+func LoadScenarios(path string) ([]Scenario, error) {
+	files := []string{path}
+	if info, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(path, "*.yaml")); err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+	}
+
+	var scenarios []Scenario
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		decoder := yaml.NewDecoder(f)
+		decoder.KnownFields(true)
+		for {
+			var s Scenario
+			if err := decoder.Decode(&s); err != nil {
+				f.Close()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			if s.Name == "" {
+				s.Name = fmt.Sprintf("%s#%d", filepath.Base(file), len(scenarios)+1)
+			}
+			scenarios = append(scenarios, s)
+		}
+	}
+	return scenarios, nil
+}
+
+// Run は、シナリオのサーバーを起動してリクエストを送信し、結果を期待値と比較する
+func (s Scenario) Run(ctx context.Context) Report {
+	report := Report{Name: s.Name}
+	if len(s.Steps) > 0 && s.Pattern != "" {
+		report.Failures = append(report.Failures, "steps and pattern cannot be combined")
+		return report
+	}
+
+	var count func() int
+	var handler http.Handler
+	path := "/"
+	if s.Pattern != "" {
+		counter := &countingHandler{next: flaky.NewFlakyServer(flaky.Config{Latency: s.Latency, Source: rand.NewSource(s.Seed)})}
+		handler, count = counter, counter.Requests
+		path = "/status/" + s.Pattern
+	} else {
+		sequence := flaky.NewSequenceServer(s.Steps...)
+		handler, count = sequence, sequence.Requests
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	method := s.Request.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, method, server.URL+path, strings.NewReader(s.Request.Body))
+	if err != nil {
+		report.Err = err
+		report.Failures = append(report.Failures, fmt.Sprintf("build request: %v", err))
+		return report
+	}
+
+	start := time.Now()
+	res, err := retryhttp.NewClient(s.Client.options()...).Do(req)
+	report.Elapsed = time.Since(start)
+	report.Err = err
+	if res != nil {
+		report.Status = res.StatusCode
+		_, _ = io.Copy(io.Discard, res.Body)
+		_ = res.Body.Close()
+	}
+	report.Attempts = count()
+
+	report.Failures = s.Expect.compare(report)
+	return report
+}
+
+// options は ClientSpec から Client のオプションを作成する
+func (c ClientSpec) options() []retryhttp.Option {
+	// NOTE: シナリオの結果のみを出力するため、リトライのログは出力しない
+	opts := []retryhttp.Option{
+		retryhttp.WithRetryNonIdempotent(c.RetryNonIdempotent),
+		retryhttp.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	}
+	if c.MaxAttempts > 0 {
+		opts = append(opts, retryhttp.WithMaxAttempts(c.MaxAttempts))
+	}
+	if c.Timeout > 0 {
+		opts = append(opts, retryhttp.WithTimeout(c.Timeout))
+	}
+	if c.AttemptTimeout > 0 {
+		opts = append(opts, retryhttp.WithAttemptTimeout(c.AttemptTimeout))
+	}
+	if c.Backoff > 0 {
+		backoff := c.Backoff
+		opts = append(opts, retryhttp.WithBackoff(retryabletransport.Constant(backoff)))
+	}
+	if c.MaxRetryAfter > 0 {
+		opts = append(opts, retryhttp.WithTransportOptions(retryabletransport.WithMaxRetryAfter(c.MaxRetryAfter)))
+	}
+	return opts
+}
+
+// compare は実行結果を期待値と比較し、一致しなかった項目を返却する
+func (e Expectation) compare(r Report) []string {
+	var failures []string
+	if e.Status != 0 && r.Status != e.Status {
+		failures = append(failures, fmt.Sprintf("status = %d, want %d", r.Status, e.Status))
+	}
+	if e.Attempts != 0 && r.Attempts != e.Attempts {
+		failures = append(failures, fmt.Sprintf("attempts = %d, want %d", r.Attempts, e.Attempts))
+	}
+	if e.MinElapsed != 0 && r.Elapsed < e.MinElapsed {
+		failures = append(failures, fmt.Sprintf("elapsed = %s, want >= %s", r.Elapsed, e.MinElapsed))
+	}
+	if e.MaxElapsed != 0 && r.Elapsed > e.MaxElapsed {
+		failures = append(failures, fmt.Sprintf("elapsed = %s, want <= %s", r.Elapsed, e.MaxElapsed))
+	}
+	switch {
+	case e.Error == "" && r.Err != nil:
+		failures = append(failures, fmt.Sprintf("err = %v, want nil", r.Err))
+	case e.Error != "" && (r.Err == nil || !strings.Contains(r.Err.Error(), e.Error)):
+		failures = append(failures, fmt.Sprintf("err = %v, want containing %q", r.Err, e.Error))
+	}
+	return failures
+}
+
+// countingHandler は受け付けたリクエスト数を数える http.Handler
+type countingHandler struct {
+	next http.Handler
+
+	mu       sync.Mutex
+	requests int
+}
+
+func (h *countingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.requests++
+	h.mu.Unlock()
+	h.next.ServeHTTP(w, r)
+}
+
+// Requests は受け付けたリクエスト数を返却する
+func (h *countingHandler) Requests() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.requests
+}
@@ -0,0 +1,167 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestScenarios は scenarios/ のすべてのシナリオを実行し、期待値と一致することを検証する
+func TestScenarios(t *testing.T) {
+	scenarios, err := LoadScenarios("scenarios")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scenarios) == 0 {
+		t.Fatal("no scenarios in scenarios/")
+	}
+	for _, s := range scenarios {
+		t.Run(s.Name, func(t *testing.T) {
+			// NOTE: 期待値のないシナリオは常に成功するため、結果 (ステータスコードまたはエラー) の期待値を必須とする
+			if s.Expect.Status == 0 && s.Expect.Error == "" {
+				t.Fatal("scenario expects neither a status nor an error")
+			}
+			// NOTE: 全体のタイムアウトで終了するシナリオは、試行回数が実行環境の速度に依存するため検証しない
+			if s.Expect.Attempts == 0 && s.Client.Timeout == 0 {
+				t.Error("scenario does not expect an attempt count")
+			}
+
+			report := s.Run(context.Background())
+			for _, failure := range report.Failures {
+				t.Error(failure)
+			}
+			if t.Failed() {
+				t.Logf("status = %d, attempts = %d, elapsed = %s, err = %v", report.Status, report.Attempts, report.Elapsed, report.Err)
+			}
+		})
+	}
+}
+
+func TestLoadScenarios(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "b.yaml", "name: second\nsteps:\n  - status: 200\n")
+	writeFile(t, dir, "a.yaml", "steps:\n  - status: 503\n---\nname: named\npattern: \"200:1\"\n")
+	writeFile(t, dir, "ignored.yml", "name: ignored\n")
+
+	scenarios, err := LoadScenarios(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range scenarios {
+		names = append(names, s.Name)
+	}
+	// NOTE: ファイル名の順に読み込み、名前のないシナリオにはファイル名と通し番号を付ける
+	if got, want := strings.Join(names, ","), "a.yaml#1,named,second"; got != want {
+		t.Errorf("names = %s, want %s", got, want)
+	}
+	if len(scenarios[0].Steps) != 1 || scenarios[0].Steps[0].Status != 503 {
+		t.Errorf("steps = %+v, want one 503 step", scenarios[0].Steps)
+	}
+
+	single, err := LoadScenarios(filepath.Join(dir, "b.yaml"))
+	if err != nil || len(single) != 1 || single[0].Name != "second" {
+		t.Errorf("LoadScenarios(file) = %+v, %v", single, err)
+	}
+}
+
+func TestLoadScenariosErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "unknown.yaml", "name: typo\nexpect:\n  attempt: 2\n")
+
+	if _, err := LoadScenarios(filepath.Join(dir, "missing.yaml")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: err = %v, want os.ErrNotExist", err)
+	}
+	// NOTE: 期待値の項目名の間違いで検証が行われないことを防ぐため、未知の項目はエラーとする
+	if _, err := LoadScenarios(dir); err == nil || !strings.Contains(err.Error(), "unknown.yaml") {
+		t.Errorf("unknown field: err = %v, want an error naming the file", err)
+	}
+}
+
+func TestRunStepsAndPattern(t *testing.T) {
+	s, err := LoadScenarios(writeFile(t, t.TempDir(), "s.yaml", "steps:\n  - status: 200\npattern: \"200:1\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := s[0].Run(context.Background())
+	if report.Passed() || report.Failures[0] != "steps and pattern cannot be combined" {
+		t.Errorf("failures = %q, want the combination to be rejected", report.Failures)
+	}
+}
+
+func TestExpectationCompare(t *testing.T) {
+	errGivingUp := errors.New("giving up after 3 attempts")
+	tests := []struct {
+		name   string
+		expect Expectation
+		report Report
+		want   []string
+	}{
+		{
+			name:   "zero expectation checks only the error",
+			report: Report{Status: 500, Attempts: 3, Elapsed: time.Second},
+		},
+		{
+			name:   "all matched",
+			expect: Expectation{Status: 200, Attempts: 2, MinElapsed: time.Second, MaxElapsed: 2 * time.Second},
+			report: Report{Status: 200, Attempts: 2, Elapsed: 1500 * time.Millisecond},
+		},
+		{
+			name:   "status and attempts",
+			expect: Expectation{Status: 200, Attempts: 2},
+			report: Report{Status: 503, Attempts: 4},
+			want:   []string{"status = 503, want 200", "attempts = 4, want 2"},
+		},
+		{
+			name:   "elapsed too short",
+			expect: Expectation{MinElapsed: time.Second},
+			report: Report{Elapsed: 10 * time.Millisecond},
+			want:   []string{"elapsed = 10ms, want >= 1s"},
+		},
+		{
+			name:   "elapsed too long",
+			expect: Expectation{MaxElapsed: time.Second},
+			report: Report{Elapsed: 2 * time.Second},
+			want:   []string{"elapsed = 2s, want <= 1s"},
+		},
+		{
+			name:   "unexpected error",
+			report: Report{Err: errGivingUp},
+			want:   []string{"err = giving up after 3 attempts, want nil"},
+		},
+		{
+			name:   "expected error matched",
+			expect: Expectation{Error: "giving up"},
+			report: Report{Err: errGivingUp},
+		},
+		{
+			name:   "expected error missing",
+			expect: Expectation{Error: "giving up"},
+			report: Report{Status: 200},
+			want:   []string{`err = <nil>, want containing "giving up"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.expect.compare(tt.report)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("compare = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// writeFile は dir に name のファイルを作成し、そのパスを返却する
+func writeFile(t *testing.T, dir string, name string, content string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
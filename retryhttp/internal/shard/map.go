@@ -0,0 +1,91 @@
+// Package shard は、ホストごとの状態を複数のロックに分散して保持するマップを提供する
+// NOTE: 1 つの sync.Mutex ですべてのホストの状態を保護すると、数万 RPS ではロックの競合がボトルネックになるため、
+// キーのハッシュ値でシャードを選択し、異なるシャードのホストへの更新は並行して実行できるようにする
+package shard
+
+import (
+	"hash/maphash"
+	"runtime"
+	"sync"
+)
+
+// cacheLineSize は隣接するシャードのロックが同じキャッシュラインに載らないようにするためのパディングのバイト数
+const cacheLineSize = 64
+
+// Map はキーのハッシュ値でシャードを選択し、シャードごとのロックで値を保護するマップ
+// Map の値は New で作成する
+type Map[V any] struct {
+	seed   maphash.Seed
+	mask   uint64
+	shards []Shard[V]
+}
+
+// Shard はロックとマップの組。Map.Lock でロックを取得した状態で返却される
+type Shard[V any] struct {
+	mu sync.Mutex
+	// Entries はシャードに属するキーと値。ロックを取得している間のみ参照できる
+	Entries map[string]V
+	// false sharing を避けるため、隣接するシャードのロックが同じキャッシュラインに載らないようにする
+	_ [cacheLineSize]byte
+}
+
+// Unlock はシャードのロックを解放する
+func (s *Shard[V]) Unlock() {
+	s.mu.Unlock()
+}
+
+// DefaultShards は、シャード数を指定しなかった場合のシャード数を返却する
+// NOTE: 同時に実行できるゴルーチンの数より十分多くなるように、GOMAXPROCS の 4 倍にする
+func DefaultShards() int {
+	return runtime.GOMAXPROCS(0) * 4
+}
+
+// New は n 個のシャードを持つ Map を作成する
+// n は 2 のべき乗に切り上げる。n が 0 以下の場合は DefaultShards を使用する。n が 1 の場合は 1 つのロックですべてのキーを保護する
+func New[V any](n int) *Map[V] {
+	if n <= 0 {
+		n = DefaultShards()
+	}
+	size := 1
+	for size < n {
+		size <<= 1
+	}
+	m := &Map[V]{
+		seed:   maphash.MakeSeed(),
+		mask:   uint64(size - 1),
+		shards: make([]Shard[V], size),
+	}
+	for i := range m.shards {
+		m.shards[i].Entries = make(map[string]V)
+	}
+	return m
+}
+
+// Lock は key が属するシャードのロックを取得して返却する。呼び出し元は Shard.Unlock でロックを解放すること
+// NOTE: Shard.Entries には key 以外に同じシャードに属するキーも含まれるが、key のみを操作すること
+// ロックを取得している間に同じ Map の Lock や Range を呼び出すとデッドロックする場合がある
+func (m *Map[V]) Lock(key string) *Shard[V] {
+	s := &m.shards[maphash.String(m.seed, key)&m.mask]
+	s.mu.Lock()
+	return s
+}
+
+// Range はシャードを 1 つずつロックし、シャードのマップを fn に渡す
+// NOTE: すべてのシャードを同時にロックしないため、fn の呼び出しの間に他のシャードは更新される場合がある
+func (m *Map[V]) Range(fn func(entries map[string]V)) {
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.Lock()
+		fn(s.Entries)
+		s.mu.Unlock()
+	}
+}
+
+// Len はすべてのシャードのキーの数の合計を返却する
+func (m *Map[V]) Len() int {
+	n := 0
+	m.Range(func(entries map[string]V) {
+		n += len(entries)
+	})
+	return n
+}
@@ -0,0 +1,59 @@
+package shard
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestNewRoundsUpShards(t *testing.T) {
+	for n, want := range map[int]int{1: 1, 3: 4, 8: 8, 9: 16} {
+		if got := len(New[int](n).shards); got != want {
+			t.Errorf("New(%d) has %d shards, want %d", n, got, want)
+		}
+	}
+	if got, min := len(New[int](0).shards), DefaultShards(); got < min {
+		t.Errorf("New(0) has %d shards, want at least %d", got, min)
+	}
+}
+
+func TestMap(t *testing.T) {
+	m := New[int](4)
+
+	// NOTE: 異なるシャードのキーを並行して更新しても、すべての更新が反映される
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("host-%d", i)
+				s := m.Lock(key)
+				s.Entries[key]++
+				s.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := m.Len(); got != 100 {
+		t.Errorf("Len = %d, want 100", got)
+	}
+	total := 0
+	m.Range(func(entries map[string]int) {
+		for _, n := range entries {
+			total += n
+		}
+	})
+	if total != 800 {
+		t.Errorf("total = %d, want 800", total)
+	}
+
+	// 同じキーは常に同じシャードに属する
+	s := m.Lock("host-1")
+	n := s.Entries["host-1"]
+	s.Unlock()
+	if n != 8 {
+		t.Errorf("host-1 = %d, want 8", n)
+	}
+}
@@ -0,0 +1,108 @@
+package retryhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// maxDecodeRetries は、レスポンスボディのデコード中に接続が切断された場合に、リクエストを再送する最大回数
+const maxDecodeRetries = 2
+
+// DoJSON は in を JSON にエンコードしたリクエストボディで送信し、レスポンスボディを JSON として out にデコードする
+// in が nil の場合はリクエストボディなし、out が nil の場合はデコードしない。ステータスコードが 2xx 以外の場合は *StatusError を返却する
+// 冪等なリクエストは、デコード中に接続が切断された場合 (io.ErrUnexpectedEOF など) に最大 2 回まで再送する
+// NOTE: リトライはステータスコードと送信エラーで判定するため、レスポンスボディの読み込み中の切断はリトライされない
+// 冪等でないリクエストは、サーバーが処理済みのため再送せずにエラーを返却する
+// 返却する *http.Response のボディはクローズ済みのため、ステータスやヘッダーの参照のみに使用する
+func (c *Client) DoJSON(ctx context.Context, method string, url string, in any, out any,
+	opts ...RequestOption) (*http.Response, error) {
+	var payload []byte
+	if in != nil {
+		var err error
+		if payload, err = json.Marshal(in); err != nil {
+			return nil, err
+		}
+	}
+
+	for retries := 0; ; retries++ {
+		req, err := c.newJSONRequest(ctx, method, url, payload, opts...)
+		if err != nil {
+			return nil, err
+		}
+		res, err := c.DoDecode(req, out)
+		if err == nil || retries >= maxDecodeRetries || !isTransientDecodeError(err) || !isIdempotentRequest(req) {
+			return res, err
+		}
+		// NOTE: 途中までデコードした値が残らないように、再送する前にゼロ値に戻す
+		resetJSONTarget(out)
+	}
+}
+
+// GetJSON は GET リクエストを送信し、レスポンスボディを JSON として out にデコードする
+func (c *Client) GetJSON(ctx context.Context, url string, out any, opts ...RequestOption) (*http.Response, error) {
+	return c.DoJSON(ctx, http.MethodGet, url, nil, out, opts...)
+}
+
+// PostJSON は in を JSON にエンコードして POST リクエストを送信し、レスポンスボディを JSON として out にデコードする
+func (c *Client) PostJSON(ctx context.Context, url string, in any, out any, opts ...RequestOption) (*http.Response, error) {
+	return c.DoJSON(ctx, http.MethodPost, url, in, out, opts...)
+}
+
+// newJSONRequest は、JSON のリクエストボディと Content-Type、Accept ヘッダーを設定したリクエストを作成する
+// NOTE: リトライでボディを巻き戻せるように、*bytes.Reader をボディに指定して GetBody を設定する
+func (c *Client) newJSONRequest(ctx context.Context, method string, url string, payload []byte,
+	opts ...RequestOption) (*http.Request, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	for _, opt := range opts {
+		opt(req)
+	}
+	return req, nil
+}
+
+// isTransientDecodeError は、レスポンスボディの読み込み中の切断など、再送すれば成功する可能性があるデコードのエラーか判定する
+// NOTE: JSON の構文エラーや型の不一致は、再送しても同じレスポンスが返却されるため対象外とする
+func isTransientDecodeError(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr)
+}
+
+// isIdempotentRequest は、再送しても副作用が重複しないリクエストか判定する
+// NOTE: Idempotency-Key ヘッダーが付与されている場合は、サーバー側で重複が排除されるため冪等とみなす
+func isIdempotentRequest(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get(retryabletransport.HeaderIdempotencyKey) != ""
+}
+
+// resetJSONTarget は、デコード先のポインタが指す値をゼロ値に戻す
+func resetJSONTarget(out any) {
+	v := reflect.ValueOf(out)
+	if v.Kind() == reflect.Pointer && !v.IsNil() {
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+	}
+}
@@ -0,0 +1,190 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PrometheusMetrics は RetryableTransport のリクエスト数、リトライ数、バックオフ、試行ごとのレイテンシーを Prometheus に公開する
+// Options で RetryableTransport に、InstrumentAttempts で親の Transport に設定する
+type PrometheusMetrics struct {
+	requests       *prometheus.CounterVec
+	retries        *prometheus.CounterVec
+	exhausted      *prometheus.CounterVec
+	backoff        prometheus.Histogram
+	attemptLatency *prometheus.HistogramVec
+	downgrades     *prometheus.CounterVec
+	// annotationKeys は、requests と exhausted のラベルに追加するアノテーションのキー。guard はその値の種類数を制限する
+	annotationKeys []string
+	guard          *retryabletransport.CardinalityGuard
+}
+
+// PrometheusOption は NewPrometheusMetrics の設定を変更する関数の型定義
+type PrometheusOption func(*PrometheusMetrics)
+
+// WithAnnotationLabels は、アノテーションの keys の値を、リクエスト数と上限に達したリクエスト数のラベルに追加する
+// 例: NewPrometheusMetrics(reg, "myservice", WithAnnotationLabels(50, "tenant", "feature"))
+// キーごとに maxValuesPerKey 種類を超えた新しい値は retryabletransport.OverflowLabelValue に、アノテーションがない場合は空文字列になる
+// NOTE: テナント ID などの値の種類が多いアノテーションで時系列が増え続けないように、CardinalityGuard で値の種類数を制限する
+// keys は Prometheus のラベル名として使用できる名前 (英数字とアンダースコア) を指定する
+func WithAnnotationLabels(maxValuesPerKey int, keys ...string) PrometheusOption {
+	return func(m *PrometheusMetrics) {
+		m.annotationKeys = append([]string(nil), keys...)
+		m.guard = retryabletransport.NewCardinalityGuard(maxValuesPerKey, keys...)
+	}
+}
+
+// NewPrometheusMetrics は PrometheusMetrics 構造体を作成し、reg に登録する
+// namespace はメトリクス名の接頭辞 (例: "myservice" の場合は "myservice_http_client_requests_total")
+func NewPrometheusMetrics(reg prometheus.Registerer, namespace string, opts ...PrometheusOption) (*PrometheusMetrics, error) {
+	// NOTE: ラベルはメトリクスの作成時に決まるため、先にオプションを適用する
+	options := &PrometheusMetrics{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	m := &PrometheusMetrics{
+		annotationKeys: options.annotationKeys,
+		guard:          options.guard,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http_client",
+			Name:      "requests_total",
+			Help:      "Total number of requests, counting retries of the same request once.",
+		}, append([]string{"host", "method", "route", "code"}, options.annotationKeys...)),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http_client",
+			Name:      "retries_total",
+			Help:      "Total number of retries by the status code or error class of the attempt that was retried.",
+		}, []string{"reason"}),
+		exhausted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http_client",
+			Name:      "retry_exhausted_total",
+			Help:      "Total number of requests that still needed a retry when attempts or the retry budget ran out.",
+		}, append([]string{"host", "method", "route"}, options.annotationKeys...)),
+		backoff: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http_client",
+			Name:      "backoff_seconds",
+			Help:      "Wait time before each retry.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+		}),
+		attemptLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http_client",
+			Name:      "attempt_duration_seconds",
+			Help:      "Latency of each attempt until response headers are received.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"host", "code"}),
+		downgrades: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http_client",
+			Name:      "protocol_downgrades_total",
+			Help:      "Total number of times a host was switched to HTTP/1.1 after repeated HTTP/2 failures.",
+		}, []string{"host"}),
+	}
+	for _, c := range []prometheus.Collector{m.requests, m.retries, m.exhausted, m.backoff, m.attemptLatency, m.downgrades} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Options は、リクエスト数、リトライ数、バックオフを集計するための RetryableTransport のオプションを返却する
+// NOTE: route ラベルのカーディナリティを抑えるため、WithRouteTemplates も合わせて設定する
+func (m *PrometheusMetrics) Options() []retryabletransport.Option {
+	return []retryabletransport.Option{
+		retryabletransport.WithRecorder(m),
+		retryabletransport.WithOnRetry(m.OnRetry),
+	}
+}
+
+// Record はリクエスト全体の結果を集計する
+// NOTE: このメソッドを実装することで、PrometheusMetrics は retryabletransport.Recorder インターフェースを満たす
+func (m *PrometheusMetrics) Record(result retryabletransport.RequestResult) {
+	annotations := m.annotationLabels(result.Annotations)
+	m.requests.WithLabelValues(append([]string{result.Host, result.Method, result.Route, code(result.StatusCode, result.Err)}, annotations...)...).Inc()
+	if result.Exhausted {
+		m.exhausted.WithLabelValues(append([]string{result.Host, result.Method, result.Route}, annotations...)...).Inc()
+	}
+}
+
+// annotationLabels は、WithAnnotationLabels のキーの順に、CardinalityGuard で制限したアノテーションの値を返却する
+func (m *PrometheusMetrics) annotationLabels(annotations retryabletransport.Annotations) []string {
+	if len(m.annotationKeys) == 0 {
+		return nil
+	}
+	labels := m.guard.Labels(annotations)
+	values := make([]string, len(m.annotationKeys))
+	for i, key := range m.annotationKeys {
+		values[i] = labels[key]
+	}
+	return values
+}
+
+// OnRetry はリトライ数とバックオフを集計する
+// NOTE: このメソッドを実装することで、PrometheusMetrics は RetryObserver インターフェースを満たす
+func (m *PrometheusMetrics) OnRetry(_ int, wait time.Duration, reason retryabletransport.RetryReason) {
+	m.retries.WithLabelValues(code(reason.StatusCode, reason.Err)).Inc()
+	m.backoff.Observe(wait.Seconds())
+}
+
+// InstrumentAttempts は、試行ごとのレイテンシーを集計する http.RoundTripper を返却する
+// NOTE: RetryableTransport の内側 (親の Transport) に設定することで、リトライを含まない 1 回の試行を計測する
+func (m *PrometheusMetrics) InstrumentAttempts(transport http.RoundTripper) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		res, err := transport.RoundTrip(req)
+		statusCode := 0
+		if res != nil {
+			statusCode = res.StatusCode
+		}
+		m.attemptLatency.WithLabelValues(req.URL.Host, code(statusCode, err)).Observe(time.Since(start).Seconds())
+		return res, err
+	})
+}
+
+// OnDowngrade は HTTP/1.1 への切り替えを集計する。HTTP2FallbackConfig.OnDowngrade に設定する
+func (m *PrometheusMetrics) OnDowngrade(host string, _ time.Time) {
+	m.downgrades.WithLabelValues(host).Inc()
+}
+
+// roundTripperFunc は関数を http.RoundTripper として使用するための型定義
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// code はステータスコード、または送信エラーの分類をラベルの値として返却する
+func code(statusCode int, err error) string {
+	if err == nil {
+		return strconv.Itoa(statusCode)
+	}
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, retryabletransport.ErrCircuitOpen):
+		return "circuit_open"
+	default:
+		return "error"
+	}
+}
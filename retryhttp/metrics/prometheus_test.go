@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"testing"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestWithAnnotationLabels(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := NewPrometheusMetrics(reg, "test", WithAnnotationLabels(2, "tenant"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tenant := range []string{"a", "b", "c", "a", ""} {
+		result := retryabletransport.RequestResult{Host: "example.com", Method: "GET", StatusCode: 200, Exhausted: true}
+		if tenant != "" {
+			result.Annotations = retryabletransport.Annotations{"tenant": tenant, "user": "ignored"}
+		}
+		m.Record(result)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string]float64{
+		"test_http_client_requests_total": {
+			"a": 2, "b": 1, retryabletransport.OverflowLabelValue: 1, "": 1,
+		},
+		"test_http_client_retry_exhausted_total": {
+			"a": 2, "b": 1, retryabletransport.OverflowLabelValue: 1, "": 1,
+		},
+	}
+	for _, family := range families {
+		expected, ok := want[family.GetName()]
+		if !ok {
+			continue
+		}
+		delete(want, family.GetName())
+		got := make(map[string]float64)
+		for _, metric := range family.GetMetric() {
+			var tenant string
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "user" {
+					t.Errorf("%s: annotation key not in WithAnnotationLabels was used as a label", family.GetName())
+				}
+				if label.GetName() == "tenant" {
+					tenant = label.GetValue()
+				}
+			}
+			got[tenant] += metric.GetCounter().GetValue()
+		}
+		if len(got) != len(expected) {
+			t.Errorf("%s: got %v, want %v", family.GetName(), got, expected)
+			continue
+		}
+		for tenant, count := range expected {
+			if got[tenant] != count {
+				t.Errorf("%s{tenant=%q}: got %v, want %v", family.GetName(), tenant, got[tenant], count)
+			}
+		}
+	}
+	for name := range want {
+		t.Errorf("%s was not gathered", name)
+	}
+}
+
+func TestNewPrometheusMetricsWithoutAnnotationLabels(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := NewPrometheusMetrics(reg, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Record(retryabletransport.RequestResult{
+		Host: "example.com", Method: "GET", StatusCode: 200,
+		Annotations: retryabletransport.Annotations{"tenant": "a"},
+	})
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			if n := len(metric.GetLabel()); family.GetName() == "test_http_client_requests_total" && n != 4 {
+				t.Errorf("requests_total has %d labels, want 4", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// Sink はメトリクスの送信先のインターフェース。PrometheusMetrics や StatsDSink、任意の retryabletransport.Recorder を登録できる
+type Sink = retryabletransport.Recorder
+
+// RetryObserver は、リトライ数とバックオフも集計する Sink が実装するインターフェース
+type RetryObserver interface {
+	OnRetry(attempt int, wait time.Duration, reason retryabletransport.RetryReason)
+}
+
+// Filter は、Sink にリクエストの結果を送信するか判定する関数の型定義
+// NOTE: 例えばコストの高い Sink には、特定のホストやエラーの結果だけを送信する
+type Filter func(result retryabletransport.RequestResult) bool
+
+// Registry は、登録した複数の Sink にリクエストの結果を送信する
+// NOTE: 監視基盤が異なるチームでも、同じ Client の設定のまま Prometheus と StatsD などに同時に送信するために使用する
+type Registry struct {
+	mu    sync.RWMutex
+	sinks []registeredSink
+}
+
+// registeredSink は名前とフィルターを付けて登録した Sink
+type registeredSink struct {
+	name   string
+	sink   Sink
+	filter Filter
+}
+
+// DefaultRegistry はパッケージ全体で共有する Registry
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry は Registry 構造体を作成する
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register は name で Sink を登録する。filter が nil の場合はすべての結果を送信する
+// 同じ名前の Sink が登録済みの場合はエラーを返却する
+func (r *Registry) Register(name string, sink Sink, filter Filter) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range r.sinks {
+		if s.name == name {
+			return fmt.Errorf("metrics sink %q is already registered", name)
+		}
+	}
+	r.sinks = append(r.sinks, registeredSink{name: name, sink: sink, filter: filter})
+	return nil
+}
+
+// Unregister は name の Sink の登録を解除する。登録されていない場合は false を返却する
+func (r *Registry) Unregister(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, s := range r.sinks {
+		if s.name == name {
+			// NOTE: 送信中の Record が参照しているスライスを変更しないように、新しいスライスを作成する
+			r.sinks = append(append([]registeredSink(nil), r.sinks[:i]...), r.sinks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Options は、登録したすべての Sink に送信するための RetryableTransport のオプションを返却する
+// NOTE: Options を設定した後に登録した Sink にも送信する
+func (r *Registry) Options() []retryabletransport.Option {
+	return []retryabletransport.Option{
+		retryabletransport.WithRecorder(r),
+		retryabletransport.WithOnRetry(r.OnRetry),
+	}
+}
+
+// Record は、フィルターが許可した Sink にリクエスト全体の結果を送信する
+// NOTE: このメソッドを実装することで、Registry は retryabletransport.Recorder インターフェースを満たす
+func (r *Registry) Record(result retryabletransport.RequestResult) {
+	for _, s := range r.snapshot() {
+		if s.filter == nil || s.filter(result) {
+			s.sink.Record(result)
+		}
+	}
+}
+
+// OnRetry は、RetryObserver を実装する Sink にリトライを送信する
+// NOTE: リトライの時点ではリクエスト全体の結果がないため、フィルターは適用しない
+func (r *Registry) OnRetry(attempt int, wait time.Duration, reason retryabletransport.RetryReason) {
+	for _, s := range r.snapshot() {
+		if observer, ok := s.sink.(RetryObserver); ok {
+			observer.OnRetry(attempt, wait, reason)
+		}
+	}
+}
+
+// snapshot は登録されている Sink の一覧を返却する
+func (r *Registry) snapshot() []registeredSink {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.sinks
+}
+
+// Register は DefaultRegistry に Sink を登録する
+func Register(name string, sink Sink, filter Filter) error {
+	return DefaultRegistry.Register(name, sink, filter)
+}
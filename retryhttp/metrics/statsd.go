@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// StatsDSink は、リクエスト数、リトライ数、レイテンシーを StatsD のプロトコルで UDP で送信する Sink
+// NOTE: UDP で送信するため、送信に失敗したメトリクスは破棄する
+type StatsDSink struct {
+	conn   net.Conn
+	prefix string
+}
+
+// NewStatsDSink は StatsDSink 構造体を作成する。addr は StatsD のアドレス (例: "127.0.0.1:8125")
+// prefix はメトリクス名の接頭辞 (例: "myservice" の場合は "myservice.http_client.requests.<host>.<code>")
+func NewStatsDSink(addr string, prefix string) (*StatsDSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsDSink{conn: conn, prefix: prefix}, nil
+}
+
+// Close はコネクションをクローズする
+func (s *StatsDSink) Close() error {
+	return s.conn.Close()
+}
+
+// Record はリクエスト数とリクエスト全体の所要時間を送信する
+// NOTE: このメソッドを実装することで、StatsDSink は Sink インターフェースを満たす
+func (s *StatsDSink) Record(result retryabletransport.RequestResult) {
+	host := sanitize(result.Host)
+	s.send(fmt.Sprintf("requests.%s.%s:1|c", host, code(result.StatusCode, result.Err)))
+	s.send(fmt.Sprintf("duration.%s:%d|ms", host, result.Duration.Milliseconds()))
+	if result.Exhausted {
+		s.send(fmt.Sprintf("retry_exhausted.%s:1|c", host))
+	}
+}
+
+// OnRetry はリトライ数とバックオフを送信する
+// NOTE: このメソッドを実装することで、StatsDSink は RetryObserver インターフェースを満たす
+func (s *StatsDSink) OnRetry(_ int, wait time.Duration, reason retryabletransport.RetryReason) {
+	s.send(fmt.Sprintf("retries.%s:1|c", code(reason.StatusCode, reason.Err)))
+	s.send(fmt.Sprintf("backoff:%d|ms", wait.Milliseconds()))
+}
+
+// send は接頭辞を付けてメトリクスを送信する
+func (s *StatsDSink) send(metric string) {
+	name := "http_client." + metric
+	if s.prefix != "" {
+		name = s.prefix + "." + name
+	}
+	_, _ = s.conn.Write([]byte(name))
+}
+
+// sanitize は、StatsD のメトリクス名の区切り文字をホスト名から取り除く
+func sanitize(host string) string {
+	return strings.NewReplacer(".", "_", ":", "_", "|", "_", "@", "_").Replace(host)
+}
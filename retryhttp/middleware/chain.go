@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// Middleware は http.RoundTripper をラップして、横断的な処理を追加する関数の型定義
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// Chain は base を mws でラップした http.RoundTripper を返却する
+// 先頭の Middleware が最も外側になり、リクエストは mws の順に処理されてから base で送信される
+// NOTE: 例えば Chain(base, Coalescing(...), Retry(...), OTP(...)) は、同一のリクエストをまとめてからリトライし、試行ごとにワンタイムパスワードを生成する
+// base が nil の場合は http.DefaultTransport を使用する
+func Chain(base http.RoundTripper, mws ...Middleware) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	for i := len(mws) - 1; i >= 0; i-- {
+		base = mws[i](base)
+	}
+	return base
+}
+
+// RoundTripperFunc は関数を http.RoundTripper として使用するための型
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip は f(req) を返却する
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Retry は RetryableTransport でラップする Middleware を返却する。引数は NewRetryableTransport と同じ
+// NOTE: ログ、メトリクス、認証情報の更新はリトライの試行と連動するため、Middleware ではなく
+// retryabletransport.WithLogger、WithRecorder、WithAuthRefresher で opts に指定する
+func Retry(maxRetryCounts int, shouldRetry retryabletransport.CheckRetryFunc, backoff retryabletransport.BackoffFunc,
+	opts ...retryabletransport.Option) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return retryabletransport.NewRetryableTransport(next, maxRetryCounts, shouldRetry, backoff, opts...)
+	}
+}
+
+// Coalescing は CoalescingTransport でラップする Middleware を返却する
+func Coalescing(config CoalescingConfig) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return NewCoalescingTransport(next, config)
+	}
+}
+
+// MethodOverride は MethodOverrideTransport でラップする Middleware を返却する
+func MethodOverride(methods ...string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return NewMethodOverrideTransport(next, methods...)
+	}
+}
+
+// OTP は OTPTransport でラップする Middleware を返却する
+func OTP(header string, generate OTPGenerator) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return NewOTPTransport(next, header, generate)
+	}
+}
+
+// Singleflight は、送信中の同一の GET と HEAD をまとめる CoalescingTransport でラップする Middleware を返却する
+func Singleflight(varyHeaders ...string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return NewSingleflightTransport(next, varyHeaders...)
+	}
+}
+
+// HeaderLimit は HeaderLimitTransport でラップする Middleware を返却する
+func HeaderLimit(config HeaderLimitConfig) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return NewHeaderLimitTransport(next, config)
+	}
+}
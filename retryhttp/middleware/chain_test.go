@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// tag は、リクエストを処理した順序に name を追加する Middleware を返却する
+func tag(name string, order *[]string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			*order = append(*order, name)
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		order = append(order, "base")
+		return textResponse(req, "ok"), nil
+	})
+
+	rt := Chain(base, tag("outer", &order), tag("inner", &order))
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(order, ","); got != "outer,inner,base" {
+		t.Errorf("order = %s, want outer,inner,base", got)
+	}
+}
+
+func TestChainWithoutMiddlewares(t *testing.T) {
+	if rt := Chain(nil); rt != http.DefaultTransport {
+		t.Errorf("Chain(nil) = %T, want http.DefaultTransport", rt)
+	}
+}
+
+// TestChainRetryRunsInnerMiddlewaresPerAttempt は、Retry の内側の Middleware が試行ごとに実行され、外側の Middleware は 1 回だけ実行されることを検証する
+func TestChainRetryRunsInnerMiddlewaresPerAttempt(t *testing.T) {
+	var order []string
+	attempts := 0
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		if attempts < 3 {
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody, Request: req}, nil
+		}
+		return textResponse(req, "ok"), nil
+	})
+	retryOn503 := func(res *http.Response, err error) bool {
+		return err == nil && res.StatusCode == http.StatusServiceUnavailable
+	}
+
+	rt := Chain(base,
+		tag("outer", &order),
+		Retry(3, retryOn503, retryabletransport.Constant(0), retryabletransport.WithoutLogging()),
+		tag("attempt", &order),
+	)
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	res, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", res.StatusCode)
+	}
+	if got := strings.Join(order, ","); got != "outer,attempt,attempt,attempt" {
+		t.Errorf("order = %s, want outer,attempt,attempt,attempt", got)
+	}
+}
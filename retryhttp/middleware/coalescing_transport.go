@@ -0,0 +1,328 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CoalescingConfig は CoalescingTransport の設定。ゼロ値の項目はデフォルト値を使用する
+type CoalescingConfig struct {
+	// Window は、送信したリクエストが成功した後も、同一のリクエストに同じレスポンスを返却する期間。デフォルトは 100 ミリ秒
+	Window time.Duration
+	// Methods はまとめる対象の HTTP メソッド。デフォルトは PUT のみ
+	// NOTE: 冪等なメソッドのみを指定する
+	Methods []string
+	// MaxBodyBytes は、同一か判定するために読み込むリクエストボディの最大バイト数。これより大きいリクエストはまとめない。デフォルトは 1 MiB
+	MaxBodyBytes int64
+	// KeyHeaders は、同一か判定するために比較するヘッダー。デフォルトは Authorization, Content-Type, If-Match, Idempotency-Key
+	KeyHeaders []string
+	// InFlightOnly は、送信中のリクエストのみをまとめるか。true の場合は Window を使用せず、完了したレスポンスを後続のリクエストに返却しない
+	InFlightOnly bool
+	// Timeout は、まとめたリクエストの送信とレスポンスボディの読み込みの最大の所要時間。デフォルトは 30 秒
+	// NOTE: 最初のリクエストのデッドライン (http.Client.Timeout を含む) の方が早い場合は、そのデッドラインを使用する
+	Timeout time.Duration
+	// MaxResponseBytes は、共有するためにバッファリングするレスポンスボディの最大バイト数。デフォルトは 1 MiB
+	// これより大きいレスポンスは共有せずに最初のリクエストに返却し、まとめた他のリクエストはそれぞれ送信する
+	MaxResponseBytes int64
+}
+
+// CoalescingTransport は、同じリソースへの同一の冪等な書き込みを 1 つのリクエストにまとめて送信するための http.RoundTripper 具象型
+// 送信中、または成功してから Window 以内に受け取った同一のリクエスト (メソッド、URL、ボディ、KeyHeaders が一致するもの) には、
+// 送信せずに同じレスポンスの複製を返却する
+// NOTE: 呼び出し元が同じ書き込みを繰り返す場合の、上流への書き込みの増幅を抑えるために使用する
+// RetryableTransport の外側に配置する。内側に配置すると、リトライの試行も同一のリクエストとしてまとめられる
+type CoalescingTransport struct {
+	wrapped http.RoundTripper
+	config  CoalescingConfig
+	methods map[string]bool
+
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+	// coalesced は送信せずにレスポンスを返却したリクエスト数
+	coalesced atomic.Int64
+}
+
+// coalescedCall は、まとめたリクエストの送信結果
+type coalescedCall struct {
+	done chan struct{}
+	res  *http.Response
+	body []byte
+	err  error
+
+	// unshared は、レスポンスボディが MaxResponseBytes を超えたために共有しないか
+	unshared bool
+
+	mu sync.Mutex
+	// stream は、共有しない場合に最初のリクエストに返却するレスポンス
+	stream *http.Response
+}
+
+// NewCoalescingTransport は CoalescingTransport 構造体を作成する
+func NewCoalescingTransport(transport http.RoundTripper, config CoalescingConfig) *CoalescingTransport {
+	if config.Window <= 0 {
+		config.Window = 100 * time.Millisecond
+	}
+	if len(config.Methods) == 0 {
+		config.Methods = []string{http.MethodPut}
+	}
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = 1 << 20
+	}
+	if len(config.KeyHeaders) == 0 {
+		config.KeyHeaders = []string{"Authorization", "Content-Type", "If-Match", "Idempotency-Key"}
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 30 * time.Second
+	}
+	if config.MaxResponseBytes <= 0 {
+		config.MaxResponseBytes = 1 << 20
+	}
+	methods := make(map[string]bool, len(config.Methods))
+	for _, m := range config.Methods {
+		methods[m] = true
+	}
+	return &CoalescingTransport{
+		wrapped: transport,
+		config:  config,
+		methods: methods,
+		calls:   make(map[string]*coalescedCall),
+	}
+}
+
+// Coalesced は、送信せずにまとめたリクエストのレスポンスを返却したリクエスト数を返却する
+func (t *CoalescingTransport) Coalesced() int64 {
+	return t.coalesced.Load()
+}
+
+// transport は親の Transport を返却する。親がない場合は、http.DefaultTransport を返却する
+func (t *CoalescingTransport) transport() http.RoundTripper {
+	if t.wrapped == nil {
+		return http.DefaultTransport
+	}
+	return t.wrapped
+}
+
+// RoundTrip は、同一のリクエストが送信中または直近に成功している場合はそのレスポンスの複製を返却し、それ以外の場合は送信する
+func (t *CoalescingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.methods[req.Method] {
+		return t.transport().RoundTrip(req)
+	}
+
+	req, body, ok, err := t.readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return t.transport().RoundTrip(req)
+	}
+	key := t.key(req, body)
+
+	t.mu.Lock()
+	call, merged := t.calls[key]
+	if !merged {
+		call = &coalescedCall{done: make(chan struct{})}
+		t.calls[key] = call
+	}
+	t.mu.Unlock()
+
+	if merged {
+		t.coalesced.Add(1)
+	} else {
+		go t.send(req, body, key, call)
+	}
+
+	select {
+	case <-req.Context().Done():
+		if !merged {
+			// NOTE: 共有しないレスポンスを受け取る呼び出し元がいなくなるため、送信の完了後にクローズする
+			go func() {
+				<-call.done
+				if stream := call.takeStream(); stream != nil {
+					_ = stream.Body.Close()
+				}
+			}()
+		}
+		return nil, req.Context().Err()
+	case <-call.done:
+	}
+	if call.unshared {
+		if !merged {
+			return call.leaderResponse(req), nil
+		}
+		t.coalesced.Add(-1)
+		return t.transport().RoundTrip(withBody(req, body))
+	}
+	return call.response(req)
+}
+
+// send はまとめたリクエストを送信し、レスポンスボディをバッファリングする
+// NOTE: 呼び出し元の 1 つがキャンセルしても他の呼び出し元の結果に影響しないように、キャンセルを引き継がない context.Context で送信する
+// 上流が応答しない場合に同一のリクエストが待ち続けないように、最初のリクエストのデッドラインと Timeout のうち早い方を上限とする
+func (t *CoalescingTransport) send(req *http.Request, body []byte, key string, call *coalescedCall) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), t.config.Timeout)
+	if deadline, ok := req.Context().Deadline(); ok {
+		ctx, cancel = withDeadline(ctx, cancel, deadline)
+	}
+	out := withBody(req.Clone(ctx), body)
+
+	res, err := t.transport().RoundTrip(out)
+	if err == nil {
+		// NOTE: 上限を超えたか判定するため、1 バイト多く読み込む
+		var buffered []byte
+		buffered, err = io.ReadAll(io.LimitReader(res.Body, t.config.MaxResponseBytes+1))
+		if err == nil && int64(len(buffered)) > t.config.MaxResponseBytes {
+			stream := *res
+			stream.Body = &restoredBody{
+				Reader: io.MultiReader(bytes.NewReader(buffered), res.Body),
+				Closer: closerFunc(func() error { defer cancel(); return res.Body.Close() }),
+			}
+			call.unshared, call.stream = true, &stream
+			// NOTE: 共有しないため、後続のリクエストがまとめられないように、完了を通知する前に破棄する
+			t.forget(key, call)
+			close(call.done)
+			return
+		}
+		_ = res.Body.Close()
+		call.body = buffered
+	}
+	cancel()
+	call.res, call.err = res, err
+	close(call.done)
+
+	// 失敗した結果はまとめず、次のリクエストは改めて送信する。成功した結果は Window の間だけ返却する
+	if err != nil || res.StatusCode >= http.StatusBadRequest || t.config.InFlightOnly {
+		t.forget(key, call)
+		return
+	}
+	time.AfterFunc(t.config.Window, func() {
+		t.forget(key, call)
+	})
+}
+
+// withDeadline は、ctx と deadline のうち早い方をデッドラインとする context.Context を返却する
+// 返却する関数は、ctx の cancel も呼び出す
+func withDeadline(ctx context.Context, cancel context.CancelFunc, deadline time.Time) (context.Context, context.CancelFunc) {
+	ctx, cancelDeadline := context.WithDeadline(ctx, deadline)
+	return ctx, func() {
+		cancelDeadline()
+		cancel()
+	}
+}
+
+// withBody は、ボディを body に置き換えたリクエストを返却する
+func withBody(req *http.Request, body []byte) *http.Request {
+	out := *req
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	out.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	if body == nil {
+		out.Body, out.GetBody = http.NoBody, nil
+	}
+	return &out
+}
+
+// forget はまとめたリクエストの送信結果を破棄する
+func (t *CoalescingTransport) forget(key string, call *coalescedCall) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.calls[key] == call {
+		delete(t.calls, key)
+	}
+}
+
+// readBody は、同一か判定するためにリクエストボディを読み込む
+// MaxBodyBytes を超える場合は、読み込んだ先頭を含めてボディを復元したリクエストと false を返却する
+func (t *CoalescingTransport) readBody(req *http.Request) (*http.Request, []byte, bool, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil, true, nil
+	}
+	// NOTE: 上限を超えたか判定するため、1 バイト多く読み込む
+	body, err := io.ReadAll(io.LimitReader(req.Body, t.config.MaxBodyBytes+1))
+	if err != nil {
+		_ = req.Body.Close()
+		return nil, nil, false, err
+	}
+	if int64(len(body)) > t.config.MaxBodyBytes {
+		// NOTE: http.RoundTripper はリクエストを変更してはいけないため、複製してからボディを置き換える
+		restored := *req
+		restored.Body = &restoredBody{Reader: io.MultiReader(bytes.NewReader(body), req.Body), Closer: req.Body}
+		return &restored, nil, false, nil
+	}
+	_ = req.Body.Close()
+	return req, body, true, nil
+}
+
+// restoredBody は、先頭を読み込んだ後のボディを復元した io.ReadCloser 具象型
+type restoredBody struct {
+	io.Reader
+	io.Closer
+}
+
+// closerFunc は関数を io.Closer として使用するための型
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+// key は、メソッド、URL、ボディ、KeyHeaders からリクエストを識別するキーを作成する
+func (t *CoalescingTransport) key(req *http.Request, body []byte) string {
+	var b strings.Builder
+	b.WriteString(req.Method)
+	b.WriteByte(' ')
+	b.WriteString(req.URL.String())
+	for _, h := range t.config.KeyHeaders {
+		b.WriteByte('\n')
+		b.WriteString(h)
+		b.WriteByte(':')
+		b.WriteString(strings.Join(req.Header.Values(h), ","))
+	}
+	sum := sha256.Sum256(body)
+	b.WriteByte('\n')
+	b.WriteString(hex.EncodeToString(sum[:]))
+	return b.String()
+}
+
+// takeStream は、共有しないレスポンスを返却する。2 回目以降は nil を返却する
+func (c *coalescedCall) takeStream() *http.Response {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stream := c.stream
+	c.stream = nil
+	return stream
+}
+
+// leaderResponse は、共有しないレスポンスを最初のリクエストの呼び出し元に返却する
+// NOTE: 送信はキャンセルを引き継いでいないため、呼び出し元がキャンセルした場合はボディの読み込みを中断する
+func (c *coalescedCall) leaderResponse(req *http.Request) *http.Response {
+	stream := c.takeStream()
+	stop := context.AfterFunc(req.Context(), func() { _ = stream.Body.Close() })
+	body := stream.Body
+	stream.Body = &restoredBody{Reader: body, Closer: closerFunc(func() error {
+		stop()
+		return body.Close()
+	})}
+	stream.Request = req
+	return stream
+}
+
+// response は、まとめたリクエストのレスポンスを呼び出し元ごとに複製して返却する
+func (c *coalescedCall) response(req *http.Request) (*http.Response, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	res := *c.res
+	res.Header = c.res.Header.Clone()
+	res.Body = io.NopCloser(bytes.NewReader(c.body))
+	res.Request = req
+	return &res, nil
+}
@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeUpstream は、受け取った PUT のボディを記録し、status のステータスコードを返却する上流の http.RoundTripper
+type writeUpstream struct {
+	mu     sync.Mutex
+	bodies []string
+	status int
+}
+
+func (u *writeUpstream) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, _ := io.ReadAll(req.Body)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.bodies = append(u.bodies, string(body))
+	status := u.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return &http.Response{StatusCode: status, Header: make(http.Header), Body: io.NopCloser(strings.NewReader("saved")), Request: req}, nil
+}
+
+func (u *writeUpstream) received() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]string(nil), u.bodies...)
+}
+
+// put は transport で PUT を送信し、ステータスコードとボディを返却する
+func put(t *testing.T, transport http.RoundTripper, body string, header http.Header) (int, string) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodPut, "http://example.com/items/1", strings.NewReader(body))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	defer res.Body.Close()
+	b, _ := io.ReadAll(res.Body)
+	return res.StatusCode, string(b)
+}
+
+func TestCoalescingTransportWindow(t *testing.T) {
+	upstream := &writeUpstream{}
+	transport := NewCoalescingTransport(upstream, CoalescingConfig{Window: time.Hour})
+
+	for i := 0; i < 3; i++ {
+		if code, body := put(t, transport, `{"name":"a"}`, nil); code != http.StatusOK || body != "saved" {
+			t.Errorf("request %d = %d %q, want 200 saved", i+1, code, body)
+		}
+	}
+	if got := upstream.received(); len(got) != 1 || got[0] != `{"name":"a"}` {
+		t.Errorf("upstream received %q, want a single write", got)
+	}
+	if got := transport.Coalesced(); got != 2 {
+		t.Errorf("Coalesced = %d, want 2", got)
+	}
+}
+
+func TestCoalescingTransportWindowExpires(t *testing.T) {
+	upstream := &writeUpstream{}
+	transport := NewCoalescingTransport(upstream, CoalescingConfig{Window: time.Millisecond})
+
+	put(t, transport, "a", nil)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(upstream.received()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("request after the window is not sent")
+		}
+		time.Sleep(5 * time.Millisecond)
+		put(t, transport, "a", nil)
+	}
+}
+
+// TestCoalescingTransportDistinctRequests は、ボディ、KeyHeaders、メソッドが異なるリクエストをまとめないことを検証する
+func TestCoalescingTransportDistinctRequests(t *testing.T) {
+	upstream := &writeUpstream{}
+	transport := NewCoalescingTransport(upstream, CoalescingConfig{Window: time.Hour, MaxBodyBytes: 8})
+
+	put(t, transport, "a", nil)
+	put(t, transport, "b", nil)
+	put(t, transport, "a", http.Header{"Idempotency-Key": {"k2"}})
+	// 同一か判定しないヘッダーは比較しない
+	put(t, transport, "a", http.Header{"X-Request-Id": {"r2"}})
+	// MaxBodyBytes を超えるリクエストはまとめず、ボディを復元して送信する
+	put(t, transport, "0123456789", nil)
+	put(t, transport, "0123456789", nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com/items/1", strings.NewReader("a"))
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	want := []string{"a", "b", "a", "0123456789", "0123456789", "a"}
+	if got := upstream.received(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("upstream received %q, want %q", got, want)
+	}
+}
+
+func TestCoalescingTransportDoesNotKeepFailures(t *testing.T) {
+	upstream := &writeUpstream{status: http.StatusServiceUnavailable}
+	transport := NewCoalescingTransport(upstream, CoalescingConfig{Window: time.Hour})
+
+	for i := 0; i < 2; i++ {
+		if code, _ := put(t, transport, "a", nil); code != http.StatusServiceUnavailable {
+			t.Errorf("request %d status = %d, want 503", i+1, code)
+		}
+	}
+	if got := len(upstream.received()); got != 2 {
+		t.Errorf("upstream writes = %d, want 2", got)
+	}
+}
+
+// TestCoalescingTransportLeaderCanceled は、最初のリクエストがキャンセルされても、まとめた他のリクエストがレスポンスを受け取ることを検証する
+func TestCoalescingTransportLeaderCanceled(t *testing.T) {
+	upstream := newBlockingUpstream("saved")
+	transport := NewCoalescingTransport(upstream, CoalescingConfig{Window: time.Hour})
+	newRequest := func(ctx context.Context) *http.Request {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPut, "http://example.com/items/1", strings.NewReader("a"))
+		return req
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() {
+		_, err := transport.RoundTrip(newRequest(ctx))
+		leader <- err
+	}()
+	for upstream.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	follower := make(chan string, 1)
+	go func() {
+		res, err := transport.RoundTrip(newRequest(context.Background()))
+		if err != nil {
+			follower <- err.Error()
+			return
+		}
+		defer res.Body.Close()
+		b, _ := io.ReadAll(res.Body)
+		follower <- string(b)
+	}()
+	waitCoalesced(t, transport, 1)
+
+	cancel()
+	if err := <-leader; !errors.Is(err, context.Canceled) {
+		t.Errorf("leader = %v, want context.Canceled", err)
+	}
+	close(upstream.release)
+	if got := <-follower; got != "saved" {
+		t.Errorf("follower = %q, want saved", got)
+	}
+	if got := upstream.calls.Load(); got != 1 {
+		t.Errorf("upstream calls = %d, want 1", got)
+	}
+}
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/baggage"
+)
+
+// headerBaggage は OpenTelemetry の baggage を伝播するヘッダー
+const headerBaggage = "Baggage"
+
+// HeaderLimitConfig は HeaderLimitTransport の設定。ゼロ値の項目はデフォルト値を使用する
+type HeaderLimitConfig struct {
+	// MaxHeaderBytes は、リクエストラインを含むリクエストヘッダー全体の最大バイト数。デフォルトは 16 KiB
+	// NOTE: 多くのロードバランサーやサーバーは 8 KiB から 16 KiB を上限とし、超えると 431 Request Header Fields Too Large を返却する
+	MaxHeaderBytes int
+	// MaxBaggageBytes は baggage ヘッダーの最大バイト数。デフォルトは W3C Baggage の上限の 8192 バイト
+	MaxBaggageBytes int
+	// MaxBaggageMembers は baggage ヘッダーのメンバーの最大数。デフォルトは W3C Baggage の上限の 180
+	MaxBaggageMembers int
+}
+
+// HeaderTooLargeError は、リクエストヘッダーが HeaderLimitConfig.MaxHeaderBytes を超えたため送信しなかったことを表すエラー
+// NOTE: 同じヘッダーで送信し直しても成功しないため、RetryableTransport はリトライしない
+type HeaderTooLargeError struct {
+	// Size はリクエストラインを含むリクエストヘッダー全体のバイト数
+	Size int
+	// Limit は HeaderLimitConfig.MaxHeaderBytes
+	Limit int
+}
+
+func (e *HeaderTooLargeError) Error() string {
+	return fmt.Sprintf("request header size %d bytes exceeds limit %d bytes", e.Size, e.Limit)
+}
+
+// Permanent は、リトライしても成功しないエラーであることを表す
+func (e *HeaderTooLargeError) Permanent() bool {
+	return true
+}
+
+// HeaderLimitTransport は、OpenTelemetry の baggage を伝播して上限まで切り詰め、リクエストヘッダー全体のサイズを検証するための http.RoundTripper 具象型
+// リクエストに baggage ヘッダーがない場合は、context.Context の baggage をヘッダーに設定する
+// ヘッダーが上限を超える場合は、送信せずに *HeaderTooLargeError を返却する
+// NOTE: RetryableTransport の内側に配置すると、リトライとリダイレクトのすべての試行で同じ検証を行い、
+// サーバーに 431 Request Header Fields Too Large で拒否されるリクエストを繰り返し送信しないようにする
+type HeaderLimitTransport struct {
+	wrapped http.RoundTripper
+	config  HeaderLimitConfig
+}
+
+// NewHeaderLimitTransport は HeaderLimitTransport 構造体を作成する
+func NewHeaderLimitTransport(transport http.RoundTripper, config HeaderLimitConfig) *HeaderLimitTransport {
+	if config.MaxHeaderBytes <= 0 {
+		config.MaxHeaderBytes = 16 << 10
+	}
+	if config.MaxBaggageBytes <= 0 {
+		config.MaxBaggageBytes = 8192
+	}
+	if config.MaxBaggageMembers <= 0 {
+		config.MaxBaggageMembers = 180
+	}
+	return &HeaderLimitTransport{
+		wrapped: transport,
+		config:  config,
+	}
+}
+
+// transport は親の Transport を返却する。親がない場合は、http.DefaultTransport を返却する
+func (t *HeaderLimitTransport) transport() http.RoundTripper {
+	if t.wrapped == nil {
+		return http.DefaultTransport
+	}
+	return t.wrapped
+}
+
+// RoundTrip は baggage を設定して切り詰め、リクエストヘッダーのサイズを検証してから送信する
+func (t *HeaderLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	current := strings.Join(req.Header.Values(headerBaggage), ",")
+	value := current
+	if value == "" {
+		value = baggage.FromContext(req.Context()).String()
+	}
+
+	out := req
+	if trimmed := trimBaggage(value, t.config.MaxBaggageBytes, t.config.MaxBaggageMembers); trimmed != current {
+		// NOTE: RoundTripper は呼び出し元のリクエストを変更してはならないため、複製してからヘッダーを変更する
+		out = req.Clone(req.Context())
+		out.Header.Del(headerBaggage)
+		if trimmed != "" {
+			out.Header.Set(headerBaggage, trimmed)
+		}
+	}
+
+	if size := headerSize(out); size > t.config.MaxHeaderBytes {
+		return nil, &HeaderTooLargeError{Size: size, Limit: t.config.MaxHeaderBytes}
+	}
+	return t.transport().RoundTrip(out)
+}
+
+// trimBaggage は、baggage のメンバーを先頭から順に、maxBytes と maxMembers を超えない範囲で残した値を返却する
+// NOTE: 空のメンバーは取り除く。上限を超えるメンバー以降は、後続の短いメンバーも含めて取り除き、伝播する順序を保つ
+func trimBaggage(value string, maxBytes int, maxMembers int) string {
+	if value == "" {
+		return ""
+	}
+	var b strings.Builder
+	members := 0
+	for _, member := range strings.Split(value, ",") {
+		if member = strings.TrimSpace(member); member == "" {
+			continue
+		}
+		size := len(member)
+		if members > 0 {
+			size++
+		}
+		if members >= maxMembers || b.Len()+size > maxBytes {
+			break
+		}
+		if members > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(member)
+		members++
+	}
+	return b.String()
+}
+
+// headerSize は、HTTP/1.1 で送信する場合のリクエストラインと Host ヘッダーを含むリクエストヘッダー全体のバイト数を返却する
+func headerSize(req *http.Request) int {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	// NOTE: "METHOD URI HTTP/1.1\r\n" と "Host: host\r\n"
+	size := len(req.Method) + 1 + len(req.URL.RequestURI()) + len(" HTTP/1.1\r\n") + len("Host: \r\n") + len(host)
+	for key, values := range req.Header {
+		for _, value := range values {
+			size += len(key) + len(": \r\n") + len(value)
+		}
+	}
+	return size
+}
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/baggage"
+)
+
+func TestTrimBaggage(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      string
+		maxBytes   int
+		maxMembers int
+		want       string
+	}{
+		{"empty", "", 100, 10, ""},
+		{"within limits", "a=1,b=2", 100, 10, "a=1,b=2"},
+		{"drops empty members", "a=1, ,b=2,", 100, 10, "a=1,b=2"},
+		{"max members", "a=1,b=2,c=3", 100, 2, "a=1,b=2"},
+		{"max bytes counts separators", "a=1,b=2,c=3", 7, 10, "a=1,b=2"},
+		// 上限を超えたメンバー以降は、短いメンバーも伝播しない
+		{"keeps order", "a=1,long=123456,c=3", 10, 10, "a=1"},
+		{"first member too large", "long=123456", 5, 10, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := trimBaggage(tt.value, tt.maxBytes, tt.maxMembers); got != tt.want {
+				t.Errorf("trimBaggage(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// sentBaggage は、transport で req を送信した際に上流が受け取った baggage ヘッダーを返却する
+func sentBaggage(t *testing.T, config HeaderLimitConfig, req *http.Request) string {
+	t.Helper()
+
+	var got string
+	transport := NewHeaderLimitTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		got = r.Header.Get(headerBaggage)
+		return textResponse(r, ""), nil
+	}), config)
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	res.Body.Close()
+	return got
+}
+
+func TestHeaderLimitTransportBaggage(t *testing.T) {
+	t.Run("from context", func(t *testing.T) {
+		member, _ := baggage.NewMember("tenant", "acme")
+		bag, _ := baggage.New(member)
+		req, _ := http.NewRequestWithContext(baggage.ContextWithBaggage(context.Background(), bag), http.MethodGet, "http://example.com/", nil)
+
+		if got := sentBaggage(t, HeaderLimitConfig{}, req); got != "tenant=acme" {
+			t.Errorf("baggage = %q, want tenant=acme", got)
+		}
+	})
+
+	t.Run("header takes precedence and is trimmed", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+		req.Header.Add(headerBaggage, "a=1,b=2")
+		req.Header.Add(headerBaggage, "c=3")
+
+		if got := sentBaggage(t, HeaderLimitConfig{MaxBaggageMembers: 2}, req); got != "a=1,b=2" {
+			t.Errorf("baggage = %q, want a=1,b=2", got)
+		}
+		// NOTE: 呼び出し元のリクエストは変更しない
+		if got := req.Header.Values(headerBaggage); len(got) != 2 {
+			t.Errorf("caller baggage = %q, want unchanged", got)
+		}
+	})
+}
+
+func TestHeaderLimitTransportTooLarge(t *testing.T) {
+	var calls int
+	transport := NewHeaderLimitTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		calls++
+		return textResponse(r, ""), nil
+	}), HeaderLimitConfig{MaxHeaderBytes: 256})
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req.Header.Set("Cookie", strings.Repeat("x", 256))
+	_, err := transport.RoundTrip(req)
+
+	var tooLarge *HeaderTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("err = %v, want *HeaderTooLargeError", err)
+	}
+	if tooLarge.Limit != 256 || tooLarge.Size != headerSize(req) || !tooLarge.Permanent() {
+		t.Errorf("err = %+v, want size %d and limit 256", tooLarge, headerSize(req))
+	}
+	if calls != 0 {
+		t.Errorf("upstream calls = %d, want 0", calls)
+	}
+}
+
+func TestHeaderSize(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/a?b=c", nil)
+	req.Header.Set("X-Id", "1")
+
+	// "GET /a?b=c HTTP/1.1\r\n" + "Host: example.com\r\n" + "X-Id: 1\r\n"
+	want := len("GET /a?b=c HTTP/1.1\r\n") + len("Host: example.com\r\n") + len("X-Id: 1\r\n")
+	if got := headerSize(req); got != want {
+		t.Errorf("headerSize = %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// HeaderMethodOverride は元の HTTP メソッドを格納するヘッダー
+const HeaderMethodOverride = "X-HTTP-Method-Override"
+
+// MethodOverrideTransport は、PUT, PATCH, DELETE などを POST に変換し、元のメソッドを X-HTTP-Method-Override ヘッダーで送信するための
+// http.RoundTripper 具象型。これらのメソッドをブロックするプロキシがある環境で使用する
+// NOTE: RetryableTransport の内側に配置することで、リトライの判定 (冪等性など) は元のメソッドで行い、すべての試行で同じ変換を行う
+type MethodOverrideTransport struct {
+	wrapped http.RoundTripper
+	methods map[string]bool
+}
+
+// NewMethodOverrideTransport は MethodOverrideTransport 構造体を作成する
+// methods を省略した場合は PUT, PATCH, DELETE を変換する
+func NewMethodOverrideTransport(transport http.RoundTripper, methods ...string) *MethodOverrideTransport {
+	if len(methods) == 0 {
+		methods = []string{http.MethodPut, http.MethodPatch, http.MethodDelete}
+	}
+	overridden := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		overridden[m] = true
+	}
+	return &MethodOverrideTransport{
+		wrapped: transport,
+		methods: overridden,
+	}
+}
+
+// transport は親の Transport を返却する。親がない場合は、http.DefaultTransport を返却する
+func (t *MethodOverrideTransport) transport() http.RoundTripper {
+	if t.wrapped == nil {
+		return http.DefaultTransport
+	}
+	return t.wrapped
+}
+
+// RoundTrip は対象のメソッドを POST に変換して送信する
+func (t *MethodOverrideTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.methods[req.Method] {
+		return t.transport().RoundTrip(req)
+	}
+
+	overridden := req.Clone(req.Context())
+	overridden.Method = http.MethodPost
+	overridden.Header.Set(HeaderMethodOverride, req.Method)
+	return t.transport().RoundTrip(overridden)
+}
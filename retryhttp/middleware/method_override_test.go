@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMethodOverrideTransport(t *testing.T) {
+	tests := []struct {
+		name         string
+		methods      []string
+		method       string
+		wantMethod   string
+		wantOverride string
+	}{
+		{"default PUT", nil, http.MethodPut, http.MethodPost, http.MethodPut},
+		{"default PATCH", nil, http.MethodPatch, http.MethodPost, http.MethodPatch},
+		{"default DELETE", nil, http.MethodDelete, http.MethodPost, http.MethodDelete},
+		{"default GET", nil, http.MethodGet, http.MethodGet, ""},
+		{"custom methods", []string{http.MethodDelete}, http.MethodPut, http.MethodPut, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent *http.Request
+			transport := NewMethodOverrideTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+				sent = r
+				return textResponse(r, ""), nil
+			}), tt.methods...)
+
+			req, _ := http.NewRequest(tt.method, "http://example.com/items/1", nil)
+			res, err := transport.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("RoundTrip: %v", err)
+			}
+			res.Body.Close()
+
+			if sent.Method != tt.wantMethod || sent.Header.Get(HeaderMethodOverride) != tt.wantOverride {
+				t.Errorf("sent %s with override %q, want %s with %q",
+					sent.Method, sent.Header.Get(HeaderMethodOverride), tt.wantMethod, tt.wantOverride)
+			}
+			// NOTE: 呼び出し元のリクエストは変更しない
+			if req.Method != tt.method || req.Header.Get(HeaderMethodOverride) != "" {
+				t.Errorf("caller request changed to %s %v", req.Method, req.Header)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OTPGenerator は、now の時刻に有効なワンタイムパスワードや期限付きのトークンを生成する関数の型定義
+type OTPGenerator func(ctx context.Context, now time.Time) (string, error)
+
+// TOTPConfig は RFC 6238 の TOTP (時間ベースのワンタイムパスワード) の設定
+// ゼロ値の項目はデフォルト値を使用する
+type TOTPConfig struct {
+	// Secret は共有鍵。Base32 でエンコードされた鍵は ParseTOTPSecret でデコードする
+	Secret []byte
+	// Period はパスワードが切り替わる間隔。秒単位で指定する。デフォルトは 30 秒
+	Period time.Duration
+	// Digits はパスワードの桁数。デフォルトは 6
+	Digits int
+	// Hash は HMAC のハッシュ関数。デフォルトは SHA-1
+	Hash func() hash.Hash
+}
+
+// TOTP は、config の設定で TOTP を生成する OTPGenerator を返却する
+func TOTP(config TOTPConfig) OTPGenerator {
+	if config.Period < time.Second {
+		config.Period = 30 * time.Second
+	}
+	if config.Digits <= 0 {
+		config.Digits = 6
+	}
+	if config.Hash == nil {
+		config.Hash = sha1.New
+	}
+	return func(_ context.Context, now time.Time) (string, error) {
+		counter := uint64(now.Unix() / int64(config.Period.Seconds()))
+		return hotp(config, counter), nil
+	}
+}
+
+// hotp は RFC 4226 の HOTP で counter のパスワードを生成する
+func hotp(config TOTPConfig, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(config.Hash, config.Secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// 動的切り捨て: 末尾の 4 ビットが示す位置から 31 ビットを取り出す
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < config.Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", config.Digits, code%mod)
+}
+
+// ParseTOTPSecret は、認証アプリに登録する形式の Base32 の共有鍵をデコードする
+// 空白やパディングの有無、大文字と小文字の違いは無視する
+func ParseTOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.Join(strings.Fields(secret), ""))
+	return base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+}
+
+// OTPTransport は、試行ごとに新しいワンタイムパスワードを生成してヘッダーに付与する http.RoundTripper 具象型
+// NOTE: リトライした試行で期限切れのパスワードを送信すると必ず失敗するため、RetryableTransport の内側に配置して試行ごとに生成する
+type OTPTransport struct {
+	wrapped  http.RoundTripper
+	header   string
+	generate OTPGenerator
+	now      func() time.Time
+}
+
+// NewOTPTransport は OTPTransport 構造体を作成する
+// header はパスワードを付与するヘッダー名 (例: "X-OTP")。generate には TOTP や、期限付きのトークンを取得する関数を指定する
+func NewOTPTransport(transport http.RoundTripper, header string, generate OTPGenerator) *OTPTransport {
+	return &OTPTransport{
+		wrapped:  transport,
+		header:   header,
+		generate: generate,
+		now:      time.Now,
+	}
+}
+
+// transport は親の Transport を返却する。親がない場合は、http.DefaultTransport を返却する
+func (t *OTPTransport) transport() http.RoundTripper {
+	if t.wrapped == nil {
+		return http.DefaultTransport
+	}
+	return t.wrapped
+}
+
+// RoundTrip は、ワンタイムパスワードを生成してヘッダーに付与し、リクエストを送信する
+// パスワードの生成に失敗した場合は、リクエストを送信せずにエラーを返却する
+func (t *OTPTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	code, err := t.generate(req.Context(), t.now())
+	if err != nil {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, fmt.Errorf("generate one-time password: %w", err)
+	}
+
+	// NOTE: http.RoundTripper は引数のリクエストを変更してはいけないため、複製してからヘッダーを設定する
+	withCode := req.Clone(req.Context())
+	withCode.Header.Set(t.header, code)
+	return t.transport().RoundTrip(withCode)
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTOTP は RFC 6238 の付録 B のテストベクターで TOTP を検証する
+func TestTOTP(t *testing.T) {
+	sha1Secret := []byte("12345678901234567890")
+	sha256Secret := []byte("12345678901234567890123456789012")
+	tests := []struct {
+		config TOTPConfig
+		unix   int64
+		want   string
+	}{
+		{TOTPConfig{Secret: sha1Secret, Digits: 8}, 59, "94287082"},
+		{TOTPConfig{Secret: sha1Secret, Digits: 8}, 1111111109, "07081804"},
+		{TOTPConfig{Secret: sha1Secret, Digits: 8}, 1234567890, "89005924"},
+		{TOTPConfig{Secret: sha1Secret, Digits: 8}, 2000000000, "69279037"},
+		{TOTPConfig{Secret: sha256Secret, Digits: 8, Hash: sha256.New}, 59, "46119246"},
+		// デフォルトの 6 桁は 8 桁の下位 6 桁になる
+		{TOTPConfig{Secret: sha1Secret}, 59, "287082"},
+	}
+	for _, tt := range tests {
+		got, err := TOTP(tt.config)(context.Background(), time.Unix(tt.unix, 0))
+		if err != nil || got != tt.want {
+			t.Errorf("TOTP at %d = %q, %v, want %q", tt.unix, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseTOTPSecret(t *testing.T) {
+	for _, secret := range []string{
+		"GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		"gezd gnbv gy3t qojq gezd gnbv gy3t qojq",
+		"GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ====",
+	} {
+		got, err := ParseTOTPSecret(secret)
+		if err != nil || string(got) != "12345678901234567890" {
+			t.Errorf("ParseTOTPSecret(%q) = %q, %v", secret, got, err)
+		}
+	}
+	if _, err := ParseTOTPSecret("not base32!"); err == nil {
+		t.Error("ParseTOTPSecret accepted an invalid secret")
+	}
+}
+
+func TestOTPTransport(t *testing.T) {
+	var sent []string
+	upstream := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		sent = append(sent, r.Header.Get("X-OTP"))
+		return textResponse(r, ""), nil
+	})
+	transport := NewOTPTransport(upstream, "X-OTP", TOTP(TOTPConfig{Secret: []byte("12345678901234567890"), Digits: 8}))
+	// NOTE: 試行ごとに時刻を進め、リトライした試行で新しいパスワードを生成することを検証する
+	now := time.Unix(59, 0)
+	transport.now = func() time.Time { return now }
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	for _, unix := range []int64{59, 1111111109} {
+		now = time.Unix(unix, 0)
+		res, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip: %v", err)
+		}
+		res.Body.Close()
+	}
+	if want := []string{"94287082", "07081804"}; strings.Join(sent, ",") != strings.Join(want, ",") {
+		t.Errorf("sent codes %q, want %q", sent, want)
+	}
+	if req.Header.Get("X-OTP") != "" {
+		t.Error("caller request changed")
+	}
+}
+
+// closeTracker は Close が呼び出されたか記録するリクエストボディ
+type closeTracker struct {
+	io.Reader
+	closed bool
+}
+
+func (b *closeTracker) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestOTPTransportGenerateError(t *testing.T) {
+	errGenerate := errors.New("token endpoint unavailable")
+	transport := NewOTPTransport(roundTripFunc(func(*http.Request) (*http.Response, error) {
+		t.Fatal("request was sent without a one-time password")
+		return nil, nil
+	}), "X-OTP", func(context.Context, time.Time) (string, error) {
+		return "", errGenerate
+	})
+
+	body := &closeTracker{Reader: strings.NewReader("payload")}
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com/", body)
+	if _, err := transport.RoundTrip(req); !errors.Is(err, errGenerate) {
+		t.Errorf("err = %v, want %v", err, errGenerate)
+	}
+	if !body.closed {
+		t.Error("request body was not closed")
+	}
+}
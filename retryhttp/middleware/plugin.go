@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Plugin は、外部のパッケージが提供する、設定ファイルから名前で使用できる Middleware のインターフェース
+// NOTE: このパッケージが外部のパッケージを import せずに使用できるように、外部のパッケージの init で RegisterPlugin に登録する
+type Plugin interface {
+	// Name は設定ファイルで指定する名前
+	Name() string
+	// Init は設定ファイルの config を検証して読み込む。config は設定ファイルで指定しなかった場合は nil
+	// NOTE: 設定の検証と Client の作成でそれぞれ呼び出されるため、外部の状態を変更しない
+	Init(config map[string]any) error
+	// Wrap は next をラップした http.RoundTripper を返却する
+	Wrap(next http.RoundTripper) http.RoundTripper
+}
+
+// PluginRegistry は、名前で Plugin を作成するための登録先
+type PluginRegistry struct {
+	mu      sync.RWMutex
+	plugins map[string]func() Plugin
+}
+
+// DefaultPluginRegistry はパッケージ全体で共有する PluginRegistry。retryhttp.LoadConfig の設定ファイルは DefaultPluginRegistry を使用する
+var DefaultPluginRegistry = NewPluginRegistry()
+
+// NewPluginRegistry は PluginRegistry 構造体を作成する
+func NewPluginRegistry() *PluginRegistry {
+	return &PluginRegistry{plugins: make(map[string]func() Plugin)}
+}
+
+// Register は newPlugin が作成する Plugin を、Plugin の Name で登録する。同じ名前の Plugin が登録済みの場合はエラーを返却する
+// NOTE: 設定ごとに Init を呼び出すため、Plugin ではなく Plugin を作成する関数を登録する
+func (r *PluginRegistry) Register(newPlugin func() Plugin) error {
+	name := newPlugin().Name()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.plugins[name]; ok {
+		return fmt.Errorf("middleware plugin %q is already registered", name)
+	}
+	r.plugins[name] = newPlugin
+	return nil
+}
+
+// New は、name の Plugin を作成して config で初期化し、Middleware を返却する。登録されていない場合はエラーを返却する
+func (r *PluginRegistry) New(name string, config map[string]any) (Middleware, error) {
+	r.mu.RLock()
+	newPlugin, ok := r.plugins[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown middleware plugin: %q", name)
+	}
+
+	p := newPlugin()
+	if err := p.Init(config); err != nil {
+		return nil, fmt.Errorf("middleware plugin %q: %w", name, err)
+	}
+	return p.Wrap, nil
+}
+
+// Names は登録されている Plugin の名前を昇順で返却する
+func (r *PluginRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.plugins))
+	for name := range r.plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RegisterPlugin は DefaultPluginRegistry に Plugin を登録する
+func RegisterPlugin(newPlugin func() Plugin) error {
+	return DefaultPluginRegistry.Register(newPlugin)
+}
+
+// MustRegisterPlugin は DefaultPluginRegistry に Plugin を登録し、同じ名前の Plugin が登録済みの場合はパニックする
+// 例: func init() { middleware.MustRegisterPlugin(func() middleware.Plugin { return &myPlugin{} }) }
+func MustRegisterPlugin(newPlugin func() Plugin) {
+	if err := RegisterPlugin(newPlugin); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// errHeaderValue は headerPlugin の設定の value が文字列でないことを表すエラー
+var errHeaderValue = errors.New("value must be a string")
+
+// headerPlugin は、設定の value を X-Plugin ヘッダーに付与する Plugin
+type headerPlugin struct {
+	name  string
+	value string
+}
+
+func (p *headerPlugin) Name() string { return p.name }
+
+func (p *headerPlugin) Init(config map[string]any) error {
+	value, ok := config["value"].(string)
+	if !ok {
+		return errHeaderValue
+	}
+	p.value = value
+	return nil
+}
+
+func (p *headerPlugin) Wrap(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		req = req.Clone(req.Context())
+		req.Header.Set("X-Plugin", p.value)
+		return next.RoundTrip(req)
+	})
+}
+
+// newHeaderPlugin は name の headerPlugin を作成する関数を返却する
+func newHeaderPlugin(name string) func() Plugin {
+	return func() Plugin { return &headerPlugin{name: name} }
+}
+
+func TestPluginRegistryRegister(t *testing.T) {
+	registry := NewPluginRegistry()
+	for _, name := range []string{"b", "a"} {
+		if err := registry.Register(newHeaderPlugin(name)); err != nil {
+			t.Fatalf("Register(%q): %v", name, err)
+		}
+	}
+	if err := registry.Register(newHeaderPlugin("a")); err == nil {
+		t.Error("Register accepted a duplicate name")
+	}
+	if got := strings.Join(registry.Names(), ","); got != "a,b" {
+		t.Errorf("Names = %s, want a,b", got)
+	}
+}
+
+func TestPluginRegistryNew(t *testing.T) {
+	registry := NewPluginRegistry()
+	if err := registry.Register(newHeaderPlugin("header")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := registry.New("missing", nil); err == nil || !strings.Contains(err.Error(), "unknown middleware plugin") {
+		t.Errorf("New(missing) err = %v, want unknown plugin", err)
+	}
+	if _, err := registry.New("header", map[string]any{"value": 1}); !errors.Is(err, errHeaderValue) {
+		t.Errorf("New with invalid config err = %v, want %v", err, errHeaderValue)
+	}
+
+	// NOTE: 設定ごとに Plugin を作成するため、同じ名前の Plugin を異なる設定で使用できる
+	first, err := registry.New("header", map[string]any{"value": "one"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := registry.New("header", map[string]any{"value": "two"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		mw   Middleware
+		want string
+	}{{first, "one"}, {second, "two"}} {
+		var got string
+		transport := tt.mw(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			got = r.Header.Get("X-Plugin")
+			return textResponse(r, ""), nil
+		}))
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+		res, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if got != tt.want {
+			t.Errorf("X-Plugin = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// singleflightKeyHeaders は、NewSingleflightTransport が同一のリクエストか判定するために常に比較するヘッダー
+// NOTE: 認証情報やコンテンツネゴシエーションが異なるリクエストに、他の呼び出し元のレスポンスを返却しないようにする
+var singleflightKeyHeaders = []string{"Authorization", "Cookie", "Accept", "Accept-Encoding", "Accept-Language"}
+
+// NewSingleflightTransport は、送信中の同一の GET と HEAD を 1 つのリクエストにまとめる CoalescingTransport 構造体を作成する
+// メソッド、URL、認証情報、Accept 系のヘッダー、varyHeaders が一致するリクエストは、送信中のリクエストのレスポンスをバッファリングして共有する
+// NOTE: リトライが続いている間に、呼び出し元のポーリングなどで同一の GET が増幅されることを防ぐ
+// レスポンスの Vary ヘッダーで指定されるヘッダーのうち、Accept 系以外のものを varyHeaders に指定する
+func NewSingleflightTransport(transport http.RoundTripper, varyHeaders ...string) *CoalescingTransport {
+	return NewCoalescingTransport(transport, CoalescingConfig{
+		Methods:      []string{http.MethodGet, http.MethodHead},
+		KeyHeaders:   append(append([]string(nil), singleflightKeyHeaders...), varyHeaders...),
+		InFlightOnly: true,
+	})
+}
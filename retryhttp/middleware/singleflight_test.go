@@ -0,0 +1,324 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// roundTripFunc は関数を http.RoundTripper として使用するための型
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// textResponse は body をボディに持つ 200 のレスポンスを作成する
+func textResponse(req *http.Request, body string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/plain"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}
+}
+
+// blockingUpstream は release をクローズするまでレスポンスを返却しない上流の http.RoundTripper
+type blockingUpstream struct {
+	release chan struct{}
+	body    string
+	calls   atomic.Int64
+}
+
+func newBlockingUpstream(body string) *blockingUpstream {
+	return &blockingUpstream{release: make(chan struct{}), body: body}
+}
+
+func (u *blockingUpstream) RoundTrip(req *http.Request) (*http.Response, error) {
+	u.calls.Add(1)
+	select {
+	case <-u.release:
+		return textResponse(req, u.body), nil
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+}
+
+// waitCoalesced は、まとめられたリクエストが n になるまで待機する
+func waitCoalesced(t *testing.T, transport *CoalescingTransport, n int64) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for transport.Coalesced() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("coalesced = %d, want %d", transport.Coalesced(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// getAll は transport で GET を n 件並行して送信し、それぞれのボディとエラーを返却する
+func getAll(transport http.RoundTripper, n int, newRequest func() *http.Request) ([]string, []error) {
+	bodies, errs := make([]string, n), make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res, err := transport.RoundTrip(newRequest())
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer res.Body.Close()
+			b, err := io.ReadAll(res.Body)
+			bodies[i], errs[i] = string(b), err
+		}(i)
+	}
+	wg.Wait()
+	return bodies, errs
+}
+
+func TestSingleflightCollapsesInFlightGets(t *testing.T) {
+	upstream := newBlockingUpstream("shared")
+	transport := NewSingleflightTransport(upstream)
+
+	done := make(chan struct{})
+	var bodies []string
+	var errs []error
+	go func() {
+		defer close(done)
+		bodies, errs = getAll(transport, 5, func() *http.Request {
+			req, _ := http.NewRequest(http.MethodGet, "http://example.com/items", nil)
+			return req
+		})
+	}()
+	waitCoalesced(t, transport, 4)
+	close(upstream.release)
+	<-done
+
+	for i := range bodies {
+		if errs[i] != nil || bodies[i] != "shared" {
+			t.Errorf("request %d = %q, %v, want %q", i+1, bodies[i], errs[i], "shared")
+		}
+	}
+	if got := upstream.calls.Load(); got != 1 {
+		t.Errorf("upstream calls = %d, want 1", got)
+	}
+
+	// NOTE: InFlightOnly のため、完了した後のリクエストは改めて送信する
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/items", nil)
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if got := upstream.calls.Load(); got != 2 {
+		t.Errorf("upstream calls after completion = %d, want 2", got)
+	}
+}
+
+func TestSingleflightKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		header http.Header
+		vary   []string
+		// wantCalls は 2 つのリクエストで上流に送信されるべきリクエスト数
+		wantCalls int64
+	}{
+		{"same request", http.MethodGet, nil, nil, 1},
+		{"HEAD", http.MethodHead, nil, nil, 1},
+		{"POST is not collapsed", http.MethodPost, nil, nil, 2},
+		{"different Authorization", http.MethodGet, http.Header{"Authorization": {"Bearer b"}}, nil, 2},
+		{"different Accept-Language", http.MethodGet, http.Header{"Accept-Language": {"en"}}, nil, 2},
+		{"different vary header", http.MethodGet, http.Header{"X-Tenant": {"b"}}, []string{"X-Tenant"}, 2},
+		{"header not in the key", http.MethodGet, http.Header{"X-Tenant": {"b"}}, nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int64
+			release := make(chan struct{})
+			upstream := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				calls.Add(1)
+				<-release
+				return textResponse(req, "ok"), nil
+			})
+			transport := NewSingleflightTransport(upstream, tt.vary...)
+
+			var wg sync.WaitGroup
+			for i, header := range []http.Header{{"Authorization": {"Bearer a"}, "Accept-Language": {"ja"}, "X-Tenant": {"a"}}, tt.header} {
+				wg.Add(1)
+				req, _ := http.NewRequest(tt.method, "http://example.com/items", nil)
+				req.Header = http.Header{"Authorization": {"Bearer a"}, "Accept-Language": {"ja"}, "X-Tenant": {"a"}}
+				for k, v := range header {
+					req.Header[k] = v
+				}
+				go func() {
+					defer wg.Done()
+					if res, err := transport.RoundTrip(req); err == nil {
+						res.Body.Close()
+					}
+				}()
+				if i == 0 {
+					// 1 件目が送信を開始してから 2 件目を送信する
+					for calls.Load() == 0 {
+						time.Sleep(time.Millisecond)
+					}
+				}
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for calls.Load()+transport.Coalesced() < 2 && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			close(release)
+			wg.Wait()
+
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("upstream calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// TestSingleflightHungUpstreamUsesLeaderDeadline は、上流が応答しない場合に最初のリクエストのデッドラインで共有する送信を打ち切り、
+// 後続のリクエストが待ち続けないことを検証する
+func TestSingleflightHungUpstreamUsesLeaderDeadline(t *testing.T) {
+	upstream := newBlockingUpstream("late")
+	transport := NewSingleflightTransport(upstream)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com/hung", nil)
+	if _, err := transport.RoundTrip(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+
+	// 共有していた送信が打ち切られた後は、同一のリクエストを改めて送信する
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		transport.mu.Lock()
+		pending := len(transport.calls)
+		transport.mu.Unlock()
+		if pending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the hung call is still shared after the leader's deadline")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(upstream.release)
+	req, _ = http.NewRequest(http.MethodGet, "http://example.com/hung", nil)
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip after the hung call: %v", err)
+	}
+	res.Body.Close()
+	if got := upstream.calls.Load(); got != 2 {
+		t.Errorf("upstream calls = %d, want 2", got)
+	}
+}
+
+// TestCoalescingTimeout は、デッドラインのない呼び出し元でも Timeout で共有する送信を打ち切ることを検証する
+func TestCoalescingTimeout(t *testing.T) {
+	upstream := newBlockingUpstream("late")
+	transport := NewCoalescingTransport(upstream, CoalescingConfig{
+		Methods:      []string{http.MethodGet},
+		InFlightOnly: true,
+		Timeout:      50 * time.Millisecond,
+	})
+
+	done := make(chan struct{})
+	var errs []error
+	go func() {
+		defer close(done)
+		_, errs = getAll(transport, 3, func() *http.Request {
+			req, _ := http.NewRequest(http.MethodGet, "http://example.com/hung", nil)
+			return req
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("requests are still waiting for the hung upstream")
+	}
+	for i, err := range errs {
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("request %d err = %v, want context.DeadlineExceeded", i+1, err)
+		}
+	}
+}
+
+// TestSingleflightLargeResponseIsNotShared は、MaxResponseBytes を超えるレスポンスを最初のリクエストにのみ返却し、
+// まとめた他のリクエストはそれぞれ送信することを検証する
+func TestSingleflightLargeResponseIsNotShared(t *testing.T) {
+	large := strings.Repeat("x", 64)
+	upstream := newBlockingUpstream(large)
+	transport := NewCoalescingTransport(upstream, CoalescingConfig{
+		Methods:          []string{http.MethodGet},
+		InFlightOnly:     true,
+		MaxResponseBytes: 16,
+	})
+
+	done := make(chan struct{})
+	var bodies []string
+	var errs []error
+	go func() {
+		defer close(done)
+		bodies, errs = getAll(transport, 3, func() *http.Request {
+			req, _ := http.NewRequest(http.MethodGet, "http://example.com/large", nil)
+			return req
+		})
+	}()
+	waitCoalesced(t, transport, 2)
+	close(upstream.release)
+	<-done
+
+	for i := range bodies {
+		if errs[i] != nil || bodies[i] != large {
+			t.Errorf("request %d = %d bytes, %v, want %d bytes", i+1, len(bodies[i]), errs[i], len(large))
+		}
+	}
+	if got := upstream.calls.Load(); got != 3 {
+		t.Errorf("upstream calls = %d, want 3", got)
+	}
+	if got := transport.Coalesced(); got != 0 {
+		t.Errorf("coalesced = %d, want 0", got)
+	}
+}
+
+// TestSingleflightSmallResponseIsShared は、MaxResponseBytes ちょうどのレスポンスは共有することを検証する
+func TestSingleflightSmallResponseIsShared(t *testing.T) {
+	body := strings.Repeat("x", 16)
+	upstream := newBlockingUpstream(body)
+	transport := NewCoalescingTransport(upstream, CoalescingConfig{
+		Methods:          []string{http.MethodGet},
+		InFlightOnly:     true,
+		MaxResponseBytes: 16,
+	})
+
+	done := make(chan struct{})
+	var bodies []string
+	go func() {
+		defer close(done)
+		bodies, _ = getAll(transport, 2, func() *http.Request {
+			req, _ := http.NewRequest(http.MethodGet, "http://example.com/small", nil)
+			return req
+		})
+	}()
+	waitCoalesced(t, transport, 1)
+	close(upstream.release)
+	<-done
+
+	if bodies[0] != body || bodies[1] != body {
+		t.Errorf("bodies = %q, want %q twice", bodies, body)
+	}
+	if got := upstream.calls.Load(); got != 1 {
+		t.Errorf("upstream calls = %d, want 1", got)
+	}
+}
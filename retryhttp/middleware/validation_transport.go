@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// Violation はリクエストが満たしていない制約
+type Violation struct {
+	// Path は制約を満たしていない項目の位置 (JSON Pointer など)。リクエスト全体の場合は空文字列
+	Path    string
+	Message string
+}
+
+// Validator はリクエストを検証するインターフェース
+// JSON Schema や protobuf のバリデーターは、このインターフェースを実装して登録する
+type Validator interface {
+	// Validate はリクエストとリクエストボディを検証し、満たしていない制約を返却する
+	// 検証自体が行えなかった場合はエラーを返却する
+	Validate(req *http.Request, body []byte) ([]Violation, error)
+}
+
+// ValidatorFunc は関数を Validator として使用するための型定義
+type ValidatorFunc func(req *http.Request, body []byte) ([]Violation, error)
+
+func (f ValidatorFunc) Validate(req *http.Request, body []byte) ([]Violation, error) {
+	return f(req, body)
+}
+
+// JSONValidator はリクエストボディを T にデコードしてから validate で検証する Validator を返却する
+// デコードできない場合は、リクエスト全体の制約違反とする
+func JSONValidator[T any](validate func(v T) []Violation) Validator {
+	return ValidatorFunc(func(req *http.Request, body []byte) ([]Violation, error) {
+		var v T
+		if err := json.Unmarshal(body, &v); err != nil {
+			return []Violation{{Message: fmt.Sprintf("invalid JSON: %v", err)}}, nil
+		}
+		return validate(v), nil
+	})
+}
+
+// ValidationError は、リクエストが検証に失敗したため送信しなかったことを表すエラー
+type ValidationError struct {
+	Method     string
+	Route      string
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	details := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		if v.Path == "" {
+			details = append(details, v.Message)
+			continue
+		}
+		details = append(details, v.Path+": "+v.Message)
+	}
+	return fmt.Sprintf("request validation failed for %s %s: %s", e.Method, e.Route, strings.Join(details, "; "))
+}
+
+// ValidationTransport は、登録したバリデーターでリクエストを検証し、制約を満たさないリクエストを送信せずに失敗させるための
+// http.RoundTripper 具象型
+// NOTE: サーバーが必ず 400 で拒否するリクエストでリトライを消費しないように、RetryableTransport の外側に配置して最初の試行の前に 1 回だけ検証する
+type ValidationTransport struct {
+	wrapped    http.RoundTripper
+	routes     *retryabletransport.RouteTemplates
+	mu         sync.RWMutex
+	validators map[string][]Validator
+}
+
+// NewValidationTransport は ValidationTransport 構造体を作成する
+func NewValidationTransport(transport http.RoundTripper) *ValidationTransport {
+	return &ValidationTransport{
+		wrapped:    transport,
+		routes:     retryabletransport.NewRouteTemplates(),
+		validators: make(map[string][]Validator),
+	}
+}
+
+// Register は method と route に一致するリクエストのバリデーターを登録する
+// route は RouteTemplates と同じ形式で、"{name}" は任意の 1 セグメントに、末尾の "*" は残りすべてのセグメントに一致する
+// NOTE: 同じ method と route に複数登録した場合は、登録した順にすべて検証する
+func (t *ValidationTransport) Register(method string, route string, v Validator) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := method + " " + route
+	if _, ok := t.validators[key]; !ok {
+		t.routes.Register(route)
+	}
+	t.validators[key] = append(t.validators[key], v)
+}
+
+// transport は親の Transport を返却する。親がない場合は、http.DefaultTransport を返却する
+func (t *ValidationTransport) transport() http.RoundTripper {
+	if t.wrapped == nil {
+		return http.DefaultTransport
+	}
+	return t.wrapped
+}
+
+// RoundTrip はリクエストを検証してから送信する
+func (t *ValidationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	route := t.routes.Normalize(req.URL.Path)
+
+	t.mu.RLock()
+	validators := t.validators[req.Method+" "+route]
+	t.mu.RUnlock()
+
+	if len(validators) == 0 {
+		return t.transport().RoundTrip(req)
+	}
+
+	body, req, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []Violation
+	for _, v := range validators {
+		vs, err := v.Validate(req, body)
+		if err != nil {
+			closeRequestBody(req)
+			return nil, fmt.Errorf("validate %s %s: %w", req.Method, route, err)
+		}
+		violations = append(violations, vs...)
+	}
+	if len(violations) > 0 {
+		// NOTE: RoundTripper はエラーの場合もリクエストボディをクローズする必要がある
+		closeRequestBody(req)
+		return nil, &ValidationError{Method: req.Method, Route: route, Violations: violations}
+	}
+
+	return t.transport().RoundTrip(req)
+}
+
+// readBody はリクエストボディを読み込み、再度読み込めるようにしたリクエストを返却する
+func readBody(req *http.Request) ([]byte, *http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, req, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	newReq := req.Clone(req.Context())
+	newReq.Body = io.NopCloser(bytes.NewReader(body))
+	newReq.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, newReq, nil
+}
+
+// closeRequestBody はリクエストボディをクローズする
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// user は検証するリクエストボディ
+type user struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+// validateUser は user の制約を検証する
+func validateUser(u user) []Violation {
+	var violations []Violation
+	if u.Name == "" {
+		violations = append(violations, Violation{Path: "/name", Message: "is required"})
+	}
+	if u.Age < 0 {
+		violations = append(violations, Violation{Path: "/age", Message: "must not be negative"})
+	}
+	return violations
+}
+
+// newValidationTransport は、POST /users/{id} を検証し、送信したボディを sent に記録する ValidationTransport を作成する
+func newValidationTransport(sent *[]string) *ValidationTransport {
+	transport := NewValidationTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(r.Body)
+		*sent = append(*sent, string(body))
+		return textResponse(r, ""), nil
+	}))
+	transport.Register(http.MethodPost, "/users/{id}", JSONValidator(validateUser))
+	return transport
+}
+
+func TestValidationTransport(t *testing.T) {
+	tests := []struct {
+		name           string
+		method, path   string
+		body           string
+		wantViolations string
+	}{
+		{"valid", http.MethodPost, "/users/1", `{"name":"a","age":1}`, ""},
+		{"violations", http.MethodPost, "/users/1", `{"age":-1}`, "/name: is required; /age: must not be negative"},
+		{"invalid JSON", http.MethodPost, "/users/1", `{`, "invalid JSON: unexpected end of JSON input"},
+		{"other method", http.MethodPut, "/users/1", `{`, ""},
+		{"other route", http.MethodPost, "/groups/1", `{`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent []string
+			transport := newValidationTransport(&sent)
+
+			req, _ := http.NewRequest(tt.method, "http://example.com"+tt.path, strings.NewReader(tt.body))
+			res, err := transport.RoundTrip(req)
+			if tt.wantViolations == "" {
+				if err != nil {
+					t.Fatalf("RoundTrip: %v", err)
+				}
+				res.Body.Close()
+				// NOTE: 検証で読み込んだボディを復元して送信する
+				if len(sent) != 1 || sent[0] != tt.body {
+					t.Errorf("sent %q, want %q", sent, tt.body)
+				}
+				return
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("err = %v, want *ValidationError", err)
+			}
+			if want := "request validation failed for POST /users/{id}: " + tt.wantViolations; verr.Error() != want {
+				t.Errorf("err = %q, want %q", verr.Error(), want)
+			}
+			if len(sent) != 0 {
+				t.Errorf("invalid request was sent: %q", sent)
+			}
+		})
+	}
+}
+
+func TestValidationTransportMultipleValidators(t *testing.T) {
+	var sent []string
+	transport := newValidationTransport(&sent)
+	transport.Register(http.MethodPost, "/users/{id}", ValidatorFunc(func(req *http.Request, _ []byte) ([]Violation, error) {
+		if req.Header.Get("Content-Type") != "application/json" {
+			return []Violation{{Message: "content type must be application/json"}}, nil
+		}
+		return nil, nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com/users/1", strings.NewReader(`{}`))
+	_, err := transport.RoundTrip(req)
+
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Violations) != 2 {
+		t.Fatalf("err = %v, want violations from both validators", err)
+	}
+	if verr.Violations[0].Path != "/name" || verr.Violations[1].Path != "" {
+		t.Errorf("violations = %+v, want registration order", verr.Violations)
+	}
+}
+
+func TestValidationTransportValidatorError(t *testing.T) {
+	errSchema := errors.New("schema unavailable")
+	var sent []string
+	transport := newValidationTransport(&sent)
+	transport.Register(http.MethodPost, "/users/{id}", ValidatorFunc(func(*http.Request, []byte) ([]Violation, error) {
+		return nil, errSchema
+	}))
+
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com/users/1", strings.NewReader(`{"name":"a"}`))
+	_, err := transport.RoundTrip(req)
+
+	var verr *ValidationError
+	if !errors.Is(err, errSchema) || errors.As(err, &verr) {
+		t.Errorf("err = %v, want wrapped %v", err, errSchema)
+	}
+	if len(sent) != 0 {
+		t.Errorf("request was sent: %q", sent)
+	}
+}
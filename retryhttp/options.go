@@ -0,0 +1,420 @@
+package retryhttp
+
+import (
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/mtnori/httpRetryExample/retryhttp/middleware"
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// config は NewClient の設定
+type config struct {
+	maxAttempts      int
+	timeouts         TimeoutConfig
+	backoff          retryabletransport.BackoffFunc
+	checkRetry       retryabletransport.CheckRetryFunc
+	transport        http.RoundTripper
+	transportOptions []retryabletransport.Option
+	statsWindow      time.Duration
+	// propagateDeadline は X-Timeout-Budget ヘッダーを付与するか
+	propagateDeadline bool
+	// bufferLimit はレスポンスボディをバッファリングする上限のバイト数。0 の場合はバッファリングしない
+	bufferLimit int64
+	// retryStatus は checkRetry が指定されていない場合に、リトライするステータスコードを判定する関数
+	retryStatus func(int) bool
+	// checkRedirect は *http.Client の CheckRedirect。nil の場合はデフォルトの動作
+	checkRedirect func(req *http.Request, via []*http.Request) error
+	// middlewares は RetryableTransport の内側で、試行ごとに適用する Middleware
+	middlewares []middleware.Middleware
+	// randSource は、backoff が指定されていない場合にデフォルトのバックオフが使用する乱数の生成元
+	randSource rand.Source
+	// singleflight は送信中の同一の GET をまとめるか。singleflightHeaders は同一か判定するために追加で比較するヘッダー
+	singleflight        bool
+	singleflightHeaders []string
+	// backgroundTasks は Client の Runtime で実行するバックグラウンドの処理
+	backgroundTasks []BackgroundTask
+	// startupJitter は、バックグラウンドの処理を開始するまでに待機するランダムな時間の上限
+	startupJitter time.Duration
+	// proxy は、transport が指定されていない場合にデフォルトの Transport が使用するプロキシ
+	proxy func(*http.Request) (*url.URL, error)
+	// alternateAddrDial は、transport が指定されていない場合に、デフォルトの Transport が AlternateAddrDial でダイヤルするか
+	alternateAddrDial bool
+	// asyncWorkers と asyncQueueSize は DoAsync のワーカー数とキューの長さ。0 の場合はデフォルト値
+	asyncWorkers   int
+	asyncQueueSize int
+	// defaultsVersion は、オプションで指定しなかった設定に使用したデフォルトの値のバージョン
+	defaultsVersion DefaultsVersion
+	// err はオプションの設定の誤り。最初に検出した誤りのみを保持する
+	err error
+}
+
+// setErr は、まだ誤りを記録していない場合に、オプションの設定の誤りを記録する
+func (c *config) setErr(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// defaultConfig は NewClient のデフォルトの設定を返却する
+func defaultConfig() config {
+	return config{
+		maxAttempts: 4,
+		timeouts:    DefaultTimeoutConfig(),
+		retryStatus: retryStatusCodes(defaultRetryStatusCodes...),
+		statsWindow: 5 * time.Minute,
+		// NOTE: defaultsVersions の DefaultsV1 と同じ値
+		defaultsVersion: DefaultsV1,
+	}
+}
+
+// Option は NewClient の設定を変更する関数の型定義
+type Option func(*config)
+
+// WithMaxAttempts は、最初の試行を含む最大試行回数を設定する。1 を指定した場合はリトライを行わない
+func WithMaxAttempts(n int) Option {
+	return func(c *config) {
+		c.maxAttempts = max(n, 1)
+	}
+}
+
+// WithTimeout は、リトライとバックオフを含むリクエスト全体のタイムアウトを設定する
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.timeouts.Overall = timeout
+	}
+}
+
+// WithAttemptTimeout は、1 回の試行のタイムアウトを設定する
+// タイムアウトした試行はリトライされるため、1 回の遅い試行がリクエスト全体のタイムアウト (WithTimeout) を使い切らない
+// NOTE: WithTimeout より短い値を設定しないと、タイムアウトした試行をリトライする時間が残らない
+func WithAttemptTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.timeouts.PerAttempt = timeout
+	}
+}
+
+// WithFirstByteTimeout は、1 回の試行でレスポンスの最初のバイトを受信するまでのタイムアウトを設定する
+// レスポンスボディの読み込みには適用されないため、応答のない試行だけを早くリトライできる
+// NOTE: TimeoutConfig.ResponseHeader と異なり、WithTransport で任意の Transport を指定した場合にも適用される
+func WithFirstByteTimeout(timeout time.Duration) Option {
+	return WithTransportOptions(retryabletransport.WithFirstByteTimeout(timeout))
+}
+
+// WithTimeouts は、タイムアウトの階層をまとめて設定する
+// NOTE: 設定の検証を行う場合は NewClientWithTimeouts を使用する
+func WithTimeouts(timeouts TimeoutConfig) Option {
+	return func(c *config) {
+		c.timeouts = timeouts
+	}
+}
+
+// WithBackoff は、リトライまでの待機時間を算出する Backoff を設定する
+// 例: WithBackoff(LinearBackoff{Base: time.Second, Cap: 5 * time.Second})
+// NOTE: 関数を指定する場合は retryabletransport.BackoffFunc に変換する
+func WithBackoff(backoff retryabletransport.Backoff) Option {
+	return func(c *config) {
+		c.backoff = nil
+		if backoff != nil {
+			c.backoff = backoff.Backoff
+		}
+	}
+}
+
+// WithBackoffPreset は、名前付きのバックオフの設定 (BackoffAggressive、BackoffStandard、BackoffConservative) を使用する
+// NOTE: 未知の名前を指定した場合は BackoffStandard を使用する
+func WithBackoffPreset(preset BackoffPreset) Option {
+	backoff, ok := preset.Backoff()
+	if !ok {
+		backoff, _ = BackoffStandard.Backoff()
+	}
+	return WithBackoff(backoff)
+}
+
+// WithCheckRetry は、リトライを行うか判定する関数を設定する
+func WithCheckRetry(checkRetry retryabletransport.CheckRetryFunc) Option {
+	return func(c *config) {
+		c.checkRetry = checkRetry
+	}
+}
+
+// WithRetryStatusCodes は、リトライするステータスコードを設定する
+// デフォルトは 408, 429, 500, 502, 503, 504。WithCheckRetry を指定した場合は使用されない
+func WithRetryStatusCodes(codes ...int) Option {
+	return WithRetryStatusFunc(retryStatusCodes(codes...))
+}
+
+// WithRetryStatusFunc は、ステータスコードからリトライするか判定する関数を設定する
+// 送信エラーは、リトライしても成功しないエラー (証明書のエラーなど) を除いてリトライする。WithCheckRetry を指定した場合は使用されない
+func WithRetryStatusFunc(retryStatus func(statusCode int) bool) Option {
+	return func(c *config) {
+		c.retryStatus = retryStatus
+	}
+}
+
+// WithCheckRetryContext は、試行回数やリクエストの内容も含めてリトライを行うか判定する関数を設定する
+// 設定した場合は WithCheckRetry の関数より優先する
+func WithCheckRetryContext(checkRetry retryabletransport.CheckRetryContextFunc) Option {
+	return WithTransportOptions(retryabletransport.WithCheckRetryContext(checkRetry))
+}
+
+// WithTransport は、実際にリクエストを送信する親の Transport を設定する
+// NOTE: 指定した場合、TimeoutConfig の Connect, TLSHandshake, ResponseHeader は適用されないため、親の Transport で設定する
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *config) {
+		c.transport = transport
+	}
+}
+
+// WithTransportOptions は、RetryableTransport のオプションを追加する
+func WithTransportOptions(opts ...retryabletransport.Option) Option {
+	return func(c *config) {
+		c.transportOptions = append(c.transportOptions, opts...)
+	}
+}
+
+// WithStatsWindow は、Client.Stats で集計する期間を設定する
+func WithStatsWindow(window time.Duration) Option {
+	return func(c *config) {
+		c.statsWindow = window
+	}
+}
+
+// WithLogger は、RetryableTransport がログを出力する *slog.Logger を設定する
+func WithLogger(logger *slog.Logger) Option {
+	return WithTransportOptions(retryabletransport.WithLogger(logger))
+}
+
+// WithRetryNonIdempotent は、冪等でないリクエスト (Idempotency-Key ヘッダーのない POST, PATCH など) もリトライするか設定する
+// デフォルトではリトライしないため、POST が安全にリトライできる場合にのみ有効にする
+func WithRetryNonIdempotent(enabled bool) Option {
+	return WithTransportOptions(retryabletransport.WithRetryNonIdempotent(enabled))
+}
+
+// WithSLOViolationHandler は、WithLatencySLO で指定したレイテンシーを超えたリクエストを通知する関数を設定する
+// NOTE: 集計結果を参照する場合は、transport.NewSLORecorder を WithTransportOptions で追加する
+func WithSLOViolationHandler(onViolation func(retryabletransport.SLOViolation)) Option {
+	return WithTransportOptions(retryabletransport.WithRecorder(retryabletransport.NewSLORecorder(onViolation)))
+}
+
+// WithIdempotencyKey は、冪等でないリクエストに Idempotency-Key ヘッダーを生成して付与し、すべてのリトライで同じキーを送信する
+// 冪等キーを付与したリクエストはリトライされる。generate が nil の場合は UUID を生成する
+func WithIdempotencyKey(generate func() string) Option {
+	return WithTransportOptions(retryabletransport.WithIdempotencyKey(generate))
+}
+
+// WithBodyTransformer は、試行ごとにリクエストボディを変換する BodyTransformer を設定する
+// transform には常に元のリクエストボディが渡される
+func WithBodyTransformer(transform retryabletransport.BodyTransformer) Option {
+	return WithTransportOptions(retryabletransport.WithBodyTransformer(transform))
+}
+
+// WithRateLimiter は、リトライを含むすべての試行を limiter で送信できるまで待機してから送信する
+// 例: WithRateLimiter(retryabletransport.NewTokenBucket(10, 1)) は、リトライを含めて秒間 10 リクエストに制限する
+func WithRateLimiter(limiter retryabletransport.Limiter) Option {
+	return WithTransportOptions(retryabletransport.WithRateLimiter(limiter))
+}
+
+// WithAuthRefresher は、401 または 403 を受け取った場合に refresh で新しいトークンを取得し、Authorization ヘッダーを書き換えて 1 回だけリトライする
+func WithAuthRefresher(refresh retryabletransport.AuthRefresher) Option {
+	return WithTransportOptions(retryabletransport.WithAuthRefresher(refresh))
+}
+
+// WithRedirects は、ホストごとにリダイレクトのステータスコードをリトライ、リダイレクト先への送信、成功のいずれとして扱うかを設定する
+func WithRedirects(table *retryabletransport.RedirectTable) Option {
+	return func(c *config) {
+		c.transportOptions = append(c.transportOptions, retryabletransport.WithRedirects(table))
+		c.checkRedirect = table.CheckRedirect
+	}
+}
+
+// WithMiddleware は、RetryableTransport の内側で試行ごとに適用する Middleware を追加する
+// 先頭の Middleware が最も外側になる
+// NOTE: 例えば middleware.AuthRefresh を追加すると、リトライの試行ごとに認証情報の更新を判定する
+func WithMiddleware(mws ...middleware.Middleware) Option {
+	return func(c *config) {
+		c.middlewares = append(c.middlewares, mws...)
+	}
+}
+
+// WithRandSource は、デフォルトのバックオフの Full Jitter が使用する乱数の生成元を設定する。WithBackoff を指定した場合は使用しない
+// NOTE: テストでリトライの待機時間を再現できるように、シードを固定した rand.NewSource を指定する
+func WithRandSource(source rand.Source) Option {
+	return func(c *config) {
+		c.randSource = source
+	}
+}
+
+// WithClock は、RetryableTransport がバックオフの待機や時刻の取得に使用する Clock を設定する
+// NOTE: テストでは retrytest.FakeClock を指定すると、実際に待機せずにリトライを検証できる
+func WithClock(clock retryabletransport.Clock) Option {
+	return WithTransportOptions(retryabletransport.WithClock(clock))
+}
+
+// WithMaxDrainBytes は、リトライ前に読み捨てるエラーレスポンスのボディの最大バイト数を n に変更する。デフォルトは 4KB
+// NOTE: n より大きいボディは読み切らずにクローズし、コネクションを破棄する
+func WithMaxDrainBytes(n int64) Option {
+	return WithTransportOptions(retryabletransport.WithMaxDrainBytes(n))
+}
+
+// WithHostPolicy は、リクエストの URL のホストが host の場合に適用するリトライポリシーを設定する
+// 例: WithHostPolicy("api.partner.com", retryabletransport.NoRetry) は、外部の API へのリクエストをリトライしない
+func WithHostPolicy(host string, policy retryabletransport.RetryPolicy) Option {
+	return WithTransportOptions(retryabletransport.WithHostPolicy(host, policy))
+}
+
+// WithAdaptiveRetry は、ホストごとの直近の失敗率が高い場合にバックオフを引き伸ばし、回復すると元に戻す
+// 例: WithAdaptiveRetry(retryabletransport.AdaptiveConfig{ReduceAttempts: true}) は、リトライ回数も失敗率に応じて減らす
+func WithAdaptiveRetry(config retryabletransport.AdaptiveConfig) Option {
+	return WithTransportOptions(retryabletransport.WithAdaptiveRetry(config))
+}
+
+// WithSingleflight は、送信中の同一の GET と HEAD を 1 つのリクエストにまとめ、すべての呼び出し元でレスポンスを共有する
+// メソッド、URL、認証情報、Accept 系のヘッダー、varyHeaders が一致するリクエストを同一とみなす
+// NOTE: RetryableTransport の外側でまとめるため、リトライを含めて送信するのは 1 つのリクエストのみになる
+func WithSingleflight(varyHeaders ...string) Option {
+	return func(c *config) {
+		c.singleflight = true
+		c.singleflightHeaders = append(c.singleflightHeaders, varyHeaders...)
+	}
+}
+
+// WithValidateResponse は、レスポンスを validate で検証し、エラーを返却した場合はリトライする
+// 例えば、ボディが {"status":"error"} の 200 を受け取った場合にリトライするために使用する。validate はボディを読み込んでよい
+func WithValidateResponse(validate func(*http.Response) error) Option {
+	return WithTransportOptions(retryabletransport.WithValidateResponse(validate))
+}
+
+// WithResponseBackoff は、レスポンスからリトライまでの待機時間を算出する backoff を設定する
+// 例: WithResponseBackoff(retryabletransport.HonorRetryAfter(retryabletransport.Min(backoff, retryabletransport.Constant(20*time.Second))))
+// は、Retry-After ヘッダーがある場合はその値を、ない場合は上限 20 秒の backoff の待機時間を使用する
+func WithResponseBackoff(backoff retryabletransport.ResponseBackoffFunc) Option {
+	return WithTransportOptions(retryabletransport.WithResponseBackoff(backoff))
+}
+
+// WithRangeResume は、GET のレスポンスボディの読み込み中に接続が切れた場合に、Range ヘッダーで続きから取得し直す
+// NOTE: ETag または Last-Modified ヘッダーを返却するサーバーからの、大きなファイルのダウンロードに使用する
+func WithRangeResume() Option {
+	return WithTransportOptions(retryabletransport.WithRangeResume())
+}
+
+// WithMaxConcurrentRequests は、リトライを含めて同時に送信する試行の数を n 以下に制限する
+// 上限に達している場合は枠が空くまで待機する。maxQueued に 0 より大きい値を指定した場合は、待機できるリクエストの数も制限する
+func WithMaxConcurrentRequests(n int, maxQueued int) Option {
+	return WithTransportOptions(
+		retryabletransport.WithMaxConcurrentRequests(n),
+		retryabletransport.WithMaxQueuedRequests(maxQueued),
+	)
+}
+
+// WithBackgroundTask は、Client が所有するバックグラウンドのゴルーチンで task を実行する
+// task は最初のリクエストの送信時に開始し、Client の Close または Shutdown で終了する
+// 例: WithBackgroundTask(func(ctx context.Context) error { regions.Run(ctx); return nil })
+func WithBackgroundTask(task BackgroundTask) Option {
+	return func(c *config) {
+		c.backgroundTasks = append(c.backgroundTasks, task)
+	}
+}
+
+// WithProxy は、送信に使用するプロキシを返却する関数を設定する。デフォルトは http.ProxyFromEnvironment
+// 例: sysproxy.Detect で検出した OS のプロキシの設定を使用する。WithTransport を指定した場合は使用されない
+func WithProxy(proxy func(req *http.Request) (*url.URL, error)) Option {
+	return func(c *config) {
+		c.proxy = proxy
+	}
+}
+
+// WithHostRateLimit は、送信先のホストごとに、リトライを含めて秒間 rate リクエスト (最大 burst) に送信数を制限する
+// リクエストごとに WithCost を指定した場合は、そのコストの数のトークンを消費する
+func WithHostRateLimit(rate float64, burst int) Option {
+	return WithTransportOptions(retryabletransport.WithHostRateLimit(rate, burst))
+}
+
+// WithRequestCostFunc は、WithCost を指定していないリクエストのコストを cost で算出する
+// 例: POST /reports のコストを 10 とし、それ以外を 1 とする
+func WithRequestCostFunc(cost func(req *http.Request) int) Option {
+	return WithTransportOptions(retryabletransport.WithRequestCostFunc(cost))
+}
+
+// WithMaxConcurrentRequestsPerHost は、送信先のホストごとに、リトライを含めて同時に送信する試行の数を n 以下に制限する
+// fair に true を指定した場合は、上限に達して待機しているリクエストに、呼び出し元 (WithCaller) ごとに順番に枠を割り当てる
+// NOTE: 1 つの Client を複数の機能で共有する場合に、1 つの機能のリクエストやリトライが他の機能の枠を奪い続けるのを防ぐ
+func WithMaxConcurrentRequestsPerHost(n int, fair bool) Option {
+	opts := []retryabletransport.Option{retryabletransport.WithMaxConcurrentRequestsPerHost(n)}
+	if fair {
+		opts = append(opts, retryabletransport.WithFairQueuing())
+	}
+	return WithTransportOptions(opts...)
+}
+
+// WithAttemptDump は、試行ごとのリクエストとレスポンスのリクエストライン、ヘッダー、先頭のボディを Debug レベルのログに出力する
+// Authorization、Cookie、Set-Cookie と redactHeaders のヘッダーの値はマスクする。maxBodyBytes が 0 の場合は先頭の 1024 バイトを出力する
+// 例: WithAttemptDump(4096, "X-Api-Key")
+func WithAttemptDump(maxBodyBytes int, redactHeaders ...string) Option {
+	return WithTransportOptions(retryabletransport.WithAttemptDump(retryabletransport.DumpConfig{
+		MaxBodyBytes:  maxBodyBytes,
+		RedactHeaders: redactHeaders,
+	}))
+}
+
+// WithStartupJitter は、バックグラウンドの処理 (WithBackgroundTask、Client.Go) ごとに、0 以上 max 未満のランダムな時間だけ待機してから開始する
+// NOTE: 多数のレプリカが同時に再起動した場合に、定期的な処理や再接続のループが同じタイミングでリトライを始めるのを防ぐ
+func WithStartupJitter(max time.Duration) Option {
+	return func(c *config) {
+		c.startupJitter = max
+	}
+}
+
+// WithMaxAttemptsByClass は、レート制限 (429、408)、5xx、送信エラーのリトライの原因ごとに、最初の試行を含めた試行回数の上限を設定する
+// 例: WithMaxAttemptsByClass(map[retryabletransport.RetryClass]int{retryabletransport.ThrottleClass: 5, retryabletransport.ServerErrorClass: 2})
+// NOTE: 指定していない原因の試行は WithMaxAttempts の上限を使用する
+func WithMaxAttemptsByClass(limits map[retryabletransport.RetryClass]int) Option {
+	return WithTransportOptions(retryabletransport.WithMaxAttemptsByClass(limits))
+}
+
+// WithRequestReducer は、431 Request Header Fields Too Large または 414 URI Too Long のレスポンスを受け取った場合に、
+// reducer で小さくしたリクエストで 1 回だけリトライする
+// 例: WithRequestReducer(retryabletransport.ChainReducers(retryabletransport.DropHeaders("X-Debug"), retryabletransport.QueryToBody()))
+func WithRequestReducer(reducer retryabletransport.RequestReducer) Option {
+	return WithTransportOptions(retryabletransport.WithRequestReducer(reducer))
+}
+
+// WithNoRetrySignals は、レスポンスに含まれていればリトライしない、サーバーからの指示 (ヘッダーとステータスコード) を設定する
+// デフォルトは、X-No-Retry: true または 413、501、505 のステータスコードの場合にリトライしない
+func WithNoRetrySignals(signals retryabletransport.NoRetrySignals) Option {
+	return WithTransportOptions(retryabletransport.WithNoRetrySignals(signals))
+}
+
+// WithCanaryPolicy は、percent パーセントのリクエストに、Client の設定の代わりに policy を適用する
+// 結果は Client.CanaryStats で Client の設定と比較できる
+// NOTE: 新しいリトライの設定に切り替える前に、本番環境のトラフィックの一部で検証するために使用する
+func WithCanaryPolicy(policy retryabletransport.RetryPolicy, percent float64) Option {
+	return WithTransportOptions(retryabletransport.WithCanaryPolicy(policy, percent))
+}
+
+// WithProxyRotation は、試行ごとに proxies のプロキシを順に切り替えて送信し、リトライでは前の試行と異なるプロキシを使用する
+// NOTE: WithTransport で任意の Transport を指定した場合は、最も内側の *http.Transport の Proxy に retryabletransport.AttemptProxy を設定する
+func WithProxyRotation(proxies []*url.URL) Option {
+	return WithTransportOptions(retryabletransport.WithProxyRotation(proxies))
+}
+
+// WithAlternateAddrDialing は、ダイヤルのたびにホスト名を名前解決し直し、前の試行でダイヤルに失敗したアドレスを後回しにしてダイヤルする
+// NOTE: 複数の A/AAAA レコードのうち一部のアドレスが停止している場合に、同じアドレスへのリトライを繰り返さないようにする
+// WithTransport を指定した場合は使用されないため、*http.Transport の DialContext に retryabletransport.AlternateAddrDial を設定する
+func WithAlternateAddrDialing() Option {
+	return func(c *config) {
+		c.alternateAddrDial = true
+	}
+}
+
+// WithAsyncWorkers は、DoAsync のリクエストを送信するワーカー数と、送信を待つリクエストのキューの長さを設定する
+// デフォルトは 4 ワーカーと 100 リクエスト。キューが上限に達している場合、DoAsync は ErrAsyncQueueFull を返却する
+func WithAsyncWorkers(workers int, queueSize int) Option {
+	return func(c *config) {
+		c.asyncWorkers = workers
+		c.asyncQueueSize = queueSize
+	}
+}
@@ -0,0 +1,145 @@
+package pagination
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CheckpointStore は、ページ送りの途中経過 (最後に処理が成功したページの次のカーソル) を保存する
+// NOTE: プロセスのクラッシュ後に再開する場合は、永続化を行う実装を使用する
+type CheckpointStore interface {
+	// Load は key のカーソルを返却する。保存されていない場合は ok に false を返却する
+	Load(key string) (cursor string, ok bool, err error)
+	// Save は key のカーソルを保存する
+	Save(key string, cursor string) error
+	// Delete は key のカーソルを削除する。ページ送りが最後まで完了した場合に呼び出される
+	Delete(key string) error
+}
+
+// MemoryCheckpointStore はカーソルをメモリ上に保存する CheckpointStore
+// NOTE: プロセス内で致命的なエラーから再開する場合に使用する。クラッシュ後の再開はできない
+type MemoryCheckpointStore struct {
+	mu      sync.Mutex
+	cursors map[string]string
+}
+
+// NewMemoryCheckpointStore は MemoryCheckpointStore 構造体を作成する
+func NewMemoryCheckpointStore() *MemoryCheckpointStore {
+	return &MemoryCheckpointStore{cursors: make(map[string]string)}
+}
+
+func (s *MemoryCheckpointStore) Load(key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cursor, ok := s.cursors[key]
+	return cursor, ok, nil
+}
+
+func (s *MemoryCheckpointStore) Save(key string, cursor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cursors[key] = cursor
+	return nil
+}
+
+func (s *MemoryCheckpointStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.cursors, key)
+	return nil
+}
+
+// FileCheckpointStore はカーソルを JSON ファイルに保存する CheckpointStore
+type FileCheckpointStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileCheckpointStore は FileCheckpointStore 構造体を作成する
+func NewFileCheckpointStore(path string) *FileCheckpointStore {
+	return &FileCheckpointStore{path: path}
+}
+
+func (s *FileCheckpointStore) Load(key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cursors, err := s.read()
+	if err != nil {
+		return "", false, err
+	}
+	cursor, ok := cursors[key]
+	return cursor, ok, nil
+}
+
+func (s *FileCheckpointStore) Save(key string, cursor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cursors, err := s.read()
+	if err != nil {
+		return err
+	}
+	cursors[key] = cursor
+	return s.write(cursors)
+}
+
+func (s *FileCheckpointStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cursors, err := s.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := cursors[key]; !ok {
+		return nil
+	}
+	delete(cursors, key)
+	return s.write(cursors)
+}
+
+// read はファイルからすべてのカーソルを読み込む。ファイルがない場合は空の map を返却する
+func (s *FileCheckpointStore) read() (map[string]string, error) {
+	cursors := make(map[string]string)
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cursors, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &cursors); err != nil {
+		return nil, err
+	}
+	return cursors, nil
+}
+
+// write はすべてのカーソルをファイルに書き込む
+// NOTE: 書き込み中にクラッシュしてもファイルが壊れないように、一時ファイルに書き込んでからリネームする
+func (s *FileCheckpointStore) write(cursors map[string]string) error {
+	data, err := json.Marshal(cursors)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
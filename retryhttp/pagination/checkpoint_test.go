@@ -0,0 +1,76 @@
+package pagination
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testCheckpointStore は、CheckpointStore の実装が共通の振る舞いを満たすか検証する
+func testCheckpointStore(t *testing.T, store CheckpointStore) {
+	t.Helper()
+
+	if _, ok, err := store.Load("orders"); err != nil || ok {
+		t.Fatalf("Load before Save = %v, %v, want not found", ok, err)
+	}
+	if err := store.Save("orders", "c1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save("users", "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save("orders", "c2"); err != nil {
+		t.Fatal(err)
+	}
+	if cursor, ok, err := store.Load("orders"); err != nil || !ok || cursor != "c2" {
+		t.Errorf("Load = %q, %v, %v, want c2", cursor, ok, err)
+	}
+
+	if err := store.Delete("orders"); err != nil {
+		t.Fatal(err)
+	}
+	// NOTE: 保存されていないキーの削除はエラーにしない
+	if err := store.Delete("orders"); err != nil {
+		t.Errorf("Delete of a missing key: %v", err)
+	}
+	if _, ok, _ := store.Load("orders"); ok {
+		t.Error("cursor remains after Delete")
+	}
+	if cursor, ok, _ := store.Load("users"); !ok || cursor != "u1" {
+		t.Errorf("other key = %q, %v, want u1", cursor, ok)
+	}
+}
+
+func TestMemoryCheckpointStore(t *testing.T) {
+	testCheckpointStore(t, NewMemoryCheckpointStore())
+}
+
+func TestFileCheckpointStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+	testCheckpointStore(t, NewFileCheckpointStore(path))
+
+	// NOTE: 別の FileCheckpointStore からも読み込めることで、クラッシュ後に再開できることを検証する
+	if cursor, ok, err := NewFileCheckpointStore(path).Load("users"); err != nil || !ok || cursor != "u1" {
+		t.Errorf("Load from a new store = %q, %v, %v, want u1", cursor, ok, err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries, want only the checkpoint file", len(entries))
+	}
+}
+
+func TestFileCheckpointStoreCorrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	store := NewFileCheckpointStore(path)
+
+	if _, _, err := store.Load("orders"); err == nil {
+		t.Error("Load of a corrupted file succeeded")
+	}
+	// NOTE: 壊れたファイルを上書きして他のキーのカーソルを失わないように、Save もエラーを返却する
+	if err := store.Save("orders", "c1"); err == nil {
+		t.Error("Save over a corrupted file succeeded")
+	}
+}
@@ -0,0 +1,59 @@
+package pagination
+
+import (
+	"context"
+	"iter"
+)
+
+// PageFunc は cursor のページを取得し、ページの要素と次のページのカーソルを返却する関数の型定義
+// 最初のページの cursor は空文字列。最後のページの場合は next に空文字列を返却する
+type PageFunc[T any] func(ctx context.Context, cursor string) (items []T, next string, err error)
+
+// Pages は最後のページまでページ送りを行い、ページごとの要素を返却するイテレーター
+// ページの取得に失敗した場合は、エラーを返却して終了する
+func Pages[T any](ctx context.Context, fetch PageFunc[T]) iter.Seq2[[]T, error] {
+	return func(yield func([]T, error) bool) {
+		var cursor string
+		for {
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+			items, next, err := fetch(ctx, cursor)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(items, nil) || next == "" {
+				return
+			}
+			cursor = next
+		}
+	}
+}
+
+// Items は最後のページまでページ送りを行い、すべてのページの要素を 1 件ずつ返却するイテレーター
+// ページの取得に失敗した場合は、ゼロ値とエラーを返却して終了する
+//
+//	for user, err := range pagination.Items(ctx, listUsers) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func Items[T any](ctx context.Context, fetch PageFunc[T]) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for items, err := range Pages(ctx, fetch) {
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			for _, item := range items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package pagination
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// pages は、カーソルごとのページを返却する PageFunc を作成する。fetched には取得したカーソルを記録する
+func pages(fetched *[]string, failAt string) PageFunc[int] {
+	book := map[string]struct {
+		items []int
+		next  string
+	}{
+		"":   {[]int{1, 2}, "p2"},
+		"p2": {[]int{3}, "p3"},
+		"p3": {[]int{4, 5}, ""},
+	}
+	return func(ctx context.Context, cursor string) ([]int, string, error) {
+		*fetched = append(*fetched, cursor)
+		if cursor == failAt {
+			return nil, "", errors.New("fetch failed")
+		}
+		page := book[cursor]
+		return page.items, page.next, nil
+	}
+}
+
+func TestItems(t *testing.T) {
+	var fetched []string
+	var got []int
+	for item, err := range Items(context.Background(), pages(&fetched, "none")) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, item)
+	}
+	if want := []int{1, 2, 3, 4, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("items = %v, want %v", got, want)
+	}
+	if want := []string{"", "p2", "p3"}; !reflect.DeepEqual(fetched, want) {
+		t.Errorf("fetched cursors = %q, want %q", fetched, want)
+	}
+}
+
+// TestItemsBreak は、ループを抜けた場合に次のページを取得しないことを検証する
+func TestItemsBreak(t *testing.T) {
+	var fetched []string
+	for item := range Items(context.Background(), pages(&fetched, "none")) {
+		if item == 2 {
+			break
+		}
+	}
+	if want := []string{""}; !reflect.DeepEqual(fetched, want) {
+		t.Errorf("fetched cursors = %q, want %q", fetched, want)
+	}
+}
+
+func TestPagesError(t *testing.T) {
+	var fetched []string
+	var got [][]int
+	var errs []error
+	for items, err := range Pages(context.Background(), pages(&fetched, "p2")) {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		got = append(got, items)
+	}
+	if want := [][]int{{1, 2}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pages = %v, want %v", got, want)
+	}
+	if len(errs) != 1 || errs[0].Error() != "fetch failed" {
+		t.Errorf("errors = %v, want a single fetch error", errs)
+	}
+}
+
+func TestPagesCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var fetched []string
+	for _, err := range Pages(ctx, pages(&fetched, "none")) {
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("error = %v, want context.Canceled", err)
+			}
+			break
+		}
+		cancel()
+	}
+	if want := []string{""}; !reflect.DeepEqual(fetched, want) {
+		t.Errorf("fetched cursors = %q, want %q", fetched, want)
+	}
+}
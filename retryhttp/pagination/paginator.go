@@ -0,0 +1,68 @@
+package pagination
+
+import (
+	"context"
+	"fmt"
+)
+
+// FetchPageFunc は cursor のページを取得して処理し、次のページのカーソルを返却する関数の型定義
+// 最初のページの cursor は空文字列。最後のページの場合は next に空文字列を返却する
+// NOTE: ページの取得は Client で行うため、一時的なエラーのリトライは Client に任せる
+type FetchPageFunc func(ctx context.Context, cursor string) (next string, err error)
+
+// CheckpointError は、ページの処理に失敗したことを表すエラー
+// Cursor から再開するため、同じ key で Paginate を呼び出せばよい
+type CheckpointError struct {
+	Key string
+	// Cursor は失敗したページのカーソル
+	Cursor string
+	// Pages は今回の呼び出しで処理が成功したページ数
+	Pages int
+	Err   error
+}
+
+func (e *CheckpointError) Error() string {
+	return fmt.Sprintf("pagination %q failed at cursor %q after %d pages: %v", e.Key, e.Cursor, e.Pages, e.Err)
+}
+
+func (e *CheckpointError) Unwrap() error {
+	return e.Err
+}
+
+// Paginate は最後のページまでページ送りを行う
+// ページの処理が成功するたびに次のカーソルを store に保存し、保存されたカーソルがあればそのページから再開する
+// 最後のページまで処理が完了した場合は、保存したカーソルを削除する
+// NOTE: 再開時は最後に保存したカーソルのページから処理するため、fetch はページ単位で冪等である必要がある
+func Paginate(ctx context.Context, store CheckpointStore, key string, fetch FetchPageFunc) error {
+	cursor, _, err := store.Load(key)
+	if err != nil {
+		return fmt.Errorf("load checkpoint %q: %w", key, err)
+	}
+
+	var pages int
+	for {
+		// 呼び出し元でタイムアウトやキャンセルされている場合は、カーソルを残したまま終了する
+		if err := ctx.Err(); err != nil {
+			return &CheckpointError{Key: key, Cursor: cursor, Pages: pages, Err: err}
+		}
+
+		next, err := fetch(ctx, cursor)
+		if err != nil {
+			return &CheckpointError{Key: key, Cursor: cursor, Pages: pages, Err: err}
+		}
+		pages++
+
+		// 最後のページまで完了した場合は、次回は最初から処理するためカーソルを削除する
+		if next == "" {
+			if err := store.Delete(key); err != nil {
+				return fmt.Errorf("delete checkpoint %q: %w", key, err)
+			}
+			return nil
+		}
+
+		if err := store.Save(key, next); err != nil {
+			return fmt.Errorf("save checkpoint %q: %w", key, err)
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,87 @@
+package pagination
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// errBadPage はページの処理に失敗したことを表すエラー
+var errBadPage = errors.New("bad page")
+
+// fetchPages は 3 ページを順に処理する FetchPageFunc を作成する。processed には処理したカーソルを記録する
+// failAt のカーソルのページは、failures の回数だけ失敗する
+func fetchPages(processed *[]string, failAt string, failures int) FetchPageFunc {
+	next := map[string]string{"": "p2", "p2": "p3", "p3": ""}
+	return func(ctx context.Context, cursor string) (string, error) {
+		if cursor == failAt && failures > 0 {
+			failures--
+			return "", errBadPage
+		}
+		*processed = append(*processed, cursor)
+		return next[cursor], nil
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	store := NewMemoryCheckpointStore()
+	var processed []string
+	if err := Paginate(context.Background(), store, "orders", fetchPages(&processed, "", 0)); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"", "p2", "p3"}; !reflect.DeepEqual(processed, want) {
+		t.Errorf("processed = %q, want %q", processed, want)
+	}
+	if _, ok, _ := store.Load("orders"); ok {
+		t.Error("checkpoint remains after completion")
+	}
+}
+
+func TestPaginateResume(t *testing.T) {
+	store := NewMemoryCheckpointStore()
+	var processed []string
+	fetch := fetchPages(&processed, "p3", 1)
+
+	err := Paginate(context.Background(), store, "orders", fetch)
+	var cerr *CheckpointError
+	if !errors.As(err, &cerr) || !errors.Is(err, errBadPage) {
+		t.Fatalf("err = %v, want *CheckpointError wrapping %v", err, errBadPage)
+	}
+	if cerr.Key != "orders" || cerr.Cursor != "p3" || cerr.Pages != 2 {
+		t.Errorf("err = %+v, want orders at p3 after 2 pages", cerr)
+	}
+	if cursor, _, _ := store.Load("orders"); cursor != "p3" {
+		t.Errorf("checkpoint = %q, want p3", cursor)
+	}
+
+	// 再開した場合は、失敗したページから処理する
+	if err := Paginate(context.Background(), store, "orders", fetch); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"", "p2", "p3"}; !reflect.DeepEqual(processed, want) {
+		t.Errorf("processed = %q, want %q", processed, want)
+	}
+}
+
+func TestPaginateCanceled(t *testing.T) {
+	store := NewMemoryCheckpointStore()
+	if err := store.Save("orders", "p2"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var processed []string
+	err := Paginate(ctx, store, "orders", fetchPages(&processed, "", 0))
+	var cerr *CheckpointError
+	if !errors.As(err, &cerr) || !errors.Is(err, context.Canceled) || cerr.Cursor != "p2" {
+		t.Errorf("err = %v, want canceled at p2", err)
+	}
+	if len(processed) != 0 {
+		t.Errorf("processed = %q after cancel", processed)
+	}
+	if cursor, _, _ := store.Load("orders"); cursor != "p2" {
+		t.Errorf("checkpoint = %q, want p2", cursor)
+	}
+}
@@ -0,0 +1,100 @@
+package retryhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// ContentTypeProblemJSON は RFC 9457 の問題の詳細を表すメディアタイプ
+const ContentTypeProblemJSON = "application/problem+json"
+
+// maxProblemBytes はデコードする問題の詳細の最大バイト数
+const maxProblemBytes = 64 << 10
+
+// ProblemDetails は RFC 9457 の問題の詳細 (application/problem+json)
+type ProblemDetails struct {
+	// Type は問題の種類を識別する URI。省略された場合は "about:blank"
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Extensions は API ごとの拡張メンバー。標準のメンバー以外が格納される
+	Extensions map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON は標準のメンバーと拡張メンバーをデコードする
+func (p *ProblemDetails) UnmarshalJSON(data []byte) error {
+	type standard ProblemDetails
+	var s standard
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+	for _, key := range []string{"type", "title", "status", "detail", "instance"} {
+		delete(members, key)
+	}
+	*p = ProblemDetails(s)
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	if len(members) > 0 {
+		p.Extensions = members
+	}
+	return nil
+}
+
+// Extension は拡張メンバー key を v にデコードする。メンバーがない場合は false を返却する
+func (p *ProblemDetails) Extension(key string, v any) (bool, error) {
+	raw, ok := p.Extensions[key]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+// ProblemFromError は err に含まれる問題の詳細を返却する。含まれない場合は nil
+func ProblemFromError(err error) *ProblemDetails {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Problem
+	}
+	return nil
+}
+
+// parseProblem は、レスポンスが application/problem+json の場合にレスポンスボディから問題の詳細をデコードする
+// デコードできない場合は nil を返却する
+func parseProblem(res *http.Response) *ProblemDetails {
+	if !isProblem(res.Header) {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxProblemBytes))
+	if err != nil {
+		return nil
+	}
+	return decodeProblem(res.Header, body)
+}
+
+// decodeProblem は、読み込み済みのレスポンスボディから問題の詳細をデコードする
+func decodeProblem(header http.Header, body []byte) *ProblemDetails {
+	if !isProblem(header) {
+		return nil
+	}
+	var problem ProblemDetails
+	if err := json.Unmarshal(body, &problem); err != nil {
+		return nil
+	}
+	return &problem
+}
+
+// isProblem は Content-Type が application/problem+json か判定する
+func isProblem(header http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	return err == nil && mediaType == ContentTypeProblemJSON
+}
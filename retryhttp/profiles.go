@@ -0,0 +1,129 @@
+package retryhttp
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// Profile は、試行回数、タイムアウト、バックオフ、リトライの予算、サーキットブレーカーの設定をまとめた名前付きの設定
+type Profile string
+
+const (
+	// ProfileAggressive は、少ない試行回数と短いタイムアウトで早く結果を返却する。ユーザーが応答を待つ対話的な処理に使用する
+	ProfileAggressive Profile = "aggressive"
+	// ProfileStandard は、NewClient のデフォルトの試行回数、タイムアウト、バックオフに、リトライの予算とサーキットブレーカーを加える
+	ProfileStandard Profile = "standard"
+	// ProfileConservative は、多い試行回数と長いタイムアウトで送信先の回復を待つ。バッチ処理などの結果を急がない処理に使用する
+	ProfileConservative Profile = "conservative"
+)
+
+// profileSettings は Profile でまとめて設定する値
+type profileSettings struct {
+	maxAttempts int
+	timeouts    TimeoutConfig
+	backoff     BackoffPreset
+	// budgetRatio と budgetMinTokens は retryabletransport.NewRetryBudget の引数
+	budgetRatio     float64
+	budgetMinTokens int
+	breaker         retryabletransport.CircuitBreakerConfig
+}
+
+// profiles は名前付きの設定の一覧
+var profiles = map[Profile]profileSettings{
+	ProfileAggressive: {
+		maxAttempts: 3,
+		timeouts: TimeoutConfig{
+			Connect:        2 * time.Second,
+			TLSHandshake:   2 * time.Second,
+			ResponseHeader: 2 * time.Second,
+			PerAttempt:     3 * time.Second,
+			Overall:        5 * time.Second,
+		},
+		backoff:         BackoffAggressive,
+		budgetRatio:     0.1,
+		budgetMinTokens: 10,
+		breaker: retryabletransport.CircuitBreakerConfig{
+			FailureRate: 0.5,
+			MinRequests: 10,
+			Window:      30 * time.Second,
+			Cooldown:    10 * time.Second,
+		},
+	},
+	ProfileStandard: {
+		maxAttempts:     4,
+		timeouts:        DefaultTimeoutConfig(),
+		backoff:         BackoffStandard,
+		budgetRatio:     0.2,
+		budgetMinTokens: 10,
+		breaker:         retryabletransport.CircuitBreakerConfig{},
+	},
+	ProfileConservative: {
+		maxAttempts: 8,
+		timeouts: TimeoutConfig{
+			Connect:      30 * time.Second,
+			TLSHandshake: 10 * time.Second,
+			PerAttempt:   time.Minute,
+			Overall:      10 * time.Minute,
+		},
+		backoff:         BackoffConservative,
+		budgetRatio:     0.5,
+		budgetMinTokens: 20,
+		breaker: retryabletransport.CircuitBreakerConfig{
+			FailureRate: 0.8,
+			MinRequests: 20,
+			Window:      5 * time.Minute,
+			Cooldown:    2 * time.Minute,
+		},
+	},
+}
+
+// UnmarshalText は名前 ("aggressive", "standard", "conservative") から Profile を設定する。大文字と小文字は区別しない
+func (p *Profile) UnmarshalText(text []byte) error {
+	for profile := range profiles {
+		if strings.EqualFold(string(text), string(profile)) {
+			*p = profile
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown profile: %q", text)
+}
+
+// WithProfile は、名前付きの設定 (ProfileAggressive、ProfileStandard、ProfileConservative) の
+// 試行回数、タイムアウト、バックオフ、リトライの予算、サーキットブレーカーをまとめて設定する
+// 例: NewClient(WithProfile(ProfileAggressive), WithMaxAttempts(2))
+// NOTE: オプションは指定した順に適用されるため、WithProfile の後に指定したオプションで個別の設定を上書きできる
+// サーキットブレーカーを使用しない場合は、WithProfile の後に WithTransportOptions(retryabletransport.WithCircuitBreaker(nil)) を指定する
+// リトライの予算とサーキットブレーカーは Client ごとに作成し、複数の Client で共有しない。未知の名前を指定した場合は ProfileStandard を使用する
+func WithProfile(profile Profile) Option {
+	settings, ok := profiles[profile]
+	if !ok {
+		settings = profiles[ProfileStandard]
+	}
+	return func(c *config) {
+		WithMaxAttempts(settings.maxAttempts)(c)
+		WithTimeouts(settings.timeouts)(c)
+		WithBackoffPreset(settings.backoff)(c)
+		WithTransportOptions(
+			retryabletransport.WithRetryBudget(settings.budgetRatio, settings.budgetMinTokens),
+			retryabletransport.WithCircuitBreaker(retryabletransport.NewCircuitBreaker(settings.breaker)),
+		)(c)
+	}
+}
+
+// WithCanaryProfile は、percent パーセントのリクエストに、Client の設定の代わりに名前付きの設定の試行回数とバックオフを適用する
+// 例: NewClient(WithProfile(ProfileStandard), WithCanaryProfile(ProfileConservative, 5))
+// NOTE: タイムアウト、リトライの予算、サーキットブレーカーは Client 全体で共有するため、Client の設定を使用する
+func WithCanaryProfile(profile Profile, percent float64) Option {
+	settings, ok := profiles[profile]
+	if !ok {
+		settings = profiles[ProfileStandard]
+	}
+	backoff, _ := settings.backoff.Backoff()
+	return WithCanaryPolicy(retryabletransport.RetryPolicy{
+		MaxAttempts: settings.maxAttempts,
+		Backoff:     backoff.Backoff,
+	}, percent)
+}
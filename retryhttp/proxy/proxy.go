@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+)
+
+// defaultMaxBufferedBody はリトライのためにバッファリングするリクエストボディのデフォルトの最大サイズ
+const defaultMaxBufferedBody = 1 << 20
+
+// Proxy は受信したリクエストをリトライ可能な Transport でアップストリームに転送し、レスポンスをストリーミングで返却する
+// リバースプロキシとして動作するため、このパッケージの部品で耐障害性のある API ゲートウェイを構築できる
+// NOTE: リトライのために必要なリクエストボディのみをバッファリングし、レスポンスボディはバッファリングせずに転送する
+type Proxy struct {
+	upstream        *url.URL
+	transport       http.RoundTripper
+	streaming       http.RoundTripper
+	maxBufferedBody int64
+	responseRules   []ResponseRule
+	stripPrefix     string
+	reverseProxy    *httputil.ReverseProxy
+}
+
+// Option は Proxy の設定を変更する関数の型定義
+type Option func(*Proxy)
+
+// WithMaxBufferedBody は、リトライのためにバッファリングするリクエストボディの最大サイズを設定する
+func WithMaxBufferedBody(n int64) Option {
+	return func(p *Proxy) {
+		p.maxBufferedBody = n
+	}
+}
+
+// WithStreamingTransport は、最大サイズを超えるリクエストボディを転送する Transport を設定する
+// NOTE: 巻き戻せないボディはリトライできないため、デフォルトではリトライを行わない http.DefaultTransport で 1 回だけ転送する
+func WithStreamingTransport(transport http.RoundTripper) Option {
+	return func(p *Proxy) {
+		p.streaming = transport
+	}
+}
+
+// WithStripPrefix は、転送時にパスから prefix を取り除く。prefix はセグメント単位で一致する場合のみ取り除く
+func WithStripPrefix(prefix string) Option {
+	return func(p *Proxy) {
+		p.stripPrefix = prefix
+	}
+}
+
+// NewProxy は Proxy 構造体を作成する
+// transport にはリトライを行う Transport (例: RetryableTransport) を指定する
+func NewProxy(upstream *url.URL, transport http.RoundTripper, opts ...Option) *Proxy {
+	p := &Proxy{
+		upstream:        upstream,
+		transport:       transport,
+		streaming:       http.DefaultTransport,
+		maxBufferedBody: defaultMaxBufferedBody,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	p.reverseProxy = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			if p.stripPrefix != "" {
+				if rest, ok := trimPathPrefix(pr.Out.URL.Path, p.stripPrefix); ok {
+					pr.Out.URL.Path = rest
+					pr.Out.URL.RawPath = ""
+				}
+			}
+			pr.SetURL(p.upstream)
+			pr.SetXForwarded()
+		},
+		Transport: roundTripperFunc(p.roundTrip),
+		// ストリーミングのレスポンス (SSE など) を遅延なく転送するため、書き込みのたびにフラッシュする
+		FlushInterval: -1,
+		BufferPool:    bufferPool{},
+		ModifyResponse: func(res *http.Response) error {
+			return applyResponseRules(p.responseRules, res)
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			slog.Warn("proxy error", "upstream", p.upstream.Host, "path", r.URL.Path, "error", err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	return p
+}
+
+// ServeHTTP はリクエストをアップストリームに転送する
+// NOTE: このメソッドを実装することで、proxy.Proxy は http.Handler インターフェースを満たす
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.reverseProxy.ServeHTTP(w, r)
+}
+
+// roundTrip はリクエストボディを巻き戻せるようにバッファリングしてから転送する
+// 最大サイズを超える場合は、読み込んだ部分と残りを連結してストリーミングで転送する
+func (p *Proxy) roundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return p.transport.RoundTrip(req)
+	}
+	// NOTE: Content-Length で最大サイズを超えることがわかる場合は、最大サイズまでメモリに読み込まずにストリーミングで転送する
+	if req.ContentLength > p.maxBufferedBody {
+		return p.streaming.RoundTrip(req)
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(req.Body, p.maxBufferedBody+1))
+	if err != nil {
+		return nil, err
+	}
+
+	out := *req
+	if int64(len(buf)) > p.maxBufferedBody {
+		out.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), req.Body), req.Body}
+		return p.streaming.RoundTrip(&out)
+	}
+
+	_ = req.Body.Close()
+	out.ContentLength = int64(len(buf))
+	out.Body = io.NopCloser(bytes.NewReader(buf))
+	out.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf)), nil
+	}
+	return p.transport.RoundTrip(&out)
+}
+
+// roundTripperFunc は関数を http.RoundTripper として使用するための型
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// copyBufferSize はレスポンスボディの転送に使用するバッファのサイズ
+const copyBufferSize = 32 * 1024
+
+// buffers はレスポンスボディの転送に使用するバッファのプール
+var buffers = sync.Pool{
+	New: func() any {
+		b := make([]byte, copyBufferSize)
+		return &b
+	},
+}
+
+// bufferPool は httputil.BufferPool インターフェースを満たす sync.Pool のラッパー
+type bufferPool struct{}
+
+func (bufferPool) Get() []byte {
+	return *buffers.Get().(*[]byte)
+}
+
+func (bufferPool) Put(b []byte) {
+	buffers.Put(&b)
+}
@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// countingBody は読み込んだバイト数を数える io.ReadCloser
+type countingBody struct {
+	io.Reader
+	read atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	b.read.Add(int64(n))
+	return n, err
+}
+
+func (b *countingBody) Close() error { return nil }
+
+// recordingTransport は、受け取ったリクエストのボディを読み込んで記録し、200 を返却する http.RoundTripper
+type recordingTransport struct {
+	calls  int
+	bodies []string
+	// replays は GetBody で取得し直したボディ
+	replays []string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.calls++
+	if req.Body != nil {
+		body, _ := io.ReadAll(req.Body)
+		t.bodies = append(t.bodies, string(body))
+	}
+	if req.GetBody != nil {
+		replay, _ := req.GetBody()
+		body, _ := io.ReadAll(replay)
+		t.replays = append(t.replays, string(body))
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+func newTestProxy(retrying, streaming http.RoundTripper, opts ...Option) *Proxy {
+	upstream, _ := url.Parse("http://upstream.example.com")
+	return NewProxy(upstream, retrying, append([]Option{WithStreamingTransport(streaming), WithMaxBufferedBody(8)}, opts...)...)
+}
+
+func TestProxyRoundTripBody(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		wantRetrying  bool
+		// wantRead は、転送する Transport を選択するまでに読み込むバイト数
+		wantRead int64
+	}{
+		{"buffered", "12345678", 8, true, 8},
+		{"buffered without length", "1234", -1, true, 4},
+		{"too large without length", "123456789", -1, false, 9},
+		// Content-Length で最大サイズを超えることがわかる場合は、読み込まずにストリーミングで転送する
+		{"too large with length", "123456789", 9, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retrying, streaming := &recordingTransport{}, &recordingTransport{}
+			p := newTestProxy(retrying, streaming)
+			body := &countingBody{Reader: strings.NewReader(tt.body)}
+			req, _ := http.NewRequest(http.MethodPost, "http://upstream.example.com/items", nil)
+			req.Body, req.ContentLength = body, tt.contentLength
+
+			var read int64
+			selected := func(rt *recordingTransport) http.RoundTripper {
+				return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+					read = body.read.Load()
+					return rt.RoundTrip(r)
+				})
+			}
+			p.transport, p.streaming = selected(retrying), selected(streaming)
+
+			if _, err := p.roundTrip(req); err != nil {
+				t.Fatal(err)
+			}
+			got, other := streaming, retrying
+			if tt.wantRetrying {
+				got, other = retrying, streaming
+			}
+			if got.calls != 1 || other.calls != 0 {
+				t.Fatalf("retrying calls = %d, streaming calls = %d", retrying.calls, streaming.calls)
+			}
+			if got.bodies[0] != tt.body {
+				t.Errorf("forwarded body = %q, want %q", got.bodies[0], tt.body)
+			}
+			if tt.wantRetrying && (len(got.replays) != 1 || got.replays[0] != tt.body) {
+				t.Errorf("GetBody = %q, want %q", got.replays, tt.body)
+			}
+			if read != tt.wantRead {
+				t.Errorf("bytes read before forwarding = %d, want %d", read, tt.wantRead)
+			}
+		})
+	}
+}
+
+func TestProxyServeHTTP(t *testing.T) {
+	var received *http.Request
+	var body string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.Header().Set("X-Upstream", "1")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "created")
+	}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL)
+	p := NewProxy(target, http.DefaultTransport, WithStripPrefix("/api"))
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "http://gateway.example.com/api/items?x=1", strings.NewReader("payload")))
+
+	if rec.Code != http.StatusCreated || rec.Body.String() != "created" || rec.Header().Get("X-Upstream") != "1" {
+		t.Errorf("response = %d %q %v, want the upstream response", rec.Code, rec.Body.String(), rec.Header())
+	}
+	if received.URL.Path != "/items" || received.URL.RawQuery != "x=1" || body != "payload" {
+		t.Errorf("upstream request = %s %q, want /items?x=1 with the body", received.URL, body)
+	}
+	if received.Header.Get("X-Forwarded-Host") != "gateway.example.com" {
+		t.Errorf("X-Forwarded-Host = %q, want gateway.example.com", received.Header.Get("X-Forwarded-Host"))
+	}
+}
+
+func TestProxyUpstreamError(t *testing.T) {
+	failing := roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		return nil, io.ErrUnexpectedEOF
+	})
+	p := newTestProxy(failing, failing)
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://gateway.example.com/", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want 502", rec.Code)
+	}
+}
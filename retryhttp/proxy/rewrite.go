@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ResponseRule は、アップストリームのレスポンスをクライアントに返却する前に書き換える関数の型定義
+// NOTE: hop-by-hop ヘッダー (Connection, Keep-Alive など) は httputil.ReverseProxy によって事前に削除されている
+type ResponseRule func(res *http.Response) error
+
+// WithResponseRules は、レスポンスを書き換えるルールを追加する。ルールは追加した順に適用される
+func WithResponseRules(rules ...ResponseRule) Option {
+	return func(p *Proxy) {
+		p.responseRules = append(p.responseRules, rules...)
+	}
+}
+
+// StripHeaders は指定したヘッダーを削除するルールを返却する
+// NOTE: Server や X-Powered-By などアップストリームの内部情報や、Alt-Svc などプロキシ越しでは意味を持たないヘッダーの削除に使用する
+func StripHeaders(names ...string) ResponseRule {
+	return func(res *http.Response) error {
+		for _, name := range names {
+			res.Header.Del(name)
+		}
+		return nil
+	}
+}
+
+// RewriteLocation は、アップストリームを指す Location ヘッダーをクライアントから見た URL に書き換えるルールを返却する
+// public はクライアントから見たプロキシのベース URL (例: https://gateway.example.com/api)
+func RewriteLocation(public *url.URL) ResponseRule {
+	return func(res *http.Response) error {
+		location := res.Header.Get("Location")
+		if location == "" || res.Request == nil {
+			return nil
+		}
+		u, err := url.Parse(location)
+		if err != nil {
+			return nil
+		}
+		upstream := res.Request.URL
+		if u.IsAbs() && u.Host != upstream.Host {
+			// 外部へのリダイレクトは書き換えない
+			return nil
+		}
+
+		rewritten := *public
+		rewritten.Path = strings.TrimSuffix(public.Path, "/") + "/" + strings.TrimPrefix(u.Path, "/")
+		rewritten.RawPath = ""
+		rewritten.RawQuery = u.RawQuery
+		rewritten.Fragment = u.Fragment
+		res.Header.Set("Location", rewritten.String())
+		return nil
+	}
+}
+
+// ErrorMapper は、アップストリームのエラーレスポンスのボディをゲートウェイのエラー形式に変換する関数の型定義
+type ErrorMapper func(statusCode int, contentType string, body []byte) (newBody []byte, newContentType string)
+
+// MapErrors は、ステータスコードが 400 以上のレスポンスのボディを mapper で変換するルールを返却する
+// maxBytes を超えるボディは変換せずにそのまま転送する
+func MapErrors(maxBytes int64, mapper ErrorMapper) ResponseRule {
+	return func(res *http.Response) error {
+		if res.StatusCode < http.StatusBadRequest || res.Body == nil {
+			return nil
+		}
+
+		body, err := io.ReadAll(io.LimitReader(res.Body, maxBytes+1))
+		if err != nil {
+			return err
+		}
+		if int64(len(body)) > maxBytes {
+			res.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), res.Body), res.Body}
+			return nil
+		}
+		_ = res.Body.Close()
+
+		newBody, contentType := mapper(res.StatusCode, res.Header.Get("Content-Type"), body)
+		res.Body = io.NopCloser(bytes.NewReader(newBody))
+		res.ContentLength = int64(len(newBody))
+		res.Header.Set("Content-Length", strconv.Itoa(len(newBody)))
+		res.Header.Del("Content-Encoding")
+		if contentType != "" {
+			res.Header.Set("Content-Type", contentType)
+		}
+		return nil
+	}
+}
+
+// applyResponseRules はルールを順に適用する
+func applyResponseRules(rules []ResponseRule, res *http.Response) error {
+	for _, rule := range rules {
+		if err := rule(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
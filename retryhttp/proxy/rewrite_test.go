@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// upstreamResponse は http://upstream.example.com/items へのリクエストに対するレスポンスを作成する
+func upstreamResponse(status int, header http.Header, body string) *http.Response {
+	req, _ := http.NewRequest(http.MethodGet, "http://upstream.example.com/items", nil)
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{StatusCode: status, Header: header, Body: io.NopCloser(strings.NewReader(body)), Request: req}
+}
+
+func TestStripHeaders(t *testing.T) {
+	res := upstreamResponse(http.StatusOK, http.Header{
+		"Server":       {"nginx"},
+		"X-Powered-By": {"php"},
+		"Content-Type": {"text/plain"},
+	}, "")
+
+	if err := StripHeaders("Server", "x-powered-by")(res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Header) != 1 || res.Header.Get("Content-Type") != "text/plain" {
+		t.Errorf("headers = %v, want only Content-Type", res.Header)
+	}
+}
+
+func TestRewriteLocation(t *testing.T) {
+	public, _ := url.Parse("https://gateway.example.com/api/")
+	tests := []struct {
+		name     string
+		location string
+		want     string
+	}{
+		{"relative", "/items/1?x=1#top", "https://gateway.example.com/api/items/1?x=1#top"},
+		{"upstream absolute", "http://upstream.example.com/items/1", "https://gateway.example.com/api/items/1"},
+		{"external", "https://auth.example.com/login", "https://auth.example.com/login"},
+		{"missing", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := upstreamResponse(http.StatusFound, http.Header{}, "")
+			if tt.location != "" {
+				res.Header.Set("Location", tt.location)
+			}
+			if err := RewriteLocation(public)(res); err != nil {
+				t.Fatal(err)
+			}
+			if got := res.Header.Get("Location"); got != tt.want {
+				t.Errorf("Location = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// gatewayError は、エラーレスポンスをゲートウェイの JSON 形式に変換する ErrorMapper
+func gatewayError(statusCode int, contentType string, body []byte) ([]byte, string) {
+	return []byte(`{"upstream":"` + contentType + `","message":"` + string(body) + `"}`), "application/json"
+}
+
+func TestMapErrors(t *testing.T) {
+	tests := []struct {
+		name            string
+		status          int
+		body            string
+		wantBody        string
+		wantContentType string
+	}{
+		{"error", http.StatusNotFound, "missing", `{"upstream":"text/plain","message":"missing"}`, "application/json"},
+		{"success", http.StatusOK, "ok", "ok", "text/plain"},
+		// maxBytes を超えるボディは変換せずに転送する
+		{"too large", http.StatusInternalServerError, "0123456789", "0123456789", "text/plain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := upstreamResponse(tt.status, http.Header{
+				"Content-Type":     {"text/plain"},
+				"Content-Encoding": {"identity"},
+			}, tt.body)
+			if err := MapErrors(8, gatewayError)(res); err != nil {
+				t.Fatal(err)
+			}
+
+			body, _ := io.ReadAll(res.Body)
+			if string(body) != tt.wantBody || res.Header.Get("Content-Type") != tt.wantContentType {
+				t.Errorf("response = %q %s, want %q %s", body, res.Header.Get("Content-Type"), tt.wantBody, tt.wantContentType)
+			}
+			mapped := tt.wantBody != tt.body
+			if mapped && (res.ContentLength != int64(len(body)) || res.Header.Get("Content-Encoding") != "") {
+				t.Errorf("Content-Length = %d, Content-Encoding = %q after mapping", res.ContentLength, res.Header.Get("Content-Encoding"))
+			}
+		})
+	}
+}
+
+func TestApplyResponseRulesStopsOnError(t *testing.T) {
+	errRule := errors.New("rule failed")
+	var applied []string
+	rule := func(name string, err error) ResponseRule {
+		return func(*http.Response) error {
+			applied = append(applied, name)
+			return err
+		}
+	}
+
+	err := applyResponseRules([]ResponseRule{rule("first", nil), rule("second", errRule), rule("third", nil)}, upstreamResponse(http.StatusOK, nil, ""))
+	if !errors.Is(err, errRule) || strings.Join(applied, ",") != "first,second" {
+		t.Errorf("applied %q with %v, want first,second with %v", applied, err, errRule)
+	}
+}
+
+func TestProxyResponseRules(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "upstream")
+		w.Header().Set("Location", "/items/1")
+		w.WriteHeader(http.StatusConflict)
+		io.WriteString(w, "conflict")
+	}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL)
+	public, _ := url.Parse("https://gateway.example.com/api")
+	p := NewProxy(target, http.DefaultTransport, WithResponseRules(StripHeaders("Server"), RewriteLocation(public), MapErrors(1024, gatewayError)))
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "http://gateway.example.com/items/1", nil))
+
+	if rec.Code != http.StatusConflict || rec.Header().Get("Server") != "" {
+		t.Errorf("response = %d with Server %q, want 409 without Server", rec.Code, rec.Header().Get("Server"))
+	}
+	if got := rec.Header().Get("Location"); got != "https://gateway.example.com/api/items/1" {
+		t.Errorf("Location = %q", got)
+	}
+	if got := rec.Body.String(); !strings.Contains(got, `"message":"conflict"`) {
+		t.Errorf("body = %q, want the mapped error", got)
+	}
+}
@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Route はプロキシのルート定義。パスのプレフィックスに一致したリクエストを Upstream に転送する
+type Route struct {
+	// Prefix は一致させるパスのプレフィックス (例: /users/)
+	Prefix string
+	// Upstream は転送先のベース URL
+	Upstream *url.URL
+	// StripPrefix が true の場合は、Prefix を取り除いたパスで転送する
+	StripPrefix bool
+	// Auth は認証を行う Transport を作成する関数 (例: auth.NewBearerTransport をラップした関数)
+	// NOTE: Policy の内側に配置されるため、リトライのたびに認証情報を付与し直す
+	Auth func(next http.RoundTripper) http.RoundTripper
+	// Policy はリトライなどのポリシーを適用する Transport を作成する関数 (例: RetryableTransport を作成する関数)
+	// nil の場合はリトライを行わない
+	Policy func(next http.RoundTripper) http.RoundTripper
+	// Options はルートごとの Proxy の設定 (レスポンスの書き換えルールなど)
+	Options []Option
+}
+
+// Router はパスのプレフィックスでルートを選択し、ルートごとの Proxy に転送する http.Handler の具象型
+// プレフィックスはセグメント単位で一致させる。例えば /users は /users と /users/1 に一致し、/usersettings には一致しない
+// NOTE: 複数のルートに一致する場合は、最も長いプレフィックスのルートを選択する
+type Router struct {
+	routes  []Route
+	proxies []*Proxy
+}
+
+// NewRouter は Router 構造体を作成する
+// base は全ルートで共有する Transport (コネクションプール)。nil の場合は http.DefaultTransport を使用する
+func NewRouter(base http.RoundTripper, routes ...Route) *Router {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	sorted := make([]Route, len(routes))
+	copy(sorted, routes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].Prefix) > len(sorted[j].Prefix)
+	})
+
+	proxies := make([]*Proxy, len(sorted))
+	for i, route := range sorted {
+		transport := base
+		if route.Auth != nil {
+			transport = route.Auth(transport)
+		}
+		if route.Policy != nil {
+			transport = route.Policy(transport)
+		}
+
+		opts := route.Options
+		if route.StripPrefix {
+			opts = append([]Option{WithStripPrefix(route.Prefix)}, opts...)
+		}
+		proxies[i] = NewProxy(route.Upstream, transport, opts...)
+	}
+
+	return &Router{
+		routes:  sorted,
+		proxies: proxies,
+	}
+}
+
+// ServeHTTP は一致するルートの Proxy にリクエストを転送する。一致するルートがない場合は 404 を返却する
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	for i, route := range r.routes {
+		if _, ok := trimPathPrefix(req.URL.Path, route.Prefix); ok {
+			r.proxies[i].ServeHTTP(w, req)
+			return
+		}
+	}
+	http.NotFound(w, req)
+}
+
+// trimPathPrefix は、path が prefix にセグメント単位で一致する場合に、prefix を取り除いた "/" から始まるパスを返却する
+// prefix の末尾の "/" は無視するため、/users/ は /users にも一致する
+func trimPathPrefix(path, prefix string) (string, bool) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if !strings.HasPrefix(path, prefix) {
+		return "", false
+	}
+	rest := path[len(prefix):]
+	if rest == "" {
+		return "/", true
+	}
+	if rest[0] != '/' {
+		return "", false
+	}
+	return rest, true
+}
@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestTrimPathPrefix(t *testing.T) {
+	tests := []struct {
+		path, prefix string
+		want         string
+		wantOK       bool
+	}{
+		{"/users", "/users", "/", true},
+		{"/users/1", "/users", "/1", true},
+		{"/users/1", "/users/", "/1", true},
+		{"/users", "/users/", "/", true},
+		{"/usersettings", "/users", "", false},
+		{"/usersettings", "/users/", "", false},
+		{"/user", "/users", "", false},
+		{"/anything", "/", "/anything", true},
+		{"/", "/", "/", true},
+	}
+	for _, tt := range tests {
+		got, ok := trimPathPrefix(tt.path, tt.prefix)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("trimPathPrefix(%q, %q) = %q, %v, want %q, %v", tt.path, tt.prefix, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestRouter(t *testing.T) {
+	// received は、アップストリームが受け取ったリクエストのホストとパス
+	var received []string
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		received = append(received, req.URL.Host+req.URL.Path)
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	})
+	upstream := func(host string) *url.URL {
+		return &url.URL{Scheme: "http", Host: host}
+	}
+	var authorized []string
+	router := NewRouter(base,
+		Route{Prefix: "/", Upstream: upstream("default")},
+		Route{Prefix: "/users/", Upstream: upstream("users"), StripPrefix: true},
+		Route{Prefix: "/users/admin", Upstream: upstream("admin"), Auth: func(next http.RoundTripper) http.RoundTripper {
+			return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				authorized = append(authorized, req.URL.Path)
+				return next.RoundTrip(req)
+			})
+		}},
+	)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/users/1", "users/1"},
+		{"/users", "users/"},
+		{"/usersettings", "default/usersettings"},
+		{"/users/admin/keys", "admin/users/admin/keys"},
+		{"/users/administrator", "users/administrator"},
+		{"/", "default/"},
+	}
+	for _, tt := range tests {
+		received = nil
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://gateway.example.com"+tt.path, nil))
+		if rec.Code != http.StatusOK || len(received) != 1 || received[0] != tt.want {
+			t.Errorf("%s forwarded to %q (status %d), want %q", tt.path, received, rec.Code, tt.want)
+		}
+	}
+	if len(authorized) != 1 || authorized[0] != "/users/admin/keys" {
+		t.Errorf("authorized requests = %q, want only the admin route", authorized)
+	}
+}
+
+func TestRouterNotFound(t *testing.T) {
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		t.Errorf("unexpected request to %s", req.URL)
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	})
+	router := NewRouter(base, Route{Prefix: "/api", Upstream: &url.URL{Scheme: "http", Host: "api"}})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://gateway.example.com/apis", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+}
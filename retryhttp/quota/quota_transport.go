@@ -0,0 +1,77 @@
+package quota
+
+import (
+	"io"
+	"net/http"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// QuotaTransport はテナントごとの送信量を Tracker に記録するための http.RoundTripper 具象型
+// テナントはリクエストの context.Context に付与されたアノテーションから取得する
+// NOTE: RetryableTransport の内側に配置すると、リトライを含む実際の送信量を記録する
+type QuotaTransport struct {
+	wrapped   http.RoundTripper
+	tracker   *Tracker
+	tenantKey string
+}
+
+// NewQuotaTransport は QuotaTransport 構造体を作成する
+// tenantKey はテナントを格納しているアノテーションのキー (例: "tenant")
+func NewQuotaTransport(transport http.RoundTripper, tracker *Tracker, tenantKey string) *QuotaTransport {
+	return &QuotaTransport{
+		wrapped:   transport,
+		tracker:   tracker,
+		tenantKey: tenantKey,
+	}
+}
+
+// transport は親の Transport を返却する。親がない場合は、http.DefaultTransport を返却する
+func (t *QuotaTransport) transport() http.RoundTripper {
+	if t.wrapped == nil {
+		return http.DefaultTransport
+	}
+	return t.wrapped
+}
+
+// RoundTrip は送信量を記録してリクエストを送信する。テナントの上限に達している場合は *QuotaExceededError を返却する
+func (t *QuotaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tenant := retryabletransport.AnnotationsFromContext(req.Context())[t.tenantKey]
+
+	var requestBytes int64
+	if req.ContentLength > 0 {
+		requestBytes = req.ContentLength
+	}
+	if err := t.tracker.acquire(tenant, requestBytes); err != nil {
+		return nil, err
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		counted := *req
+		counted.Body = &countingBody{ReadCloser: req.Body, add: func(n int64) { t.tracker.addRequestBytes(tenant, n) }}
+		req = &counted
+	}
+
+	res, err := t.transport().RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.Body != nil {
+		res.Body = &countingBody{ReadCloser: res.Body, add: func(n int64) { t.tracker.addResponseBytes(tenant, n) }}
+	}
+	return res, nil
+}
+
+// countingBody は読み込んだバイト数を通知する io.ReadCloser の具象型
+type countingBody struct {
+	io.ReadCloser
+	add func(n int64)
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.add(int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,111 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// echoTransport は、リクエストボディを読み込み、response をボディとする 200 を返却する http.RoundTripper
+type echoTransport struct {
+	response string
+	calls    int
+}
+
+func (t *echoTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.calls++
+	if req.Body != nil {
+		_, _ = io.Copy(io.Discard, req.Body)
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(t.response)), Request: req}, nil
+}
+
+// send は tenant のアノテーションを付与したリクエストを送信し、レスポンスボディを読み切る
+func send(transport http.RoundTripper, tenant string, body string) error {
+	ctx := retryabletransport.Annotate(context.Background(), "tenant", tenant)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "http://example.com/", strings.NewReader(body))
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, err = io.Copy(io.Discard, res.Body)
+	return err
+}
+
+func TestQuotaTransportUsage(t *testing.T) {
+	tracker := NewTracker()
+	transport := NewQuotaTransport(&echoTransport{response: "0123456789"}, tracker, "tenant")
+
+	for _, tenant := range []string{"acme", "acme", "globex"} {
+		if err := send(transport, tenant, "abcd"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]Usage{
+		"acme":   {Requests: 2, RequestBytes: 8, ResponseBytes: 20},
+		"globex": {Requests: 1, RequestBytes: 4, ResponseBytes: 10},
+	}
+	snapshot := tracker.Snapshot()
+	if len(snapshot) != len(want) {
+		t.Fatalf("Snapshot = %+v, want %+v", snapshot, want)
+	}
+	for tenant, usage := range want {
+		if snapshot[tenant] != usage || tracker.Usage(tenant) != usage {
+			t.Errorf("usage of %s = %+v, want %+v", tenant, snapshot[tenant], usage)
+		}
+	}
+
+	tracker.Reset("acme")
+	if got := tracker.Usage("acme"); got != (Usage{}) {
+		t.Errorf("usage after Reset = %+v, want zero", got)
+	}
+}
+
+func TestQuotaTransportLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  Limit
+		tenant string
+		// wantSent は上限に達するまでに送信するリクエスト数
+		wantSent int
+	}{
+		{"requests", Limit{Requests: 2}, "acme", 2},
+		// リクエストボディが 4 バイト、レスポンスボディが 10 バイトのため、2 件目で 28 バイトになる
+		// 3 件目はリクエストボディを加えると上限を超えるため、送信しない
+		{"bytes", Limit{Bytes: 31}, "acme", 2},
+		{"bytes up to the limit", Limit{Bytes: 32}, "acme", 3},
+		{"default limit", Limit{}, "globex", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewTracker()
+			tracker.SetDefaultLimit(Limit{Requests: 1})
+			tracker.SetLimit("acme", tt.limit)
+			upstream := &echoTransport{response: "0123456789"}
+			transport := NewQuotaTransport(upstream, tracker, "tenant")
+
+			var err error
+			for i := 0; i < 10 && err == nil; i++ {
+				err = send(transport, tt.tenant, "abcd")
+			}
+
+			var exceeded *QuotaExceededError
+			if !errors.As(err, &exceeded) {
+				t.Fatalf("err = %v, want *QuotaExceededError", err)
+			}
+			if exceeded.Tenant != tt.tenant || exceeded.Usage.Requests != int64(tt.wantSent) {
+				t.Errorf("err = %+v, want tenant %s after %d requests", exceeded, tt.tenant, tt.wantSent)
+			}
+			if upstream.calls != tt.wantSent {
+				t.Errorf("upstream calls = %d, want %d", upstream.calls, tt.wantSent)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package quota
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Usage はテナントごとの送信量
+type Usage struct {
+	// Requests は送信したリクエスト数 (リトライを含む)
+	Requests int64
+	// RequestBytes は送信したリクエストボディのバイト数
+	RequestBytes int64
+	// ResponseBytes は受信したレスポンスボディのバイト数
+	ResponseBytes int64
+}
+
+// Limit はテナントごとの送信量の上限。0 の項目は上限なしとする
+type Limit struct {
+	Requests int64
+	// Bytes はリクエストボディとレスポンスボディの合計バイト数の上限
+	Bytes int64
+}
+
+// QuotaExceededError は、テナントの送信量が上限に達したためリクエストを送信しなかったことを表すエラー
+type QuotaExceededError struct {
+	Tenant string
+	Usage  Usage
+	Limit  Limit
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("egress quota exceeded for tenant %q: requests=%d/%d bytes=%d/%d",
+		e.Tenant, e.Usage.Requests, e.Limit.Requests, e.Usage.RequestBytes+e.Usage.ResponseBytes, e.Limit.Bytes)
+}
+
+// Tracker はテナントごとの送信量を集計し、上限を超えたリクエストを拒否する
+// NOTE: 課金やクォータの管理に使用するため、集計値は Reset を呼ぶまで累積する
+type Tracker struct {
+	mu           sync.Mutex
+	usage        map[string]*Usage
+	limits       map[string]Limit
+	defaultLimit Limit
+}
+
+// NewTracker は Tracker 構造体を作成する
+func NewTracker() *Tracker {
+	return &Tracker{
+		usage:  make(map[string]*Usage),
+		limits: make(map[string]Limit),
+	}
+}
+
+// SetLimit はテナントの上限を設定する
+func (t *Tracker) SetLimit(tenant string, limit Limit) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.limits[tenant] = limit
+}
+
+// SetDefaultLimit は個別に上限を設定していないテナントの上限を設定する
+func (t *Tracker) SetDefaultLimit(limit Limit) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.defaultLimit = limit
+}
+
+// Usage はテナントの送信量を返却する
+func (t *Tracker) Usage(tenant string) Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if u, ok := t.usage[tenant]; ok {
+		return *u
+	}
+	return Usage{}
+}
+
+// Snapshot はすべてのテナントの送信量を返却する
+func (t *Tracker) Snapshot() map[string]Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	snapshot := make(map[string]Usage, len(t.usage))
+	for tenant, u := range t.usage {
+		snapshot[tenant] = *u
+	}
+	return snapshot
+}
+
+// Reset はテナントの送信量をリセットする。課金期間の切り替え時などに使用する
+func (t *Tracker) Reset(tenant string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.usage, tenant)
+}
+
+// acquire は上限を確認し、リクエスト数を加算する。上限に達している場合は *QuotaExceededError を返却する
+func (t *Tracker) acquire(tenant string, requestBytes int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	u := t.usageOf(tenant)
+	limit, ok := t.limits[tenant]
+	if !ok {
+		limit = t.defaultLimit
+	}
+	if (limit.Requests > 0 && u.Requests >= limit.Requests) ||
+		(limit.Bytes > 0 && u.RequestBytes+u.ResponseBytes+requestBytes > limit.Bytes) {
+		return &QuotaExceededError{Tenant: tenant, Usage: *u, Limit: limit}
+	}
+	u.Requests++
+	return nil
+}
+
+// addRequestBytes はリクエストボディのバイト数を加算する
+func (t *Tracker) addRequestBytes(tenant string, n int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.usageOf(tenant).RequestBytes += n
+}
+
+// addResponseBytes はレスポンスボディのバイト数を加算する
+func (t *Tracker) addResponseBytes(tenant string, n int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.usageOf(tenant).ResponseBytes += n
+}
+
+// usageOf はテナントの集計値を返却する。存在しない場合は作成する
+// NOTE: 呼び出し元でロックを取得している必要がある
+func (t *Tracker) usageOf(tenant string) *Usage {
+	u, ok := t.usage[tenant]
+	if !ok {
+		u = &Usage{}
+		t.usage[tenant] = u
+	}
+	return u
+}
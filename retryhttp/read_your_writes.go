@@ -0,0 +1,132 @@
+package retryhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrWriteNotVisible は、書き込みの結果が制限時間内に読み込み先に反映されなかったことを表すエラー
+var ErrWriteNotVisible = errors.New("write did not become visible in time")
+
+// VisibilityFunc は、読み込んだレスポンスに書き込みの結果が反映されているか判定する関数の型定義
+// body はバッファリング済みのレスポンスボディ。反映を待っても成功しない場合はエラーを返却する
+type VisibilityFunc func(res *http.Response, body []byte) (visible bool, err error)
+
+// ExpectETag は、ETag ヘッダーが etag と一致した場合に反映されたと判定する VisibilityFunc を返却する
+// NOTE: 弱い ETag (W/) は区別せずに比較する
+func ExpectETag(etag string) VisibilityFunc {
+	want := strings.TrimPrefix(etag, "W/")
+	return func(res *http.Response, _ []byte) (bool, error) {
+		return strings.TrimPrefix(res.Header.Get("ETag"), "W/") == want, nil
+	}
+}
+
+// ExpectField は、JSON のレスポンスボディの field が value と一致した場合に反映されたと判定する VisibilityFunc を返却する
+// field はドット区切りでネストしたフィールドを指定できる (例: "metadata.version")
+func ExpectField(field string, value any) VisibilityFunc {
+	want, err := json.Marshal(value)
+	return func(_ *http.Response, body []byte) (bool, error) {
+		if err != nil {
+			return false, err
+		}
+		var doc any
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return false, nil
+		}
+		for _, key := range strings.Split(field, ".") {
+			object, ok := doc.(map[string]any)
+			if !ok {
+				return false, nil
+			}
+			if doc, ok = object[key]; !ok {
+				return false, nil
+			}
+		}
+		got, err := json.Marshal(doc)
+		if err != nil {
+			return false, nil
+		}
+		return bytes.Equal(got, want), nil
+	}
+}
+
+// WaitForWrite は、書き込みの後に readURL を GET で読み込み、visible が反映されたと判定するまで繰り返し読み込んで、反映されたレスポンスを返却する
+// 404 Not Found は反映前とみなして読み込みを繰り返し、それ以外のエラーレスポンスは StatusError を返却する
+// 制限時間内に反映されなかった場合は ErrWriteNotVisible を返却する。レスポンスボディのクローズは呼び出し元で行う必要がある
+// NOTE: 結果整合性の API で、書き込んだ直後の読み込みが古い結果を返却する場合に使用する
+// WithPollBackoff と WithPollTimeout で読み込みの間隔と制限時間を変更できる。デフォルトは 100 ミリ秒から 5 秒までの指数バックオフと 30 秒の制限時間
+func (c *Client) WaitForWrite(ctx context.Context, readURL string, visible VisibilityFunc,
+	opts ...PollOption) (*http.Response, error) {
+	config := pollConfig{
+		backoff: readBackoff,
+		timeout: 30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	pollCtx, cancel := context.WithTimeout(ctx, config.timeout)
+	defer cancel()
+
+	for attempts := 1; ; attempts++ {
+		res, body, err := c.readBack(pollCtx, readURL)
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				return nil, fmt.Errorf("%w: %d reads of %s", ErrWriteNotVisible, attempts, readURL)
+			}
+			return nil, err
+		}
+		if res.StatusCode != http.StatusNotFound {
+			if res.StatusCode >= http.StatusBadRequest {
+				return nil, &StatusError{StatusCode: res.StatusCode, Status: res.Status, Problem: decodeProblem(res.Header, body)}
+			}
+			ok, err := visible(res, body)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				res.Body = io.NopCloser(bytes.NewReader(body))
+				return res, nil
+			}
+		}
+
+		timer := time.NewTimer(config.backoff(attempts))
+		select {
+		case <-pollCtx.Done():
+			timer.Stop()
+			if ctx.Err() == nil {
+				return nil, fmt.Errorf("%w: %d reads of %s", ErrWriteNotVisible, attempts, readURL)
+			}
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// readBack は readURL に GET リクエストを送信し、レスポンスボディをバッファリングする
+func (c *Client) readBack(ctx context.Context, readURL string) (*http.Response, []byte, error) {
+	res, err := c.Get(ctx, readURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer closeBody(res)
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxPollBodySize))
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, body, nil
+}
+
+// readBackoff は WaitForWrite の読み込みの間隔のデフォルト。100 ミリ秒から倍々に増加し、5 秒を上限とする
+func readBackoff(attempts int) time.Duration {
+	wait := 100 * time.Millisecond << min(attempts-1, 6)
+	return min(wait, 5*time.Second)
+}
@@ -0,0 +1,95 @@
+package retryhttp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// ErrBodyNotReplayable は、上限を超えたためにバッファリングされなかったレスポンスボディを巻き戻そうとした場合のエラー
+var ErrBodyNotReplayable = errors.New("response body exceeds the buffering limit and cannot be replayed")
+
+// WithResponseBuffering は、レスポンスボディを limit バイトまでメモリに読み込み、繰り返し読み込める ReplayableBody に置き換える
+// limit が 0 以下の場合はバッファリングしない
+// NOTE: ログの出力とデコードの両方でボディを読み込む場合に、io.TeeReader などで複製する手間を省くために使用する
+// limit を超えるボディは先頭のみ読み込んだ状態で返却し、巻き戻すことはできない
+func WithResponseBuffering(limit int64) Option {
+	return func(c *config) {
+		c.bufferLimit = limit
+	}
+}
+
+// ReplayableBody は、バッファリングしたレスポンスボディの io.ReadCloser 具象型
+// res.Body を *ReplayableBody に型アサーションして使用する
+type ReplayableBody struct {
+	buf    []byte
+	reader *bytes.Reader
+	// rest は上限を超えたため読み込んでいないボディの残り。全体をバッファリングした場合は nil
+	rest   io.ReadCloser
+	closed bool
+}
+
+// bufferBody は、レスポンスボディを limit バイトまで読み込んだ ReplayableBody に置き換える
+func bufferBody(res *http.Response, limit int64) error {
+	if res == nil || res.Body == nil || res.Body == http.NoBody {
+		return nil
+	}
+	if _, ok := res.Body.(*ReplayableBody); ok {
+		return nil
+	}
+
+	// NOTE: 上限を超えたか判定するため、1 バイト多く読み込む
+	buf, err := io.ReadAll(io.LimitReader(res.Body, limit+1))
+	if err != nil {
+		_ = res.Body.Close()
+		return err
+	}
+
+	body := &ReplayableBody{buf: buf, reader: bytes.NewReader(buf)}
+	if int64(len(buf)) > limit {
+		body.rest = res.Body
+	} else {
+		// NOTE: ボディを読み切っているため、コネクションを再利用できるように先にクローズする
+		_ = res.Body.Close()
+	}
+	res.Body = body
+	return nil
+}
+
+func (b *ReplayableBody) Read(p []byte) (int, error) {
+	if b.closed && b.rest != nil {
+		return 0, http.ErrBodyReadAfterClose
+	}
+	n, err := b.reader.Read(p)
+	if err == io.EOF && b.rest != nil {
+		return b.rest.Read(p)
+	}
+	return n, err
+}
+
+// Close はボディをクローズする
+// NOTE: 全体をバッファリングしている場合は、クローズ後も Rewind して読み込める
+func (b *ReplayableBody) Close() error {
+	b.closed = true
+	if b.rest != nil {
+		return b.rest.Close()
+	}
+	return nil
+}
+
+// Rewind は、ボディを先頭から読み込めるように巻き戻す
+// 上限を超えたためにバッファリングされていない場合は ErrBodyNotReplayable を返却する
+func (b *ReplayableBody) Rewind() error {
+	if b.rest != nil {
+		return ErrBodyNotReplayable
+	}
+	_, err := b.reader.Seek(0, io.SeekStart)
+	return err
+}
+
+// Bytes は、バッファリングしたボディを返却する
+// 上限を超えたためにボディ全体をバッファリングしていない場合は、読み込んだ先頭と false を返却する
+func (b *ReplayableBody) Bytes() ([]byte, bool) {
+	return b.buf, b.rest == nil
+}
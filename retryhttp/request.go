@@ -0,0 +1,121 @@
+package retryhttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// RequestOption は、リクエストごとの設定を変更する関数の型定義
+type RequestOption func(*http.Request)
+
+// WithHeader はリクエストヘッダーを設定する
+func WithHeader(key string, value string) RequestOption {
+	return func(req *http.Request) {
+		req.Header.Set(key, value)
+	}
+}
+
+// WithBasicAuth は Basic 認証の Authorization ヘッダーを設定する
+func WithBasicAuth(username string, password string) RequestOption {
+	return func(req *http.Request) {
+		req.SetBasicAuth(username, password)
+	}
+}
+
+// WithBearer は Bearer トークンの Authorization ヘッダーを設定する
+func WithBearer(token string) RequestOption {
+	return func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// WithRetryPolicy はリクエストに適用するリトライポリシーを設定する
+func WithRetryPolicy(policy retryabletransport.RetryPolicy) RequestOption {
+	return func(req *http.Request) {
+		*req = *req.WithContext(retryabletransport.WithRetryPolicy(req.Context(), policy))
+	}
+}
+
+// NoRetry は、ctx で送信するリクエストをリトライしない context.Context を返却する
+// 例: res, err := client.Get(retryhttp.NoRetry(ctx), url)
+// NOTE: ユーザーが応答を待つ遅延に敏感な処理で、リトライしない Client を別に作成せずに、呼び出しごとにリトライを止める
+// WithRetryPolicy やホストのリトライポリシーで試行回数を指定している場合も、NoRetry を優先する
+func NoRetry(ctx context.Context) context.Context {
+	return retryabletransport.WithoutRetry(ctx)
+}
+
+// ForceRetry は、ctx で送信するリクエストを最初の試行を含めて最大 n 回試行する context.Context を返却する
+// WithRetryPolicy やホストのリトライポリシーより優先し、WithMaxAttemptsByClass と WithAdaptiveRetry による試行回数の削減も行わない
+// NOTE: リトライするかの判定とリトライの予算、サーキットブレーカーは Client の設定に従う。冪等でないリクエストはリトライしない
+func ForceRetry(ctx context.Context, n int) context.Context {
+	return retryabletransport.WithForcedRetry(ctx, n)
+}
+
+// WithCost は、レート制限のトークンバケットから試行ごとに消費するトークンの数を設定する。デフォルトは 1
+// NOTE: レポートの生成などの重いリクエストに、送信先の API のドキュメントに記載されたコストを指定する
+func WithCost(cost int) RequestOption {
+	return func(req *http.Request) {
+		*req = *req.WithContext(retryabletransport.WithRequestCost(req.Context(), cost))
+	}
+}
+
+// WithCaller は、リクエストの呼び出し元の識別子を設定する
+// WithMaxConcurrentRequestsPerHost で fair に true を指定した場合は、呼び出し元ごとに順番に枠を割り当てる
+func WithCaller(caller string) RequestOption {
+	return func(req *http.Request) {
+		*req = *req.WithContext(retryabletransport.WithCaller(req.Context(), caller))
+	}
+}
+
+// WithAnnotations はリクエストにアノテーション (キーと値の組) を付与する
+func WithAnnotations(kv ...string) RequestOption {
+	return func(req *http.Request) {
+		*req = *req.WithContext(retryabletransport.Annotate(req.Context(), kv...))
+	}
+}
+
+// WithLatencySLO はリクエストの種類と期待するレイテンシーを設定する
+// レイテンシーが threshold を超えた場合は、成功したリクエストも WithSLOViolationHandler の関数に通知される
+func WithLatencySLO(class string, threshold time.Duration) RequestOption {
+	return func(req *http.Request) {
+		*req = *req.WithContext(retryabletransport.WithLatencySLO(req.Context(), class, threshold))
+	}
+}
+
+// NewRequest はオプションを適用した *http.Request を作成する
+func (c *Client) NewRequest(ctx context.Context, method string, url string, body io.Reader,
+	opts ...RequestOption) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		opt(req)
+	}
+	return req, nil
+}
+
+// Send はオプションを適用したリクエストを作成して送信する。レスポンスボディのクローズは呼び出し元で行う必要がある
+func (c *Client) Send(ctx context.Context, method string, url string, body io.Reader,
+	opts ...RequestOption) (*http.Response, error) {
+	req, err := c.NewRequest(ctx, method, url, body, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Get は GET リクエストを送信する
+func (c *Client) Get(ctx context.Context, url string, opts ...RequestOption) (*http.Response, error) {
+	return c.Send(ctx, http.MethodGet, url, nil, opts...)
+}
+
+// Post は Content-Type を指定して POST リクエストを送信する
+func (c *Client) Post(ctx context.Context, url string, contentType string, body io.Reader,
+	opts ...RequestOption) (*http.Response, error) {
+	return c.Send(ctx, http.MethodPost, url, body, append([]RequestOption{WithHeader("Content-Type", contentType)}, opts...)...)
+}
@@ -0,0 +1,67 @@
+package retrytest
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// FakeClock は実際に待機せずに時刻を進める transport.Clock
+// After を呼び出すと即座に待機時間だけ時刻を進め、待機時間を記録する
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+// NewFakeClock は start を現在時刻とする FakeClock 構造体を作成する
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// After は時刻を d だけ進め、進めた後の時刻を送信済みのチャネルを返却する
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+// Sleep は時刻を d だけ進めて即座に返却する。ctx が終了している場合は時刻を進めずに ctx.Err() を返却する
+// NOTE: このメソッドを実装することで、FakeClock は transport.Sleeper インターフェースを満たす
+func (c *FakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	<-c.After(d)
+	return nil
+}
+
+// Advance は時刻を d だけ進める。送信にかかる時間を再現する場合に使用する
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// Sleeps は After で待機した時間を呼び出した順に返却する
+func (c *FakeClock) Sleeps() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sleeps := make([]time.Duration, len(c.sleeps))
+	copy(sleeps, c.sleeps)
+	return sleeps
+}
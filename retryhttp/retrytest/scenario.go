@@ -0,0 +1,205 @@
+package retrytest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// Step は偽のサーバーが 1 回の試行で返却する結果
+type Step struct {
+	StatusCode int
+	Header     http.Header
+	Body       string
+	// Err は送信エラー。指定した場合はレスポンスを返却しない
+	Err error
+	// Latency は試行にかかる時間。FakeClock の時刻を進める
+	Latency time.Duration
+}
+
+// Status はステータスコードのみを返却する Step を作成する
+func Status(code int) Step {
+	return Step{StatusCode: code}
+}
+
+// Fail は送信エラーを返却する Step を作成する
+func Fail(err error) Step {
+	return Step{Err: err}
+}
+
+// Attempt は偽のサーバーが受け付けた試行
+type Attempt struct {
+	// At は試行を受け付けた FakeClock の時刻
+	At     time.Time
+	Method string
+	URL    string
+	Header http.Header
+	// Body は受け付けたリクエストボディ。ボディがない場合は nil
+	Body []byte
+}
+
+// BuildFunc は、偽のサーバーに送信する Transport と FakeClock から、検証する RetryableTransport を作成する関数の型定義
+type BuildFunc func(base http.RoundTripper, clock retryabletransport.Clock) http.RoundTripper
+
+// Scenario は、偽のサーバーと FakeClock を使用してリトライの一連のやり取りを実行し、検証する
+//
+//	retrytest.NewScenario(build).
+//		Respond(retrytest.Status(503), retrytest.Status(503), retrytest.Status(200)).
+//		Run(t, req).
+//		Attempts(3).
+//		Sleeps(2*time.Second, 4*time.Second).
+//		StatusCode(200)
+type Scenario struct {
+	build BuildFunc
+	steps []Step
+	start time.Time
+}
+
+// NewScenario は Scenario 構造体を作成する
+func NewScenario(build BuildFunc) *Scenario {
+	return &Scenario{build: build, start: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+// Respond は偽のサーバーが試行ごとに返却する結果を追加する。すべて返却した後の試行は t.Errorf で失敗させる
+func (s *Scenario) Respond(steps ...Step) *Scenario {
+	s.steps = append(s.steps, steps...)
+	return s
+}
+
+// Run はリクエストを送信し、検証を行う Result を返却する
+func (s *Scenario) Run(t testing.TB, req *http.Request) *Result {
+	t.Helper()
+
+	clock := NewFakeClock(s.start)
+	server := NewScriptedTransport(t, clock, s.steps...)
+	rt := s.build(server, clock)
+
+	start := clock.Now()
+	res, err := rt.RoundTrip(req)
+	result := &Result{
+		t:        t,
+		res:      res,
+		err:      err,
+		attempts: server.Attempts(),
+		sleeps:   clock.Sleeps(),
+		elapsed:  clock.Now().Sub(start),
+	}
+	if res != nil {
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		result.body = string(body)
+	}
+	return result
+}
+
+// Result は Scenario の実行結果。メソッドチェーンで検証を行う
+type Result struct {
+	t        testing.TB
+	res      *http.Response
+	err      error
+	body     string
+	attempts []Attempt
+	sleeps   []time.Duration
+	elapsed  time.Duration
+}
+
+// Attempts は試行回数を検証する
+func (r *Result) Attempts(n int) *Result {
+	r.t.Helper()
+	if len(r.attempts) != n {
+		r.t.Errorf("attempts = %d, want %d", len(r.attempts), n)
+	}
+	return r
+}
+
+// Sleeps はバックオフの待機時間の並びを検証する
+func (r *Result) Sleeps(want ...time.Duration) *Result {
+	r.t.Helper()
+	if fmt.Sprint(r.sleeps) != fmt.Sprint(want) {
+		r.t.Errorf("sleeps = %v, want %v", r.sleeps, want)
+	}
+	return r
+}
+
+// BackoffIncreasing は、バックオフの待機時間が前回の待機時間以上で、減少していないことを検証する
+// NOTE: ゆらぎを含む待機時間は値を固定できないため、順序のみを検証する場合に使用する
+func (r *Result) BackoffIncreasing() *Result {
+	r.t.Helper()
+	for i := 1; i < len(r.sleeps); i++ {
+		if r.sleeps[i] < r.sleeps[i-1] {
+			r.t.Errorf("sleeps = %v, want non-decreasing (sleep %d < sleep %d)", r.sleeps, i+1, i)
+			break
+		}
+	}
+	return r
+}
+
+// Bodies は試行ごとのリクエストボディを検証する。リトライで同じボディが再送されたことを確認する場合に使用する
+func (r *Result) Bodies(want ...string) *Result {
+	r.t.Helper()
+	got := make([]string, len(r.attempts))
+	for i, a := range r.attempts {
+		got[i] = string(a.Body)
+	}
+	if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", want) {
+		r.t.Errorf("bodies = %q, want %q", got, want)
+	}
+	return r
+}
+
+// Elapsed は試行とバックオフを含む全体の所要時間を検証する
+func (r *Result) Elapsed(want time.Duration) *Result {
+	r.t.Helper()
+	if r.elapsed != want {
+		r.t.Errorf("elapsed = %s, want %s", r.elapsed, want)
+	}
+	return r
+}
+
+// StatusCode は最終的なレスポンスのステータスコードを検証する
+func (r *Result) StatusCode(want int) *Result {
+	r.t.Helper()
+	switch {
+	case r.err != nil:
+		r.t.Errorf("err = %v, want status %d", r.err, want)
+	case r.res.StatusCode != want:
+		r.t.Errorf("status = %d, want %d", r.res.StatusCode, want)
+	}
+	return r
+}
+
+// Error は最終的なエラーが target を含むか (errors.Is) を検証する。target が nil の場合はエラーがないことを検証する
+func (r *Result) Error(target error) *Result {
+	r.t.Helper()
+	switch {
+	case target == nil && r.err != nil:
+		r.t.Errorf("err = %v, want nil", r.err)
+	case target != nil && !errors.Is(r.err, target):
+		r.t.Errorf("err = %v, want %v", r.err, target)
+	}
+	return r
+}
+
+// Body は最終的なレスポンスボディを検証する
+func (r *Result) Body(want string) *Result {
+	r.t.Helper()
+	if r.body != want {
+		r.t.Errorf("body = %q, want %q", r.body, want)
+	}
+	return r
+}
+
+// Response は最終的なレスポンスとエラーを返却する。レスポンスボディは読み込み済み
+func (r *Result) Response() (*http.Response, error) {
+	return r.res, r.err
+}
+
+// AttemptLog はサーバーが受け付けた試行を返却する。試行ごとのヘッダーや時刻を個別に検証する場合に使用する
+func (r *Result) AttemptLog() []Attempt {
+	return r.attempts
+}
@@ -0,0 +1,166 @@
+package retrytest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// recordingTB は、検証の失敗を記録する testing.TB
+// NOTE: 検証が失敗することを確認するために、テスト自体を失敗させずに Errorf のメッセージを記録する
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+// retryServerErrors は 429 と 5xx と送信エラーをリトライする CheckRetryFunc
+func retryServerErrors(res *http.Response, err error) bool {
+	return err != nil || res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= http.StatusInternalServerError
+}
+
+// doublingBackoff は 1 秒から倍々に増加する待機時間を返却する BackoffFunc
+func doublingBackoff(attempts int) time.Duration {
+	return time.Second << (attempts - 1)
+}
+
+// buildTransport は Scenario の FakeClock を使用する RetryableTransport を作成する BuildFunc
+func buildTransport(maxRetries int) BuildFunc {
+	return func(base http.RoundTripper, clock retryabletransport.Clock) http.RoundTripper {
+		return retryabletransport.NewRetryableTransport(base, maxRetries, retryServerErrors, doublingBackoff,
+			retryabletransport.WithClock(clock), retryabletransport.WithoutLogging())
+	}
+}
+
+func TestScenarioPasses(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPut, "http://example.com/items/1", strings.NewReader("payload"))
+
+	result := NewScenario(buildTransport(3)).
+		Respond(
+			Step{StatusCode: 503, Latency: 100 * time.Millisecond},
+			Fail(errors.New("connection reset")),
+			Step{StatusCode: 200, Body: "ok"},
+		).
+		Run(t, req).
+		Attempts(3).
+		Sleeps(1*time.Second, 2*time.Second).
+		BackoffIncreasing().
+		Bodies("payload", "payload", "payload").
+		Elapsed(3100 * time.Millisecond).
+		StatusCode(200).
+		Error(nil).
+		Body("ok")
+
+	if res, err := result.Response(); err != nil || res.StatusCode != 200 {
+		t.Errorf("Response() = %v, %v", res, err)
+	}
+	log := result.AttemptLog()
+	if len(log) != 3 {
+		t.Fatalf("AttemptLog() has %d attempts, want 3", len(log))
+	}
+	if got := log[2].At.Sub(log[0].At); got != 3100*time.Millisecond {
+		t.Errorf("third attempt sent %v after the first, want 3.1s", got)
+	}
+	if log[0].Method != http.MethodPut || log[0].URL != "http://example.com/items/1" {
+		t.Errorf("first attempt = %s %s", log[0].Method, log[0].URL)
+	}
+}
+
+func TestScenarioFailingExpectations(t *testing.T) {
+	errRefused := errors.New("connection refused")
+	tests := []struct {
+		name   string
+		steps  []Step
+		expect func(*Result)
+		// want は記録されるべき失敗ごとの、メッセージに含まれる文字列
+		want []string
+	}{
+		{
+			name:   "attempts",
+			steps:  []Step{Status(503), Status(200)},
+			expect: func(r *Result) { r.Attempts(3) },
+			want:   []string{"attempts = 2, want 3"},
+		},
+		{
+			name:   "sleeps",
+			steps:  []Step{Status(503), Status(200)},
+			expect: func(r *Result) { r.Sleeps(2 * time.Second) },
+			want:   []string{"sleeps = [1s], want [2s]"},
+		},
+		{
+			name:   "status code",
+			steps:  []Step{Status(404)},
+			expect: func(r *Result) { r.StatusCode(200) },
+			want:   []string{"status = 404, want 200"},
+		},
+		{
+			name:   "status code on error",
+			steps:  []Step{Fail(errRefused), Fail(errRefused)},
+			expect: func(r *Result) { r.StatusCode(200) },
+			want:   []string{"connection refused, want status 200"},
+		},
+		{
+			name:   "error",
+			steps:  []Step{Status(200)},
+			expect: func(r *Result) { r.Error(errRefused) },
+			want:   []string{"err = <nil>, want connection refused"},
+		},
+		{
+			name:   "body and elapsed",
+			steps:  []Step{{StatusCode: 200, Body: "ok", Latency: time.Second}},
+			expect: func(r *Result) { r.Body("ng").Elapsed(0) },
+			want:   []string{`body = "ok", want "ng"`, "elapsed = 1s, want 0s"},
+		},
+		{
+			name:   "unexpected extra attempt",
+			steps:  []Step{Status(503)},
+			expect: func(r *Result) {},
+			want:   []string{"unexpected attempt 2: only 1 steps are defined"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := &recordingTB{TB: t}
+			req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+			tt.expect(NewScenario(buildTransport(1)).Respond(tt.steps...).Run(tb, req))
+
+			if len(tb.errors) != len(tt.want) {
+				t.Fatalf("recorded failures = %q, want %d failures", tb.errors, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(tb.errors[i], want) {
+					t.Errorf("failure %d = %q, want it to contain %q", i+1, tb.errors[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestResultBackoffIncreasingFails(t *testing.T) {
+	tb := &recordingTB{TB: t}
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	build := func(base http.RoundTripper, clock retryabletransport.Clock) http.RoundTripper {
+		decreasing := func(attempts int) time.Duration { return time.Duration(10-attempts) * time.Second }
+		return retryabletransport.NewRetryableTransport(base, 2, retryServerErrors, decreasing,
+			retryabletransport.WithClock(clock), retryabletransport.WithoutLogging())
+	}
+
+	NewScenario(build).
+		Respond(Status(503), Status(503), Status(200)).
+		Run(tb, req).
+		BackoffIncreasing()
+
+	if len(tb.errors) != 1 || !strings.Contains(tb.errors[0], "want non-decreasing") {
+		t.Errorf("recorded failures = %q, want one non-decreasing failure", tb.errors)
+	}
+}
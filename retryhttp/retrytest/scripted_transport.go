@@ -0,0 +1,106 @@
+package retrytest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ErrNoMoreSteps は、定義した Step をすべて返却した後に試行を受け付けたことを表すエラー
+var ErrNoMoreSteps = errors.New("retrytest: no more steps")
+
+// ScriptedTransport は、定義した Step を試行ごとに順に返却し、受け付けた試行を記録する偽のサーバーの http.RoundTripper 具象型
+// NOTE: httptest のサーバーや外部のサービスを使用せずに、RetryableTransport や Client のリトライの設定をテストするために使用する
+// Scenario を使用せずに、任意の Client や Transport の親の Transport に設定できる
+//
+//	server := retrytest.NewScriptedTransport(t, clock, retrytest.Status(500), retrytest.Status(500), retrytest.Status(200))
+//	client := retryhttp.NewClient(retryhttp.WithTransport(server), retryhttp.WithClock(clock))
+type ScriptedTransport struct {
+	t     testing.TB
+	clock *FakeClock
+
+	mu       sync.Mutex
+	steps    []Step
+	attempts []Attempt
+}
+
+// NewScriptedTransport は ScriptedTransport 構造体を作成する
+// Step をすべて返却した後の試行は t.Errorf で失敗させる。clock が nil の場合は Step.Latency を無視し、試行の時刻は time.Now() とする
+func NewScriptedTransport(t testing.TB, clock *FakeClock, steps ...Step) *ScriptedTransport {
+	return &ScriptedTransport{t: t, clock: clock, steps: steps}
+}
+
+// RoundTrip は試行を記録し、次の Step の結果を返却する
+func (s *ScriptedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+		req.Body.Close()
+	}
+
+	s.mu.Lock()
+	now := time.Now()
+	if s.clock != nil {
+		now = s.clock.Now()
+	}
+	s.attempts = append(s.attempts, Attempt{
+		At:     now,
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: req.Header.Clone(),
+		Body:   body,
+	})
+	n := len(s.attempts)
+	if n > len(s.steps) {
+		s.mu.Unlock()
+		s.t.Errorf("unexpected attempt %d: only %d steps are defined", n, len(s.steps))
+		return nil, ErrNoMoreSteps
+	}
+	step := s.steps[n-1]
+	s.mu.Unlock()
+
+	if s.clock != nil {
+		s.clock.Advance(step.Latency)
+	}
+	if step.Err != nil {
+		return nil, step.Err
+	}
+	header := step.Header
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		StatusCode: step.StatusCode,
+		Status:     fmt.Sprintf("%d %s", step.StatusCode, http.StatusText(step.StatusCode)),
+		Header:     header.Clone(),
+		Body:       io.NopCloser(strings.NewReader(step.Body)),
+		Request:    req,
+	}, nil
+}
+
+// Attempts は受け付けた試行を受け付けた順に返却する
+func (s *ScriptedTransport) Attempts() []Attempt {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts := make([]Attempt, len(s.attempts))
+	copy(attempts, s.attempts)
+	return attempts
+}
+
+// AssertDone は、定義した Step をすべて返却したことを検証する
+func (s *ScriptedTransport) AssertDone() {
+	s.t.Helper()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.attempts) < len(s.steps) {
+		s.t.Errorf("attempts = %d, want all %d steps to be used", len(s.attempts), len(s.steps))
+	}
+}
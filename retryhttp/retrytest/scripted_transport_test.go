@@ -0,0 +1,234 @@
+package retrytest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// testStart は FakeClock の開始時刻
+var testStart = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestScriptedTransportSteps(t *testing.T) {
+	errReset := errors.New("connection reset")
+	tests := []struct {
+		name         string
+		steps        []Step
+		wantStatus   int
+		wantErr      error
+		wantBody     string
+		wantHeader   string
+		wantAttempts int
+		// wantAt は各試行を受け付けた、開始時刻からの経過時間
+		wantAt []time.Duration
+	}{
+		{
+			name:         "status codes in order",
+			steps:        []Step{Status(503), Status(500), {StatusCode: 200, Body: "ok"}},
+			wantStatus:   200,
+			wantBody:     "ok",
+			wantAttempts: 3,
+			wantAt:       []time.Duration{0, 1 * time.Second, 3 * time.Second},
+		},
+		{
+			name:         "errors in order",
+			steps:        []Step{Fail(errReset), Fail(errReset), Fail(errReset), Fail(errReset)},
+			wantErr:      errReset,
+			wantAttempts: 4,
+			wantAt:       []time.Duration{0, 1 * time.Second, 3 * time.Second, 7 * time.Second},
+		},
+		{
+			name:         "error then response",
+			steps:        []Step{Fail(errReset), {StatusCode: 200, Header: http.Header{"X-Step": {"2"}}}},
+			wantStatus:   200,
+			wantHeader:   "2",
+			wantAttempts: 2,
+			wantAt:       []time.Duration{0, 1 * time.Second},
+		},
+		{
+			name:         "latency advances the clock",
+			steps:        []Step{{StatusCode: 503, Latency: 500 * time.Millisecond}, {StatusCode: 200, Latency: time.Second}},
+			wantStatus:   200,
+			wantAttempts: 2,
+			wantAt:       []time.Duration{0, 1500 * time.Millisecond},
+		},
+		{
+			name:         "non-retryable status stops the sequence",
+			steps:        []Step{Status(404)},
+			wantStatus:   404,
+			wantAttempts: 1,
+			wantAt:       []time.Duration{0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := NewFakeClock(testStart)
+			server := NewScriptedTransport(t, clock, tt.steps...)
+			transport := retryabletransport.NewRetryableTransport(server, 3, retryServerErrors, doublingBackoff,
+				retryabletransport.WithClock(clock), retryabletransport.WithoutLogging())
+
+			req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+			res, err := transport.RoundTrip(req)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("RoundTrip: %v", err)
+				}
+				body, _ := io.ReadAll(res.Body)
+				res.Body.Close()
+				if res.StatusCode != tt.wantStatus {
+					t.Errorf("status = %d, want %d", res.StatusCode, tt.wantStatus)
+				}
+				if want := fmt.Sprintf("%d %s", tt.wantStatus, http.StatusText(tt.wantStatus)); res.Status != want {
+					t.Errorf("status line = %q, want %q", res.Status, want)
+				}
+				if string(body) != tt.wantBody {
+					t.Errorf("body = %q, want %q", body, tt.wantBody)
+				}
+				if got := res.Header.Get("X-Step"); got != tt.wantHeader {
+					t.Errorf("X-Step = %q, want %q", got, tt.wantHeader)
+				}
+			}
+
+			server.AssertDone()
+			attempts := server.Attempts()
+			if len(attempts) != tt.wantAttempts {
+				t.Fatalf("attempts = %d, want %d", len(attempts), tt.wantAttempts)
+			}
+			for i, attempt := range attempts {
+				if got := attempt.At.Sub(testStart); got != tt.wantAt[i] {
+					t.Errorf("attempt %d at +%v, want +%v", i+1, got, tt.wantAt[i])
+				}
+			}
+		})
+	}
+}
+
+// TestScriptedTransportRecordsRequests は、リトライで再送したリクエストのボディとヘッダーを試行ごとに記録することを検証する
+func TestScriptedTransportRecordsRequests(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	server := NewScriptedTransport(t, clock, Status(503), Status(200))
+	transport := retryabletransport.NewRetryableTransport(server, 3, retryServerErrors, doublingBackoff,
+		retryabletransport.WithClock(clock), retryabletransport.WithoutLogging())
+
+	req, _ := http.NewRequest(http.MethodPut, "http://example.com/items/1?v=2", strings.NewReader("payload"))
+	req.Header.Set("Content-Type", "text/plain")
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	attempts := server.Attempts()
+	if len(attempts) != 2 {
+		t.Fatalf("attempts = %d, want 2", len(attempts))
+	}
+	for i, attempt := range attempts {
+		if attempt.Method != http.MethodPut || attempt.URL != "http://example.com/items/1?v=2" {
+			t.Errorf("attempt %d = %s %s", i+1, attempt.Method, attempt.URL)
+		}
+		if string(attempt.Body) != "payload" {
+			t.Errorf("attempt %d body = %q, want %q", i+1, attempt.Body, "payload")
+		}
+		if got := attempt.Header.Get("Content-Type"); got != "text/plain" {
+			t.Errorf("attempt %d Content-Type = %q, want %q", i+1, got, "text/plain")
+		}
+	}
+
+	// NOTE: 記録したヘッダーは複製のため、リクエストを変更しても変わらない
+	req.Header.Set("Content-Type", "application/json")
+	if got := server.Attempts()[0].Header.Get("Content-Type"); got != "text/plain" {
+		t.Errorf("recorded Content-Type = %q after modifying the request, want %q", got, "text/plain")
+	}
+}
+
+// TestScriptedTransportWithoutClock は、clock が nil の場合に Latency を無視して現在時刻を記録することを検証する
+func TestScriptedTransportWithoutClock(t *testing.T) {
+	server := NewScriptedTransport(t, nil, Step{StatusCode: 200, Latency: time.Hour})
+	before := time.Now()
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	res, err := server.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if at := server.Attempts()[0].At; at.Before(before) || at.After(time.Now()) {
+		t.Errorf("attempt at %v, want the current time", at)
+	}
+}
+
+func TestScriptedTransportAssertions(t *testing.T) {
+	tests := []struct {
+		name     string
+		steps    []Step
+		requests int
+		// wantErr は最後のリクエストに期待するエラー
+		wantErr error
+		// want は記録されるべき失敗ごとの、メッセージに含まれる文字列
+		want []string
+	}{
+		{
+			name:     "all steps used",
+			steps:    []Step{Status(503), Status(200)},
+			requests: 2,
+		},
+		{
+			name:     "steps left",
+			steps:    []Step{Status(503), Status(503), Status(200)},
+			requests: 1,
+			want:     []string{"attempts = 1, want all 3 steps to be used"},
+		},
+		{
+			name:     "no steps used",
+			steps:    []Step{Status(200)},
+			requests: 0,
+			want:     []string{"attempts = 0, want all 1 steps to be used"},
+		},
+		{
+			name:     "unexpected extra attempt",
+			steps:    []Step{Status(200)},
+			requests: 2,
+			wantErr:  ErrNoMoreSteps,
+			want:     []string{"unexpected attempt 2: only 1 steps are defined"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := &recordingTB{TB: t}
+			server := NewScriptedTransport(tb, NewFakeClock(testStart), tt.steps...)
+
+			var err error
+			for i := 0; i < tt.requests; i++ {
+				req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+				var res *http.Response
+				if res, err = server.RoundTrip(req); err == nil {
+					res.Body.Close()
+				}
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			server.AssertDone()
+
+			if len(tb.errors) != len(tt.want) {
+				t.Fatalf("recorded failures = %q, want %d failures", tb.errors, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(tb.errors[i], want) {
+					t.Errorf("failure %d = %q, want it to contain %q", i+1, tb.errors[i], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package retryhttp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrClientClosed は、Close または Shutdown を呼び出した後の Client にバックグラウンドの処理を追加しようとしたことを表すエラー
+var ErrClientClosed = errors.New("client is closed")
+
+// BackgroundTask は、Client が所有するバックグラウンドのゴルーチンで実行する処理の型定義
+// ctx は Client の Close または Shutdown で終了するため、終了したら処理を終えて返却する
+type BackgroundTask func(ctx context.Context) error
+
+// Runtime は、ヘルスチェックやキャッシュの掃除、トークンの更新など、Client が所有するバックグラウンドのゴルーチンを管理する
+// 処理は最初のリクエストの送信時に開始し、Client の Close または Shutdown で停止する
+// NOTE: 処理がエラーを返却しても他の処理は停止しない。最初のエラーを Shutdown で返却する
+type Runtime struct {
+	once    sync.Once
+	mu      sync.Mutex
+	tasks   []BackgroundTask
+	started bool
+	closed  bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	group   errgroup.Group
+	// startupJitter は、処理を開始するまでに待機するランダムな時間の上限
+	startupJitter time.Duration
+}
+
+// Go は、バックグラウンドで実行する処理を追加する。既に開始している場合は即座に実行する
+// Close の後に呼び出した場合は ErrClientClosed を返却する
+func (r *Runtime) Go(task BackgroundTask) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return ErrClientClosed
+	}
+	if r.started {
+		r.run(task)
+		return nil
+	}
+	r.tasks = append(r.tasks, task)
+	return nil
+}
+
+// Start は、追加した処理を開始する。既に開始している場合や、Close の後は何もしない
+// NOTE: Client は最初のリクエストの送信時に呼び出すため、通常は呼び出す必要はない
+func (r *Runtime) Start() {
+	r.once.Do(r.start)
+}
+
+// start は、追加した処理を開始する
+func (r *Runtime) start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.started || r.closed {
+		return
+	}
+	r.started = true
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	for _, task := range r.tasks {
+		r.run(task)
+	}
+	r.tasks = nil
+}
+
+// run は処理をゴルーチンで実行する。呼び出し元でロックを取得する
+func (r *Runtime) run(task BackgroundTask) {
+	ctx := r.ctx
+	jitter := r.startupJitter
+	r.group.Go(func() error {
+		if err := retryabletransport.StartupDelay(ctx, jitter); err != nil {
+			return nil
+		}
+		err := task(ctx)
+		if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+			return nil
+		}
+		return err
+	})
+}
+
+// SetStartupJitter は、処理ごとに 0 以上 max 未満のランダムな時間だけ待機してから開始するように設定する
+// NOTE: 多数のレプリカが同時に再起動した場合に、定期的な処理や再接続のループが同じタイミングで送信しないようにする
+// 既に開始している処理には影響しない
+func (r *Runtime) SetStartupJitter(max time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.startupJitter = max
+}
+
+// Close は、すべての処理の context.Context を終了する。処理の終了は待機しない
+func (r *Runtime) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+	r.tasks = nil
+	if r.cancel != nil {
+		r.cancel()
+	}
+}
+
+// Shutdown は、Close を呼び出してすべての処理が終了するか ctx が終了するまで待機する
+// 処理がエラーを返却した場合は最初のエラーを、ctx が終了した場合は ctx.Err() を返却する
+func (r *Runtime) Shutdown(ctx context.Context) error {
+	r.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- r.group.Wait()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,173 @@
+package retryhttp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// SelfTestCheck は SelfTest で確認する項目
+type SelfTestCheck string
+
+const (
+	// CheckDNS はホスト名の名前解決
+	CheckDNS SelfTestCheck = "dns"
+	// CheckTCP は TCP のコネクションの確立
+	CheckTCP SelfTestCheck = "tcp"
+	// CheckTLS は TLS のハンドシェイク。https 以外の場合は確認しない
+	CheckTLS SelfTestCheck = "tls"
+	// CheckHTTP は Client を使用した HTTP のリクエスト
+	CheckHTTP SelfTestCheck = "http"
+)
+
+// SelfTestReport は SelfTest の結果
+type SelfTestReport struct {
+	Targets []TargetReport `json:"targets"`
+}
+
+// OK はすべての接続先の確認に成功したか
+func (r *SelfTestReport) OK() bool {
+	for _, target := range r.Targets {
+		if !target.OK() {
+			return false
+		}
+	}
+	return true
+}
+
+// TargetReport は接続先ごとの確認結果
+type TargetReport struct {
+	URL    string        `json:"url"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// OK はすべての項目の確認に成功したか
+func (r *TargetReport) OK() bool {
+	for _, check := range r.Checks {
+		if check.Error != "" {
+			return false
+		}
+	}
+	return len(r.Checks) > 0
+}
+
+// CheckResult は項目ごとの確認結果
+type CheckResult struct {
+	Check    SelfTestCheck `json:"check"`
+	Duration time.Duration `json:"duration"`
+	// Detail は解決したアドレスや TLS のバージョン、ステータスコードなどの確認した内容
+	Detail string `json:"detail,omitempty"`
+	// Error は確認に失敗した理由。成功した場合は空文字
+	Error string `json:"error,omitempty"`
+}
+
+// SelfTest は、接続先ごとに名前解決、TCP のコネクションの確立、TLS のハンドシェイク、HTTP のリクエストを順に確認し、結果を返却する
+// 確認に失敗した項目以降の項目は確認しない
+// NOTE: このパッケージを使用するサービスのレディネスプローブに使用する。HTTP のリクエストはリトライせずに GET で送信し、5xx の場合は失敗とする
+func (c *Client) SelfTest(ctx context.Context, targets []string) *SelfTestReport {
+	report := &SelfTestReport{Targets: make([]TargetReport, len(targets))}
+
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		i, target := i, target
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Targets[i] = c.selfTestTarget(ctx, target)
+		}()
+	}
+	wg.Wait()
+
+	return report
+}
+
+// selfTestTarget は 1 つの接続先を確認する
+func (c *Client) selfTestTarget(ctx context.Context, target string) TargetReport {
+	report := TargetReport{URL: target}
+	run := func(check SelfTestCheck, fn func() (string, error)) bool {
+		start := time.Now()
+		detail, err := fn()
+		result := CheckResult{Check: check, Duration: time.Since(start), Detail: detail}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		report.Checks = append(report.Checks, result)
+		return err == nil
+	}
+
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		report.Checks = append(report.Checks, CheckResult{Check: CheckDNS, Error: fmt.Sprintf("invalid target URL: %q", target)})
+		return report
+	}
+	host, port := u.Hostname(), u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	var addrs []string
+	ok := run(CheckDNS, func() (string, error) {
+		addrs, err = net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprint(addrs), nil
+	})
+	if !ok {
+		return report
+	}
+
+	addr := net.JoinHostPort(host, port)
+	ok = run(CheckTCP, func() (string, error) {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		return conn.RemoteAddr().String(), nil
+	})
+	if !ok {
+		return report
+	}
+
+	if u.Scheme == "https" {
+		ok = run(CheckTLS, func() (string, error) {
+			dialer := &tls.Dialer{Config: &tls.Config{ServerName: host, NextProtos: []string{"h2", "http/1.1"}}}
+			conn, err := dialer.DialContext(ctx, "tcp", addr)
+			if err != nil {
+				return "", err
+			}
+			defer conn.Close()
+			state := conn.(*tls.Conn).ConnectionState()
+			return fmt.Sprintf("%s %s", tls.VersionName(state.Version), state.NegotiatedProtocol), nil
+		})
+		if !ok {
+			return report
+		}
+	}
+
+	run(CheckHTTP, func() (string, error) {
+		res, err := c.Get(ctx, target, WithRetryPolicy(retryabletransport.NoRetry))
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+		if res.StatusCode >= http.StatusInternalServerError {
+			return res.Status, fmt.Errorf("unexpected status: %s", res.Status)
+		}
+		return res.Status, nil
+	})
+	return report
+}
@@ -0,0 +1,85 @@
+package signing
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSigner はタイムスタンプを固定した HMACSigner を作成する
+func testSigner() *HMACSigner {
+	return &HMACSigner{
+		KeyID:         "primary",
+		Secret:        []byte("secret"),
+		SignedHeaders: []string{"Content-Type", HeaderTimestamp},
+		Now:           func() time.Time { return time.Unix(1700000000, 0) },
+	}
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	tests := []struct {
+		rawQuery string
+		want     string
+	}{
+		{"", ""},
+		{"b=2&a=1", "a=1&b=2"},
+		{"a=2&a=1&a=10", "a=1&a=10&a=2"},
+		{"q=a b&x=%2F", "q=a+b&x=%2F"},
+		// 値に & や = を含むクエリは、クエリを分割した場合と区別する
+		{"a=b%26c%3Dd", "a=b%26c%3Dd"},
+		{"a=b&c=d", "a=b&c=d"},
+		{"k%3Dv=1", "k%3Dv=1"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, "https://api.example.com/?"+tt.rawQuery, nil)
+		if got := canonicalQuery(req); got != tt.want {
+			t.Errorf("canonicalQuery(%q) = %q, want %q", tt.rawQuery, got, tt.want)
+		}
+	}
+}
+
+func TestCanonicalStringDoesNotModifyRequest(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "https://api.example.com/v1/items?b=2&a=1", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json")
+
+	canonical, err := testSigner().CanonicalString(req, []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"POST",
+		"/v1/items",
+		"a=1&b=2",
+		"1700000000",
+		"content-type:application/json,x-signature-timestamp:1700000000",
+		"44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a",
+	}, "\n")
+	if canonical != want {
+		t.Errorf("canonical string = %q, want %q", canonical, want)
+	}
+	if got := req.Header.Get(HeaderTimestamp); got != "" {
+		t.Errorf("CanonicalString set %s = %q on the request", HeaderTimestamp, got)
+	}
+}
+
+func TestSign(t *testing.T) {
+	signer := testSigner()
+	req, _ := http.NewRequest(http.MethodGet, "https://api.example.com/", nil)
+	canonical, _ := signer.CanonicalString(req, nil)
+
+	signature, err := signer.Sign(req, canonical)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get(HeaderTimestamp); got != "1700000000" {
+		t.Errorf("%s = %q, want the timestamp of the canonical string", HeaderTimestamp, got)
+	}
+	if got, want := req.Header.Get(HeaderSignature), "keyId=primary,signature="+signature; got != want {
+		t.Errorf("%s = %q, want %q", HeaderSignature, got, want)
+	}
+
+	if _, err := signer.Sign(req, "GET\n/"); err == nil {
+		t.Error("Sign of a malformed canonical string succeeded")
+	}
+}
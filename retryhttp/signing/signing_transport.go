@@ -0,0 +1,111 @@
+package signing
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Signer はリクエストに署名を行うインターフェース
+// 署名対象の文字列 (canonical string) の作成と署名を分けることで、テストベクターとして比較できるようにする
+type Signer interface {
+	// CanonicalString はリクエストを変更せずに、リクエストから署名対象の文字列を作成する
+	CanonicalString(req *http.Request, body []byte) (string, error)
+	// Sign は署名対象の文字列から署名を作成し、署名と必要なヘッダー (タイムスタンプなど) をリクエストに付与する
+	Sign(req *http.Request, canonical string) (signature string, err error)
+}
+
+// SigningTransport は試行ごとにリクエストへ署名を行うための http.RoundTripper 具象型
+// NOTE: RetryableTransport の内側に配置することで、リトライ時にも毎回署名をやり直す
+type SigningTransport struct {
+	wrapped http.RoundTripper
+	signer  Signer
+	onSign  func(Vector)
+}
+
+// Option は SigningTransport の設定を変更する関数の型定義
+type Option func(*SigningTransport)
+
+// WithVectorRecorder は、試行ごとの署名内容を Vector として fn に通知する
+// NOTE: リトライ時のみ 403 になる場合など、試行ごとの署名対象の文字列を比較する際に使用する
+func WithVectorRecorder(fn func(Vector)) Option {
+	return func(t *SigningTransport) {
+		t.onSign = fn
+	}
+}
+
+// NewSigningTransport は SigningTransport 構造体を作成する
+func NewSigningTransport(transport http.RoundTripper, signer Signer, opts ...Option) *SigningTransport {
+	t := &SigningTransport{
+		wrapped: transport,
+		signer:  signer,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// transport は親の Transport を返却する。親がない場合は、http.DefaultTransport を返却する
+func (t *SigningTransport) transport() http.RoundTripper {
+	if t.wrapped == nil {
+		return http.DefaultTransport
+	}
+	return t.wrapped
+}
+
+// RoundTrip はリクエストに署名を行い送信する
+func (t *SigningTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	signed, vector, err := sign(t.signer, req)
+	if err != nil {
+		return nil, err
+	}
+	if t.onSign != nil {
+		t.onSign(vector)
+	}
+	return t.transport().RoundTrip(signed)
+}
+
+// sign はリクエストを複製して署名を行う
+// NOTE: http.RoundTripper はリクエストを変更してはいけないため、ヘッダーを複製してから署名する
+func sign(signer Signer, req *http.Request) (*http.Request, Vector, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, Vector{}, fmt.Errorf("read body for signing: %w", err)
+	}
+
+	signed := req.Clone(req.Context())
+	if body != nil {
+		signed.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	canonical, err := signer.CanonicalString(signed, body)
+	if err != nil {
+		return nil, Vector{}, err
+	}
+	signature, err := signer.Sign(signed, canonical)
+	if err != nil {
+		return nil, Vector{}, err
+	}
+
+	return signed, newVector(signed, body, canonical, signature), nil
+}
+
+// readBody はリクエストボディを読み込む。GetBody がある場合は元のボディを消費しない
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body := req.Body
+	if req.GetBody != nil {
+		b, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
@@ -0,0 +1,79 @@
+package signing
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTripFunc は関数を http.RoundTripper として使用するための型
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestSigningTransportSignsEachAttempt(t *testing.T) {
+	var received []*http.Request
+	var bodies []string
+	upstream := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		received, bodies = append(received, req), append(bodies, string(body))
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	})
+	signer := testSigner()
+	now := time.Unix(1700000000, 0)
+	signer.Now = func() time.Time { return now }
+	var vectors []Vector
+	rt := NewSigningTransport(upstream, signer, WithVectorRecorder(func(v Vector) { vectors = append(vectors, v) }))
+
+	req, _ := http.NewRequest(http.MethodPost, "https://api.example.com/items", strings.NewReader("payload"))
+	for i := 0; i < 2; i++ {
+		if _, err := rt.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Second)
+	}
+
+	if req.Header.Get(HeaderSignature) != "" || req.Header.Get(HeaderTimestamp) != "" {
+		t.Errorf("original request header = %v, want it unchanged", req.Header)
+	}
+	for i, r := range received {
+		if bodies[i] != "payload" {
+			t.Errorf("attempt %d body = %q, want payload", i+1, bodies[i])
+		}
+		if r.Header.Get(HeaderSignature) != "keyId=primary,signature="+vectors[i].Signature {
+			t.Errorf("attempt %d signature header = %q, want the recorded signature", i+1, r.Header.Get(HeaderSignature))
+		}
+	}
+	if received[0].Header.Get(HeaderTimestamp) == received[1].Header.Get(HeaderTimestamp) {
+		t.Error("retried request is not signed with a new timestamp")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "https://api.example.com/items?a=1", strings.NewReader(`{"id":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	vector, err := Capture(testSigner(), "create item", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(testSigner(), vector); err != nil {
+		t.Errorf("Verify of a captured vector = %v", err)
+	}
+
+	// ヘッダーの値が異なる場合は、署名対象の文字列の 5 行目が一致しない
+	vector.Header.Set("Content-Type", "text/plain")
+	var mismatch *MismatchError
+	if err := Verify(testSigner(), vector); !errors.As(err, &mismatch) || mismatch.Field != "canonicalString" || mismatch.Line != 5 {
+		t.Errorf("Verify with a different header = %v, want a canonicalString mismatch at line 5", err)
+	}
+
+	vector, _ = Capture(testSigner(), "create item", req)
+	signer := testSigner()
+	signer.Secret = []byte("rotated")
+	if err := Verify(signer, vector); !errors.As(err, &mismatch) || mismatch.Field != "signature" {
+		t.Errorf("Verify with a different secret = %v, want a signature mismatch", err)
+	}
+}
@@ -0,0 +1,115 @@
+package signing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Vector は署名のテストベクター。サンプルリクエストと、その署名対象の文字列および署名を記録する
+// NOTE: プロバイダーのドキュメントに記載された値と比較し、署名の不一致 (403) の原因を調査するために使用する
+type Vector struct {
+	Name            string      `json:"name,omitempty"`
+	Method          string      `json:"method"`
+	URL             string      `json:"url"`
+	Header          http.Header `json:"header,omitempty"`
+	Body            string      `json:"body,omitempty"`
+	CanonicalString string      `json:"canonicalString"`
+	Signature       string      `json:"signature"`
+}
+
+// newVector は署名済みのリクエストから Vector を作成する
+func newVector(req *http.Request, body []byte, canonical string, signature string) Vector {
+	return Vector{
+		Method:          req.Method,
+		URL:             req.URL.String(),
+		Header:          req.Header.Clone(),
+		Body:            string(body),
+		CanonicalString: canonical,
+		Signature:       signature,
+	}
+}
+
+// Capture はサンプルリクエストに署名を行い、Vector を作成する。リクエストは送信しない
+func Capture(signer Signer, name string, req *http.Request) (Vector, error) {
+	_, vector, err := sign(signer, req)
+	if err != nil {
+		return Vector{}, err
+	}
+	vector.Name = name
+	return vector, nil
+}
+
+// MismatchError は、期待した Vector と実際の署名内容が一致しないことを表すエラー
+type MismatchError struct {
+	Name string
+	// Field は一致しなかった項目 ("canonicalString" または "signature")
+	Field    string
+	Expected string
+	Actual   string
+	// Line は署名対象の文字列で最初に一致しなかった行 (1 始まり)。Field が "signature" の場合は 0
+	Line int
+}
+
+func (e *MismatchError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("vector %q: %s mismatch at line %d: expected %q, got %q",
+			e.Name, e.Field, e.Line, e.Expected, e.Actual)
+	}
+	return fmt.Sprintf("vector %q: %s mismatch: expected %q, got %q", e.Name, e.Field, e.Expected, e.Actual)
+}
+
+// Verify は Vector のリクエストを署名し、記録された署名対象の文字列と署名に一致するか検証する
+func Verify(signer Signer, expected Vector) error {
+	req, err := http.NewRequest(expected.Method, expected.URL, strings.NewReader(expected.Body))
+	if err != nil {
+		return err
+	}
+	for k, v := range expected.Header {
+		req.Header[k] = v
+	}
+
+	actual, err := Capture(signer, expected.Name, req)
+	if err != nil {
+		return err
+	}
+
+	if actual.CanonicalString != expected.CanonicalString {
+		expectedLines := strings.Split(expected.CanonicalString, "\n")
+		actualLines := strings.Split(actual.CanonicalString, "\n")
+		for i := 0; i < len(expectedLines) || i < len(actualLines); i++ {
+			var e, a string
+			if i < len(expectedLines) {
+				e = expectedLines[i]
+			}
+			if i < len(actualLines) {
+				a = actualLines[i]
+			}
+			if e != a {
+				return &MismatchError{Name: expected.Name, Field: "canonicalString", Expected: e, Actual: a, Line: i + 1}
+			}
+		}
+	}
+	if actual.Signature != expected.Signature {
+		return &MismatchError{Name: expected.Name, Field: "signature", Expected: expected.Signature, Actual: actual.Signature}
+	}
+	return nil
+}
+
+// WriteVectors は Vector を JSON として書き出す
+func WriteVectors(w io.Writer, vectors []Vector) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(vectors)
+}
+
+// ReadVectors は JSON から Vector を読み込む
+func ReadVectors(r io.Reader) ([]Vector, error) {
+	var vectors []Vector
+	if err := json.NewDecoder(r).Decode(&vectors); err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
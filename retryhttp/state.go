@@ -0,0 +1,68 @@
+package retryhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/mtnori/httpRetryExample/retryhttp/stats"
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// clientState は SaveState で保存する Client の状態
+type clientState struct {
+	Stats    stats.WindowState                             `json:"stats"`
+	Circuits map[string]retryabletransport.CircuitSnapshot `json:"circuits,omitempty"`
+}
+
+// SaveState は、ホストごとの直近の統計情報とサーキットブレーカーの状態を path に JSON で保存する
+// NOTE: 短時間の再起動で、不安定なホストについて学習した状態が失われないように、終了時に呼び出して起動時に LoadState で復元する
+// 書き込み中にクラッシュしてもファイルが壊れないように、一時ファイルに書き込んでからリネームする
+func (c *Client) SaveState(path string) error {
+	state := clientState{Stats: c.stats.Export()}
+	if breaker := c.transport.CircuitBreaker(); breaker != nil {
+		state.Circuits = breaker.Export()
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadState は、SaveState で保存した状態を復元する。ファイルがない場合は何もしない
+// 集計期間を過ぎた統計情報やサーキットブレーカーの状態は復元しない
+func (c *Client) LoadState(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state clientState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	c.stats.Restore(state.Stats)
+	if breaker := c.transport.CircuitBreaker(); breaker != nil && state.Circuits != nil {
+		breaker.Restore(state.Circuits)
+	}
+	return nil
+}
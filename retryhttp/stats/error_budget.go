@@ -0,0 +1,121 @@
+package stats
+
+import (
+	"time"
+
+	"github.com/mtnori/httpRetryExample/retryhttp/internal/shard"
+	"github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// BurnThreshold はエラーバジェットの消費速度 (バーンレート) のしきい値
+// 例えば SLO 99.9% に対して 1 時間で BurnRate 14.4 を超えると、30 日分のエラーバジェットの 2% を 1 時間で消費したことになる
+type BurnThreshold struct {
+	// Window はバーンレートを算出する期間
+	Window time.Duration
+	// BurnRate はアラートを通知するバーンレート
+	BurnRate float64
+	// MinRequests は判定に必要な最小リクエスト数。少数のリクエストによる誤検知を防ぐ
+	MinRequests int
+}
+
+// BurnAlert はバーンレートがしきい値を超えた、または下回ったことを表す通知
+type BurnAlert struct {
+	Host         string
+	Threshold    BurnThreshold
+	Availability float64
+	BurnRate     float64
+	// Resolved はバーンレートがしきい値を下回り、アラートが解消されたか
+	Resolved bool
+}
+
+// ErrorBudget は、クライアントから観測したアップストリームごとの可用性を SLO と比較し、
+// エラーバジェットのバーンレートがしきい値を超えた場合にコールバックを呼び出す
+// transport.Recorder インターフェースを満たすため、transport.WithRecorder で RetryableTransport に登録できる
+type ErrorBudget struct {
+	slo        float64
+	thresholds []BurnThreshold
+	windows    []*RollingWindow
+	// firing はホストごとの、しきい値を超えているかの状態。ホストごとの判定が競合しないように、シャードに分散して保持する
+	firing  *shard.Map[[]bool]
+	onAlert func(BurnAlert)
+}
+
+// NewErrorBudget は ErrorBudget 構造体を作成する
+// slo は目標とする可用性 (例: 0.999)。onAlert はしきい値を超えた時と解消した時に呼び出される
+func NewErrorBudget(slo float64, onAlert func(BurnAlert), thresholds ...BurnThreshold) *ErrorBudget {
+	windows := make([]*RollingWindow, len(thresholds))
+	for i, th := range thresholds {
+		windows[i] = NewRollingWindow(th.Window)
+	}
+	return &ErrorBudget{
+		slo:        slo,
+		thresholds: thresholds,
+		windows:    windows,
+		firing:     shard.New[[]bool](0),
+		onAlert:    onAlert,
+	}
+}
+
+// Record はリクエストの結果を集計し、バーンレートを判定する
+func (b *ErrorBudget) Record(result transport.RequestResult) {
+	var alerts []BurnAlert
+
+	hosts := b.firing.Lock(result.Host)
+	firing, ok := hosts.Entries[result.Host]
+	if !ok {
+		firing = make([]bool, len(b.thresholds))
+		hosts.Entries[result.Host] = firing
+	}
+	for i, w := range b.windows {
+		w.Record(result)
+
+		snapshot := w.Host(result.Host)
+		if snapshot.Requests < b.thresholds[i].MinRequests {
+			continue
+		}
+		burnRate := b.burnRate(snapshot.SuccessRate)
+		exceeded := burnRate >= b.thresholds[i].BurnRate
+		if exceeded == firing[i] {
+			continue
+		}
+		firing[i] = exceeded
+		alerts = append(alerts, BurnAlert{
+			Host:         result.Host,
+			Threshold:    b.thresholds[i],
+			Availability: snapshot.SuccessRate,
+			BurnRate:     burnRate,
+			Resolved:     !exceeded,
+		})
+	}
+	hosts.Unlock()
+
+	// NOTE: コールバック内で ErrorBudget を参照できるように、ロックを解放してから呼び出す
+	if b.onAlert == nil {
+		return
+	}
+	for _, alert := range alerts {
+		b.onAlert(alert)
+	}
+}
+
+// BurnRate は指定したホストの、各しきい値の期間におけるバーンレートを返却する
+func (b *ErrorBudget) BurnRate(host string) []float64 {
+	rates := make([]float64, len(b.windows))
+	for i, w := range b.windows {
+		snapshot := w.Host(host)
+		if snapshot.Requests == 0 {
+			continue
+		}
+		rates[i] = b.burnRate(snapshot.SuccessRate)
+	}
+	return rates
+}
+
+// burnRate は可用性からバーンレートを算出する
+func (b *ErrorBudget) burnRate(availability float64) float64 {
+	budget := 1 - b.slo
+	if budget <= 0 {
+		return 0
+	}
+	return (1 - availability) / budget
+}
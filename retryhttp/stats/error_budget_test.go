@@ -0,0 +1,81 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+func TestErrorBudget(t *testing.T) {
+	threshold := BurnThreshold{Window: time.Hour, BurnRate: 2, MinRequests: 5}
+	var alerts []BurnAlert
+	var budget *ErrorBudget
+	budget = NewErrorBudget(0.9, func(alert BurnAlert) {
+		// NOTE: コールバック内で ErrorBudget を参照してもデッドロックしない
+		budget.BurnRate(alert.Host)
+		alerts = append(alerts, alert)
+	}, threshold)
+	record := func(host string, succeeded bool) {
+		budget.Record(transport.RequestResult{Host: host, Attempts: 1, Succeeded: succeeded})
+	}
+
+	// MinRequests に達するまではアラートを通知しない
+	for i := 0; i < 4; i++ {
+		record("api.example.com", false)
+	}
+	if len(alerts) != 0 {
+		t.Fatalf("alerts before MinRequests = %+v", alerts)
+	}
+	record("api.example.com", false)
+	if len(alerts) != 1 || alerts[0].Resolved || alerts[0].Host != "api.example.com" || alerts[0].Availability != 0 {
+		t.Fatalf("alerts = %+v, want one firing alert", alerts)
+	}
+	if alerts[0].Threshold != threshold || alerts[0].BurnRate < 9.99 {
+		t.Errorf("alert = %+v, want burn rate 10", alerts[0])
+	}
+
+	// しきい値を超えたままの場合は、重複して通知しない
+	record("api.example.com", false)
+	// 他のホストの可用性は独立して判定する
+	for i := 0; i < 10; i++ {
+		record("other.example.com", true)
+	}
+	if len(alerts) != 1 {
+		t.Fatalf("alerts = %+v, want no additional alerts", alerts)
+	}
+
+	for i := 0; i < 100; i++ {
+		record("api.example.com", true)
+	}
+	if len(alerts) != 2 || !alerts[1].Resolved || alerts[1].BurnRate >= threshold.BurnRate {
+		t.Fatalf("alerts = %+v, want a resolved alert", alerts)
+	}
+}
+
+func TestErrorBudgetBurnRate(t *testing.T) {
+	budget := NewErrorBudget(0.99, nil,
+		BurnThreshold{Window: time.Hour, BurnRate: 14.4},
+		BurnThreshold{Window: 6 * time.Hour, BurnRate: 6},
+	)
+	if got := budget.BurnRate("api.example.com"); len(got) != 2 || got[0] != 0 || got[1] != 0 {
+		t.Errorf("BurnRate without requests = %v, want zeros", got)
+	}
+
+	for i := 0; i < 10; i++ {
+		budget.Record(transport.RequestResult{Host: "api.example.com", Attempts: 1, Succeeded: i != 0})
+	}
+	// 可用性 90% は、エラーバジェット 1% の 10 倍の速度で消費する
+	for i, rate := range budget.BurnRate("api.example.com") {
+		if rate < 9.99 || rate > 10.01 {
+			t.Errorf("BurnRate[%d] = %v, want 10", i, rate)
+		}
+	}
+
+	// NOTE: SLO が 100% の場合はエラーバジェットがないため、バーンレートを 0 とする
+	strict := NewErrorBudget(1, nil, BurnThreshold{Window: time.Hour})
+	strict.Record(transport.RequestResult{Host: "api.example.com", Attempts: 1})
+	if got := strict.BurnRate("api.example.com"); got[0] != 0 {
+		t.Errorf("BurnRate with SLO 1 = %v, want 0", got)
+	}
+}
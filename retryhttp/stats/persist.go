@@ -0,0 +1,90 @@
+package stats
+
+import (
+	"time"
+)
+
+// WindowState は、RollingWindow の集計値をファイルなどに保存するための状態
+type WindowState struct {
+	// Hosts はホストごとのバケットの集計値
+	Hosts map[string][]BucketState `json:"hosts"`
+}
+
+// BucketState は、一定期間のバケットの集計値
+type BucketState struct {
+	Start     time.Time `json:"start"`
+	Requests  int       `json:"requests"`
+	Successes int       `json:"successes"`
+	Retried   int       `json:"retried"`
+	Latencies []int     `json:"latencies"`
+}
+
+// Export は、ウィンドウ内の集計値を WindowState として返却する
+// NOTE: プロセスの再起動で直近の統計情報が失われないように、終了時に保存して起動時に Restore で復元するために使用する
+func (w *RollingWindow) Export() WindowState {
+	oldest := w.oldest(w.now())
+	state := WindowState{Hosts: make(map[string][]BucketState)}
+	w.hosts.Range(func(entries map[string]*hostWindow) {
+		for host, hw := range entries {
+			var buckets []BucketState
+			for i := range hw.buckets {
+				b := &hw.buckets[i]
+				if b.start.Before(oldest) || b.requests == 0 {
+					continue
+				}
+				buckets = append(buckets, BucketState{
+					Start:     b.start,
+					Requests:  b.requests,
+					Successes: b.successes,
+					Retried:   b.retried,
+					Latencies: append([]int(nil), b.latencies[:]...),
+				})
+			}
+			if len(buckets) > 0 {
+				state.Hosts[host] = buckets
+			}
+		}
+	})
+	return state
+}
+
+// Restore は、Export で保存した集計値を現在の集計値に加算する
+// ウィンドウの期間外になったバケットは破棄する。保存時とウィンドウの期間が異なる場合は、開始時刻が属するバケットに加算する
+func (w *RollingWindow) Restore(state WindowState) {
+	now := w.now()
+	oldest := w.oldest(now)
+	for host, buckets := range state.Hosts {
+		w.restore(host, buckets, oldest, now)
+	}
+}
+
+// restore は、ホストの保存した集計値のうち、ウィンドウの期間内のバケットを現在の集計値に加算する
+func (w *RollingWindow) restore(host string, buckets []BucketState, oldest, now time.Time) {
+	hosts := w.hosts.Lock(host)
+	defer hosts.Unlock()
+
+	for _, saved := range buckets {
+		if saved.Start.Before(oldest) || saved.Start.After(now) {
+			continue
+		}
+		hw, ok := hosts.Entries[host]
+		if !ok {
+			hw = &hostWindow{}
+			hosts.Entries[host] = hw
+		}
+		b := w.bucketAt(hw, saved.Start)
+		b.requests += saved.Requests
+		b.successes += saved.Successes
+		b.retried += saved.Retried
+		for i, n := range saved.Latencies {
+			if i < len(b.latencies) {
+				b.latencies[i] += n
+			}
+		}
+	}
+}
+
+// oldest はウィンドウ内の最も古いバケットの開始時刻を返却する
+func (w *RollingWindow) oldest(now time.Time) time.Time {
+	return now.Truncate(w.resolution).Add(-w.resolution * (bucketCount - 1))
+}
@@ -0,0 +1,71 @@
+package stats
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+func TestRollingWindowExportRestore(t *testing.T) {
+	now := time.Unix(1000, 0)
+	saved := newTestWindow(&now)
+	saved.Record(transport.RequestResult{Host: "a.example.com", Attempts: 2, Succeeded: true, Duration: 3 * time.Millisecond})
+	now = now.Add(30 * time.Second)
+	saved.Record(transport.RequestResult{Host: "a.example.com", Attempts: 1, Duration: time.Millisecond})
+	saved.Record(transport.RequestResult{Host: "b.example.com", Attempts: 1, Succeeded: true})
+
+	// NOTE: 再起動後に読み込むことを想定して、JSON を経由して復元する
+	data, err := json.Marshal(saved.Export())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state WindowState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Hosts["a.example.com"]) != 2 || len(state.Hosts["b.example.com"]) != 1 {
+		t.Fatalf("exported state = %s, want 2 and 1 buckets", data)
+	}
+
+	restored := newTestWindow(&now)
+	restored.Restore(state)
+	for _, host := range []string{"a.example.com", "b.example.com"} {
+		if got, want := restored.Host(host), saved.Host(host); got != want {
+			t.Errorf("restored %s = %+v, want %+v", host, got, want)
+		}
+	}
+
+	// 復元した集計値は現在の集計値に加算する
+	restored.Record(transport.RequestResult{Host: "b.example.com", Attempts: 1})
+	if got := restored.Host("b.example.com"); got.Requests != 2 || got.SuccessRate != 0.5 {
+		t.Errorf("b.example.com after Record = %+v, want 2 requests", got)
+	}
+}
+
+func TestRollingWindowRestoreDropsOutOfWindow(t *testing.T) {
+	now := time.Unix(1000, 0)
+	window := newTestWindow(&now)
+	latencies := make([]int, latencyBucketCount+1)
+	latencies[0] = 1
+	state := WindowState{Hosts: map[string][]BucketState{
+		"a.example.com": {
+			// 期間外になったバケットと、現在時刻より後のバケットは破棄する
+			{Start: now.Add(-2 * time.Minute), Requests: 5, Latencies: latencies},
+			{Start: now.Add(time.Minute), Requests: 7, Latencies: latencies},
+			{Start: now.Add(-10 * time.Second), Requests: 1, Successes: 1, Latencies: latencies},
+		},
+		"b.example.com": {
+			{Start: now.Add(-time.Hour), Requests: 3},
+		},
+	}}
+
+	window.Restore(state)
+	if got := window.Host("a.example.com"); got.Requests != 1 || got.SuccessRate != 1 || got.P95Latency != time.Millisecond {
+		t.Errorf("a.example.com = %+v, want only the bucket within the window", got)
+	}
+	if got := window.Hosts(); len(got) != 1 {
+		t.Errorf("Hosts = %v, want only a.example.com", got)
+	}
+}
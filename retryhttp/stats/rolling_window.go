@@ -0,0 +1,202 @@
+package stats
+
+import (
+	"sort"
+	"time"
+
+	"github.com/mtnori/httpRetryExample/retryhttp/internal/shard"
+	"github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+const (
+	// bucketCount はウィンドウを分割するバケット数
+	bucketCount = 60
+	// latencyBucketCount はレイテンシのヒストグラムのバケット数
+	latencyBucketCount = 17
+)
+
+// latencyBounds はレイテンシのヒストグラムの上限値 (1ms から約 65 秒まで倍々に増加する)
+var latencyBounds = func() (bounds [latencyBucketCount]time.Duration) {
+	for i := range bounds {
+		bounds[i] = time.Millisecond << i
+	}
+	return bounds
+}()
+
+// Snapshot はホストごとのウィンドウ内の統計情報
+type Snapshot struct {
+	// Requests はウィンドウ内のリクエスト数
+	Requests int
+	// SuccessRate は成功したリクエストの割合 (0.0 - 1.0)
+	SuccessRate float64
+	// RetryRate はリトライが行われたリクエストの割合 (0.0 - 1.0)
+	RetryRate float64
+	// P95Latency はリトライを含むリクエスト全体のレイテンシの 95 パーセンタイル
+	// NOTE: ヒストグラムから算出するため、バケットの上限値に丸められた近似値となる
+	P95Latency time.Duration
+}
+
+// bucket は一定期間の集計値
+type bucket struct {
+	start     time.Time
+	requests  int
+	successes int
+	retried   int
+	latencies [latencyBucketCount + 1]int
+}
+
+// hostWindow はホストごとのバケットのリングバッファ
+type hostWindow struct {
+	buckets [bucketCount]bucket
+}
+
+// RollingWindow はホストごとに直近一定期間のリクエスト統計を集計する
+// transport.Recorder インターフェースを満たすため、transport.WithRecorder で RetryableTransport に登録できる
+type RollingWindow struct {
+	resolution time.Duration
+	// hosts はホストごとのバケット。多数のホストへの並行したリクエストでロックが競合しないように、シャードに分散して保持する
+	hosts *shard.Map[*hostWindow]
+	now   func() time.Time
+}
+
+// NewRollingWindow は RollingWindow 構造体を作成する
+// window は集計対象とする期間 (例: 直近 5 分)
+func NewRollingWindow(window time.Duration) *RollingWindow {
+	return NewShardedRollingWindow(window, 0)
+}
+
+// NewShardedRollingWindow は、ホストごとのバケットを shards 個のロックに分散して保持する RollingWindow 構造体を作成する
+// shards が 0 以下の場合は GOMAXPROCS の 4 倍、1 の場合は 1 つのロックですべてのホストのバケットを保護する
+func NewShardedRollingWindow(window time.Duration, shards int) *RollingWindow {
+	resolution := window / bucketCount
+	if resolution <= 0 {
+		resolution = time.Nanosecond
+	}
+	return &RollingWindow{
+		resolution: resolution,
+		hosts:      shard.New[*hostWindow](shards),
+		now:        time.Now,
+	}
+}
+
+// Record はリクエストの結果を集計する
+func (w *RollingWindow) Record(result transport.RequestResult) {
+	hosts := w.hosts.Lock(result.Host)
+	defer hosts.Unlock()
+
+	hw, ok := hosts.Entries[result.Host]
+	if !ok {
+		hw = &hostWindow{}
+		hosts.Entries[result.Host] = hw
+	}
+
+	b := w.bucketAt(hw, w.now())
+	b.requests++
+	if result.Succeeded {
+		b.successes++
+	}
+	if result.Attempts > 1 {
+		b.retried++
+	}
+	b.latencies[latencyIndex(result.Duration)]++
+}
+
+// Host は指定したホストのウィンドウ内の統計情報を返却する
+func (w *RollingWindow) Host(host string) Snapshot {
+	hosts := w.hosts.Lock(host)
+	defer hosts.Unlock()
+
+	hw, ok := hosts.Entries[host]
+	if !ok {
+		return Snapshot{}
+	}
+	return w.snapshot(hw, w.now())
+}
+
+// Hosts はウィンドウ内にリクエストが存在するホストの一覧を返却する
+func (w *RollingWindow) Hosts() []string {
+	now := w.now()
+	hosts := make([]string, 0)
+	w.hosts.Range(func(entries map[string]*hostWindow) {
+		for host, hw := range entries {
+			if w.snapshot(hw, now).Requests == 0 {
+				// 期限切れのホストは削除する
+				delete(entries, host)
+				continue
+			}
+			hosts = append(hosts, host)
+		}
+	})
+	sort.Strings(hosts)
+	return hosts
+}
+
+// bucketAt は指定時刻に対応するバケットを返却する。期限切れのバケットは初期化する
+func (w *RollingWindow) bucketAt(hw *hostWindow, now time.Time) *bucket {
+	start := now.Truncate(w.resolution)
+	b := &hw.buckets[(start.UnixNano()/int64(w.resolution))%bucketCount]
+	if !b.start.Equal(start) {
+		*b = bucket{start: start}
+	}
+	return b
+}
+
+// snapshot はウィンドウ内のバケットを集計する
+func (w *RollingWindow) snapshot(hw *hostWindow, now time.Time) Snapshot {
+	oldest := w.oldest(now)
+
+	var total bucket
+	for i := range hw.buckets {
+		b := &hw.buckets[i]
+		if b.start.Before(oldest) || b.requests == 0 {
+			continue
+		}
+		total.requests += b.requests
+		total.successes += b.successes
+		total.retried += b.retried
+		for j, n := range b.latencies {
+			total.latencies[j] += n
+		}
+	}
+
+	if total.requests == 0 {
+		return Snapshot{}
+	}
+	return Snapshot{
+		Requests:    total.requests,
+		SuccessRate: float64(total.successes) / float64(total.requests),
+		RetryRate:   float64(total.retried) / float64(total.requests),
+		P95Latency:  percentile(total.latencies[:], total.requests, 0.95),
+	}
+}
+
+// latencyIndex はレイテンシが属するヒストグラムのインデックスを返却する
+func latencyIndex(d time.Duration) int {
+	for i, bound := range latencyBounds {
+		if d <= bound {
+			return i
+		}
+	}
+	return len(latencyBounds)
+}
+
+// percentile はヒストグラムから指定したパーセンタイルを算出する
+func percentile(latencies []int, total int, p float64) time.Duration {
+	threshold := int(float64(total)*p + 0.5)
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	var count int
+	for i, n := range latencies {
+		count += n
+		if count >= threshold {
+			if i < len(latencyBounds) {
+				return latencyBounds[i]
+			}
+			break
+		}
+	}
+	// 上限値を超える場合は最大の上限値を返却する
+	return latencyBounds[len(latencyBounds)-1]
+}
@@ -0,0 +1,131 @@
+package stats
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// newTestWindow は、now を現在時刻とする 1 分間の RollingWindow を作成する
+func newTestWindow(now *time.Time) *RollingWindow {
+	window := NewRollingWindow(time.Minute)
+	window.now = func() time.Time { return *now }
+	return window
+}
+
+func TestRollingWindowHost(t *testing.T) {
+	now := time.Unix(1000, 0)
+	window := newTestWindow(&now)
+
+	for i := 0; i < 20; i++ {
+		// NOTE: 20 件中 1 件だけ遅いリクエストのため、95 パーセンタイルは速いリクエストのバケットの上限値になる
+		duration := 3 * time.Millisecond
+		if i == 0 {
+			duration = 3 * time.Second
+		}
+		window.Record(transport.RequestResult{
+			Host:      "api.example.com",
+			Attempts:  1 + i%2,
+			Succeeded: i%4 != 0,
+			Duration:  duration,
+		})
+	}
+
+	want := Snapshot{Requests: 20, SuccessRate: 0.75, RetryRate: 0.5, P95Latency: 4 * time.Millisecond}
+	if got := window.Host("api.example.com"); got != want {
+		t.Errorf("Host = %+v, want %+v", got, want)
+	}
+	if got := window.Host("other.example.com"); got != (Snapshot{}) {
+		t.Errorf("Host of an unknown host = %+v, want zero", got)
+	}
+}
+
+func TestRollingWindowExpires(t *testing.T) {
+	now := time.Unix(1000, 0)
+	window := newTestWindow(&now)
+
+	window.Record(transport.RequestResult{Host: "a.example.com", Attempts: 1, Succeeded: true})
+	now = now.Add(30 * time.Second)
+	window.Record(transport.RequestResult{Host: "a.example.com", Attempts: 1})
+	window.Record(transport.RequestResult{Host: "b.example.com", Attempts: 1})
+
+	if got := window.Host("a.example.com").Requests; got != 2 {
+		t.Errorf("requests within the window = %d, want 2", got)
+	}
+	if got := window.Hosts(); fmt.Sprint(got) != "[a.example.com b.example.com]" {
+		t.Errorf("Hosts = %v", got)
+	}
+
+	// 最初のリクエストはウィンドウの外になる
+	now = now.Add(31 * time.Second)
+	if got := window.Host("a.example.com"); got.Requests != 1 || got.SuccessRate != 0 {
+		t.Errorf("Host after the first bucket expired = %+v, want 1 failed request", got)
+	}
+
+	now = now.Add(time.Minute)
+	if got := window.Hosts(); len(got) != 0 {
+		t.Errorf("Hosts after the window = %v, want none", got)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		name      string
+		latencies []time.Duration
+		p         float64
+		want      time.Duration
+	}{
+		{"single", []time.Duration{1500 * time.Microsecond}, 0.95, 2 * time.Millisecond},
+		{"upper bound is inclusive", []time.Duration{time.Millisecond}, 0.95, time.Millisecond},
+		{"median", []time.Duration{time.Millisecond, 10 * time.Millisecond, time.Second}, 0.5, 16 * time.Millisecond},
+		{"over the largest bound", []time.Duration{time.Hour}, 0.95, latencyBounds[len(latencyBounds)-1]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var histogram [latencyBucketCount + 1]int
+			for _, d := range tt.latencies {
+				histogram[latencyIndex(d)]++
+			}
+			if got := percentile(histogram[:], len(tt.latencies), tt.p); got != tt.want {
+				t.Errorf("percentile = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// BenchmarkRollingWindowRecord は、並行して異なるホストのリクエストの結果を RollingWindow に集計する時間を、
+// 1 つのロックで保護した場合 (shards=1) とシャードに分散した場合で比較する
+// 例: go test ./retryhttp/stats -run '^$' -bench RollingWindowRecord -cpu 1,16
+func BenchmarkRollingWindowRecord(b *testing.B) {
+	hosts := make([]string, 1000)
+	for i := range hosts {
+		hosts[i] = fmt.Sprintf("host-%d.example.com", i)
+	}
+
+	for _, shards := range []int{1, 0} {
+		name := fmt.Sprintf("shards=%d", shards)
+		if shards == 0 {
+			name = "shards=default"
+		}
+		b.Run(name, func(b *testing.B) {
+			window := NewShardedRollingWindow(time.Minute, shards)
+
+			var next atomic.Uint64
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					window.Record(transport.RequestResult{
+						Host:      hosts[next.Add(1)%uint64(len(hosts))],
+						Attempts:  1,
+						Succeeded: true,
+						Duration:  time.Millisecond,
+					})
+				}
+			})
+		})
+	}
+}
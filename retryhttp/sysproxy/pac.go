@@ -0,0 +1,607 @@
+package sysproxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// ErrUnsupportedPAC は、PAC ファイルに ParsePAC で評価できない構文が含まれていることを表すエラー
+var ErrUnsupportedPAC = errors.New("unsupported PAC syntax")
+
+// PAC は ParsePAC で解析した PAC ファイル
+type PAC struct {
+	urlParam, hostParam string
+	body                pacStmt
+}
+
+// ParsePAC は、PAC ファイルの FindProxyForURL 関数を解析する
+// JavaScript のエンジンを使用しないため、社内ネットワークの PAC ファイルで一般的な次の構文のみを評価する
+//   - if / else、ブロック、return 文
+//   - ||、&&、!、==、!=、括弧、文字列の + による連結
+//   - isPlainHostName, dnsDomainIs, localHostOrDomainIs, shExpMatch, isInNet, isResolvable, dnsResolve, myIpAddress
+//
+// 変数の宣言や上記以外の関数など、評価できない構文が含まれる場合は ErrUnsupportedPAC を返却する
+func ParsePAC(script string) (*PAC, error) {
+	tokens, err := tokenizePAC(script)
+	if err != nil {
+		return nil, err
+	}
+	p := &pacParser{tokens: tokens}
+	return p.program()
+}
+
+// FindProxy は、FindProxyForURL を評価した結果 ("PROXY host:port; DIRECT" など) を返却する
+func (p *PAC) FindProxy(u *url.URL) (string, error) {
+	env := map[string]string{p.urlParam: u.String(), p.hostParam: u.Hostname()}
+	result, returned, err := p.body(env)
+	if err != nil {
+		return "", err
+	}
+	if !returned {
+		return "DIRECT", nil
+	}
+	return result.String(), nil
+}
+
+// ProxyFunc は、PAC ファイルの評価結果の最初のプロキシを使用する関数を返却する
+// NOTE: 評価結果に複数のプロキシがある場合も、http.Transport は 1 つのプロキシしか使用できないため、2 番目以降は使用しない
+func (p *PAC) ProxyFunc() ProxyFunc {
+	return func(req *http.Request) (*url.URL, error) {
+		result, err := p.FindProxy(req.URL)
+		if err != nil {
+			return nil, err
+		}
+		return parsePACResult(result)
+	}
+}
+
+// parsePACResult は、PAC ファイルの評価結果の最初の項目をプロキシの URL に変換する。DIRECT の場合は nil を返却する
+func parsePACResult(result string) (*url.URL, error) {
+	first, _, _ := strings.Cut(result, ";")
+	fields := strings.Fields(first)
+	if len(fields) == 0 || strings.EqualFold(fields[0], "DIRECT") {
+		return nil, nil
+	}
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("invalid PAC result %q", result)
+	}
+	scheme := map[string]string{"PROXY": "http", "HTTP": "http", "HTTPS": "https", "SOCKS": "socks5", "SOCKS5": "socks5"}[strings.ToUpper(fields[0])]
+	if scheme == "" {
+		return nil, fmt.Errorf("invalid PAC result %q", result)
+	}
+	return url.Parse(scheme + "://" + fields[1])
+}
+
+// pacValue は PAC ファイルの式の値。文字列または真偽値
+type pacValue struct {
+	str    string
+	b      bool
+	isBool bool
+}
+
+func (v pacValue) String() string {
+	if v.isBool {
+		return fmt.Sprint(v.b)
+	}
+	return v.str
+}
+
+// truthy は JavaScript と同様に、空文字列と false を偽とする
+func (v pacValue) truthy() bool {
+	if v.isBool {
+		return v.b
+	}
+	return v.str != ""
+}
+
+func pacString(s string) pacValue { return pacValue{str: s} }
+func pacBool(b bool) pacValue     { return pacValue{b: b, isBool: true} }
+
+// pacStmt は文を評価する関数。return 文を評価した場合は returned に true を返却する
+type pacStmt func(env map[string]string) (result pacValue, returned bool, err error)
+
+// pacExpr は式を評価する関数
+type pacExpr func(env map[string]string) (pacValue, error)
+
+// pacToken は PAC ファイルの字句。kind は "ident", "string", または記号そのもの
+type pacToken struct {
+	kind  string
+	value string
+}
+
+// tokenizePAC は PAC ファイルを字句に分割する。コメントは読み飛ばす
+func tokenizePAC(script string) ([]pacToken, error) {
+	var tokens []pacToken
+	for i := 0; i < len(script); {
+		c := script[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case strings.HasPrefix(script[i:], "//"):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				return tokens, nil
+			}
+			i += end
+		case strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unterminated comment", ErrUnsupportedPAC)
+			}
+			i += end + 4
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(script[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unterminated string", ErrUnsupportedPAC)
+			}
+			tokens = append(tokens, pacToken{kind: "string", value: script[i+1 : i+1+end]})
+			i += end + 2
+		case c == '_' || c == '$' || unicode.IsLetter(rune(c)):
+			start := i
+			for i < len(script) && (script[i] == '_' || script[i] == '$' || unicode.IsLetter(rune(script[i])) || unicode.IsDigit(rune(script[i]))) {
+				i++
+			}
+			tokens = append(tokens, pacToken{kind: "ident", value: script[start:i]})
+		default:
+			symbol := ""
+			for _, s := range []string{"===", "!==", "==", "!=", "||", "&&", "(", ")", "{", "}", ",", ";", "!", "+"} {
+				if strings.HasPrefix(script[i:], s) {
+					symbol = s
+					break
+				}
+			}
+			if symbol == "" {
+				return nil, fmt.Errorf("%w: unexpected character %q", ErrUnsupportedPAC, c)
+			}
+			// NOTE: 評価する値は文字列と真偽値のみのため、厳密等価演算子は等価演算子と同じとみなす
+			kind := symbol
+			if symbol == "===" || symbol == "!==" {
+				kind = symbol[:2]
+			}
+			tokens = append(tokens, pacToken{kind: kind})
+			i += len(symbol)
+		}
+	}
+	return tokens, nil
+}
+
+// pacParser は字句から評価する関数を組み立てる再帰下降の構文解析器
+type pacParser struct {
+	tokens []pacToken
+	pos    int
+}
+
+func (p *pacParser) peek() pacToken {
+	if p.pos >= len(p.tokens) {
+		return pacToken{kind: "eof"}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *pacParser) next() pacToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+// accept は、次の字句が kind の場合に読み進めて true を返却する
+func (p *pacParser) accept(kind string) bool {
+	if p.peek().kind == kind {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// expect は、次の字句が kind の場合に読み進める。異なる場合は ErrUnsupportedPAC を返却する
+func (p *pacParser) expect(kind string) (pacToken, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, fmt.Errorf("%w: expected %s but got %s %q", ErrUnsupportedPAC, kind, t.kind, t.value)
+	}
+	return t, nil
+}
+
+// keyword は、次の字句が識別子 word の場合に読み進めて true を返却する
+func (p *pacParser) keyword(word string) bool {
+	if t := p.peek(); t.kind == "ident" && t.value == word {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// program は function FindProxyForURL(url, host) { ... } を解析する
+func (p *pacParser) program() (*PAC, error) {
+	if !p.keyword("function") || !p.keyword("FindProxyForURL") {
+		return nil, fmt.Errorf("%w: FindProxyForURL function not found", ErrUnsupportedPAC)
+	}
+	if _, err := p.expect("("); err != nil {
+		return nil, err
+	}
+	urlParam, err := p.expect("ident")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(","); err != nil {
+		return nil, err
+	}
+	hostParam, err := p.expect("ident")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != "eof" {
+		return nil, fmt.Errorf("%w: unexpected %s %q after FindProxyForURL", ErrUnsupportedPAC, t.kind, t.value)
+	}
+	return &PAC{urlParam: urlParam.value, hostParam: hostParam.value, body: body}, nil
+}
+
+// block は { 文... } を解析する
+func (p *pacParser) block() (pacStmt, error) {
+	if _, err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var stmts []pacStmt
+	for !p.accept("}") {
+		if p.peek().kind == "eof" {
+			return nil, fmt.Errorf("%w: unterminated block", ErrUnsupportedPAC)
+		}
+		stmt, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, stmt)
+	}
+	return func(env map[string]string) (pacValue, bool, error) {
+		for _, stmt := range stmts {
+			if result, returned, err := stmt(env); err != nil || returned {
+				return result, returned, err
+			}
+		}
+		return pacValue{}, false, nil
+	}, nil
+}
+
+// statement は if 文、ブロック、return 文、空の文を解析する
+func (p *pacParser) statement() (pacStmt, error) {
+	switch {
+	case p.peek().kind == "{":
+		return p.block()
+	case p.accept(";"):
+		return func(map[string]string) (pacValue, bool, error) { return pacValue{}, false, nil }, nil
+	case p.keyword("return"):
+		value, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		p.accept(";")
+		return func(env map[string]string) (pacValue, bool, error) {
+			v, err := value(env)
+			return v, err == nil, err
+		}, nil
+	case p.keyword("if"):
+		if _, err := p.expect("("); err != nil {
+			return nil, err
+		}
+		cond, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		then, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		otherwise := pacStmt(func(map[string]string) (pacValue, bool, error) { return pacValue{}, false, nil })
+		if p.keyword("else") {
+			if otherwise, err = p.statement(); err != nil {
+				return nil, err
+			}
+		}
+		return func(env map[string]string) (pacValue, bool, error) {
+			v, err := cond(env)
+			if err != nil {
+				return pacValue{}, false, err
+			}
+			if v.truthy() {
+				return then(env)
+			}
+			return otherwise(env)
+		}, nil
+	}
+	t := p.peek()
+	return nil, fmt.Errorf("%w: unexpected %s %q", ErrUnsupportedPAC, t.kind, t.value)
+}
+
+// expression は || で連結した式を解析する
+func (p *pacParser) expression() (pacExpr, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		l := left
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = func(env map[string]string) (pacValue, error) {
+			v, err := l(env)
+			if err != nil || v.truthy() {
+				return v, err
+			}
+			return right(env)
+		}
+	}
+	return left, nil
+}
+
+// and は && で連結した式を解析する
+func (p *pacParser) and() (pacExpr, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		l := left
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = func(env map[string]string) (pacValue, error) {
+			v, err := l(env)
+			if err != nil || !v.truthy() {
+				return v, err
+			}
+			return right(env)
+		}
+	}
+	return left, nil
+}
+
+// unary は ! を付けた式と、== または != で比較する式を解析する
+func (p *pacParser) unary() (pacExpr, error) {
+	if p.accept("!") {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(env map[string]string) (pacValue, error) {
+			v, err := operand(env)
+			return pacBool(!v.truthy()), err
+		}, nil
+	}
+
+	left, err := p.concat()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!="} {
+		if !p.accept(op) {
+			continue
+		}
+		right, err := p.concat()
+		if err != nil {
+			return nil, err
+		}
+		negate := op == "!="
+		return func(env map[string]string) (pacValue, error) {
+			l, err := left(env)
+			if err != nil {
+				return pacValue{}, err
+			}
+			r, err := right(env)
+			if err != nil {
+				return pacValue{}, err
+			}
+			return pacBool((l == r) != negate), nil
+		}, nil
+	}
+	return left, nil
+}
+
+// concat は + で連結した文字列の式を解析する
+func (p *pacParser) concat() (pacExpr, error) {
+	left, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("+") {
+		l := left
+		right, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		left = func(env map[string]string) (pacValue, error) {
+			lv, err := l(env)
+			if err != nil {
+				return pacValue{}, err
+			}
+			rv, err := right(env)
+			return pacString(lv.String() + rv.String()), err
+		}
+	}
+	return left, nil
+}
+
+// primary は文字列、引数の変数、true と false、関数呼び出し、括弧で囲んだ式を解析する
+func (p *pacParser) primary() (pacExpr, error) {
+	t := p.next()
+	switch t.kind {
+	case "string":
+		return func(map[string]string) (pacValue, error) { return pacString(t.value), nil }, nil
+	case "(":
+		expr, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	case "ident":
+		if t.value == "true" || t.value == "false" {
+			return func(map[string]string) (pacValue, error) { return pacBool(t.value == "true"), nil }, nil
+		}
+		if p.peek().kind != "(" {
+			return func(env map[string]string) (pacValue, error) {
+				v, ok := env[t.value]
+				if !ok {
+					return pacValue{}, fmt.Errorf("%w: undefined variable %s", ErrUnsupportedPAC, t.value)
+				}
+				return pacString(v), nil
+			}, nil
+		}
+		return p.call(t.value)
+	}
+	return nil, fmt.Errorf("%w: unexpected %s %q", ErrUnsupportedPAC, t.kind, t.value)
+}
+
+// call は、関数呼び出しの引数を解析して組み込み関数を呼び出す式を返却する
+func (p *pacParser) call(name string) (pacExpr, error) {
+	fn, ok := pacFunctions[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: function %s", ErrUnsupportedPAC, name)
+	}
+	p.next()
+	var args []pacExpr
+	for !p.accept(")") {
+		if len(args) > 0 {
+			if _, err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	if len(args) != fn.arity {
+		return nil, fmt.Errorf("%w: %s takes %d arguments", ErrUnsupportedPAC, name, fn.arity)
+	}
+	return func(env map[string]string) (pacValue, error) {
+		values := make([]string, len(args))
+		for i, arg := range args {
+			v, err := arg(env)
+			if err != nil {
+				return pacValue{}, err
+			}
+			values[i] = v.String()
+		}
+		return fn.call(values), nil
+	}, nil
+}
+
+// pacFunction は PAC ファイルの組み込み関数
+type pacFunction struct {
+	arity int
+	call  func(args []string) pacValue
+}
+
+// pacFunctions は評価できる PAC ファイルの組み込み関数
+var pacFunctions = map[string]pacFunction{
+	"isPlainHostName": {1, func(args []string) pacValue {
+		return pacBool(!strings.Contains(args[0], "."))
+	}},
+	"dnsDomainIs": {2, func(args []string) pacValue {
+		return pacBool(strings.HasSuffix(strings.ToLower(args[0]), strings.ToLower(args[1])))
+	}},
+	"localHostOrDomainIs": {2, func(args []string) pacValue {
+		host, hostdom := strings.ToLower(args[0]), strings.ToLower(args[1])
+		return pacBool(host == hostdom || !strings.Contains(host, ".") && strings.HasPrefix(hostdom, host+"."))
+	}},
+	"shExpMatch": {2, func(args []string) pacValue {
+		return pacBool(shExpMatch(args[0], args[1]))
+	}},
+	"isInNet": {3, func(args []string) pacValue {
+		ip := resolveIPv4(args[0])
+		pattern, mask := net.ParseIP(args[1]).To4(), net.ParseIP(args[2]).To4()
+		if ip == nil || pattern == nil || mask == nil {
+			return pacBool(false)
+		}
+		return pacBool(ip.Mask(net.IPMask(mask)).Equal(pattern.Mask(net.IPMask(mask))))
+	}},
+	"isResolvable": {1, func(args []string) pacValue {
+		return pacBool(resolveIPv4(args[0]) != nil)
+	}},
+	"dnsResolve": {1, func(args []string) pacValue {
+		if ip := resolveIPv4(args[0]); ip != nil {
+			return pacString(ip.String())
+		}
+		return pacString("")
+	}},
+	"myIpAddress": {0, func([]string) pacValue {
+		return pacString(myIPAddress())
+	}},
+}
+
+// resolveIPv4 は、ホスト名を名前解決した最初の IPv4 アドレスを返却する。IP アドレスの場合はそのまま返却する
+func resolveIPv4(host string) net.IP {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.To4()
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil
+	}
+	for _, ip := range ips {
+		if v4 := ip.To4(); v4 != nil {
+			return v4
+		}
+	}
+	return nil
+}
+
+// myIPAddress は、ループバック以外の最初の IPv4 アドレスを返却する。見つからない場合は 127.0.0.1
+func myIPAddress() string {
+	addrs, err := net.InterfaceAddrs()
+	if err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+				return ipNet.IP.String()
+			}
+		}
+	}
+	return "127.0.0.1"
+}
+
+// shExpMatch は、* (任意の文字列) と ? (任意の 1 文字) を使用したシェルのパターンに s が一致するか判定する
+// NOTE: path.Match と異なり、* は / にも一致する
+func shExpMatch(s string, pattern string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if shExpMatch(s[i:], pattern[1:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		s, pattern = s[1:], pattern[1:]
+	}
+	return len(s) == 0
+}
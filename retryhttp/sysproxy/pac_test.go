@@ -0,0 +1,234 @@
+package sysproxy
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// corporatePAC は社内ネットワークで一般的な構成の PAC ファイル
+const corporatePAC = `
+/* 社内のホストは直接接続し、それ以外はプロキシを経由する */
+function FindProxyForURL(url, host) {
+	// ドメインのないホスト名とループバック
+	if (isPlainHostName(host) || host === "127.0.0.1")
+		return "DIRECT";
+	if (dnsDomainIs(host, ".intra.example.com") || isInNet(host, "10.0.0.0", "255.0.0.0")) {
+		return 'DIRECT';
+	}
+	if (shExpMatch(url, "https://*.example.org/*") && !localHostOrDomainIs(host, "www.example.org"))
+		return "HTTPS secure.example.com:443";
+	if (shExpMatch(host, "*.cn") != false)
+		return "SOCKS socks.example.com:1080";
+	return "PROXY " + "proxy.example.com:8080" + "; DIRECT";
+}
+`
+
+func TestPACFindProxy(t *testing.T) {
+	pac, err := ParsePAC(corporatePAC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://intranet/", "DIRECT"},
+		{"http://127.0.0.1:8080/", "DIRECT"},
+		{"http://wiki.intra.example.com/page", "DIRECT"},
+		{"http://WIKI.INTRA.EXAMPLE.COM/page", "DIRECT"},
+		{"http://10.1.2.3/", "DIRECT"},
+		{"https://api.example.org/v1", "HTTPS secure.example.com:443"},
+		{"https://www.example.org/v1", "PROXY proxy.example.com:8080; DIRECT"},
+		{"http://api.example.org/v1", "PROXY proxy.example.com:8080; DIRECT"},
+		{"http://www.example.cn/", "SOCKS socks.example.com:1080"},
+		{"http://11.1.2.3/", "PROXY proxy.example.com:8080; DIRECT"},
+		{"https://example.net/", "PROXY proxy.example.com:8080; DIRECT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+			got, err := pac.FindProxy(u)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("FindProxy = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPACFindProxyWithoutReturn は、return 文を評価しなかった場合に DIRECT を返却することを検証する
+func TestPACFindProxyWithoutReturn(t *testing.T) {
+	pac, err := ParsePAC(`function FindProxyForURL(u, h) { if (h == "proxied") return "PROXY p:1"; ; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("http://example.com/")
+	if got, err := pac.FindProxy(u); err != nil || got != "DIRECT" {
+		t.Errorf("FindProxy = %q, %v, want DIRECT", got, err)
+	}
+}
+
+func TestPACProxyFunc(t *testing.T) {
+	tests := []struct {
+		name   string
+		result string
+		// want は使用するプロキシの URL。空の場合は直接接続する
+		want string
+	}{
+		{"multiple proxies use the first", "PROXY a.example.com:8080; DIRECT", "http://a.example.com:8080"},
+		{"first is DIRECT", "DIRECT; PROXY a.example.com:8080", ""},
+		{"HTTPS", "HTTPS secure.example.com:443", "https://secure.example.com:443"},
+		{"SOCKS", "SOCKS socks.example.com:1080", "socks5://socks.example.com:1080"},
+		{"lower case", "proxy a.example.com:8080", "http://a.example.com:8080"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pac, err := ParsePAC(`function FindProxyForURL(url, host) { return "` + tt.result + `"; }`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+			proxy, err := pac.ProxyFunc()(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ""
+			if proxy != nil {
+				got = proxy.String()
+			}
+			if got != tt.want {
+				t.Errorf("proxy = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPACProxyFuncInvalidResult(t *testing.T) {
+	for _, result := range []string{"PROXY", "FTP ftp.example.com:21", "PROXY a b"} {
+		pac, err := ParsePAC(`function FindProxyForURL(url, host) { return "` + result + `"; }`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+		if proxy, err := pac.ProxyFunc()(req); err == nil {
+			t.Errorf("%q: proxy = %v, want an error", result, proxy)
+		}
+	}
+}
+
+func TestShExpMatch(t *testing.T) {
+	tests := []struct {
+		s       string
+		pattern string
+		want    bool
+	}{
+		{"www.example.com", "*.example.com", true},
+		{"example.com", "*.example.com", false},
+		{"http://example.com/a/b/c", "http://example.com/*", true},
+		{"http://example.com/a/b/c", "*/b/*", true},
+		{"host1.example.com", "host?.example.com", true},
+		{"host10.example.com", "host?.example.com", false},
+		{"abc", "abc", true},
+		{"abc", "ab", false},
+		{"", "*", true},
+		{"", "?", false},
+		{"a.b", "*.*", true},
+		{"Example.com", "example.com", false},
+	}
+	for _, tt := range tests {
+		if got := shExpMatch(tt.s, tt.pattern); got != tt.want {
+			t.Errorf("shExpMatch(%q, %q) = %v, want %v", tt.s, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestPACFunctions(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`dnsDomainIs(host, ".example.com")`, true},
+		{`dnsDomainIs(host, ".EXAMPLE.com")`, true},
+		{`dnsDomainIs(host, ".example.org")`, false},
+		{`dnsDomainIs("notexample.com", ".example.com")`, false},
+		{`isInNet("192.168.1.20", "192.168.0.0", "255.255.0.0")`, true},
+		{`isInNet("192.169.1.20", "192.168.0.0", "255.255.0.0")`, false},
+		{`isInNet("10.0.0.1", "10.0.0.1", "255.255.255.255")`, true},
+		{`isInNet("10.0.0.1", "invalid", "255.0.0.0")`, false},
+		{`isInNet("", "10.0.0.0", "255.0.0.0")`, false},
+		{`isPlainHostName("intranet")`, true},
+		{`isPlainHostName(host)`, false},
+		{`localHostOrDomainIs("www", "www.example.com")`, true},
+		{`localHostOrDomainIs(host, "www.example.com")`, true},
+		{`localHostOrDomainIs("home.example.com", "www.example.com")`, false},
+		{`dnsResolve("192.168.1.1") == "192.168.1.1"`, true},
+		{`isResolvable("192.168.1.1")`, true},
+		{`shExpMatch(url, "http://www.example.com/*")`, true},
+		{`url == "http://www.example.com/path" && host != "example.com"`, true},
+		{`!(isPlainHostName(host) || false)`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			pac, err := ParsePAC(`function FindProxyForURL(url, host) { if (` + tt.expr + `) return "yes"; return "no"; }`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			u, _ := url.Parse("http://www.example.com/path")
+			got, err := pac.FindProxy(u)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := map[bool]string{true: "yes", false: "no"}[tt.want]; got != want {
+				t.Errorf("FindProxy = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestParsePACErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+	}{
+		{"empty", ``},
+		{"no FindProxyForURL", `function other(url, host) { return "DIRECT"; }`},
+		{"missing parameter", `function FindProxyForURL(url) { return "DIRECT"; }`},
+		{"unterminated block", `function FindProxyForURL(url, host) { return "DIRECT";`},
+		{"unterminated string", `function FindProxyForURL(url, host) { return "DIRECT; }`},
+		{"unterminated comment", `function FindProxyForURL(url, host) { /* return "DIRECT"; }`},
+		{"variable declaration", `function FindProxyForURL(url, host) { var proxy = "DIRECT"; return proxy; }`},
+		{"unknown function", `function FindProxyForURL(url, host) { return myProxy(host); }`},
+		{"wrong arity", `function FindProxyForURL(url, host) { if (dnsDomainIs(host)) return "DIRECT"; }`},
+		{"missing closing parenthesis", `function FindProxyForURL(url, host) { if (isPlainHostName(host) return "DIRECT"; }`},
+		{"unexpected character", `function FindProxyForURL(url, host) { return host < "m"; }`},
+		{"code after the function", `function FindProxyForURL(url, host) { return "DIRECT"; } alert("x");`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if pac, err := ParsePAC(tt.script); !errors.Is(err, ErrUnsupportedPAC) {
+				t.Errorf("ParsePAC = %v, %v, want ErrUnsupportedPAC", pac, err)
+			}
+		})
+	}
+}
+
+// TestPACFindProxyUndefinedVariable は、引数以外の変数を評価時にエラーとすることを検証する
+func TestPACFindProxyUndefinedVariable(t *testing.T) {
+	pac, err := ParsePAC(`function FindProxyForURL(url, host) { if (host == "a") return proxy; return "DIRECT"; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("http://a/")
+	if got, err := pac.FindProxy(u); !errors.Is(err, ErrUnsupportedPAC) {
+		t.Errorf("FindProxy = %q, %v, want ErrUnsupportedPAC", got, err)
+	}
+	u, _ = url.Parse("http://b/")
+	if got, err := pac.FindProxy(u); err != nil || got != "DIRECT" {
+		t.Errorf("FindProxy = %q, %v, want DIRECT", got, err)
+	}
+}
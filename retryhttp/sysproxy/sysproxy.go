@@ -0,0 +1,203 @@
+// Package sysproxy は、環境変数や OS の設定、PAC ファイルから送信に使用するプロキシを検出する
+// NOTE: 社内ネットワークの CLI の利用者が、プロキシのフラグを手動で指定せずに済むようにするために使用する
+package sysproxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// ProxyFunc は、http.Transport.Proxy に指定する、リクエストの送信に使用するプロキシを返却する関数の型定義
+// nil の URL を返却した場合は、プロキシを使用せずに直接送信する
+type ProxyFunc func(req *http.Request) (*url.URL, error)
+
+// Settings は OS に設定されているプロキシの設定
+type Settings struct {
+	// HTTPProxy と HTTPSProxy は、http と https の URL の送信に使用するプロキシ ("host:port" または URL)。空文字列の場合は直接送信する
+	HTTPProxy  string
+	HTTPSProxy string
+	// Bypass はプロキシを使用しないホストのパターン。"*.example.com" のようにワイルドカードを使用できる
+	// "<local>" は、ドットを含まないホスト名に一致する
+	Bypass []string
+	// PACURL は PAC ファイルの URL。指定されている場合は HTTPProxy と HTTPSProxy より優先する
+	PACURL string
+}
+
+// Option は Detect の設定を変更する関数の型定義
+type Option func(*detector)
+
+// detector は Detect の設定
+type detector struct {
+	client      *http.Client
+	environment bool
+	system      func(ctx context.Context) (Settings, error)
+}
+
+// WithHTTPClient は、PAC ファイルの取得に使用する *http.Client を設定する。デフォルトは 10 秒でタイムアウトする *http.Client
+func WithHTTPClient(client *http.Client) Option {
+	return func(d *detector) {
+		d.client = client
+	}
+}
+
+// WithoutEnvironment は、HTTP_PROXY などの環境変数を無視して OS の設定のみを使用する
+func WithoutEnvironment() Option {
+	return func(d *detector) {
+		d.environment = false
+	}
+}
+
+// Detect は、環境変数、OS の設定の順にプロキシの設定を検出し、送信に使用するプロキシを返却する関数を返却する
+// HTTP_PROXY、HTTPS_PROXY のいずれかの環境変数が設定されている場合は、http.ProxyFromEnvironment と同様に環境変数の設定を使用する
+// OS の設定は、Windows はインターネット オプション (レジストリ)、macOS は scutil --proxy の結果から取得する
+// OS の設定に PAC ファイルの URL がある場合は、PAC ファイルを取得して評価する。評価できる PAC ファイルの構文は ParsePAC を参照
+// NOTE: プロキシの設定がない場合は、プロキシを使用しない関数を返却する
+func Detect(ctx context.Context, opts ...Option) (ProxyFunc, error) {
+	d := &detector{
+		client:      &http.Client{Timeout: 10 * time.Second},
+		environment: true,
+		system:      systemSettings,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	if d.environment && hasProxyEnvironment() {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	settings, err := d.system(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("detect system proxy: %w", err)
+	}
+	if settings.PACURL == "" {
+		return settings.ProxyFunc()
+	}
+
+	script, err := d.fetchPAC(ctx, settings.PACURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetch PAC %s: %w", settings.PACURL, err)
+	}
+	pac, err := ParsePAC(script)
+	if err != nil {
+		return nil, fmt.Errorf("parse PAC %s: %w", settings.PACURL, err)
+	}
+	return pac.ProxyFunc(), nil
+}
+
+// hasProxyEnvironment は、プロキシを指定する環境変数が設定されているか判定する
+func hasProxyEnvironment() bool {
+	for _, name := range []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy"} {
+		if os.Getenv(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchPAC は PAC ファイルを取得する。file スキームの URL の場合はファイルを読み込む
+func (d *detector) fetchPAC(ctx context.Context, pacURL string) (string, error) {
+	u, err := url.Parse(pacURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "file" {
+		path := u.Path
+		// NOTE: Windows の file:///C:/proxy.pac は、先頭のスラッシュを取り除いてパスとする
+		if len(path) > 2 && path[0] == '/' && path[2] == ':' {
+			path = path[1:]
+		}
+		data, err := os.ReadFile(path)
+		return string(data), err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pacURL, nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := d.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxPACSize))
+	return string(data), err
+}
+
+// maxPACSize は取得する PAC ファイルの最大サイズ
+const maxPACSize = 1 << 20
+
+// ProxyFunc は、設定のプロキシを使用する関数を返却する。PACURL は使用しない
+func (s Settings) ProxyFunc() (ProxyFunc, error) {
+	httpProxy, err := parseProxyURL(s.HTTPProxy)
+	if err != nil {
+		return nil, err
+	}
+	httpsProxy, err := parseProxyURL(s.HTTPSProxy)
+	if err != nil {
+		return nil, err
+	}
+	bypass := append([]string(nil), s.Bypass...)
+	return func(req *http.Request) (*url.URL, error) {
+		if bypassed(req.URL.Hostname(), bypass) {
+			return nil, nil
+		}
+		if req.URL.Scheme == "https" {
+			return httpsProxy, nil
+		}
+		return httpProxy, nil
+	}, nil
+}
+
+// parseProxyURL は "host:port" または URL の形式のプロキシを URL に変換する。空文字列の場合は nil を返却する
+func parseProxyURL(proxy string) (*url.URL, error) {
+	if proxy == "" {
+		return nil, nil
+	}
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", proxy, err)
+	}
+	return u, nil
+}
+
+// bypassed は、ホストがプロキシを使用しないパターンに一致するか判定する
+// NOTE: localhost とループバックアドレスは、http.ProxyFromEnvironment と同様に常にプロキシを使用しない
+func bypassed(host string, patterns []string) bool {
+	if host == "localhost" {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return true
+	}
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		switch {
+		case pattern == "":
+			continue
+		case strings.EqualFold(pattern, "<local>"):
+			if !strings.Contains(host, ".") {
+				return true
+			}
+		case shExpMatch(strings.ToLower(host), strings.ToLower(pattern)):
+			return true
+		case strings.HasPrefix(pattern, ".") && strings.HasSuffix(strings.ToLower(host), strings.ToLower(pattern)):
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+//go:build darwin
+
+package sysproxy
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+)
+
+// systemSettings は、scutil --proxy の結果からネットワーク環境設定のプロキシの設定を取得する
+func systemSettings(ctx context.Context) (Settings, error) {
+	output, err := exec.CommandContext(ctx, "scutil", "--proxy").Output()
+	if err != nil {
+		return Settings{}, err
+	}
+	return parseScutilProxy(string(output)), nil
+}
+
+// parseScutilProxy は、scutil --proxy の結果を解析する
+// NOTE: 結果は "HTTPProxy : proxy.example.com" のような行と、ExceptionsList の配列の要素の "0 : *.local" のような行からなる
+func parseScutilProxy(output string) Settings {
+	values := map[string]string{}
+	var exceptions []string
+	inExceptions := false
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "}" {
+			inExceptions = false
+			continue
+		}
+		key, value, ok := strings.Cut(line, " : ")
+		if !ok {
+			continue
+		}
+		if inExceptions {
+			exceptions = append(exceptions, value)
+			continue
+		}
+		if key == "ExceptionsList" {
+			inExceptions = true
+			continue
+		}
+		values[key] = value
+	}
+
+	settings := Settings{Bypass: exceptions}
+	if values["ProxyAutoConfigEnable"] == "1" {
+		settings.PACURL = values["ProxyAutoConfigURLString"]
+	}
+	if values["HTTPEnable"] == "1" && values["HTTPProxy"] != "" {
+		settings.HTTPProxy = values["HTTPProxy"] + ":" + values["HTTPPort"]
+	}
+	if values["HTTPSEnable"] == "1" && values["HTTPSProxy"] != "" {
+		settings.HTTPSProxy = values["HTTPSProxy"] + ":" + values["HTTPSPort"]
+	}
+	return settings
+}
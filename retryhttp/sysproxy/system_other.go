@@ -0,0 +1,11 @@
+//go:build !windows && !darwin
+
+package sysproxy
+
+import "context"
+
+// systemSettings は、OS のプロキシの設定を取得する
+// NOTE: Windows と macOS 以外では OS 共通の設定がないため、環境変数の設定のみを使用する
+func systemSettings(context.Context) (Settings, error) {
+	return Settings{}, nil
+}
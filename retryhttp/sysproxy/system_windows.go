@@ -0,0 +1,68 @@
+//go:build windows
+
+package sysproxy
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// internetSettingsKey は、インターネット オプションのプロキシの設定を格納するレジストリのキー
+const internetSettingsKey = `Software\Microsoft\Windows\CurrentVersion\Internet Settings`
+
+// systemSettings は、現在のユーザーのインターネット オプションからプロキシの設定を取得する
+func systemSettings(context.Context) (Settings, error) {
+	key, err := registry.OpenKey(registry.CURRENT_USER, internetSettingsKey, registry.QUERY_VALUE)
+	if err != nil {
+		return Settings{}, err
+	}
+	defer key.Close()
+
+	var settings Settings
+	if pacURL, _, err := key.GetStringValue("AutoConfigURL"); err == nil {
+		settings.PACURL = pacURL
+	} else if !errors.Is(err, registry.ErrNotExist) {
+		return Settings{}, err
+	}
+
+	enabled, _, err := key.GetIntegerValue("ProxyEnable")
+	if err != nil && !errors.Is(err, registry.ErrNotExist) {
+		return Settings{}, err
+	}
+	if enabled == 0 {
+		return settings, nil
+	}
+	server, _, err := key.GetStringValue("ProxyServer")
+	if err != nil && !errors.Is(err, registry.ErrNotExist) {
+		return Settings{}, err
+	}
+	settings.HTTPProxy, settings.HTTPSProxy = parseProxyServer(server)
+	if override, _, err := key.GetStringValue("ProxyOverride"); err == nil {
+		settings.Bypass = strings.Split(override, ";")
+	}
+	return settings, nil
+}
+
+// parseProxyServer は、ProxyServer の値から http と https のプロキシを返却する
+// NOTE: 値は "host:port" の場合はすべてのプロトコルに、"http=host:port;https=host:port" の場合はプロトコルごとに使用する
+func parseProxyServer(server string) (httpProxy string, httpsProxy string) {
+	if !strings.Contains(server, "=") {
+		return server, server
+	}
+	for _, entry := range strings.Split(server, ";") {
+		protocol, proxy, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(protocol) {
+		case "http":
+			httpProxy = proxy
+		case "https":
+			httpsProxy = proxy
+		}
+	}
+	return httpProxy, httpsProxy
+}
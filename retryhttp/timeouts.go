@@ -0,0 +1,95 @@
+package retryhttp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// TimeoutConfig はタイムアウトの階層を表す設定
+// 内側から順に、コネクション確立 (Connect)、TLS ハンドシェイク (TLSHandshake)、レスポンスヘッダーの受信 (ResponseHeader)、
+// 1 回の試行 (PerAttempt)、リトライとバックオフを含むリクエスト全体 (Overall) のタイムアウトとなる
+// 0 の項目はタイムアウトを設定しない
+type TimeoutConfig struct {
+	Connect        time.Duration `yaml:"connect"`
+	TLSHandshake   time.Duration `yaml:"tls_handshake"`
+	ResponseHeader time.Duration `yaml:"response_header"`
+	PerAttempt     time.Duration `yaml:"per_attempt"`
+	Overall        time.Duration `yaml:"overall"`
+}
+
+// DefaultTimeoutConfig はデフォルトのタイムアウト設定を返却する
+// NOTE: Connect と TLSHandshake は http.DefaultTransport と同じ値
+func DefaultTimeoutConfig() TimeoutConfig {
+	return TimeoutConfig{
+		Connect:      30 * time.Second,
+		TLSHandshake: 10 * time.Second,
+		Overall:      30 * time.Second,
+	}
+}
+
+// ErrInvalidTimeoutConfig は、タイムアウトの階層が矛盾していることを表すエラー
+var ErrInvalidTimeoutConfig = errors.New("invalid timeout config")
+
+// Validate はタイムアウトの階層が矛盾していないか検証する
+// 内側のタイムアウトが外側のタイムアウトより長い場合、内側のタイムアウトは意味を持たないためエラーとする
+func (c TimeoutConfig) Validate() error {
+	values := map[string]time.Duration{
+		"Connect":        c.Connect,
+		"TLSHandshake":   c.TLSHandshake,
+		"ResponseHeader": c.ResponseHeader,
+		"PerAttempt":     c.PerAttempt,
+		"Overall":        c.Overall,
+	}
+	for name, v := range values {
+		if v < 0 {
+			return fmt.Errorf("%w: %s must not be negative", ErrInvalidTimeoutConfig, name)
+		}
+	}
+
+	checks := []struct {
+		inner, outer           string
+		innerValue, outerValue time.Duration
+	}{
+		{"PerAttempt", "Overall", c.PerAttempt, c.Overall},
+		{"ResponseHeader", "PerAttempt", c.ResponseHeader, c.PerAttempt},
+		{"ResponseHeader", "Overall", c.ResponseHeader, c.Overall},
+	}
+	for _, check := range checks {
+		if check.innerValue > 0 && check.outerValue > 0 && check.innerValue > check.outerValue {
+			return fmt.Errorf("%w: %s (%s) must not exceed %s (%s)",
+				ErrInvalidTimeoutConfig, check.inner, check.innerValue, check.outer, check.outerValue)
+		}
+	}
+	return nil
+}
+
+// NewClientWithTimeouts はタイムアウトの設定と opts を検証してから Client 構造体を作成する
+// NOTE: opts で WithTimeout などタイムアウトを変更するオプションを指定した場合は、そちらが優先される
+func NewClientWithTimeouts(config TimeoutConfig, opts ...Option) (*Client, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	client := NewClient(append([]Option{WithTimeouts(config)}, opts...)...)
+	if err := client.Err(); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// NewBaseTransport は、コネクション確立、TLS ハンドシェイク、レスポンスヘッダーのタイムアウトを設定した *http.Transport を作成する
+// NOTE: WithTransport で親の Transport をラップする場合に、タイムアウトの設定を引き継ぐために使用する
+func NewBaseTransport(config TimeoutConfig) *http.Transport {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{
+		Timeout:   config.Connect,
+		KeepAlive: 30 * time.Second,
+	}
+	base.DialContext = dialer.DialContext
+	base.TLSHandshakeTimeout = config.TLSHandshake
+	base.ResponseHeaderTimeout = config.ResponseHeader
+	return base
+}
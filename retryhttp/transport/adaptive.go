@@ -0,0 +1,160 @@
+package transport
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/mtnori/httpRetryExample/retryhttp/internal/shard"
+)
+
+// adaptiveBuckets は AdaptiveConfig.Window を分割するバケット数
+const adaptiveBuckets = 10
+
+// AdaptiveConfig は、ホストごとの直近の失敗率に応じてリトライを抑制する設定
+// ゼロ値の項目はデフォルト値を使用する
+type AdaptiveConfig struct {
+	// Window は失敗率を集計する期間。デフォルトは 30 秒
+	Window time.Duration
+	// MinAttempts は失敗率を判定するために必要な、集計期間内の最小の試行回数。デフォルトは 20
+	MinAttempts int
+	// Threshold はリトライを抑制し始める失敗率。デフォルトは 0.5
+	Threshold float64
+	// MaxStretch は、すべての試行が失敗している場合にバックオフを引き伸ばす倍率。デフォルトは 8
+	MaxStretch float64
+	// ReduceAttempts は、失敗率に応じてリトライ回数も減らすか。すべての試行が失敗している場合はリトライしない
+	ReduceAttempts bool
+	// IsFailure は試行の結果を失敗とみなすか判定する関数。デフォルトは送信エラー、429 または 5xx を失敗とする
+	IsFailure func(*http.Response, error) bool
+}
+
+// WithAdaptiveRetry は、ホストごとに直近の試行の失敗率を集計し、失敗率が config.Threshold を超えた場合に
+// 失敗率に比例してバックオフを引き伸ばす (config.ReduceAttempts の場合はリトライ回数も減らす)
+// 失敗率が下がると元のバックオフとリトライ回数に戻る
+// NOTE: 固定の指数バックオフでは、ほとんどの試行が失敗している障害中のバックエンドにも同じ間隔でリトライしてしまうため、
+// 観測した失敗率をフィードバックしてリトライによる負荷を下げる。Retry-After でサーバーが指定した待機時間は引き伸ばさない
+func WithAdaptiveRetry(config AdaptiveConfig) Option {
+	if config.Window <= 0 {
+		config.Window = 30 * time.Second
+	}
+	if config.MinAttempts <= 0 {
+		config.MinAttempts = 20
+	}
+	if config.Threshold <= 0 || config.Threshold >= 1 {
+		config.Threshold = 0.5
+	}
+	if config.MaxStretch < 1 {
+		config.MaxStretch = 8
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = isAdaptiveFailure
+	}
+	return func(t *RetryableTransport) {
+		t.adaptive = &adaptiveRetry{config: config, hosts: shard.New[*adaptiveWindow](0)}
+	}
+}
+
+// isAdaptiveFailure は、送信エラー、429 Too Many Requests または 5xx を失敗とみなす
+func isAdaptiveFailure(res *http.Response, err error) bool {
+	return err != nil || res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= http.StatusInternalServerError
+}
+
+// adaptiveRetry はホストごとの直近の試行の失敗率を集計する
+type adaptiveRetry struct {
+	config AdaptiveConfig
+	hosts  *shard.Map[*adaptiveWindow]
+}
+
+// adaptiveWindow はホストごとのバケットのリングバッファ
+type adaptiveWindow struct {
+	buckets [adaptiveBuckets]adaptiveBucket
+}
+
+// adaptiveBucket は、期間ごとの試行回数と失敗した試行回数
+type adaptiveBucket struct {
+	start    time.Time
+	attempts int
+	failures int
+}
+
+// observe は試行の結果を集計する
+func (a *adaptiveRetry) observe(host string, res *http.Response, err error, now time.Time) {
+	failed := a.config.IsFailure(res, err)
+
+	hosts := a.hosts.Lock(host)
+	defer hosts.Unlock()
+
+	w, ok := hosts.Entries[host]
+	if !ok {
+		w = &adaptiveWindow{}
+		hosts.Entries[host] = w
+	}
+	width := a.config.Window / adaptiveBuckets
+	start := now.Truncate(width)
+	b := &w.buckets[(start.UnixNano()/int64(width))%adaptiveBuckets]
+	if !b.start.Equal(start) {
+		*b = adaptiveBucket{start: start}
+	}
+	b.attempts++
+	if failed {
+		b.failures++
+	}
+}
+
+// severity は、ホストの失敗率が Threshold を超えている度合いを 0 (超えていない) から 1 (すべて失敗) で返却する
+func (a *adaptiveRetry) severity(host string, now time.Time) float64 {
+	hosts := a.hosts.Lock(host)
+	defer hosts.Unlock()
+
+	w, ok := hosts.Entries[host]
+	if !ok {
+		return 0
+	}
+	var attempts, failures int
+	for _, b := range w.buckets {
+		if b.start.IsZero() || now.Sub(b.start) >= a.config.Window {
+			continue
+		}
+		attempts += b.attempts
+		failures += b.failures
+	}
+	if attempts == 0 {
+		// 集計期間内の試行がない場合は、回復したとみなして削除する
+		delete(hosts.Entries, host)
+		return 0
+	}
+	if attempts < a.config.MinAttempts {
+		return 0
+	}
+	rate := float64(failures) / float64(attempts)
+	if rate <= a.config.Threshold {
+		return 0
+	}
+	return (rate - a.config.Threshold) / (1 - a.config.Threshold)
+}
+
+// observeAdaptive は、WithAdaptiveRetry が指定されている場合に試行の結果を集計する
+func (t *RetryableTransport) observeAdaptive(req *http.Request, res *http.Response, err error) {
+	if t.adaptive == nil {
+		return
+	}
+	t.adaptive.observe(req.URL.Host, res, err, t.clock().Now())
+}
+
+// adaptiveBackoff は、WithAdaptiveRetry が指定されている場合に、ホストの失敗率に応じて引き伸ばしたバックオフを返却する
+func (t *RetryableTransport) adaptiveBackoff(req *http.Request, wait time.Duration) time.Duration {
+	if t.adaptive == nil {
+		return wait
+	}
+	s := t.adaptive.severity(req.URL.Host, t.clock().Now())
+	return time.Duration(float64(wait) * (1 + s*(t.adaptive.config.MaxStretch-1)))
+}
+
+// adaptiveMaxAttempts は、WithAdaptiveRetry で ReduceAttempts が指定されている場合に、ホストの失敗率に応じて減らしたリトライ回数を返却する
+func (t *RetryableTransport) adaptiveMaxAttempts(req *http.Request, maxAttempts int) int {
+	if t.adaptive == nil || !t.adaptive.config.ReduceAttempts {
+		return maxAttempts
+	}
+	s := t.adaptive.severity(req.URL.Host, t.clock().Now())
+	return int(math.Round(float64(maxAttempts) * (1 - s)))
+}
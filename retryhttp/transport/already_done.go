@@ -0,0 +1,49 @@
+package transport
+
+import (
+	"net/http"
+)
+
+// WithAlreadyDoneStatus は、リトライした試行で指定したステータスコードを受け取った場合に、処理済みとして成功とみなす
+// 例えば DELETE の 404 や POST (作成) の 409 は、最初の試行が実際には成功しており、接続の切断によりレスポンスを受け取れなかった可能性がある
+// 処理済みとみなしたレスポンスは ResponseMetadata.AlreadyDone で判定できる
+// NOTE: 最初の試行で受け取った場合は、処理済みとはみなさない
+func WithAlreadyDoneStatus(method string, statusCodes ...int) Option {
+	return func(t *RetryableTransport) {
+		if t.alreadyDone == nil {
+			t.alreadyDone = make(map[string]map[int]bool)
+		}
+		codes, ok := t.alreadyDone[method]
+		if !ok {
+			codes = make(map[int]bool, len(statusCodes))
+			t.alreadyDone[method] = codes
+		}
+		for _, code := range statusCodes {
+			codes[code] = true
+		}
+	}
+}
+
+// isAlreadyDone は、リトライした試行のレスポンスが処理済みを表すか判定する
+func (t *RetryableTransport) isAlreadyDone(req *http.Request, res *http.Response, attempts int) bool {
+	if attempts <= 1 || res == nil {
+		return false
+	}
+	return t.alreadyDone[req.Method][res.StatusCode]
+}
+
+// AlreadyDone は、リトライした試行のレスポンスを処理済み (WithAlreadyDoneStatus) として成功とみなしたか
+func (m *ResponseMetadata) AlreadyDone() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.alreadyDone
+}
+
+// markAlreadyDone は、レスポンスを処理済みとみなしたことを記録する
+func (m *ResponseMetadata) markAlreadyDone() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.alreadyDone = true
+}
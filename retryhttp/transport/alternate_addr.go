@@ -0,0 +1,98 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+)
+
+// AlternateAddrDial は、ダイヤルのたびにホスト名を名前解決し直し、同じリクエストの前の試行でダイヤルに失敗したアドレスを
+// 後回しにしてダイヤルする関数を返却する。http.Transport の DialContext に設定する
+// 例: base.DialContext = AlternateAddrDial(dialer.DialContext, nil)
+// dial には "IP アドレス:ポート" の形式のアドレスを渡す。resolver が nil の場合は net.DefaultResolver を使用する
+// NOTE: 一部のアドレスのサーバーが停止している場合に、キャッシュされた失敗するアドレスへのリトライを繰り返さないようにする
+// 解決したアドレスを順にダイヤルするため、net.Dialer の Happy Eyeballs (IPv4 と IPv6 の並行したダイヤル) は行わない
+// 失敗したアドレスは RetryableTransport の 1 回のリクエストの間だけ記録するため、RetryableTransport の内側で使用する
+func AlternateAddrDial(dial func(ctx context.Context, network, addr string) (net.Conn, error),
+	resolver *net.Resolver) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, addr)
+		}
+		ips, err := resolver.LookupIP(ctx, ipNetwork(network), host)
+		if err != nil {
+			return nil, err
+		}
+
+		m, _ := ctx.Value(metadataKey{}).(*ResponseMetadata)
+		var errs []error
+		for _, ip := range m.preferAddrs(ips) {
+			conn, err := dial(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			errs = append(errs, err)
+			if ctx.Err() != nil {
+				break
+			}
+			m.markFailedAddr(ip)
+		}
+		if len(errs) == 1 {
+			return nil, errs[0]
+		}
+		return nil, errors.Join(errs...)
+	}
+}
+
+// ipNetwork は、ダイヤルのネットワークに対応する名前解決のネットワークを返却する
+func ipNetwork(network string) string {
+	switch {
+	case strings.HasSuffix(network, "4"):
+		return "ip4"
+	case strings.HasSuffix(network, "6"):
+		return "ip6"
+	default:
+		return "ip"
+	}
+}
+
+// preferAddrs は、ダイヤルに失敗したアドレスを後ろに移動したアドレスを返却する
+// NOTE: すべてのアドレスで失敗している場合も、一時的な障害から回復している可能性があるため、除外せずにダイヤルする
+func (m *ResponseMetadata) preferAddrs(ips []net.IP) []net.IP {
+	if m == nil {
+		return ips
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.failedAddrs) == 0 {
+		return ips
+	}
+	preferred := make([]net.IP, 0, len(ips))
+	var failed []net.IP
+	for _, ip := range ips {
+		if m.failedAddrs[ip.String()] {
+			failed = append(failed, ip)
+			continue
+		}
+		preferred = append(preferred, ip)
+	}
+	return append(preferred, failed...)
+}
+
+// markFailedAddr は、ダイヤルに失敗したアドレスを記録する
+func (m *ResponseMetadata) markFailedAddr(ip net.IP) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failedAddrs == nil {
+		m.failedAddrs = make(map[string]bool)
+	}
+	m.failedAddrs[ip.String()] = true
+}
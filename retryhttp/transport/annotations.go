@@ -0,0 +1,126 @@
+package transport
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// annotationsKey は context.Context にアノテーションを格納するためのキー
+type annotationsKey struct{}
+
+// Annotations はリクエストに付与する任意のキーと値 (テナント、機能名、エンドポイント名など)
+// ログ、Recorder に通知される RequestResult、トレースのスパン、history.Record の監査記録などに自動的に付与される
+type Annotations map[string]string
+
+// Annotate は context.Context にアノテーションを追加する
+// NOTE: 元の context.Context のアノテーションは変更せず、コピーに追加する
+func Annotate(ctx context.Context, kv ...string) context.Context {
+	current := AnnotationsFromContext(ctx)
+	annotations := make(Annotations, len(current)+len(kv)/2)
+	for k, v := range current {
+		annotations[k] = v
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		annotations[kv[i]] = kv[i+1]
+	}
+	return context.WithValue(ctx, annotationsKey{}, annotations)
+}
+
+// AnnotationsFromContext は context.Context に付与されたアノテーションを返却する
+func AnnotationsFromContext(ctx context.Context) Annotations {
+	annotations, _ := ctx.Value(annotationsKey{}).(Annotations)
+	return annotations
+}
+
+// Keys はアノテーションのキーをソートして返却する
+func (a Annotations) Keys() []string {
+	keys := make([]string, 0, len(a))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// logArgs は slog に渡す引数に変換する
+func (a Annotations) logArgs() []any {
+	if len(a) == 0 {
+		return nil
+	}
+	args := make([]any, 0, len(a)*2)
+	for _, k := range a.Keys() {
+		args = append(args, k, a[k])
+	}
+	return args
+}
+
+// spanAttributes は、アノテーションを "http.request.annotation.<キー>" の名前のスパンの属性に変換する
+func (a Annotations) spanAttributes() []attribute.KeyValue {
+	if len(a) == 0 {
+		return nil
+	}
+	attrs := make([]attribute.KeyValue, 0, len(a))
+	for _, k := range a.Keys() {
+		attrs = append(attrs, attribute.String("http.request.annotation."+k, a[k]))
+	}
+	return attrs
+}
+
+// OverflowLabelValue は、CardinalityGuard の上限を超えた値の置き換え先
+const OverflowLabelValue = "__other__"
+
+// CardinalityGuard は、アノテーションをメトリクスのラベルとして使用する際に、キーごとの値の種類数を制限する
+// 上限を超えた新しい値は OverflowLabelValue に置き換えられる。metrics.WithAnnotationLabels で使用する
+type CardinalityGuard struct {
+	mu        sync.Mutex
+	maxValues int
+	allowed   map[string]bool
+	seen      map[string]map[string]struct{}
+}
+
+// NewCardinalityGuard は CardinalityGuard 構造体を作成する
+// keys を指定した場合は、そのキーのみをラベルとして使用する
+func NewCardinalityGuard(maxValuesPerKey int, keys ...string) *CardinalityGuard {
+	var allowed map[string]bool
+	if len(keys) > 0 {
+		allowed = make(map[string]bool, len(keys))
+		for _, k := range keys {
+			allowed[k] = true
+		}
+	}
+	return &CardinalityGuard{
+		maxValues: maxValuesPerKey,
+		allowed:   allowed,
+		seen:      make(map[string]map[string]struct{}),
+	}
+}
+
+// Labels はアノテーションをメトリクスのラベルに変換する
+func (g *CardinalityGuard) Labels(a Annotations) map[string]string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	labels := make(map[string]string, len(a))
+	for k, v := range a {
+		if g.allowed != nil && !g.allowed[k] {
+			continue
+		}
+		values, ok := g.seen[k]
+		if !ok {
+			values = make(map[string]struct{})
+			g.seen[k] = values
+		}
+		if _, ok := values[v]; !ok {
+			if len(values) >= g.maxValues {
+				labels[k] = OverflowLabelValue
+				continue
+			}
+			values[v] = struct{}{}
+		}
+		labels[k] = v
+	}
+	return labels
+}
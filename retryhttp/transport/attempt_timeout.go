@@ -0,0 +1,117 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+// WithAttemptTimeout は、1 回の試行のタイムアウトを設定する
+// タイムアウトした試行は送信エラーとしてリトライの判定が行われるため、1 回の遅い試行がリクエスト全体の時間を使い切らない
+// NOTE: タイムアウトはレスポンスボディの読み込みにも適用される
+func WithAttemptTimeout(timeout time.Duration) Option {
+	return func(t *RetryableTransport) {
+		t.attemptTimeout = timeout
+	}
+}
+
+// WithFirstByteTimeout は、1 回の試行でレスポンスの最初のバイトを受信するまでのタイムアウトを設定する
+// WithAttemptTimeout と異なりレスポンスボディの読み込みには適用されないため、ボディを少しずつ返却する遅いが成功しているレスポンスを中断せずに、
+// 応答のない試行だけを早くリトライできる
+// NOTE: http.Transport の ResponseHeaderTimeout と同様だが、WithTransport で任意の Transport を指定した場合にも適用される
+func WithFirstByteTimeout(timeout time.Duration) Option {
+	return func(t *RetryableTransport) {
+		t.firstByteTimeout = timeout
+	}
+}
+
+// errFirstByteTimeout は、最初のバイトを受信するまでのタイムアウトで試行をキャンセルした理由
+var errFirstByteTimeout = errors.New("timeout awaiting first response byte")
+
+// withAttemptTimeout は試行ごとのタイムアウトを設定したリクエストを返却する
+func (t *RetryableTransport) withAttemptTimeout(req *http.Request) (*http.Request, context.CancelFunc) {
+	if t.attemptTimeout <= 0 && t.firstByteTimeout <= 0 {
+		return req, func() {}
+	}
+	ctx, cancel := req.Context(), context.CancelFunc(func() {})
+	if t.attemptTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, t.attemptTimeout)
+	}
+	if t.firstByteTimeout > 0 {
+		var cancelCause context.CancelCauseFunc
+		ctx, cancelCause = context.WithCancelCause(ctx)
+		// NOTE: 最初のバイトを受信した時点でタイマーを停止し、レスポンスボディの読み込み中はキャンセルしない
+		timer := time.AfterFunc(t.firstByteTimeout, func() {
+			cancelCause(errFirstByteTimeout)
+		})
+		ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+			GotFirstResponseByte: func() {
+				timer.Stop()
+			},
+		})
+		parentCancel := cancel
+		cancel = func() {
+			timer.Stop()
+			cancelCause(context.Canceled)
+			parentCancel()
+		}
+	}
+	return req.WithContext(ctx), cancel
+}
+
+// cancelOnClose は、レスポンスボディのクローズ時に試行の context.Context をキャンセルするようにラップする
+// NOTE: RoundTrip から返却した後もレスポンスボディを読み込めるように、返却時点ではキャンセルしない
+func cancelOnClose(res *http.Response, cancel context.CancelFunc) *http.Response {
+	if res == nil || res.Body == nil {
+		cancel()
+		return res
+	}
+	res.Body = &cancelBody{ReadCloser: res.Body, cancel: cancel}
+	return res
+}
+
+// cancelBody は Close 時に context.CancelFunc を呼び出す io.ReadCloser の具象型
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// AttemptTimeoutError は、試行ごとのタイムアウト (WithAttemptTimeout, WithFirstByteTimeout) により試行が失敗したことを表すエラー
+// リクエスト全体の context.Context はまだ有効なため、リトライ可能なエラーとして扱う
+type AttemptTimeoutError struct {
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *AttemptTimeoutError) Error() string {
+	return fmt.Sprintf("attempt timed out after %s: %v", e.Timeout, e.Err)
+}
+
+func (e *AttemptTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// attemptError は、試行ごとのタイムアウトで失敗した送信エラーを *AttemptTimeoutError でラップする
+// NOTE: リクエスト全体のデッドラインによる失敗と区別するために、親の context.Context が有効な場合のみラップする
+func (t *RetryableTransport) attemptError(ctx context.Context, attemptReq *http.Request, err error) error {
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+	if t.firstByteTimeout > 0 && errors.Is(context.Cause(attemptReq.Context()), errFirstByteTimeout) {
+		return &AttemptTimeoutError{Timeout: t.firstByteTimeout, Err: err}
+	}
+	if t.attemptTimeout <= 0 || !errors.Is(attemptReq.Context().Err(), context.DeadlineExceeded) {
+		return err
+	}
+	return &AttemptTimeoutError{Timeout: t.attemptTimeout, Err: err}
+}
@@ -0,0 +1,165 @@
+package transport
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+// TraceEventType は、試行ごとのコネクションの確立からレスポンスの受信までのイベントの種類
+type TraceEventType int
+
+const (
+	// TraceDNSStart は名前解決の開始
+	TraceDNSStart TraceEventType = iota
+	// TraceDNSDone は名前解決の終了
+	TraceDNSDone
+	// TraceConnectStart は TCP の接続の開始
+	TraceConnectStart
+	// TraceConnectDone は TCP の接続の終了
+	TraceConnectDone
+	// TraceTLSHandshakeStart は TLS のハンドシェイクの開始
+	TraceTLSHandshakeStart
+	// TraceTLSHandshakeDone は TLS のハンドシェイクの終了
+	TraceTLSHandshakeDone
+	// TraceGotConn はリクエストを送信するコネクションの取得
+	TraceGotConn
+	// TraceWroteRequest はリクエストの書き込みの終了
+	TraceWroteRequest
+	// TraceGotFirstResponseByte はレスポンスの最初のバイトの受信
+	TraceGotFirstResponseByte
+)
+
+func (t TraceEventType) String() string {
+	switch t {
+	case TraceDNSStart:
+		return "dns_start"
+	case TraceDNSDone:
+		return "dns_done"
+	case TraceConnectStart:
+		return "connect_start"
+	case TraceConnectDone:
+		return "connect_done"
+	case TraceTLSHandshakeStart:
+		return "tls_handshake_start"
+	case TraceTLSHandshakeDone:
+		return "tls_handshake_done"
+	case TraceGotConn:
+		return "got_conn"
+	case TraceWroteRequest:
+		return "wrote_request"
+	case TraceGotFirstResponseByte:
+		return "got_first_response_byte"
+	default:
+		return "unknown"
+	}
+}
+
+// TraceEvent は、試行ごとのコネクションの確立からレスポンスの受信までのイベント
+type TraceEvent struct {
+	Type TraceEventType
+	// Attempt は最初の試行を 1 とする試行回数
+	Attempt int
+	// Host はリクエスト先のホスト
+	Host string
+	// Addr は接続先のアドレス。TraceConnectStart、TraceConnectDone、TraceGotConn 以外は空文字
+	Addr string
+	// Reused は TraceGotConn でアイドル状態のコネクションを再利用したか
+	Reused bool
+	// Elapsed は試行の送信開始からの経過時間
+	Elapsed time.Duration
+	// Err は名前解決、接続、TLS のハンドシェイク、リクエストの書き込みが失敗した場合のエラー
+	Err error
+}
+
+// TraceHook は試行のイベントごとに呼び出される関数の型定義
+// NOTE: 複数のアドレスに並行して接続する場合は、複数の goroutine から同時に呼び出されても安全である必要がある
+type TraceHook func(event TraceEvent)
+
+// WithOnTrace は、試行ごとに net/http/httptrace で名前解決、接続、TLS のハンドシェイク、最初のバイトの受信などのイベントを通知するフックを追加する
+// イベントは LogEventTrace のログにも試行回数とともに出力する
+// NOTE: リトライの原因が、送信先の処理の遅延か、コネクションの確立の失敗かを区別するために使用する
+func WithOnTrace(hook TraceHook) Option {
+	return func(t *RetryableTransport) {
+		t.onTrace = append(t.onTrace, hook)
+	}
+}
+
+// withAttemptTrace は、WithOnTrace のフックがあるか LogEventTrace のログが有効な場合に、試行のイベントを通知する httptrace.ClientTrace を設定する
+// NOTE: 既に設定されている httptrace.ClientTrace のフックも呼び出される
+func (t *RetryableTransport) withAttemptTrace(req *http.Request, attempt int, logArgs *requestLogArgs) *http.Request {
+	ctx := req.Context()
+	logEnabled := t.logEnabled(ctx, LogEventTrace)
+	if len(t.onTrace) == 0 && !logEnabled {
+		return req
+	}
+
+	if logEnabled {
+		// NOTE: イベントは複数の goroutine から通知される場合があるため、ログの引数を先に作成しておく
+		logArgs.with()
+	}
+
+	clock := t.clock()
+	start := clock.Now()
+	host := req.URL.Host
+	emit := func(event TraceEvent) {
+		event.Attempt, event.Host, event.Elapsed = attempt, host, clock.Now().Sub(start)
+		for _, hook := range t.onTrace {
+			hook(event)
+		}
+		if logEnabled {
+			t.log(ctx, LogEventTrace, "attempt trace", logArgs.with(traceEventArgs(event)...)...)
+		}
+	}
+
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			emit(TraceEvent{Type: TraceDNSStart})
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			emit(TraceEvent{Type: TraceDNSDone, Err: info.Err})
+		},
+		ConnectStart: func(network, addr string) {
+			emit(TraceEvent{Type: TraceConnectStart, Addr: addr})
+		},
+		ConnectDone: func(network, addr string, err error) {
+			emit(TraceEvent{Type: TraceConnectDone, Addr: addr, Err: err})
+		},
+		TLSHandshakeStart: func() {
+			emit(TraceEvent{Type: TraceTLSHandshakeStart})
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			emit(TraceEvent{Type: TraceTLSHandshakeDone, Err: err})
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			event := TraceEvent{Type: TraceGotConn, Reused: info.Reused}
+			if info.Conn != nil && info.Conn.RemoteAddr() != nil {
+				event.Addr = info.Conn.RemoteAddr().String()
+			}
+			emit(event)
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			emit(TraceEvent{Type: TraceWroteRequest, Err: info.Err})
+		},
+		GotFirstResponseByte: func() {
+			emit(TraceEvent{Type: TraceGotFirstResponseByte})
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(ctx, trace))
+}
+
+// traceEventArgs は試行のイベントをログの属性として返却する
+func traceEventArgs(event TraceEvent) []any {
+	args := []any{"attempt", event.Attempt, "event", event.Type.String(), "elapsed", event.Elapsed}
+	if event.Addr != "" {
+		args = append(args, "addr", event.Addr)
+	}
+	if event.Type == TraceGotConn {
+		args = append(args, "reused", event.Reused)
+	}
+	if event.Err != nil {
+		args = append(args, "error", event.Err)
+	}
+	return args
+}
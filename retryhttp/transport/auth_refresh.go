@@ -0,0 +1,51 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// AuthRefresher は、認証に失敗した場合に新しいトークンを取得する関数の型定義
+type AuthRefresher func(ctx context.Context) (token string, err error)
+
+// WithAuthRefresher は、401 Unauthorized または 403 Forbidden を受け取った場合に、refresh で新しいトークンを取得し、
+// Authorization ヘッダーを "Bearer <token>" に書き換えて 1 回だけ即座にリトライする
+// 以降の試行も新しいトークンで送信する。トークンの取得に失敗した場合は、リトライせずにそのエラーを返却する
+// NOTE: OAuth2 のアクセストークンの期限切れで失敗したリクエストを、別の Transport でラップせずにリトライするために使用する
+// リクエストごとにトークンを取得するため、取得したトークンのキャッシュは refresh で行う
+func WithAuthRefresher(refresh AuthRefresher) Option {
+	return func(t *RetryableTransport) {
+		t.authRefresher = refresh
+	}
+}
+
+// shouldRefreshAuth は、認証情報を更新してリトライすべきレスポンスか判定する
+// NOTE: サーバーは認証に失敗したリクエストを処理していないため、冪等でないリクエストでもリトライする
+func (t *RetryableTransport) shouldRefreshAuth(res *http.Response, err error, refreshed bool) bool {
+	if t.authRefresher == nil || refreshed || err != nil {
+		return false
+	}
+	return res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden
+}
+
+// refreshAuth は AuthRefresher で新しいトークンを取得する
+func (t *RetryableTransport) refreshAuth(ctx context.Context) (string, error) {
+	token, err := t.authRefresher(ctx)
+	if err != nil {
+		return "", fmt.Errorf("refresh credentials: %w", err)
+	}
+	return token, nil
+}
+
+// withAuthorization は、更新したトークンがある場合に、Authorization ヘッダーを書き換えたリクエストを返却する
+func withAuthorization(req *http.Request, token string) *http.Request {
+	if token == "" {
+		return req
+	}
+	// NOTE: http.RoundTripper はリクエストを変更してはいけないため、ヘッダーを複製してから書き換える
+	authorized := *req
+	authorized.Header = req.Header.Clone()
+	authorized.Header.Set("Authorization", "Bearer "+token)
+	return &authorized
+}
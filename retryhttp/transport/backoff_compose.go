@@ -0,0 +1,94 @@
+package transport
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// ResponseBackoffFunc は、直前の試行のレスポンスからバックオフを取得する関数の型定義
+// 送信エラーの場合、res は nil となる
+type ResponseBackoffFunc func(attempts int, res *http.Response) time.Duration
+
+// WithResponseBackoff は、BackoffFunc と Retry-After ヘッダーの代わりに使用する ResponseBackoffFunc を設定する
+// NOTE: HonorRetryAfter と組み合わせて、Retry-After ヘッダーを優先する条件や代替のバックオフを指定する
+// CheckRetryContextFunc が RetryAfter で待機時間を指定した場合は、その値を優先する
+func WithResponseBackoff(backoff ResponseBackoffFunc) Option {
+	return func(t *RetryableTransport) {
+		t.responseBackoff = backoff
+	}
+}
+
+// Constant は、常に wait を待機時間とする BackoffFunc を返却する
+func Constant(wait time.Duration) BackoffFunc {
+	return func(int) time.Duration {
+		return wait
+	}
+}
+
+// Max は、backoffs の待機時間のうち最大の値を待機時間とする BackoffFunc を返却する
+// NOTE: 例えば Max(backoff, Constant(time.Second)) は、待機時間の下限を 1 秒とする
+func Max(backoffs ...BackoffFunc) BackoffFunc {
+	return func(attempts int) time.Duration {
+		var wait time.Duration
+		for i, backoff := range backoffs {
+			if w := backoff(attempts); i == 0 || w > wait {
+				wait = w
+			}
+		}
+		return wait
+	}
+}
+
+// Min は、backoffs の待機時間のうち最小の値を待機時間とする BackoffFunc を返却する
+// NOTE: 例えば Min(backoff, Constant(20*time.Second)) は、待機時間の上限を 20 秒とする
+func Min(backoffs ...BackoffFunc) BackoffFunc {
+	return func(attempts int) time.Duration {
+		var wait time.Duration
+		for i, backoff := range backoffs {
+			if w := backoff(attempts); i == 0 || w < wait {
+				wait = w
+			}
+		}
+		return wait
+	}
+}
+
+// Add は、backoffs の待機時間の合計を待機時間とする BackoffFunc を返却する
+func Add(backoffs ...BackoffFunc) BackoffFunc {
+	return func(attempts int) time.Duration {
+		var wait time.Duration
+		for _, backoff := range backoffs {
+			wait += backoff(attempts)
+		}
+		return wait
+	}
+}
+
+// WithJitter は、backoff の待機時間を上下に fraction の割合でゆらがせた BackoffFunc を返却する
+// fraction は 0 から 1 の範囲に丸める。例えば 0.2 の場合は、待機時間の 0.8 倍から 1.2 倍までの一様乱数を待機時間とする
+// NOTE: ゆらぎのない Constant や JitterNone のバックオフに適用して、同時に失敗したクライアントのリトライを分散する
+func WithJitter(backoff BackoffFunc, fraction float64) BackoffFunc {
+	fraction = min(max(fraction, 0), 1)
+	return func(attempts int) time.Duration {
+		wait := backoff(attempts)
+		spread := time.Duration(float64(wait) * fraction)
+		if spread <= 0 {
+			return wait
+		}
+		return wait - spread + time.Duration(rand.Int63n(int64(spread)*2))
+	}
+}
+
+// HonorRetryAfter は、レスポンスに Retry-After ヘッダーがある場合はその値を、ない場合は fallback の待機時間を返却する ResponseBackoffFunc を返却する
+// NOTE: RetryableTransport は 429 と 503 のレスポンスの Retry-After ヘッダーのみを使用するが、HonorRetryAfter はステータスコードに関わらず使用する
+// 例えば HonorRetryAfter(Min(backoff, Constant(20*time.Second))) は、Retry-After ヘッダーがない場合に上限 20 秒の backoff で待機する
+// WithMaxRetryAfter の上限は適用しない
+func HonorRetryAfter(fallback BackoffFunc) ResponseBackoffFunc {
+	return func(attempts int, res *http.Response) time.Duration {
+		if wait, ok := ParseRetryAfter(res, time.Now()); ok {
+			return wait
+		}
+		return fallback(attempts)
+	}
+}
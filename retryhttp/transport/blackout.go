@@ -0,0 +1,114 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// BlackoutMode はブラックアウト期間中のリクエストの扱い
+type BlackoutMode int
+
+const (
+	// BlackoutFailFast はブラックアウト期間中のリクエストを送信せずに *BlackoutError を返却する
+	BlackoutFailFast BlackoutMode = iota
+	// BlackoutQueue はブラックアウト期間が終了するまで待機してからリクエストを送信する
+	BlackoutQueue
+)
+
+// BlackoutWindow は、アップストリームの定期メンテナンスなど、毎日決まった時間帯にリクエストを送信しない期間
+type BlackoutWindow struct {
+	// Host は対象のホスト。空文字の場合はすべてのホストが対象となる
+	Host string
+	// Start は期間の開始時刻 (0 時からの経過時間)
+	Start time.Duration
+	// Duration は期間の長さ
+	Duration time.Duration
+	// Location は Start を解釈するタイムゾーン。nil の場合は UTC
+	Location *time.Location
+	// Mode は期間中のリクエストの扱い
+	Mode BlackoutMode
+}
+
+// DailyBlackout は "02:00" のような時刻表記から BlackoutWindow を作成する
+func DailyBlackout(host string, start string, duration time.Duration, mode BlackoutMode) (BlackoutWindow, error) {
+	t, err := time.Parse("15:04", start)
+	if err != nil {
+		return BlackoutWindow{}, fmt.Errorf("invalid blackout start %q: %w", start, err)
+	}
+	return BlackoutWindow{
+		Host:     host,
+		Start:    time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute,
+		Duration: duration,
+		Mode:     mode,
+	}, nil
+}
+
+// BlackoutError は、ブラックアウト期間中のためリクエストを送信しなかったことを表すエラー
+type BlackoutError struct {
+	Host  string
+	Until time.Time
+}
+
+func (e *BlackoutError) Error() string {
+	return fmt.Sprintf("%s is in a blackout window until %s", e.Host, e.Until.Format(time.RFC3339))
+}
+
+// WithBlackoutWindows は、ブラックアウト期間を設定する
+// 期間中のリクエストはリトライせずに、BlackoutWindow.Mode に従って即座に失敗するか期間の終了まで待機する
+func WithBlackoutWindows(windows ...BlackoutWindow) Option {
+	return func(t *RetryableTransport) {
+		t.blackouts = append(t.blackouts, windows...)
+	}
+}
+
+// matches はリクエスト先のホストが対象か判定する
+func (w BlackoutWindow) matches(req *http.Request) bool {
+	return w.Host == "" || w.Host == req.URL.Host || w.Host == req.URL.Hostname()
+}
+
+// activeUntil は now が期間中であれば、期間の終了時刻を返却する
+func (w BlackoutWindow) activeUntil(now time.Time) (time.Time, bool) {
+	loc := w.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	year, month, day := now.In(loc).Date()
+	hour, minute, sec := int(w.Start/time.Hour), int(w.Start%time.Hour/time.Minute), int(w.Start%time.Minute/time.Second)
+
+	// 日付をまたぐ期間を考慮して、前日に開始した期間も確認する
+	for _, d := range []int{day - 1, day} {
+		// NOTE: 夏時間の切り替え日は 1 日が 24 時間ではないため、0 時に Start を加算せずに、その日の時刻として開始時刻を作成する
+		start := time.Date(year, month, d, hour, minute, sec, 0, loc)
+		end := start.Add(w.Duration)
+		if !now.Before(start) && now.Before(end) {
+			return end, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// waitBlackout はリクエスト先がブラックアウト期間中であれば、設定に従ってエラーを返却するか期間の終了まで待機する
+func (t *RetryableTransport) waitBlackout(ctx context.Context, req *http.Request) error {
+	for _, w := range t.blackouts {
+		if !w.matches(req) {
+			continue
+		}
+		now := t.clock().Now()
+		until, ok := w.activeUntil(now)
+		if !ok {
+			continue
+		}
+		if w.Mode == BlackoutFailFast {
+			return &BlackoutError{Host: req.URL.Host, Until: until}
+		}
+
+		if err := t.sleep(ctx, until.Sub(now)); err != nil {
+			return err
+		}
+		// 期間の終了まで待機していたリクエストは、一度にではなく段階的に解放する
+		t.resumeRamp(req.URL.Host, until)
+	}
+	return nil
+}
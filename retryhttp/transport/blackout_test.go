@@ -0,0 +1,98 @@
+package transport
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBlackoutWindowActiveUntil(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("load location: %v", err)
+	}
+	at := func(loc *time.Location, year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name      string
+		window    BlackoutWindow
+		now       time.Time
+		wantUntil time.Time
+		wantOK    bool
+	}{
+		{
+			name:      "in window",
+			window:    BlackoutWindow{Start: 2 * time.Hour, Duration: time.Hour},
+			now:       at(time.UTC, 2024, 1, 15, 2, 30),
+			wantUntil: at(time.UTC, 2024, 1, 15, 3, 0),
+			wantOK:    true,
+		},
+		{
+			name:   "after window",
+			window: BlackoutWindow{Start: 2 * time.Hour, Duration: time.Hour},
+			now:    at(time.UTC, 2024, 1, 15, 3, 0),
+		},
+		{
+			name:      "window started the previous day",
+			window:    BlackoutWindow{Start: 23 * time.Hour, Duration: 2 * time.Hour},
+			now:       at(time.UTC, 2024, 1, 16, 0, 30),
+			wantUntil: at(time.UTC, 2024, 1, 16, 1, 0),
+			wantOK:    true,
+		},
+		{
+			name:      "location",
+			window:    BlackoutWindow{Start: 6 * time.Hour, Duration: time.Hour, Location: newYork},
+			now:       at(newYork, 2024, 1, 15, 6, 30),
+			wantUntil: at(newYork, 2024, 1, 15, 7, 0),
+			wantOK:    true,
+		},
+		// 夏時間の開始日 (2:00 が 3:00 になる) は 1 日が 23 時間
+		{
+			name:      "spring forward",
+			window:    BlackoutWindow{Start: 6 * time.Hour, Duration: time.Hour, Location: newYork},
+			now:       at(newYork, 2024, 3, 10, 6, 30),
+			wantUntil: at(newYork, 2024, 3, 10, 7, 0),
+			wantOK:    true,
+		},
+		{
+			name:   "spring forward before window",
+			window: BlackoutWindow{Start: 6 * time.Hour, Duration: time.Hour, Location: newYork},
+			now:    at(newYork, 2024, 3, 10, 5, 30),
+		},
+		// 夏時間の終了日 (2:00 が 1:00 になる) は 1 日が 25 時間
+		{
+			name:      "fall back",
+			window:    BlackoutWindow{Start: 6 * time.Hour, Duration: time.Hour, Location: newYork},
+			now:       at(newYork, 2024, 11, 3, 6, 30),
+			wantUntil: at(newYork, 2024, 11, 3, 7, 0),
+			wantOK:    true,
+		},
+		{
+			name:   "fall back after window",
+			window: BlackoutWindow{Start: 6 * time.Hour, Duration: time.Hour, Location: newYork},
+			now:    at(newYork, 2024, 11, 3, 7, 30),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			until, ok := tt.window.activeUntil(tt.now)
+			if ok != tt.wantOK || !until.Equal(tt.wantUntil) {
+				t.Errorf("activeUntil(%s) = %s, %v, want %s, %v", tt.now, until, ok, tt.wantUntil, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestDailyBlackout(t *testing.T) {
+	w, err := DailyBlackout("api.example.com", "02:30", time.Hour, BlackoutQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Start != 2*time.Hour+30*time.Minute || w.Duration != time.Hour || w.Mode != BlackoutQueue {
+		t.Errorf("DailyBlackout = %+v", w)
+	}
+	if _, err := DailyBlackout("", "25:00", time.Hour, BlackoutFailFast); err == nil {
+		t.Error("DailyBlackout with an invalid start succeeded")
+	}
+}
@@ -0,0 +1,170 @@
+package transport
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultMaxBodyBuffer は、リトライのためにリクエストボディをバッファリングする上限のデフォルト値
+const defaultMaxBodyBuffer = 10 << 20
+
+// WithMaxBodyBuffer は、GetBody のないリクエストボディをリトライのためにバッファリングする上限のバイト数を設定する
+// 上限を超えるリクエストボディはバッファリングせずに送信し、リトライが必要な場合は *RequestBodyTooLargeError を返却する
+// NOTE: 上限のないストリームをすべてメモリに読み込まないように設定する。デフォルトは 10 MiB
+func WithMaxBodyBuffer(limit int64) Option {
+	return func(t *RetryableTransport) {
+		t.maxBodyBuffer = limit
+	}
+}
+
+// bodyBufferLimit はリクエストボディをバッファリングする上限を返却する
+func (t *RetryableTransport) bodyBufferLimit() int64 {
+	if t.maxBodyBuffer <= 0 {
+		return defaultMaxBodyBuffer
+	}
+	return t.maxBodyBuffer
+}
+
+// maxPooledBodyBuffer は、bodyBufferPool に戻すバッファの最大の容量
+// NOTE: まれに送信する大きなボディのバッファをプールに保持し続けないように、これより大きいバッファは破棄する
+const maxPooledBodyBuffer = 1 << 20
+
+// bodyBufferPool は、GetBody のないリクエストボディをバッファリングする *bytes.Buffer のプール
+var bodyBufferPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+// pooledBody は、bodyBufferPool から取得したバッファにバッファリングしたリクエストボディ
+// RoundTrip と、newReader で返却したすべての読み込み中のボディがクローズされた後に、バッファをプールに戻す
+// NOTE: 親の Transport は、RoundTrip がレスポンスを返却した後もリクエストボディを読み込む場合があるため、参照の数を数える
+type pooledBody struct {
+	buf  *bytes.Buffer
+	refs atomic.Int64
+}
+
+// newPooledBody は、r から limit バイトまでをプールのバッファに読み込む。limit を超える場合は false を返却する
+// limit を超えた場合も、読み込んだ先頭のバイト列を返却する
+func newPooledBody(r io.Reader, limit int64) (*pooledBody, []byte, bool, error) {
+	buf := bodyBufferPool.Get().(*bytes.Buffer)
+	// NOTE: 上限を超えたか判定するため、1 バイト多く読み込む
+	if _, err := buf.ReadFrom(io.LimitReader(r, limit+1)); err != nil {
+		putBodyBuffer(buf)
+		return nil, nil, false, err
+	}
+	if int64(buf.Len()) > limit {
+		// NOTE: 残りのボディと合わせて送信するため、バッファはプールに戻さない
+		return nil, buf.Bytes(), false, nil
+	}
+	body := &pooledBody{buf: buf}
+	body.refs.Store(1)
+	return body, nil, true, nil
+}
+
+// newReader は、バッファリングしたボディを先頭から読み込む io.ReadCloser を返却する
+// RoundTrip の終了後にバッファをプールに戻している場合は false を返却する
+func (b *pooledBody) newReader() (*pooledBodyReader, bool) {
+	for {
+		refs := b.refs.Load()
+		if refs <= 0 {
+			return nil, false
+		}
+		if b.refs.CompareAndSwap(refs, refs+1) {
+			break
+		}
+	}
+	r := &pooledBodyReader{body: b}
+	r.reader.Reset(b.buf.Bytes())
+	return r, true
+}
+
+// getBody は http.Request の GetBody として使用する関数
+func (b *pooledBody) getBody() (io.ReadCloser, error) {
+	r, ok := b.newReader()
+	if !ok {
+		return nil, http.ErrBodyReadAfterClose
+	}
+	return r, nil
+}
+
+// release は参照を 1 つ解放し、参照がなくなった場合はバッファをプールに戻す
+func (b *pooledBody) release() {
+	if b.refs.Add(-1) == 0 {
+		putBodyBuffer(b.buf)
+	}
+}
+
+// putBodyBuffer は、バッファを空にしてプールに戻す
+func putBodyBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBodyBuffer {
+		return
+	}
+	buf.Reset()
+	bodyBufferPool.Put(buf)
+}
+
+// pooledBodyReader は pooledBody を読み込む io.ReadCloser 具象型
+// NOTE: bytes.Reader を値で保持して Reset で初期化するため、試行ごとの割り当ては 1 回になる
+// クローズした後に読み込むと、プールに戻したバッファを参照しないように http.ErrBodyReadAfterClose を返却する
+type pooledBodyReader struct {
+	body   *pooledBody
+	mu     sync.Mutex
+	reader bytes.Reader
+	closed bool
+}
+
+func (r *pooledBodyReader) Read(data []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return 0, http.ErrBodyReadAfterClose
+	}
+	return r.reader.Read(data)
+}
+
+func (r *pooledBodyReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	r.body.release()
+	return nil
+}
+
+// RequestBodyTooLargeError は、リクエストボディがバッファリングの上限を超えていて巻き戻せないため、リトライしなかったことを表すエラー
+// リクエストボディを巻き戻せるようにするには、リクエストに GetBody を設定するか、WithMaxBodyBuffer で上限を変更する
+type RequestBodyTooLargeError struct {
+	Limit int64
+	// StatusCode はリトライが必要と判定した試行のステータスコード。送信エラーの場合は 0
+	StatusCode int
+	// Err はリトライが必要と判定した試行の送信エラー
+	Err error
+}
+
+func (e *RequestBodyTooLargeError) Error() string {
+	cause := fmt.Sprintf("status %d", e.StatusCode)
+	if e.Err != nil {
+		cause = e.Err.Error()
+	}
+	return fmt.Sprintf("request body exceeds the %d byte buffer limit and cannot be retried: %s", e.Limit, cause)
+}
+
+func (e *RequestBodyTooLargeError) Unwrap() error {
+	return e.Err
+}
+
+// bodyTooLarge は、リトライが必要と判定した試行の結果から RequestBodyTooLargeError を作成する
+func (t *RetryableTransport) bodyTooLarge(res *http.Response, err error) *RequestBodyTooLargeError {
+	e := &RequestBodyTooLargeError{Limit: t.bodyBufferLimit(), Err: err}
+	if res != nil {
+		e.StatusCode = res.StatusCode
+	}
+	return e
+}
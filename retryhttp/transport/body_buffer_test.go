@@ -0,0 +1,107 @@
+package transport
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPooledBody(t *testing.T) {
+	body, _, ok, err := newPooledBody(strings.NewReader("payload"), 16)
+	if err != nil || !ok {
+		t.Fatalf("newPooledBody = %v, %v", ok, err)
+	}
+
+	// 試行ごとに先頭から読み込める
+	for i := 0; i < 2; i++ {
+		r, err := body.getBody()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(r)
+		if string(data) != "payload" {
+			t.Errorf("attempt %d body = %q, want payload", i+1, data)
+		}
+		r.Close()
+	}
+
+	// 読み込み中のボディがある間は、RoundTrip が終了してもバッファをプールに戻さない
+	r, _ := body.getBody()
+	body.release()
+	if data, _ := io.ReadAll(r); string(data) != "payload" {
+		t.Errorf("body read after release = %q, want payload", data)
+	}
+	r.Close()
+	if _, err := body.getBody(); !errors.Is(err, http.ErrBodyReadAfterClose) {
+		t.Errorf("getBody after all readers are closed = %v, want ErrBodyReadAfterClose", err)
+	}
+	if _, err := r.Read(make([]byte, 1)); !errors.Is(err, http.ErrBodyReadAfterClose) {
+		t.Errorf("Read after Close = %v, want ErrBodyReadAfterClose", err)
+	}
+}
+
+func TestPooledBodyOverLimit(t *testing.T) {
+	_, head, ok, err := newPooledBody(strings.NewReader("0123456789"), 4)
+	if err != nil || ok {
+		t.Fatalf("newPooledBody = %v, %v, want over the limit", ok, err)
+	}
+	if string(head) != "01234" {
+		t.Errorf("head = %q, want 01234", head)
+	}
+}
+
+// bodyBufferSizes と bodyBufferAttempts は、ボディのバッファリングのベンチマークでバッファリングするボディのサイズと試行回数
+var (
+	bodyBufferSizes    = []int{1 << 10, 64 << 10, 512 << 10}
+	bodyBufferAttempts = 3
+)
+
+// BenchmarkBodyBufferPooled は、プールのバッファに 1 回だけ読み込み、試行ごとに先頭から読み込む場合の割り当てを計測する
+func BenchmarkBodyBufferPooled(b *testing.B) {
+	for _, size := range bodyBufferSizes {
+		payload := bytes.Repeat([]byte("x"), size)
+		b.Run(fmt.Sprintf("%dKiB", size>>10), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				body, _, _, err := newPooledBody(bytes.NewReader(payload), defaultMaxBodyBuffer)
+				if err != nil {
+					b.Fatal(err)
+				}
+				for attempt := 0; attempt < bodyBufferAttempts; attempt++ {
+					r, _ := body.getBody()
+					_, _ = io.Copy(io.Discard, r)
+					r.Close()
+				}
+				body.release()
+			}
+		})
+	}
+}
+
+// BenchmarkBodyBufferUnpooled は、プールを使用せずにボディを読み込み、試行ごとに bytes.Reader を作成する場合の割り当てを計測する
+// NOTE: BenchmarkBodyBufferPooled と比較するための、プールを導入する前の実装
+func BenchmarkBodyBufferUnpooled(b *testing.B) {
+	for _, size := range bodyBufferSizes {
+		payload := bytes.Repeat([]byte("x"), size)
+		b.Run(fmt.Sprintf("%dKiB", size>>10), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				data, err := io.ReadAll(io.LimitReader(bytes.NewReader(payload), defaultMaxBodyBuffer+1))
+				if err != nil {
+					b.Fatal(err)
+				}
+				for attempt := 0; attempt < bodyBufferAttempts; attempt++ {
+					r := io.NopCloser(bytes.NewReader(data))
+					_, _ = io.Copy(io.Discard, r)
+					r.Close()
+				}
+			}
+		})
+	}
+}
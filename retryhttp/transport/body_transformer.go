@@ -0,0 +1,54 @@
+package transport
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// BodyTransformer は、試行ごとにリクエストボディを変換する関数の型定義
+// body は常に呼び出し元が指定した元のリクエストボディで、前の試行で変換したボディではない
+// NOTE: JSON に埋め込まれたタイムスタンプやノンスを、試行ごとに更新する場合に使用する
+type BodyTransformer func(attempt int, req *http.Request, body []byte) ([]byte, error)
+
+// WithBodyTransformer は、試行ごとにリクエストボディを変換する BodyTransformer を設定する
+// 変換するにはリクエストボディをメモリに読み込むため、WithMaxBodyBuffer の上限を超えるボディは *RequestBodyTooLargeError を返却する
+func WithBodyTransformer(transform BodyTransformer) Option {
+	return func(t *RetryableTransport) {
+		t.bodyTransformer = transform
+	}
+}
+
+// transformBody は、BodyTransformer が設定されている場合に、変換したリクエストボディで置き換えたリクエストを返却する
+// NOTE: 元のリクエストボディは巻き戻しの仕組みで試行ごとに取得し直すため、変換したボディは次の試行に影響しない
+func (t *RetryableTransport) transformBody(req *http.Request, attempt int) (*http.Request, error) {
+	if t.bodyTransformer == nil || req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	if !canRewind(req) {
+		return nil, &RequestBodyTooLargeError{Limit: t.bodyBufferLimit()}
+	}
+
+	original, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	transformed, err := t.bodyTransformer(attempt, req, original)
+	if err != nil {
+		return nil, err
+	}
+
+	newReq := *req
+	newReq.Body = io.NopCloser(bytes.NewReader(transformed))
+	newReq.ContentLength = int64(len(transformed))
+	newReq.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(transformed)), nil
+	}
+	// NOTE: ボディの長さが変わるため、Content-Length ヘッダーを明示している場合は更新する
+	if newReq.Header.Get("Content-Length") != "" {
+		newReq.Header = req.Header.Clone()
+		newReq.Header.Set("Content-Length", strconv.Itoa(len(transformed)))
+	}
+	return &newReq, nil
+}
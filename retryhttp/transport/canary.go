@@ -0,0 +1,110 @@
+package transport
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// WithCanaryPolicy は、percent パーセントのリクエストに、RetryableTransport の設定の代わりに policy を適用する
+// 例: WithCanaryPolicy(RetryPolicy{MaxAttempts: 6, Backoff: newBackoff}, 5)
+// policy と RetryableTransport の設定それぞれのリクエスト数、成功率、リトライ数、レイテンシーを CanaryStats で比較できる
+// NOTE: 新しいリトライの設定に切り替える前に、本番環境のトラフィックの一部で検証するために使用する
+// WithHostPolicy と WithRetryPolicy で指定したリトライポリシーは、policy より優先する
+func WithCanaryPolicy(policy RetryPolicy, percent float64) Option {
+	return func(t *RetryableTransport) {
+		t.canary = &canaryRollout{policy: policy, percent: min(max(percent, 0), 100)}
+	}
+}
+
+// canaryRollout は、WithCanaryPolicy で設定したリトライポリシーと、比較のための集計
+type canaryRollout struct {
+	policy  RetryPolicy
+	percent float64
+	// arms は、RetryableTransport の設定 (0) と policy (1) を適用したリクエストの集計
+	arms [2]canaryArm
+}
+
+// canaryArm は、一方のリトライポリシーを適用したリクエストの集計
+type canaryArm struct {
+	requests  atomic.Int64
+	succeeded atomic.Int64
+	retries   atomic.Int64
+	// latency はバックオフを含むリクエスト全体の所要時間の合計 (ナノ秒)
+	latency atomic.Int64
+}
+
+// CanaryArmStats は、一方のリトライポリシーを適用したリクエストの集計
+type CanaryArmStats struct {
+	Requests  int64 `json:"requests"`
+	Succeeded int64 `json:"succeeded"`
+	// Retries はリトライの数の合計
+	Retries int64 `json:"retries"`
+	// SuccessRate はリトライ不要な結果で終了したリクエストの割合。リクエストがない場合は 0
+	SuccessRate float64 `json:"success_rate"`
+	// RetriesPerRequest はリクエストあたりのリトライの数。リクエストがない場合は 0
+	RetriesPerRequest float64 `json:"retries_per_request"`
+	// MeanLatency はバックオフを含むリクエスト全体の所要時間の平均
+	MeanLatency time.Duration `json:"mean_latency"`
+}
+
+// CanaryStats は、WithCanaryPolicy の RetryableTransport の設定 (Control) と policy (Canary) の比較
+type CanaryStats struct {
+	// Percent は policy を適用するリクエストの割合 (パーセント)
+	Percent float64        `json:"percent"`
+	Control CanaryArmStats `json:"control"`
+	Canary  CanaryArmStats `json:"canary"`
+}
+
+// CanaryStats は、WithCanaryPolicy の RetryableTransport の設定と policy を適用したリクエストの集計を返却する
+// WithCanaryPolicy が設定されていない場合は false を返却する
+func (t *RetryableTransport) CanaryStats() (CanaryStats, bool) {
+	if t.canary == nil {
+		return CanaryStats{}, false
+	}
+	return CanaryStats{
+		Percent: t.canary.percent,
+		Control: t.canary.arms[0].stats(),
+		Canary:  t.canary.arms[1].stats(),
+	}, true
+}
+
+// stats は集計を CanaryArmStats に変換する
+func (a *canaryArm) stats() CanaryArmStats {
+	stats := CanaryArmStats{
+		Requests:  a.requests.Load(),
+		Succeeded: a.succeeded.Load(),
+		Retries:   a.retries.Load(),
+	}
+	if stats.Requests > 0 {
+		stats.SuccessRate = float64(stats.Succeeded) / float64(stats.Requests)
+		stats.RetriesPerRequest = float64(stats.Retries) / float64(stats.Requests)
+		stats.MeanLatency = time.Duration(a.latency.Load() / stats.Requests)
+	}
+	return stats
+}
+
+// selectCanary は、リクエストに WithCanaryPolicy の policy を適用するか判定する
+func (t *RetryableTransport) selectCanary() bool {
+	if t.canary == nil || t.canary.percent <= 0 {
+		return false
+	}
+	return rand.Float64()*100 < t.canary.percent
+}
+
+// recordCanary は、WithCanaryPolicy が設定されている場合に、適用したリトライポリシーごとにリクエストの結果を集計する
+func (t *RetryableTransport) recordCanary(canary bool, attempts int, succeeded bool, duration time.Duration) {
+	if t.canary == nil {
+		return
+	}
+	arm := &t.canary.arms[0]
+	if canary {
+		arm = &t.canary.arms[1]
+	}
+	arm.requests.Add(1)
+	if succeeded {
+		arm.succeeded.Add(1)
+	}
+	arm.retries.Add(int64(max(attempts-1, 0)))
+	arm.latency.Add(int64(duration))
+}
@@ -0,0 +1,58 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// CheckRetryContextFunc は、試行回数やリクエストの内容も含めて、リトライを行うか判定する関数の型定義
+// attempt は判定する試行の回数で、最初の試行は 1
+// error を返却した場合はリトライを中止し、レスポンスの代わりにそのエラーを返却する。RetryAfterError の場合は指定した待機時間でリトライする
+// ctx からは AttemptWritePhase で、失敗した時点でリクエストの書き込みが完了していたかを取得できる
+// NOTE: 「429 は 1 回だけリトライする」など試行回数に応じた判定や、メソッドやパスによって判定を切り替える場合に使用する
+type CheckRetryContextFunc func(ctx context.Context, attempt int, req *http.Request, res *http.Response, err error) (bool, error)
+
+// AdaptCheckRetry は、CheckRetryFunc を CheckRetryContextFunc に変換する
+func AdaptCheckRetry(checkRetry CheckRetryFunc) CheckRetryContextFunc {
+	return func(_ context.Context, _ int, _ *http.Request, res *http.Response, err error) (bool, error) {
+		return checkRetry(res, err), nil
+	}
+}
+
+// WithCheckRetryContext は、NewRetryableTransport に指定した CheckRetryFunc の代わりに、リトライを行うか判定する関数を設定する
+func WithCheckRetryContext(checkRetry CheckRetryContextFunc) Option {
+	return func(t *RetryableTransport) {
+		t.checkRetryContext = checkRetry
+	}
+}
+
+// RetryAfterError は、CheckRetryContextFunc がリトライまでの待機時間を指定するためのエラー
+// CheckRetryContextFunc がこのエラーを返却した場合はリトライを中止せず、BackoffFunc や Retry-After ヘッダーの代わりに Wait だけ待機してリトライする
+// NOTE: X-RateLimit-Reset など独自のヘッダーでレート制限の解除時刻が返却される場合に、その時刻までちょうど待機するために使用する
+type RetryAfterError struct {
+	Wait time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("retry after %s", e.Wait)
+}
+
+// RetryAfter は、wait だけ待機してリトライすることを表すエラーを返却する
+func RetryAfter(wait time.Duration) error {
+	return &RetryAfterError{Wait: wait}
+}
+
+// retryAfterOverride は、CheckRetryContextFunc が返却したエラーが待機時間の指定の場合に、その待機時間を返却する
+func retryAfterOverride(err error) (time.Duration, bool) {
+	var retryAfterErr *RetryAfterError
+	if !errors.As(err, &retryAfterErr) {
+		return 0, false
+	}
+	if retryAfterErr.Wait < 0 {
+		return 0, true
+	}
+	return retryAfterErr.Wait, true
+}
@@ -0,0 +1,84 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+)
+
+// All は、checks のすべてがリトライすると判定した場合にリトライする CheckRetryContextFunc を返却する
+// checks は順に判定し、リトライしないと判定した時点で残りは判定しない。エラーを返却した場合はそのエラーを返却する
+// NOTE: 例えば All(OnlyMethods("GET"), AdaptCheckRetry(checkRetry)) は、GET のみを checkRetry で判定してリトライする
+func All(checks ...CheckRetryContextFunc) CheckRetryContextFunc {
+	return func(ctx context.Context, attempt int, req *http.Request, res *http.Response, err error) (bool, error) {
+		for _, check := range checks {
+			retry, checkErr := check(ctx, attempt, req, res, err)
+			if checkErr != nil {
+				return false, checkErr
+			}
+			if !retry {
+				return false, nil
+			}
+		}
+		return len(checks) > 0, nil
+	}
+}
+
+// Any は、checks のいずれかがリトライすると判定した場合にリトライする CheckRetryContextFunc を返却する
+// checks は順に判定し、リトライすると判定した時点で残りは判定しない。エラーを返却した場合はそのエラーを返却する
+func Any(checks ...CheckRetryContextFunc) CheckRetryContextFunc {
+	return func(ctx context.Context, attempt int, req *http.Request, res *http.Response, err error) (bool, error) {
+		for _, check := range checks {
+			retry, checkErr := check(ctx, attempt, req, res, err)
+			if checkErr != nil {
+				return false, checkErr
+			}
+			if retry {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+// Not は、check の判定を反転した CheckRetryContextFunc を返却する。check がエラーを返却した場合はそのエラーを返却する
+func Not(check CheckRetryContextFunc) CheckRetryContextFunc {
+	return func(ctx context.Context, attempt int, req *http.Request, res *http.Response, err error) (bool, error) {
+		retry, checkErr := check(ctx, attempt, req, res, err)
+		if checkErr != nil {
+			return false, checkErr
+		}
+		return !retry, nil
+	}
+}
+
+// MaxAttempts は、最初の試行を含めて n 回目の試行まではリトライする CheckRetryContextFunc を返却する
+// NOTE: All と組み合わせて、「429 は 1 回だけリトライする」などの条件ごとの試行回数の上限に使用する
+// RetryableTransport の試行回数の上限を超えてリトライすることはない
+func MaxAttempts(n int) CheckRetryContextFunc {
+	return func(_ context.Context, attempt int, _ *http.Request, _ *http.Response, _ error) (bool, error) {
+		return attempt < n, nil
+	}
+}
+
+// OnlyMethods は、リクエストのメソッドが methods のいずれかの場合にリトライする CheckRetryContextFunc を返却する
+func OnlyMethods(methods ...string) CheckRetryContextFunc {
+	allowed := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		allowed[m] = true
+	}
+	return func(_ context.Context, _ int, req *http.Request, _ *http.Response, _ error) (bool, error) {
+		return allowed[req.Method], nil
+	}
+}
+
+// OnlyHosts は、リクエスト先のホストが hosts のいずれかの場合にリトライする CheckRetryContextFunc を返却する
+// hosts は "api.example.com" または "api.example.com:8443" の形式
+func OnlyHosts(hosts ...string) CheckRetryContextFunc {
+	allowed := make(map[string]bool, len(hosts))
+	for _, h := range hosts {
+		allowed[h] = true
+	}
+	return func(_ context.Context, _ int, req *http.Request, _ *http.Response, _ error) (bool, error) {
+		return allowed[req.URL.Host] || allowed[req.URL.Hostname()], nil
+	}
+}
@@ -0,0 +1,281 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mtnori/httpRetryExample/retryhttp/internal/shard"
+)
+
+// CircuitState はサーキットブレーカーの状態
+type CircuitState int
+
+const (
+	// CircuitClosed はリクエストを送信し、失敗率を集計している状態
+	CircuitClosed CircuitState = iota
+	// CircuitOpen は失敗率が閾値を超えたため、クールダウン期間が終了するまでリクエストを送信しない状態
+	CircuitOpen
+	// CircuitHalfOpen はクールダウン期間の終了後に、試験的に一部のリクエストだけを送信している状態
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+// ErrCircuitOpen は、サーキットブレーカーが開いているためリクエストを送信しなかったことを表すエラー
+// NOTE: 返却されるエラーは *CircuitOpenError のため、errors.Is で判定する
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitOpenError は、サーキットブレーカーが開いているためリクエストを送信しなかったことを表すエラー
+type CircuitOpenError struct {
+	Host string
+	// Until はクールダウン期間の終了時刻。半開状態で試験的なリクエストの上限に達している場合は現在時刻
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker for %s is open until %s", e.Host, e.Until.Format(time.RFC3339))
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+// CircuitBreakerConfig はサーキットブレーカーの設定。ゼロ値の項目はデフォルト値を使用する
+type CircuitBreakerConfig struct {
+	// FailureRate は回路を開く失敗率の閾値。デフォルトは 0.5
+	FailureRate float64
+	// MinRequests は失敗率を判定するために必要な、集計期間内の最小の試行回数。デフォルトは 10
+	MinRequests int
+	// Window は失敗率を集計する期間。デフォルトは 1 分
+	Window time.Duration
+	// Cooldown は回路を開いてから半開状態にするまでの期間。デフォルトは 30 秒
+	Cooldown time.Duration
+	// HalfOpenRequests は半開状態で同時に送信する試験的なリクエストの数。デフォルトは 1
+	HalfOpenRequests int
+	// IsFailure は試行の結果を失敗とみなすか判定する関数。デフォルトは送信エラーまたは 5xx を失敗とする
+	IsFailure func(*http.Response, error) bool
+	// OnStateChange は状態が変化した時に呼び出される関数
+	OnStateChange func(host string, from CircuitState, to CircuitState)
+	// Shards はホストごとの状態を分散して保持するロックの数。デフォルトは GOMAXPROCS の 4 倍
+	// NOTE: 1 を指定すると、1 つのロックですべてのホストの状態を保護する
+	Shards int
+}
+
+// CircuitBreaker はホストごとの失敗率を集計し、失敗が続くホストへのリクエストを即座に失敗させる
+// NOTE: 障害中のバックエンドにリトライでさらに負荷をかけないように、RetryableTransport は試行の前に確認する
+type CircuitBreaker struct {
+	config CircuitBreakerConfig
+	// hosts はホストごとの状態。多数のホストへの並行したリクエストでロックが競合しないように、シャードに分散して保持する
+	hosts *shard.Map[*circuit]
+	now   func() time.Time
+}
+
+// circuit はホストごとのサーキットブレーカーの状態
+type circuit struct {
+	state       CircuitState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	// closedAt は半開状態から閉じた時刻
+	closedAt time.Time
+	probes   int
+}
+
+// NewCircuitBreaker は CircuitBreaker 構造体を作成する
+func NewCircuitBreaker(config CircuitBreakerConfig) *CircuitBreaker {
+	if config.FailureRate <= 0 {
+		config.FailureRate = 0.5
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = 10
+	}
+	if config.Window <= 0 {
+		config.Window = time.Minute
+	}
+	if config.Cooldown <= 0 {
+		config.Cooldown = 30 * time.Second
+	}
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = 1
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = isCircuitFailure
+	}
+	return &CircuitBreaker{
+		config: config,
+		hosts:  shard.New[*circuit](config.Shards),
+		now:    time.Now,
+	}
+}
+
+// WithCircuitBreaker は、サーキットブレーカーを設定する
+// 回路が開いているホストへのリクエストは、リトライせずに *CircuitOpenError を返却する
+// NOTE: 同じ CircuitBreaker を複数の RetryableTransport で共有すると、ホストごとの状態も共有される
+func WithCircuitBreaker(cb *CircuitBreaker) Option {
+	return func(t *RetryableTransport) {
+		t.breaker = cb
+	}
+}
+
+// State はホストの現在の状態を返却する
+func (cb *CircuitBreaker) State(host string) CircuitState {
+	hosts := cb.hosts.Lock(host)
+	defer hosts.Unlock()
+
+	c, ok := hosts.Entries[host]
+	if !ok {
+		return CircuitClosed
+	}
+	// クールダウン期間が終了していれば、次のリクエストで半開状態になる
+	if c.state == CircuitOpen && !cb.now().Before(c.openedAt.Add(cb.config.Cooldown)) {
+		return CircuitHalfOpen
+	}
+	return c.state
+}
+
+// closedAt は、ホストの回路が半開状態から閉じた時刻を返却する。閉じたことがない場合は false を返却する
+func (cb *CircuitBreaker) closedAt(host string) (time.Time, bool) {
+	hosts := cb.hosts.Lock(host)
+	defer hosts.Unlock()
+
+	c, ok := hosts.Entries[host]
+	if !ok || c.state != CircuitClosed || c.closedAt.IsZero() {
+		return time.Time{}, false
+	}
+	return c.closedAt, true
+}
+
+// openUntil は、ホストの回路が開いている場合に、半開状態になる時刻を返却する
+func (cb *CircuitBreaker) openUntil(host string) (time.Time, bool) {
+	hosts := cb.hosts.Lock(host)
+	defer hosts.Unlock()
+
+	c, ok := hosts.Entries[host]
+	if !ok || c.state != CircuitOpen {
+		return time.Time{}, false
+	}
+	until := c.openedAt.Add(cb.config.Cooldown)
+	if !cb.now().Before(until) {
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// allow は試行を送信してよいか判定する。送信してよい場合は、試行の結果を通知する関数を返却する
+func (cb *CircuitBreaker) allow(host string) (func(*http.Response, error), error) {
+	hosts := cb.hosts.Lock(host)
+	defer hosts.Unlock()
+
+	now := cb.now()
+	c, ok := hosts.Entries[host]
+	if !ok {
+		c = &circuit{windowStart: now}
+		hosts.Entries[host] = c
+	}
+
+	switch c.state {
+	case CircuitClosed:
+		if now.Sub(c.windowStart) >= cb.config.Window {
+			c.windowStart, c.requests, c.failures = now, 0, 0
+		}
+	case CircuitOpen:
+		until := c.openedAt.Add(cb.config.Cooldown)
+		if now.Before(until) {
+			return nil, &CircuitOpenError{Host: host, Until: until}
+		}
+		cb.transition(host, c, CircuitHalfOpen)
+		c.probes = 0
+		fallthrough
+	case CircuitHalfOpen:
+		if c.probes >= cb.config.HalfOpenRequests {
+			return nil, &CircuitOpenError{Host: host, Until: now}
+		}
+		c.probes++
+	}
+
+	state := c.state
+	return func(res *http.Response, err error) {
+		cb.report(host, state, res, err)
+	}, nil
+}
+
+// report は試行の結果を集計し、必要に応じて状態を変化させる
+func (cb *CircuitBreaker) report(host string, state CircuitState, res *http.Response, err error) {
+	// 呼び出し元によるキャンセルはバックエンドの障害ではないため、失敗として集計しない
+	canceled := errors.Is(err, context.Canceled)
+	failed := !canceled && cb.config.IsFailure(res, err)
+
+	hosts := cb.hosts.Lock(host)
+	defer hosts.Unlock()
+
+	c := hosts.Entries[host]
+	// 試行中に状態が変化した場合は、古い状態での結果のため集計しない
+	if c.state != state {
+		return
+	}
+
+	switch c.state {
+	case CircuitClosed:
+		if canceled {
+			return
+		}
+		c.requests++
+		if failed {
+			c.failures++
+		}
+		if c.requests >= cb.config.MinRequests && float64(c.failures)/float64(c.requests) >= cb.config.FailureRate {
+			c.openedAt = cb.now()
+			cb.transition(host, c, CircuitOpen)
+		}
+	case CircuitHalfOpen:
+		c.probes--
+		if canceled {
+			return
+		}
+		if failed {
+			c.openedAt = cb.now()
+			cb.transition(host, c, CircuitOpen)
+			return
+		}
+		c.windowStart, c.requests, c.failures = cb.now(), 0, 0
+		c.closedAt = c.windowStart
+		cb.transition(host, c, CircuitClosed)
+	}
+}
+
+// transition は状態を変化させ、OnStateChange を呼び出す
+func (cb *CircuitBreaker) transition(host string, c *circuit, to CircuitState) {
+	from := c.state
+	c.state = to
+	if cb.config.OnStateChange != nil {
+		cb.config.OnStateChange(host, from, to)
+	}
+}
+
+// isCircuitFailure は送信エラーまたは 5xx を失敗とみなす
+func isCircuitFailure(res *http.Response, err error) bool {
+	return err != nil || res.StatusCode >= http.StatusInternalServerError
+}
+
+// allowCircuit は、サーキットブレーカーが設定されている場合に試行を送信してよいか判定する
+func (t *RetryableTransport) allowCircuit(req *http.Request) (func(*http.Response, error), error) {
+	if t.breaker == nil {
+		return func(*http.Response, error) {}, nil
+	}
+	return t.breaker.allow(req.URL.Host)
+}
@@ -0,0 +1,60 @@
+package transport
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+// benchmarkHosts は、ホストごとの状態の更新を計測するベンチマークで並行して送信するホスト
+var benchmarkHosts = func() []string {
+	hosts := make([]string, 1000)
+	for i := range hosts {
+		hosts[i] = fmt.Sprintf("host-%d.example.com", i)
+	}
+	return hosts
+}()
+
+// shardCounts は、1 つのロックで保護した場合 (1) とデフォルトのシャード数 (0) を比較するシャード数
+var shardCounts = []int{1, 0}
+
+// shardsName はシャード数のサブベンチマークの名前を返却する
+func shardsName(shards int) string {
+	if shards == 0 {
+		return "shards=default"
+	}
+	return fmt.Sprintf("shards=%d", shards)
+}
+
+// BenchmarkRoundTripCircuitBreaker は、サーキットブレーカーを設定した RetryableTransport で、並行して異なるホストに送信する時間を計測する
+// 例: go test ./retryhttp/transport -run '^$' -bench RoundTripCircuitBreaker -cpu 1,16
+func BenchmarkRoundTripCircuitBreaker(b *testing.B) {
+	requests := make([]*http.Request, len(benchmarkHosts))
+	for i, host := range benchmarkHosts {
+		requests[i], _ = http.NewRequest(http.MethodGet, "http://"+host+"/", nil)
+	}
+
+	for _, shards := range shardCounts {
+		b.Run(shardsName(shards), func(b *testing.B) {
+			breaker := NewCircuitBreaker(CircuitBreakerConfig{Shards: shards})
+			// NOTE: 計測対象はリトライではなく、ホストごとの状態の更新のため、リトライしない
+			rt := NewRetryableTransport(okTransport, 0, func(*http.Response, error) bool { return false }, Constant(0),
+				WithCircuitBreaker(breaker), WithoutLogging())
+
+			var next atomic.Uint64
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					res, err := rt.RoundTrip(requests[next.Add(1)%uint64(len(requests))])
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					_ = res.Body.Close()
+				}
+			})
+		})
+	}
+}
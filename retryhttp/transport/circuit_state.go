@@ -0,0 +1,76 @@
+package transport
+
+import (
+	"time"
+)
+
+// CircuitSnapshot は、ホストごとのサーキットブレーカーの状態をファイルなどに保存するための状態
+type CircuitSnapshot struct {
+	State       CircuitState `json:"state"`
+	WindowStart time.Time    `json:"window_start"`
+	Requests    int          `json:"requests"`
+	Failures    int          `json:"failures"`
+	OpenedAt    time.Time    `json:"opened_at,omitempty"`
+	ClosedAt    time.Time    `json:"closed_at,omitempty"`
+}
+
+// Export は、ホストごとのサーキットブレーカーの状態を返却する
+// NOTE: プロセスの再起動で障害中のホストの状態が失われないように、終了時に保存して起動時に Restore で復元するために使用する
+func (cb *CircuitBreaker) Export() map[string]CircuitSnapshot {
+	snapshots := make(map[string]CircuitSnapshot)
+	cb.hosts.Range(func(hosts map[string]*circuit) {
+		for host, c := range hosts {
+			snapshots[host] = CircuitSnapshot{
+				State:       c.state,
+				WindowStart: c.windowStart,
+				Requests:    c.requests,
+				Failures:    c.failures,
+				OpenedAt:    c.openedAt,
+				ClosedAt:    c.closedAt,
+			}
+		}
+	})
+	return snapshots
+}
+
+// Restore は、Export で保存した状態を復元する。既に試行を集計しているホストの状態は上書きしない
+// NOTE: 半開状態は試験的なリクエストの結果を引き継げないため、開いた状態として復元し、クールダウン期間の終了後に改めて半開状態にする
+// 集計期間を過ぎた閉じた状態は、失敗率を引き継がずに破棄する
+func (cb *CircuitBreaker) Restore(snapshots map[string]CircuitSnapshot) {
+	now := cb.now()
+	for host, s := range snapshots {
+		cb.restore(host, s, now)
+	}
+}
+
+// restore は、ホストの状態をまだ集計していない場合に、保存した状態を復元する
+func (cb *CircuitBreaker) restore(host string, s CircuitSnapshot, now time.Time) {
+	hosts := cb.hosts.Lock(host)
+	defer hosts.Unlock()
+
+	if _, ok := hosts.Entries[host]; ok {
+		return
+	}
+	c := &circuit{
+		state:       s.State,
+		windowStart: s.WindowStart,
+		requests:    s.Requests,
+		failures:    s.Failures,
+		openedAt:    s.OpenedAt,
+		closedAt:    s.ClosedAt,
+	}
+	switch s.State {
+	case CircuitHalfOpen:
+		c.state = CircuitOpen
+	case CircuitClosed:
+		if now.Sub(s.WindowStart) >= cb.config.Window {
+			return
+		}
+	}
+	hosts.Entries[host] = c
+}
+
+// CircuitBreaker は、WithCircuitBreaker で設定したサーキットブレーカーを返却する。設定されていない場合は nil
+func (t *RetryableTransport) CircuitBreaker() *CircuitBreaker {
+	return t.breaker
+}
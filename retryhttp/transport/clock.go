@@ -0,0 +1,62 @@
+package transport
+
+import (
+	"context"
+	"time"
+)
+
+// Clock は現在時刻の取得と待機を行うインターフェース
+// NOTE: テストで実際に待機せずにバックオフの待機時間を検証できるように、偽の Clock に差し替える
+type Clock interface {
+	Now() time.Time
+	// After は d が経過した後に現在時刻を送信するチャネルを返却する
+	After(d time.Duration) <-chan time.Time
+}
+
+// Sleeper は、待機を中断できる Clock が実装するインターフェース
+// Clock が Sleeper を実装している場合、RetryableTransport はバックオフの待機に After の代わりに Sleep を使用する
+// NOTE: 偽の Clock で、待機を記録して即座に返却したり、ctx のキャンセルを再現したりするために使用する
+type Sleeper interface {
+	// Sleep は d が経過するか ctx が終了するまで待機する。ctx が終了した場合は ctx.Err() を返却する
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// realClock は time パッケージを使用する Clock
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// WithClock は、RetryableTransport が使用する Clock を設定する
+func WithClock(clock Clock) Option {
+	return func(t *RetryableTransport) {
+		t.clk = clock
+	}
+}
+
+// sleep は、バックオフの待機時間だけ待機する。ctx が終了した場合は ctx.Err() を返却する
+func (t *RetryableTransport) sleep(ctx context.Context, d time.Duration) error {
+	clock := t.clock()
+	if sleeper, ok := clock.(Sleeper); ok {
+		return sleeper.Sleep(ctx, d)
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-clock.After(d):
+		return nil
+	}
+}
+
+// clock は設定された Clock を返却する。設定されていない場合は time パッケージを使用する
+func (t *RetryableTransport) clock() Clock {
+	if t.clk == nil {
+		return realClock{}
+	}
+	return t.clk
+}
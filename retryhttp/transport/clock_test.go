@@ -0,0 +1,219 @@
+package transport_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mtnori/httpRetryExample/retryhttp/retrytest"
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// testStart は FakeClock の開始時刻
+var testStart = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// retryStatus は 429 と 5xx をリトライする CheckRetryFunc
+func retryStatus(res *http.Response, err error) bool {
+	return err != nil || res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= http.StatusInternalServerError
+}
+
+// linearBackoff は試行回数 × 1 秒を待機する BackoffFunc
+func linearBackoff(attempts int) time.Duration {
+	return time.Duration(attempts) * time.Second
+}
+
+// retryAfter は Retry-After ヘッダーを付与した Step を作成する
+func retryAfter(code int, value string) retrytest.Step {
+	return retrytest.Step{StatusCode: code, Header: http.Header{"Retry-After": {value}}}
+}
+
+func TestRoundTripFakeClock(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxRetries int
+		backoff    retryabletransport.BackoffFunc
+		opts       []retryabletransport.Option
+		steps      []retrytest.Step
+		wantStatus int
+		wantSleeps []time.Duration
+		// wantElapsed は試行とバックオフを含む所要時間。0 の場合は待機時間の合計
+		wantElapsed time.Duration
+	}{
+		{
+			name:       "backoff between attempts",
+			maxRetries: 3,
+			backoff:    linearBackoff,
+			steps:      []retrytest.Step{retrytest.Status(503), retrytest.Status(500), retrytest.Status(200)},
+			wantStatus: 200,
+			wantSleeps: []time.Duration{1 * time.Second, 2 * time.Second},
+		},
+		{
+			name:       "attempts exhausted",
+			maxRetries: 2,
+			backoff:    linearBackoff,
+			steps:      []retrytest.Step{retrytest.Status(503), retrytest.Status(503), retrytest.Status(503)},
+			wantStatus: 503,
+			wantSleeps: []time.Duration{1 * time.Second, 2 * time.Second},
+		},
+		{
+			name:       "non-retryable status",
+			maxRetries: 3,
+			backoff:    linearBackoff,
+			steps:      []retrytest.Step{retrytest.Status(404)},
+			wantStatus: 404,
+		},
+		{
+			name:       "Retry-After seconds overrides backoff",
+			maxRetries: 3,
+			backoff:    linearBackoff,
+			steps:      []retrytest.Step{retryAfter(429, "7"), retrytest.Status(200)},
+			wantStatus: 200,
+			wantSleeps: []time.Duration{7 * time.Second},
+		},
+		{
+			name:       "Retry-After HTTP-date is relative to the clock",
+			maxRetries: 3,
+			backoff:    linearBackoff,
+			steps:      []retrytest.Step{retryAfter(503, testStart.Add(30*time.Second).Format(http.TimeFormat)), retrytest.Status(200)},
+			wantStatus: 200,
+			wantSleeps: []time.Duration{30 * time.Second},
+		},
+		{
+			name:       "Retry-After is ignored for other statuses",
+			maxRetries: 3,
+			backoff:    linearBackoff,
+			steps:      []retrytest.Step{retryAfter(500, "7"), retrytest.Status(200)},
+			wantStatus: 200,
+			wantSleeps: []time.Duration{1 * time.Second},
+		},
+		{
+			name:       "Retry-After is capped by WithMaxRetryAfter",
+			maxRetries: 3,
+			backoff:    linearBackoff,
+			opts:       []retryabletransport.Option{retryabletransport.WithMaxRetryAfter(5 * time.Second)},
+			steps:      []retrytest.Step{retryAfter(429, "120"), retryAfter(429, "3"), retrytest.Status(200)},
+			wantStatus: 200,
+			wantSleeps: []time.Duration{5 * time.Second, 3 * time.Second},
+		},
+		{
+			name:       "WithoutRetryAfter uses backoff",
+			maxRetries: 3,
+			backoff:    linearBackoff,
+			opts:       []retryabletransport.Option{retryabletransport.WithoutRetryAfter()},
+			steps:      []retrytest.Step{retryAfter(429, "120"), retrytest.Status(200)},
+			wantStatus: 200,
+			wantSleeps: []time.Duration{1 * time.Second},
+		},
+		{
+			name:       "max elapsed time stops before the backoff that would exceed it",
+			maxRetries: 10,
+			backoff:    func(int) time.Duration { return 4 * time.Second },
+			opts:       []retryabletransport.Option{retryabletransport.WithMaxElapsedTime(10 * time.Second)},
+			steps: []retrytest.Step{
+				{StatusCode: 503, Latency: time.Second},
+				{StatusCode: 503, Latency: time.Second},
+				{StatusCode: 503, Latency: time.Second},
+			},
+			wantStatus: 503,
+			// 1 回目: 0s-1s、待機 4s。2 回目: 5s-6s、待機 4s。3 回目: 10s-11s、待機すると 15s で上限を超える
+			wantSleeps:  []time.Duration{4 * time.Second, 4 * time.Second},
+			wantElapsed: 11 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := retrytest.NewFakeClock(testStart)
+			server := retrytest.NewScriptedTransport(t, clock, tt.steps...)
+			opts := append([]retryabletransport.Option{
+				retryabletransport.WithClock(clock),
+				retryabletransport.WithoutLogging(),
+			}, tt.opts...)
+			transport := retryabletransport.NewRetryableTransport(server, tt.maxRetries, retryStatus, tt.backoff, opts...)
+
+			req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+			res, err := transport.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("RoundTrip: %v", err)
+			}
+			res.Body.Close()
+
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", res.StatusCode, tt.wantStatus)
+			}
+			server.AssertDone()
+			if got := len(server.Attempts()); got != len(tt.steps) {
+				t.Errorf("attempts = %d, want %d", got, len(tt.steps))
+			}
+			if got := clock.Sleeps(); fmt.Sprint(got) != fmt.Sprint(tt.wantSleeps) {
+				t.Errorf("sleeps = %v, want %v", got, tt.wantSleeps)
+			}
+
+			wantElapsed := tt.wantElapsed
+			if wantElapsed == 0 {
+				for _, sleep := range tt.wantSleeps {
+					wantElapsed += sleep
+				}
+			}
+			if got := clock.Now().Sub(testStart); got != wantElapsed {
+				t.Errorf("elapsed = %v, want %v", got, wantElapsed)
+			}
+		})
+	}
+}
+
+// TestRoundTripFakeClockAttemptTimes は、各試行がバックオフの待機の後の時刻に送信されることを検証する
+func TestRoundTripFakeClockAttemptTimes(t *testing.T) {
+	clock := retrytest.NewFakeClock(testStart)
+	server := retrytest.NewScriptedTransport(t, clock,
+		retrytest.Step{StatusCode: 503, Latency: 100 * time.Millisecond},
+		retrytest.Step{StatusCode: 503, Latency: 100 * time.Millisecond},
+		retrytest.Status(200),
+	)
+	transport := retryabletransport.NewRetryableTransport(server, 3, retryStatus, linearBackoff,
+		retryabletransport.WithClock(clock), retryabletransport.WithoutLogging())
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	want := []time.Duration{0, 1100 * time.Millisecond, 3200 * time.Millisecond}
+	attempts := server.Attempts()
+	if len(attempts) != len(want) {
+		t.Fatalf("attempts = %d, want %d", len(attempts), len(want))
+	}
+	for i, attempt := range attempts {
+		if got := attempt.At.Sub(testStart); got != want[i] {
+			t.Errorf("attempt %d sent at +%v, want +%v", i+1, got, want[i])
+		}
+	}
+}
+
+// TestRoundTripFakeClockCanceled は、キャンセルされた context.Context ではバックオフの待機をせずに終了することを検証する
+func TestRoundTripFakeClockCanceled(t *testing.T) {
+	clock := retrytest.NewFakeClock(testStart)
+	ctx, cancel := context.WithCancel(context.Background())
+	server := retrytest.NewScriptedTransport(t, clock, retrytest.Status(503))
+	transport := retryabletransport.NewRetryableTransport(server, 3, func(res *http.Response, err error) bool {
+		// 1 回目の試行の後にキャンセルする
+		cancel()
+		return true
+	}, linearBackoff, retryabletransport.WithClock(clock), retryabletransport.WithoutLogging())
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com/", nil)
+	res, err := transport.RoundTrip(req)
+	if err == nil {
+		res.Body.Close()
+		t.Fatal("RoundTrip succeeded, want context.Canceled")
+	}
+	if len(server.Attempts()) != 1 {
+		t.Errorf("attempts = %d, want 1", len(server.Attempts()))
+	}
+	if sleeps := clock.Sleeps(); len(sleeps) != 0 {
+		t.Errorf("sleeps = %v, want none", sleeps)
+	}
+}
@@ -0,0 +1,96 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrConcurrencyQueueFull は、同時に送信できる試行数の上限に達し、待機しているリクエストも上限に達したことを表すエラー
+var ErrConcurrencyQueueFull = errors.New("concurrent request queue is full")
+
+// WithMaxConcurrentRequests は、リトライを含めて同時に送信する試行の数を n 以下に制限する。n が 0 以下の場合は制限しない
+// 上限に達している場合は、いずれかの試行が終了するか context.Context が終了するまで待機する
+// NOTE: 障害時にリトライが重なり、クライアントのコネクションや送信先のサーバーが過負荷になるのを防ぐために使用する
+// 試行はレスポンスボディのクローズ、またはリトライのバックオフの開始時点で終了したとみなす
+func WithMaxConcurrentRequests(n int) Option {
+	return func(t *RetryableTransport) {
+		if n <= 0 {
+			t.concurrency = nil
+			return
+		}
+		t.concurrency = &concurrencyLimiter{slots: make(chan struct{}, n)}
+	}
+}
+
+// WithMaxQueuedRequests は、WithMaxConcurrentRequests の上限に達した場合に待機できるリクエストの数を制限する
+// 待機しているリクエストが depth に達している場合は、待機せずに ErrConcurrencyQueueFull を返却する。depth が 0 以下の場合は制限しない
+func WithMaxQueuedRequests(depth int) Option {
+	return func(t *RetryableTransport) {
+		t.maxQueuedRequests = depth
+	}
+}
+
+// concurrencyLimiter は、同時に送信する試行の数を制限するセマフォ
+type concurrencyLimiter struct {
+	slots   chan struct{}
+	waiting atomic.Int64
+}
+
+// acquireSlot は、WithMaxConcurrentRequests が指定されている場合に、試行を送信できるまで待機する
+// 返却する関数は試行の終了時に呼び出す。複数回呼び出しても 1 回だけ解放する
+// NOTE: Shutdown を呼び出した場合も、待機を中断して ErrShutdown を返却する
+func (t *RetryableTransport) acquireSlot(ctx context.Context) (func(), error) {
+	limiter := t.concurrency
+	if limiter == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case limiter.slots <- struct{}{}:
+		return limiter.releaseOnce(), nil
+	default:
+	}
+
+	if waiting := limiter.waiting.Add(1); t.maxQueuedRequests > 0 && waiting > int64(t.maxQueuedRequests) {
+		limiter.waiting.Add(-1)
+		return nil, ErrConcurrencyQueueFull
+	}
+	defer limiter.waiting.Add(-1)
+
+	select {
+	case limiter.slots <- struct{}{}:
+		return limiter.releaseOnce(), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-t.shutdown.done().Done():
+		return nil, ErrShutdown
+	}
+}
+
+// releaseOnce は、獲得した枠を 1 回だけ解放する関数を返却する
+func (l *concurrencyLimiter) releaseOnce() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-l.slots
+		})
+	}
+}
+
+// InFlightRequests は、WithMaxConcurrentRequests の枠を使用している送信中の試行の数と、枠が空くのを待機しているリクエストの数を返却する
+func (t *RetryableTransport) InFlightRequests() (active int, queued int) {
+	if t.concurrency == nil {
+		return 0, 0
+	}
+	return len(t.concurrency.slots), int(t.concurrency.waiting.Load())
+}
+
+// withRelease は、試行の context.CancelFunc を呼び出した時に、WithMaxConcurrentRequests の枠も解放するようにラップする
+func withRelease(cancel context.CancelFunc, release func()) context.CancelFunc {
+	return func() {
+		cancel()
+		release()
+	}
+}
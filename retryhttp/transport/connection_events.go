@@ -0,0 +1,190 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// ConnectionEventType はコネクションのイベントの種類
+type ConnectionEventType int
+
+const (
+	// ConnectionOpened は新しいコネクションを確立して、最初のリクエストに使用したイベント
+	ConnectionOpened ConnectionEventType = iota
+	// ConnectionReused はアイドル状態のコネクションをリクエストに再利用したイベント
+	ConnectionReused
+	// ConnectionClosed はコネクションをクローズしたイベント
+	ConnectionClosed
+)
+
+func (t ConnectionEventType) String() string {
+	switch t {
+	case ConnectionOpened:
+		return "opened"
+	case ConnectionReused:
+		return "reused"
+	case ConnectionClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// ConnectionEvent はコネクションのイベント
+type ConnectionEvent struct {
+	Type ConnectionEventType
+	// Host はリクエスト先のホスト
+	Host string
+	// Addr は接続先のアドレス
+	Addr string
+	// TLSVersion は TLS のバージョン (tls.VersionTLS13 など)。TLS を使用していない場合は 0
+	TLSVersion uint16
+	// ALPN は ALPN でネゴシエーションしたプロトコル ("h2" など)。ネゴシエーションしていない場合は空文字
+	ALPN string
+	// Reused はアイドル状態のコネクションを再利用したか
+	Reused bool
+	// IdleTime は再利用したコネクションがアイドル状態だった時間
+	IdleTime time.Duration
+}
+
+// ConnectionHook はコネクションのイベントごとに呼び出される関数の型定義
+// NOTE: コネクションのクローズはリクエストと関係なく呼び出されるため、複数の goroutine から同時に呼び出されても安全である必要がある
+type ConnectionHook func(event ConnectionEvent)
+
+// ConnectionEventsTransport は、コネクションの確立、再利用、クローズのイベントを通知するための http.RoundTripper 具象型
+// NOTE: リトライの増加とコネクションの入れ替わりを関連付けて可視化するために使用する。RetryableTransport の内側 (親の Transport) に配置する
+type ConnectionEventsTransport struct {
+	wrapped *http.Transport
+	hook    ConnectionHook
+}
+
+// NewConnectionEventsTransport は ConnectionEventsTransport 構造体を作成する。transport が nil の場合は http.DefaultTransport を複製して使用する
+// コネクションのクローズを検出するため、transport の設定を複製し、ダイヤルする関数をラップして使用する
+func NewConnectionEventsTransport(transport *http.Transport, hook ConnectionHook) *ConnectionEventsTransport {
+	if transport == nil {
+		transport = http.DefaultTransport.(*http.Transport)
+	}
+	wrapped := transport.Clone()
+
+	dial := wrapped.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	wrapped.DialContext = trackDial(dial, hook)
+	if wrapped.DialTLSContext != nil {
+		wrapped.DialTLSContext = trackDial(wrapped.DialTLSContext, hook)
+	}
+
+	return &ConnectionEventsTransport{
+		wrapped: wrapped,
+		hook:    hook,
+	}
+}
+
+// RoundTrip は、コネクションを取得した時にイベントを通知してリクエストを送信する
+func (t *ConnectionEventsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	ctx := httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.gotConn(host, info)
+		},
+	})
+	return t.wrapped.RoundTrip(req.WithContext(ctx))
+}
+
+// CloseIdleConnections はアイドル状態のコネクションをクローズする
+func (t *ConnectionEventsTransport) CloseIdleConnections() {
+	t.wrapped.CloseIdleConnections()
+}
+
+// gotConn は、取得したコネクションの TLS の状態を記録して、確立または再利用のイベントを通知する
+func (t *ConnectionEventsTransport) gotConn(host string, info httptrace.GotConnInfo) {
+	event := ConnectionEvent{
+		Type:     ConnectionOpened,
+		Host:     host,
+		Reused:   info.Reused,
+		IdleTime: info.IdleTime,
+	}
+	if info.Reused {
+		event.Type = ConnectionReused
+	}
+
+	// NOTE: Transport が TLS のハンドシェイクを行う場合は、*tls.Conn がダイヤルしたコネクションをラップしている
+	conn := info.Conn
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		event.TLSVersion, event.ALPN = state.Version, state.NegotiatedProtocol
+		conn = tlsConn.NetConn()
+	}
+	if tracked, ok := conn.(*trackedConn); ok {
+		if tlsConn, ok := tracked.Conn.(*tls.Conn); ok {
+			state := tlsConn.ConnectionState()
+			event.TLSVersion, event.ALPN = state.Version, state.NegotiatedProtocol
+		}
+		tracked.setState(host, event.TLSVersion, event.ALPN)
+		event.Addr = tracked.addr
+	} else if conn != nil && conn.RemoteAddr() != nil {
+		event.Addr = conn.RemoteAddr().String()
+	}
+
+	t.hook(event)
+}
+
+// trackDial は、ダイヤルしたコネクションのクローズを通知するようにラップする関数を返却する
+func trackDial(dial func(ctx context.Context, network, addr string) (net.Conn, error),
+	hook ConnectionHook) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &trackedConn{Conn: conn, addr: addr, hook: hook}, nil
+	}
+}
+
+// trackedConn は、クローズ時にイベントを通知する net.Conn 具象型
+type trackedConn struct {
+	net.Conn
+	addr string
+	hook ConnectionHook
+	once sync.Once
+
+	mu         sync.Mutex
+	host       string
+	tlsVersion uint16
+	alpn       string
+}
+
+// setState は、クローズのイベントに含めるホストと TLS の状態を記録する
+func (c *trackedConn) setState(host string, tlsVersion uint16, alpn string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.host, c.tlsVersion, c.alpn = host, tlsVersion, alpn
+}
+
+func (c *trackedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() {
+		c.mu.Lock()
+		event := ConnectionEvent{
+			Type:       ConnectionClosed,
+			Host:       c.host,
+			Addr:       c.addr,
+			TLSVersion: c.tlsVersion,
+			ALPN:       c.alpn,
+		}
+		c.mu.Unlock()
+		// NOTE: リクエストに使用される前にクローズされた場合は、ホストの代わりに接続先のアドレスを使用する
+		if event.Host == "" {
+			event.Host = c.addr
+		}
+		c.hook(event)
+	})
+	return err
+}
@@ -0,0 +1,62 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrWouldExceedDeadline は、バックオフの待機時間が context.Context のデッドラインまでの残り時間を超えるため、リトライしなかったことを表すエラー
+// NOTE: 返却されるエラーは *DeadlineError のため、errors.Is で判定する
+var ErrWouldExceedDeadline = errors.New("backoff would exceed context deadline")
+
+// DeadlineError は、バックオフの待機時間がデッドラインまでの残り時間を超えるため、リトライせずに終了したことを表すエラー
+// errors.Is で ErrWouldExceedDeadline と context.DeadlineExceeded のどちらとも判定できる
+type DeadlineError struct {
+	// Wait はリトライまでの待機時間
+	Wait time.Duration
+	// Remaining はデッドラインまでの残り時間
+	Remaining time.Duration
+	// Attempts は終了までの試行回数
+	Attempts int
+	// StatusCode は最後の試行のステータスコード。送信エラーの場合は 0
+	StatusCode int
+	// Err は最後の試行の送信エラー
+	Err error
+}
+
+func (e *DeadlineError) Error() string {
+	last := fmt.Sprintf("status %d", e.StatusCode)
+	if e.Err != nil {
+		last = e.Err.Error()
+	}
+	return fmt.Sprintf("giving up after %d attempts (%s): backoff %s exceeds remaining %s before deadline", e.Attempts, last, e.Wait, e.Remaining)
+}
+
+func (e *DeadlineError) Unwrap() []error {
+	errs := []error{ErrWouldExceedDeadline, context.DeadlineExceeded}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	return errs
+}
+
+// exceedsDeadline は、バックオフの待機時間の後に context.Context のデッドラインを過ぎる場合にエラーを返却する
+// NOTE: 待機した後にデッドラインで失敗するだけのリトライを行わないように、待機する前に判定する
+func (t *RetryableTransport) exceedsDeadline(ctx context.Context, wait time.Duration, attempts int, res *http.Response, err error) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil
+	}
+	remaining := deadline.Sub(t.clock().Now())
+	if wait < remaining {
+		return nil
+	}
+	deadlineErr := &DeadlineError{Wait: wait, Remaining: max(remaining, 0), Attempts: attempts, Err: err}
+	if res != nil {
+		deadlineErr.StatusCode = res.StatusCode
+	}
+	return deadlineErr
+}
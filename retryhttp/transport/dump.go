@@ -0,0 +1,156 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// redactedValue は、マスクしたヘッダーの値
+const redactedValue = "[REDACTED]"
+
+// defaultDumpBodyBytes は、DumpConfig.MaxBodyBytes を指定しなかった場合に出力するボディの最大のバイト数
+const defaultDumpBodyBytes = 1024
+
+// defaultRedactedHeaders は、常にマスクするヘッダー
+var defaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// DumpConfig は、WithAttemptDump で出力する内容の設定
+type DumpConfig struct {
+	// MaxBodyBytes は出力するリクエストボディとレスポンスボディの最大のバイト数。0 の場合は 1024 バイト、負の値の場合はボディを出力しない
+	MaxBodyBytes int
+	// RedactHeaders は値をマスクするヘッダーの名前。Authorization、Proxy-Authorization、Cookie、Set-Cookie は常にマスクする
+	RedactHeaders []string
+	// BodyFormatters は、メディアタイプ ("application/json"、"image/*"、"*/*") ごとのボディの出力方法
+	// 指定しないメディアタイプは、テキストの場合は TextBody、バイナリの場合は Base64Body で出力する
+	// 例: {"application/octet-stream": OmitBody}
+	BodyFormatters map[string]BodyFormatter
+}
+
+// attemptDump は、WithAttemptDump で設定した出力の内容
+type attemptDump struct {
+	maxBodyBytes int
+	redact       map[string]bool
+	formatters   map[string]BodyFormatter
+}
+
+// WithAttemptDump は、試行ごとに、リクエストライン、ヘッダー、先頭のボディと、レスポンスのステータス、ヘッダー、先頭のボディを
+// LogEventDump のログとして出力する
+// 認証情報を出力しないように、Authorization、Cookie、Set-Cookie などのヘッダーと config.RedactHeaders のヘッダーの値はマスクする
+// NOTE: 本番環境でリトライの原因を調査するために使用する。ログは Debug レベルのため、ロガーのレベルか WithLogLevel で出力を有効にする
+// リクエストボディは GetBody で巻き戻せる場合のみ出力する。レスポンスボディは Peek で先頭を読み込むため、呼び出し元は続けてボディ全体を読み込める
+func WithAttemptDump(config DumpConfig) Option {
+	return func(t *RetryableTransport) {
+		maxBodyBytes := config.MaxBodyBytes
+		if maxBodyBytes == 0 {
+			maxBodyBytes = defaultDumpBodyBytes
+		}
+		redact := make(map[string]bool, len(defaultRedactedHeaders)+len(config.RedactHeaders))
+		for _, name := range append(append([]string(nil), defaultRedactedHeaders...), config.RedactHeaders...) {
+			redact[http.CanonicalHeaderKey(name)] = true
+		}
+		formatters := make(map[string]BodyFormatter, len(config.BodyFormatters))
+		for mediaType, formatter := range config.BodyFormatters {
+			formatters[strings.ToLower(mediaType)] = formatter
+		}
+		t.dump = &attemptDump{maxBodyBytes: maxBodyBytes, redact: redact, formatters: formatters}
+	}
+}
+
+// dumpRequest は、WithAttemptDump が指定されている場合に、送信する試行のリクエストを出力する
+func (t *RetryableTransport) dumpRequest(ctx context.Context, attempt int, req *http.Request, logArgs *requestLogArgs) {
+	if t.dump == nil || !t.logEnabled(ctx, LogEventDump) {
+		return
+	}
+	attrs := []any{
+		slog.String("line", req.Method+" "+req.URL.Redacted()+" "+req.Proto),
+		t.dump.headers(req.Header),
+	}
+	if body, truncated, ok := t.dump.requestBody(req); ok {
+		attrs = append(attrs, t.dump.body(req.Header.Get("Content-Type"), body, truncated)...)
+	}
+	t.log(ctx, LogEventDump, "attempt request", logArgs.with("attempt", attempt, slog.Group("request", attrs...))...)
+}
+
+// dumpResponse は、WithAttemptDump が指定されている場合に、試行の結果のレスポンスを出力する
+func (t *RetryableTransport) dumpResponse(ctx context.Context, attempt int, res *http.Response, err error, logArgs *requestLogArgs) {
+	if t.dump == nil || !t.logEnabled(ctx, LogEventDump) {
+		return
+	}
+	if err != nil {
+		t.log(ctx, LogEventDump, "attempt response", logArgs.with("attempt", attempt, "error", err)...)
+		return
+	}
+	attrs := []any{
+		slog.Int("status", res.StatusCode),
+		slog.String("proto", res.Proto),
+		t.dump.headers(res.Header),
+	}
+	if t.dump.maxBodyBytes > 0 {
+		// NOTE: ボディの読み込みに失敗した場合は、読み込めた部分のみを出力し、エラーは呼び出し元がボディを読み込む時に返却させる
+		// 切り詰めたか判定するため、1 バイト多く読み込む
+		body, _ := Peek(res, t.dump.maxBodyBytes+1)
+		truncated := len(body) > t.dump.maxBodyBytes
+		if truncated {
+			body = body[:t.dump.maxBodyBytes]
+		}
+		attrs = append(attrs, t.dump.body(res.Header.Get("Content-Type"), body, truncated)...)
+	}
+	t.log(ctx, LogEventDump, "attempt response", logArgs.with("attempt", attempt, slog.Group("response", attrs...))...)
+}
+
+// headers は、マスクするヘッダーの値を置き換えたヘッダーをログの属性として返却する
+func (d *attemptDump) headers(header http.Header) slog.Attr {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]any, 0, len(keys))
+	for _, key := range keys {
+		value := strings.Join(header[key], ", ")
+		if d.redact[http.CanonicalHeaderKey(key)] {
+			value = redactedValue
+		}
+		attrs = append(attrs, slog.String(key, value))
+	}
+	return slog.Group("headers", attrs...)
+}
+
+// body は、Content-Type に応じた BodyFormatter で変換したボディをログの属性として返却する
+func (d *attemptDump) body(contentType string, body []byte, truncated bool) []any {
+	if truncated {
+		body = trimPartialRune(body)
+	}
+	attrs := []any{slog.Any("body", formatBody(d.formatters, contentType, body))}
+	if truncated {
+		attrs = append(attrs, slog.Bool("body_truncated", true))
+	}
+	return attrs
+}
+
+// requestBody は、リクエストボディの先頭と、MaxBodyBytes で切り詰めたかを返却する。GetBody で巻き戻せない場合やボディを出力しない場合は false を返却する
+func (d *attemptDump) requestBody(req *http.Request) ([]byte, bool, bool) {
+	if d.maxBodyBytes <= 0 || req.Body == nil || req.Body == http.NoBody || req.GetBody == nil {
+		return nil, false, false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, false, false
+	}
+	defer body.Close()
+
+	// NOTE: 切り詰めたか判定するため、1 バイト多く読み込む
+	data, err := io.ReadAll(io.LimitReader(body, int64(d.maxBodyBytes)+1))
+	if err != nil {
+		return nil, false, false
+	}
+	if len(data) > d.maxBodyBytes {
+		return data[:d.maxBodyBytes], true, true
+	}
+	return data, false, true
+}
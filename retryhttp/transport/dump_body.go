@@ -0,0 +1,105 @@
+package transport
+
+import (
+	"encoding/base64"
+	"log/slog"
+	"mime"
+	"strings"
+	"unicode/utf8"
+)
+
+// BodyFormatter は、WithAttemptDump で出力するボディをログの値に変換する関数の型定義
+// contentType は Content-Type ヘッダーのメディアタイプ (小文字でパラメーターを除いたもの)。body は DumpConfig.MaxBodyBytes までの先頭
+type BodyFormatter func(contentType string, body []byte) slog.Value
+
+// TextBody は、ボディを文字列として出力する BodyFormatter。UTF-8 として不正なボディは Base64Body で出力する
+func TextBody(contentType string, body []byte) slog.Value {
+	if !utf8.Valid(body) {
+		return Base64Body(contentType, body)
+	}
+	return slog.StringValue(string(body))
+}
+
+// Base64Body は、ボディを Base64 でエンコードして、エンコードの種類とバイト数とともに出力する BodyFormatter
+// NOTE: 画像などのバイナリのボディをそのままログに出力すると、ログの収集基盤で文字化けやパースの失敗が起きるため使用する
+func Base64Body(contentType string, body []byte) slog.Value {
+	return slog.GroupValue(
+		slog.String("encoding", "base64"),
+		slog.Int("bytes", len(body)),
+		slog.String("data", base64.StdEncoding.EncodeToString(body)),
+	)
+}
+
+// OmitBody は、ボディの内容を出力せず、バイト数のみを出力する BodyFormatter
+func OmitBody(contentType string, body []byte) slog.Value {
+	return slog.GroupValue(
+		slog.String("encoding", "omitted"),
+		slog.Int("bytes", len(body)),
+	)
+}
+
+// formatBody は、Content-Type に対応する BodyFormatter でボディをログの値に変換する
+// formatters は、メディアタイプ ("application/json")、タイプのワイルドカード ("image/*")、すべてのタイプ ("*/*") の順に検索する
+// 一致するものがない場合は、テキストのメディアタイプは TextBody、それ以外は Base64Body で出力する
+// NOTE: BodyFormatter がパニックした場合も試行を中断しないように、Base64Body で出力し直す
+func formatBody(formatters map[string]BodyFormatter, contentType string, body []byte) (value slog.Value) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = ""
+	}
+	mediaType = strings.ToLower(mediaType)
+
+	formatter, ok := formatters[mediaType]
+	if !ok && mediaType != "" {
+		major, _, _ := strings.Cut(mediaType, "/")
+		formatter, ok = formatters[major+"/*"]
+	}
+	if !ok {
+		formatter, ok = formatters["*/*"]
+	}
+	if !ok {
+		formatter = Base64Body
+		if isTextMediaType(mediaType) {
+			formatter = TextBody
+		}
+	}
+
+	defer func() {
+		if recover() != nil {
+			value = Base64Body(mediaType, body)
+		}
+	}()
+	return formatter(mediaType, body)
+}
+
+// isTextMediaType は、ボディをテキストとして出力するメディアタイプか判定する
+// NOTE: Content-Type がない場合は、JSON API のエラーレスポンスなどを読めるようにテキストとみなす。不正な UTF-8 は TextBody が Base64 で出力する
+func isTextMediaType(mediaType string) bool {
+	switch {
+	case mediaType == "":
+		return true
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/xml", "application/x-www-form-urlencoded", "application/javascript", "application/x-ndjson":
+		return true
+	}
+	return false
+}
+
+// trimPartialRune は、切り詰めたボディの末尾にある途中で切れた UTF-8 の文字を取り除く
+// NOTE: 切り詰めたテキストが不正な UTF-8 とみなされ、Base64 で出力されるのを防ぐ
+func trimPartialRune(body []byte) []byte {
+	for i := len(body) - 1; i >= 0 && i >= len(body)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(body[i]) {
+			if !utf8.FullRune(body[i:]) {
+				return body[:i]
+			}
+			break
+		}
+	}
+	return body
+}
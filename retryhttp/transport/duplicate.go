@@ -0,0 +1,99 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+)
+
+// PossibleDuplicate は、書き込み後に送信エラーとなった非冪等なリクエストをリトライしたか
+// true の場合、サーバーが最初の試行を処理済みの可能性があるため、アプリケーション側で重複の確認 (照合) を行う必要がある
+func (m *ResponseMetadata) PossibleDuplicate() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.possibleDuplicate
+}
+
+// markPossibleDuplicate は、重複送信の可能性があることを記録する
+func (m *ResponseMetadata) markPossibleDuplicate() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.possibleDuplicate = true
+}
+
+// attemptWroteRequest は、現在の試行でリクエストの書き込みが完了したか
+func (m *ResponseMetadata) attemptWroteRequest() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.wroteRequest
+}
+
+// WritePhase は、試行が失敗した時点でリクエストの書き込みが完了していたか
+type WritePhase int
+
+const (
+	// WritePhaseUnknown は RetryableTransport を経由していないため不明であることを表す
+	WritePhaseUnknown WritePhase = iota
+	// BeforeWrite はリクエストの書き込みが完了する前であることを表す。サーバーは処理していないため、常にリトライしても安全
+	BeforeWrite
+	// AfterWrite はリクエストの書き込みが完了した後であることを表す。サーバーが処理済みの可能性があるため、リトライすると重複する可能性がある
+	AfterWrite
+)
+
+func (p WritePhase) String() string {
+	switch p {
+	case BeforeWrite:
+		return "before_write"
+	case AfterWrite:
+		return "after_write"
+	default:
+		return "unknown"
+	}
+}
+
+// AttemptWritePhase は、CheckRetryContextFunc に渡された context.Context から、現在の試行でリクエストの書き込みが完了していたかを返却する
+// NOTE: 冪等でないリクエストでも、書き込み前の送信エラーであればリトライするなど、書き込みの前後で判定を切り替える場合に使用する
+func AttemptWritePhase(ctx context.Context) WritePhase {
+	m, ok := ctx.Value(metadataKey{}).(*ResponseMetadata)
+	if !ok {
+		return WritePhaseUnknown
+	}
+	if m.attemptWroteRequest() {
+		return AfterWrite
+	}
+	return BeforeWrite
+}
+
+// WithRetryNonIdempotent は、冪等でないリクエスト (Idempotency-Key ヘッダーのない POST, PATCH など) もリトライするか設定する
+// デフォルトでは重複した副作用を避けるため、リクエストの書き込み前に失敗した場合を除いてリトライしない
+// NOTE: サーバー側で重複が排除されるなど、リトライしても安全な場合にのみ有効にする。書き込み後にリトライした場合は PossibleDuplicate で判定できる
+func WithRetryNonIdempotent(enabled bool) Option {
+	return func(t *RetryableTransport) {
+		t.retryNonIdempotent = enabled
+	}
+}
+
+// canRetryMethod は、リクエストのメソッドと試行の状態からリトライしても安全か判定する
+// NOTE: リクエストの書き込み前に送信エラーとなった場合や、レート制限 (429) で拒否された場合は、
+// サーバーで処理されていないため冪等でなくてもリトライする
+func (t *RetryableTransport) canRetryMethod(req *http.Request, res *http.Response, err error, m *ResponseMetadata) bool {
+	if t.retryNonIdempotent || isIdempotent(req) {
+		return true
+	}
+	if res != nil && res.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return err != nil && !m.attemptWroteRequest()
+}
+
+// isIdempotent は、リクエストが冪等か判定する
+// NOTE: Idempotency-Key ヘッダーが付与されている場合は、サーバー側で重複が排除されるため冪等とみなす
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get(HeaderIdempotencyKey) != ""
+}
@@ -0,0 +1,107 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// ErrorClass は送信エラーの分類
+type ErrorClass int
+
+const (
+	// ErrorRetryable はリトライで成功する可能性がある一時的なエラー (タイムアウト、接続のリセットなど)
+	ErrorRetryable ErrorClass = iota
+	// ErrorPermanent はリトライしても成功しない恒久的なエラー (証明書のエラー、存在しないホスト、呼び出し元のキャンセルなど)
+	ErrorPermanent
+	// ErrorUnknown は分類できないエラー。IsRetryableError ではリトライ可能とみなす
+	ErrorUnknown
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorRetryable:
+		return "retryable"
+	case ErrorPermanent:
+		return "permanent"
+	default:
+		return "unknown"
+	}
+}
+
+// ClassifyError は送信エラーを分類する
+func ClassifyError(err error) ErrorClass {
+	if err == nil {
+		return ErrorRetryable
+	}
+
+	// Permanent() で true を返却するエラーは、リトライしても成功しない
+	var permanent interface{ Permanent() bool }
+	if errors.As(err, &permanent) && permanent.Permanent() {
+		return ErrorPermanent
+	}
+
+	// 試行ごとのタイムアウトは、リクエスト全体の context.Context が有効なためリトライ可能
+	var attemptErr *AttemptTimeoutError
+	if errors.As(err, &attemptErr) {
+		return ErrorRetryable
+	}
+
+	// 呼び出し元によるキャンセルやデッドラインの超過は、リトライしても成功しない
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return ErrorPermanent
+	}
+
+	// 証明書のエラーは、設定を変更しない限り成功しない
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+		verification     *tls.CertificateVerificationError
+	)
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid) || errors.As(err, &verification) {
+		return ErrorPermanent
+	}
+
+	// 存在しないホスト (NXDOMAIN) は、リトライしても成功しない
+	// NOTE: DNS サーバーのタイムアウトなど、一時的な名前解決のエラーはリトライする
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsNotFound {
+			return ErrorPermanent
+		}
+		return ErrorRetryable
+	}
+
+	// タイムアウト、接続のリセット、途中での切断は一時的なエラー
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorRetryable
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.EPIPE):
+		return ErrorRetryable
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrorRetryable
+	case isHTTP2Retryable(err):
+		return ErrorRetryable
+	}
+	return ErrorUnknown
+}
+
+// IsRetryableError は、送信エラーがリトライ可能か判定する
+// NOTE: 分類できないエラーは、一時的なエラーの可能性があるためリトライ可能とみなす
+func IsRetryableError(err error) bool {
+	return ClassifyError(err) != ErrorPermanent
+}
+
+// isHTTP2Retryable は、サーバーが処理せずに拒否した HTTP/2 のストリームか判定する
+// NOTE: GOAWAY や REFUSED_STREAM はサーバーの再起動など一時的な理由で返却される
+func isHTTP2Retryable(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "GOAWAY") || strings.Contains(msg, "REFUSED_STREAM")
+}
@@ -0,0 +1,204 @@
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// maxErrorCodeBodyBytes はエラーコードを取得するために読み込むレスポンスボディの最大バイト数
+const maxErrorCodeBodyBytes = 64 << 10
+
+// ErrorCodeRule は、ベンダー固有のエラーコードに対するリトライの判定と、呼び出し元に返却するエラー
+type ErrorCodeRule struct {
+	// Retryable はリトライを行うか。CheckRetryFunc の判定より優先される
+	Retryable bool
+	// Err はエラーコードに対応する型付きのエラー。nil の場合は VendorError のみを返却する
+	Err error
+}
+
+// ErrorCodeExtractor は、エラーレスポンスからベンダー固有のエラーコードを取得する関数の型定義
+// エラーコードが含まれない場合は空文字列を返却する
+type ErrorCodeExtractor func(res *http.Response, body []byte) string
+
+// VendorError は、エラーレスポンスにベンダー固有のエラーコードが含まれていたことを表すエラー
+type VendorError struct {
+	Host       string
+	StatusCode int
+	Code       string
+	// Err は ErrorCodeRule.Err
+	Err error
+}
+
+func (e *VendorError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s returned %d %s: %v", e.Host, e.StatusCode, e.Code, e.Err)
+	}
+	return fmt.Sprintf("%s returned %d %s", e.Host, e.StatusCode, e.Code)
+}
+
+func (e *VendorError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorCodeTable は、ホストごとのベンダー固有のエラーコードからリトライの判定と型付きのエラーへの対応表
+// 例えば AWS の "ThrottlingException" はステータスコード 400 で返却されるが、リトライ可能として扱う
+type ErrorCodeTable struct {
+	mu    sync.RWMutex
+	hosts map[string]*hostErrorCodes
+}
+
+// hostErrorCodes はホストごとの対応表
+type hostErrorCodes struct {
+	extract ErrorCodeExtractor
+	rules   map[string]ErrorCodeRule
+}
+
+// NewErrorCodeTable は ErrorCodeTable 構造体を作成する
+func NewErrorCodeTable() *ErrorCodeTable {
+	return &ErrorCodeTable{hosts: make(map[string]*hostErrorCodes)}
+}
+
+// Register はホストのエラーコードの対応を登録する。host は "api.example.com" または "api.example.com:8443" の形式
+// NOTE: 同じエラーコードを再度登録した場合は上書きする
+func (t *ErrorCodeTable) Register(host string, rules map[string]ErrorCodeRule) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h := t.host(host)
+	for code, rule := range rules {
+		h.rules[code] = rule
+	}
+}
+
+// SetExtractor はホストのエラーコードの取得方法を設定する。設定しない場合は DefaultErrorCodeExtractor を使用する
+func (t *ErrorCodeTable) SetExtractor(host string, extract ErrorCodeExtractor) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.host(host).extract = extract
+}
+
+// host はホストの対応表を返却する。ない場合は作成する
+func (t *ErrorCodeTable) host(host string) *hostErrorCodes {
+	h, ok := t.hosts[host]
+	if !ok {
+		h = &hostErrorCodes{extract: DefaultErrorCodeExtractor, rules: make(map[string]ErrorCodeRule)}
+		t.hosts[host] = h
+	}
+	return h
+}
+
+// lookup はリクエスト先のホストの対応表を返却する
+func (t *ErrorCodeTable) lookup(req *http.Request) (*hostErrorCodes, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if h, ok := t.hosts[req.URL.Host]; ok {
+		return h, true
+	}
+	h, ok := t.hosts[req.URL.Hostname()]
+	return h, ok
+}
+
+// DefaultErrorCodeExtractor は、主要なベンダーの形式からエラーコードを取得する
+// X-Amzn-ErrorType ヘッダー、JSON の "__type" (AWS), "error.code" (Google, Azure), "code", "errorCode", "Code" の順に確認する
+func DefaultErrorCodeExtractor(res *http.Response, body []byte) string {
+	if v := res.Header.Get("X-Amzn-ErrorType"); v != "" {
+		code, _, _ := strings.Cut(v, ":")
+		return code
+	}
+
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+	if v := jsonString(payload["__type"]); v != "" {
+		// "com.amazonaws.dynamodb.v20120810#ThrottlingException" の形式の場合は "#" 以降をエラーコードとする
+		if i := strings.LastIndex(v, "#"); i >= 0 {
+			return v[i+1:]
+		}
+		return v
+	}
+	if raw, ok := payload["error"]; ok {
+		var nested map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &nested); err == nil {
+			if v := jsonString(nested["code"]); v != "" {
+				return v
+			}
+		}
+	}
+	for _, key := range []string{"code", "errorCode", "Code"} {
+		if v := jsonString(payload[key]); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// jsonString は JSON の文字列または数値を文字列として返却する
+func jsonString(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n.String()
+	}
+	return ""
+}
+
+// WithErrorCodes は、ベンダー固有のエラーコードの対応表を設定する
+// エラーレスポンスのエラーコードが対応表にある場合は、CheckRetryFunc の代わりに ErrorCodeRule.Retryable でリトライを判定し、
+// *VendorError を ResponseMetadata.VendorError で参照できるようにする
+func WithErrorCodes(table *ErrorCodeTable) Option {
+	return func(t *RetryableTransport) {
+		t.errorCodes = table
+	}
+}
+
+// classifyErrorCode は、エラーレスポンスのエラーコードが対応表にある場合に、その対応を返却する
+// NOTE: エラーコードを取得するためにレスポンスボディの先頭を Peek で読み込むため、呼び出し元はボディ全体を読み込める
+func (t *RetryableTransport) classifyErrorCode(req *http.Request, res *http.Response) (*VendorError, ErrorCodeRule, bool) {
+	if t.errorCodes == nil || res == nil || res.StatusCode < http.StatusBadRequest || res.Body == nil {
+		return nil, ErrorCodeRule{}, false
+	}
+	h, ok := t.errorCodes.lookup(req)
+	if !ok {
+		return nil, ErrorCodeRule{}, false
+	}
+
+	body, err := Peek(res, maxErrorCodeBodyBytes)
+	if err != nil {
+		return nil, ErrorCodeRule{}, false
+	}
+
+	code := h.extract(res, body)
+	rule, ok := h.rules[code]
+	if code == "" || !ok {
+		return nil, ErrorCodeRule{}, false
+	}
+	return &VendorError{Host: req.URL.Host, StatusCode: res.StatusCode, Code: code, Err: rule.Err}, rule, true
+}
+
+// VendorError は、最後の試行のレスポンスに対応表にあるエラーコードが含まれていた場合に、その *VendorError を返却する
+func (m *ResponseMetadata) VendorError() *VendorError {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.vendorError
+}
+
+// setVendorError は、試行のレスポンスに含まれていたエラーコードを記録する
+func (m *ResponseMetadata) setVendorError(err *VendorError) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.vendorError = err
+}
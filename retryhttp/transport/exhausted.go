@@ -0,0 +1,119 @@
+package transport
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// AttemptResult は 1 回の試行の結果
+type AttemptResult struct {
+	// Attempt は試行番号 (1 から開始)
+	Attempt int
+	// StatusCode はレスポンスのステータスコード。送信エラーの場合は 0
+	StatusCode int
+	// Err は送信エラー
+	Err error
+	// Duration は試行の所要時間
+	Duration time.Duration
+	// Wait は試行の後のバックオフの待機時間。リトライしなかった場合は 0
+	Wait time.Duration
+}
+
+// RetryExhaustedError は、試行回数の上限、リトライの予算、所要時間の上限のいずれかに達したため、
+// リトライが必要な結果のまま終了したことを表すエラー。最後の試行のエラーにアンラップされる
+type RetryExhaustedError struct {
+	Attempts []AttemptResult
+	// Err は最後の試行のエラー。最後の試行でレスポンスを受け取った場合は、ベンダー固有のエラーコードの *VendorError または nil
+	Err error
+}
+
+func (e *RetryExhaustedError) Error() string {
+	last := e.Attempts[len(e.Attempts)-1]
+	if e.Err != nil {
+		return fmt.Sprintf("retries exhausted after %d attempts: %v", len(e.Attempts), e.Err)
+	}
+	return fmt.Sprintf("retries exhausted after %d attempts: last status %d", len(e.Attempts), last.StatusCode)
+}
+
+func (e *RetryExhaustedError) Unwrap() error {
+	return e.Err
+}
+
+// Attempts は試行ごとの結果を試行した順に返却する
+func (m *ResponseMetadata) Attempts() []AttemptResult {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempts := make([]AttemptResult, len(m.attempts))
+	copy(attempts, m.attempts)
+	return attempts
+}
+
+// Exhausted は、リトライが必要な結果のまま終了したレスポンスか
+// NOTE: 送信エラーで終了した場合は、RoundTrip が *RetryExhaustedError を返却する
+func (m *ResponseMetadata) Exhausted() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.exhausted
+}
+
+// ExhaustedError は、リトライが必要な結果のまま終了したレスポンスの場合に、試行ごとの結果を含む *RetryExhaustedError を返却する
+// それ以外の場合は nil を返却する
+func (m *ResponseMetadata) ExhaustedError() *RetryExhaustedError {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.exhausted {
+		return nil
+	}
+	attempts := make([]AttemptResult, len(m.attempts))
+	copy(attempts, m.attempts)
+	exhaustedErr := &RetryExhaustedError{Attempts: attempts}
+	if m.vendorError != nil {
+		exhaustedErr.Err = m.vendorError
+	}
+	return exhaustedErr
+}
+
+// recordAttempt は試行の結果を記録する
+func (m *ResponseMetadata) recordAttempt(result AttemptResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.attempts = append(m.attempts, result)
+}
+
+// recordWait は最後の試行の後のバックオフの待機時間を記録する
+func (m *ResponseMetadata) recordWait(wait time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.attempts) > 0 {
+		m.attempts[len(m.attempts)-1].Wait = wait
+	}
+}
+
+// exhaust は、リトライが必要な結果のまま終了したことを記録する。送信エラーの場合は *RetryExhaustedError でラップして返却する
+func (m *ResponseMetadata) exhaust(err error) error {
+	m.mu.Lock()
+	m.exhausted = true
+	attempts := make([]AttemptResult, len(m.attempts))
+	copy(attempts, m.attempts)
+	m.mu.Unlock()
+
+	if err == nil {
+		return nil
+	}
+	return &RetryExhaustedError{Attempts: attempts, Err: err}
+}
+
+// attemptResult は試行の結果から AttemptResult を作成する
+func attemptResult(attempt int, res *http.Response, err error, duration time.Duration) AttemptResult {
+	result := AttemptResult{Attempt: attempt, Err: err, Duration: duration}
+	if res != nil {
+		result.StatusCode = res.StatusCode
+	}
+	return result
+}
@@ -0,0 +1,181 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Host は、HostSelector で選択した最後の試行の送信先 (スキームとホスト) を返却する。WithHostSelector が指定されていない場合は nil
+func (m *ResponseMetadata) Host() *url.URL {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.host
+}
+
+// setHost は試行の送信先を記録する
+func (m *ResponseMetadata) setHost(host *url.URL) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.host = host
+}
+
+// ErrInvalidBaseURL は、HostSelector の送信先の URL にスキームとホストが含まれていないことを表すエラー
+var ErrInvalidBaseURL = errors.New("base URL must include a scheme and a host")
+
+// HostSelector は、リクエストの試行ごとの送信先 (スキームとホスト) を選択するインターフェース
+// Hosts が返却した順に試行ごとの送信先とし、試行回数が送信先の数を超えた場合は先頭から繰り返す
+// NOTE: 失敗し続けている送信先にリトライを集中させず、別のホストやリージョンにフェイルオーバーするために使用する
+type HostSelector interface {
+	Hosts(req *http.Request) []*url.URL
+}
+
+// HostReporter は、試行ごとの送信先の結果を受け取る HostSelector が実装するインターフェース
+type HostReporter interface {
+	Report(host *url.URL, failed bool)
+}
+
+// WithHostSelector は、試行ごとの送信先を選択する HostSelector を設定する
+// リクエストの URL のパスとクエリはそのままに、スキームとホストを選択した送信先に置き換えて送信する
+func WithHostSelector(selector HostSelector) Option {
+	return func(t *RetryableTransport) {
+		t.hosts = selector
+	}
+}
+
+// RoundRobinHosts は、リクエストごとに最初の送信先をずらし、リトライごとに次の送信先に切り替える HostSelector 具象型
+type RoundRobinHosts struct {
+	hosts []*url.URL
+	next  atomic.Uint64
+}
+
+// NewRoundRobinHosts は RoundRobinHosts 構造体を作成する。baseURLs はスキームとホストを含む URL (例: https://api-1.example.com)
+func NewRoundRobinHosts(baseURLs ...string) (*RoundRobinHosts, error) {
+	hosts, err := parseBaseURLs(baseURLs)
+	if err != nil {
+		return nil, err
+	}
+	return &RoundRobinHosts{hosts: hosts}, nil
+}
+
+// Hosts は、前回のリクエストの次の送信先から順に並べた送信先を返却する
+func (s *RoundRobinHosts) Hosts(*http.Request) []*url.URL {
+	start := int((s.next.Add(1) - 1) % uint64(len(s.hosts)))
+	return append(append([]*url.URL(nil), s.hosts[start:]...), s.hosts[:start]...)
+}
+
+// PriorityHosts は、優先度の高い送信先から順に試行し、失敗した送信先を一定期間優先度を下げる HostSelector 具象型
+type PriorityHosts struct {
+	hosts    []*url.URL
+	cooldown time.Duration
+	now      func() time.Time
+
+	mu     sync.Mutex
+	failed map[string]time.Time
+}
+
+// NewPriorityHosts は PriorityHosts 構造体を作成する。baseURLs は優先度の高い順に指定する
+// cooldown は失敗した送信先の優先度を下げる期間。0 以下の場合は 30 秒
+func NewPriorityHosts(cooldown time.Duration, baseURLs ...string) (*PriorityHosts, error) {
+	hosts, err := parseBaseURLs(baseURLs)
+	if err != nil {
+		return nil, err
+	}
+	if cooldown <= 0 {
+		cooldown = 30 * time.Second
+	}
+	return &PriorityHosts{
+		hosts:    hosts,
+		cooldown: cooldown,
+		now:      time.Now,
+		failed:   make(map[string]time.Time),
+	}, nil
+}
+
+// Hosts は、直近で失敗していない送信先を優先度の順に並べ、その後に失敗した送信先を並べて返却する
+func (s *PriorityHosts) Hosts(*http.Request) []*url.URL {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	healthy := make([]*url.URL, 0, len(s.hosts))
+	var failed []*url.URL
+	for _, host := range s.hosts {
+		if until, ok := s.failed[host.Host]; ok && now.Before(until) {
+			failed = append(failed, host)
+			continue
+		}
+		healthy = append(healthy, host)
+	}
+	return append(healthy, failed...)
+}
+
+// Report は送信先の結果を記録する。失敗した送信先は cooldown の間、優先度を下げる
+func (s *PriorityHosts) Report(host *url.URL, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if failed {
+		s.failed[host.Host] = s.now().Add(s.cooldown)
+		return
+	}
+	delete(s.failed, host.Host)
+}
+
+// parseBaseURLs は送信先の URL を解析する
+func parseBaseURLs(baseURLs []string) ([]*url.URL, error) {
+	if len(baseURLs) == 0 {
+		return nil, fmt.Errorf("%w: no base URLs", ErrInvalidBaseURL)
+	}
+	hosts := make([]*url.URL, 0, len(baseURLs))
+	for _, raw := range baseURLs {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, &url.Error{Op: "parse", URL: raw, Err: ErrInvalidBaseURL}
+		}
+		hosts = append(hosts, u)
+	}
+	return hosts, nil
+}
+
+// selectHosts は、HostSelector が設定されている場合にリクエストの送信先を返却する
+func (t *RetryableTransport) selectHosts(req *http.Request) []*url.URL {
+	if t.hosts == nil {
+		return nil
+	}
+	return t.hosts.Hosts(req)
+}
+
+// withAttemptHost は、試行回数に応じた送信先にスキームとホストを置き換えたリクエストを返却する
+// NOTE: 呼び出し元のリクエストを変更しないように、URL を複製してから置き換える
+func withAttemptHost(req *http.Request, hosts []*url.URL, attempts int) (*http.Request, *url.URL) {
+	if len(hosts) == 0 {
+		return req, nil
+	}
+	host := hosts[(attempts-1)%len(hosts)]
+	newReq := *req
+	u := *req.URL
+	u.Scheme, u.Host = host.Scheme, host.Host
+	newReq.URL = &u
+	// NOTE: Host ヘッダーを置き換えた送信先のホストにする
+	newReq.Host = ""
+	return &newReq, host
+}
+
+// reportHost は、HostSelector が HostReporter を実装している場合に、送信先の結果を通知する
+func (t *RetryableTransport) reportHost(host *url.URL, res *http.Response, err error) {
+	reporter, ok := t.hosts.(HostReporter)
+	if !ok || host == nil {
+		return
+	}
+	reporter.Report(host, err != nil || res.StatusCode >= http.StatusInternalServerError)
+}
@@ -0,0 +1,196 @@
+package transport
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/mtnori/httpRetryExample/retryhttp/internal/shard"
+)
+
+// callerKey は context.Context に呼び出し元の識別子を格納するためのキー
+type callerKey struct{}
+
+// WithCaller は、context.Context にリクエストの呼び出し元の識別子を格納する
+// WithFairQueuing を指定した場合は、呼び出し元ごとに順番に WithMaxConcurrentRequestsPerHost の枠を割り当てる
+// NOTE: 1 つの Client を共有する複数の機能やテナントを区別するために、機能名やテナント ID を指定する
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFromContext は context.Context に格納された呼び出し元の識別子を返却する
+func CallerFromContext(ctx context.Context) (string, bool) {
+	caller, ok := ctx.Value(callerKey{}).(string)
+	return caller, ok
+}
+
+// WithMaxConcurrentRequestsPerHost は、送信先のホストごとに、リトライを含めて同時に送信する試行の数を n 以下に制限する
+// 上限に達している場合は、そのホストへの試行が終了するか context.Context が終了するまで待機する。n が 0 以下の場合は制限しない
+// NOTE: WithMaxConcurrentRequests と組み合わせた場合は、ホストの枠を獲得してから全体の枠を獲得する
+func WithMaxConcurrentRequestsPerHost(n int) Option {
+	return func(t *RetryableTransport) {
+		if n <= 0 {
+			t.hostConcurrency = nil
+			return
+		}
+		t.hostConcurrency = &hostConcurrency{limit: n, hosts: shard.New[*fairSemaphore](0)}
+	}
+}
+
+// WithFairQueuing は、WithMaxConcurrentRequestsPerHost の上限に達した場合に、待機しているリクエストに呼び出し元 (WithCaller) ごとに順番に枠を割り当てる
+// 指定しない場合は、呼び出し元に関係なく待機を開始した順に枠を割り当てる
+// NOTE: 大量のリクエストやそのリトライを送信する呼び出し元が、他の呼び出し元の枠を奪い続けるのを防ぐために使用する
+// リトライの試行も呼び出し元の待機列の末尾に並ぶため、障害時にリトライを繰り返す呼び出し元が枠を独占することはない
+// 呼び出し元を指定していないリクエストは、1 つの呼び出し元として扱う
+func WithFairQueuing() Option {
+	return func(t *RetryableTransport) {
+		t.fairQueuing = true
+	}
+}
+
+// hostConcurrency は、ホストごとの同時に送信する試行の数を制限するセマフォ
+type hostConcurrency struct {
+	limit int
+	hosts *shard.Map[*fairSemaphore]
+}
+
+// fairSemaphore は、待機しているリクエストに呼び出し元ごとのラウンドロビンで枠を割り当てるセマフォ
+type fairSemaphore struct {
+	mu     sync.Mutex
+	limit  int
+	active int
+	// queues は呼び出し元ごとの待機列
+	queues map[string]*list.List
+	// order は待機しているリクエストがある呼び出し元の、次に枠を割り当てる順番
+	order []string
+}
+
+// slotWaiter は枠が空くのを待機しているリクエスト
+type slotWaiter struct {
+	caller  string
+	ready   chan struct{}
+	granted bool
+	element *list.Element
+}
+
+// acquireHostSlot は、WithMaxConcurrentRequestsPerHost が指定されている場合に、ホストへ試行を送信できるまで待機する
+// 返却する関数は試行の終了時に呼び出す。複数回呼び出しても 1 回だけ解放する
+// NOTE: Shutdown を呼び出した場合も、待機を中断して ErrShutdown を返却する
+func (t *RetryableTransport) acquireHostSlot(req *http.Request) (func(), error) {
+	limit := t.hostConcurrency
+	if limit == nil {
+		return func() {}, nil
+	}
+
+	host := req.URL.Host
+	semaphores := limit.hosts.Lock(host)
+	semaphore, ok := semaphores.Entries[host]
+	if !ok {
+		semaphore = &fairSemaphore{limit: limit.limit, queues: make(map[string]*list.List)}
+		semaphores.Entries[host] = semaphore
+	}
+	semaphores.Unlock()
+
+	var caller string
+	if t.fairQueuing {
+		caller, _ = CallerFromContext(req.Context())
+	}
+	return semaphore.acquire(req.Context(), caller, t.shutdown.done())
+}
+
+// acquire は枠を獲得するまで待機する。ctx または shutdown が終了した場合は待機を中断する
+func (s *fairSemaphore) acquire(ctx context.Context, caller string, shutdown context.Context) (func(), error) {
+	s.mu.Lock()
+	if s.active < s.limit && len(s.order) == 0 {
+		s.active++
+		s.mu.Unlock()
+		return s.releaseOnce(), nil
+	}
+	w := s.enqueue(caller)
+	s.mu.Unlock()
+
+	var err error
+	select {
+	case <-w.ready:
+		return s.releaseOnce(), nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-shutdown.Done():
+		err = ErrShutdown
+	}
+
+	s.mu.Lock()
+	if w.granted {
+		// NOTE: 待機の中断と同時に枠を割り当てられた場合は、割り当てられた枠を次のリクエストに渡す
+		s.mu.Unlock()
+		s.release()
+		return nil, err
+	}
+	s.dequeue(w)
+	s.mu.Unlock()
+	return nil, err
+}
+
+// enqueue は呼び出し元の待機列の末尾にリクエストを追加する。呼び出し元でロックを取得する
+func (s *fairSemaphore) enqueue(caller string) *slotWaiter {
+	queue, ok := s.queues[caller]
+	if !ok {
+		queue = list.New()
+		s.queues[caller] = queue
+		s.order = append(s.order, caller)
+	}
+	w := &slotWaiter{caller: caller, ready: make(chan struct{})}
+	w.element = queue.PushBack(w)
+	return w
+}
+
+// dequeue は待機を中断したリクエストを待機列から取り除く。呼び出し元でロックを取得する
+func (s *fairSemaphore) dequeue(w *slotWaiter) {
+	queue := s.queues[w.caller]
+	queue.Remove(w.element)
+	if queue.Len() > 0 {
+		return
+	}
+	delete(s.queues, w.caller)
+	for i, caller := range s.order {
+		if caller == w.caller {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// release は枠を解放し、待機しているリクエストがあれば、次の順番の呼び出し元の先頭のリクエストに枠を割り当てる
+func (s *fairSemaphore) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.active--
+	if len(s.order) == 0 {
+		return
+	}
+
+	caller := s.order[0]
+	queue := s.queues[caller]
+	w := queue.Remove(queue.Front()).(*slotWaiter)
+	if queue.Len() == 0 {
+		delete(s.queues, caller)
+		s.order = s.order[1:]
+	} else {
+		// NOTE: 待機しているリクエストが残っている呼び出し元は、他の呼び出し元の後に回す
+		s.order = append(s.order[1:], caller)
+	}
+
+	s.active++
+	w.granted = true
+	close(w.ready)
+}
+
+// releaseOnce は、獲得した枠を 1 回だけ解放する関数を返却する
+func (s *fairSemaphore) releaseOnce() func() {
+	var once sync.Once
+	return func() {
+		once.Do(s.release)
+	}
+}
@@ -0,0 +1,110 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// WithHedging は、試行の送信から delay が経過してもレスポンスがない場合に、同じリクエストを並行して送信する (ヘッジリクエスト)
+// 最初に受信したレスポンスを返却し、残りの送信はキャンセルする。maxHedges は追加で送信する最大数で、0 以下の場合は 1
+// NOTE: レイテンシーのテール (p99 など) を短縮するために使用する。サーバーの負荷が増えるため、delay には p95 程度のレイテンシーを指定する
+// 重複して処理されても安全な、ボディのない冪等なリクエスト (GET, HEAD など) のみが対象
+func WithHedging(delay time.Duration, maxHedges int) Option {
+	return func(t *RetryableTransport) {
+		t.hedgeDelay = delay
+		t.maxHedges = max(maxHedges, 1)
+	}
+}
+
+// canHedge は、リクエストを並行して送信しても安全か判定する
+func canHedge(req *http.Request) bool {
+	return isIdempotent(req) && (req.Body == nil || req.Body == http.NoBody)
+}
+
+// hedgeResult はヘッジリクエストを含む 1 回の送信の結果
+type hedgeResult struct {
+	// index は何番目の送信か。最初の送信は 0
+	index  int
+	res    *http.Response
+	err    error
+	cancel context.CancelFunc
+}
+
+// roundTripHedged は、WithHedging が指定されている場合はヘッジリクエストを含めて送信し、最初に受信したレスポンスを返却する
+// すべての送信が送信エラーとなった場合は、最後の送信エラーを返却する
+func (t *RetryableTransport) roundTripHedged(rt http.RoundTripper, req *http.Request, logArgs *requestLogArgs) (*http.Response, error) {
+	if t.hedgeDelay <= 0 || !canHedge(req) {
+		return safeRoundTrip(rt, req)
+	}
+
+	results := make(chan hedgeResult, t.maxHedges+1)
+	var cancels []context.CancelFunc
+	send := func() {
+		ctx, cancel := context.WithCancel(req.Context())
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+		// NOTE: 並行して送信するため、ヘッダーを共有しないように複製する
+		hedgeReq := req.Clone(ctx)
+		go func() {
+			// NOTE: 最初の送信は試行ごとに待機済みのため、ヘッジリクエストのみ待機する
+			if index > 0 {
+				if err := t.waitLimiter(hedgeReq); err != nil {
+					results <- hedgeResult{index: index, err: err, cancel: cancel}
+					return
+				}
+			}
+			res, err := safeRoundTrip(rt, hedgeReq)
+			results <- hedgeResult{index: index, res: res, err: err, cancel: cancel}
+		}()
+	}
+
+	send()
+	inflight := 1
+	hedge := t.clock().After(t.hedgeDelay)
+	var lastErr error
+	for {
+		select {
+		case r := <-results:
+			inflight--
+			if r.err != nil {
+				r.cancel()
+				lastErr = r.err
+				if inflight == 0 {
+					return nil, lastErr
+				}
+				continue
+			}
+
+			// 残りの送信をキャンセルし、受信したレスポンスはコネクションを解放するためにクローズする
+			for i, cancel := range cancels {
+				if i != r.index {
+					cancel()
+				}
+			}
+			go discardHedges(results, inflight)
+			return cancelOnClose(r.res, r.cancel), nil
+		case <-hedge:
+			send()
+			inflight++
+			if t.logEnabled(req.Context(), LogEventHedge) {
+				t.log(req.Context(), LogEventHedge, "hedge", logArgs.with("hedges", len(cancels)-1)...)
+			}
+			hedge = nil
+			if len(cancels) <= t.maxHedges {
+				hedge = t.clock().After(t.hedgeDelay)
+			}
+		}
+	}
+}
+
+// discardHedges は、キャンセルしたヘッジリクエストの結果を受信してレスポンスをクローズする
+func discardHedges(results <-chan hedgeResult, n int) {
+	for i := 0; i < n; i++ {
+		r := <-results
+		if r.res != nil && r.res.Body != nil {
+			_ = r.res.Body.Close()
+		}
+		r.cancel()
+	}
+}
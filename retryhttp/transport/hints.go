@@ -0,0 +1,143 @@
+package transport
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/mtnori/httpRetryExample/retryhttp/internal/shard"
+)
+
+// HostHealth は、Hint で返却するホストの状態
+type HostHealth int
+
+const (
+	// HostHealthy はリクエストを送信してよい状態
+	HostHealthy HostHealth = iota
+	// HostThrottled は、429 Too Many Requests や Retry-After ヘッダーでレート制限を受けている状態
+	HostThrottled
+	// HostDown は、サーキットブレーカーが開いているか、ブラックアウト期間中で送信しても失敗する状態
+	HostDown
+)
+
+func (h HostHealth) String() string {
+	switch h {
+	case HostThrottled:
+		return "throttled"
+	case HostDown:
+		return "down"
+	default:
+		return "healthy"
+	}
+}
+
+// defaultThrottleDelay は、429 に Retry-After ヘッダーがない場合にレート制限を受けているとみなす期間
+const defaultThrottleDelay = time.Second
+
+// Hint は、ホストにリクエストを送信する前に参照する状態と、送信を遅らせるべき時間
+type Hint struct {
+	Host   string
+	Health HostHealth
+	// Delay は送信を遅らせるべき時間。HostHealthy の場合は 0
+	Delay time.Duration
+}
+
+// hintTable はホストごとのレート制限の状態
+// NOTE: すべての試行のレスポンスで更新するため、ホストごとの状態をシャードに分散して保持し、ロックの競合を避ける
+type hintTable struct {
+	once      sync.Once
+	throttled *shard.Map[time.Time]
+}
+
+// hosts は、ホストごとのレート制限の状態を保持するマップを返却する
+// NOTE: RetryableTransport のゼロ値で使用できるように、最初に参照した時に作成する
+func (h *hintTable) hosts() *shard.Map[time.Time] {
+	h.once.Do(func() {
+		h.throttled = shard.New[time.Time](0)
+	})
+	return h.throttled
+}
+
+// observe は、レート制限のレスポンスを受け取った場合にホストをレート制限中として記録し、成功した場合は解除する
+func (h *hintTable) observe(host string, res *http.Response, now time.Time) {
+	if res == nil {
+		return
+	}
+
+	throttled := h.hosts().Lock(host)
+	defer throttled.Unlock()
+
+	switch {
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable:
+		wait, ok := ParseRetryAfter(res, now)
+		if !ok {
+			if res.StatusCode != http.StatusTooManyRequests {
+				return
+			}
+			wait = defaultThrottleDelay
+		}
+		if until := now.Add(wait); until.After(throttled.Entries[host]) {
+			throttled.Entries[host] = until
+		}
+	case res.StatusCode < http.StatusBadRequest:
+		delete(throttled.Entries, host)
+	}
+}
+
+// until は、ホストがレート制限中であれば解除される時刻を返却する
+func (h *hintTable) until(host string, now time.Time) (time.Time, bool) {
+	throttled := h.hosts().Lock(host)
+	defer throttled.Unlock()
+
+	until, ok := throttled.Entries[host]
+	if !ok {
+		return time.Time{}, false
+	}
+	if !now.Before(until) {
+		delete(throttled.Entries, host)
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// Hint は、host ("api.example.com" または "api.example.com:8443") への直近のレスポンスやサーキットブレーカー、
+// ブラックアウト期間から、リクエストを送信してよいかと送信を遅らせるべき時間を返却する
+// NOTE: アプリケーションのスケジューラーが、リクエストを作成する前にレート制限や障害中のホストへの送信を控えるために使用する
+func (t *RetryableTransport) Hint(host string) Hint {
+	now := t.clock().Now()
+	hint := Hint{Host: host, Health: HostHealthy}
+	down := func(until time.Time) {
+		hint.Health = HostDown
+		hint.Delay = max(hint.Delay, until.Sub(now))
+	}
+
+	if t.breaker != nil {
+		if until, ok := t.breaker.openUntil(host); ok {
+			down(until)
+		}
+	}
+	hostname := (&url.URL{Host: host}).Hostname()
+	for _, w := range t.blackouts {
+		if w.Host != "" && w.Host != host && w.Host != hostname {
+			continue
+		}
+		if until, ok := w.activeUntil(now); ok {
+			down(until)
+		}
+	}
+	if hint.Health == HostDown {
+		return hint
+	}
+
+	if until, ok := t.hints.until(host, now); ok {
+		hint.Health = HostThrottled
+		hint.Delay = until.Sub(now)
+	}
+	return hint
+}
+
+// observeHint は、試行のレスポンスからホストのレート制限の状態を記録する
+func (t *RetryableTransport) observeHint(req *http.Request, res *http.Response) {
+	t.hints.observe(req.URL.Host, res, t.clock().Now())
+}
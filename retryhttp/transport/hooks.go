@@ -0,0 +1,97 @@
+package transport
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// RequestHook は各試行の送信前に呼び出される関数の型定義
+// NOTE: req は試行ごとに複製されるため、ヘッダーの変更はその試行にのみ反映される
+type RequestHook func(attempt int, req *http.Request)
+
+// ResponseHook は各試行の送信後に呼び出される関数の型定義。送信エラーの場合は res が nil
+// NOTE: レスポンスボディは呼び出し元が読み込むため、フックでは読み込まない
+type ResponseHook func(attempt int, res *http.Response, err error)
+
+// RetryHook はリトライ前のバックオフの開始時に呼び出される関数の型定義
+type RetryHook func(attempt int, wait time.Duration, reason RetryReason)
+
+// RetryReason はリトライする理由
+type RetryReason struct {
+	// StatusCode はリトライの対象となったレスポンスのステータスコード。送信エラーの場合は 0
+	StatusCode int
+	// Err はリトライの対象となった送信エラー
+	Err error
+	// Code はリトライの対象となったベンダー固有のエラーコード (WithErrorCodes)
+	Code string
+}
+
+func (r RetryReason) String() string {
+	switch {
+	case r.Err != nil:
+		return r.Err.Error()
+	case r.Code != "":
+		return fmt.Sprintf("status %d (%s)", r.StatusCode, r.Code)
+	default:
+		return fmt.Sprintf("status %d", r.StatusCode)
+	}
+}
+
+// WithOnRequest は各試行の送信前に呼び出すフックを追加する
+func WithOnRequest(hook RequestHook) Option {
+	return func(t *RetryableTransport) {
+		t.onRequest = append(t.onRequest, hook)
+	}
+}
+
+// WithOnResponse は各試行の送信後に呼び出すフックを追加する
+func WithOnResponse(hook ResponseHook) Option {
+	return func(t *RetryableTransport) {
+		t.onResponse = append(t.onResponse, hook)
+	}
+}
+
+// WithOnRetry はリトライ前に呼び出すフックを追加する
+func WithOnRetry(hook RetryHook) Option {
+	return func(t *RetryableTransport) {
+		t.onRetry = append(t.onRetry, hook)
+	}
+}
+
+// beforeAttempt は送信前のフックを呼び出し、送信するリクエストを返却する
+func (t *RetryableTransport) beforeAttempt(attempt int, req *http.Request) *http.Request {
+	if len(t.onRequest) == 0 {
+		return req
+	}
+	// NOTE: RoundTripper は呼び出し元のリクエストを変更してはならないため、複製してからフックに渡す
+	req = req.Clone(req.Context())
+	for _, hook := range t.onRequest {
+		hook(attempt, req)
+	}
+	return req
+}
+
+// afterAttempt は送信後のフックを呼び出す
+func (t *RetryableTransport) afterAttempt(attempt int, res *http.Response, err error) {
+	for _, hook := range t.onResponse {
+		hook(attempt, res, err)
+	}
+}
+
+// beforeRetry はリトライ前のフックを呼び出す
+func (t *RetryableTransport) beforeRetry(attempt int, wait time.Duration, res *http.Response, err error, vendorErr *VendorError) {
+	if len(t.onRetry) == 0 {
+		return
+	}
+	reason := RetryReason{Err: err}
+	if res != nil {
+		reason.StatusCode = res.StatusCode
+	}
+	if vendorErr != nil {
+		reason.Code = vendorErr.Code
+	}
+	for _, hook := range t.onRetry {
+		hook(attempt, wait, reason)
+	}
+}
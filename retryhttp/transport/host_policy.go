@@ -0,0 +1,30 @@
+package transport
+
+import (
+	"net/http"
+)
+
+// WithHostPolicy は、リクエスト先のホストが host の場合に適用するリトライポリシーを設定する
+// host は "api.example.com" または "api.example.com:8443" の形式。ポートを含む設定をポートを含まない設定より優先する
+// NOTE: 1 つの Client を共有したまま、社内のサービスには積極的にリトライし、外部の API には控えめにリトライする (または NoRetry でリトライしない) ために使用する
+// ホストは試行ごとの送信先ではなく、リクエストの URL のホストで判定する。WithRetryPolicy で context.Context に格納したリトライポリシーを優先する
+func WithHostPolicy(host string, policy RetryPolicy) Option {
+	return func(t *RetryableTransport) {
+		if t.hostPolicies == nil {
+			t.hostPolicies = make(map[string]RetryPolicy)
+		}
+		t.hostPolicies[host] = policy
+	}
+}
+
+// hostPolicy は、リクエスト先のホストに設定されたリトライポリシーを返却する
+func (t *RetryableTransport) hostPolicy(req *http.Request) (RetryPolicy, bool) {
+	if len(t.hostPolicies) == 0 {
+		return RetryPolicy{}, false
+	}
+	if policy, ok := t.hostPolicies[req.URL.Host]; ok {
+		return policy, true
+	}
+	policy, ok := t.hostPolicies[req.URL.Hostname()]
+	return policy, ok
+}
@@ -0,0 +1,143 @@
+package transport
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTP2FallbackConfig は HTTP2FallbackTransport の設定。ゼロ値の項目はデフォルト値を使用する
+type HTTP2FallbackConfig struct {
+	// Threshold は HTTP/1.1 に切り替える、Window 内の HTTP/2 固有のエラーの回数。デフォルトは 3
+	Threshold int
+	// Window はエラーを集計する期間。デフォルトは 1 分
+	Window time.Duration
+	// Cooldown は HTTP/1.1 で送信する期間。期間の終了後は再び HTTP/2 を試す。デフォルトは 5 分
+	Cooldown time.Duration
+	// OnDowngrade はホストを HTTP/1.1 に切り替えた時に呼び出される関数。メトリクスの集計に使用する
+	OnDowngrade func(host string, until time.Time)
+}
+
+// HTTP2FallbackTransport は、HTTP/2 固有のエラーが続くホストに対して、一定期間 HTTP/1.1 で送信するための http.RoundTripper 具象型
+// NOTE: 壊れた HTTP/2 のネゴシエーションにリトライし続けないように、RetryableTransport の内側 (親の Transport) に配置する
+type HTTP2FallbackTransport struct {
+	h2     *http.Transport
+	h1     *http.Transport
+	config HTTP2FallbackConfig
+	now    func() time.Time
+
+	mu    sync.Mutex
+	hosts map[string]*http2HostState
+}
+
+// http2HostState はホストごとの HTTP/2 のエラーの状態
+type http2HostState struct {
+	windowStart time.Time
+	failures    int
+	until       time.Time
+}
+
+// NewHTTP2FallbackTransport は HTTP2FallbackTransport 構造体を作成する。transport が nil の場合は http.DefaultTransport を複製して使用する
+// HTTP/1.1 で送信するための Transport は transport の設定を複製し、HTTP/2 を無効にして作成する
+func NewHTTP2FallbackTransport(transport *http.Transport, config HTTP2FallbackConfig) *HTTP2FallbackTransport {
+	if transport == nil {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	if config.Threshold <= 0 {
+		config.Threshold = 3
+	}
+	if config.Window <= 0 {
+		config.Window = time.Minute
+	}
+	if config.Cooldown <= 0 {
+		config.Cooldown = 5 * time.Minute
+	}
+
+	h1 := transport.Clone()
+	h1.ForceAttemptHTTP2 = false
+	// NOTE: 空の TLSNextProto を設定すると、HTTP/2 へのアップグレードが無効になる
+	h1.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	if h1.TLSClientConfig != nil {
+		h1.TLSClientConfig.NextProtos = []string{"http/1.1"}
+	}
+
+	return &HTTP2FallbackTransport{
+		h2:     transport,
+		h1:     h1,
+		config: config,
+		now:    time.Now,
+		hosts:  make(map[string]*http2HostState),
+	}
+}
+
+// RoundTrip は、ホストが HTTP/1.1 に切り替えられている期間は HTTP/1.1 で、それ以外は HTTP/2 で送信する
+func (t *HTTP2FallbackTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	if t.Downgraded(host) {
+		return t.h1.RoundTrip(req)
+	}
+
+	res, err := t.h2.RoundTrip(req)
+	if err != nil && isHTTP2Error(err) {
+		t.recordFailure(host)
+	}
+	return res, err
+}
+
+// Downgraded はホストが HTTP/1.1 に切り替えられている期間中か判定する
+func (t *HTTP2FallbackTransport) Downgraded(host string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, ok := t.hosts[host]
+	return ok && t.now().Before(state.until)
+}
+
+// CloseIdleConnections は HTTP/2 と HTTP/1.1 の両方のアイドル状態のコネクションをクローズする
+func (t *HTTP2FallbackTransport) CloseIdleConnections() {
+	t.h2.CloseIdleConnections()
+	t.h1.CloseIdleConnections()
+}
+
+// recordFailure は HTTP/2 固有のエラーを集計し、閾値を超えた場合は HTTP/1.1 に切り替える
+func (t *HTTP2FallbackTransport) recordFailure(host string) {
+	t.mu.Lock()
+	now := t.now()
+	state, ok := t.hosts[host]
+	if !ok {
+		state = &http2HostState{windowStart: now}
+		t.hosts[host] = state
+	}
+	if now.Sub(state.windowStart) >= t.config.Window {
+		state.windowStart, state.failures = now, 0
+	}
+	state.failures++
+	if state.failures < t.config.Threshold {
+		t.mu.Unlock()
+		return
+	}
+	state.windowStart, state.failures = now, 0
+	state.until = now.Add(t.config.Cooldown)
+	until := state.until
+	t.mu.Unlock()
+
+	if t.config.OnDowngrade != nil {
+		t.config.OnDowngrade(host, until)
+	}
+}
+
+// isHTTP2Error は HTTP/2 固有のエラー (ストリームのリセット、GOAWAY、プロトコルエラーなど) か判定する
+// NOTE: net/http に同梱されている HTTP/2 の実装のエラー型は公開されていないため、エラーメッセージで判定する
+func isHTTP2Error(err error) bool {
+	for err != nil {
+		msg := err.Error()
+		if strings.HasPrefix(msg, "http2:") || strings.Contains(msg, "stream error:") || strings.Contains(msg, "GOAWAY") {
+			return true
+		}
+		err = errors.Unwrap(err)
+	}
+	return false
+}
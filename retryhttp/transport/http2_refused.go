@@ -0,0 +1,67 @@
+package transport
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// WithoutHTTP2RefusedRetry は、HTTP/2 の GOAWAY や REFUSED_STREAM で拒否された場合に、バックオフせずに即座にリトライする動作を無効にする
+// NOTE: 無効にした場合も、CheckRetryFunc がリトライすると判定すれば、他の送信エラーと同様にバックオフしてリトライする
+func WithoutHTTP2RefusedRetry() Option {
+	return func(t *RetryableTransport) {
+		t.noHTTP2RefusedRetry = true
+	}
+}
+
+// WithHTTP2RefusedIsolation は、HTTP/2 の GOAWAY や REFUSED_STREAM で拒否された次の試行を、既存のコネクションを再利用せずに送信する
+// NOTE: GOAWAY を送信したコネクションはクローズ処理中のため、同じコネクションプールの別のコネクションも同じサーバーの停止中である可能性がある
+func WithHTTP2RefusedIsolation() Option {
+	return func(t *RetryableTransport) {
+		t.http2RefusedIsolation = true
+	}
+}
+
+// shouldRetryHTTP2Refused は、バックオフせずに即座にリトライすべき、HTTP/2 のサーバーが拒否したストリームか判定する
+// NOTE: REFUSED_STREAM と、最後に処理するストリームより後のストリームへの GOAWAY は、サーバーがリクエストを処理していないことを表すため、
+// 冪等でないリクエストもリトライする。コネクションのクローズを伴う GOAWAY は処理済みの可能性があるため、冪等なリクエストのみリトライする
+func (t *RetryableTransport) shouldRetryHTTP2Refused(req *http.Request, err error) bool {
+	if t.noHTTP2RefusedRetry || err == nil || !canRewind(req) || isResponseValidationError(err) {
+		return false
+	}
+	switch {
+	case isHTTP2Unprocessed(err):
+		return true
+	case isHTTP2GoAway(err):
+		return t.retryNonIdempotent || isIdempotent(req)
+	}
+	return false
+}
+
+// isHTTP2Unprocessed は、サーバーが処理していないストリームのエラー (REFUSED_STREAM、処理しないストリームへの GOAWAY) か判定する
+// NOTE: isHTTP2Error と同様に、net/http に同梱されている HTTP/2 の実装のエラー型は公開されていないため、エラーメッセージで判定する
+// golang.org/x/net/http2 の http2.StreamError も同じメッセージのため、同様に判定できる
+func isHTTP2Unprocessed(err error) bool {
+	for err != nil {
+		msg := err.Error()
+		if strings.Contains(msg, "stream error:") && strings.Contains(msg, "REFUSED_STREAM") {
+			return true
+		}
+		if strings.Contains(msg, "graceful shutdown GOAWAY") {
+			return true
+		}
+		err = errors.Unwrap(err)
+	}
+	return false
+}
+
+// isHTTP2GoAway は、サーバーが GOAWAY を送信してコネクションをクローズした場合のエラー (http2.GoAwayError) か判定する
+func isHTTP2GoAway(err error) bool {
+	for err != nil {
+		if strings.Contains(err.Error(), "server sent GOAWAY") {
+			return true
+		}
+		err = errors.Unwrap(err)
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package transport
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+// HeaderIdempotencyKey は、サーバーがリクエストの重複を排除するための冪等キーのヘッダー
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+// WithIdempotencyKey は、冪等でないリクエスト (POST, PATCH など) に Idempotency-Key ヘッダーがない場合に、最初の試行の前に冪等キーを生成して付与する
+// すべてのリトライで同じキーを送信するため、冪等キーに対応したサーバーでは重複が排除される。generate が nil の場合は UUID (バージョン 4) を生成する
+// NOTE: Idempotency-Key ヘッダーを付与したリクエストは冪等とみなされ、WithRetryNonIdempotent を指定しなくてもリトライされる
+func WithIdempotencyKey(generate func() string) Option {
+	if generate == nil {
+		generate = newUUID
+	}
+	return func(t *RetryableTransport) {
+		t.idempotencyKey = generate
+	}
+}
+
+// withIdempotencyKey は、WithIdempotencyKey が指定されている場合に、冪等キーを付与したリクエストを返却する
+// NOTE: 呼び出し元のリクエストを変更しないように、複製してから付与する
+func (t *RetryableTransport) withIdempotencyKey(req *http.Request) *http.Request {
+	if t.idempotencyKey == nil || isIdempotent(req) {
+		return req
+	}
+	keyed := req.Clone(req.Context())
+	keyed.Header.Set(HeaderIdempotencyKey, t.idempotencyKey())
+	return keyed
+}
+
+// newUUID は UUID (バージョン 4) を生成する
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,177 @@
+package transport
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+)
+
+// LogEvent は RetryableTransport が出力するログの種類
+type LogEvent int
+
+const (
+	// LogEventRequestStart は各試行のリクエスト送信開始時のログ
+	LogEventRequestStart LogEvent = iota
+	// LogEventRequestEnd は各試行のリクエスト送信終了時のログ
+	LogEventRequestEnd
+	// LogEventBackoff はリトライ前のバックオフのログ
+	LogEventBackoff
+	// LogEventBudgetExhausted はリトライの予算を使い切ったためリトライしなかった時のログ
+	LogEventBudgetExhausted
+	// LogEventConnectionAbandoned はリトライ前にレスポンスボディを読み切れず、コネクションを破棄した時のログ
+	LogEventConnectionAbandoned
+	// LogEventHedge はヘッジリクエストを送信した時のログ
+	LogEventHedge
+	// LogEventStaleConnection は、再利用したコネクションがサーバーにクローズされていたため、新しいコネクションでリトライした時のログ
+	LogEventStaleConnection
+	// LogEventRangeResume は、レスポンスボディの読み込み中に失敗したため、Range ヘッダーで続きから取得し直した時のログ
+	LogEventRangeResume
+	// LogEventDump は WithAttemptDump を指定した場合の、各試行のリクエストとレスポンスの内容のログ
+	LogEventDump
+	// LogEventTrace は、各試行の名前解決、接続、TLS のハンドシェイク、最初のバイトの受信などのイベントのログ
+	LogEventTrace
+	// LogEventHTTP2Refused は、HTTP/2 のサーバーが GOAWAY や REFUSED_STREAM でストリームを拒否したため、即座にリトライした時のログ
+	LogEventHTTP2Refused
+)
+
+// defaultLogLevels はログの種類ごとのデフォルトのログレベル
+var defaultLogLevels = map[LogEvent]slog.Level{
+	LogEventRequestStart:        slog.LevelDebug,
+	LogEventRequestEnd:          slog.LevelDebug,
+	LogEventBackoff:             slog.LevelInfo,
+	LogEventBudgetExhausted:     slog.LevelWarn,
+	LogEventConnectionAbandoned: slog.LevelDebug,
+	LogEventHedge:               slog.LevelDebug,
+	LogEventStaleConnection:     slog.LevelDebug,
+	LogEventRangeResume:         slog.LevelInfo,
+	LogEventDump:                slog.LevelDebug,
+	LogEventTrace:               slog.LevelDebug,
+	LogEventHTTP2Refused:        slog.LevelDebug,
+}
+
+// WithLogLevel は、指定した種類のログのログレベルを変更する
+func WithLogLevel(event LogEvent, level slog.Level) Option {
+	return func(t *RetryableTransport) {
+		if t.logLevels == nil {
+			t.logLevels = make(map[LogEvent]slog.Level, len(defaultLogLevels))
+			for e, l := range defaultLogLevels {
+				t.logLevels[e] = l
+			}
+		}
+		t.logLevels[event] = level
+	}
+}
+
+// WithAttemptLogLevel は、各試行の送信開始と終了のログのログレベルを変更する
+func WithAttemptLogLevel(level slog.Level) Option {
+	return func(t *RetryableTransport) {
+		WithLogLevel(LogEventRequestStart, level)(t)
+		WithLogLevel(LogEventRequestEnd, level)(t)
+	}
+}
+
+// WithLogger は、ログを出力する *slog.Logger を設定する。設定しない場合は slog.Default() を使用する
+func WithLogger(logger *slog.Logger) Option {
+	return func(t *RetryableTransport) {
+		t.logger = logger
+	}
+}
+
+// WithoutLogging は RetryableTransport のログ出力をすべて無効にする
+func WithoutLogging() Option {
+	return func(t *RetryableTransport) {
+		t.silent = true
+	}
+}
+
+// log はログの種類に応じたログレベルでログを出力する
+// NOTE: 引数の作成でメモリを割り当てないように、頻繁に出力するログは logEnabled で確認してから呼び出す
+func (t *RetryableTransport) log(ctx context.Context, event LogEvent, msg string, args ...any) {
+	logger, level, ok := t.logLevel(ctx, event)
+	if !ok {
+		return
+	}
+	logger.Log(ctx, level, msg, args...)
+}
+
+// logEnabled は、ログの種類に応じたログレベルのログが出力されるか判定する
+func (t *RetryableTransport) logEnabled(ctx context.Context, event LogEvent) bool {
+	_, _, ok := t.logLevel(ctx, event)
+	return ok
+}
+
+// logLevel は、ログを出力する *slog.Logger とログの種類に応じたログレベルを返却する。ログを出力しない場合は false を返却する
+func (t *RetryableTransport) logLevel(ctx context.Context, event LogEvent) (*slog.Logger, slog.Level, bool) {
+	if t.silent {
+		return nil, 0, false
+	}
+	levels := t.logLevels
+	if levels == nil {
+		levels = defaultLogLevels
+	}
+	logger := t.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	level := levels[event]
+	return logger, level, logger.Enabled(ctx, level)
+}
+
+// highestLogLevel は、ログの種類ごとのログレベルのうち最も高いログレベルを返却する
+// NOTE: *slog.Logger がこのログレベルのログを出力しない場合は、いずれの種類のログも出力しない
+func (t *RetryableTransport) highestLogLevel() slog.Level {
+	levels := t.logLevels
+	if levels == nil {
+		levels = defaultLogLevels
+	}
+	highest := slog.Level(math.MinInt)
+	for _, level := range levels {
+		highest = max(highest, level)
+	}
+	return highest
+}
+
+// requestLogArgs は、すべてのログに付与するリクエストの情報とアノテーション
+// NOTE: ログを出力しない場合にメモリを割り当てないように、最初にログを出力する時に作成する
+type requestLogArgs struct {
+	req  *http.Request
+	args []any
+}
+
+// newRequestLogArgs は、いずれかの種類のログを出力する場合に requestLogArgs 構造体を作成する。ログを出力しない場合は nil を返却する
+// NOTE: ログを無効にしている場合に、リクエストごとにメモリを割り当てないようにする
+func (t *RetryableTransport) newRequestLogArgs(ctx context.Context, req *http.Request) *requestLogArgs {
+	if t.silent {
+		return nil
+	}
+	logger := t.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if !logger.Enabled(ctx, t.maxLogLevel) {
+		return nil
+	}
+	return &requestLogArgs{req: req}
+}
+
+// with は、args の後ろにリクエストの情報とアノテーションを追加したログの引数を返却する
+// l が nil の場合はログを出力しないため、args をそのまま返却する
+func (l *requestLogArgs) with(args ...any) []any {
+	if l == nil {
+		return args
+	}
+	if l.args == nil {
+		l.args = append([]any{"method", l.req.Method, "host", l.req.URL.Host}, AnnotationsFromContext(l.req.Context()).logArgs()...)
+	}
+	return append(append(make([]any, 0, len(args)+len(l.args)), args...), l.args...)
+}
+
+// attemptResultArgs は試行の結果をログの属性として返却する
+func attemptResultArgs(attempt int, res *http.Response, err error) []any {
+	args := []any{"attempt", attempt}
+	if err != nil {
+		return append(args, "error", err)
+	}
+	return append(args, "status", res.StatusCode)
+}
@@ -0,0 +1,73 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// okTransport は、同じ 200 のレスポンスを返却する http.RoundTripper
+var okTransport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+})
+
+// roundTripAllocs は、1 回目で成功するリクエストの RoundTrip あたりのメモリの割り当て回数を返却する
+func roundTripAllocs(t *testing.T, opts ...Option) float64 {
+	t.Helper()
+
+	rt := NewRetryableTransport(okTransport, 3, func(*http.Response, error) bool { return false }, Constant(0), opts...)
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	return testing.AllocsPerRun(100, func() {
+		res, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	})
+}
+
+// TestRoundTripAllocsWithoutLogging は、ログを出力しない場合にログの引数を作成しないことを検証する
+func TestRoundTripAllocsWithoutLogging(t *testing.T) {
+	discard := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	silent := roundTripAllocs(t, WithoutLogging())
+	t.Logf("allocs per RoundTrip = %v", silent)
+	if disabled := roundTripAllocs(t, WithLogger(discard)); disabled != silent {
+		t.Errorf("allocs with a disabled logger = %v, want %v as with WithoutLogging", disabled, silent)
+	}
+	// NOTE: 1 回の試行で成功するリクエストの割り当て回数。増えた場合はホットパスで割り当てを追加していないか確認する
+	const maxAllocs = 19
+	if silent > maxAllocs {
+		t.Errorf("allocs per RoundTrip = %v, want at most %d", silent, maxAllocs)
+	}
+}
+
+func TestRequestLogArgs(t *testing.T) {
+	var out strings.Builder
+	logger := slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+
+	// すべての種類のログのログレベルがロガーのログレベルより低い場合は作成しない
+	rt := NewRetryableTransport(okTransport, 1, nil, nil, WithLogger(logger), WithLogLevel(LogEventBudgetExhausted, slog.LevelInfo))
+	if l := rt.newRequestLogArgs(context.Background(), req); l != nil {
+		t.Errorf("newRequestLogArgs = %v, want nil when no log event is enabled", l)
+	}
+	var nilArgs *requestLogArgs
+	if got := nilArgs.with("attempt", 1); len(got) != 2 {
+		t.Errorf("with on nil = %v, want the arguments as is", got)
+	}
+
+	// LogEventBudgetExhausted のデフォルトのログレベルは Warn
+	rt = NewRetryableTransport(okTransport, 1, nil, nil, WithLogger(logger))
+	l := rt.newRequestLogArgs(context.Background(), req)
+	if l == nil {
+		t.Fatal("newRequestLogArgs = nil, want log arguments when a log event is enabled")
+	}
+	logger.Warn("retry budget exhausted", l.with("attempt", 1)...)
+	if got := out.String(); !strings.Contains(got, "attempt=1 method=GET host=example.com") {
+		t.Errorf("log = %q, want the request information", got)
+	}
+}
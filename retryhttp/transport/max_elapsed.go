@@ -0,0 +1,22 @@
+package transport
+
+import (
+	"time"
+)
+
+// WithMaxElapsedTime は、試行とバックオフを含むリクエスト全体の所要時間の上限を設定する。0 の場合は上限なし
+// 次のバックオフの後に上限を超える場合は、試行回数が上限に達していなくても最後の試行の結果を返却する
+// NOTE: バックオフの上限が大きい場合、試行回数だけではリクエスト全体の所要時間を見積もりにくいため使用する
+func WithMaxElapsedTime(d time.Duration) Option {
+	return func(t *RetryableTransport) {
+		t.maxElapsed = d
+	}
+}
+
+// exceedsMaxElapsed は、start から wait だけ待機した後に所要時間の上限を超えるか判定する
+func (t *RetryableTransport) exceedsMaxElapsed(start time.Time, wait time.Duration) bool {
+	if t.maxElapsed <= 0 {
+		return false
+	}
+	return t.clock().Now().Sub(start)+wait > t.maxElapsed
+}
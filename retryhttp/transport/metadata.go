@@ -0,0 +1,104 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"net/url"
+	"sync"
+)
+
+// metadataKey は context.Context に ResponseMetadata を格納するためのキー
+type metadataKey struct{}
+
+// ResponseMetadata は、RetryableTransport がレスポンスに付与するメタデータ
+// MetadataFromResponse でレスポンスから取得する
+type ResponseMetadata struct {
+	mu          sync.Mutex
+	earlyHints  []http.Header
+	alreadyDone bool
+	// possibleDuplicate は重複送信の可能性があるか
+	possibleDuplicate bool
+	// wroteRequest は現在の試行でリクエストの書き込みが完了したか
+	wroteRequest bool
+	// vendorError は現在の試行のレスポンスに含まれていたベンダー固有のエラーコード
+	vendorError *VendorError
+	// attempts は試行ごとの結果
+	attempts []AttemptResult
+	// exhausted はリトライが必要な結果のまま終了したか
+	exhausted bool
+	// host は HostSelector で選択した、最後の試行の送信先
+	host *url.URL
+	// reusedConnection は現在の試行でアイドル状態のコネクションを再利用したか
+	reusedConnection bool
+	// wroteHeaders は現在の試行でリクエストヘッダーを書き込んだか
+	wroteHeaders bool
+	// failedAddrs は AlternateAddrDial でダイヤルに失敗した IP アドレス。試行ごとに初期化しない
+	failedAddrs map[string]bool
+}
+
+// EarlyHints は、最後の試行で受信した 103 Early Hints のヘッダーを返却する
+// NOTE: 1xx のレスポンスは最終的なレスポンスではないため、リトライの判定には影響しない
+func (m *ResponseMetadata) EarlyHints() []http.Header {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hints := make([]http.Header, len(m.earlyHints))
+	copy(hints, m.earlyHints)
+	return hints
+}
+
+// MetadataFromResponse は、RetryableTransport が返却したレスポンスのメタデータを返却する
+// RetryableTransport を経由していないレスポンスの場合は nil を返却する
+func MetadataFromResponse(res *http.Response) *ResponseMetadata {
+	if res == nil || res.Request == nil {
+		return nil
+	}
+	m, _ := res.Request.Context().Value(metadataKey{}).(*ResponseMetadata)
+	return m
+}
+
+// withMetadata は、メタデータを格納し、1xx のレスポンスを受信するための httptrace.ClientTrace を設定した context.Context を返却する
+func withMetadata(ctx context.Context, m *ResponseMetadata) context.Context {
+	ctx = context.WithValue(ctx, metadataKey{}, m)
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			if code == http.StatusEarlyHints {
+				m.mu.Lock()
+				m.earlyHints = append(m.earlyHints, http.Header(header).Clone())
+				m.mu.Unlock()
+			}
+			return nil
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			m.mu.Lock()
+			m.reusedConnection = info.Reused
+			m.mu.Unlock()
+		},
+		WroteHeaders: func() {
+			m.mu.Lock()
+			m.wroteHeaders = true
+			m.mu.Unlock()
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			if info.Err == nil {
+				m.mu.Lock()
+				m.wroteRequest = true
+				m.mu.Unlock()
+			}
+		},
+	})
+}
+
+// resetAttempt は試行ごとのメタデータを初期化する
+func (m *ResponseMetadata) resetAttempt() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.earlyHints = nil
+	m.wroteRequest = false
+	m.vendorError = nil
+	m.reusedConnection = false
+	m.wroteHeaders = false
+}
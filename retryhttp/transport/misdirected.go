@@ -0,0 +1,38 @@
+package transport
+
+import (
+	"net/http"
+)
+
+// WithoutMisdirectedRetry は、421 Misdirected Request を受け取った場合に新しいコネクションで即座にリトライする動作を無効にする
+func WithoutMisdirectedRetry() Option {
+	return func(t *RetryableTransport) {
+		t.noMisdirectedRetry = true
+	}
+}
+
+// shouldRetryMisdirected は、新しいコネクションでリトライすべき 421 Misdirected Request か判定する
+// NOTE: 421 は HTTP/2 のコネクションの再利用 (コアレッシング) で、証明書は一致するが別のサーバーに送信した場合に返却される
+// サーバーはリクエストを処理していないため、冪等でないリクエストでもバックオフせずにリトライする
+// リクエストボディを巻き戻せない場合は、リトライせずに 421 のレスポンスを返却する
+func (t *RetryableTransport) shouldRetryMisdirected(req *http.Request, res *http.Response, err error, retried bool) bool {
+	if t.noMisdirectedRetry || retried || err != nil || !canRewind(req) {
+		return false
+	}
+	return res.StatusCode == http.StatusMisdirectedRequest
+}
+
+// isolatedTransport は、既存のコネクションを再利用しない base の Transport を返却する
+// base が *http.Transport の場合は、コネクションプールを共有しない複製を使用し、試行の後にコネクションをクローズする
+// NOTE: base が *http.Transport 以外の場合は複製できないため、アイドル状態のコネクションをクローズしてから base を使用する
+func isolatedTransport(base http.RoundTripper) http.RoundTripper {
+	if ht, ok := base.(*http.Transport); ok {
+		isolated := ht.Clone()
+		isolated.DisableKeepAlives = true
+		return isolated
+	}
+	if closer, ok := base.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+	return base
+}
@@ -0,0 +1,74 @@
+package transport_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mtnori/httpRetryExample/retryhttp/retrytest"
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+func TestMisdirectedRetry(t *testing.T) {
+	tests := []struct {
+		name string
+		// body はリクエストボディ。WithMaxBodyBuffer の上限 (4 バイト) を超えるボディは巻き戻せない
+		body         string
+		steps        []retrytest.Step
+		wantStatus   int
+		wantAttempts int
+	}{
+		{
+			name:         "rewindable body is retried on a new connection",
+			body:         "ok",
+			steps:        []retrytest.Step{retrytest.Status(421), retrytest.Status(200)},
+			wantStatus:   200,
+			wantAttempts: 2,
+		},
+		{
+			name:         "retried only once",
+			body:         "ok",
+			steps:        []retrytest.Step{retrytest.Status(421), retrytest.Status(421)},
+			wantStatus:   421,
+			wantAttempts: 2,
+		},
+		{
+			name:         "body over the buffer limit returns the 421 response",
+			body:         "too large to buffer",
+			steps:        []retrytest.Step{retrytest.Status(421)},
+			wantStatus:   421,
+			wantAttempts: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := retrytest.NewFakeClock(testStart)
+			server := retrytest.NewScriptedTransport(t, clock, tt.steps...)
+			transport := retryabletransport.NewRetryableTransport(server, 3,
+				func(*http.Response, error) bool { return false }, linearBackoff,
+				retryabletransport.WithClock(clock), retryabletransport.WithoutLogging(), retryabletransport.WithMaxBodyBuffer(4))
+
+			// NOTE: GetBody を設定しないように、http.NewRequest が認識しない io.Reader を使用する
+			req, _ := http.NewRequest(http.MethodPost, "http://example.com/", io.NopCloser(strings.NewReader(tt.body)))
+			res, err := transport.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("RoundTrip: %v", err)
+			}
+			res.Body.Close()
+
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", res.StatusCode, tt.wantStatus)
+			}
+			attempts := server.Attempts()
+			if len(attempts) != tt.wantAttempts {
+				t.Fatalf("attempts = %d, want %d", len(attempts), tt.wantAttempts)
+			}
+			for i, attempt := range attempts {
+				if string(attempt.Body) != tt.body {
+					t.Errorf("attempt %d body = %q, want %q", i+1, attempt.Body, tt.body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package transport
+
+import (
+	"net/http"
+	"strings"
+)
+
+// HeaderNoRetry は、サーバーがリトライしないように指示するヘッダー
+const HeaderNoRetry = "X-No-Retry"
+
+// NoRetrySignals は、レスポンスに含まれていればリトライの判定に関わらずリトライしない、サーバーからの指示
+type NoRetrySignals struct {
+	// Headers はヘッダーの名前と、リトライしないことを表す値。値は大文字と小文字を区別しない。値が空の場合は、ヘッダーがあればリトライしない
+	// 例: {"X-No-Retry": {"true", "1"}, "Retry-After": {"never"}}
+	Headers map[string][]string
+	// StatusCodes はリトライしないステータスコード
+	StatusCodes []int
+}
+
+// DefaultNoRetrySignals は、サーバーからのリトライしない指示のデフォルト
+// NOTE: 413 Content Too Large、501 Not Implemented、505 HTTP Version Not Supported は、同じリクエストを送信し直しても成功しない
+var DefaultNoRetrySignals = NoRetrySignals{
+	Headers:     map[string][]string{HeaderNoRetry: {"true", "1"}},
+	StatusCodes: []int{http.StatusRequestEntityTooLarge, http.StatusNotImplemented, http.StatusHTTPVersionNotSupported},
+}
+
+// WithNoRetrySignals は、レスポンスに含まれていればリトライしない、サーバーからの指示を設定する。デフォルトは DefaultNoRetrySignals
+// NOTE: CheckRetryFunc、WithErrorCodes、WithRetryPolicy でリトライすると判定した場合も、サーバーの指示を優先する
+// ゼロ値の NoRetrySignals を指定した場合は、サーバーの指示を無視する
+func WithNoRetrySignals(signals NoRetrySignals) Option {
+	return func(t *RetryableTransport) {
+		t.noRetrySignals = compileNoRetrySignals(signals)
+	}
+}
+
+// noRetrySignals は、判定しやすいように変換した NoRetrySignals
+type noRetrySignals struct {
+	// headers は正規化したヘッダーの名前と、小文字にしたリトライしないことを表す値
+	headers  map[string][]string
+	statuses map[int]bool
+}
+
+// defaultNoRetrySignals は DefaultNoRetrySignals を変換した値
+var defaultNoRetrySignals = compileNoRetrySignals(DefaultNoRetrySignals)
+
+// compileNoRetrySignals は NoRetrySignals を判定しやすいように変換する
+func compileNoRetrySignals(signals NoRetrySignals) *noRetrySignals {
+	compiled := &noRetrySignals{
+		headers:  make(map[string][]string, len(signals.Headers)),
+		statuses: make(map[int]bool, len(signals.StatusCodes)),
+	}
+	for name, values := range signals.Headers {
+		lowered := make([]string, 0, len(values))
+		for _, value := range values {
+			lowered = append(lowered, strings.ToLower(strings.TrimSpace(value)))
+		}
+		compiled.headers[http.CanonicalHeaderKey(name)] = lowered
+	}
+	for _, code := range signals.StatusCodes {
+		compiled.statuses[code] = true
+	}
+	return compiled
+}
+
+// noRetrySignaled は、レスポンスにサーバーからのリトライしない指示が含まれているか判定する
+func (t *RetryableTransport) noRetrySignaled(res *http.Response) bool {
+	if res == nil {
+		return false
+	}
+	signals := t.noRetrySignals
+	if signals == nil {
+		signals = defaultNoRetrySignals
+	}
+
+	if signals.statuses[res.StatusCode] {
+		return true
+	}
+	for name, values := range signals.headers {
+		actual, ok := res.Header[name]
+		if !ok {
+			continue
+		}
+		if len(values) == 0 {
+			return true
+		}
+		for _, value := range actual {
+			for _, signal := range values {
+				if strings.EqualFold(strings.TrimSpace(value), signal) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+// Peek は、レスポンスボディの先頭 n バイトを読み込んで返却する
+// res.Body は読み込んだ先頭を含めて最初から読み込めるボディに置き換えるため、呼び出し元はボディ全体を続けて読み込める
+// ボディが n バイトより短い場合はボディ全体を返却する
+// NOTE: Content-Type の判定やエラーレスポンスの検出に使用する。同じレスポンスに複数回呼び出した場合は、読み込み済みの先頭を再利用する
+func Peek(res *http.Response, n int) ([]byte, error) {
+	if res == nil || res.Body == nil || res.Body == http.NoBody || n <= 0 {
+		return nil, nil
+	}
+
+	body, ok := res.Body.(*peekedBody)
+	if !ok {
+		body = &peekedBody{rest: res.Body, closer: res.Body}
+		res.Body = body
+	}
+	if len(body.head)-body.offset >= n {
+		return body.head[body.offset : body.offset+n], nil
+	}
+	// NOTE: 先頭を読み込んだ後に呼び出し元が一部を読み込んでいる場合は、未読の部分から n バイトを返却する
+	if body.offset > 0 {
+		body.head = body.head[body.offset:]
+		body.offset = 0
+	}
+
+	buf := make([]byte, n-len(body.head))
+	read, err := io.ReadFull(body.rest, buf)
+	body.head = append(body.head, buf[:read]...)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil
+	}
+	return body.head, err
+}
+
+// peekedBody は、先頭を読み込んだレスポンスボディを復元した io.ReadCloser 具象型
+type peekedBody struct {
+	// head は Peek で読み込んだ先頭。offset までは呼び出し元が読み込み済み
+	head   []byte
+	offset int
+	rest   io.Reader
+	closer io.Closer
+}
+
+func (b *peekedBody) Read(p []byte) (int, error) {
+	if b.offset < len(b.head) {
+		n := copy(p, b.head[b.offset:])
+		b.offset += n
+		return n, nil
+	}
+	return b.rest.Read(p)
+}
+
+func (b *peekedBody) Close() error {
+	return b.closer.Close()
+}
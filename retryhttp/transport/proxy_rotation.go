@@ -0,0 +1,96 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+)
+
+// attemptProxyKey は context.Context に試行の送信に使用するプロキシを格納するためのキー
+type attemptProxyKey struct{}
+
+// WithProxyRotation は、試行ごとに proxies のプロキシを順に切り替えて送信する
+// リクエストごとに開始するプロキシをずらし、リトライでは前の試行と異なるプロキシを使用する
+// 親の Transport が *http.Transport の場合は、プロキシごとに Proxy を設定した複製を使用する
+// それ以外の場合は、最も内側の *http.Transport の Proxy に AttemptProxy を設定すると、試行のプロキシで送信する
+// NOTE: 送信元のプロキシ (egress の経路) が劣化しているか送信先にブロックされている場合、同じ経路でリトライしても成功しない
+func WithProxyRotation(proxies []*url.URL) Option {
+	return func(t *RetryableTransport) {
+		t.proxyRotation = nil
+		if len(proxies) == 0 {
+			return
+		}
+		r := &proxyRotation{proxies: append([]*url.URL(nil), proxies...)}
+		if base, ok := t.transport().(*http.Transport); ok {
+			r.transports = make([]*http.Transport, len(proxies))
+			for i, proxy := range r.proxies {
+				r.transports[i] = base.Clone()
+				r.transports[i].Proxy = http.ProxyURL(proxy)
+			}
+		}
+		t.proxyRotation = r
+	}
+}
+
+// AttemptProxyFromContext は、WithProxyRotation で選択した試行のプロキシを返却する
+func AttemptProxyFromContext(ctx context.Context) (*url.URL, bool) {
+	proxy, ok := ctx.Value(attemptProxyKey{}).(*url.URL)
+	return proxy, ok
+}
+
+// AttemptProxy は、WithProxyRotation で選択した試行のプロキシを返却し、選択していない場合は fallback を使用する
+// http.Transport の Proxy として使用する関数を返却する。fallback が nil の場合はプロキシを使用しない
+// 例: base.Proxy = AttemptProxy(http.ProxyFromEnvironment)
+func AttemptProxy(fallback func(*http.Request) (*url.URL, error)) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		if proxy, ok := AttemptProxyFromContext(req.Context()); ok {
+			return proxy, nil
+		}
+		if fallback == nil {
+			return nil, nil
+		}
+		return fallback(req)
+	}
+}
+
+// proxyRotation は、WithProxyRotation で設定したプロキシと、プロキシごとの親の Transport の複製
+type proxyRotation struct {
+	proxies []*url.URL
+	// next は次のリクエストで最初に使用するプロキシの位置
+	next atomic.Uint64
+	// transports はプロキシごとの親の Transport の複製。親の Transport が *http.Transport でない場合は nil
+	transports []*http.Transport
+}
+
+// startProxyRotation は、リクエストの最初の試行で使用するプロキシの位置を返却する
+func (t *RetryableTransport) startProxyRotation() int {
+	if t.proxyRotation == nil {
+		return 0
+	}
+	return int((t.proxyRotation.next.Add(1) - 1) % uint64(len(t.proxyRotation.proxies)))
+}
+
+// proxyTransport は、WithProxyRotation が設定されている場合に、試行のプロキシを格納したリクエストと、そのプロキシで送信する Transport を返却する
+func (t *RetryableTransport) proxyTransport(req *http.Request, start int, attempts int) (*http.Request, http.RoundTripper) {
+	r := t.proxyRotation
+	if r == nil {
+		return req, t.transport()
+	}
+	i := (start + attempts - 1) % len(r.proxies)
+	req = req.WithContext(context.WithValue(req.Context(), attemptProxyKey{}, r.proxies[i]))
+	if r.transports == nil {
+		return req, t.transport()
+	}
+	return req, r.transports[i]
+}
+
+// closeProxyTransports は、WithProxyRotation で作成した親の Transport の複製のアイドル状態のコネクションをクローズする
+func (t *RetryableTransport) closeProxyTransports() {
+	if t.proxyRotation == nil {
+		return
+	}
+	for _, transport := range t.proxyRotation.transports {
+		transport.CloseIdleConnections()
+	}
+}
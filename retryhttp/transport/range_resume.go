@@ -0,0 +1,165 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// WithRangeResume は、GET のレスポンスボディの読み込み中に接続が切れた場合に、Range ヘッダーで続きから取得し直す
+// NOTE: 大きなファイルのダウンロードで、読み込み済みの部分を再送させずにリトライするために使用する
+// 再開は RetryPolicy.MaxAttempts のリトライ回数まで行い、再開のリクエスト自体も通常と同様にリトライする
+func WithRangeResume() Option {
+	return func(t *RetryableTransport) {
+		t.rangeResume = true
+	}
+}
+
+// RangeResumeError は、Range ヘッダーでレスポンスボディの続きを取得できなかったことを表すエラー
+// Err は読み込みを中断した元のエラー
+type RangeResumeError struct {
+	// Offset は読み込み済みのバイト数
+	Offset int64
+	Reason string
+	Err    error
+}
+
+func (e *RangeResumeError) Error() string {
+	return fmt.Sprintf("range resume at %d failed: %s: %v", e.Offset, e.Reason, e.Err)
+}
+
+func (e *RangeResumeError) Unwrap() error {
+	return e.Err
+}
+
+// withRangeResume は、再開できるレスポンスのボディを、読み込みに失敗した時点から取得し直すボディに置き換える
+// NOTE: 再開後に同じリソースであることを確認するため、強い ETag または Last-Modified ヘッダーがあるレスポンスのみを対象とする
+// net/http が gzip を展開したボディは、読み込み済みのバイト数が圧縮後の位置と一致しないため対象としない
+func (t *RetryableTransport) withRangeResume(req *http.Request, res *http.Response, policy RetryPolicy) *http.Response {
+	if !t.rangeResume || res == nil || res.Body == nil || res.Body == http.NoBody {
+		return res
+	}
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" || res.StatusCode != http.StatusOK || res.Uncompressed {
+		return res
+	}
+	if strings.EqualFold(res.Header.Get("Accept-Ranges"), "none") {
+		return res
+	}
+	validator := res.Header.Get("ETag")
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		validator = res.Header.Get("Last-Modified")
+	}
+	if validator == "" {
+		return res
+	}
+	res.Body = &resumableBody{
+		t:          t,
+		req:        req,
+		body:       res.Body,
+		etag:       res.Header.Get("ETag"),
+		validator:  validator,
+		maxResumes: policy.MaxAttempts,
+	}
+	return res
+}
+
+// resumableBody は、読み込みに失敗した場合に Range ヘッダーで続きから取得し直す io.ReadCloser の具象型
+type resumableBody struct {
+	t    *RetryableTransport
+	req  *http.Request
+	body io.ReadCloser
+	// etag は最初のレスポンスの ETag ヘッダー、validator は If-Range ヘッダーに指定する値
+	etag       string
+	validator  string
+	offset     int64
+	resumes    int
+	maxResumes int
+	closed     bool
+}
+
+func (b *resumableBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.offset += int64(n)
+	if err == nil || errors.Is(err, io.EOF) || b.closed {
+		return n, err
+	}
+	// NOTE: 呼び出し元がキャンセルした場合や再開の上限に達した場合は、元のエラーを返却する
+	if b.req.Context().Err() != nil || b.resumes >= b.maxResumes {
+		return n, err
+	}
+	if resumeErr := b.resume(err); resumeErr != nil {
+		return n, resumeErr
+	}
+	if n > 0 {
+		return n, nil
+	}
+	return b.Read(p)
+}
+
+// resume は、読み込み済みの位置から続きを取得するリクエストを送信し、ボディを置き換える
+func (b *resumableBody) resume(readErr error) error {
+	b.resumes++
+	_ = b.body.Close()
+
+	ctx := b.req.Context()
+	if b.t.logEnabled(ctx, LogEventRangeResume) {
+		b.t.log(ctx, LogEventRangeResume, "range resume", "offset", b.offset, "resume", b.resumes, "method", b.req.Method, "host", b.req.URL.Host)
+	}
+
+	req := b.req.Clone(ctx)
+	req.Header.Set("Range", "bytes="+strconv.FormatInt(b.offset, 10)+"-")
+	req.Header.Set("If-Range", b.validator)
+	res, err := b.t.RoundTrip(req)
+	if err != nil {
+		b.body = http.NoBody
+		return &RangeResumeError{Offset: b.offset, Reason: err.Error(), Err: readErr}
+	}
+	if reason := b.mismatch(res); reason != "" {
+		b.t.drainBody(res)
+		b.body = http.NoBody
+		return &RangeResumeError{Offset: b.offset, Reason: reason, Err: readErr}
+	}
+	b.body = res.Body
+	return nil
+}
+
+// mismatch は、再開のレスポンスが読み込み済みの位置から始まる同じリソースの続きでない場合に、その理由を返却する
+// NOTE: If-Range で指定したリソースが更新されている場合、サーバーは 200 でリソース全体を返却する
+func (b *resumableBody) mismatch(res *http.Response) string {
+	if res.StatusCode != http.StatusPartialContent {
+		return "unexpected status " + strconv.Itoa(res.StatusCode)
+	}
+	if b.etag != "" && res.Header.Get("ETag") != "" && res.Header.Get("ETag") != b.etag {
+		return "etag changed"
+	}
+	start, ok := contentRangeStart(res.Header.Get("Content-Range"))
+	if !ok || start != b.offset {
+		return "unexpected content range " + strconv.Quote(res.Header.Get("Content-Range"))
+	}
+	return ""
+}
+
+func (b *resumableBody) Close() error {
+	b.closed = true
+	return b.body.Close()
+}
+
+// contentRangeStart は、Content-Range ヘッダー (bytes start-end/size) の開始位置を返却する
+func contentRangeStart(value string) (int64, bool) {
+	spec, ok := strings.CutPrefix(value, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	first, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, false
+	}
+	return start, true
+}
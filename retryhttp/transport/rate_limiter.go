@@ -0,0 +1,145 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Limiter は、リクエストを送信する前に送信できるまで待機するインターフェース
+// NOTE: golang.org/x/time/rate の *rate.Limiter もこのインターフェースを満たす
+type Limiter interface {
+	// Wait は送信できるまで待機する。ctx がキャンセルされた場合や、期限までに送信できない場合はエラーを返却する
+	Wait(ctx context.Context) error
+}
+
+// CostLimiter は、リクエストのコストの数のトークンを消費して待機できる Limiter が実装するインターフェース
+// NOTE: golang.org/x/time/rate の *rate.Limiter と TokenBucket はこのインターフェースを満たす
+type CostLimiter interface {
+	// WaitN は n 個のトークンを消費して送信できるまで待機する
+	WaitN(ctx context.Context, n int) error
+}
+
+// WithRateLimiter は、リトライやヘッジリクエストを含むすべての試行を、limiter で送信できるまで待機してから送信する
+// NOTE: 呼び出し元のリクエストとリトライを合わせた送信数を、送信先の API の秒間リクエスト数の上限以下に抑えるために使用する
+// 複数の RetryableTransport で同じ limiter を共有すると、合計の送信数を制限できる
+// limiter が CostLimiter を実装している場合は、試行ごとにリクエストのコスト (WithRequestCost) の数のトークンを消費する
+func WithRateLimiter(limiter Limiter) Option {
+	return func(t *RetryableTransport) {
+		t.limiter = limiter
+	}
+}
+
+// waitLimiter は、WithRateLimiter と WithHostRateLimit が指定されている場合に、送信できるまで待機する
+// NOTE: limiter が CostLimiter を実装している場合は、リクエストのコストの数のトークンを消費する
+func (t *RetryableTransport) waitLimiter(req *http.Request) error {
+	ctx := req.Context()
+	cost := t.requestCost(req)
+	if t.limiter != nil {
+		var err error
+		if costLimiter, ok := t.limiter.(CostLimiter); ok {
+			err = costLimiter.WaitN(ctx, cost)
+		} else {
+			err = t.limiter.Wait(ctx)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return t.waitHostLimiter(ctx, req.URL.Host, cost)
+}
+
+// TokenBucket はトークンバケット方式の Limiter 具象型
+// 1 秒あたり rate 個のトークンを補充し、最大で burst 個のトークンを保持する。送信ごとに 1 個のトークンを消費する
+type TokenBucket struct {
+	rate  float64
+	burst float64
+	clk   Clock
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket は TokenBucket 構造体を作成する。作成直後は burst 個のトークンを保持する
+// rate が 0 以下の場合は制限しない。burst が 1 未満の場合は 1 とする
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return NewTokenBucketWithClock(rate, burst, realClock{})
+}
+
+// NewTokenBucketWithClock は、clock を使用する TokenBucket 構造体を作成する
+func NewTokenBucketWithClock(rate float64, burst int, clock Clock) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		clk:    clock,
+		tokens: float64(burst),
+		last:   clock.Now(),
+	}
+}
+
+// Wait はトークンを 1 個消費できるまで待機する
+// NOTE: 待機する前にトークンを予約するため、並行して待機するリクエストは予約した順に送信される
+// ctx の期限までにトークンを消費できない場合は、待機せずにエラーを返却する
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	return b.WaitN(ctx, 1)
+}
+
+// WaitN はトークンを n 個消費できるまで待機する。n が burst を超える場合は、トークンが貯まることがないためエラーを返却する
+// NOTE: 送信先の API の上限がリクエストの重さ (コスト) に基づく場合に、重いリクエストで多くのトークンを消費するために使用する
+func (b *TokenBucket) WaitN(ctx context.Context, n int) error {
+	if b.rate <= 0 || n <= 0 {
+		return nil
+	}
+	if float64(n) > b.burst {
+		return fmt.Errorf("rate limit cost %d exceeds burst %d", n, int(b.burst))
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	wait := b.reserve(n)
+	if wait <= 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && b.clk.Now().Add(wait).After(deadline) {
+		b.cancel(n)
+		return fmt.Errorf("rate limit wait %s would exceed context deadline: %w", wait, context.DeadlineExceeded)
+	}
+
+	select {
+	case <-ctx.Done():
+		b.cancel(n)
+		return ctx.Err()
+	case <-b.clk.After(wait):
+		return nil
+	}
+}
+
+// reserve はトークンを n 個予約し、トークンが補充されるまでの待機時間を返却する
+func (b *TokenBucket) reserve(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clk.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel は予約したトークンを n 個返却する
+func (b *TokenBucket) cancel(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens = min(b.burst, b.tokens+float64(n))
+}
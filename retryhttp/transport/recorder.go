@@ -0,0 +1,78 @@
+package transport
+
+import (
+	"net/http"
+	"time"
+)
+
+// RequestResult は、リトライを含む 1 リクエスト全体の結果
+type RequestResult struct {
+	// Host はリクエスト先のホスト
+	Host string
+	// Method はリクエストの HTTP メソッド
+	Method string
+	// Route は RouteTemplates で正規化したパス。WithRouteTemplates が指定されていない場合は空文字
+	Route string
+	// StatusCode は最終的なレスポンスのステータスコード。レスポンスがない場合は 0
+	StatusCode int
+	// Err は最終的なエラー
+	Err error
+	// Attempts は試行回数。リトライが行われていない場合は 1
+	Attempts int
+	// Succeeded はリトライ不要な結果で終了したか
+	Succeeded bool
+	// Exhausted は試行回数の上限、またはリトライの予算を使い切ったため、リトライが必要な結果で終了したか
+	Exhausted bool
+	// Duration はバックオフを含むリクエスト全体の所要時間
+	Duration time.Duration
+	// Annotations はリクエストの context.Context に付与されたアノテーション
+	Annotations Annotations
+	// SLO は WithLatencySLO で指定されたレイテンシーの SLO。指定されていない場合はゼロ値
+	SLO LatencySLO
+	// Canary は WithCanaryPolicy の policy を適用したリクエストか
+	Canary bool
+}
+
+// Recorder は、リクエストの結果を記録するインターフェース
+// NOTE: RoundTrip ごとに呼び出されるため、複数の goroutine から同時に呼び出されても安全である必要がある
+type Recorder interface {
+	Record(result RequestResult)
+}
+
+// WithRecorder は、リクエストの結果を記録する Recorder を追加する
+func WithRecorder(recorder Recorder) Option {
+	return func(t *RetryableTransport) {
+		t.recorders = append(t.recorders, recorder)
+	}
+}
+
+// record は、登録されている Recorder にリクエストの結果を通知する
+func (t *RetryableTransport) record(req *http.Request, res *http.Response, err error,
+	attempts int, succeeded bool, exhausted bool, canary bool, duration time.Duration) {
+	if len(t.recorders) == 0 {
+		return
+	}
+
+	result := RequestResult{
+		Host:        req.URL.Host,
+		Method:      req.Method,
+		Err:         err,
+		Attempts:    attempts,
+		Succeeded:   succeeded,
+		Exhausted:   exhausted,
+		Duration:    duration,
+		Annotations: AnnotationsFromContext(req.Context()),
+		Canary:      canary,
+	}
+	result.SLO, _ = LatencySLOFromContext(req.Context())
+	if res != nil {
+		result.StatusCode = res.StatusCode
+	}
+	if t.routes != nil {
+		result.Route = t.routes.Normalize(req.URL.Path)
+	}
+
+	for _, r := range t.recorders {
+		r.Record(result)
+	}
+}
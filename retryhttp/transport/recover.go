@@ -0,0 +1,58 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// RewindError は、リトライのためにリクエストボディを巻き戻せなかったことを表すエラー
+// NOTE: 巻き戻せなかったリクエストは壊れたボディを送信するため、送信せずに返却する
+type RewindError struct {
+	// Err は GetBody、またはリクエストボディのクローズが返却したエラー
+	Err error
+}
+
+func (e *RewindError) Error() string {
+	return fmt.Sprintf("rewind request body: %v", e.Err)
+}
+
+func (e *RewindError) Unwrap() error {
+	return e.Err
+}
+
+// PanicError は、親の Transport が RoundTrip でパニックしたことを表すエラー
+type PanicError struct {
+	// Value は recover が返却した値
+	Value any
+	// Stack はパニックした時点のスタックトレース
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("transport panicked: %v", e.Value)
+}
+
+// Unwrap は、パニックの値が error の場合にその値を返却する
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// safeRoundTrip は rt.RoundTrip を呼び出し、パニックした場合は *PanicError を返却する
+// NOTE: 不具合のある親の Transport のパニックで、呼び出し元の goroutine やヘッジリクエストの goroutine がクラッシュしないようにする
+func safeRoundTrip(rt http.RoundTripper, req *http.Request) (res *http.Response, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			res, err = nil, &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	return rt.RoundTrip(req)
+}
+
+// isPanic は、親の Transport のパニックによるエラーか判定する
+func isPanic(err error) bool {
+	var panicErr *PanicError
+	return errors.As(err, &panicErr)
+}
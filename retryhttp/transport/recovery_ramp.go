@@ -0,0 +1,118 @@
+package transport
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RampConfig は、ブラックアウト期間の終了後やサーキットブレーカーが閉じた後に、リクエストを段階的に解放する設定
+// ゼロ値の項目はデフォルト値を使用する
+type RampConfig struct {
+	// Rate は 1 秒あたりに解放するリクエスト数。デフォルトは 10
+	Rate float64
+	// Burst は再開直後に即座に解放するリクエスト数。デフォルトは 1
+	Burst int
+	// Duration は段階的に解放する期間。期間の終了後は制御しない。デフォルトは 30 秒
+	Duration time.Duration
+}
+
+// WithRecoveryRamp は、ブラックアウト期間の終了後やサーキットブレーカーが閉じた後に、待機していたリクエストを一度にではなく、
+// ホストごとに config.Rate の間隔で解放する
+// NOTE: 回復直後のバックエンドに、待機していたリクエストとリトライが集中して再び障害になることを防ぐ
+func WithRecoveryRamp(config RampConfig) Option {
+	if config.Rate <= 0 {
+		config.Rate = 10
+	}
+	if config.Burst <= 0 {
+		config.Burst = 1
+	}
+	if config.Duration <= 0 {
+		config.Duration = 30 * time.Second
+	}
+	return func(t *RetryableTransport) {
+		t.ramp = &recoveryRamp{config: config, hosts: make(map[string]*rampState)}
+	}
+}
+
+// recoveryRamp はホストごとにリクエストを段階的に解放する
+type recoveryRamp struct {
+	config RampConfig
+
+	mu    sync.Mutex
+	hosts map[string]*rampState
+}
+
+// rampState はホストごとの段階的な解放の状態
+type rampState struct {
+	// start は再開した時刻
+	start time.Time
+	// released は再開後に解放したリクエスト数
+	released int
+}
+
+// resume は、ホストへのリクエストを at から段階的に解放する。既に at 以降に再開している場合は何もしない
+func (r *recoveryRamp) resume(host string, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s, ok := r.hosts[host]; ok && !s.start.Before(at) {
+		return
+	}
+	r.hosts[host] = &rampState{start: at}
+}
+
+// slot は、ホストへのリクエストを解放する時刻を返却する。段階的に解放する期間外の場合は false を返却する
+func (r *recoveryRamp) slot(host string, now time.Time) (time.Time, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.hosts[host]
+	if !ok {
+		return time.Time{}, false
+	}
+	if now.Sub(s.start) >= r.config.Duration {
+		delete(r.hosts, host)
+		return time.Time{}, false
+	}
+	n := s.released
+	s.released++
+	if n < r.config.Burst {
+		return now, true
+	}
+	interval := time.Duration(float64(n-r.config.Burst+1) / r.config.Rate * float64(time.Second))
+	return s.start.Add(interval), true
+}
+
+// waitRamp は、WithRecoveryRamp が指定されている場合に、ホストへのリクエストを解放する時刻まで待機する
+// NOTE: サーキットブレーカーが閉じた時刻は、試行ごとに CircuitBreaker から取得する
+func (t *RetryableTransport) waitRamp(ctx context.Context, host string) error {
+	if t.ramp == nil {
+		return nil
+	}
+	if t.breaker != nil {
+		if closedAt, ok := t.breaker.closedAt(host); ok {
+			t.ramp.resume(host, closedAt)
+		}
+	}
+
+	now := t.clock().Now()
+	slot, ok := t.ramp.slot(host, now)
+	if !ok || !slot.After(now) {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.clock().After(slot.Sub(now)):
+		return nil
+	}
+}
+
+// resumeRamp は、WithRecoveryRamp が指定されている場合に、ホストへのリクエストを at から段階的に解放する
+func (t *RetryableTransport) resumeRamp(host string, at time.Time) {
+	if t.ramp == nil {
+		return
+	}
+	t.ramp.resume(host, at)
+}
@@ -0,0 +1,108 @@
+package transport
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// RedirectAction は、リダイレクトのステータスコード (3xx) を受け取った場合の動作
+type RedirectAction int
+
+const (
+	// RedirectFollow は、*http.Client の通常の動作と同様にリダイレクト先に送信する。対応表にないステータスコードの動作
+	RedirectFollow RedirectAction = iota
+	// RedirectRetry は、リダイレクト先に送信せずに、同じリクエストをリトライする
+	// 試行回数の上限に達した場合は、リダイレクトのレスポンスをそのまま返却する
+	RedirectRetry
+	// RedirectTerminal は、リダイレクト先に送信せずに、リダイレクトのレスポンスを成功として返却する
+	RedirectTerminal
+)
+
+func (a RedirectAction) String() string {
+	switch a {
+	case RedirectRetry:
+		return "retry"
+	case RedirectTerminal:
+		return "terminal"
+	default:
+		return "follow"
+	}
+}
+
+// errTooManyRedirects は、*http.Client のデフォルトと同様に 10 回リダイレクトした場合のエラー
+var errTooManyRedirects = errors.New("stopped after 10 redirects")
+
+// RedirectTable は、ホストごとのリダイレクトのステータスコードから動作への対応表
+// 例えば過負荷の場合に 302 でステータスページにリダイレクトするレガシーなシステムでは、302 をリトライとして扱う
+// NOTE: RedirectTerminal とリトライを使い切った RedirectRetry のレスポンスを返却するには、*http.Client の CheckRedirect に
+// RedirectTable.CheckRedirect を設定する必要がある
+type RedirectTable struct {
+	mu    sync.RWMutex
+	hosts map[string]map[int]RedirectAction
+}
+
+// NewRedirectTable は RedirectTable 構造体を作成する
+func NewRedirectTable() *RedirectTable {
+	return &RedirectTable{hosts: make(map[string]map[int]RedirectAction)}
+}
+
+// Register はホストのステータスコードごとの動作を登録する。host は "api.example.com" または "api.example.com:8443" の形式
+// NOTE: 同じステータスコードを再度登録した場合は上書きする
+func (t *RedirectTable) Register(host string, rules map[int]RedirectAction) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h, ok := t.hosts[host]
+	if !ok {
+		h = make(map[int]RedirectAction, len(rules))
+		t.hosts[host] = h
+	}
+	for code, action := range rules {
+		h[code] = action
+	}
+}
+
+// Action は、リクエスト先のホストからステータスコードを受け取った場合の動作を返却する
+func (t *RedirectTable) Action(req *http.Request, statusCode int) RedirectAction {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if h, ok := t.hosts[req.URL.Host]; ok {
+		if action, ok := h[statusCode]; ok {
+			return action
+		}
+	}
+	if h, ok := t.hosts[req.URL.Hostname()]; ok {
+		return h[statusCode]
+	}
+	return RedirectFollow
+}
+
+// CheckRedirect は *http.Client の CheckRedirect に設定する関数
+// リダイレクトのレスポンスの動作が RedirectFollow 以外の場合は、リダイレクト先に送信せずにそのレスポンスを返却する
+func (t *RedirectTable) CheckRedirect(req *http.Request, via []*http.Request) error {
+	if res := req.Response; res != nil && res.Request != nil && t.Action(res.Request, res.StatusCode) != RedirectFollow {
+		return http.ErrUseLastResponse
+	}
+	if len(via) >= 10 {
+		return errTooManyRedirects
+	}
+	return nil
+}
+
+// WithRedirects は、リダイレクトのステータスコードの対応表を設定する
+// 対応表で RedirectRetry を指定したステータスコードは、CheckRetryFunc の判定にかかわらずリトライする
+func WithRedirects(table *RedirectTable) Option {
+	return func(t *RetryableTransport) {
+		t.redirects = table
+	}
+}
+
+// shouldRetryRedirect は、対応表でリトライを指定したリダイレクトのレスポンスか判定する
+func (t *RetryableTransport) shouldRetryRedirect(req *http.Request, res *http.Response) bool {
+	if t.redirects == nil || res == nil || res.StatusCode < http.StatusMultipleChoices || res.StatusCode >= http.StatusBadRequest {
+		return false
+	}
+	return t.redirects.Action(req, res.StatusCode) == RedirectRetry
+}
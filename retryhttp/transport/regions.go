@@ -0,0 +1,230 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RegionConfig は RegionHosts のレイテンシーの計測の設定。ゼロ値の項目はデフォルト値を使用する
+type RegionConfig struct {
+	// ProbePath は計測のために GET リクエストを送信するパス。デフォルトは "/"
+	ProbePath string
+	// Interval は Run で計測する間隔。デフォルトは 30 秒
+	Interval time.Duration
+	// Timeout は 1 回の計測のタイムアウト。デフォルトは 5 秒
+	Timeout time.Duration
+	// Transport は計測のリクエストを送信する Transport。nil の場合は http.DefaultTransport
+	// NOTE: 計測結果にリトライが含まれないように、RetryableTransport は指定しない
+	Transport http.RoundTripper
+	// StartupJitter は、Run で最初に計測するまでに待機するランダムな時間の上限。0 の場合は待機しない
+	// NOTE: 多数のレプリカが同時に起動した場合に、計測のリクエストが同じタイミングに集中しないようにする
+	StartupJitter time.Duration
+}
+
+// RegionHosts は、リージョンごとの送信先のレイテンシーを定期的に計測し、レイテンシーの短い正常なリージョンから順に試行する HostSelector 具象型
+// 試行が失敗したリージョンは、次の計測で成功するまで優先度を下げる
+// NOTE: 選択したリージョンは ResponseMetadata.Host と RegionFromResponse でレスポンスから確認できる
+type RegionHosts struct {
+	config RegionConfig
+
+	mu      sync.Mutex
+	regions []*regionState
+}
+
+// regionState はリージョンごとの計測の状態
+type regionState struct {
+	name    string
+	host    *url.URL
+	latency time.Duration
+	// measured は一度でも計測に成功したか
+	measured bool
+	healthy  bool
+}
+
+// NewRegionHosts は RegionHosts 構造体を作成する。regions はリージョン名とスキームとホストを含む URL の組
+// 計測されるまでは、リージョン名の順に試行する
+func NewRegionHosts(regions map[string]string, config RegionConfig) (*RegionHosts, error) {
+	if config.ProbePath == "" {
+		config.ProbePath = "/"
+	}
+	if config.Interval <= 0 {
+		config.Interval = 30 * time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 5 * time.Second
+	}
+	if config.Transport == nil {
+		config.Transport = http.DefaultTransport
+	}
+
+	names := make([]string, 0, len(regions))
+	for name := range regions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	baseURLs := make([]string, len(names))
+	for i, name := range names {
+		baseURLs[i] = regions[name]
+	}
+	hosts, err := parseBaseURLs(baseURLs)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &RegionHosts{config: config}
+	for i, name := range names {
+		r.regions = append(r.regions, &regionState{name: name, host: hosts[i], healthy: true})
+	}
+	return r, nil
+}
+
+// Hosts は、正常なリージョンをレイテンシーの短い順に並べ、その後に異常なリージョンを並べて返却する
+func (r *RegionHosts) Hosts(*http.Request) []*url.URL {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ordered := append([]*regionState(nil), r.regions...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if a.healthy != b.healthy {
+			return a.healthy
+		}
+		if a.measured != b.measured {
+			return a.measured
+		}
+		return a.latency < b.latency
+	})
+	hosts := make([]*url.URL, len(ordered))
+	for i, s := range ordered {
+		hosts[i] = s.host
+	}
+	return hosts
+}
+
+// Report は試行の結果を記録する。失敗したリージョンは、次の計測で成功するまで優先度を下げる
+func (r *RegionHosts) Report(host *url.URL, failed bool) {
+	if !failed {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s := r.find(host); s != nil {
+		s.healthy = false
+	}
+}
+
+// Region は送信先のリージョン名を返却する。RegionHosts の送信先でない場合は false を返却する
+func (r *RegionHosts) Region(host *url.URL) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s := r.find(host); s != nil {
+		return s.name, true
+	}
+	return "", false
+}
+
+// RegionFromResponse は、RetryableTransport が返却したレスポンスの送信先のリージョン名を返却する
+func (r *RegionHosts) RegionFromResponse(res *http.Response) (string, bool) {
+	m := MetadataFromResponse(res)
+	if m == nil || m.Host() == nil {
+		return "", false
+	}
+	return r.Region(m.Host())
+}
+
+// Latencies は、計測に成功したリージョンごとの直近のレイテンシーを返却する
+func (r *RegionHosts) Latencies() map[string]time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	latencies := make(map[string]time.Duration, len(r.regions))
+	for _, s := range r.regions {
+		if s.measured {
+			latencies[s.name] = s.latency
+		}
+	}
+	return latencies
+}
+
+// Run は ctx が終了するまで、RegionConfig.Interval ごとにすべてのリージョンのレイテンシーを計測する
+// RegionConfig.StartupJitter を指定した場合は、ランダムな時間だけ待機してから計測を始める
+func (r *RegionHosts) Run(ctx context.Context) {
+	if err := StartupDelay(ctx, r.config.StartupJitter); err != nil {
+		return
+	}
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		r.Measure(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Measure は、すべてのリージョンのレイテンシーを並行して計測する
+// 5xx または送信エラーのリージョンは異常とみなす
+func (r *RegionHosts) Measure(ctx context.Context) {
+	r.mu.Lock()
+	regions := append([]*regionState(nil), r.regions...)
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, s := range regions {
+		s := s
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			latency, ok := r.probe(ctx, s.host)
+
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			s.healthy = ok
+			if ok {
+				s.latency, s.measured = latency, true
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// probe は送信先に GET リクエストを送信し、レスポンスヘッダーを受信するまでのレイテンシーを返却する
+func (r *RegionHosts) probe(ctx context.Context, host *url.URL) (time.Duration, bool) {
+	ctx, cancel := context.WithTimeout(ctx, r.config.Timeout)
+	defer cancel()
+
+	probeURL := host.JoinPath(r.config.ProbePath)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL.String(), nil)
+	if err != nil {
+		return 0, false
+	}
+	start := time.Now()
+	res, err := r.config.Transport.RoundTrip(req)
+	if err != nil {
+		return 0, false
+	}
+	latency := time.Since(start)
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, defaultMaxDrainBytes))
+	_ = res.Body.Close()
+	return latency, res.StatusCode < http.StatusInternalServerError
+}
+
+// find は送信先のリージョンの状態を返却する
+func (r *RegionHosts) find(host *url.URL) *regionState {
+	for _, s := range r.regions {
+		if s.host.Scheme == host.Scheme && s.host.Host == host.Host {
+			return s
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/mtnori/httpRetryExample/retryhttp/internal/shard"
+)
+
+// requestCostKey は context.Context にリクエストのコストを格納するためのキー
+type requestCostKey struct{}
+
+// WithRequestCost は、context.Context にリクエストのコストを格納する
+// コストは WithRateLimiter と WithHostRateLimit のトークンバケットから、試行ごとに消費するトークンの数となる
+// NOTE: レポートの生成などの重いリクエストに 10 を指定するなど、送信先の API の上限がリクエストの重さに基づく場合に使用する
+func WithRequestCost(ctx context.Context, cost int) context.Context {
+	return context.WithValue(ctx, requestCostKey{}, cost)
+}
+
+// RequestCostFromContext は context.Context に格納されたリクエストのコストを返却する
+func RequestCostFromContext(ctx context.Context) (int, bool) {
+	cost, ok := ctx.Value(requestCostKey{}).(int)
+	return cost, ok
+}
+
+// WithRequestCostFunc は、context.Context にコストが格納されていないリクエストのコストを cost で算出する
+// NOTE: 呼び出し元を変更せずに、メソッドやパスからコストを決めるために使用する。0 以下を返却した場合はトークンを消費しない
+func WithRequestCostFunc(cost func(req *http.Request) int) Option {
+	return func(t *RetryableTransport) {
+		t.requestCostFunc = cost
+	}
+}
+
+// requestCost はリクエストのコストを返却する。context.Context、WithRequestCostFunc の順に優先し、どちらもない場合は 1
+func (t *RetryableTransport) requestCost(req *http.Request) int {
+	if cost, ok := RequestCostFromContext(req.Context()); ok {
+		return cost
+	}
+	if t.requestCostFunc != nil {
+		return t.requestCostFunc(req)
+	}
+	return 1
+}
+
+// WithHostRateLimit は、送信先のホストごとに、1 秒あたり rate 個のトークンを補充し最大で burst 個を保持するトークンバケットで送信数を制限する
+// 試行ごとにリクエストのコスト (WithRequestCost) の数のトークンを消費し、トークンが足りない場合は補充されるまで待機する
+// NOTE: WithRateLimiter と組み合わせた場合は、両方のトークンを消費する
+func WithHostRateLimit(rate float64, burst int) Option {
+	return func(t *RetryableTransport) {
+		t.hostRateLimit = &hostRateLimit{rate: rate, burst: burst, buckets: shard.New[*TokenBucket](0)}
+	}
+}
+
+// hostRateLimit は、ホストごとのトークンバケット
+type hostRateLimit struct {
+	rate    float64
+	burst   int
+	buckets *shard.Map[*TokenBucket]
+}
+
+// waitHostLimiter は、WithHostRateLimit が指定されている場合に、ホストのトークンを cost 個消費できるまで待機する
+func (t *RetryableTransport) waitHostLimiter(ctx context.Context, host string, cost int) error {
+	limit := t.hostRateLimit
+	if limit == nil {
+		return nil
+	}
+
+	buckets := limit.buckets.Lock(host)
+	bucket, ok := buckets.Entries[host]
+	if !ok {
+		bucket = NewTokenBucketWithClock(limit.rate, limit.burst, t.clock())
+		buckets.Entries[host] = bucket
+	}
+	buckets.Unlock()
+
+	return bucket.WaitN(ctx, cost)
+}
@@ -0,0 +1,132 @@
+package transport
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// headerMethodOverride は、QueryToBody で変換した元の HTTP メソッドを格納するヘッダー
+const headerMethodOverride = "X-HTTP-Method-Override"
+
+// RequestReducer は、431 Request Header Fields Too Large または 414 URI Too Long のレスポンスを受け取った場合に、
+// ヘッダーや URL を小さくしたリクエストを返却する関数の型定義。小さくできない場合は false を返却する
+// NOTE: req は呼び出し元のリクエストのため、変更する場合は req.Clone(req.Context()) で複製してから変更する
+type RequestReducer func(req *http.Request, res *http.Response) (*http.Request, bool)
+
+// WithRequestReducer は、431 または 414 のレスポンスを受け取った場合に、reducer で小さくしたリクエストで即座に 1 回だけリトライする
+// NOTE: 同じ大きさのリクエストを送信し直しても同じ理由で拒否されるため、小さくできない場合はリトライせずにレスポンスを返却する
+// サーバーはリクエストを処理していないため、冪等でないリクエストでもリトライする
+func WithRequestReducer(reducer RequestReducer) Option {
+	return func(t *RetryableTransport) {
+		t.requestReducer = reducer
+	}
+}
+
+// ChainReducers は、reducers を順に適用し、いずれかで小さくできた場合に true を返却する RequestReducer を返却する
+// 例: ChainReducers(DropHeaders("X-Debug", "X-Client-Context"), QueryToBody())
+func ChainReducers(reducers ...RequestReducer) RequestReducer {
+	return func(req *http.Request, res *http.Response) (*http.Request, bool) {
+		reduced := false
+		for _, reducer := range reducers {
+			if next, ok := reducer(req, res); ok {
+				req, reduced = next, true
+			}
+		}
+		return req, reduced
+	}
+}
+
+// DropHeaders は、431 のレスポンスを受け取った場合に、送信に必須でない names のヘッダーを取り除く RequestReducer を返却する
+// 取り除くヘッダーがない場合は false を返却する
+func DropHeaders(names ...string) RequestReducer {
+	return func(req *http.Request, res *http.Response) (*http.Request, bool) {
+		if res.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+			return req, false
+		}
+		var reduced *http.Request
+		for _, name := range names {
+			if _, ok := req.Header[http.CanonicalHeaderKey(name)]; !ok {
+				continue
+			}
+			if reduced == nil {
+				reduced = req.Clone(req.Context())
+			}
+			reduced.Header.Del(name)
+		}
+		if reduced == nil {
+			return req, false
+		}
+		return reduced, true
+	}
+}
+
+// QueryToBody は、414 のレスポンスを受け取った場合に、ボディのない GET リクエストのクエリ文字列を
+// application/x-www-form-urlencoded のボディに移した POST リクエストに変換する RequestReducer を返却する
+// 元のメソッドは X-HTTP-Method-Override ヘッダーで送信する
+// NOTE: 送信先のサーバーが X-HTTP-Method-Override に対応している場合のみ使用する
+func QueryToBody() RequestReducer {
+	return func(req *http.Request, res *http.Response) (*http.Request, bool) {
+		if res.StatusCode != http.StatusRequestURITooLong || req.Method != http.MethodGet || req.URL.RawQuery == "" {
+			return req, false
+		}
+		if req.Body != nil && req.Body != http.NoBody {
+			return req, false
+		}
+
+		query := req.URL.RawQuery
+		reduced := req.Clone(req.Context())
+		reduced.Method = http.MethodPost
+		reduced.URL = cloneURL(req.URL)
+		reduced.URL.RawQuery = ""
+		reduced.Header.Set(headerMethodOverride, req.Method)
+		reduced.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		reduced.Body = io.NopCloser(strings.NewReader(query))
+		reduced.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(query)), nil
+		}
+		reduced.ContentLength = int64(len(query))
+		return reduced, true
+	}
+}
+
+// cloneURL は URL を複製する
+func cloneURL(u *url.URL) *url.URL {
+	cloned := *u
+	if u.User != nil {
+		user := *u.User
+		cloned.User = &user
+	}
+	return &cloned
+}
+
+// shouldReduceRequest は、リクエストを小さくしてリトライすべきレスポンスか判定する
+func (t *RetryableTransport) shouldReduceRequest(res *http.Response, err error, reduced bool) bool {
+	if t.requestReducer == nil || reduced || err != nil {
+		return false
+	}
+	return res.StatusCode == http.StatusRequestHeaderFieldsTooLarge || res.StatusCode == http.StatusRequestURITooLong
+}
+
+// reduceRequest は、巻き戻したリクエストを RequestReducer で小さくし、リトライで巻き戻せるようにしたリクエストを返却する
+// 小さくできない場合は false を返却する。返却する関数は、RoundTrip の終了時にリクエストボディをクローズする関数
+func (t *RetryableTransport) reduceRequest(req *http.Request, res *http.Response) (*http.Request, func(), bool, error) {
+	// NOTE: 試行でリクエストボディが読み込まれているため、巻き戻してから RequestReducer に渡す
+	rewound, err := t.rewindBody(req)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	reduced, ok := t.requestReducer(rewound, res)
+	if !ok {
+		if rewound != req {
+			_ = rewound.Body.Close()
+		}
+		return nil, nil, false, nil
+	}
+	reduced, closeBody, err := setupRewindBody(reduced, t.bodyBufferLimit())
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return reduced, closeBody, true, nil
+}
@@ -0,0 +1,60 @@
+package transport
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// HeaderRetryAttempts は、WithAttemptsHeader を指定した場合にレスポンスに付与する試行回数のヘッダー
+// NOTE: サーバーが返却したヘッダーではなく、クライアント側で付与する
+const HeaderRetryAttempts = "X-Client-Retry-Attempts"
+
+// RetryResult は、レスポンスを受け取るまでのリトライの結果
+type RetryResult struct {
+	// Attempts は試行回数。リトライが行われていない場合は 1
+	Attempts int
+	// History は試行ごとの結果
+	History []AttemptResult
+	// PossibleDuplicate は ResponseMetadata.PossibleDuplicate と同じ
+	PossibleDuplicate bool
+	// AlreadyDone は ResponseMetadata.AlreadyDone と同じ
+	AlreadyDone bool
+}
+
+// Retried はリトライが行われたか
+func (r RetryResult) Retried() bool {
+	return r.Attempts > 1
+}
+
+// ResultFromResponse は、RetryableTransport が返却したレスポンスのリトライの結果を返却する
+// RetryableTransport を経由していないレスポンスの場合は false を返却する
+// NOTE: 成功したレスポンスでも何回目の試行で成功したかを確認できるため、利用側での SLO の集計に使用する
+func ResultFromResponse(res *http.Response) (RetryResult, bool) {
+	m := MetadataFromResponse(res)
+	if m == nil {
+		return RetryResult{}, false
+	}
+	history := m.Attempts()
+	return RetryResult{
+		Attempts:          len(history),
+		History:           history,
+		PossibleDuplicate: m.PossibleDuplicate(),
+		AlreadyDone:       m.AlreadyDone(),
+	}, true
+}
+
+// WithAttemptsHeader は、返却するレスポンスに試行回数の X-Client-Retry-Attempts ヘッダーを付与する
+// NOTE: レスポンスのヘッダーのみを参照するライブラリやプロキシに、試行回数を伝える場合に使用する
+func WithAttemptsHeader() Option {
+	return func(t *RetryableTransport) {
+		t.attemptsHeader = true
+	}
+}
+
+// setAttemptsHeader は、WithAttemptsHeader が指定されている場合にレスポンスに試行回数を付与する
+func (t *RetryableTransport) setAttemptsHeader(res *http.Response, attempts int) {
+	if !t.attemptsHeader || res == nil || res.Header == nil {
+		return
+	}
+	res.Header.Set(HeaderRetryAttempts, strconv.Itoa(attempts))
+}
@@ -0,0 +1,64 @@
+package transport
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// WithMaxRetryAfter は、Retry-After ヘッダーの値を待機時間として使用する場合の上限を設定する。0 の場合は上限なし
+// NOTE: 上限を超える値を返却された場合は、上限まで待機してからリトライする
+func WithMaxRetryAfter(max time.Duration) Option {
+	return func(t *RetryableTransport) {
+		t.maxRetryAfter = max
+	}
+}
+
+// WithoutRetryAfter は、Retry-After ヘッダーを無視して常に BackoffFunc の待機時間を使用する
+func WithoutRetryAfter() Option {
+	return func(t *RetryableTransport) {
+		t.ignoreRetryAfter = true
+	}
+}
+
+// ParseRetryAfter は Retry-After ヘッダーの値 (秒数または HTTP-date) から待機時間を返却する
+// ヘッダーがない、または解釈できない場合は ok に false を返却する
+func ParseRetryAfter(res *http.Response, now time.Time) (wait time.Duration, ok bool) {
+	if res == nil {
+		return 0, false
+	}
+	value := res.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	// 過去の日時の場合は待機せずにリトライする
+	return max(date.Sub(now), 0), true
+}
+
+// retryAfter は、429 または 503 のレスポンスに Retry-After ヘッダーがある場合に、その値を待機時間として返却する
+func (t *RetryableTransport) retryAfter(res *http.Response) (time.Duration, bool) {
+	if t.ignoreRetryAfter || res == nil {
+		return 0, false
+	}
+	if res.StatusCode != http.StatusTooManyRequests && res.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	wait, ok := ParseRetryAfter(res, t.clock().Now())
+	if !ok {
+		return 0, false
+	}
+	if t.maxRetryAfter > 0 {
+		wait = min(wait, t.maxRetryAfter)
+	}
+	return wait, true
+}
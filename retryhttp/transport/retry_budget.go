@@ -0,0 +1,128 @@
+package transport
+
+import (
+	"sync"
+	"time"
+)
+
+// retryBudgetBuckets は RetryBudget の集計期間を分割するバケット数
+const retryBudgetBuckets = 10
+
+// RetryBudget は、リクエスト数に対するリトライ数の割合を制限するトークンバケット
+// 元のリクエストごとに ratio 個のトークンが追加され、リトライごとに 1 個のトークンを消費する
+// NOTE: 障害が続いている間にリトライでトラフィックを増幅させないように、複数のゴルーチンで共有して使用する
+type RetryBudget struct {
+	ratio     float64
+	minTokens int
+	// window はトークンの有効期間。古いリクエストで貯めたトークンで大量のリトライが行われないように、期間を過ぎたトークンは失効する
+	window time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	buckets [retryBudgetBuckets]retryBudgetBucket
+}
+
+// retryBudgetBucket は、期間ごとのリクエスト数とリトライ数
+type retryBudgetBucket struct {
+	start    time.Time
+	requests int
+	retries  int
+}
+
+// NewRetryBudget は RetryBudget 構造体を作成する
+// ratio はリクエスト数に対して許可するリトライ数の割合 (0.1 の場合は 10%)
+// minTokens はリクエスト数が少ない場合でもリトライできるように、集計期間 (10 秒) ごとに常に許可するリトライ数
+func NewRetryBudget(ratio float64, minTokens int) *RetryBudget {
+	return &RetryBudget{
+		ratio:     max(ratio, 0),
+		minTokens: max(minTokens, 0),
+		window:    10 * time.Second,
+		now:       time.Now,
+	}
+}
+
+// WithRetryBudget は、RetryableTransport にリトライの予算を設定する
+// 予算を使い切った場合は、リトライせずに最後の試行の結果を返却する
+func WithRetryBudget(ratio float64, minTokens int) Option {
+	return WithSharedRetryBudget(NewRetryBudget(ratio, minTokens))
+}
+
+// WithSharedRetryBudget は、複数の RetryableTransport で共有するリトライの予算を設定する
+// NOTE: ClientPool のテナントごとの Client など、同じバックエンドに送信する複数のクライアントで予算を共有する場合に使用する
+func WithSharedRetryBudget(b *RetryBudget) Option {
+	return func(t *RetryableTransport) {
+		t.budget = b
+	}
+}
+
+// deposit は元のリクエストを記録し、トークンを追加する
+func (b *RetryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.current().requests++
+}
+
+// withdraw はトークンが残っていれば 1 個消費して true を返却する
+func (b *RetryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.balanceLocked() < 1 {
+		return false
+	}
+	b.current().retries++
+	return true
+}
+
+// Balance は現在のトークンの残数を返却する
+func (b *RetryBudget) Balance() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.balanceLocked()
+}
+
+// balanceLocked は有効期間内のリクエスト数とリトライ数からトークンの残数を算出する
+func (b *RetryBudget) balanceLocked() float64 {
+	var requests, retries int
+	for i := range b.buckets {
+		if b.expired(b.buckets[i]) {
+			continue
+		}
+		requests += b.buckets[i].requests
+		retries += b.buckets[i].retries
+	}
+	return float64(b.minTokens) + b.ratio*float64(requests) - float64(retries)
+}
+
+// current は現在時刻のバケットを返却する。古いバケットは初期化して再利用する
+func (b *RetryBudget) current() *retryBudgetBucket {
+	width := b.window / retryBudgetBuckets
+	start := b.now().Truncate(width)
+	bucket := &b.buckets[(start.UnixNano()/int64(width))%retryBudgetBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = retryBudgetBucket{start: start}
+	}
+	return bucket
+}
+
+// expired はバケットが有効期間を過ぎているか判定する
+func (b *RetryBudget) expired(bucket retryBudgetBucket) bool {
+	return bucket.start.IsZero() || b.now().Sub(bucket.start) >= b.window
+}
+
+// depositBudget は、リトライの予算が設定されている場合に元のリクエストを記録する
+func (t *RetryableTransport) depositBudget() {
+	if t.budget != nil {
+		t.budget.deposit()
+	}
+}
+
+// withdrawBudget は、リトライの予算が設定されている場合にトークンを消費する。予算を使い切っている場合は false を返却する
+func (t *RetryableTransport) withdrawBudget() bool {
+	if t.budget == nil {
+		return true
+	}
+	return t.budget.withdraw()
+}
@@ -0,0 +1,78 @@
+package transport
+
+import (
+	"net/http"
+)
+
+// RetryClass は、WithMaxAttemptsByClass で試行回数の上限を分ける、リトライの原因の分類
+type RetryClass int
+
+const (
+	// ThrottleClass は、送信先のレート制限や過負荷を表すステータスコード (429 Too Many Requests、408 Request Timeout)
+	ThrottleClass RetryClass = iota
+	// ServerErrorClass は、5xx のステータスコード
+	ServerErrorClass
+	// NetworkErrorClass は、タイムアウトや接続のリセットなどの送信エラー
+	NetworkErrorClass
+)
+
+func (c RetryClass) String() string {
+	switch c {
+	case ThrottleClass:
+		return "throttle"
+	case ServerErrorClass:
+		return "server_error"
+	case NetworkErrorClass:
+		return "network_error"
+	default:
+		return "unknown"
+	}
+}
+
+// ClassifyRetry は、試行の結果をリトライの原因で分類する。いずれにも該当しない場合は false を返却する
+func ClassifyRetry(res *http.Response, err error) (RetryClass, bool) {
+	switch {
+	case err != nil:
+		return NetworkErrorClass, true
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusRequestTimeout:
+		return ThrottleClass, true
+	case res.StatusCode >= http.StatusInternalServerError:
+		return ServerErrorClass, true
+	}
+	return 0, false
+}
+
+// WithMaxAttemptsByClass は、リトライの原因の分類ごとに、最初の試行を含めてその分類の結果となった試行の回数の上限を設定する
+// 例: WithMaxAttemptsByClass(map[RetryClass]int{ThrottleClass: 5, ServerErrorClass: 2})
+// 分類の上限を指定した場合は、その分類の結果の試行では全体の試行回数の上限より優先する。指定していない分類や 0 以下の上限は、全体の上限を使用する
+// NOTE: レート制限は待機すれば成功することが多いが、クラッシュしている送信先へのリトライは負荷を増やすだけのため、分類ごとに上限を分ける
+func WithMaxAttemptsByClass(limits map[RetryClass]int) Option {
+	return func(t *RetryableTransport) {
+		t.maxAttemptsByClass = make(map[RetryClass]int, len(limits))
+		for class, limit := range limits {
+			if limit > 0 {
+				t.maxAttemptsByClass[class] = limit
+			}
+		}
+	}
+}
+
+// classAttempts は、リトライの原因の分類ごとの試行回数
+type classAttempts [NetworkErrorClass + 1]int
+
+// attemptsExhausted は、試行回数が上限に達したか判定する
+// WithMaxAttemptsByClass でこの試行の結果の分類に上限がある場合は、分類ごとの試行回数で判定する
+// NOTE: WithAdaptiveRetry が指定されている場合は、ホストの失敗率に応じて全体の上限を減らす
+// WithForcedRetry が指定されている場合は、分類ごとの上限と失敗率による削減を行わない
+func (t *RetryableTransport) attemptsExhausted(req *http.Request, policy RetryPolicy, attempts int, counts *classAttempts, res *http.Response, err error) bool {
+	if _, forced := retryOverrideFromContext(req.Context()); forced {
+		return policy.MaxAttempts < attempts
+	}
+	if class, ok := ClassifyRetry(res, err); ok {
+		counts[class]++
+		if limit, ok := t.maxAttemptsByClass[class]; ok {
+			return counts[class] >= limit
+		}
+	}
+	return t.adaptiveMaxAttempts(req, policy.MaxAttempts) < attempts
+}
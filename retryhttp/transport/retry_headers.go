@@ -0,0 +1,84 @@
+package transport
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const (
+	// HeaderRetryAttempt は、WithRetryHeaders を指定した場合に各試行に付与する試行回数のヘッダー。最初の試行は 1
+	HeaderRetryAttempt = "X-Retry-Attempt"
+	// HeaderRetryReason は、WithRetryHeaders を指定した場合にリトライした試行に付与する、前の試行のリトライの理由のヘッダー
+	// 前の試行のステータスコード、または送信エラーの場合は "error"
+	HeaderRetryReason = "X-Retry-Reason"
+	// HeaderRetryDeadline は、WithRetryHeaders を指定した場合に各試行に付与する、試行のデッドラインのヘッダー
+	// 試行ごとのタイムアウトを含めた context.Context のデッドラインを、UTC の RFC 3339 形式で付与する
+	HeaderRetryDeadline = "X-Retry-Deadline"
+)
+
+// retryDeadlineLayout は、X-Retry-Deadline ヘッダーのミリ秒精度の RFC 3339 の形式
+const retryDeadlineLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// RetryHeaderNames は、WithRetryHeaders で付与するヘッダーの名前。空文字列の項目のヘッダーは付与しない
+type RetryHeaderNames struct {
+	Attempt  string
+	Reason   string
+	Deadline string
+}
+
+// DefaultRetryHeaderNames は、WithRetryHeaders で付与するヘッダーの名前のデフォルト
+var DefaultRetryHeaderNames = RetryHeaderNames{
+	Attempt:  HeaderRetryAttempt,
+	Reason:   HeaderRetryReason,
+	Deadline: HeaderRetryDeadline,
+}
+
+// WithRetryHeaders は、各試行に X-Retry-Attempt ヘッダーと X-Retry-Deadline ヘッダーを、リトライした試行に X-Retry-Reason ヘッダーを付与する
+// NOTE: クライアントのリトライによる重複したリクエストを、サーバー側のログで関連付けるために使用する。デフォルトでは付与しない
+// X-Retry-Deadline ヘッダーは、context.Context にデッドラインがある場合のみ付与する
+func WithRetryHeaders() Option {
+	return func(t *RetryableTransport) {
+		t.retryHeaders = true
+	}
+}
+
+// WithRetryHeaderNames は、WithRetryHeaders で付与するヘッダーの名前を names に置き換える
+// 例: WithRetryHeaderNames(RetryHeaderNames{Attempt: "X-Request-Attempt", Deadline: "X-Request-Deadline"}) は、リトライの理由を付与しない
+// NOTE: 組織内で既にヘッダーの命名規則がある場合に使用する。WithRetryHeaders も指定する必要がある
+func WithRetryHeaderNames(names RetryHeaderNames) Option {
+	return func(t *RetryableTransport) {
+		t.retryHeaderNames = &names
+	}
+}
+
+// withRetryHeaders は、WithRetryHeaders が指定されている場合に、試行回数とリトライの理由のヘッダーを付与したリクエストを返却する
+// NOTE: 呼び出し元のリクエストを変更しないように、複製してから付与する
+func (t *RetryableTransport) withRetryHeaders(req *http.Request, attempt int, reason string) *http.Request {
+	if !t.retryHeaders {
+		return req
+	}
+	names := DefaultRetryHeaderNames
+	if t.retryHeaderNames != nil {
+		names = *t.retryHeaderNames
+	}
+	stamped := req.Clone(req.Context())
+	if names.Attempt != "" {
+		stamped.Header.Set(names.Attempt, strconv.Itoa(attempt))
+	}
+	if names.Reason != "" && reason != "" {
+		stamped.Header.Set(names.Reason, reason)
+	}
+	// NOTE: 試行ごとのタイムアウトを設定した後の context.Context のため、全体と試行のデッドラインのうち早い方を付与する
+	if deadline, ok := req.Context().Deadline(); ok && names.Deadline != "" {
+		stamped.Header.Set(names.Deadline, deadline.UTC().Format(retryDeadlineLayout))
+	}
+	return stamped
+}
+
+// retryReasonHeader は、リトライの対象となった試行の結果から X-Retry-Reason ヘッダーの値を返却する
+func retryReasonHeader(res *http.Response, err error) string {
+	if err != nil || res == nil {
+		return "error"
+	}
+	return strconv.Itoa(res.StatusCode)
+}
@@ -0,0 +1,31 @@
+package transport
+
+import "context"
+
+// retryOverrideKey は context.Context に呼び出しごとのリトライの指定を格納するためのキー
+type retryOverrideKey struct{}
+
+// retryOverride は、WithoutRetry または WithForcedRetry で指定した呼び出しごとのリトライの指定
+type retryOverride struct {
+	// maxAttempts は最初の試行を含む最大試行回数。1 の場合はリトライを行わない
+	maxAttempts int
+}
+
+// WithoutRetry は、リクエストをリトライしないことを context.Context に格納する
+// NOTE: WithRetryPolicy やホストのリトライポリシーより優先するため、ユーザーが応答を待つ遅延に敏感な処理で、Client の設定に関わらずリトライを止める
+func WithoutRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryOverrideKey{}, retryOverride{maxAttempts: 1})
+}
+
+// WithForcedRetry は、最初の試行を含めて最大 maxAttempts 回試行することを context.Context に格納する
+// WithRetryPolicy やホストのリトライポリシーより優先し、WithMaxAttemptsByClass と WithAdaptiveRetry による試行回数の削減も行わない
+// NOTE: リトライするかの判定、リトライの予算、サーキットブレーカーはそのまま適用する。maxAttempts が 1 未満の場合は 1 とする
+func WithForcedRetry(ctx context.Context, maxAttempts int) context.Context {
+	return context.WithValue(ctx, retryOverrideKey{}, retryOverride{maxAttempts: max(maxAttempts, 1)})
+}
+
+// retryOverrideFromContext は context.Context に格納された呼び出しごとのリトライの指定を返却する
+func retryOverrideFromContext(ctx context.Context) (retryOverride, bool) {
+	override, ok := ctx.Value(retryOverrideKey{}).(retryOverride)
+	return override, ok
+}
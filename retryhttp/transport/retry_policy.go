@@ -0,0 +1,90 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+)
+
+// retryPolicyKey は context.Context にリトライポリシーを格納するためのキー
+type retryPolicyKey struct{}
+
+// RetryPolicy は 1 回のリクエストに適用するリトライの設定
+// ゼロ値の項目は RetryableTransport の設定を使用する
+type RetryPolicy struct {
+	// MaxAttempts は最初の試行を含む最大試行回数。1 の場合はリトライを行わない
+	MaxAttempts int
+	CheckRetry  CheckRetryFunc
+	Backoff     BackoffFunc
+	// CheckRetryContext は CheckRetry の代わりに使用する判定の関数。両方を指定した場合は CheckRetryContext を優先する
+	CheckRetryContext CheckRetryContextFunc
+	// ResponseBackoff は Backoff と Retry-After ヘッダーの代わりに使用するバックオフ。両方を指定した場合は ResponseBackoff を優先する
+	ResponseBackoff ResponseBackoffFunc
+}
+
+// NoRetry はリトライを行わないリトライポリシー。冪等でない POST などに使用する
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+// WithRetryPolicy は context.Context にリトライポリシーを格納する
+// NOTE: 同じ Client を冪等な GET とリトライできない POST の両方に使用する場合に、リクエストごとに設定を切り替える
+func WithRetryPolicy(ctx context.Context, policy RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyKey{}, policy)
+}
+
+// RetryPolicyFromContext は context.Context に格納されたリトライポリシーを返却する
+func RetryPolicyFromContext(ctx context.Context) (RetryPolicy, bool) {
+	policy, ok := ctx.Value(retryPolicyKey{}).(RetryPolicy)
+	return policy, ok
+}
+
+// policy は、リクエスト先のホストのリトライポリシーと context.Context のリトライポリシーを RetryableTransport の設定で補完して返却する
+// NOTE: 返却する MaxAttempts は、RetryableTransport.maxAttempts と同様にリトライ回数を表す
+// CheckRetryContext には、CheckRetry を変換した関数を含めて判定に使用する関数を設定する
+// 同じ項目を指定している場合は、WithoutRetry と WithForcedRetry、context.Context、ホスト、WithCanaryPolicy (canary が true の場合)、RetryableTransport の順に優先する
+func (t *RetryableTransport) policy(req *http.Request, canary bool) RetryPolicy {
+	effective := RetryPolicy{
+		MaxAttempts:       t.maxAttempts,
+		CheckRetry:        t.checkRetry,
+		Backoff:           t.backoff,
+		CheckRetryContext: t.checkRetryContext,
+		ResponseBackoff:   t.responseBackoff,
+	}
+	if effective.CheckRetryContext == nil && t.checkRetry != nil {
+		effective.CheckRetryContext = AdaptCheckRetry(t.checkRetry)
+	}
+	if canary {
+		effective = effective.override(t.canary.policy)
+	}
+	if policy, ok := t.hostPolicy(req); ok {
+		effective = effective.override(policy)
+	}
+	if policy, ok := RetryPolicyFromContext(req.Context()); ok {
+		effective = effective.override(policy)
+	}
+	if override, ok := retryOverrideFromContext(req.Context()); ok {
+		effective.MaxAttempts = override.maxAttempts - 1
+	}
+	return effective
+}
+
+// override は、policy で指定されている項目で上書きしたリトライポリシーを返却する
+func (p RetryPolicy) override(policy RetryPolicy) RetryPolicy {
+	if policy.MaxAttempts > 0 {
+		p.MaxAttempts = policy.MaxAttempts - 1
+	}
+	if policy.CheckRetry != nil {
+		p.CheckRetry = policy.CheckRetry
+		p.CheckRetryContext = AdaptCheckRetry(policy.CheckRetry)
+	}
+	if policy.CheckRetryContext != nil {
+		p.CheckRetryContext = policy.CheckRetryContext
+	}
+	// NOTE: Backoff のみを指定した場合は、補完元の ResponseBackoff より Backoff を優先する
+	if policy.Backoff != nil {
+		p.Backoff = policy.Backoff
+		p.ResponseBackoff = nil
+	}
+	if policy.ResponseBackoff != nil {
+		p.ResponseBackoff = policy.ResponseBackoff
+	}
+	return p
+}
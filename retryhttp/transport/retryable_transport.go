@@ -0,0 +1,723 @@
+package transport
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CheckRetryFunc は、レスポンスとエラー内容から、リトライを行うか判定する関数の型定義
+type CheckRetryFunc func(*http.Response, error) bool
+
+// BackoffFunc は、バックオフを取得する関数の型定義
+type BackoffFunc func(attempts int) time.Duration
+
+// Backoff は、試行回数からリトライまでの待機時間を算出するインターフェース
+// NOTE: BackoffFunc は Backoff を実装するため、関数は BackoffFunc に変換して Backoff として使用できる
+type Backoff interface {
+	Backoff(attempts int) time.Duration
+}
+
+// Backoff は f(attempts) を返却する
+func (f BackoffFunc) Backoff(attempts int) time.Duration {
+	return f(attempts)
+}
+
+// RetryableTransport はリトライを行うための http.RoundTripper 具象型
+type RetryableTransport struct {
+	wrapped     http.RoundTripper
+	maxAttempts int
+	checkRetry  CheckRetryFunc
+	backoff     BackoffFunc
+	recorders   []Recorder
+	routes      *RouteTemplates
+	logLevels   map[LogEvent]slog.Level
+	silent      bool
+	// maxLogLevel は、ログの種類ごとのログレベルのうち最も高いログレベル
+	maxLogLevel slog.Level
+	blackouts   []BlackoutWindow
+	// attemptTimeout は 1 回の試行のタイムアウト。0 の場合は設定しない
+	attemptTimeout time.Duration
+	// alreadyDone はリトライ時に処理済みとみなす HTTP メソッドごとのステータスコード
+	alreadyDone map[string]map[int]bool
+	// maxRetryAfter は Retry-After ヘッダーの値を待機時間とする場合の上限。0 の場合は上限なし
+	maxRetryAfter    time.Duration
+	ignoreRetryAfter bool
+	breaker          *CircuitBreaker
+	errorCodes       *ErrorCodeTable
+	budget           *RetryBudget
+	onRequest        []RequestHook
+	onResponse       []ResponseHook
+	onRetry          []RetryHook
+	tracer           trace.Tracer
+	logger           *slog.Logger
+	// retryNonIdempotent は冪等でないリクエストもリトライするか
+	retryNonIdempotent bool
+	clk                Clock
+	// maxElapsed はリクエスト全体の所要時間の上限。0 の場合は上限なし
+	maxElapsed         time.Duration
+	noMisdirectedRetry bool
+	// abandonedConnections はレスポンスボディを読み切れずに破棄したコネクションの数
+	abandonedConnections atomic.Int64
+	attemptsHeader       bool
+	// checkRetryContext は WithCheckRetryContext で設定した判定の関数。設定されている場合は checkRetry より優先する
+	checkRetryContext CheckRetryContextFunc
+	// hedgeDelay はヘッジリクエストを送信するまでの時間。0 の場合はヘッジリクエストを送信しない
+	hedgeDelay time.Duration
+	maxHedges  int
+	hosts      HostSelector
+	ramp       *recoveryRamp
+	// maxBodyBuffer はリトライのためにリクエストボディをバッファリングする上限のバイト数。0 の場合はデフォルト値
+	maxBodyBuffer int64
+	// idempotencyKey は冪等キーを生成する関数。nil の場合は冪等キーを付与しない
+	idempotencyKey func() string
+	// firstByteTimeout は 1 回の試行で最初のバイトを受信するまでのタイムアウト。0 の場合は設定しない
+	firstByteTimeout time.Duration
+	retryHeaders     bool
+	bodyTransformer  BodyTransformer
+	limiter          Limiter
+	authRefresher    AuthRefresher
+	redirects        *RedirectTable
+	hints            hintTable
+	maxDrainBytes    int64
+	hostPolicies     map[string]RetryPolicy
+	adaptive         *adaptiveRetry
+	// noStaleConnectionRetry は、再利用したコネクションの切断で即座にリトライする動作を無効にするか
+	noStaleConnectionRetry bool
+	// staleConnectionRetries は、再利用したコネクションの切断で新しいコネクションでリトライした回数
+	staleConnectionRetries atomic.Int64
+	// validateResponse は WithValidateResponse で設定したレスポンスを検証する関数
+	validateResponse  func(*http.Response) error
+	responseBackoff   ResponseBackoffFunc
+	rangeResume       bool
+	shutdown          shutdownState
+	retryHeaderNames  *RetryHeaderNames
+	concurrency       *concurrencyLimiter
+	maxQueuedRequests int
+	requestCostFunc   func(*http.Request) int
+	hostRateLimit     *hostRateLimit
+	hostConcurrency   *hostConcurrency
+	fairQueuing       bool
+	dump              *attemptDump
+	// maxAttemptsByClass は、リトライの原因の分類ごとの試行回数の上限
+	maxAttemptsByClass map[RetryClass]int
+	onTrace            []TraceHook
+	requestReducer     RequestReducer
+	noRetrySignals     *noRetrySignals
+	// stats は Stats で返却する統計情報のカウンター
+	stats transportStats
+	// canary は WithCanaryPolicy で設定したリトライポリシー
+	canary *canaryRollout
+	// proxyRotation は WithProxyRotation で設定した、試行ごとに切り替えるプロキシ
+	proxyRotation *proxyRotation
+	// noHTTP2RefusedRetry は、HTTP/2 の GOAWAY や REFUSED_STREAM で即座にリトライする動作を無効にするか
+	// http2RefusedIsolation は、その次の試行で新しいコネクションを使用するか
+	noHTTP2RefusedRetry   bool
+	http2RefusedIsolation bool
+}
+
+// Option は RetryableTransport の設定を変更する関数の型定義
+type Option func(*RetryableTransport)
+
+// NewRetryableTransport は RetryableTransport 構造体を作成する
+func NewRetryableTransport(transport http.RoundTripper, maxRetryCounts int,
+	shouldRetry CheckRetryFunc, backoff BackoffFunc, opts ...Option) *RetryableTransport {
+	t := &RetryableTransport{
+		wrapped:     transport,
+		maxAttempts: maxRetryCounts,
+		checkRetry:  shouldRetry,
+		backoff:     backoff,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.maxLogLevel = t.highestLogLevel()
+	return t
+}
+
+// defaultMaxDrainBytes は、WithMaxDrainBytes が指定されていない場合に、コネクションを再利用するために読み捨てるレスポンスボディの最大バイト数
+// NOTE: これより大きいボディは、読み捨てるよりも新しいコネクションを確立する方が安価なため、読み切らずにクローズする
+// エラーレスポンスの HTML を試行ごとに数 MB 読み込まないように、小さな値にしている
+const defaultMaxDrainBytes = 4 << 10
+
+// WithMaxDrainBytes は、リトライ前にコネクションを再利用するために読み捨てるレスポンスボディの最大バイト数を n に変更する
+// n より大きいボディは読み切らずにクローズし、コネクションを破棄する。n が負の場合は読み捨てずに常にクローズする
+func WithMaxDrainBytes(n int64) Option {
+	return func(t *RetryableTransport) {
+		if n < 0 {
+			n = -1
+		}
+		t.maxDrainBytes = n
+	}
+}
+
+// drainLimit は読み捨てるレスポンスボディの最大バイト数を返却する。負の場合は読み捨てない
+func (t *RetryableTransport) drainLimit() int64 {
+	if t.maxDrainBytes == 0 {
+		return defaultMaxDrainBytes
+	}
+	return t.maxDrainBytes
+}
+
+// drainBody はレスポンスボディを読み切ってクローズする
+// NOTE: コネクションを再利用するには、レスポンスボディを読み切ってクローズする必要がある
+// 読み切れなかった場合はコネクションが再利用されず、次の試行は新しいコネクションで送信されるため、エラーにはせずに false を返却する
+func (t *RetryableTransport) drainBody(res *http.Response) (reused bool) {
+	// 送信エラーの場合はレスポンスがない
+	if res == nil || res.Body == nil {
+		return true
+	}
+	limit := t.drainLimit()
+	if limit < 0 {
+		_ = res.Body.Close()
+		t.abandonedConnections.Add(1)
+		return false
+	}
+	n, err := io.Copy(io.Discard, io.LimitReader(res.Body, limit+1))
+	closeErr := res.Body.Close()
+	if err == nil && closeErr == nil && n <= limit {
+		return true
+	}
+	t.abandonedConnections.Add(1)
+	return false
+}
+
+// AbandonedConnections は、リトライ前にレスポンスボディを読み切れなかったため、再利用せずに破棄したコネクションの数を返却する
+// NOTE: 値が大きい場合は、エラーレスポンスのボディが大きいか、ボディの読み込み中に切断されている
+func (t *RetryableTransport) AbandonedConnections() int64 {
+	return t.abandonedConnections.Load()
+}
+
+// readTrackingBody は io.ReadCloser の具象型。http.Request の Body をラップするために使用する
+// readTrackingBody.Read と readTrackingBody.Close メソッドを実装することで io.ReadCloser インターフェースを満たす
+type readTrackingBody struct {
+	io.ReadCloser
+	didRead  bool
+	didClose bool
+}
+
+func (r *readTrackingBody) Read(data []byte) (int, error) {
+	r.didRead = true
+	return r.ReadCloser.Read(data)
+}
+
+func (r *readTrackingBody) Close() error {
+	r.didClose = true
+	return r.ReadCloser.Close()
+}
+
+// setupRewindBody は、リトライ時にリクエストボディを巻き戻せるように、状態を持った構造体にラップする
+// GetBody がない場合は、最初の試行の前に GetBody を合成する。リクエストボディが io.Seeker を実装している場合 (*os.File など) は、
+// 送信前の位置に Seek して巻き戻し、それ以外の場合は limit バイトまでリクエストボディを読み込む
+// NOTE: 試行で一部が読み込まれた後のボディを読み込むと、リトライで壊れたボディを送信するため、送信前に読み込む
+// limit を超えるボディは巻き戻せないため、GetBody を設定せずにそのまま送信する
+// 返却する関数は、RoundTrip の終了時にリクエストボディをクローズする関数。io.Seeker の場合は試行ごとにクローズしないため、最後にクローズする
+// 読み込んだボディの場合は、バッファをプールに戻す
+func setupRewindBody(req *http.Request, limit int64) (*http.Request, func(), error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, func() {}, nil
+	}
+	newReq := *req
+	body := req.Body
+	closeBody := func() {}
+
+	if req.GetBody == nil {
+		if seeker, offset, ok := seekableBody(req.Body); ok {
+			// NOTE: 大きなファイルをメモリに読み込まないように、試行ごとに送信前の位置に Seek する
+			newReq.GetBody = func() (io.ReadCloser, error) {
+				if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+					return nil, err
+				}
+				return io.NopCloser(seeker), nil
+			}
+			body = io.NopCloser(seeker)
+			closeBody = func() { _ = req.Body.Close() }
+		} else {
+			// NOTE: 試行ごとにボディを複製しないように、プールのバッファに 1 回だけ読み込み、試行ごとに読み込む位置を先頭に戻す
+			pooled, head, ok, err := newPooledBody(req.Body, limit)
+			if err != nil {
+				_ = req.Body.Close()
+				return nil, nil, err
+			}
+			if ok {
+				_ = req.Body.Close()
+				newReq.GetBody = pooled.getBody
+				body, _ = pooled.getBody()
+				closeBody = pooled.release
+			} else {
+				body = &partialBody{Reader: io.MultiReader(bytes.NewReader(head), req.Body), Closer: req.Body}
+			}
+		}
+	}
+
+	newReq.Body = &readTrackingBody{ReadCloser: body}
+	return &newReq, closeBody, nil
+}
+
+// seekableBody は、リクエストボディが io.Seeker を実装していて Seek できる場合に、現在の位置を返却する
+func seekableBody(body io.ReadCloser) (io.ReadSeeker, int64, bool) {
+	seeker, ok := body.(io.ReadSeeker)
+	if !ok {
+		return nil, 0, false
+	}
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, 0, false
+	}
+	return seeker, offset, true
+}
+
+// partialBody は、先頭を読み込んだ後のリクエストボディを復元した io.ReadCloser 具象型
+type partialBody struct {
+	io.Reader
+	io.Closer
+}
+
+// rewindBody はリクエストボディを巻き戻す
+// NOTE: bytes.Buffer など一部の io.ReadCloser 具象型では、リトライ時に冪等なリクエストにならないため巻き戻す必要がある
+func (t *RetryableTransport) rewindBody(req *http.Request) (rewoundBody *http.Request, err error) {
+	// リクエストボディがない、または読み込み、クローズが行われている場合は巻き戻さない
+	if req.Body == nil || req.Body == http.NoBody || (!req.Body.(*readTrackingBody).didRead && !req.Body.(*readTrackingBody).didClose) {
+		return req, nil
+	}
+
+	// 上限を超えたためにバッファリングしていないボディは巻き戻せない
+	if req.GetBody == nil {
+		return nil, &RequestBodyTooLargeError{Limit: t.bodyBufferLimit()}
+	}
+
+	// リクエストボディがクローズされていない場合はクローズする
+	if !req.Body.(*readTrackingBody).didClose {
+		err := req.Body.Close()
+		if err != nil {
+			return nil, &RewindError{Err: err}
+		}
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, &RewindError{Err: err}
+	}
+
+	newReq := *req
+	newReq.Body = &readTrackingBody{
+		ReadCloser: body,
+	}
+	return &newReq, nil
+}
+
+// canRewind は、リトライ時にリクエストボディを巻き戻せるか判定する
+func canRewind(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// transport は親の Transport を返却する。親がない場合は、http.DefaultTransport を返却する
+func (t *RetryableTransport) transport() http.RoundTripper {
+	if t.wrapped == nil {
+		return http.DefaultTransport
+	}
+	return t.wrapped
+}
+
+// RoundTrip はリクエスト送信エラーの場合にリトライを行う
+// NOTE: このメソッドを実装することで、transport.RetryableTransport は http.RoundTripper インターフェースを満たす
+func (t *RetryableTransport) RoundTrip(req *http.Request) (res *http.Response, err error) {
+	// Shutdown の後は新しいリクエストを送信しない
+	if !t.shutdown.enter() {
+		return nil, ErrShutdown
+	}
+	defer t.shutdown.leave()
+
+	// 統計情報に、リクエストと送信中のリクエストを集計する
+	t.stats.requests.Add(1)
+	t.stats.inFlight.Add(1)
+	defer t.stats.inFlight.Add(-1)
+
+	// コンテキストを取得する
+	ctx := req.Context()
+
+	// リクエスト全体の結果を記録する
+	start := t.clock().Now()
+	var attempts int
+	var succeeded, exhausted bool
+	// WithCanaryPolicy が設定されている場合は、一部のリクエストに policy を適用する
+	canary := t.selectCanary()
+	defer func() {
+		if exhausted {
+			t.stats.exhausted.Add(1)
+		}
+		duration := t.clock().Now().Sub(start)
+		t.recordCanary(canary, attempts, succeeded, duration)
+		t.record(req, res, err, attempts, succeeded, exhausted, canary, duration)
+		t.setAttemptsHeader(res, attempts)
+	}()
+
+	// トレースが有効な場合は、リクエスト全体のスパンを開始する
+	ctx, endSpan := t.startSpan(ctx, req)
+	defer func() {
+		endSpan(res, err, attempts, exhausted)
+	}()
+	req = req.WithContext(ctx)
+
+	// ログにリクエストの情報とアノテーションを付与する
+	logArgs := t.newRequestLogArgs(ctx, req)
+
+	// リトライの予算にトークンを追加する
+	t.depositBudget()
+
+	// ホストごとやリクエストごとのリトライポリシーがあれば優先する
+	policy := t.policy(req, canary)
+
+	// 冪等でないリクエストには、すべての試行で同じ冪等キーを付与する
+	req = t.withIdempotencyKey(req)
+
+	// 巻き戻せるように、状態を持った構造体にラップする
+	req, closeBody, err := setupRewindBody(req, t.bodyBufferLimit())
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody()
+
+	// レスポンスから参照できるように、メタデータを context.Context に格納する
+	metadata := &ResponseMetadata{}
+	req = req.WithContext(withMetadata(ctx, metadata))
+
+	// HostSelector が設定されている場合は、試行ごとに送信先を切り替える
+	hosts := t.selectHosts(req)
+
+	// misdirected は 421 Misdirected Request でリトライしたか、isolate は次の試行で新しいコネクションを使用するか
+	var misdirected, isolate bool
+	// staleConnection は、再利用したコネクションの切断で新しいコネクションでリトライしたか
+	var staleConnection bool
+	// retryReason は X-Retry-Reason ヘッダーに付与する、前の試行のリトライの理由
+	var retryReason string
+	// authToken は WithAuthRefresher で更新したトークン、refreshedAuth は認証情報を更新してリトライしたか
+	var authToken string
+	var refreshedAuth bool
+	// reduced は WithRequestReducer でリクエストを小さくしてリトライしたか
+	var reduced bool
+	// classCounts は、WithMaxAttemptsByClass のリトライの原因の分類ごとの試行回数
+	var classCounts classAttempts
+	// proxyStart は、WithProxyRotation で最初の試行に使用するプロキシの位置
+	proxyStart := t.startProxyRotation()
+
+	// リトライ処理
+	for {
+		attempts++
+
+		// Shutdown を呼び出した後は、リトライせずに終了する
+		if attempts > 1 && t.shutdown.isClosed() {
+			return nil, ErrShutdown
+		}
+
+		// ブラックアウト期間中であれば、リトライせずに失敗するか期間の終了まで待機する
+		if err := t.waitBlackout(ctx, req); err != nil {
+			return nil, err
+		}
+
+		// ブラックアウト期間の終了直後やサーキットブレーカーが閉じた直後は、リクエストを段階的に解放する
+		targetReq, host := withAttemptHost(req, hosts, attempts)
+		if err := t.waitRamp(ctx, targetReq.URL.Host); err != nil {
+			return nil, err
+		}
+
+		// 巻き戻したリクエストボディを取得する
+		// NOTE: 巻き戻しに失敗したリクエストを送信すると壊れたボディを送信するため、サーキットブレーカーの確認より前に *RewindError を返却する
+		rewoundReq, err := t.rewindBody(req)
+		if err != nil {
+			return nil, err
+		}
+		rewoundReq, err = t.transformBody(rewoundReq, attempts)
+		if err != nil {
+			return nil, err
+		}
+
+		// リトライを含めた送信数を制限する
+		if err := t.waitLimiter(targetReq); err != nil {
+			return nil, err
+		}
+
+		// 同時に送信する試行の数を、ホストごとと全体で制限する
+		releaseHost, err := t.acquireHostSlot(targetReq)
+		if err != nil {
+			return nil, err
+		}
+		releaseSlot, err := t.acquireSlot(ctx)
+		if err != nil {
+			releaseHost()
+			return nil, err
+		}
+		release := func() {
+			releaseSlot()
+			releaseHost()
+		}
+
+		// サーキットブレーカーが開いていれば、リトライせずに失敗する
+		reportCircuit, err := t.allowCircuit(targetReq)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		rewoundReq, _ = withAttemptHost(rewoundReq, hosts, attempts)
+		rewoundReq = withAuthorization(rewoundReq, authToken)
+		metadata.resetAttempt()
+		if host != nil {
+			metadata.setHost(host)
+		}
+
+		if t.logEnabled(ctx, LogEventRequestStart) {
+			t.log(ctx, LogEventRequestStart, "request start", logArgs.with("attempt", attempts)...)
+		}
+
+		// 試行ごとのタイムアウトを設定する
+		attemptReq, cancelAttempt := t.withAttemptTimeout(rewoundReq)
+		cancelAttempt = withRelease(cancelAttempt, release)
+
+		// 送信前のフックを呼び出す
+		attemptReq = t.withRetryHeaders(attemptReq, attempts, retryReason)
+		attemptReq = t.beforeAttempt(attempts, attemptReq)
+		t.dumpRequest(ctx, attempts, attemptReq, logArgs)
+		attemptReq = t.withAttemptTrace(attemptReq, attempts, logArgs)
+
+		// リクエストを送信
+		attemptReq, endAttemptSpan := t.startAttemptSpan(attemptReq, attempts)
+		// WithProxyRotation が設定されている場合は、前の試行と異なるプロキシで送信する
+		attemptReq, rt := t.proxyTransport(attemptReq, proxyStart, attempts)
+		if isolate {
+			rt, isolate = isolatedTransport(rt), false
+		}
+		attemptStart := t.clock().Now()
+		t.stats.attempts.Add(1)
+		res, err := t.roundTripHedged(rt, attemptReq, logArgs)
+		err = t.attemptError(ctx, attemptReq, err)
+		metadata.recordAttempt(attemptResult(attempts, res, err, t.clock().Now().Sub(attemptStart)))
+		endAttemptSpan(res, err)
+		t.dumpResponse(ctx, attempts, res, err, logArgs)
+
+		if t.logEnabled(ctx, LogEventRequestEnd) {
+			t.log(ctx, LogEventRequestEnd, "request end", logArgs.with(attemptResultArgs(attempts, res, err)...)...)
+		}
+		reportCircuit(res, err)
+		t.reportHost(host, res, err)
+		t.observeHint(attemptReq, res)
+		t.observeAdaptive(req, res, err)
+		t.afterAttempt(attempts, res, err)
+
+		// 親の Transport がパニックした場合は、同じ不具合を繰り返さないようにリトライせずに返却する
+		if isPanic(err) {
+			cancelAttempt()
+			return nil, err
+		}
+
+		// レスポンスの検証に失敗した場合は、レスポンスを破棄して送信エラーと同様に扱う
+		if validateErr := t.validate(res, err); validateErr != nil {
+			t.drainBody(res)
+			res, err = nil, validateErr
+		}
+
+		// リトライした試行で処理済みを表すレスポンスを受け取った場合は、成功とみなして返却する
+		if err == nil && t.isAlreadyDone(req, res, attempts) {
+			metadata.markAlreadyDone()
+			succeeded = true
+			return cancelOnClose(res, cancelAttempt), nil
+		}
+
+		// 421 Misdirected Request の場合は、試行回数の上限までは新しいコネクションで即座にリトライする
+		if t.shouldRetryMisdirected(req, res, err, misdirected) && attempts <= policy.MaxAttempts {
+			misdirected, isolate = true, true
+			retryReason = retryReasonHeader(res, err)
+			t.stats.retry(retryCauseMisdirected)
+			t.drainBody(res)
+			cancelAttempt()
+			continue
+		}
+
+		// HTTP/2 のサーバーが GOAWAY や REFUSED_STREAM でストリームを拒否した場合は、試行回数の上限までは即座にリトライする
+		if t.shouldRetryHTTP2Refused(req, err) && attempts <= policy.MaxAttempts {
+			isolate = t.http2RefusedIsolation
+			retryReason = retryReasonHeader(res, err)
+			t.stats.retry(retryCauseHTTP2Refused)
+			if t.logEnabled(ctx, LogEventHTTP2Refused) {
+				t.log(ctx, LogEventHTTP2Refused, "http2 refused", logArgs.with(attemptResultArgs(attempts, res, err)...)...)
+			}
+			cancelAttempt()
+			continue
+		}
+
+		// 再利用したコネクションがサーバーにクローズされていた場合は、新しいコネクションで即座に 1 回だけリトライする
+		if t.shouldRetryStaleConnection(req, err, metadata, staleConnection) && attempts <= policy.MaxAttempts {
+			staleConnection, isolate = true, true
+			retryReason = retryReasonHeader(res, err)
+			t.staleConnectionRetries.Add(1)
+			t.stats.retry(retryCauseStaleConnection)
+			if t.logEnabled(ctx, LogEventStaleConnection) {
+				t.log(ctx, LogEventStaleConnection, "stale connection", logArgs.with(attemptResultArgs(attempts, res, err)...)...)
+			}
+			cancelAttempt()
+			continue
+		}
+
+		// 401 Unauthorized や 403 Forbidden の場合は、認証情報を更新して即座に 1 回だけリトライする
+		if t.shouldRefreshAuth(res, err, refreshedAuth) && canRewind(req) {
+			refreshedAuth = true
+			retryReason = retryReasonHeader(res, err)
+			t.stats.retry(retryCauseAuthRefresh)
+			t.drainBody(res)
+			cancelAttempt()
+			if authToken, err = t.refreshAuth(ctx); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// 431 Request Header Fields Too Large や 414 URI Too Long の場合は、リクエストを小さくして即座に 1 回だけリトライする
+		if t.shouldReduceRequest(res, err, reduced) {
+			reducedReq, closeReduced, ok, reduceErr := t.reduceRequest(req, res)
+			if reduceErr != nil {
+				t.drainBody(res)
+				cancelAttempt()
+				return nil, reduceErr
+			}
+			if ok {
+				reduced, req = true, reducedReq
+				defer closeReduced()
+				retryReason = retryReasonHeader(res, err)
+				t.stats.retry(retryCauseRequestReduced)
+				t.drainBody(res)
+				cancelAttempt()
+				continue
+			}
+		}
+
+		// リトライ不要なら結果を返却する
+		// NOTE: AttemptWritePhase で書き込みの前後を判定できるように、メタデータを格納した context.Context を渡す
+		shouldRetry, checkErr := policy.CheckRetryContext(req.Context(), attempts, req, res, err)
+		// 判定の関数が待機時間を指定した場合は、その時間だけ待機してリトライする
+		overrideWait, override := retryAfterOverride(checkErr)
+		if override {
+			shouldRetry, checkErr = true, nil
+		}
+		// 判定の関数がエラーを返却した場合は、リトライを中止してそのエラーを返却する
+		if checkErr != nil {
+			t.drainBody(res)
+			cancelAttempt()
+			return nil, checkErr
+		}
+		// ベンダー固有のエラーコードの対応がある場合は、そちらの判定を優先する
+		vendorErr, rule, ok := t.classifyErrorCode(req, res)
+		if ok {
+			metadata.setVendorError(vendorErr)
+			shouldRetry = rule.Retryable
+		}
+		// リダイレクトの対応表でリトライを指定したステータスコードは、リトライする
+		if t.shouldRetryRedirect(req, res) {
+			shouldRetry = true
+		}
+		// WithValidateResponse の検証に失敗したレスポンスは、リトライする
+		if isResponseValidationError(err) {
+			shouldRetry = true
+		}
+		// 冪等でないリクエストは、重複した副作用を避けるためリトライしない
+		if shouldRetry && !t.canRetryMethod(req, res, err, metadata) {
+			shouldRetry = false
+		}
+		// サーバーがリトライしないように指示した場合は、リトライしない
+		if shouldRetry && t.noRetrySignaled(res) {
+			shouldRetry = false
+		}
+		if !shouldRetry {
+			succeeded = err == nil
+			return t.withRangeResume(req, cancelOnClose(res, cancelAttempt), policy), err
+		}
+
+		// 試行回数が上限なら結果を返却する
+		// NOTE: WithMaxAttemptsByClass が指定されている場合は、リトライの原因の分類ごとの上限で判定する
+		if t.attemptsExhausted(req, policy, attempts, &classCounts, res, err) {
+			exhausted = true
+			return cancelOnClose(res, cancelAttempt), metadata.exhaust(err)
+		}
+
+		// リクエストボディが上限を超えていて巻き戻せない場合は、壊れたボディを送信しないようにリトライせずに終了する
+		if !canRewind(req) {
+			t.drainBody(res)
+			cancelAttempt()
+			return nil, t.bodyTooLarge(res, err)
+		}
+
+		// リトライの予算を使い切っている場合は、トラフィックを増幅させないように結果を返却する
+		if !t.withdrawBudget() {
+			if t.logEnabled(ctx, LogEventBudgetExhausted) {
+				t.log(ctx, LogEventBudgetExhausted, "retry budget exhausted", logArgs.with("attempt", attempts)...)
+			}
+			exhausted = true
+			return cancelOnClose(res, cancelAttempt), metadata.exhaust(err)
+		}
+
+		// 書き込み後に送信エラーとなった非冪等なリクエストは、サーバーが処理済みの可能性があるため記録する
+		if err != nil && !isIdempotent(req) && metadata.attemptWroteRequest() {
+			metadata.markPossibleDuplicate()
+		}
+
+		// リトライまでのバックオフを取得する
+		// NOTE: レート制限などでサーバーが Retry-After ヘッダーで待機時間を指定した場合は、その値を優先する
+		// 判定の関数が待機時間を指定した場合は、さらにその値を優先する
+		// ResponseBackoff を指定した場合は、Retry-After ヘッダーと Backoff の代わりに使用する
+		wait, ok := overrideWait, override
+		if !ok && policy.ResponseBackoff != nil {
+			wait, ok = policy.ResponseBackoff(attempts, res), true
+		}
+		if !ok {
+			wait, ok = t.retryAfter(res)
+		}
+		if !ok {
+			wait = t.adaptiveBackoff(req, policy.Backoff(attempts))
+		}
+
+		// 待機すると所要時間の上限を超える場合は、最後の試行の結果を返却する
+		if t.exceedsMaxElapsed(start, wait) {
+			exhausted = true
+			return cancelOnClose(res, cancelAttempt), metadata.exhaust(err)
+		}
+
+		// 待機するとデッドラインを過ぎる場合は、リトライせずに終了する
+		if deadlineErr := t.exceedsDeadline(ctx, wait, attempts, res, err); deadlineErr != nil {
+			t.drainBody(res)
+			cancelAttempt()
+			return nil, deadlineErr
+		}
+
+		if t.logEnabled(ctx, LogEventBackoff) {
+			t.log(ctx, LogEventBackoff, "backoff", logArgs.with("attempt", attempts, "wait", wait)...)
+		}
+		metadata.recordWait(wait)
+		t.beforeRetry(attempts, wait, res, err, vendorErr)
+		retryReason = retryReasonHeader(res, err)
+		t.stats.retry(classifyRetryCause(res, err))
+		t.spanBackoff(ctx, attempts, wait)
+
+		// 呼び出し元でタイムアウトやキャンセルされている場合があるので、処理を継続する必要があるか確認する
+		// NOTE: Transport に CancelRequest を実装する方法もあるが、CancelRequest は HTTP/2 をキャンセルできないので非推奨
+		// 遅延処理を行い、待機中に context.Context が終了した場合はエラーを返却する
+		// Shutdown を呼び出した場合も、待機を中断して ErrShutdown を返却する
+		// NOTE: バックオフの待機中は試行を送信していないため、WithMaxConcurrentRequests と WithMaxConcurrentRequestsPerHost の枠を解放する
+		release()
+		if err := t.sleepUnlessShutdown(ctx, wait); err != nil {
+			cancelAttempt()
+			return nil, err
+		}
+
+		// コネクションを再利用するためにレスポンスボディを読み切ってクローズする
+		// NOTE: 読み切れなかった場合もコネクションを破棄するだけで、リトライは継続する
+		if !t.drainBody(res) {
+			if t.logEnabled(ctx, LogEventConnectionAbandoned) {
+				t.log(ctx, LogEventConnectionAbandoned, "connection abandoned", logArgs.with("attempt", attempts)...)
+			}
+		}
+		cancelAttempt()
+	}
+}
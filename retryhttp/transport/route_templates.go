@@ -0,0 +1,98 @@
+package transport
+
+import (
+	"strings"
+	"sync"
+)
+
+// RouteTemplates は、メトリクスのラベルに使用するために URL パスをテンプレートに正規化する
+// 例えば "/users/{id}" を登録すると、"/users/123" は "/users/{id}" に正規化される
+// NOTE: 生のパスをラベルに使用すると、Prometheus などでカーディナリティが爆発するため使用する
+type RouteTemplates struct {
+	mu       sync.RWMutex
+	patterns []routePattern
+}
+
+// routePattern は "/" で分割したテンプレートのセグメント
+type routePattern struct {
+	template string
+	segments []string
+}
+
+// NewRouteTemplates は RouteTemplates 構造体を作成する
+func NewRouteTemplates(patterns ...string) *RouteTemplates {
+	r := &RouteTemplates{}
+	for _, p := range patterns {
+		r.Register(p)
+	}
+	return r
+}
+
+// Register はテンプレートを登録する。"{name}" は任意の 1 セグメントに、末尾の "*" は残りすべてのセグメントに一致する
+// NOTE: 先に登録したテンプレートが優先される
+func (r *RouteTemplates) Register(pattern string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.patterns = append(r.patterns, routePattern{
+		template: pattern,
+		segments: splitPath(pattern),
+	})
+}
+
+// UnmatchedRoute は、登録したテンプレートに一致しないパスを正規化したルート
+const UnmatchedRoute = "other"
+
+// Normalize はパスに一致するテンプレートを返却する。一致するテンプレートがない場合は UnmatchedRoute を返却する
+// NOTE: 未登録のパスのセグメントをラベルに含めると、ID の形式によってはカーディナリティが抑えられないため、固定の値にまとめる
+func (r *RouteTemplates) Normalize(path string) string {
+	segments := splitPath(path)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, p := range r.patterns {
+		if p.match(segments) {
+			return p.template
+		}
+	}
+	return UnmatchedRoute
+}
+
+// match はセグメントがテンプレートに一致するか判定する
+func (p routePattern) match(segments []string) bool {
+	for i, s := range p.segments {
+		if s == "*" && i == len(p.segments)-1 {
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+			continue
+		}
+		if s != segments[i] {
+			return false
+		}
+	}
+	return len(p.segments) == len(segments)
+}
+
+// WithRouteTemplates は、RequestResult.Route に正規化したパスを設定する
+func WithRouteTemplates(r *RouteTemplates) Option {
+	return func(t *RetryableTransport) {
+		t.routes = r
+	}
+}
+
+// splitPath はパスを "/" で分割する。空のセグメントは除外する
+func splitPath(path string) []string {
+	parts := strings.Split(path, "/")
+	segments := parts[:0]
+	for _, p := range parts {
+		if p != "" {
+			segments = append(segments, p)
+		}
+	}
+	return segments
+}
@@ -0,0 +1,58 @@
+package transport
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestRouteTemplatesNormalize(t *testing.T) {
+	routes := NewRouteTemplates("/users/{id}", "/users/me", "/files/*", "/")
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/users/123", "/users/{id}"},
+		{"/users/123/", "/users/{id}"},
+		// 先に登録したテンプレートが優先される
+		{"/users/me", "/users/{id}"},
+		{"/files/a/b/c", "/files/*"},
+		{"/files", "/files/*"},
+		{"/", "/"},
+		{"", "/"},
+		// 一致しないパスは、ID らしきセグメントの有無にかかわらず固定のルートにまとめる
+		{"/users/123/posts", UnmatchedRoute},
+		{"/orders/5f2b8c1e-aaaa-bbbb-cccc-1234567890ab", UnmatchedRoute},
+		{"/search/alice", UnmatchedRoute},
+	}
+	for _, tt := range tests {
+		if got := routes.Normalize(tt.path); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+// recorderFunc は関数を Recorder として使用するための型
+type recorderFunc func(RequestResult)
+
+func (f recorderFunc) Record(result RequestResult) { f(result) }
+
+func TestWithRouteTemplates(t *testing.T) {
+	var routes []string
+	rt := NewRetryableTransport(okTransport, 1, func(*http.Response, error) bool { return false }, Constant(0), WithoutLogging(),
+		WithRouteTemplates(NewRouteTemplates("/users/{id}")),
+		WithRecorder(recorderFunc(func(result RequestResult) { routes = append(routes, result.Route) })))
+
+	for _, path := range []string{"/users/1", "/users/2", "/unknown/3"} {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com"+path, nil)
+		res, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+	if want := []string{"/users/{id}", "/users/{id}", UnmatchedRoute}; !reflect.DeepEqual(routes, want) {
+		t.Errorf("recorded routes = %q, want %q", routes, want)
+	}
+}
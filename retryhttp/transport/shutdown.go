@@ -0,0 +1,136 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrShutdown は、Shutdown を呼び出した RetryableTransport でリクエストを送信しようとしたことを表すエラー
+var ErrShutdown = errors.New("retryable transport is shut down")
+
+// shutdownState は、Shutdown の状態と送信中の RoundTrip の数を管理する
+type shutdownState struct {
+	mu     sync.Mutex
+	closed bool
+	active int
+	// ctx は Shutdown でキャンセルする context.Context。バックオフの待機を中断するために使用する
+	ctx    context.Context
+	cancel context.CancelFunc
+	// drained は Shutdown の後に送信中の RoundTrip がなくなるとクローズする
+	drained chan struct{}
+}
+
+// init は、遅延して context.Context とチャネルを作成する。呼び出し元でロックを取得する
+func (s *shutdownState) init() {
+	if s.ctx == nil {
+		s.ctx, s.cancel = context.WithCancel(context.Background())
+		s.drained = make(chan struct{})
+	}
+}
+
+// enter は RoundTrip の開始を記録する。Shutdown の後の場合は false を返却する
+func (s *shutdownState) enter() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.active++
+	return true
+}
+
+// leave は RoundTrip の終了を記録する
+func (s *shutdownState) leave() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.active--
+	// NOTE: Shutdown の後は enter が失敗するため、0 になるのは 1 回のみ
+	if s.closed && s.active == 0 {
+		close(s.drained)
+	}
+}
+
+// done は Shutdown でキャンセルする context.Context を返却する
+func (s *shutdownState) done() context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.init()
+	return s.ctx
+}
+
+// shutdown は Shutdown の状態にして、送信中の RoundTrip がなくなるとクローズするチャネルを返却する
+func (s *shutdownState) shutdown() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.init()
+	if !s.closed {
+		s.closed = true
+		s.cancel()
+		if s.active == 0 {
+			close(s.drained)
+		}
+	}
+	return s.drained
+}
+
+// isClosed は Shutdown を呼び出したか返却する
+func (s *shutdownState) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closed
+}
+
+// Shutdown は、新しいリクエストと送信中のリクエストのリトライを停止し、アイドル状態のコネクションをクローズする
+// バックオフの待機中のリクエストは即座に ErrShutdown を返却する。送信中の試行は中断せず、その結果を返却する
+// 送信中のリクエストがすべて終了するか ctx が終了するまで待機し、ctx が終了した場合は ctx.Err() を返却する
+// NOTE: サービスの停止時に、リトライの完了を待たずに終了するために使用する。Shutdown の後は再開できない
+func (t *RetryableTransport) Shutdown(ctx context.Context) error {
+	drained := t.shutdown.shutdown()
+	t.CloseIdleConnections()
+
+	select {
+	case <-drained:
+		t.CloseIdleConnections()
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close は、送信中のリクエストの終了を待たずに Shutdown と同様にリトライを停止する
+func (t *RetryableTransport) Close() error {
+	t.shutdown.shutdown()
+	t.CloseIdleConnections()
+	return nil
+}
+
+// CloseIdleConnections は、親の Transport のアイドル状態のコネクションをクローズする
+func (t *RetryableTransport) CloseIdleConnections() {
+	if closer, ok := t.transport().(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+	t.closeProxyTransports()
+}
+
+// sleepUnlessShutdown は、バックオフの待機時間だけ待機する。待機中に Shutdown を呼び出した場合は ErrShutdown を返却する
+func (t *RetryableTransport) sleepUnlessShutdown(ctx context.Context, d time.Duration) error {
+	sleepCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	stop := context.AfterFunc(t.shutdown.done(), func() {
+		cancel(ErrShutdown)
+	})
+	defer stop()
+
+	err := t.sleep(sleepCtx, d)
+	if err != nil && errors.Is(context.Cause(sleepCtx), ErrShutdown) && ctx.Err() == nil {
+		return ErrShutdown
+	}
+	return err
+}
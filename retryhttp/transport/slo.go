@@ -0,0 +1,97 @@
+package transport
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// latencySLOKey は context.Context にレイテンシーの SLO を格納するためのキー
+type latencySLOKey struct{}
+
+// LatencySLO はリクエストの種類ごとに期待するレイテンシー
+type LatencySLO struct {
+	// Class はリクエストの種類 (例: "search", "checkout")
+	Class string
+	// Threshold は期待するリトライとバックオフを含むリクエスト全体のレイテンシーの上限
+	Threshold time.Duration
+}
+
+// WithLatencySLO は context.Context にリクエストの種類と期待するレイテンシーを格納する
+func WithLatencySLO(ctx context.Context, class string, threshold time.Duration) context.Context {
+	return context.WithValue(ctx, latencySLOKey{}, LatencySLO{Class: class, Threshold: threshold})
+}
+
+// LatencySLOFromContext は context.Context に格納されたレイテンシーの SLO を返却する
+func LatencySLOFromContext(ctx context.Context) (LatencySLO, bool) {
+	slo, ok := ctx.Value(latencySLOKey{}).(LatencySLO)
+	return slo, ok
+}
+
+// SLOViolation は、リクエストのレイテンシーが SLO を超えたことを表す
+type SLOViolation struct {
+	LatencySLO
+	// Result は SLO を超えたリクエストの結果。成功したリクエストも含む
+	Result RequestResult
+}
+
+// SLOStats はリクエストの種類ごとの SLO の集計
+type SLOStats struct {
+	Requests   int64
+	Violations int64
+}
+
+// SLORecorder は、レイテンシーの SLO を超えたリクエストを集計し、通知するための Recorder 具象型
+// NOTE: 成功したリクエストも集計するため、リトライのメトリクスには表れない「遅いが成功する」上流の状態を検出できる
+// レイテンシーは RoundTrip がレスポンスを返却するまでの時間で、レスポンスボディの読み込みは含まない
+type SLORecorder struct {
+	onViolation func(SLOViolation)
+
+	mu    sync.Mutex
+	stats map[string]*SLOStats
+}
+
+// NewSLORecorder は SLORecorder 構造体を作成する。onViolation は SLO を超えるたびに呼び出され、nil の場合は集計のみを行う
+func NewSLORecorder(onViolation func(SLOViolation)) *SLORecorder {
+	return &SLORecorder{
+		onViolation: onViolation,
+		stats:       make(map[string]*SLOStats),
+	}
+}
+
+// Record は、WithLatencySLO が指定されたリクエストのレイテンシーを集計する
+func (r *SLORecorder) Record(result RequestResult) {
+	slo := result.SLO
+	if slo.Threshold <= 0 {
+		return
+	}
+	violated := result.Duration > slo.Threshold
+
+	r.mu.Lock()
+	stats, ok := r.stats[slo.Class]
+	if !ok {
+		stats = &SLOStats{}
+		r.stats[slo.Class] = stats
+	}
+	stats.Requests++
+	if violated {
+		stats.Violations++
+	}
+	r.mu.Unlock()
+
+	if violated && r.onViolation != nil {
+		r.onViolation(SLOViolation{LatencySLO: slo, Result: result})
+	}
+}
+
+// Stats はリクエストの種類ごとの SLO の集計を返却する
+func (r *SLORecorder) Stats() map[string]SLOStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := make(map[string]SLOStats, len(r.stats))
+	for class, s := range r.stats {
+		stats[class] = *s
+	}
+	return stats
+}
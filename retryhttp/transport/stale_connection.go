@@ -0,0 +1,63 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"syscall"
+)
+
+// WithoutStaleConnectionRetry は、再利用したコネクションがサーバーにクローズされていた場合に、新しいコネクションで即座にリトライする動作を無効にする
+func WithoutStaleConnectionRetry() Option {
+	return func(t *RetryableTransport) {
+		t.noStaleConnectionRetry = true
+	}
+}
+
+// shouldRetryStaleConnection は、新しいコネクションで 1 回だけリトライすべき、再利用したコネクションの切断か判定する
+// NOTE: サーバーがアイドル状態のコネクションをクローズした直後に再利用すると、io.EOF などで失敗する
+// net/http と同様に、リクエストを書き込む前に失敗した場合はサーバーが処理していないため、冪等でないリクエストでもバックオフせずにリトライする
+func (t *RetryableTransport) shouldRetryStaleConnection(req *http.Request, err error, m *ResponseMetadata, retried bool) bool {
+	if t.noStaleConnectionRetry || retried || err == nil || !canRewind(req) {
+		return false
+	}
+	if !m.attemptReusedConnection() || !isStaleConnectionError(err) || isResponseValidationError(err) {
+		return false
+	}
+	return isIdempotent(req) || !m.attemptWroteHeaders()
+}
+
+// isStaleConnectionError は、サーバーにクローズされたコネクションを使用した場合の送信エラーか判定する
+func isStaleConnectionError(err error) bool {
+	switch {
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return true
+	}
+	// NOTE: net/http の errServerClosedIdle は公開されていないため、メッセージで判定する
+	return strings.Contains(err.Error(), "server closed idle connection")
+}
+
+// StaleConnectionRetries は、再利用したコネクションがサーバーにクローズされていたため、新しいコネクションでリトライした回数を返却する
+// NOTE: 値が大きい場合は、サーバーのキープアライブのタイムアウトより http.Transport の IdleConnTimeout が長い
+func (t *RetryableTransport) StaleConnectionRetries() int64 {
+	return t.staleConnectionRetries.Load()
+}
+
+// attemptReusedConnection は、現在の試行でアイドル状態のコネクションを再利用したか
+func (m *ResponseMetadata) attemptReusedConnection() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.reusedConnection
+}
+
+// attemptWroteHeaders は、現在の試行でリクエストヘッダーの書き込みを開始したか
+func (m *ResponseMetadata) attemptWroteHeaders() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.wroteHeaders
+}
@@ -0,0 +1,34 @@
+package transport
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// StartupJitter は、0 以上 max 未満のランダムな時間を返却する。max が 0 以下の場合は 0
+func StartupJitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+// StartupDelay は、0 以上 max 未満のランダムな時間か ctx が終了するまで待機する。ctx が終了した場合は ctx.Err() を返却する
+// NOTE: 多数のレプリカが同時に再起動した場合に、定期的な処理や再接続のループが同じタイミングで送信を始め、
+// 送信先に負荷が集中する (thundering herd) のを防ぐために、ループの開始前に 1 回だけ呼び出す
+func StartupDelay(ctx context.Context, max time.Duration) error {
+	wait := StartupJitter(max)
+	if wait <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,126 @@
+package transport
+
+import (
+	"expvar"
+	"net/http"
+	"sync/atomic"
+)
+
+// retryCause は、TransportStats.Retries で集計するリトライの原因
+type retryCause int
+
+const (
+	retryCauseThrottle retryCause = iota
+	retryCauseServerError
+	retryCauseNetworkError
+	retryCauseMisdirected
+	retryCauseStaleConnection
+	retryCauseAuthRefresh
+	retryCauseRequestReduced
+	retryCauseHTTP2Refused
+	retryCauseOther
+	retryCauseCount
+)
+
+func (c retryCause) String() string {
+	switch c {
+	case retryCauseThrottle:
+		return ThrottleClass.String()
+	case retryCauseServerError:
+		return ServerErrorClass.String()
+	case retryCauseNetworkError:
+		return NetworkErrorClass.String()
+	case retryCauseMisdirected:
+		return "misdirected"
+	case retryCauseStaleConnection:
+		return "stale_connection"
+	case retryCauseAuthRefresh:
+		return "auth_refresh"
+	case retryCauseRequestReduced:
+		return "request_reduced"
+	case retryCauseHTTP2Refused:
+		return "http2_refused"
+	default:
+		return "other"
+	}
+}
+
+// classifyRetryCause は、バックオフしてリトライする試行の結果をリトライの原因に分類する
+func classifyRetryCause(res *http.Response, err error) retryCause {
+	class, ok := ClassifyRetry(res, err)
+	if !ok {
+		return retryCauseOther
+	}
+	switch class {
+	case ThrottleClass:
+		return retryCauseThrottle
+	case ServerErrorClass:
+		return retryCauseServerError
+	default:
+		return retryCauseNetworkError
+	}
+}
+
+// TransportStats は、RetryableTransport の作成からの累計の統計情報
+type TransportStats struct {
+	// Requests は RoundTrip を呼び出したリクエストの数
+	Requests int64 `json:"requests"`
+	// Attempts はリトライを含めて送信した試行の数
+	Attempts int64 `json:"attempts"`
+	// Retries はリトライの理由ごとのリトライの数
+	// 理由は throttle、server_error、network_error、misdirected、stale_connection、auth_refresh、request_reduced、other
+	Retries map[string]int64 `json:"retries"`
+	// Exhausted は試行回数や予算などの上限に達したため、リトライを中止したリクエストの数
+	Exhausted int64 `json:"exhausted"`
+	// InFlight は送信中のリクエストの数。バックオフの待機中のリクエストを含む
+	InFlight int64 `json:"in_flight"`
+	// Circuits は、WithCircuitBreaker が設定されている場合の、ホストごとのサーキットブレーカーの状態
+	Circuits map[string]string `json:"circuits,omitempty"`
+}
+
+// transportStats は、TransportStats を集計するカウンター
+type transportStats struct {
+	requests  atomic.Int64
+	attempts  atomic.Int64
+	retries   [retryCauseCount]atomic.Int64
+	exhausted atomic.Int64
+	inFlight  atomic.Int64
+}
+
+// retry は、cause によるリトライを集計する
+func (s *transportStats) retry(cause retryCause) {
+	s.retries[cause].Add(1)
+}
+
+// Stats は、リクエスト、試行、理由ごとのリトライ、上限に達したリクエスト、送信中のリクエストの数と、サーキットブレーカーの状態を返却する
+// NOTE: トラフィックの急増がリトライによるものか、実際の負荷によるものかを運用者が判断するために使用する
+// Attempts と Requests の差がリトライによって増えた送信数になる
+func (t *RetryableTransport) Stats() TransportStats {
+	stats := TransportStats{
+		Requests:  t.stats.requests.Load(),
+		Attempts:  t.stats.attempts.Load(),
+		Retries:   make(map[string]int64, retryCauseCount),
+		Exhausted: t.stats.exhausted.Load(),
+		InFlight:  t.stats.inFlight.Load(),
+	}
+	for cause := retryCause(0); cause < retryCauseCount; cause++ {
+		stats.Retries[cause.String()] = t.stats.retries[cause].Load()
+	}
+	if t.breaker != nil {
+		snapshots := t.breaker.Export()
+		stats.Circuits = make(map[string]string, len(snapshots))
+		for host, s := range snapshots {
+			stats.Circuits[host] = s.State.String()
+		}
+	}
+	return stats
+}
+
+// PublishExpvar は、Stats の値を name の expvar 変数として公開する
+// net/http/pprof と同様に、http.DefaultServeMux の /debug/vars から JSON で参照できる
+// NOTE: expvar.Publish と同様に、同じ name で複数回呼び出すとパニックするため、起動時に 1 回だけ呼び出す
+func (t *RetryableTransport) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		return t.Stats()
+	}))
+}
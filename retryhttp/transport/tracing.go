@@ -0,0 +1,86 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName は RetryableTransport が作成するスパンの計装スコープ名
+const tracerName = "github.com/mtnori/httpRetryExample/retryhttp/transport"
+
+// WithTracerProvider は、OpenTelemetry のトレースを有効にする
+// RoundTrip ごとに親のスパンを、試行ごとに子のスパンを作成し、試行回数、ステータスコード、バックオフ、最終的な結果を記録する
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(t *RetryableTransport) {
+		t.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// startSpan はリクエスト全体のスパンを開始する。終了する関数には最終的な結果を渡す
+func (t *RetryableTransport) startSpan(ctx context.Context, req *http.Request) (context.Context, func(res *http.Response, err error, attempts int, exhausted bool)) {
+	if t.tracer == nil {
+		return ctx, func(*http.Response, error, int, bool) {}
+	}
+	ctx, span := t.tracer.Start(ctx, "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("server.address", req.URL.Host),
+			attribute.String("url.full", req.URL.Redacted()),
+		),
+		trace.WithAttributes(AnnotationsFromContext(ctx).spanAttributes()...),
+	)
+	return ctx, func(res *http.Response, err error, attempts int, exhausted bool) {
+		span.SetAttributes(
+			attribute.Int("http.retry.attempts", attempts),
+			attribute.Bool("http.retry.exhausted", exhausted),
+		)
+		endSpan(span, res, err)
+	}
+}
+
+// startAttemptSpan は試行のスパンを開始し、スパンを格納したリクエストを返却する
+func (t *RetryableTransport) startAttemptSpan(req *http.Request, attempt int) (*http.Request, func(res *http.Response, err error)) {
+	if t.tracer == nil {
+		return req, func(*http.Response, error) {}
+	}
+	ctx, span := t.tracer.Start(req.Context(), "HTTP "+req.Method+" attempt",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.Int("http.retry.attempt", attempt)),
+	)
+	return req.WithContext(ctx), func(res *http.Response, err error) {
+		endSpan(span, res, err)
+	}
+}
+
+// spanBackoff はリトライ前のバックオフをリクエスト全体のスパンにイベントとして記録する
+func (t *RetryableTransport) spanBackoff(ctx context.Context, attempt int, wait time.Duration) {
+	// NOTE: トレースが無効な場合に、呼び出し元のスパンにイベントを記録しないようにする
+	if t.tracer == nil {
+		return
+	}
+	trace.SpanFromContext(ctx).AddEvent("backoff", trace.WithAttributes(
+		attribute.Int("http.retry.attempt", attempt),
+		attribute.Int64("http.retry.backoff_ms", wait.Milliseconds()),
+	))
+}
+
+// endSpan はレスポンスのステータスコードまたはエラーを記録してスパンを終了する
+func endSpan(span trace.Span, res *http.Response, err error) {
+	switch {
+	case err != nil:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	case res != nil:
+		span.SetAttributes(attribute.Int("http.response.status_code", res.StatusCode))
+		if res.StatusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(res.StatusCode))
+		}
+	}
+	span.End()
+}
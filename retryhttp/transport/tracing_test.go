@@ -0,0 +1,77 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordingTracerProvider は、作成したスパンの名前と開始時の属性を記録する trace.TracerProvider
+type recordingTracerProvider struct {
+	embedded.TracerProvider
+
+	mu    sync.Mutex
+	spans map[string][]attribute.KeyValue
+}
+
+func (p *recordingTracerProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return &recordingTracer{provider: p}
+}
+
+type recordingTracer struct {
+	embedded.Tracer
+	provider *recordingTracerProvider
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	config := trace.NewSpanStartConfig(opts...)
+	t.provider.mu.Lock()
+	t.provider.spans[name] = config.Attributes()
+	t.provider.mu.Unlock()
+	return noop.NewTracerProvider().Tracer("").Start(ctx, name)
+}
+
+func TestStartSpanAnnotations(t *testing.T) {
+	tp := &recordingTracerProvider{spans: make(map[string][]attribute.KeyValue)}
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+	})
+	transport := NewRetryableTransport(base, 0, func(*http.Response, error) bool { return false }, func(int) time.Duration { return 0 },
+		WithTracerProvider(tp), WithoutLogging())
+
+	ctx := Annotate(context.Background(), "tenant", "acme", "feature", "checkout")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com/", nil)
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	attrs := make(map[attribute.Key]string)
+	for _, attr := range tp.spans["HTTP GET"] {
+		attrs[attr.Key] = attr.Value.Emit()
+	}
+	for key, want := range map[attribute.Key]string{
+		"http.request.annotation.tenant":  "acme",
+		"http.request.annotation.feature": "checkout",
+	} {
+		if got := attrs[key]; got != want {
+			t.Errorf("span attribute %s: got %q, want %q", key, got, want)
+		}
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,81 @@
+package transport
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxValidationBytes は、WithValidateResponse で検証するためにバッファリングするレスポンスボディの最大バイト数
+// NOTE: これより大きいボディは検証せずに、読み込んだ先頭を含めて復元して返却する
+const maxValidationBytes = 1 << 20
+
+// ResponseValidationError は、WithValidateResponse で指定した関数がレスポンスを不正と判定したことを表すエラー
+// リトライを使い切った場合は *RetryExhaustedError にラップされる
+type ResponseValidationError struct {
+	// StatusCode は不正と判定したレスポンスのステータスコード
+	StatusCode int
+	Err        error
+}
+
+func (e *ResponseValidationError) Error() string {
+	return fmt.Sprintf("invalid response (status %d): %v", e.StatusCode, e.Err)
+}
+
+func (e *ResponseValidationError) Unwrap() error {
+	return e.Err
+}
+
+// WithValidateResponse は、レスポンスを受け取った試行ごとにレスポンスを validate で検証し、エラーを返却した場合はリトライする
+// 例えば、ボディが {"status":"error"} の 200 や、途中で切断されたボディを検出してリトライするために使用する
+// NOTE: validate はレスポンスボディを読み込んでよい。ボディはバッファリングして検証の後に最初から読み込めるように復元する
+// ボディの読み込みに失敗した場合は、validate を呼び出さずに不正なレスポンスとみなす。1 MiB を超えるボディは検証しない
+func WithValidateResponse(validate func(*http.Response) error) Option {
+	return func(t *RetryableTransport) {
+		t.validateResponse = validate
+	}
+}
+
+// validate は、WithValidateResponse が指定されている場合にレスポンスを検証し、不正な場合は *ResponseValidationError を返却する
+func (t *RetryableTransport) validate(res *http.Response, err error) error {
+	if t.validateResponse == nil || err != nil || res == nil {
+		return nil
+	}
+	if res.Body == nil || res.Body == http.NoBody {
+		return validationError(res, t.validateResponse(res))
+	}
+
+	// NOTE: 上限を超えたか判定するため、1 バイト多く読み込む
+	body, readErr := io.ReadAll(io.LimitReader(res.Body, maxValidationBytes+1))
+	if readErr != nil {
+		_ = res.Body.Close()
+		res.Body = io.NopCloser(bytes.NewReader(body))
+		return validationError(res, fmt.Errorf("read response body: %w", readErr))
+	}
+	if len(body) > maxValidationBytes {
+		res.Body = &peekedBody{head: body, rest: res.Body, closer: res.Body}
+		return nil
+	}
+	_ = res.Body.Close()
+
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	validateErr := t.validateResponse(res)
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	return validationError(res, validateErr)
+}
+
+// validationError は、検証のエラーを *ResponseValidationError にラップする
+func validationError(res *http.Response, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ResponseValidationError{StatusCode: res.StatusCode, Err: err}
+}
+
+// isResponseValidationError は、WithValidateResponse の検証に失敗したエラーか判定する
+func isResponseValidationError(err error) bool {
+	var validationErr *ResponseValidationError
+	return errors.As(err, &validationErr)
+}
@@ -0,0 +1,142 @@
+package tuning
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	retryabletransport "github.com/mtnori/httpRetryExample/retryhttp/transport"
+)
+
+// ErrUnsafeMethod は、副作用のあるメソッドで計測しようとした場合のエラー
+var ErrUnsafeMethod = errors.New("tuning probes only support GET and HEAD")
+
+// ProbeConfig は計測の設定
+type ProbeConfig struct {
+	URL string
+	// Method は GET または HEAD。空文字列の場合は GET
+	Method string
+	// Requests は送信するリクエスト数
+	Requests int
+	// Concurrency は同時に送信するリクエスト数
+	Concurrency int
+	// Timeout は 1 回のリクエストのタイムアウト。タイムアウトしたリクエストは送信エラーとして集計する
+	Timeout time.Duration
+	// Transport はリクエストを送信する Transport。nil の場合は http.DefaultTransport
+	// NOTE: 計測結果にリトライが含まれないように、RetryableTransport は指定しない
+	Transport http.RoundTripper
+}
+
+// ProbeResult は計測結果
+type ProbeResult struct {
+	Requests int
+	// Errors は送信エラー (タイムアウトを含む) の数
+	Errors int
+	// Throttled は 429 または 503 の数
+	Throttled int
+	// ServerErrors は 503 以外の 5xx の数
+	ServerErrors int
+	// Latencies は送信エラー以外のリクエストのレイテンシー (昇順)
+	Latencies []time.Duration
+	// MaxRetryAfter は Retry-After ヘッダーで指定された最大の待機時間
+	MaxRetryAfter time.Duration
+}
+
+// Percentile はレイテンシーの p パーセンタイル (0 から 100) を返却する
+func (r *ProbeResult) Percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(r.Latencies)-1) * p / 100)
+	return r.Latencies[i]
+}
+
+// Probe は対象のエンドポイントに GET または HEAD のリクエストを送信し、レイテンシーの分布とレート制限の発生状況を計測する
+func Probe(ctx context.Context, config ProbeConfig) (*ProbeResult, error) {
+	if config.Method == "" {
+		config.Method = http.MethodGet
+	}
+	if config.Method != http.MethodGet && config.Method != http.MethodHead {
+		return nil, fmt.Errorf("%w: %s", ErrUnsafeMethod, config.Method)
+	}
+	if config.Requests <= 0 {
+		config.Requests = 100
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = 4
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 30 * time.Second
+	}
+	client := &http.Client{Transport: config.Transport, Timeout: config.Timeout}
+
+	var (
+		mu     sync.Mutex
+		result = &ProbeResult{}
+		wg     sync.WaitGroup
+		sem    = make(chan struct{}, config.Concurrency)
+	)
+	for i := 0; i < config.Requests; i++ {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return nil, ctx.Err()
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			latency, res, err := probeOnce(ctx, client, config)
+
+			mu.Lock()
+			defer mu.Unlock()
+			result.record(latency, res, err)
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(result.Latencies, func(i, j int) bool { return result.Latencies[i] < result.Latencies[j] })
+	return result, nil
+}
+
+// probeOnce は 1 回のリクエストを送信し、レスポンスボディを読み切るまでのレイテンシーを返却する
+func probeOnce(ctx context.Context, client *http.Client, config ProbeConfig) (time.Duration, *http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, config.Method, config.URL, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	start := time.Now()
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	_, err = io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	return time.Since(start), res, err
+}
+
+// record は 1 回のリクエストの結果を集計する
+func (r *ProbeResult) record(latency time.Duration, res *http.Response, err error) {
+	r.Requests++
+	if err != nil {
+		r.Errors++
+		return
+	}
+	r.Latencies = append(r.Latencies, latency)
+	switch {
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable:
+		r.Throttled++
+		if wait, ok := retryabletransport.ParseRetryAfter(res, time.Now()); ok {
+			r.MaxRetryAfter = max(r.MaxRetryAfter, wait)
+		}
+	case res.StatusCode >= http.StatusInternalServerError:
+		r.ServerErrors++
+	}
+}
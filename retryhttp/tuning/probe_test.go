@@ -0,0 +1,92 @@
+package tuning
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// roundTripFunc は関数を http.RoundTripper として使用するための型
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestProbe(t *testing.T) {
+	var calls atomic.Int64
+	var methods atomic.Value
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		methods.Store(req.Method)
+		res := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: io.NopCloser(strings.NewReader("ok")), Request: req}
+		// 10 件ごとに、送信エラー、429、503、500 を 1 件ずつ返却する
+		switch calls.Add(1) % 10 {
+		case 1:
+			return nil, errors.New("connection refused")
+		case 2:
+			res.StatusCode = http.StatusTooManyRequests
+			res.Header.Set("Retry-After", "7")
+		case 3:
+			res.StatusCode = http.StatusServiceUnavailable
+			res.Header.Set("Retry-After", "3")
+		case 4:
+			res.StatusCode = http.StatusInternalServerError
+		}
+		return res, nil
+	})
+
+	result, err := Probe(context.Background(), ProbeConfig{URL: "http://example.com/health", Method: http.MethodHead, Requests: 20, Concurrency: 3, Transport: transport})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Requests != 20 || result.Errors != 2 || result.Throttled != 4 || result.ServerErrors != 2 {
+		t.Errorf("result = %+v, want 20 requests with 2 errors, 4 throttled and 2 server errors", result)
+	}
+	if len(result.Latencies) != 18 || result.MaxRetryAfter != 7*time.Second {
+		t.Errorf("latencies = %d, MaxRetryAfter = %s, want 18 and 7s", len(result.Latencies), result.MaxRetryAfter)
+	}
+	for i := 1; i < len(result.Latencies); i++ {
+		if result.Latencies[i] < result.Latencies[i-1] {
+			t.Fatalf("latencies are not sorted: %v", result.Latencies)
+		}
+	}
+	if got := methods.Load(); got != http.MethodHead {
+		t.Errorf("method = %v, want HEAD", got)
+	}
+}
+
+func TestProbeUnsafeMethod(t *testing.T) {
+	transport := roundTripFunc(func(*http.Request) (*http.Response, error) {
+		t.Fatal("unsafe request was sent")
+		return nil, nil
+	})
+	if _, err := Probe(context.Background(), ProbeConfig{URL: "http://example.com/", Method: http.MethodPost, Transport: transport}); !errors.Is(err, ErrUnsafeMethod) {
+		t.Errorf("err = %v, want %v", err, ErrUnsafeMethod)
+	}
+}
+
+func TestProbeCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Probe(ctx, ProbeConfig{URL: "http://example.com/", Transport: http.DefaultTransport}); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	r := &ProbeResult{}
+	if got := r.Percentile(99); got != 0 {
+		t.Errorf("Percentile without latencies = %s, want 0", got)
+	}
+	for i := 1; i <= 100; i++ {
+		r.Latencies = append(r.Latencies, time.Duration(i)*time.Millisecond)
+	}
+	for p, want := range map[float64]time.Duration{0: time.Millisecond, 50: 50 * time.Millisecond, 99: 99 * time.Millisecond, 100: 100 * time.Millisecond} {
+		if got := r.Percentile(p); got != want {
+			t.Errorf("Percentile(%v) = %s, want %s", p, got, want)
+		}
+	}
+}
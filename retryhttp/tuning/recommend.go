@@ -0,0 +1,61 @@
+package tuning
+
+import (
+	"fmt"
+	"time"
+)
+
+// Recommendation は計測結果から算出したリトライポリシーの初期設定
+// NOTE: あくまで出発点であり、本番のトラフィックとエラーバジェットを見ながら調整する
+type Recommendation struct {
+	// PerAttemptTimeout は 1 回の試行のタイムアウト (TimeoutConfig.PerAttempt)
+	PerAttemptTimeout time.Duration
+	// BackoffBase と BackoffCap は ExponentialBackoff の引数
+	BackoffBase time.Duration
+	BackoffCap  time.Duration
+	// MaxAttempts は最初の試行を含む最大試行回数 (WithMaxAttempts)
+	MaxAttempts int
+	// Notes は設定の根拠
+	Notes []string
+}
+
+// Recommend は計測結果からリトライポリシーの初期設定を算出する
+func Recommend(r *ProbeResult) Recommendation {
+	var rec Recommendation
+	p50, p99 := r.Percentile(50), r.Percentile(99)
+
+	// 試行のタイムアウトは p99 の 2 倍とし、遅い試行を打ち切ってリトライできるようにする
+	rec.PerAttemptTimeout = roundUp(max(2*p99, time.Second))
+	rec.Notes = append(rec.Notes, fmt.Sprintf("per-attempt timeout is 2x p99 latency (%s)", p99))
+
+	// バックオフの初期値は p50 とし、サーバーの処理時間より短い間隔でリトライしないようにする
+	rec.BackoffBase = roundUp(max(p50, 100*time.Millisecond))
+	rec.BackoffCap = 10 * rec.BackoffBase
+	if r.MaxRetryAfter > rec.BackoffCap {
+		rec.BackoffCap = r.MaxRetryAfter
+		rec.Notes = append(rec.Notes, fmt.Sprintf("backoff cap raised to the largest Retry-After (%s)", r.MaxRetryAfter))
+	}
+
+	// 失敗率が高い場合は、リトライでトラフィックを増幅させないように試行回数を減らす
+	failureRate := 0.0
+	if r.Requests > 0 {
+		failureRate = float64(r.Errors+r.Throttled+r.ServerErrors) / float64(r.Requests)
+	}
+	switch {
+	case failureRate >= 0.5:
+		rec.MaxAttempts = 2
+		rec.Notes = append(rec.Notes, fmt.Sprintf("failure rate %.0f%% is high; retries would mostly amplify load, consider a circuit breaker", failureRate*100))
+	case r.Throttled > 0:
+		rec.MaxAttempts = 3
+		rec.Notes = append(rec.Notes, fmt.Sprintf("%d throttled responses; consider a retry budget", r.Throttled))
+	default:
+		rec.MaxAttempts = 4
+	}
+	return rec
+}
+
+// roundUp は表示しやすいように 100 ミリ秒単位に切り上げる
+func roundUp(d time.Duration) time.Duration {
+	const unit = 100 * time.Millisecond
+	return (d + unit - 1) / unit * unit
+}
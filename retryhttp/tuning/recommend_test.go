@@ -0,0 +1,71 @@
+package tuning
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// latencies は、すべてのリクエストが d の ProbeResult の Latencies を作成する
+func latencies(n int, d time.Duration) []time.Duration {
+	l := make([]time.Duration, n)
+	for i := range l {
+		l[i] = d
+	}
+	return l
+}
+
+func TestRecommend(t *testing.T) {
+	tests := []struct {
+		name   string
+		result ProbeResult
+		want   Recommendation
+	}{
+		{
+			name:   "healthy",
+			result: ProbeResult{Requests: 10, Latencies: latencies(10, 730*time.Millisecond)},
+			want:   Recommendation{PerAttemptTimeout: 1500 * time.Millisecond, BackoffBase: 800 * time.Millisecond, BackoffCap: 8 * time.Second, MaxAttempts: 4},
+		},
+		{
+			// タイムアウトとバックオフの初期値は下限を設ける
+			name:   "fast",
+			result: ProbeResult{Requests: 10, Latencies: latencies(10, time.Millisecond)},
+			want:   Recommendation{PerAttemptTimeout: time.Second, BackoffBase: 100 * time.Millisecond, BackoffCap: time.Second, MaxAttempts: 4},
+		},
+		{
+			name:   "throttled with long Retry-After",
+			result: ProbeResult{Requests: 10, Throttled: 2, MaxRetryAfter: 30 * time.Second, Latencies: latencies(10, 10*time.Millisecond)},
+			want:   Recommendation{PerAttemptTimeout: time.Second, BackoffBase: 100 * time.Millisecond, BackoffCap: 30 * time.Second, MaxAttempts: 3},
+		},
+		{
+			name:   "mostly failing",
+			result: ProbeResult{Requests: 10, Errors: 3, ServerErrors: 2, Latencies: latencies(7, 10*time.Millisecond)},
+			want:   Recommendation{PerAttemptTimeout: time.Second, BackoffBase: 100 * time.Millisecond, BackoffCap: time.Second, MaxAttempts: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Recommend(&tt.result)
+			if len(got.Notes) == 0 {
+				t.Error("Recommend returned no notes")
+			}
+			got.Notes = nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Recommend = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundUp(t *testing.T) {
+	for d, want := range map[time.Duration]time.Duration{
+		0:                      0,
+		time.Millisecond:       100 * time.Millisecond,
+		100 * time.Millisecond: 100 * time.Millisecond,
+		101 * time.Millisecond: 200 * time.Millisecond,
+	} {
+		if got := roundUp(d); got != want {
+			t.Errorf("roundUp(%s) = %s, want %s", d, got, want)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package wire
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OrderedHeaderTransport は、ヘッダーの大文字小文字と順序を指定どおりに送信する HTTP/1.1 の http.RoundTripper 具象型
+// net/http はヘッダー名を正規化 (Content-Type 形式) し、キーの昇順で送信するため、順序や表記に依存するレガシーなサーバーで使用する
+// 同じリクエストは常に同じバイト列として送信されるため、リトライ時もヘッダーの表記と順序は変わらない
+// NOTE: 動作を単純にするため、コネクションはリクエストごとに確立して Connection: close で送信する。HTTP/2 は使用しない
+// (HTTP/2 ではヘッダー名は小文字で送信される仕様のため、表記を制御できない)
+type OrderedHeaderTransport struct {
+	// Order は送信するヘッダーの順序。ここに指定した表記で送信する。指定していないヘッダーは後ろに昇順で送信する
+	Order []string
+	// Casing は Order に含まれないヘッダーの送信時の表記 (例: "Content-Md5" → "Content-MD5")
+	Casing map[string]string
+	// Dialer はコネクションの確立に使用する。nil の場合はデフォルトの net.Dialer
+	Dialer *net.Dialer
+	// TLSConfig は HTTPS の場合に使用する TLS の設定
+	TLSConfig *tls.Config
+}
+
+// RoundTrip はヘッダーの順序と表記を保ったままリクエストを送信する
+// メソッドやヘッダーに改行などの不正な文字が含まれる場合は、接続せずにエラーを返却する
+func (t *OrderedHeaderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	head, chunked, err := t.requestHead(req)
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	ctx := req.Context()
+	conn, err := t.dial(ctx, req)
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	// context.Context の終了時にコネクションをクローズして、読み書きを中断する
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+
+	if err := t.write(conn, req, head, chunked); err != nil {
+		stop()
+		conn.Close()
+		return nil, err
+	}
+
+	res, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		stop()
+		conn.Close()
+		return nil, err
+	}
+	res.Body = &connBody{ReadCloser: res.Body, conn: conn, stop: stop}
+	return res, nil
+}
+
+// dial はリクエスト先に接続する。HTTPS の場合は TLS ハンドシェイクを行う
+func (t *OrderedHeaderTransport) dial(ctx context.Context, req *http.Request) (net.Conn, error) {
+	dialer := t.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+
+	host := req.URL.Hostname()
+	port := req.URL.Port()
+	if port == "" {
+		port = "80"
+		if req.URL.Scheme == "https" {
+			port = "443"
+		}
+	}
+	addr := net.JoinHostPort(host, port)
+
+	if req.URL.Scheme != "https" {
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+
+	config := &tls.Config{}
+	if t.TLSConfig != nil {
+		config = t.TLSConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+	config.NextProtos = []string{"http/1.1"}
+	tlsDialer := &tls.Dialer{NetDialer: dialer, Config: config}
+	return tlsDialer.DialContext(ctx, "tcp", addr)
+}
+
+// requestHead は、リクエストラインとヘッダーの書き込むバイト列と、ボディを chunked で送信するかを返却する
+// NOTE: net/http と同様に、ヘッダーの行を分割して別のヘッダーを挿入されないように、不正なメソッドやヘッダーはエラーとする
+func (t *OrderedHeaderTransport) requestHead(req *http.Request) (string, bool, error) {
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	if !validHeaderFieldName(method) {
+		return "", false, fmt.Errorf("wire: invalid method %q", method)
+	}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	header := req.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	if header.Get("Host") == "" {
+		header.Set("Host", host)
+	}
+	header.Set("Connection", "close")
+	chunked := false
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.ContentLength > 0 {
+			header.Set("Content-Length", strconv.FormatInt(req.ContentLength, 10))
+		} else {
+			header.Set("Transfer-Encoding", "chunked")
+			chunked = true
+		}
+	}
+
+	lines, err := t.headerLines(header)
+	if err != nil {
+		return "", false, err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\r\n", method, req.URL.RequestURI())
+	for _, line := range lines {
+		b.WriteString(line + "\r\n")
+	}
+	b.WriteString("\r\n")
+	return b.String(), chunked, nil
+}
+
+// write は requestHead で作成したリクエストラインとヘッダー、ボディを書き込む
+func (t *OrderedHeaderTransport) write(conn net.Conn, req *http.Request, head string, chunked bool) error {
+	w := bufio.NewWriter(conn)
+	if _, err := w.WriteString(head); err != nil {
+		return err
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		defer req.Body.Close()
+		var body io.Writer = w
+		if chunked {
+			body = newChunkedWriter(w)
+		}
+		if _, err := io.Copy(body, req.Body); err != nil {
+			return err
+		}
+		if chunked {
+			if err := body.(*chunkedWriter).Close(); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// headerLines はヘッダーを "Name: value" の行に変換する。Order の順に並べ、残りは昇順で並べる
+// NOTE: Order に Host を含めない場合は、net/http と同様に Host を先頭に送信する
+func (t *OrderedHeaderTransport) headerLines(header http.Header) ([]string, error) {
+	var lines []string
+	written := make(map[string]bool, len(header))
+	add := func(name string, v string) error {
+		if !validHeaderFieldName(name) {
+			return fmt.Errorf("wire: invalid header field name %q", name)
+		}
+		if !validHeaderFieldValue(v) {
+			return fmt.Errorf("wire: invalid header field value for %q", name)
+		}
+		lines = append(lines, name+": "+v)
+		return nil
+	}
+
+	if !containsFold(t.Order, "Host") {
+		if err := add("Host", header.Get("Host")); err != nil {
+			return nil, err
+		}
+		written["Host"] = true
+	}
+
+	for _, name := range t.Order {
+		key := http.CanonicalHeaderKey(name)
+		values, ok := header[key]
+		if !ok {
+			// 正規化せずに設定されたヘッダーも対象とする
+			values, ok = header[name]
+			key = name
+		}
+		if !ok || written[key] {
+			continue
+		}
+		written[key] = true
+		for _, v := range values {
+			if err := add(name, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	rest := make([]string, 0, len(header))
+	for key := range header {
+		if !written[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	for _, key := range rest {
+		name := key
+		if casing, ok := t.Casing[key]; ok {
+			name = casing
+		}
+		for _, v := range header[key] {
+			if err := add(name, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return lines, nil
+}
+
+// validHeaderFieldName は、name が RFC 9110 の token (ヘッダー名、メソッド) として有効か判定する
+// NOTE: golang.org/x/net/http/httpguts の ValidHeaderFieldName と同じ判定
+func validHeaderFieldName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c >= 0x80 || !isTokenChar(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// isTokenChar は RFC 9110 の tchar か判定する
+func isTokenChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
+
+// validHeaderFieldValue は、v がヘッダーの値として有効か判定する。CR、LF、NUL などの制御文字 (水平タブを除く) を含む場合は無効
+// NOTE: golang.org/x/net/http/httpguts の ValidHeaderFieldValue と同じ判定
+func validHeaderFieldValue(v string) bool {
+	for i := 0; i < len(v); i++ {
+		if c := v[i]; c < ' ' && c != '\t' || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// containsFold は大文字小文字を区別せずにスライスに値が含まれるか判定する
+func containsFold(values []string, v string) bool {
+	for _, s := range values {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// connBody はレスポンスボディのクローズ時にコネクションもクローズする io.ReadCloser の具象型
+type connBody struct {
+	io.ReadCloser
+	conn net.Conn
+	stop func() bool
+}
+
+func (b *connBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.stop()
+	if closeErr := b.conn.Close(); err == nil && !isClosedConnError(closeErr) {
+		err = closeErr
+	}
+	return err
+}
+
+// isClosedConnError はクローズ済みのコネクションに対するエラーか判定する
+func isClosedConnError(err error) bool {
+	return err == nil || errors.Is(err, net.ErrClosed)
+}
+
+// chunkedWriter は chunked 転送エンコーディングで書き込む io.WriteCloser の具象型
+type chunkedWriter struct {
+	w      *bufio.Writer
+	closed bool
+}
+
+// newChunkedWriter は chunkedWriter 構造体を作成する
+func newChunkedWriter(w *bufio.Writer) *chunkedWriter {
+	return &chunkedWriter{w: w}
+}
+
+func (c *chunkedWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if _, err := fmt.Fprintf(c.w, "%x\r\n", len(p)); err != nil {
+		return 0, err
+	}
+	n, err := c.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	_, err = c.w.WriteString("\r\n")
+	return n, err
+}
+
+func (c *chunkedWriter) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	_, err := c.w.WriteString("0\r\n\r\n")
+	return err
+}
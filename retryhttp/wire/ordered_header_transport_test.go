@@ -0,0 +1,290 @@
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// rawServer は、受け付けたリクエストのヘッダーまでのバイト列とボディを記録し、固定のレスポンスを返却するテスト用のサーバー
+type rawServer struct {
+	listener net.Listener
+	requests chan rawRequest
+}
+
+// rawRequest は rawServer が受け付けたリクエスト
+type rawRequest struct {
+	head string
+	body string
+}
+
+// newRawServer は rawServer 構造体を作成して接続の受け付けを開始する
+func newRawServer(t *testing.T) *rawServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &rawServer{listener: listener, requests: make(chan rawRequest, 10)}
+	t.Cleanup(func() { listener.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *rawServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			var head strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				head.WriteString(line)
+				if line == "\r\n" {
+					break
+				}
+			}
+			// NOTE: ボディの形式 (Content-Length または chunked) の解析は net/http に任せる
+			req, err := http.ReadRequest(bufio.NewReader(io.MultiReader(strings.NewReader(head.String()), r)))
+			if err != nil {
+				return
+			}
+			body, _ := io.ReadAll(req.Body)
+			s.requests <- rawRequest{head: head.String(), body: string(body)}
+			io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok")
+		}()
+	}
+}
+
+// url は rawServer の URL を返却する
+func (s *rawServer) url(path string) string {
+	return "http://" + s.listener.Addr().String() + path
+}
+
+// roundTrip は transport でリクエストを送信し、サーバーが受け付けたリクエストを返却する
+func roundTrip(t *testing.T, s *rawServer, transport *OrderedHeaderTransport, req *http.Request) rawRequest {
+	t.Helper()
+
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil || string(body) != "ok" {
+		t.Errorf("response body = %q, %v", body, err)
+	}
+	if err := res.Body.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	return <-s.requests
+}
+
+func TestOrderedHeaderTransportOrder(t *testing.T) {
+	server := newRawServer(t)
+	transport := &OrderedHeaderTransport{
+		Order:  []string{"x-b", "Host", "X-A"},
+		Casing: map[string]string{"Content-Md5": "Content-MD5"},
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.url("/path?q=1"), nil)
+	req.Header.Set("X-A", "a")
+	req.Header["x-b"] = []string{"b1", "b2"}
+	req.Header.Set("Content-Md5", "md5")
+	req.Header.Set("Accept", "*/*")
+
+	got := roundTrip(t, server, transport, req).head
+	host := strings.TrimPrefix(server.url(""), "http://")
+	want := "GET /path?q=1 HTTP/1.1\r\n" +
+		"x-b: b1\r\n" +
+		"x-b: b2\r\n" +
+		"Host: " + host + "\r\n" +
+		"X-A: a\r\n" +
+		"Accept: */*\r\n" +
+		"Connection: close\r\n" +
+		"Content-MD5: md5\r\n" +
+		"\r\n"
+	if got != want {
+		t.Errorf("request head =\n%s\nwant\n%s", got, want)
+	}
+
+	// NOTE: リトライで同じリクエストを送信した場合も、同じバイト列になる
+	req2, _ := http.NewRequest(http.MethodGet, server.url("/path?q=1"), nil)
+	req2.Header = req.Header.Clone()
+	if again := roundTrip(t, server, transport, req2).head; again != got {
+		t.Errorf("second request head =\n%s\nwant\n%s", again, got)
+	}
+}
+
+// TestOrderedHeaderTransportHostFirst は、Order に Host を含めない場合に Host を先頭に送信することを検証する
+func TestOrderedHeaderTransportHostFirst(t *testing.T) {
+	server := newRawServer(t)
+	transport := &OrderedHeaderTransport{Order: []string{"X-First"}}
+
+	req, _ := http.NewRequest(http.MethodGet, server.url("/"), nil)
+	req.Host = "virtual.example.com"
+	req.Header.Set("X-First", "1")
+
+	lines := strings.Split(roundTrip(t, server, transport, req).head, "\r\n")
+	if lines[1] != "Host: virtual.example.com" || lines[2] != "X-First: 1" {
+		t.Errorf("header lines = %q, want Host first and then X-First", lines[1:3])
+	}
+}
+
+func TestOrderedHeaderTransportBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body io.Reader
+		// wantHeader は送信されるべきボディの長さのヘッダー
+		wantHeader string
+	}{
+		{"content length", strings.NewReader("hello"), "Content-Length: 5"},
+		{"chunked", io.MultiReader(strings.NewReader("hel"), bytes.NewReader([]byte("lo"))), "Transfer-Encoding: chunked"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRawServer(t)
+			req, _ := http.NewRequest(http.MethodPost, server.url("/upload"), tt.body)
+
+			got := roundTrip(t, server, &OrderedHeaderTransport{}, req)
+			if !strings.Contains(got.head, "\r\n"+tt.wantHeader+"\r\n") {
+				t.Errorf("request head = %q, want %q", got.head, tt.wantHeader)
+			}
+			if got.body != "hello" {
+				t.Errorf("body = %q, want %q", got.body, "hello")
+			}
+		})
+	}
+}
+
+// TestOrderedHeaderTransportRejectsInjection は、改行などでヘッダーを挿入できるリクエストを送信せずにエラーとすることを検証する
+func TestOrderedHeaderTransportRejectsInjection(t *testing.T) {
+	tests := []struct {
+		name      string
+		transport *OrderedHeaderTransport
+		modify    func(req *http.Request)
+		want      string
+	}{
+		{
+			name:   "CRLF in a value",
+			modify: func(req *http.Request) { req.Header.Set("X-Value", "v\r\nX-Injected: 1") },
+			want:   `wire: invalid header field value for "X-Value"`,
+		},
+		{
+			name:   "LF in a value",
+			modify: func(req *http.Request) { req.Header.Set("X-Value", "v\nX-Injected: 1") },
+			want:   `wire: invalid header field value for "X-Value"`,
+		},
+		{
+			name:   "NUL in a value",
+			modify: func(req *http.Request) { req.Header.Set("X-Value", "v\x00") },
+			want:   `wire: invalid header field value for "X-Value"`,
+		},
+		{
+			name:   "CRLF in a name",
+			modify: func(req *http.Request) { req.Header["X-Name\r\nX-Injected"] = []string{"1"} },
+			want:   `wire: invalid header field name "X-Name\r\nX-Injected"`,
+		},
+		{
+			name:   "space in a name",
+			modify: func(req *http.Request) { req.Header["X Name"] = []string{"1"} },
+			want:   `wire: invalid header field name "X Name"`,
+		},
+		{
+			name:      "value of a header in Order",
+			transport: &OrderedHeaderTransport{Order: []string{"X-Ordered"}},
+			modify:    func(req *http.Request) { req.Header.Set("X-Ordered", "v\r\n") },
+			want:      `wire: invalid header field value for "X-Ordered"`,
+		},
+		{
+			name:      "invalid Casing",
+			transport: &OrderedHeaderTransport{Casing: map[string]string{"X-Cased": "X-Cased:"}},
+			modify:    func(req *http.Request) { req.Header.Set("X-Cased", "v") },
+			want:      `wire: invalid header field name "X-Cased:"`,
+		},
+		{
+			name:   "CRLF in Host",
+			modify: func(req *http.Request) { req.Host = "example.com\r\nX-Injected: 1" },
+			want:   `wire: invalid header field value for "Host"`,
+		},
+		{
+			name:   "CRLF in the method",
+			modify: func(req *http.Request) { req.Method = "GET / HTTP/1.1\r\nX-Injected: 1\r\n\r\nGET" },
+			want:   "wire: invalid method",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRawServer(t)
+			transport := tt.transport
+			if transport == nil {
+				transport = &OrderedHeaderTransport{}
+			}
+			req, _ := http.NewRequest(http.MethodGet, server.url("/"), nil)
+			tt.modify(req)
+
+			res, err := transport.RoundTrip(req)
+			if err == nil {
+				res.Body.Close()
+				t.Fatal("RoundTrip succeeded, want an error")
+			}
+			if !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %s", err, tt.want)
+			}
+			select {
+			case got := <-server.requests:
+				t.Errorf("server received %q", got.head)
+			default:
+			}
+		})
+	}
+}
+
+func TestValidHeaderField(t *testing.T) {
+	for _, name := range []string{"X-Test", "x_test", "Content-MD5", "!#$%&'*+-.^_`|~09"} {
+		if !validHeaderFieldName(name) {
+			t.Errorf("validHeaderFieldName(%q) = false, want true", name)
+		}
+	}
+	for _, name := range []string{"", "X Test", "X-Test:", "X\tTest", "X-Tést", "(X)"} {
+		if validHeaderFieldName(name) {
+			t.Errorf("validHeaderFieldName(%q) = true, want false", name)
+		}
+	}
+	for _, v := range []string{"", "value", "a\tb", "quoted \"v\", (c)", "caf\xc3\xa9"} {
+		if !validHeaderFieldValue(v) {
+			t.Errorf("validHeaderFieldValue(%q) = false, want true", v)
+		}
+	}
+	for _, v := range []string{"a\rb", "a\nb", "a\x00b", "a\x7fb", "a\x1bb"} {
+		if validHeaderFieldValue(v) {
+			t.Errorf("validHeaderFieldValue(%q) = true, want false", v)
+		}
+	}
+}
+
+func TestIsClosedConnError(t *testing.T) {
+	server := newRawServer(t)
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if err := conn.Close(); err == nil || !isClosedConnError(err) {
+		t.Errorf("isClosedConnError(%v) = false, want true", err)
+	}
+	if isClosedConnError(io.ErrUnexpectedEOF) {
+		t.Error("isClosedConnError(io.ErrUnexpectedEOF) = true, want false")
+	}
+}